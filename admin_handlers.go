@@ -19,6 +19,10 @@ func init() {
 	base.Handle("/admin/prefill", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
 	base.Handle("/admin/templates", timeHandler(api, authenticated(createTemplate))).Methods("POST")
 	base.Handle("/admin/templates", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/admin/connections", timeHandler(api, authenticated(liveConnections))).Methods("GET")
+	base.Handle("/admin/connections", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/admin/push/failures", timeHandler(api, authenticated(pushFailures))).Methods("GET")
+	base.Handle("/admin/push/failures", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
 }
 
 //MissingParameterNetwork is the error you'll get if you don't give a network when you're manually creating a user.
@@ -30,7 +34,7 @@ var MissingParameterNetwork = gp.APIerror{Reason: "Missing parameter: network"}
 var MissingParameterPost = gp.APIerror{Reason: "Missing parameter: post"}
 
 func newVersionNotificationHandler(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
-	count, err := api.SendUpdateNotification(userID, r.FormValue("message"), r.FormValue("version"), r.FormValue("type"))
+	count, err := api.SendUpdateNotification(r.Context(), userID, r.FormValue("message"), r.FormValue("version"), r.FormValue("type"))
 	switch {
 	case err == lib.ENOTALLOWED:
 		jsonResponse(w, err, 403)
@@ -43,7 +47,7 @@ func newVersionNotificationHandler(userID gp.UserID, w http.ResponseWriter, r *h
 }
 
 func mm(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
-	err := api.Massmail(userID)
+	err := api.Massmail(r.Context(), userID)
 	switch {
 	case err == lib.ENOTALLOWED:
 		jsonResponse(w, err, 403)
@@ -54,6 +58,43 @@ func mm(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+//liveConnections lists the realtime connections this server is holding, optionally just for one user.
+func liveConnections(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	var forUser gp.UserID
+	if u, err := strconv.ParseUint(r.FormValue("user"), 10, 64); err == nil {
+		forUser = gp.UserID(u)
+	}
+	connections, err := api.LiveConnections(r.Context(), userID, forUser)
+	switch {
+	case err == lib.ENOTALLOWED:
+		jsonResponse(w, err, 403)
+	case err != nil:
+		jsonErr(w, err, 500)
+	default:
+		jsonResponse(w, connections, 200)
+	}
+}
+
+func pushFailures(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	var forUser gp.UserID
+	if u, err := strconv.ParseUint(r.FormValue("user"), 10, 64); err == nil {
+		forUser = gp.UserID(u)
+	}
+	limit := 100
+	if l, err := strconv.Atoi(r.FormValue("limit")); err == nil && l > 0 && l < limit {
+		limit = l
+	}
+	failures, err := api.PushFailures(r.Context(), userID, forUser, limit)
+	switch {
+	case err == lib.ENOTALLOWED:
+		jsonResponse(w, err, 403)
+	case err != nil:
+		jsonErr(w, err, 500)
+	default:
+		jsonResponse(w, failures, 200)
+	}
+}
+
 func postUsers(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	_netID, err := strconv.ParseUint(r.FormValue("network"), 10, 64)
 	if err != nil {
@@ -62,10 +103,13 @@ func postUsers(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	}
 	netID := gp.NetworkID(_netID)
 	verified, _ := strconv.ParseBool(r.FormValue("verified"))
-	_, err = api.UserCreateUserSpecial(userID, r.FormValue("first"), r.FormValue("last"), r.FormValue("email"), r.FormValue("pass"), verified, netID)
+	_, err = api.UserCreateUserSpecial(r.Context(), userID, r.FormValue("first"), r.FormValue("last"), r.FormValue("email"), r.FormValue("pass"), verified, netID)
+	_, invalid := err.(gp.ValidationErrors)
 	switch {
 	case err == lib.ENOTALLOWED:
 		jsonResponse(w, err, 403)
+	case invalid:
+		jsonResponse(w, err, 400)
 	case err != nil:
 		jsonErr(w, err, 500)
 	default:
@@ -81,7 +125,7 @@ func prefillNetwork(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	}
 	netID := gp.NetworkID(_netID)
 	name := r.FormValue("name")
-	err = api.AdminPrefillUniversity(userID, netID, name)
+	err = api.AdminPrefillUniversity(r.Context(), userID, netID, name)
 	switch {
 	case err == lib.ENOTALLOWED:
 		jsonResponse(w, err, 403)
@@ -99,7 +143,7 @@ func createTemplate(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	postID := gp.PostID(_postID)
-	id, err := api.AdminCreateTemplateFromPost(userID, postID)
+	id, err := api.AdminCreateTemplateFromPost(r.Context(), userID, postID)
 	switch {
 	case err == lib.ENOTALLOWED:
 		jsonResponse(w, err, 403)
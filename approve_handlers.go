@@ -25,7 +25,7 @@ func init() {
 }
 
 func permissionHandler(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
-	access, err := api.ApproveAccess(userID)
+	access, err := api.ApproveAccess(r.Context(), userID)
 	if err != nil {
 		jsonErr(w, err, 500)
 		return
@@ -34,7 +34,7 @@ func permissionHandler(userID gp.UserID, w http.ResponseWriter, r *http.Request)
 }
 
 func getApproveSettings(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
-	level, err := api.ApproveLevel(userID)
+	level, err := api.ApproveLevel(r.Context(), userID)
 	if err != nil {
 		jsonErr(w, err, 500)
 		return
@@ -45,10 +45,10 @@ func getApproveSettings(userID gp.UserID, w http.ResponseWriter, r *http.Request
 func postApproveSettings(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	_lev := r.FormValue("level")
 	level, _ := strconv.Atoi(_lev)
-	err := api.SetApproveLevel(userID, level)
+	err := api.SetApproveLevel(r.Context(), userID, level)
 	switch {
 	case err == nil:
-		level, err := api.ApproveLevel(userID)
+		level, err := api.ApproveLevel(r.Context(), userID)
 		if err != nil {
 			jsonErr(w, err, 500)
 			return
@@ -62,7 +62,7 @@ func postApproveSettings(userID gp.UserID, w http.ResponseWriter, r *http.Reques
 }
 
 func getApprovePending(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
-	pending, err := api.UserGetPending(userID)
+	pending, err := api.UserGetPending(r.Context(), userID)
 	switch {
 	case err == nil:
 		jsonResponse(w, pending, 200)
@@ -77,7 +77,7 @@ func postApproveApproved(userID gp.UserID, w http.ResponseWriter, r *http.Reques
 	_postID, _ := strconv.ParseUint(r.FormValue("post"), 10, 64)
 	postID := gp.PostID(_postID)
 	reason := r.FormValue("reason")
-	err := api.ApprovePost(userID, postID, reason)
+	err := api.ApprovePost(r.Context(), userID, postID, reason)
 	switch {
 	case err == nil:
 		w.WriteHeader(204)
@@ -90,7 +90,7 @@ func postApproveApproved(userID gp.UserID, w http.ResponseWriter, r *http.Reques
 
 func getApproveApproved(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	mode, index := interpretPagination(r)
-	approved, err := api.UserGetApproved(userID, mode, index, api.Config.PostPageSize)
+	approved, err := api.UserGetApproved(r.Context(), userID, mode, index, api.Config.PostPageSize)
 	switch {
 	case err == nil:
 		jsonResponse(w, approved, 200)
@@ -139,7 +139,7 @@ func postApproveRejected(userID gp.UserID, w http.ResponseWriter, r *http.Reques
 	_postID, _ := strconv.ParseUint(r.FormValue("post"), 10, 64)
 	postID := gp.PostID(_postID)
 	reason := r.FormValue("reason")
-	err := api.RejectPost(userID, postID, reason)
+	err := api.RejectPost(r.Context(), userID, postID, reason)
 	switch {
 	case err == nil:
 		w.WriteHeader(204)
@@ -152,7 +152,7 @@ func postApproveRejected(userID gp.UserID, w http.ResponseWriter, r *http.Reques
 
 func getApproveRejected(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	mode, index := interpretPagination(r)
-	rejected, err := api.UserGetRejected(userID, mode, index, api.Config.PostPageSize)
+	rejected, err := api.UserGetRejected(r.Context(), userID, mode, index, api.Config.PostPageSize)
 	switch {
 	case err == nil:
 		jsonResponse(w, rejected, 200)
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"math"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -18,6 +20,9 @@ func init() {
 	base.Handle("/login", timeHandler(api, http.HandlerFunc(loginHandler))).Methods("POST")
 	base.Handle("/login", timeHandler(api, http.HandlerFunc(optionsHandler))).Methods("OPTIONS")
 	base.Handle("/login", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/token/refresh", timeHandler(api, http.HandlerFunc(refreshHandler))).Methods("POST")
+	base.Handle("/token/refresh", timeHandler(api, http.HandlerFunc(optionsHandler))).Methods("OPTIONS")
+	base.Handle("/token/refresh", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
 	base.Handle("/register", timeHandler(api, http.HandlerFunc(registerHandler))).Methods("POST")
 	base.Handle("/register", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
 	base.Handle("/verify/{token}", timeHandler(api, http.HandlerFunc(verificationHandler))).Methods("POST")
@@ -28,14 +33,31 @@ func init() {
 	base.Handle("/profile/reset/{id:[0-9]+}/{token}", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
 	base.Handle("/resend_verification", timeHandler(api, http.HandlerFunc(resendVerificationHandler))).Methods("POST")
 	base.Handle("/resend_verification", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/profile/sessions", timeHandler(api, authenticated(getSessions))).Methods("GET")
+	base.Handle("/profile/sessions", timeHandler(api, authenticated(deleteAllSessions))).Methods("DELETE")
+	base.Handle("/profile/sessions", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/profile/sessions/{id:[0-9]+}", timeHandler(api, authenticated(deleteSession))).Methods("DELETE")
+	base.Handle("/profile/sessions/{id:[0-9]+}", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
 }
 
 //Note to self: validateToken should probably return an error at some point
 func authenticate(r *http.Request) (userID gp.UserID, err error) {
 	defer api.Statsd.Time(time.Now(), "gleepost.auth.authenticate")
+	userID, token := credentials(r)
+	success := api.Auth.ValidateToken(r.Context(), userID, token, requiredScope(r))
+	if success {
+		go api.Statsd.Count(1, "gleepost.auth.authenticate.fail")
+		return userID, nil
+	}
+	go api.Statsd.Count(1, "gleepost.auth.authenticate.success")
+	return 0, &EBADTOKEN
+}
+
+//credentials returns the id:token pair this request claims, from either the form values or the X-GP-Auth header.
+func credentials(r *http.Request) (userID gp.UserID, token string) {
 	id, _ := strconv.ParseUint(r.FormValue("id"), 10, 64)
 	userID = gp.UserID(id)
-	token := r.FormValue("token")
+	token = r.FormValue("token")
 	if len(token) == 0 {
 		credentialsFromHeader := strings.Split(r.Header.Get("X-GP-Auth"), "-")
 		id, _ = strconv.ParseUint(credentialsFromHeader[0], 10, 64)
@@ -44,13 +66,57 @@ func authenticate(r *http.Request) (userID gp.UserID, err error) {
 			token = credentialsFromHeader[1]
 		}
 	}
-	success := api.Auth.ValidateToken(userID, token)
-	if success {
-		go api.Statsd.Count(1, "gleepost.auth.authenticate.fail")
-		return userID, nil
+	return
+}
+
+//requiredScope is the token scope this request needs.
+func requiredScope(r *http.Request) string {
+	switch {
+	case strings.Contains(r.URL.Path, "/admin/"):
+		return gp.ScopeAdmin
+	case strings.Contains(r.URL.Path, "/approve/"):
+		return gp.ScopeApprove
+	case r.Method == "GET" || r.Method == "HEAD":
+		return gp.ScopeRead
+	default:
+		return gp.ScopeWrite
 	}
-	go api.Statsd.Count(1, "gleepost.auth.authenticate.success")
-	return 0, &EBADTOKEN
+}
+
+//clientIP is the address this request came from, as reported by the proxy in front of us.
+func clientIP(r *http.Request) string {
+	if ip := r.Header.Get("X-Real-IP"); len(ip) > 0 {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+//tooManyAttempts responds with a 429 and a Retry-After header if err is a lib.RateLimited, and reports whether it did.
+func tooManyAttempts(w http.ResponseWriter, err error) bool {
+	limited, ok := err.(lib.RateLimited)
+	if !ok {
+		return false
+	}
+	retry := int(math.Ceil(limited.RetryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retry))
+	jsonResponse(w, gp.APIerror{Reason: limited.Error()}, 429)
+	return true
+}
+
+//deviceLabel is what a new session will be listed as; clients may name themselves, otherwise we fall back to their user agent.
+func deviceLabel(r *http.Request) string {
+	device := r.FormValue("device")
+	if len(device) == 0 {
+		device = r.UserAgent()
+	}
+	if len(device) > 256 {
+		device = device[:256]
+	}
+	return device
 }
 
 func registerHandler(w http.ResponseWriter, r *http.Request) {
@@ -60,23 +126,12 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 	first := r.FormValue("first")
 	last := r.FormValue("last")
 	invite := r.FormValue("invite")
-	created, err := api.AttemptRegister(email, pass, first, last, invite)
+	created, err := api.AttemptRegister(r.Context(), email, pass, first, last, invite, deviceLabel(r))
+	_, invalid := err.(gp.ValidationErrors)
 	switch {
-	//Note to future self : would be neater if
-	//we returned _all_ errors not just the first
-	case err == lib.MissingParamFirst:
-		fallthrough
-	case err == lib.MissingParamLast:
-		fallthrough
-	case err == lib.MissingParamPass:
-		fallthrough
-	case err == lib.MissingParamEmail:
-		fallthrough
-	case err == lib.ETOOWEAK:
+	case invalid:
 		fallthrough
 	case err == lib.UserAlreadyExists:
-		fallthrough
-	case err == lib.InvalidEmail:
 		go api.Statsd.Count(1, "gleepost.auth.register.400")
 		jsonResponse(w, err, 400)
 	case err != nil:
@@ -91,8 +146,16 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 func loginHandler(w http.ResponseWriter, r *http.Request) {
 	email := r.FormValue("email")
 	pass := r.FormValue("pass")
-	token, verificationStatus, err := api.AttemptLogin(email, pass)
+	scopes, err := lib.ParseScopes(r.FormValue("scopes"))
+	if err != nil {
+		go api.Statsd.Count(1, "gleepost.auth.login.400")
+		jsonResponse(w, err, 400)
+		return
+	}
+	token, verificationStatus, err := api.AttemptLogin(r.Context(), email, pass, clientIP(r), deviceLabel(r), scopes)
 	switch {
+	case tooManyAttempts(w, err):
+		go api.Statsd.Count(1, "gleepost.auth.login.429")
 	case err != nil && err == lib.BadLogin:
 		go api.Statsd.Count(1, "gleepost.auth.login.400")
 		jsonResponse(w, err, 400)
@@ -108,10 +171,27 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+//refreshHandler swaps a refresh token for a new access token. The refresh token is only accepted in a POST body, never in the URL.
+func refreshHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := api.RefreshToken(r.Context(), r.PostFormValue("refresh_token"))
+	switch {
+	case err == lib.BadRefreshToken || err == lib.RefreshTokenReused:
+		go api.Statsd.Count(1, "gleepost.token.refresh.post.401")
+		jsonResponse(w, err, 401)
+	case err != nil:
+		go api.Statsd.Count(1, "gleepost.token.refresh.post.500")
+		jsonErr(w, err, 500)
+	default:
+		go api.Statsd.Count(1, "gleepost.token.refresh.post.200")
+		jsonResponse(w, token, 200)
+	}
+}
+
 func changePassHandler(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	oldPass := r.FormValue("old")
 	newPass := r.FormValue("new")
-	err := api.ChangePass(userID, oldPass, newPass)
+	_, token := credentials(r)
+	err := api.ChangePass(r.Context(), userID, token, oldPass, newPass)
 	if err != nil {
 		go api.Statsd.Count(1, "gleepost.profile.change_pass.post.400")
 		//Assuming that most errors will be bad input for now
@@ -124,7 +204,7 @@ func changePassHandler(userID gp.UserID, w http.ResponseWriter, r *http.Request)
 
 func verificationHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	err := api.Verify(vars["token"])
+	token, err := api.Verify(r.Context(), vars["token"], deviceLabel(r))
 	if err != nil {
 		go api.Statsd.Count(1, "gleepost.verify.post.400")
 		jsonResponse(w, gp.APIerror{Reason: "Bad verification token"}, 400)
@@ -132,14 +212,19 @@ func verificationHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	go api.Statsd.Count(1, "gleepost.verify.post.200")
 	jsonResponse(w, struct {
-		Verified bool `json:"verified"`
-	}{true}, 200)
+		Verified bool     `json:"verified"`
+		Token    gp.Token `json:"token"`
+	}{true, token}, 200)
 	return
 }
 
 func requestResetHandler(w http.ResponseWriter, r *http.Request) {
 	email := r.FormValue("email")
-	err := api.RequestReset(email)
+	err := api.RequestReset(r.Context(), email, clientIP(r))
+	if tooManyAttempts(w, err) {
+		go api.Statsd.Count(1, "gleepost.profile.request_reset.post.429")
+		return
+	}
 	if err != nil {
 		go api.Statsd.Count(1, "gleepost.profile.request_reset.post.400")
 		jsonErr(w, err, 400)
@@ -160,7 +245,7 @@ func resetPassHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	userID := gp.UserID(id)
 	pass := r.FormValue("pass")
-	err = api.ResetPass(userID, vars["token"], pass)
+	err = api.ResetPass(r.Context(), userID, vars["token"], pass)
 	if err != nil {
 		go api.Statsd.Count(1, "gleepost.profile.reset.post.400")
 		jsonErr(w, err, 400)
@@ -173,7 +258,7 @@ func resetPassHandler(w http.ResponseWriter, r *http.Request) {
 
 func resendVerificationHandler(w http.ResponseWriter, r *http.Request) {
 	email := r.FormValue("email")
-	err := api.AttemptResendVerification(email)
+	err := api.AttemptResendVerification(r.Context(), email)
 	switch {
 	case err == lib.NoSuchUser:
 		go api.Statsd.Count(1, "gleepost.resend_verification.post.400")
@@ -186,3 +271,37 @@ func resendVerificationHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(204)
 	}
 }
+
+func getSessions(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	_, token := credentials(r)
+	sessions, err := api.UserSessions(r.Context(), userID, token)
+	if err != nil {
+		jsonErr(w, err, 500)
+		return
+	}
+	jsonResponse(w, sessions, 200)
+}
+
+func deleteSession(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	_id, _ := strconv.ParseUint(vars["id"], 10, 64)
+	err := api.RevokeSession(r.Context(), userID, gp.SessionID(_id))
+	switch {
+	case err == lib.NoSuchSession:
+		jsonErr(w, err, 404)
+	case err != nil:
+		jsonErr(w, err, 500)
+	default:
+		w.WriteHeader(204)
+	}
+}
+
+//deleteAllSessions logs the user out everywhere, including this session.
+func deleteAllSessions(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	err := api.RevokeAllSessions(r.Context(), userID, "")
+	if err != nil {
+		jsonErr(w, err, 500)
+		return
+	}
+	w.WriteHeader(204)
+}
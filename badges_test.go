@@ -0,0 +1,127 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/Petergatsby/GleepostAPI/lib/conf"
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+func TestMessageBadges(t *testing.T) {
+	err := initDB()
+	if err != nil {
+		t.Fatal("Error initializing db:", err)
+	}
+	err = truncate("conversations", "conversation_participants", "chat_messages")
+	if err != nil {
+		t.Fatal("Error truncating:", err)
+	}
+	err = initPartner()
+	if err != nil {
+		t.Fatal("Error creating partner:", err)
+	}
+	once.Do(setup)
+	token, err := testingGetSession("patrick@fakestanford.edu", "TestingPass")
+	if err != nil {
+		t.Fatal("Error getting session:", err)
+	}
+	partner, err := testingGetSession("partner@fakestanford.edu", "TestingPass")
+	if err != nil {
+		t.Fatal("Error getting session:", err)
+	}
+	convID, err := conversationWith(token, partner.UserID)
+	if err != nil {
+		t.Fatal("Error creating conversation:", err)
+	}
+	batch, err := poll(partner, "", 0)
+	if err != nil {
+		t.Fatal("Error polling:", err)
+	}
+
+	//A new message counts towards the recipient's badge...
+	msgID, err := sendMessage(token, convID, "Unread")
+	if err != nil {
+		t.Fatal("Error sending message:", err)
+	}
+	cursor := waitForBadge(t, partner, batch.Cursor, 1)
+
+	//...until it's deleted.
+	resp, err := twoFactorRequest("DELETE", fmt.Sprintf("conversations/%d/messages/%d", convID, msgID), token, nil)
+	if err != nil {
+		t.Fatal("Error deleting message:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected %d, got %d\n", http.StatusNoContent, resp.StatusCode)
+	}
+	waitForBadge(t, partner, cursor, 0)
+}
+
+//waitForBadge polls token's stream from cursor until it sees a badge event with this many unread messages, and returns where it got to.
+func waitForBadge(t *testing.T, token gp.Token, cursor string, messages int) string {
+	for i := 0; i < 5; i++ {
+		batch, err := poll(token, cursor, 2)
+		if err != nil {
+			t.Fatal("Error polling:", err)
+		}
+		cursor = batch.Cursor
+		for _, e := range batch.Events {
+			var event struct {
+				Data struct {
+					Type string         `json:"type"`
+					Data gp.BadgeCounts `json:"data"`
+				} `json:"data"`
+			}
+			err = json.Unmarshal(e, &event)
+			if err != nil {
+				t.Fatal("Error parsing event:", err)
+			}
+			if event.Data.Type == "badge" && event.Data.Data.Messages == messages {
+				return cursor
+			}
+		}
+	}
+	t.Fatalf("Never saw a badge with %d unread messages\n", messages)
+	return cursor
+}
+
+//conversationWith starts a conversation between token's user and participant.
+func conversationWith(token gp.Token, participant gp.UserID) (convID gp.ConversationID, err error) {
+	data := make(url.Values)
+	data["participants"] = []string{fmt.Sprintf("%d", participant)}
+	resp, err := twoFactorRequest("POST", "conversations", token, data)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return convID, fmt.Errorf("expected %d, got %d", http.StatusCreated, resp.StatusCode)
+	}
+	var conv gp.ConversationAndMessages
+	err = json.NewDecoder(resp.Body).Decode(&conv)
+	return conv.ID, err
+}
+
+//initPartner adds a second verified user at Fake Stanford, partner@fakestanford.edu, for patrick to talk to.
+func initPartner() error {
+	db, err := sql.Open("mysql", conf.GetConfig().Mysql.ConnectionString())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	res, err := db.Exec("INSERT INTO `users` (`password`, `email`, `verified`, `firstname`, `lastname`) VALUES ('$2a$10$xLUmQbvrHAAOGuv4.uHAY.NmoLGEuEObENPiQ8kkh.Miyvdzhyge6', 'partner@fakestanford.edu', 1, 'Chat', 'Partner')")
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("INSERT INTO `user_network` (`user_id`, `network_id`) SELECT ?, id FROM network WHERE name = 'Fake Stanford'", id)
+	return err
+}
@@ -43,7 +43,7 @@ func TestChangePass(t *testing.T) {
 		NewPass:            "hi",
 		ExpectedStatusCode: http.StatusBadRequest,
 		ExpectedType:       "Error",
-		ExpectedError:      "Password too weak!",
+		ExpectedError:      "Password must be at least 8 characters",
 	}
 	testWrongOldPass := changePassTest{
 		Email:              "patrick@fakestanford.edu",
@@ -0,0 +1,58 @@
+//hashversions reports how many accounts are on each password hash version and bcrypt cost, and how many are due to be rehashed.
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/Petergatsby/GleepostAPI/lib"
+	"github.com/Petergatsby/GleepostAPI/lib/conf"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+func main() {
+	config := conf.GetConfig()
+	db, err := sql.Open("mysql", config.Mysql.ConnectionString())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	//bcrypt hashes look like $2a$10$..., where 10 is the cost.
+	rows, err := db.Query("SELECT password_version, SUBSTRING(password, 5, 2) AS cost, COUNT(*) FROM users GROUP BY password_version, cost ORDER BY password_version, cost")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+	target := config.Passwords.Cost()
+	fmt.Printf("Target: version %d, cost %d\n\n", lib.CurrentHashVersion, target)
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "version\tcost\taccounts\t")
+	var total, outdated int
+	for rows.Next() {
+		var version, count int
+		var cost sql.NullString
+		err = rows.Scan(&version, &cost, &count)
+		if err != nil {
+			log.Fatal(err)
+		}
+		c, err := strconv.Atoi(cost.String)
+		if err != nil {
+			fmt.Fprintf(w, "%d\t?\t%d\t\n", version, count)
+		} else {
+			fmt.Fprintf(w, "%d\t%d\t%d\t\n", version, c, count)
+		}
+		total += count
+		if version < lib.CurrentHashVersion || (err == nil && c < target) {
+			outdated += count
+		}
+	}
+	if err = rows.Err(); err != nil {
+		log.Fatal(err)
+	}
+	w.Flush()
+	fmt.Printf("\n%d of %d accounts will be rehashed when they next log in.\n", outdated, total)
+}
@@ -32,6 +32,12 @@ func init() {
 	base.Handle("/conversations/{id:[0-9]+}/messages", timeHandler(api, authenticated(putMessages))).Methods("PUT")
 	base.Handle("/conversations/{id:[0-9]+}/messages", timeHandler(api, http.HandlerFunc(optionsHandler))).Methods("OPTIONS")
 	base.Handle("/conversations/{id:[0-9]+}/messages", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/conversations/{id:[0-9]+}/messages/{message:[0-9]+}", timeHandler(api, authenticated(putMessage))).Methods("PUT")
+	base.Handle("/conversations/{id:[0-9]+}/messages/{message:[0-9]+}", timeHandler(api, authenticated(deleteMessage))).Methods("DELETE")
+	base.Handle("/conversations/{id:[0-9]+}/messages/{message:[0-9]+}", timeHandler(api, http.HandlerFunc(optionsHandler))).Methods("OPTIONS")
+	base.Handle("/conversations/{id:[0-9]+}/messages/{message:[0-9]+}", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/conversations/{id:[0-9]+}/messages/{message:[0-9]+}/edits", timeHandler(api, authenticated(getMessageEdits))).Methods("GET")
+	base.Handle("/conversations/{id:[0-9]+}/messages/{message:[0-9]+}/edits", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
 	base.Handle("/conversations/{id:[0-9]+}/participants", timeHandler(api, authenticated(postParticipants))).Methods("POST")
 	base.Handle("/conversations/{id:[0-9]+}/participants", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
 	base.Handle("/conversations/{id:[0-9]+}/files", timeHandler(api, authenticated(getFiles))).Methods("GET")
@@ -43,7 +49,7 @@ func getConversations(userID gp.UserID, w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		start = 0
 	}
-	conversations, err := api.GetConversations(userID, start, api.Config.ConversationPageSize)
+	conversations, err := api.GetConversations(r.Context(), userID, start, api.Config.ConversationPageSize)
 	if err != nil {
 		go api.Statsd.Count(1, "gleepost.conversations.get.500")
 		jsonErr(w, err, 500)
@@ -63,7 +69,7 @@ func postConversations(userID gp.UserID, w http.ResponseWriter, r *http.Request)
 			userIds = append(userIds, gp.UserID(id))
 		}
 	}
-	conversation, err := api.CreateConversationWith(userID, userIds)
+	conversation, err := api.CreateConversationWith(r.Context(), userID, userIds)
 	e, ok := err.(*gp.APIerror)
 	switch {
 	case ok && *e == gp.ENOSUCHUSER:
@@ -85,7 +91,7 @@ func postConversations(userID gp.UserID, w http.ResponseWriter, r *http.Request)
 }
 
 func maybeRedirect(w http.ResponseWriter, r *http.Request, conv gp.ConversationID, urlPattern string, statusCode int) bool {
-	mergedID, err := api.ConversationMergedInto(conv)
+	mergedID, err := api.ConversationMergedInto(r.Context(), conv)
 	if err != nil {
 		return false
 	}
@@ -103,7 +109,7 @@ func getSpecificConversation(userID gp.UserID, w http.ResponseWriter, r *http.Re
 	if err != nil {
 		start = 0
 	}
-	conv, err := api.UserGetConversation(userID, convID, start, api.Config.MessagePageSize)
+	conv, err := api.UserGetConversation(r.Context(), userID, convID, start, api.Config.MessagePageSize)
 	if err != nil {
 		e, ok := err.(*gp.APIerror)
 		if ok && *e == lib.ENOTALLOWED {
@@ -128,7 +134,7 @@ func deleteSpecificConversation(userID gp.UserID, w http.ResponseWriter, r *http
 	_convID, _ := strconv.ParseInt(vars["id"], 10, 64)
 	convID := gp.ConversationID(_convID)
 	url := fmt.Sprintf("gleepost.conversations.%d.delete", convID)
-	err := api.UserDeleteConversation(userID, convID)
+	err := api.UserDeleteConversation(r.Context(), userID, convID)
 	if err != nil {
 		e, ok := err.(*gp.APIerror)
 		if ok && *e == lib.ENOTALLOWED {
@@ -157,7 +163,7 @@ func getMessages(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	mode, index := interpretPagination(r)
 	_count, _ := strconv.ParseInt(r.FormValue("count"), 10, 64)
 	count := int(_count)
-	messages, err := api.UserGetMessages(userID, convID, mode, index, count)
+	messages, err := api.UserGetMessages(r.Context(), userID, convID, mode, index, count)
 	if err != nil {
 		e, ok := err.(*gp.APIerror)
 		if ok && *e == lib.ENOTALLOWED {
@@ -183,7 +189,7 @@ func postMessages(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	convID := gp.ConversationID(_convID)
 	url := fmt.Sprintf("gleepost.conversations.%d.messages.post", convID)
 	text := r.FormValue("text")
-	message, err := api.AddMessage(convID, userID, text)
+	message, err := api.AddMessage(r.Context(), convID, userID, text)
 	if err != nil {
 		e, ok := err.(*gp.APIerror)
 		if ok && *e == lib.ENOTALLOWED {
@@ -213,7 +219,7 @@ func putMessages(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 		_upTo = 0
 	}
 	upTo := gp.MessageID(_upTo)
-	err = api.MarkConversationSeen(userID, convID, upTo)
+	err = api.MarkConversationSeen(r.Context(), userID, convID, upTo)
 	if err != nil {
 		if maybeRedirect(w, r, convID, "api/v1/conversations/%d/messages", 301) {
 			go api.Statsd.Count(1, url+".301")
@@ -222,7 +228,7 @@ func putMessages(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 		go api.Statsd.Count(1, url+".500")
 		jsonErr(w, err, 500)
 	} else {
-		conversation, err := api.GetConversation(userID, convID)
+		conversation, err := api.GetConversation(r.Context(), userID, convID)
 		if err != nil {
 			go api.Statsd.Count(1, url+".500")
 			jsonErr(w, err, 500)
@@ -233,8 +239,70 @@ func putMessages(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+//messageVars returns the conversation and message a request is about.
+func messageVars(r *http.Request) (gp.ConversationID, gp.MessageID) {
+	vars := mux.Vars(r)
+	_convID, _ := strconv.ParseUint(vars["id"], 10, 64)
+	_msgID, _ := strconv.ParseUint(vars["message"], 10, 64)
+	return gp.ConversationID(_convID), gp.MessageID(_msgID)
+}
+
+//messageErr replies with why a message couldn't be changed or looked at.
+func messageErr(w http.ResponseWriter, url string, err error) {
+	switch {
+	case err == lib.NoSuchMessage:
+		go api.Statsd.Count(1, url+".404")
+		jsonResponse(w, err, 404)
+	case err == lib.ENOTALLOWED || err == lib.EditWindowClosed:
+		go api.Statsd.Count(1, url+".403")
+		jsonResponse(w, err, 403)
+	case err == lib.EmptyMessage:
+		go api.Statsd.Count(1, url+".400")
+		jsonResponse(w, err, 400)
+	default:
+		go api.Statsd.Count(1, url+".500")
+		jsonErr(w, err, 500)
+	}
+}
+
+func putMessage(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	convID, msgID := messageVars(r)
+	url := fmt.Sprintf("gleepost.conversations.%d.messages.%d.put", convID, msgID)
+	message, err := api.EditMessage(r.Context(), userID, convID, msgID, r.FormValue("text"))
+	if err != nil {
+		messageErr(w, url, err)
+		return
+	}
+	go api.Statsd.Count(1, url+".200")
+	jsonResponse(w, message, 200)
+}
+
+func deleteMessage(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	convID, msgID := messageVars(r)
+	url := fmt.Sprintf("gleepost.conversations.%d.messages.%d.delete", convID, msgID)
+	err := api.DeleteMessage(r.Context(), userID, convID, msgID)
+	if err != nil {
+		messageErr(w, url, err)
+		return
+	}
+	go api.Statsd.Count(1, url+".204")
+	w.WriteHeader(204)
+}
+
+func getMessageEdits(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	convID, msgID := messageVars(r)
+	url := fmt.Sprintf("gleepost.conversations.%d.messages.%d.edits.get", convID, msgID)
+	edits, err := api.MessageHistory(r.Context(), userID, convID, msgID)
+	if err != nil {
+		messageErr(w, url, err)
+		return
+	}
+	go api.Statsd.Count(1, url+".200")
+	jsonResponse(w, edits, 200)
+}
+
 func readAll(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
-	err := api.MarkAllConversationsSeen(userID)
+	err := api.MarkAllConversationsSeen(r.Context(), userID)
 	if err != nil {
 		go api.Statsd.Count(1, "gleepost.conversations.read_all.post.500")
 		jsonResponse(w, err, 500)
@@ -246,7 +314,7 @@ func readAll(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 
 func muteBadges(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	t := time.Now().UTC()
-	err := api.UserMuteBadges(userID, t)
+	err := api.UserMuteBadges(r.Context(), userID, t)
 	if err != nil {
 		go api.Statsd.Count(1, "gleepost.conversations.mute_badges.post.500")
 		jsonResponse(w, err, 500)
@@ -270,7 +338,7 @@ func postParticipants(userID gp.UserID, w http.ResponseWriter, r *http.Request)
 			users = append(users, gp.UserID(user))
 		}
 	}
-	participants, err := api.UserAddParticipants(userID, convID, users...)
+	participants, err := api.UserAddParticipants(r.Context(), userID, convID, users...)
 	if err != nil {
 		if maybeRedirect(w, r, convID, "api/v1/conversations/%d/messages", 301) {
 			go api.Statsd.Count(1, url+".301")
@@ -289,14 +357,14 @@ func putConversation(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	_convID, _ := strconv.ParseInt(vars["id"], 10, 64)
 	convID := gp.ConversationID(_convID)
 	muted, _ := strconv.ParseBool(r.FormValue("muted"))
-	err := api.SetMuteStatus(userID, convID, muted)
+	err := api.SetMuteStatus(r.Context(), userID, convID, muted)
 	switch {
 	case err == lib.ENOTALLOWED:
 		jsonErr(w, err, 403)
 	case err != nil:
 		jsonErr(w, err, 500)
 	default:
-		conv, err := api.UserGetConversation(userID, convID, 0, api.Config.MessagePageSize)
+		conv, err := api.UserGetConversation(r.Context(), userID, convID, 0, api.Config.MessagePageSize)
 		if err != nil {
 			jsonResponse(w, err, 500)
 		}
@@ -314,7 +382,7 @@ func getFiles(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	if c > 0 {
 		count = int(c)
 	}
-	files, err := api.ConversationFiles(userID, convID, mode, index, count)
+	files, err := api.ConversationFiles(r.Context(), userID, convID, mode, index, count)
 	switch {
 	case err == lib.ENOTALLOWED:
 		jsonErr(w, err, 403)
@@ -330,7 +398,7 @@ func searchMessages(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	_convID, _ := strconv.ParseInt(vars["id"], 10, 64)
 	mode, index := interpretPagination(r)
 	convID := gp.ConversationID(_convID)
-	results, err := api.SearchMessagesInConversation(userID, convID, vars["query"], mode, index)
+	results, err := api.SearchMessagesInConversation(r.Context(), userID, convID, vars["query"], mode, index)
 	switch {
 	case err == lib.ENOTALLOWED:
 		jsonErr(w, err, 403)
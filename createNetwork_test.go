@@ -32,8 +32,10 @@ func initCreateNetwork() error {
 var once sync.Once
 
 func setup() {
-	config := conf.GetConfig()
-	api = lib.New(*config)
+	config := *conf.GetConfig()
+	//Keep realtime events in-process, so the tests don't need a redis server for them.
+	config.Events.Backend = "memory"
+	api = lib.New(config)
 	api.TW = lib.StubTranscodeWorker{}
 	api.Mail = mail.NewMock()
 	api.Start()
@@ -1,9 +1,15 @@
-package main
+package migrations
 
 import (
 	"database/sql"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20141031150208, Down20141031150208)
+}
+
 //Up20141031150208 is executed when this migration is applied
 func Up20141031150208(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE network ADD master_group INT(10) UNSIGNED NULL")
@@ -1,9 +1,15 @@
-package main
+package migrations
 
 import (
 	"database/sql"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20141104165143, Down20141104165143)
+}
+
 //Up20141104165143 is executed when this migration is applied
 func Up20141104165143(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE network ADD approval_level INT(5) UNSIGNED NOT NULL DEFAULT 0")
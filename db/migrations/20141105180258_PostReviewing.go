@@ -1,9 +1,15 @@
-package main
+package migrations
 
 import (
 	"database/sql"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20141105180258, Down20141105180258)
+}
+
 //Up20141105180258 is executed when this migration is applied
 func Up20141105180258(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE wall_posts ADD pending BOOLEAN NOT NULL DEFAULT 0")
@@ -1,9 +1,15 @@
-package main
+package migrations
 
 import (
 	"database/sql"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20141106120249, Down20141106120249)
+}
+
 //Up20141106120249 is executed when this migration is applied
 func Up20141106120249(txn *sql.Tx) {
 	q := "CREATE TABLE `post_reviews` ( "
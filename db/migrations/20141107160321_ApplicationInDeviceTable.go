@@ -1,9 +1,15 @@
-package main
+package migrations
 
 import (
 	"database/sql"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20141107160321, Down20141107160321)
+}
+
 //Up20141107160321 is executed when this migration is applied
 func Up20141107160321(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE devices ADD application VARCHAR(100) NOT NULL DEFAULT 'gleepost'")
@@ -1,9 +1,15 @@
-package main
+package migrations
 
 import (
 	"database/sql"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20141111121859, Down20141111121859)
+}
+
 //Up20141111121859 is executed when this migration is applied
 func Up20141111121859(txn *sql.Tx) {
 	q := "CREATE TABLE `contact_requests` ( " +
@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20141118154734, Down20141118154734)
+}
+
 //Up20141118154734 is executed when this migration is applied
 func Up20141118154734(txn *sql.Tx) {
 	_, err := txn.Query("UPDATE users SET firstname = name WHERE firstname IS NULL")
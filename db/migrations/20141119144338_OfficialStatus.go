@@ -1,9 +1,15 @@
-package main
+package migrations
 
 import (
 	"database/sql"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20141119144338, Down20141119144338)
+}
+
 //Up20141119144338 is executed when this migration is applied
 func Up20141119144338(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE users ADD official BOOLEAN NOT NULL DEFAULT 0")
@@ -1,9 +1,15 @@
-package main
+package migrations
 
 import (
 	"database/sql"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20141120154940, Down20141120154940)
+}
+
 //Up20141120154940 is executed when this migration is applied
 func Up20141120154940(txn *sql.Tx) {
 	_, err := txn.Query("UPDATE users SET avatar = CONCAT('http://d2tc2ce3464r63.cloudfront.net', SUBSTR(avatar, 41)) WHERE avatar LIKE '%gpimg%'")
@@ -1,9 +1,15 @@
-package main
+package migrations
 
 import (
 	"database/sql"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20141120163306, Down20141120163306)
+}
+
 //Up20141120163306 is executed when this migration is applied
 func Up20141120163306(txn *sql.Tx) {
 	_, err := txn.Query("UPDATE network SET cover_img = CONCAT('http://d2tc2ce3464r63.cloudfront.net', SUBSTR(cover_img, 41)) WHERE cover_img LIKE '%gpimg%'")
@@ -1,9 +1,15 @@
-package main
+package migrations
 
 import (
 	"database/sql"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20141125170337, Down20141125170337)
+}
+
 //Up20141125170337 is executed when this migration is applied
 func Up20141125170337(txn *sql.Tx) {
 	_, err := txn.Query("UPDATE notifications SET post_id = location_id WHERE post_id IS NULL AND type IN ('commented', 'liked', 'approved_post', 'rejected_post')")
@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20141216221609, Down20141216221609)
+}
+
 //Up20141216221609 is executed when this migration is applied
 func Up20141216221609(txn *sql.Tx) {
 	q := "CREATE TABLE `post_views` ( "
@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150116222816, Down20150116222816)
+}
+
 //Up20150116222816 is executed when this migration is applied
 func Up20150116222816(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE chat_messages charset=utf8mb4, MODIFY COLUMN `text` VARCHAR(1024) CHARACTER SET utf8mb4")
@@ -1,9 +1,15 @@
-package main
+package migrations
 
 import (
 	"database/sql"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150122160128, Down20150122160128)
+}
+
 //Up20150122160128 is executed when this migration is applied
 func Up20150122160128(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE users ADD new_message_threshold DATETIME NOT NULL")
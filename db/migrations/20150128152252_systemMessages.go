@@ -1,9 +1,15 @@
-package main
+package migrations
 
 import (
 	"database/sql"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150128152252, Down20150128152252)
+}
+
 //Up20150128152252 is executed when this migration is applied
 func Up20150128152252(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE chat_messages ADD system BOOLEAN NOT NULL DEFAULT 0")
@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150130201806, Down20150130201806)
+}
+
 //Up20150130201806 is executed when this migration is applied
 func Up20150130201806(txn *sql.Tx) {
 	log.Println("Adding primary_conversation flag")
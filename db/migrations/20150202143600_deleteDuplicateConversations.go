@@ -1,4 +1,4 @@
-package main
+package migrations
 
 import (
 	"database/sql"
@@ -6,8 +6,13 @@ import (
 	"time"
 
 	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150202143600, Down20150202143600)
+}
+
 //Up20150202143600 is executed when this migration is applied
 func Up20150202143600(txn *sql.Tx) {
 	//Merge all duplicate conversations between user pairs into one
@@ -22,7 +27,7 @@ func Up20150202143600(txn *sql.Tx) {
 	var conversations []gp.Conversation
 	for rows.Next() {
 		var conversation gp.Conversation
-		var participant gp.User
+		var participant gp.UserPresence
 		var t string
 		err = rows.Scan(&conversation.ID, &participant.ID, &t)
 		if err != nil {
@@ -1,9 +1,15 @@
-package main
+package migrations
 
 import (
 	"database/sql"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150204181648, Down20150204181648)
+}
+
 //Up20150204181648 is executed when this migration is applied
 func Up20150204181648(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE conversations ADD group_id INT(10) UNSIGNED NULL")
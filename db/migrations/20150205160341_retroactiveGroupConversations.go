@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150205160341, Down20150205160341)
+}
+
 //Up20150205160341 is executed when this migration is applied
 func Up20150205160341(txn *sql.Tx) {
 	_, err := txn.Query("INSERT INTO conversations (initiator, last_mod, primary_conversation, group_id) SELECT creator, NOW(), false, id FROM network WHERE creator IS NOT NULL")
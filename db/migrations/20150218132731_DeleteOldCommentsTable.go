@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150218132731, Down20150218132731)
+}
+
 //Up20150218132731 is executed when this migration is applied
 func Up20150218132731(txn *sql.Tx) {
 	_, err := txn.Query("DROP TABLE comments")
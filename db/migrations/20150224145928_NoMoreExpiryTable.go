@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150224145928, Down20150224145928)
+}
+
 //Up20150224145928 is executed when this migration is applied
 func Up20150224145928(txn *sql.Tx) {
 	_, err := txn.Query("DELETE FROM chat_messages WHERE conversation_id IN (SELECT conversation_id FROM conversation_expirations)")
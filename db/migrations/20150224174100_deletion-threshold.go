@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150224174100, Down20150224174100)
+}
+
 //Up20150224174100 is executed when this migration is applied
 func Up20150224174100(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE conversation_participants ADD deletion_threshold INT(10) UNSIGNED NOT NULL DEFAULT 0")
@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150225162015, Down20150225162015)
+}
+
 //Up20150225162015 is executed when this migration is applied
 func Up20150225162015(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE conversations DROP COLUMN last_mod")
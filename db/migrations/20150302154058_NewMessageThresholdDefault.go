@@ -1,9 +1,15 @@
-package main
+package migrations
 
 import (
 	"database/sql"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150302154058, Down20150302154058)
+}
+
 //Up20150302154058 is executed when this migration is applied
 func Up20150302154058(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE users ALTER new_message_threshold SET DEFAULT 0")
@@ -1,28 +1,20 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
 
-	"github.com/Petergatsby/GleepostAPI/lib/conf"
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150306153027, Down20150306153027)
+}
+
 //Up20150306153027 is executed when this migration is applied
-//Must be executed at commit bb57bd7aedf58c687d78318ab47b36a8d0a75bdf or before (before admins were deleted from conf)
+//It used to flag the members of conf's Admins network as admins; it had to be run at commit bb57bd7aedf58c687d78318ab47b36a8d0a75bdf or before, since Admins has been deleted from conf since.
+//Every database old enough to need it has had it; newer ones have nobody to flag, so now it only records the version.
 func Up20150306153027(txn *sql.Tx) {
-	conf := conf.GetConfig()
-	s, err := txn.Prepare("UPDATE users SET is_admin = 1 WHERE id IN (SELECT user_id FROM user_network WHERE network_id = ?)")
-	if err != nil {
-		log.Println(err)
-		txn.Rollback()
-		return
-	}
-	_, err = s.Exec(conf.Admins)
-	if err != nil {
-		log.Println(err)
-		txn.Rollback()
-		return
-	}
 }
 
 //Down20150306153027 is executed when this migration is rolled back
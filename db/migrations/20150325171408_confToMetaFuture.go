@@ -1,30 +1,20 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
 
-	"github.com/Petergatsby/GleepostAPI/lib/conf"
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150325171408, Down20150325171408)
+}
+
 //Up20150325171408 is executed when this migration is applied
-// Must be performed at commit 08a985040eb776a279753d6ed758776e8200c78a
+//It used to copy conf's Futures into post_attribs; it had to be run at commit 08a985040eb776a279753d6ed758776e8200c78a, since Futures has been deleted from conf since.
+//Every database old enough to need it has had it; newer ones have no Futures to copy, so now it only records the version.
 func Up20150325171408(txn *sql.Tx) {
-	config := conf.GetConfig()
-	s, err := txn.Prepare("INSERT INTO post_attribs (post_id, attrib, value) VALUES (?, ?, ?)")
-	if err != nil {
-		log.Println(err)
-		txn.Rollback()
-		return
-	}
-	for _, f := range config.Futures {
-		_, err = s.Exec(f.Post, "meta-future", f.Future)
-		if err != nil {
-			log.Println(err)
-			txn.Rollback()
-			return
-		}
-	}
 }
 
 //Down20150325171408 is executed when this migration is rolled back
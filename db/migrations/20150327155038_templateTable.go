@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150327155038, Down20150327155038)
+}
+
 //Up20150327155038 is executed when this migration is applied
 func Up20150327155038(txn *sql.Tx) {
 	q := "CREATE TABLE `post_templates` ( "
@@ -1,9 +1,15 @@
-package main
+package migrations
 
 import (
 	"database/sql"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150401214324, Down20150401214324)
+}
+
 // Up20150401214324 is executed when this migration is applied
 func Up20150401214324(txn *sql.Tx) {
 	_, err := txn.Query("INSERT INTO categories (tag, name) VALUES (?, ?)", "food", "Free Food")
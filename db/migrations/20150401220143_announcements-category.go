@@ -1,9 +1,15 @@
-package main
+package migrations
 
 import (
 	"database/sql"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150401220143, Down20150401220143)
+}
+
 // Up20150401220143 is executed when this migration is applied
 func Up20150401220143(txn *sql.Tx) {
 	_, err := txn.Query("INSERT INTO categories (tag, name) VALUES (?, ?)", "announcement", "Announcements")
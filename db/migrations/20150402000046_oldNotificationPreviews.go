@@ -1,8 +1,10 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
 type postBy struct {
@@ -15,6 +17,10 @@ type notificationText struct {
 	text         string
 }
 
+func init() {
+	migrate.Register(Up20150402000046, Down20150402000046)
+}
+
 // Up20150402000046 is executed when this migration is applied
 func Up20150402000046(txn *sql.Tx) {
 	//Find all the posts with comment-null notifications
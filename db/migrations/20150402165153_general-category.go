@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150402165153, Down20150402165153)
+}
+
 // Up20150402165153 is executed when this migration is applied
 func Up20150402165153(txn *sql.Tx) {
 	_, err := txn.Query("INSERT INTO categories (id, tag, name) VALUES (?, ?, ?)", 1, "general", "General")
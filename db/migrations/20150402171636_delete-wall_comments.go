@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150402171636, Down20150402171636)
+}
+
 // Up20150402171636 is executed when this migration is applied
 func Up20150402171636(txn *sql.Tx) {
 	_, err := txn.Exec("DROP TABLE wall_comments")
@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150402174034, Down20150402174034)
+}
+
 // Up20150402174034 is executed when this migration is applied
 func Up20150402174034(txn *sql.Tx) {
 	_, err := txn.Query("DROP TABLE IF EXISTS user_at")
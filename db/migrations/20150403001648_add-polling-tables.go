@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150403001648, Down20150403001648)
+}
+
 // Up20150403001648 is executed when this migration is applied
 func Up20150403001648(txn *sql.Tx) {
 	q := "CREATE TABLE `post_polls` ( "
@@ -1,9 +1,15 @@
-package main
+package migrations
 
 import (
 	"database/sql"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150406171351, Down20150406171351)
+}
+
 // Up20150406171351 is executed when this migration is applied
 func Up20150406171351(txn *sql.Tx) {
 	_, err := txn.Exec("INSERT INTO categories (tag, name) VALUES ('poll', 'Poll')")
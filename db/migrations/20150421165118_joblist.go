@@ -1,6 +1,14 @@
-package main
+package migrations
 
-import "database/sql"
+import (
+	"database/sql"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
+)
+
+func init() {
+	migrate.Register(Up20150421165118, Down20150421165118)
+}
 
 // Up20150421165118 is executed when this migration is applied
 func Up20150421165118(txn *sql.Tx) {
@@ -1,9 +1,15 @@
-package main
+package migrations
 
 import (
 	"database/sql"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150520171651, Down20150520171651)
+}
+
 // Up20150520171651 is executed when this migration is applied
 func Up20150520171651(txn *sql.Tx) {
 	q := "CREATE TABLE `network_requests` ( "
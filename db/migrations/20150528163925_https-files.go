@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150528163925, Down20150528163925)
+}
+
 // Up20150528163925 is executed when this migration is applied
 func Up20150528163925(txn *sql.Tx) {
 	_, err := txn.Exec("UPDATE uploads SET `url` = CONCAT('https:', SUBSTR(`url`, 6)) WHERE `url` LIKE 'http:%'")
@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150602171801, Down20150602171801)
+}
+
 // Up20150602171801 is executed when this migration is applied
 func Up20150602171801(txn *sql.Tx) {
 	_, err := txn.Exec("ALTER TABLE conversation_participants ADD read_at DATETIME NULL")
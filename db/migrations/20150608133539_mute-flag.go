@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150608133539, Down20150608133539)
+}
+
 // Up20150608133539 is executed when this migration is applied
 func Up20150608133539(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE conversation_participants ADD muted BOOL NOT NULL DEFAULT 0")
@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150623125937, Down20150623125937)
+}
+
 // Up20150623125937 is executed when this migration is applied
 func Up20150623125937(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE users ADD type VARCHAR(10) NOT NULL DEFAULT 'student'")
@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150626155046, Down20150626155046)
+}
+
 // Up20150626155046 is executed when this migration is applied
 func Up20150626155046(txn *sql.Tx) {
 	q := "CREATE TABLE conversation_files ( "
@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150806180417, Down20150806180417)
+}
+
 // Up20150806180417 is executed when this migration is applied
 func Up20150806180417(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE network ADD category VARCHAR(25) NULL")
@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150812153155, Down20150812153155)
+}
+
 // Up20150812153155 is executed when this migration is applied
 func Up20150812153155(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE notifications ADD done BOOLEAN NOT NULL DEFAULT 0")
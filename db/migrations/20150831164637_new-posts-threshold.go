@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150831164637, Down20150831164637)
+}
+
 // Up20150831164637 is executed when this migration is applied
 func Up20150831164637(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE user_network ADD seen_upto INT(10) UNSIGNED DEFAULT 0")
@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150831171048, Down20150831171048)
+}
+
 // Up20150831171048 is executed when this migration is applied
 func Up20150831171048(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE user_network ADD join_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP")
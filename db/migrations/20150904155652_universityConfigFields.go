@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150904155652, Down20150904155652)
+}
+
 // Up20150904155652 is executed when this migration is applied
 func Up20150904155652(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE network ADD COLUMN shortname VARCHAR(100) NULL, ADD COLUMN appname VARCHAR(100) NULL, ADD COLUMN tagline VARCHAR(255) NULL, ADD COLUMN ios_url VARCHAR(255) NULL, ADD COLUMN android_url VARCHAR(255) NULL")
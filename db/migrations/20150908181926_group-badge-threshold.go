@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150908181926, Down20150908181926)
+}
+
 // Up20150908181926 is executed when this migration is applied
 func Up20150908181926(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE users ADD group_badge_threshold DATETIME NOT NULL")
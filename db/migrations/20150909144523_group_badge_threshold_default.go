@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150909144523, Down20150909144523)
+}
+
 // Up20150909144523 is executed when this migration is applied
 func Up20150909144523(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE users ALTER COLUMN group_badge_threshold SET DEFAULT 0")
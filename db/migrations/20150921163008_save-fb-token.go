@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150921163008, Down20150921163008)
+}
+
 // Up20150921163008 is executed when this migration is applied
 func Up20150921163008(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE facebook ADD COLUMN fb_token VARCHAR(1024) NULL")
@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150921182913, Down20150921182913)
+}
+
 // Up20150921182913 is executed when this migration is applied
 func Up20150921182913(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE network ADD COLUMN covervid_mp4 VARCHAR(255) NULL, ADD COLUMN covervid_webm VARCHAR(255) NULL")
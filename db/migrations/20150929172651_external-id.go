@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20150929172651, Down20150929172651)
+}
+
 // Up20150929172651 is executed when this migration is applied
 func Up20150929172651(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE users ADD external_id VARCHAR(64) NULL")
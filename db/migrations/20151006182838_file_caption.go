@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20151006182838, Down20151006182838)
+}
+
 // Up20151006182838 is executed when this migration is applied
 func Up20151006182838(txn *sql.Tx) {
 	_, err := txn.Exec("ALTER TABLE conversation_files ADD caption VARCHAR(255) NULL")
@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20151009170110, Down20151009170110)
+}
+
 // Up20151009170110 is executed when this migration is applied
 func Up20151009170110(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE users ADD tutorial_state VARCHAR(1024) NULL")
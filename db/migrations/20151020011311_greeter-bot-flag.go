@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20151020011311, Down20151020011311)
+}
+
 // Up20151020011311 is executed when this migration is applied
 func Up20151020011311(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE users ADD greeter BOOLEAN DEFAULT 0")
@@ -1,10 +1,16 @@
-package main
+package migrations
 
 import (
 	"database/sql"
 	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
 )
 
+func init() {
+	migrate.Register(Up20160516144811, Down20160516144811)
+}
+
 // Up is executed when this migration is applied
 func Up20160516144811(txn *sql.Tx) {
 	_, err := txn.Query("ALTER TABLE devices ADD arn VARCHAR(300) NULL")
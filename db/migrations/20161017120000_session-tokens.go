@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
+)
+
+func init() {
+	migrate.Register(Up20161017120000, Down20161017120000)
+}
+
+// Up20161017120000 is executed when this migration is applied
+func Up20161017120000(txn *sql.Tx) {
+	q := "ALTER TABLE tokens "
+	q += "ADD `id` int(10) unsigned NOT NULL AUTO_INCREMENT, "
+	q += "ADD `scopes` varchar(128) COLLATE utf8_bin NOT NULL DEFAULT 'read,write,admin,approve', "
+	q += "ADD `device` varchar(256) COLLATE utf8_bin DEFAULT NULL, "
+	q += "ADD `created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP, "
+	q += "ADD `last_used` datetime DEFAULT NULL, "
+	q += "ADD UNIQUE KEY `id` (`id`)"
+	_, err := txn.Query(q)
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+}
+
+// Down20161017120000 is executed when this migration is rolled back
+func Down20161017120000(txn *sql.Tx) {
+	_, err := txn.Query("ALTER TABLE tokens DROP INDEX `id`, DROP COLUMN `id`, DROP COLUMN `scopes`, DROP COLUMN `device`, DROP COLUMN `created`, DROP COLUMN `last_used`")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+}
@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
+)
+
+func init() {
+	migrate.Register(Up20161017130000, Down20161017130000)
+}
+
+// Up20161017130000 is executed when this migration is applied
+func Up20161017130000(txn *sql.Tx) {
+	_, err := txn.Query("ALTER TABLE tokens ADD `legacy` tinyint(1) NOT NULL DEFAULT '0'")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+	//Everything issued up to now is a long-lived token with no refresh token.
+	_, err = txn.Query("UPDATE tokens SET legacy = 1")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+	q := "CREATE TABLE `refresh_tokens` ( "
+	q += "`token` varchar(64) COLLATE utf8_bin NOT NULL, "
+	q += "`user_id` int(10) unsigned NOT NULL, "
+	q += "`session_id` int(10) unsigned NOT NULL, "
+	q += "`expiry` datetime NOT NULL, "
+	q += "`used` tinyint(1) NOT NULL DEFAULT '0', "
+	q += "PRIMARY KEY (`token`), "
+	q += "KEY `session_id` (`session_id`) ) "
+	q += "ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_bin;"
+	_, err = txn.Query(q)
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+}
+
+// Down20161017130000 is executed when this migration is rolled back
+func Down20161017130000(txn *sql.Tx) {
+	_, err := txn.Query("DROP TABLE refresh_tokens")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+	_, err = txn.Query("ALTER TABLE tokens DROP COLUMN `legacy`")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+}
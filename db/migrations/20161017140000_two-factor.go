@@ -0,0 +1,74 @@
+package migrations
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
+)
+
+func init() {
+	migrate.Register(Up20161017140000, Down20161017140000)
+}
+
+// Up20161017140000 is executed when this migration is applied
+func Up20161017140000(txn *sql.Tx) {
+	q := "CREATE TABLE `two_factor` ( "
+	q += "`user_id` int(10) unsigned NOT NULL, "
+	q += "`secret` varchar(64) COLLATE utf8_bin NOT NULL, "
+	q += "`enabled` tinyint(1) NOT NULL DEFAULT '0', "
+	q += "`created` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP, "
+	q += "PRIMARY KEY (`user_id`) ) "
+	q += "ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_bin;"
+	_, err := txn.Query(q)
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+	q = "CREATE TABLE `two_factor_recovery` ( "
+	q += "`user_id` int(10) unsigned NOT NULL, "
+	q += "`code_hash` varchar(64) COLLATE utf8_bin NOT NULL, "
+	q += "`used` tinyint(1) NOT NULL DEFAULT '0', "
+	q += "PRIMARY KEY (`user_id`, `code_hash`) ) "
+	q += "ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_bin;"
+	_, err = txn.Query(q)
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+	_, err = txn.Query("ALTER TABLE network ADD `require_2fa` tinyint(1) NOT NULL DEFAULT '0'")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+	//mfa marks a session which completed the second login step.
+	_, err = txn.Query("ALTER TABLE tokens ADD `mfa` tinyint(1) NOT NULL DEFAULT '0'")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+}
+
+// Down20161017140000 is executed when this migration is rolled back
+func Down20161017140000(txn *sql.Tx) {
+	_, err := txn.Query("ALTER TABLE tokens DROP COLUMN `mfa`")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+	_, err = txn.Query("ALTER TABLE network DROP COLUMN `require_2fa`")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+	_, err = txn.Query("DROP TABLE two_factor_recovery")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+	_, err = txn.Query("DROP TABLE two_factor")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+}
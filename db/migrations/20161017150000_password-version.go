@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
+)
+
+func init() {
+	migrate.Register(Up20161017150000, Down20161017150000)
+}
+
+// Up20161017150000 is executed when this migration is applied
+func Up20161017150000(txn *sql.Tx) {
+	//Every existing hash is bcrypt, which is version 1.
+	_, err := txn.Query("ALTER TABLE users ADD `password_version` tinyint(3) unsigned NOT NULL DEFAULT '1' AFTER `password`")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+}
+
+// Down20161017150000 is executed when this migration is rolled back
+func Down20161017150000(txn *sql.Tx) {
+	_, err := txn.Query("ALTER TABLE users DROP COLUMN `password_version`")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+}
@@ -0,0 +1,64 @@
+package migrations
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
+)
+
+func init() {
+	migrate.Register(Up20161017160000, Down20161017160000)
+}
+
+// Up20161017160000 is executed when this migration is applied
+func Up20161017160000(txn *sql.Tx) {
+	//Each row is a single sign-on provider for a university network. type is "oidc" (the only kind supported so far).
+	q := "CREATE TABLE `identity_providers` ( "
+	q += "`id` int(10) unsigned NOT NULL AUTO_INCREMENT, "
+	q += "`network_id` int(10) unsigned NOT NULL, "
+	q += "`name` varchar(64) COLLATE utf8_bin NOT NULL, "
+	q += "`display_name` varchar(255) NOT NULL, "
+	q += "`type` varchar(16) NOT NULL DEFAULT 'oidc', "
+	q += "`issuer` varchar(255) NOT NULL, "
+	q += "`client_id` varchar(255) NOT NULL, "
+	q += "`client_secret` varchar(255) NOT NULL DEFAULT '', "
+	q += "`enabled` tinyint(1) NOT NULL DEFAULT '1', "
+	q += "PRIMARY KEY (`id`), "
+	q += "UNIQUE KEY `name` (`name`), "
+	q += "KEY `network_id` (`network_id`) ) "
+	q += "ENGINE=InnoDB DEFAULT CHARSET=utf8;"
+	_, err := txn.Query(q)
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+	q = "CREATE TABLE `external_identities` ( "
+	q += "`provider` varchar(64) COLLATE utf8_bin NOT NULL, "
+	q += "`subject` varchar(255) COLLATE utf8_bin NOT NULL, "
+	q += "`user_id` int(10) unsigned NOT NULL, "
+	q += "`email` varchar(255) DEFAULT NULL, "
+	q += "`created` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP, "
+	q += "PRIMARY KEY (`provider`, `subject`), "
+	q += "UNIQUE KEY `user_provider` (`user_id`, `provider`) ) "
+	q += "ENGINE=InnoDB DEFAULT CHARSET=utf8;"
+	_, err = txn.Query(q)
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+}
+
+// Down20161017160000 is executed when this migration is rolled back
+func Down20161017160000(txn *sql.Tx) {
+	_, err := txn.Query("DROP TABLE external_identities")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+	_, err = txn.Query("DROP TABLE identity_providers")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+}
@@ -0,0 +1,75 @@
+package migrations
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
+)
+
+func init() {
+	migrate.Register(Up20161017170000, Down20161017170000)
+}
+
+// Up20161017170000 is executed when this migration is applied
+func Up20161017170000(txn *sql.Tx) {
+	//Each row is a push waiting to be sent (or retried) to one device. claim and locked_until mark the worker sending it.
+	q := "CREATE TABLE `push_queue` ( "
+	q += "`id` bigint(20) unsigned NOT NULL AUTO_INCREMENT, "
+	q += "`application` varchar(32) NOT NULL, "
+	q += "`user_id` int(10) unsigned NOT NULL, "
+	q += "`device_type` varchar(32) NOT NULL, "
+	q += "`device_id` varchar(255) NOT NULL, "
+	q += "`arn` varchar(255) DEFAULT NULL, "
+	q += "`payload` text NOT NULL, "
+	q += "`attempts` int(10) unsigned NOT NULL DEFAULT '0', "
+	q += "`next_attempt` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP, "
+	q += "`claim` varchar(64) DEFAULT NULL, "
+	q += "`locked_until` datetime DEFAULT NULL, "
+	q += "`last_error` varchar(255) DEFAULT NULL, "
+	q += "`created` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP, "
+	q += "PRIMARY KEY (`id`), "
+	q += "KEY `next_attempt` (`next_attempt`), "
+	q += "KEY `claim` (`claim`) ) "
+	q += "ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;"
+	_, err := txn.Query(q)
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+	//Pushes which failed permanently, or ran out of retries.
+	q = "CREATE TABLE `push_dead_letters` ( "
+	q += "`id` bigint(20) unsigned NOT NULL AUTO_INCREMENT, "
+	q += "`application` varchar(32) NOT NULL, "
+	q += "`user_id` int(10) unsigned NOT NULL, "
+	q += "`device_type` varchar(32) NOT NULL, "
+	q += "`device_id` varchar(255) NOT NULL, "
+	q += "`payload` text NOT NULL, "
+	q += "`attempts` int(10) unsigned NOT NULL, "
+	q += "`error` varchar(255) NOT NULL, "
+	q += "`created` datetime NOT NULL, "
+	q += "`failed_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP, "
+	q += "PRIMARY KEY (`id`), "
+	q += "KEY `user_id` (`user_id`), "
+	q += "KEY `failed_at` (`failed_at`) ) "
+	q += "ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;"
+	_, err = txn.Query(q)
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+}
+
+// Down20161017170000 is executed when this migration is rolled back
+func Down20161017170000(txn *sql.Tx) {
+	_, err := txn.Query("DROP TABLE push_dead_letters")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+	_, err = txn.Query("DROP TABLE push_queue")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+}
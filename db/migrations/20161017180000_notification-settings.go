@@ -0,0 +1,76 @@
+package migrations
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
+)
+
+func init() {
+	migrate.Register(Up20161017180000, Down20161017180000)
+}
+
+// Up20161017180000 is executed when this migration is applied
+func Up20161017180000(txn *sql.Tx) {
+	//A row turns channels on or off for one type of notification; types with no row are fully on.
+	q := "CREATE TABLE `notification_settings` ( "
+	q += "`user_id` int(10) unsigned NOT NULL, "
+	q += "`type` varchar(32) NOT NULL, "
+	q += "`in_app` tinyint(1) NOT NULL DEFAULT '1', "
+	q += "`push` tinyint(1) NOT NULL DEFAULT '1', "
+	q += "`email` tinyint(1) NOT NULL DEFAULT '1', "
+	q += "PRIMARY KEY (`user_id`, `type`) ) "
+	q += "ENGINE=InnoDB DEFAULT CHARSET=utf8;"
+	_, err := txn.Query(q)
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+	//Likewise for every notification about one group.
+	q = "CREATE TABLE `notification_group_settings` ( "
+	q += "`user_id` int(10) unsigned NOT NULL, "
+	q += "`network_id` int(10) unsigned NOT NULL, "
+	q += "`in_app` tinyint(1) NOT NULL DEFAULT '1', "
+	q += "`push` tinyint(1) NOT NULL DEFAULT '1', "
+	q += "`email` tinyint(1) NOT NULL DEFAULT '1', "
+	q += "PRIMARY KEY (`user_id`, `network_id`) ) "
+	q += "ENGINE=InnoDB DEFAULT CHARSET=utf8;"
+	_, err = txn.Query(q)
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+	//start and end are minutes after midnight in timezone; the window wraps past midnight if end < start.
+	q = "CREATE TABLE `notification_quiet_hours` ( "
+	q += "`user_id` int(10) unsigned NOT NULL, "
+	q += "`start` smallint(5) unsigned NOT NULL, "
+	q += "`end` smallint(5) unsigned NOT NULL, "
+	q += "`timezone` varchar(64) NOT NULL DEFAULT 'UTC', "
+	q += "PRIMARY KEY (`user_id`) ) "
+	q += "ENGINE=InnoDB DEFAULT CHARSET=utf8;"
+	_, err = txn.Query(q)
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+}
+
+// Down20161017180000 is executed when this migration is rolled back
+func Down20161017180000(txn *sql.Tx) {
+	_, err := txn.Query("DROP TABLE notification_quiet_hours")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+	_, err = txn.Query("DROP TABLE notification_group_settings")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+	_, err = txn.Query("DROP TABLE notification_settings")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+}
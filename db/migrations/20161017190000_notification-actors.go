@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
+)
+
+func init() {
+	migrate.Register(Up20161017190000, Down20161017190000)
+}
+
+// Up20161017190000 is executed when this migration is applied
+func Up20161017190000(txn *sql.Tx) {
+	//actor_count is how many people an aggregated notification ("Alice and 12 others liked your post") is about; they're listed in notification_actors.
+	_, err := txn.Query("ALTER TABLE notifications ADD actor_count INT(10) UNSIGNED NOT NULL DEFAULT 1")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+	q := "CREATE TABLE `notification_actors` ( "
+	q += "`notification_id` int(10) unsigned NOT NULL, "
+	q += "`user_id` int(10) unsigned NOT NULL, "
+	q += "`time` datetime NOT NULL, "
+	q += "PRIMARY KEY (`notification_id`, `user_id`), "
+	q += "KEY `latest` (`notification_id`, `time`) ) "
+	q += "ENGINE=InnoDB DEFAULT CHARSET=utf8;"
+	_, err = txn.Query(q)
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+	_, err = txn.Query("INSERT INTO notification_actors (notification_id, user_id, time) SELECT id, `by`, time FROM notifications WHERE type IN ('liked', 'attended', 'poll_vote', 'commented', 'commented2') AND seen = 0")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+}
+
+// Down20161017190000 is executed when this migration is rolled back
+func Down20161017190000(txn *sql.Tx) {
+	_, err := txn.Query("DROP TABLE notification_actors")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+	_, err = txn.Query("ALTER TABLE notifications DROP COLUMN actor_count")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+}
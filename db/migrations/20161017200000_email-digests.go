@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
+)
+
+func init() {
+	migrate.Register(Up20161017200000, Down20161017200000)
+}
+
+// Up20161017200000 is executed when this migration is applied
+func Up20161017200000(txn *sql.Tx) {
+	//frequency is "daily", "weekly" or "never"; users with no row get weekly digests.
+	q := "CREATE TABLE `email_digests` ( "
+	q += "`user_id` int(10) unsigned NOT NULL, "
+	q += "`frequency` varchar(16) NOT NULL DEFAULT 'weekly', "
+	q += "`last_sent` datetime DEFAULT NULL, "
+	q += "PRIMARY KEY (`user_id`) ) "
+	q += "ENGINE=InnoDB DEFAULT CHARSET=utf8;"
+	_, err := txn.Query(q)
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+}
+
+// Down20161017200000 is executed when this migration is rolled back
+func Down20161017200000(txn *sql.Tx) {
+	_, err := txn.Query("DROP TABLE email_digests")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+}
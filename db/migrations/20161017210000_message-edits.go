@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
+)
+
+func init() {
+	migrate.Register(Up20161017210000, Down20161017210000)
+}
+
+//Up20161017210000 is executed when this migration is applied
+func Up20161017210000(txn *sql.Tx) {
+	//A deleted message keeps its row (with its text blanked) so that it can be shown as a tombstone.
+	_, err := txn.Query("ALTER TABLE chat_messages ADD `edited` datetime NULL, ADD `deleted` tinyint(1) NOT NULL DEFAULT 0")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+		return
+	}
+	//Each row is a message's text as it was before one of its edits.
+	q := "CREATE TABLE `message_edits` ( "
+	q += "`id` int(10) unsigned NOT NULL AUTO_INCREMENT, "
+	q += "`message_id` int(10) unsigned NOT NULL, "
+	q += "`text` varchar(1024) CHARACTER SET utf8mb4 DEFAULT NULL, "
+	q += "`time` datetime NOT NULL, "
+	q += "PRIMARY KEY (`id`), "
+	q += "KEY `message_id` (`message_id`) ) "
+	q += "ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;"
+	_, err = txn.Query(q)
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+}
+
+//Down20161017210000 is executed when this migration is rolled back
+func Down20161017210000(txn *sql.Tx) {
+	_, err := txn.Query("DROP TABLE message_edits")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+		return
+	}
+	_, err = txn.Query("ALTER TABLE chat_messages DROP COLUMN `edited`, DROP COLUMN `deleted`")
+	if err != nil {
+		log.Println(err)
+		txn.Rollback()
+	}
+}
@@ -24,7 +24,7 @@ func postDevice(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 		application = "gleepost"
 	}
 	log.Println("Device:", deviceType, deviceID)
-	device, err := api.AddDevice(userID, deviceType, deviceID, application)
+	device, err := api.AddDevice(r.Context(), userID, deviceType, deviceID, application)
 	log.Println(device, err)
 	if err != nil {
 		go api.Statsd.Count(1, "gleepost.devices.post.500")
@@ -40,7 +40,7 @@ func deleteDevice(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	url := fmt.Sprintf("gleepost.devices.%s.delete", vars["id"])
 	w.Header().Set("Content-Type", "application/json")
 	log.Println("Delete device hit")
-	err := api.DeleteDevice(userID, vars["id"])
+	err := api.DeleteDevice(r.Context(), userID, vars["id"])
 	if err != nil {
 		go api.Statsd.Count(1, url+".500")
 		jsonErr(w, err, 500)
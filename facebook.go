@@ -25,9 +25,9 @@ func facebookAssociate(w http.ResponseWriter, r *http.Request) {
 	switch {
 	case autherr == nil:
 		//Note to self: The existence of this branch means that a gleepost token is now a password equivalent.
-		err = api.AssociateFB(userID, _fbToken)
+		err = api.AssociateFB(r.Context(), userID, _fbToken)
 	default:
-		err = api.AttemptAssociationWithCredentials(email, pass, _fbToken)
+		err = api.AttemptAssociationWithCredentials(r.Context(), email, pass, _fbToken)
 	}
 	switch {
 	case err != nil && err == lib.AlreadyAssociated:
@@ -49,7 +49,7 @@ func facebookHandler(w http.ResponseWriter, r *http.Request) {
 	_fbToken := r.FormValue("token")
 	email := r.FormValue("email")
 	invite := r.FormValue("invite")
-	token, _, status, err := api.FacebookLogin(_fbToken, email, invite)
+	token, _, status, err := api.FacebookLogin(r.Context(), _fbToken, email, invite, deviceLabel(r))
 	switch {
 	case err == lib.BadFBToken:
 		fallthrough
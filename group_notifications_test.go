@@ -0,0 +1,132 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/conf"
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+func TestMutedGroupSuppressesLike(t *testing.T) {
+	err := initDB()
+	if err != nil {
+		t.Fatal("Error initializing db:", err)
+	}
+	err = truncate("notifications", "notification_actors", "notification_settings", "notification_group_settings", "wall_posts", "post_likes")
+	if err != nil {
+		t.Fatal("Error truncating:", err)
+	}
+	once.Do(setup)
+	groupID, postID, err := initMutedGroup()
+	if err != nil {
+		t.Fatal("Error setting up group:", err)
+	}
+	owner, err := testingGetSession("patrick@fakestanford.edu", "TestingPass")
+	if err != nil {
+		t.Fatal("Error logging in:", err)
+	}
+	liker, err := testingGetSession("muted-liker@fakestanford.edu", "TestingPass")
+	if err != nil {
+		t.Fatal("Error logging in:", err)
+	}
+
+	groupSettings := fmt.Sprintf("profile/notification_settings/networks/%d", groupID)
+	resp, err := twoFactorRequest("POST", groupSettings, owner, url.Values{"in_app": {"false"}, "push": {"false"}, "email": {"false"}})
+	if err != nil {
+		t.Fatal("Error muting group:", err)
+	}
+	decodeSettings(t, resp, http.StatusOK)
+	likePost(t, liker, postID, true)
+
+	//Unmute, and like it again: the observer handles events in order, so once this one's notification arrives the first has been dealt with too.
+	resp, err = twoFactorRequest("DELETE", groupSettings, owner, nil)
+	if err != nil {
+		t.Fatal("Error unmuting group:", err)
+	}
+	decodeSettings(t, resp, http.StatusOK)
+	likePost(t, liker, postID, false)
+	likePost(t, liker, postID, true)
+
+	var likes []gp.Notification
+	for i := 0; i < 20 && len(likes) == 0; i++ {
+		time.Sleep(50 * time.Millisecond)
+		notifications, err := getNotifications(owner, "true")
+		if err != nil {
+			t.Fatal("Error getting notifications:", err)
+		}
+		likes = likes[:0]
+		for _, n := range notifications {
+			if n.Type == "liked" {
+				likes = append(likes, n)
+			}
+		}
+	}
+	if len(likes) != 1 || likes[0].Count > 1 {
+		t.Fatalf("Expected just the like from after the group was unmuted, got %+v", likes)
+	}
+	if likes[0].Group != groupID {
+		t.Fatalf("Expected the notification to be about group %d, got %d", groupID, likes[0].Group)
+	}
+}
+
+//initMutedGroup creates a group with patrick and another user in it, and a post of patrick's there.
+func initMutedGroup() (groupID gp.NetworkID, postID gp.PostID, err error) {
+	db, err := sql.Open("mysql", conf.GetConfig().Mysql.ConnectionString())
+	if err != nil {
+		return
+	}
+	defer db.Close()
+	var patrick gp.UserID
+	var university gp.NetworkID
+	err = db.QueryRow("SELECT id FROM users WHERE email = 'patrick@fakestanford.edu'").Scan(&patrick)
+	if err != nil {
+		return
+	}
+	err = db.QueryRow("SELECT id FROM network WHERE name = 'Fake Stanford'").Scan(&university)
+	if err != nil {
+		return
+	}
+	res, err := db.Exec("INSERT INTO `users` (`password`, `email`, `verified`, `firstname`, `lastname`) VALUES ('$2a$10$xLUmQbvrHAAOGuv4.uHAY.NmoLGEuEObENPiQ8kkh.Miyvdzhyge6', 'muted-liker@fakestanford.edu', 1, 'Muted', 'Liker')")
+	if err != nil {
+		return
+	}
+	liker, err := res.LastInsertId()
+	if err != nil {
+		return
+	}
+	res, err = db.Exec("INSERT INTO `network` (`name`, `is_university`, `privacy`, `user_group`, `parent`, `creator`) VALUES ('Quiet group', 0, 'private', 1, ?, ?)", university, patrick)
+	if err != nil {
+		return
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return
+	}
+	groupID = gp.NetworkID(id)
+	_, err = db.Exec("INSERT INTO `user_network` (`user_id`, `network_id`) VALUES (?, ?), (?, ?), (?, ?)", liker, university, liker, groupID, patrick, groupID)
+	if err != nil {
+		return
+	}
+	res, err = db.Exec("INSERT INTO wall_posts (`by`, text, network_id) VALUES (?, ?, ?)", patrick, "Don't tell anyone", groupID)
+	if err != nil {
+		return
+	}
+	id, err = res.LastInsertId()
+	return groupID, gp.PostID(id), err
+}
+
+func likePost(t *testing.T, token gp.Token, postID gp.PostID, liked bool) {
+	resp, err := twoFactorRequest("POST", fmt.Sprintf("posts/%d/likes", postID), token, url.Values{"liked": {fmt.Sprintf("%t", liked)}})
+	if err != nil {
+		t.Fatal("Error liking post:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Liking post: expected %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+}
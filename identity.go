@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Petergatsby/GleepostAPI/lib"
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/gorilla/mux"
+)
+
+func init() {
+	base.Handle("/login/external", timeHandler(api, http.HandlerFunc(externalLoginHandler))).Methods("POST")
+	base.Handle("/login/external", timeHandler(api, http.HandlerFunc(optionsHandler))).Methods("OPTIONS")
+	base.Handle("/login/external", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/login/external/nonce", timeHandler(api, http.HandlerFunc(externalNonceHandler))).Methods("POST")
+	base.Handle("/login/external/nonce", timeHandler(api, http.HandlerFunc(optionsHandler))).Methods("OPTIONS")
+	base.Handle("/login/external/nonce", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/university/{network:[0-9]+}/identity_providers", timeHandler(api, http.HandlerFunc(getIdentityProviders))).Methods("GET")
+	base.Handle("/university/{network:[0-9]+}/identity_providers", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/profile/identities", timeHandler(api, authenticated(getIdentities))).Methods("GET")
+	base.Handle("/profile/identities", timeHandler(api, authenticated(postIdentities))).Methods("POST")
+	base.Handle("/profile/identities", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/profile/identities/{provider}", timeHandler(api, authenticated(deleteIdentity))).Methods("DELETE")
+	base.Handle("/profile/identities/{provider}", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+}
+
+//identityCredential is whatever the client got back from the identity provider: an id_token, or an authorization code for us to exchange.
+func identityCredential(r *http.Request) lib.Credential {
+	token := r.FormValue("id_token")
+	if len(token) == 0 {
+		token = r.FormValue("token")
+	}
+	return lib.Credential{Token: token, Code: r.FormValue("code"), RedirectURI: r.FormValue("redirect_uri")}
+}
+
+//externalLoginHandler logs in with an identity provider (a university's single sign-on). It responds like /login: a token, or a 403 with a status ("registered", "2fa_required").
+func externalLoginHandler(w http.ResponseWriter, r *http.Request) {
+	scopes, err := lib.ParseScopes(r.FormValue("scopes"))
+	if err != nil {
+		go api.Statsd.Count(1, "gleepost.auth.login.external.400")
+		jsonResponse(w, err, 400)
+		return
+	}
+	token, status, err := api.ExternalLogin(r.Context(), r.FormValue("provider"), identityCredential(r), deviceLabel(r), scopes)
+	switch {
+	case err == lib.NoSuchProvider || err == lib.BadCredential || err == lib.IdentityEmailUnverified:
+		go api.Statsd.Count(1, "gleepost.auth.login.external.400")
+		jsonResponse(w, err, 400)
+	case err != nil:
+		go api.Statsd.Count(1, "gleepost.auth.login.external.500")
+		jsonErr(w, err, 500)
+	case status.Status != "":
+		go api.Statsd.Count(1, "gleepost.auth.login.external.403")
+		jsonResponse(w, status, 403)
+	default:
+		go api.Statsd.Count(1, "gleepost.auth.login.external.200")
+		jsonResponse(w, token, 200)
+	}
+}
+
+//externalNonceHandler issues a nonce for the client to send with its authorization request. The id_token it gets back can then only be used to log in once.
+func externalNonceHandler(w http.ResponseWriter, r *http.Request) {
+	nonce, err := api.LoginNonce(r.Context())
+	if err != nil {
+		go api.Statsd.Count(1, "gleepost.auth.login.external.nonce.500")
+		jsonErr(w, err, 500)
+		return
+	}
+	go api.Statsd.Count(1, "gleepost.auth.login.external.nonce.200")
+	jsonResponse(w, struct {
+		Nonce string `json:"nonce"`
+	}{nonce}, 200)
+}
+
+func getIdentityProviders(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	_netID, _ := strconv.ParseUint(vars["network"], 10, 64)
+	providers, err := api.IdentityProviders(r.Context(), gp.NetworkID(_netID))
+	if err != nil {
+		jsonErr(w, err, 500)
+		return
+	}
+	jsonResponse(w, providers, 200)
+}
+
+func getIdentities(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	identities, err := api.LinkedIdentities(r.Context(), userID)
+	if err != nil {
+		jsonErr(w, err, 500)
+		return
+	}
+	jsonResponse(w, identities, 200)
+}
+
+//postIdentities links an identity provider to the user's account, so they can log in with it.
+func postIdentities(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	err := api.LinkIdentity(r.Context(), userID, r.FormValue("provider"), identityCredential(r))
+	switch {
+	case err == lib.NoSuchProvider || err == lib.BadCredential:
+		jsonResponse(w, err, 400)
+	case err == lib.IdentityAlreadyLinked:
+		jsonResponse(w, err, 409)
+	case err != nil:
+		jsonErr(w, err, 500)
+	default:
+		getIdentities(userID, w, r)
+	}
+}
+
+func deleteIdentity(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	err := api.UnlinkIdentity(r.Context(), userID, mux.Vars(r)["provider"])
+	switch {
+	case err == lib.NoSuchProvider || err == lib.NotLinked:
+		jsonResponse(w, err, 404)
+	case err != nil:
+		jsonErr(w, err, 500)
+	default:
+		w.WriteHeader(204)
+	}
+}
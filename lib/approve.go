@@ -1,15 +1,15 @@
 package lib
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"strconv"
-	"strings"
-	"time"
 
+	"github.com/Petergatsby/GleepostAPI/lib/events"
 	"github.com/Petergatsby/GleepostAPI/lib/gp"
-	"github.com/draaglom/apns"
+	"github.com/Petergatsby/GleepostAPI/lib/push"
 )
 
 const (
@@ -27,22 +27,16 @@ var NoSuchGroup = gp.APIerror{Reason: "No such group"}
 var NotChanged = gp.APIerror{Reason: "Level not changed"}
 
 //ApproveAccess returns this user's access to review / change review level in this network.
-func (api *API) ApproveAccess(userID gp.UserID) (access gp.ApprovePermission, err error) {
-	primary, err := api.getUserUniversity(userID)
+func (api *API) ApproveAccess(ctx context.Context, userID gp.UserID) (access gp.ApprovePermission, err error) {
+	primary, err := api.getUserUniversity(ctx, userID)
 	if err != nil {
 		return
 	}
-	return api.approveAccess(userID, primary.ID)
+	return api.approveAccess(ctx, userID, primary.ID)
 }
 
-func (api *API) approveAccess(userID gp.UserID, netID gp.NetworkID) (perm gp.ApprovePermission, err error) {
-	q := "SELECT role_level FROM user_network JOIN network ON network.master_group = user_network.network_id WHERE network.id = ? AND user_network.user_id = ?"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	var level int
-	err = s.QueryRow(netID, userID).Scan(&level)
+func (api *API) approveAccess(ctx context.Context, userID gp.UserID, netID gp.NetworkID) (perm gp.ApprovePermission, err error) {
+	level, err := api.store.Approvals.ReviewerLevel(ctx, netID, userID)
 	switch {
 	case err != nil && err == sql.ErrNoRows:
 		return perm, nil
@@ -61,21 +55,21 @@ func (api *API) approveAccess(userID gp.UserID, netID gp.NetworkID) (perm gp.App
 }
 
 //ApproveLevel returns this network's current approval level, or ENOTALLOWED if you aren't allowed to see it.
-func (api *API) ApproveLevel(userID gp.UserID) (level gp.ApproveLevel, err error) {
-	primary, err := api.getUserUniversity(userID)
+func (api *API) ApproveLevel(ctx context.Context, userID gp.UserID) (level gp.ApproveLevel, err error) {
+	primary, err := api.getUserUniversity(ctx, userID)
 	if err != nil {
 		return
 	}
-	return api.approveLevel(primary.ID)
+	return api.approveLevel(ctx, primary.ID)
 }
 
 //SetApproveLevel sets this network's approval level, or returns ENOTALLOWED if you can't.
-func (api *API) SetApproveLevel(userID gp.UserID, level int) (err error) {
-	primary, err := api.getUserUniversity(userID)
+func (api *API) SetApproveLevel(ctx context.Context, userID gp.UserID, level int) (err error) {
+	primary, err := api.getUserUniversity(ctx, userID)
 	if err != nil {
 		return
 	}
-	access, err := api.approveAccess(userID, primary.ID)
+	access, err := api.approveAccess(ctx, userID, primary.ID)
 	switch {
 	case err != nil:
 		return err
@@ -84,7 +78,7 @@ func (api *API) SetApproveLevel(userID gp.UserID, level int) (err error) {
 	case level < 0 || level > 3:
 		return NoSuchLevelErr
 	default:
-		err = api.setApproveLevel(primary.ID, level)
+		err = api.setApproveLevel(ctx, primary.ID, level)
 		if err == nil {
 			go api.approvalChangePush(primary.ID, userID, level)
 		}
@@ -95,39 +89,30 @@ func (api *API) SetApproveLevel(userID gp.UserID, level int) (err error) {
 	}
 }
 
+//approvalChangePush tells the other reviewers in netID that changer has set its approval level. It runs in the background, after the change has been made.
 func (api *API) approvalChangePush(netID gp.NetworkID, changer gp.UserID, level int) (err error) {
-	badge := api.approvalBadgeCount(changer, netID)
-	users, err := api.approveUsers(netID)
+	ctx := context.Background()
+	badge := api.approvalBadgeCount(ctx, changer, netID)
+	users, err := api.approveUsers(ctx, netID)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 	for _, u := range users {
-		devices, err := getDevices(api.sc, u.ID, "approve")
+		devices, err := getDevices(ctx, api.sc, u.ID, "approve")
 		if err != nil {
 			log.Println(err)
 			continue
 		}
+		pn := push.Notification{
+			Alert: push.Alert{LocKey: "level_change", LocArgs: []string{strconv.Itoa(level)}, ActionLocKey: "OK"},
+			Badge: &badge,
+			Sound: "default",
+		}
 		for _, d := range devices {
-			switch {
-			case d.Type == "ios":
-				payload := apns.NewPayload()
-				alert := apns.NewAlertDictionary()
-				alert.ActionLocKey = "OK"
-				alert.LocKey = "level_change"
-				alert.LocArgs = []string{strconv.Itoa(level)}
-				payload.Badge = badge
-				payload.Alert = alert
-				payload.Sound = "default"
-				pn := apns.NewPushNotification()
-				pn.DeviceToken = d.ID
-				pn.AddPayload(payload)
-				err := api.pushers["approve"].IOSPush(pn)
-				if err != nil {
-					log.Println(err)
-				}
-			default:
-				//We only support iOS so far.
+			err := api.pushQueue.enqueue(ctx, "approve", d, pn)
+			if err != nil {
+				log.Println(err)
 			}
 		}
 	}
@@ -135,63 +120,63 @@ func (api *API) approvalChangePush(netID gp.NetworkID, changer gp.UserID, level
 }
 
 //UserGetPending returns all the posts pending review in this user's primary network.
-func (api *API) UserGetPending(userID gp.UserID) (pending []gp.PendingPost, err error) {
-	primary, err := api.getUserUniversity(userID)
+func (api *API) UserGetPending(ctx context.Context, userID gp.UserID) (pending []gp.PendingPost, err error) {
+	primary, err := api.getUserUniversity(ctx, userID)
 	if err != nil {
 		return
 	}
-	return api.GetNetworkPending(userID, primary.ID)
+	return api.GetNetworkPending(ctx, userID, primary.ID)
 
 }
 
 //UserGetApproved returns posts that have been approved in this user's primary network.
-func (api *API) UserGetApproved(userID gp.UserID, mode int, index int64, count int) (approved []gp.PendingPost, err error) {
-	primary, err := api.getUserUniversity(userID)
+func (api *API) UserGetApproved(ctx context.Context, userID gp.UserID, mode int, index int64, count int) (approved []gp.PendingPost, err error) {
+	primary, err := api.getUserUniversity(ctx, userID)
 	if err != nil {
 		return
 	}
-	return api.GetNetworkApproved(userID, primary.ID, mode, index, count)
+	return api.GetNetworkApproved(ctx, userID, primary.ID, mode, index, count)
 
 }
 
 //UserGetRejected returns posts that have been rejected in this user's primary network.
-func (api *API) UserGetRejected(userID gp.UserID, mode int, index int64, count int) (rejected []gp.PendingPost, err error) {
-	primary, err := api.getUserUniversity(userID)
+func (api *API) UserGetRejected(ctx context.Context, userID gp.UserID, mode int, index int64, count int) (rejected []gp.PendingPost, err error) {
+	primary, err := api.getUserUniversity(ctx, userID)
 	if err != nil {
 		return
 	}
-	return api.GetNetworkRejected(userID, primary.ID, mode, index, count)
+	return api.GetNetworkRejected(ctx, userID, primary.ID, mode, index, count)
 
 }
 
 //GetNetworkPending returns all the posts which are pending review in this network.
-func (api *API) GetNetworkPending(userID gp.UserID, netID gp.NetworkID) (pending []gp.PendingPost, err error) {
+func (api *API) GetNetworkPending(ctx context.Context, userID gp.UserID, netID gp.NetworkID) (pending []gp.PendingPost, err error) {
 	pending = make([]gp.PendingPost, 0)
-	access, err := api.approveAccess(userID, netID)
+	access, err := api.approveAccess(ctx, userID, netID)
 	switch {
 	case err != nil:
 		return
 	case !access.ApproveAccess:
 		return pending, &ENOTALLOWED
 	default:
-		return api.getNetworkPending(userID, netID)
+		return api.getNetworkPending(ctx, userID, netID)
 	}
 }
 
-func (api *API) getNetworkPending(userID gp.UserID, netID gp.NetworkID) (pending []gp.PendingPost, err error) {
+func (api *API) getNetworkPending(ctx context.Context, userID gp.UserID, netID gp.NetworkID) (pending []gp.PendingPost, err error) {
 	pending = make([]gp.PendingPost, 0)
-	_pending, err := api.pendingPosts(netID)
+	_pending, err := api.pendingPosts(ctx, netID)
 	if err != nil {
 		return pending, err
 	}
 
 	for i := range _pending {
 		pending = append(pending, gp.PendingPost{PostSmall: _pending[i]})
-		processed, err := api.postProcess(pending[i].PostSmall, userID)
+		processed, err := api.postProcess(ctx, pending[i].PostSmall, userID)
 		if err == nil {
 			pending[i].PostSmall = processed
 		}
-		history, err := api.reviewHistory(pending[i].ID)
+		history, err := api.reviewHistory(ctx, pending[i].ID)
 		if err == nil {
 			pending[i].ReviewHistory = history
 		}
@@ -199,13 +184,13 @@ func (api *API) getNetworkPending(userID gp.UserID, netID gp.NetworkID) (pending
 	return pending, nil
 }
 
-func (api *API) isPendingVisible(userID gp.UserID, postID gp.PostID) (visible bool, err error) {
-	p, err := api.getPost(postID)
+func (api *API) isPendingVisible(ctx context.Context, userID gp.UserID, postID gp.PostID) (visible bool, err error) {
+	p, err := api.getPost(ctx, postID)
 	if err != nil {
 		//Not sure what kinds of errors GetPost will give me, so we'll just say you can't see the post.
 		return false, nil
 	}
-	in, err := api.UserInNetwork(userID, p.Network)
+	in, err := api.UserInNetwork(ctx, userID, p.Network)
 	switch {
 	case err != nil:
 		return
@@ -213,7 +198,7 @@ func (api *API) isPendingVisible(userID gp.UserID, postID gp.PostID) (visible bo
 		return false, &ENOTALLOWED
 	default:
 		//Is the post still pending?
-		pending, _ := api.pendingStatus(postID)
+		pending, _ := api.pendingStatus(ctx, postID)
 		if pending > 0 {
 			return true, nil
 		}
@@ -222,49 +207,50 @@ func (api *API) isPendingVisible(userID gp.UserID, postID gp.PostID) (visible bo
 }
 
 //ApprovePost will mark this post approved if you are allowed to do so, or return ENOTALLOWED otherwise.
-func (api *API) ApprovePost(userID gp.UserID, postID gp.PostID, reason string) (err error) {
-	visible, err := api.isPendingVisible(userID, postID)
+func (api *API) ApprovePost(ctx context.Context, userID gp.UserID, postID gp.PostID, reason string) (err error) {
+	visible, err := api.isPendingVisible(ctx, userID, postID)
 	if !visible || err != nil {
 		return &ENOTALLOWED
 	}
-	p, _ := api.getPost(postID)
-	access, _ := api.approveAccess(userID, p.Network)
+	p, _ := api.getPost(ctx, postID)
+	access, _ := api.approveAccess(ctx, userID, p.Network)
 	if !access.ApproveAccess {
 		return &ENOTALLOWED
 	}
-	err = api.approvePost(userID, postID, reason)
+	err = api.approvePost(ctx, userID, postID, reason)
 	if err == nil {
 		//Notify user their post has been approved
 		api.notifObserver.Notify(approvedEvent{userID: userID, recipientID: p.By.ID, postID: postID})
 		//Silently reduce badge count for app users
 		//nb: just using p.Network won't work if we eventually want to eg. approve posts in public groups
-		api.silentSetApproveBadgeCount(p.Network, userID)
-		go api.broker.PublishEvent("post", fmt.Sprintf("/networks/%d/posts", p.Network), p, []string{NetworkChannel(p.Network)})
+		api.silentSetApproveBadgeCount(ctx, p.Network, userID)
+		go api.broker.PublishEvent(events.Post, fmt.Sprintf("/networks/%d/posts", p.Network), p, []string{NetworkChannel(p.Network)})
+		go api.groupBadgesChanged(p.Network, p.By.ID)
 	}
 	return
 }
 
 //GetNetworkApproved returns the list of approved posts in this network.
-func (api *API) GetNetworkApproved(userID gp.UserID, netID gp.NetworkID, mode int, index int64, count int) (approved []gp.PendingPost, err error) {
+func (api *API) GetNetworkApproved(ctx context.Context, userID gp.UserID, netID gp.NetworkID, mode int, index int64, count int) (approved []gp.PendingPost, err error) {
 	approved = make([]gp.PendingPost, 0)
-	access, err := api.approveAccess(userID, netID)
+	access, err := api.approveAccess(ctx, userID, netID)
 	switch {
 	case err != nil:
 		return
 	case !access.ApproveAccess:
 		return approved, &ENOTALLOWED
 	default:
-		_approved, err := api.getNetworkApproved(netID, mode, index, count)
+		_approved, err := api.getNetworkApproved(ctx, netID, mode, index, count)
 		if err != nil {
 			return approved, err
 		}
 		for i := range _approved {
 			approved = append(approved, gp.PendingPost{PostSmall: _approved[i]})
-			processed, err := api.postProcess(approved[i].PostSmall, userID)
+			processed, err := api.postProcess(ctx, approved[i].PostSmall, userID)
 			if err == nil {
 				approved[i].PostSmall = processed
 			}
-			history, err := api.reviewHistory(approved[i].ID)
+			history, err := api.reviewHistory(ctx, approved[i].ID)
 			if err == nil {
 				approved[i].ReviewHistory = history
 			}
@@ -274,45 +260,45 @@ func (api *API) GetNetworkApproved(userID gp.UserID, netID gp.NetworkID, mode in
 }
 
 //RejectPost marks this post as rejected (if you're allowed) or ENOTALLOWED otherwise.
-func (api *API) RejectPost(userID gp.UserID, postID gp.PostID, reason string) (err error) {
-	visible, err := api.isPendingVisible(userID, postID)
+func (api *API) RejectPost(ctx context.Context, userID gp.UserID, postID gp.PostID, reason string) (err error) {
+	visible, err := api.isPendingVisible(ctx, userID, postID)
 	if !visible || err != nil {
 		return &ENOTALLOWED
 	}
-	p, _ := api.getPost(postID)
-	access, _ := api.approveAccess(userID, p.Network)
+	p, _ := api.getPost(ctx, postID)
+	access, _ := api.approveAccess(ctx, userID, p.Network)
 	if !access.ApproveAccess {
 		return &ENOTALLOWED
 	}
-	err = api.rejectPost(userID, postID, reason)
+	err = api.rejectPost(ctx, userID, postID, reason)
 	if err == nil {
 		api.notifObserver.Notify(rejectedEvent{userID: userID, recipientID: p.By.ID, postID: postID})
-		api.silentSetApproveBadgeCount(p.Network, userID)
+		api.silentSetApproveBadgeCount(ctx, p.Network, userID)
 	}
 	return
 }
 
 //GetNetworkRejected returns the list of rejected posts in this network.
-func (api *API) GetNetworkRejected(userID gp.UserID, netID gp.NetworkID, mode int, index int64, count int) (rejected []gp.PendingPost, err error) {
+func (api *API) GetNetworkRejected(ctx context.Context, userID gp.UserID, netID gp.NetworkID, mode int, index int64, count int) (rejected []gp.PendingPost, err error) {
 	rejected = make([]gp.PendingPost, 0)
-	access, err := api.approveAccess(userID, netID)
+	access, err := api.approveAccess(ctx, userID, netID)
 	switch {
 	case err != nil:
 		return
 	case !access.ApproveAccess:
 		return rejected, &ENOTALLOWED
 	default:
-		_rejected, err := api.getNetworkRejected(netID, mode, index, count)
+		_rejected, err := api.getNetworkRejected(ctx, netID, mode, index, count)
 		if err != nil {
 			return rejected, err
 		}
 		for i := range _rejected {
 			rejected = append(rejected, gp.PendingPost{PostSmall: _rejected[i]})
-			processed, err := api.postProcess(rejected[i].PostSmall, userID)
+			processed, err := api.postProcess(ctx, rejected[i].PostSmall, userID)
 			if err == nil {
 				rejected[i].PostSmall = processed
 			}
-			history, err := api.reviewHistory(rejected[i].ID)
+			history, err := api.reviewHistory(ctx, rejected[i].ID)
 			if err == nil {
 				rejected[i].ReviewHistory = history
 			}
@@ -322,19 +308,19 @@ func (api *API) GetNetworkRejected(userID gp.UserID, netID gp.NetworkID, mode in
 }
 
 //PendingPosts returns this user's pending posts.
-func (api *API) PendingPosts(userID gp.UserID) (pending []gp.PendingPost, err error) {
+func (api *API) PendingPosts(ctx context.Context, userID gp.UserID) (pending []gp.PendingPost, err error) {
 	pending = make([]gp.PendingPost, 0)
-	_pending, err := api.userPendingPosts(userID)
+	_pending, err := api.userPendingPosts(ctx, userID)
 	if err != nil {
 		return pending, err
 	}
 	for i := range _pending {
 		pending = append(pending, gp.PendingPost{PostSmall: _pending[i]})
-		processed, err := api.postProcess(pending[i].PostSmall, userID)
+		processed, err := api.postProcess(ctx, pending[i].PostSmall, userID)
 		if err == nil {
 			pending[i].PostSmall = processed
 		}
-		history, err := api.reviewHistory(pending[i].ID)
+		history, err := api.reviewHistory(ctx, pending[i].ID)
 		if err == nil {
 			pending[i].ReviewHistory = history
 		}
@@ -342,54 +328,46 @@ func (api *API) PendingPosts(userID gp.UserID) (pending []gp.PendingPost, err er
 	return
 }
 
-func (api *API) silentSetApproveBadgeCount(netID gp.NetworkID, userID gp.UserID) {
-	posts, err := api.getNetworkPending(userID, netID)
+func (api *API) silentSetApproveBadgeCount(ctx context.Context, netID gp.NetworkID, userID gp.UserID) {
+	posts, err := api.getNetworkPending(ctx, userID, netID)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 	badge := len(posts)
-	users, err := api.approveUsers(netID)
+	users, err := api.approveUsers(ctx, netID)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 	for _, u := range users {
-		devices, err := getDevices(api.sc, u.ID, "approve")
+		devices, err := getDevices(ctx, api.sc, u.ID, "approve")
 		if err != nil {
 			log.Println(err)
 			continue
 		}
+		//Only the latest badge count matters.
+		pn := push.Notification{Badge: &badge, CollapseKey: "badge"}
 		for _, d := range devices {
-			switch {
-			case d.Type == "ios":
-				payload := apns.NewPayload()
-				payload.Badge = badge
-				pn := apns.NewPushNotification()
-				pn.DeviceToken = d.ID
-				pn.AddPayload(payload)
-				err := api.pushers["approve"].IOSPush(pn)
-				if err != nil {
-					log.Println(err)
-				}
-			default:
-				//We only support iOS so far.
+			err := api.pushQueue.enqueue(ctx, "approve", d, pn)
+			if err != nil {
+				log.Println(err)
 			}
 		}
 	}
 }
 
 //approveUsers returns all the users who have Approve access in this network.
-func (api *API) approveUsers(netID gp.NetworkID) (users []gp.UserRole, err error) {
-	master, err := api.masterGroup(netID)
+func (api *API) approveUsers(ctx context.Context, netID gp.NetworkID) (users []gp.UserRole, err error) {
+	master, err := api.masterGroup(ctx, netID)
 	if err != nil {
 		return
 	}
-	return getNetworkUsers(api.sc, master)
+	return api.store.Networks.Members(ctx, master)
 }
 
-func (api *API) approvalBadgeCount(userID gp.UserID, netID gp.NetworkID) (badge int) {
-	posts, err := api.getNetworkPending(userID, netID)
+func (api *API) approvalBadgeCount(ctx context.Context, userID gp.UserID, netID gp.NetworkID) (badge int) {
+	posts, err := api.getNetworkPending(ctx, userID, netID)
 	if err != nil {
 		log.Println(err)
 		return
@@ -398,49 +376,38 @@ func (api *API) approvalBadgeCount(userID gp.UserID, netID gp.NetworkID) (badge
 	return
 }
 
-func (api *API) postsToApproveNotification(userID gp.UserID, netID gp.NetworkID) {
-	badge := api.approvalBadgeCount(userID, netID)
+func (api *API) postsToApproveNotification(ctx context.Context, userID gp.UserID, netID gp.NetworkID) {
+	badge := api.approvalBadgeCount(ctx, userID, netID)
 	if badge == 0 {
 		return
 	}
-	users, err := api.approveUsers(netID)
+	users, err := api.approveUsers(ctx, netID)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 	for _, u := range users {
-		devices, err := getDevices(api.sc, u.ID, "approve")
+		devices, err := getDevices(ctx, api.sc, u.ID, "approve")
 		if err != nil {
 			log.Println(err)
 			continue
 		}
+		pn := push.Notification{
+			Alert: push.Alert{LocKey: "to_review", LocArgs: []string{strconv.Itoa(badge)}, ActionLocKey: "Review"},
+			Badge: &badge,
+			Sound: "default",
+		}
 		for _, d := range devices {
-			switch {
-			case d.Type == "ios":
-				payload := apns.NewPayload()
-				alert := apns.NewAlertDictionary()
-				alert.ActionLocKey = "Review"
-				alert.LocKey = "to_review"
-				alert.LocArgs = []string{strconv.Itoa(badge)}
-				payload.Badge = badge
-				payload.Alert = alert
-				payload.Sound = "default"
-				pn := apns.NewPushNotification()
-				pn.DeviceToken = d.ID
-				pn.AddPayload(payload)
-				err := api.pushers["approve"].IOSPush(pn)
-				if err != nil {
-					log.Println(err)
-				}
-			default:
-				//We only support iOS so far.
+			err := api.pushQueue.enqueue(ctx, "approve", d, pn)
+			if err != nil {
+				log.Println(err)
 			}
 		}
 	}
 }
 
-func (api *API) maybeResubmitPost(userID gp.UserID, postID gp.PostID, netID gp.NetworkID, reason string) (err error) {
-	pending, err := api.pendingStatus(postID)
+func (api *API) maybeResubmitPost(ctx context.Context, userID gp.UserID, postID gp.PostID, netID gp.NetworkID, reason string) (err error) {
+	pending, err := api.pendingStatus(ctx, postID)
 	if err != nil {
 		return
 	}
@@ -448,41 +415,25 @@ func (api *API) maybeResubmitPost(userID gp.UserID, postID gp.PostID, netID gp.N
 	if pending == 0 {
 		return
 	}
-	return api.ResubmitPost(userID, postID, netID, reason)
+	return api.ResubmitPost(ctx, userID, postID, netID, reason)
 }
 
 //ResubmitPost puts the post back in the approval queue to be reviewed again.
-func (api *API) ResubmitPost(userID gp.UserID, postID gp.PostID, netID gp.NetworkID, reason string) (err error) {
-	err = api.resubmitPost(userID, postID, reason)
+func (api *API) ResubmitPost(ctx context.Context, userID gp.UserID, postID gp.PostID, netID gp.NetworkID, reason string) (err error) {
+	err = api.resubmitPost(ctx, userID, postID, reason)
 	if err == nil {
-		api.postsToApproveNotification(userID, netID)
+		api.postsToApproveNotification(ctx, userID, netID)
 	}
 	return
 }
 
 //ApproveLevel returns this network's current approval level.
-func (api *API) approveLevel(netID gp.NetworkID) (level gp.ApproveLevel, err error) {
-	q := "SELECT approval_level, approved_categories FROM network WHERE id = ?"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	var approvedCategories sql.NullString
-	err = s.QueryRow(netID).Scan(&level.Level, &approvedCategories)
-	if err != nil {
-		return
-	}
-	cats := []string{}
-	if approvedCategories.Valid {
-		cats = strings.Split(approvedCategories.String, ",")
-	}
-	level.Categories = cats
-	return level, nil
+func (api *API) approveLevel(ctx context.Context, netID gp.NetworkID) (level gp.ApproveLevel, err error) {
+	return api.store.Approvals.Level(ctx, netID)
 }
 
 //SetApproveLevel updates this network's approval level.
-func (api *API) setApproveLevel(netID gp.NetworkID, level int) (err error) {
-	q := "UPDATE network SET approval_level = ?, approved_categories = ? WHERE id = ?"
+func (api *API) setApproveLevel(ctx context.Context, netID gp.NetworkID, level int) (err error) {
 	var categories string
 	switch {
 	case level == 0:
@@ -496,239 +447,83 @@ func (api *API) setApproveLevel(netID gp.NetworkID, level int) (err error) {
 	default:
 		return gp.APIerror{Reason: "That's not a valid approve level"}
 	}
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	res, err := s.Exec(level, categories, netID)
-	if err != nil {
-		return
-	}
-	affected, err := res.RowsAffected()
-	if err != nil {
-		return
-	}
-	if affected == 0 {
+	changed, err := api.store.Approvals.SetLevel(ctx, netID, level, categories)
+	if err == nil && !changed {
 		return NotChanged
 	}
 	return
 }
 
 //PendingPosts returns all the posts in this network which are awaiting review.
-func (api *API) pendingPosts(netID gp.NetworkID) (pending []gp.PostSmall, err error) {
-	pending = make([]gp.PostSmall, 0)
-	//This query assumes pending = 1 and rejected = 2
-	q := "SELECT wall_posts.id, wall_posts.`by`, time, text, network_id " +
-		"FROM wall_posts " +
-		"WHERE deleted = 0 AND pending = 1 AND network_id = ? " +
-		"ORDER BY time DESC "
-	s, err := api.sc.Prepare(q)
+func (api *API) pendingPosts(ctx context.Context, netID gp.NetworkID) (pending []gp.PostSmall, err error) {
+	stored, err := api.store.Approvals.Pending(ctx, netID)
 	if err != nil {
-		return
+		return make([]gp.PostSmall, 0), err
 	}
-	rows, err := s.Query(netID)
-	if err != nil {
-		return
-	}
-	defer rows.Close()
-	return api.scanPostRows(rows, false)
+	return api.expandPosts(ctx, stored, false)
 }
 
 //ReviewHistory returns all the review events on this post
-func (api *API) reviewHistory(postID gp.PostID) (history []gp.ReviewEvent, err error) {
+func (api *API) reviewHistory(ctx context.Context, postID gp.PostID) (history []gp.ReviewEvent, err error) {
 	history = make([]gp.ReviewEvent, 0)
-	q := "SELECT action, `by`, reason, `timestamp` FROM post_reviews WHERE post_id = ?"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	rows, err := s.Query(postID)
+	reviews, err := api.store.Approvals.History(ctx, postID)
 	if err != nil {
 		return
 	}
-	defer rows.Close()
-	for rows.Next() {
-		event := gp.ReviewEvent{}
-		var by gp.UserID
-		var reason sql.NullString
-		var t string
-		err = rows.Scan(&event.Action, &by, &reason, &t)
+	for _, review := range reviews {
+		event := gp.ReviewEvent{Action: review.Action, Reason: review.Reason, At: review.At}
+		event.By, err = api.users.byID(ctx, review.By)
 		if err != nil {
 			return
 		}
-		if reason.Valid {
-			event.Reason = reason.String
-		}
-		user, UsrErr := api.users.byID(by)
-		if UsrErr != nil {
-			return history, UsrErr
-		}
-		event.By = user
-		time, TimeErr := time.Parse(mysqlTime, t)
-		if TimeErr != nil {
-			return history, TimeErr
-		}
-		event.At = time
 		history = append(history, event)
 	}
 	return
 }
 
 //PendingStatus returns the current approval status of this post. 0 = approved, 1 = pending, 2 = rejected.
-func (api *API) pendingStatus(postID gp.PostID) (pending int, err error) {
-	q := "SELECT pending FROM wall_posts WHERE id = ?"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(postID).Scan(&pending)
-	return
+func (api *API) pendingStatus(ctx context.Context, postID gp.PostID) (pending int, err error) {
+	return api.store.Approvals.Status(ctx, postID)
 }
 
 //ApprovePost marks this post as approved by this user.
-func (api *API) approvePost(userID gp.UserID, postID gp.PostID, reason string) (err error) {
-	//Should be one transaction...
-	q := "INSERT INTO post_reviews (post_id, action, `by`, reason) VALUES (?, 'approved', ?, ?)"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(postID, userID, reason)
-	if err != nil {
-		return
-	}
-	q2 := "UPDATE wall_posts SET pending = 0 WHERE id = ?"
-	s, err = api.sc.Prepare(q2)
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(postID)
-	if err != nil {
-		return
-	}
-	q3 := "UPDATE wall_posts SET time = NOW() WHERE id = ?"
-	s, err = api.sc.Prepare(q3)
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(postID)
-	return
+func (api *API) approvePost(ctx context.Context, userID gp.UserID, postID gp.PostID, reason string) (err error) {
+	return api.store.Approvals.Approve(ctx, postID, userID, reason)
 }
 
 //GetNetworkApproved returns the 20 most recent approved posts in this network.
-func (api *API) getNetworkApproved(netID gp.NetworkID, mode int, index int64, count int) (approved []gp.PostSmall, err error) {
-	approved = make([]gp.PostSmall, 0)
-	q := "SELECT wall_posts.id, wall_posts.`by`, time, text, network_id " +
-		"FROM wall_posts JOIN post_reviews ON post_reviews.post_id = wall_posts.id " +
-		"WHERE wall_posts.deleted = 0 AND pending = 0 AND post_reviews.action = 'approved' " +
-		"AND network_id = ? "
-	switch {
-	case mode == ByOffsetDescending:
-		q += "ORDER BY post_reviews.timestamp DESC LIMIT ?, ?"
-	case mode == ChronologicallyAfterID:
-		q += "AND wall_posts.time > (SELECT time FROM wall_posts WHERE post_id = ?) " +
-			"ORDER BY post_reviews.timestamp DESC LIMIT 0, ?"
-	case mode == ChronologicallyBeforeID:
-		q += "AND wall_posts.time < (SELECT time FROM wall_posts WHERE post_id = ?) " +
-			"ORDER BY post_reviews.timestamp DESC LIMIT 0, ?"
-	}
-	s, err := api.sc.Prepare(q)
+func (api *API) getNetworkApproved(ctx context.Context, netID gp.NetworkID, mode int, index int64, count int) (approved []gp.PostSmall, err error) {
+	stored, err := api.store.Approvals.Approved(ctx, netID, mode, index, count)
 	if err != nil {
-		return
+		return make([]gp.PostSmall, 0), err
 	}
-	rows, err := s.Query(netID, index, count)
-	if err != nil {
-		return
-	}
-	defer rows.Close()
-	return api.scanPostRows(rows, false)
+	return api.expandPosts(ctx, stored, false)
 }
 
 //RejectPost marks this post as 'rejected'.
-func (api *API) rejectPost(userID gp.UserID, postID gp.PostID, reason string) (err error) {
-	q := "INSERT INTO post_reviews (post_id, action, `by`, reason) VALUES (?, 'rejected', ?, ?)"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(postID, userID, reason)
-	if err != nil {
-		return
-	}
-	q = "UPDATE wall_posts SET pending = 2 WHERE id = ?"
-	s, err = api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(postID)
-	return
+func (api *API) rejectPost(ctx context.Context, userID gp.UserID, postID gp.PostID, reason string) (err error) {
+	return api.store.Approvals.Reject(ctx, postID, userID, reason)
 }
 
 //ResubmitPost marks this post as 'pending' again.
-func (api *API) resubmitPost(userID gp.UserID, postID gp.PostID, reason string) (err error) {
-	s, err := api.sc.Prepare("INSERT INTO post_reviews (post_id, action, `by`, reason) VALUES (?, 'edited', ?, ?)")
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(postID, userID, reason)
-	if err != nil {
-		return
-	}
-	s, err = api.sc.Prepare("UPDATE wall_posts SET pending = 1 WHERE id = ?")
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(postID)
-	return
+func (api *API) resubmitPost(ctx context.Context, userID gp.UserID, postID gp.PostID, reason string) (err error) {
+	return api.store.Approvals.Resubmit(ctx, postID, userID, reason)
 }
 
 //GetNetworkRejected returns the posts in this network which have been rejected.
-func (api *API) getNetworkRejected(netID gp.NetworkID, mode int, index int64, count int) (rejected []gp.PostSmall, err error) {
-	rejected = make([]gp.PostSmall, 0)
-	q := "SELECT wall_posts.id, wall_posts.`by`, time, text, network_id " +
-		"FROM wall_posts JOIN post_reviews ON post_reviews.post_id = wall_posts.id " +
-		"WHERE wall_posts.deleted = 0 AND pending = 2 AND post_reviews.action = 'rejected' " +
-		"AND network_id = ? "
-	switch {
-	case mode == ByOffsetDescending:
-		q += "ORDER BY post_reviews.timestamp DESC LIMIT ?, ?"
-	case mode == ChronologicallyAfterID:
-		q += "AND wall_posts.time > (SELECT time FROM wall_posts WHERE post_id = ?) " +
-			"ORDER BY post_reviews.timestamp DESC LIMIT 0, ?"
-	case mode == ChronologicallyBeforeID:
-		q += "AND wall_posts.time < (SELECT time FROM wall_posts WHERE post_id = ?) " +
-			"ORDER BY post_reviews.timestamp DESC LIMIT 0, ?"
-	}
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	rows, err := s.Query(netID, index, count)
+func (api *API) getNetworkRejected(ctx context.Context, netID gp.NetworkID, mode int, index int64, count int) (rejected []gp.PostSmall, err error) {
+	stored, err := api.store.Approvals.Rejected(ctx, netID, mode, index, count)
 	if err != nil {
-		return
+		return make([]gp.PostSmall, 0), err
 	}
-	defer rows.Close()
-	return api.scanPostRows(rows, false)
+	return api.expandPosts(ctx, stored, false)
 }
 
 //UserPendingPosts returns all this user's pending posts.
-func (api *API) userPendingPosts(userID gp.UserID) (pending []gp.PostSmall, err error) {
-	pending = make([]gp.PostSmall, 0)
-	//This query assumes pending = 1 and rejected = 2
-	q := "SELECT DISTINCT wall_posts.id, wall_posts.`by`, time, text, network_id " +
-		"FROM wall_posts " +
-		"LEFT JOIN post_reviews ON wall_posts.id = post_reviews.post_id " +
-		"WHERE deleted = 0 AND pending > 0 AND wall_posts.`by` = ? " +
-		"GROUP BY wall_posts.id " +
-		"ORDER BY CASE WHEN MAX(post_reviews.timestamp) IS NULL THEN wall_posts.time ELSE MAX(post_reviews.timestamp) END DESC "
-	s, err := api.sc.Prepare(q)
+func (api *API) userPendingPosts(ctx context.Context, userID gp.UserID) (pending []gp.PostSmall, err error) {
+	stored, err := api.store.Approvals.UserPending(ctx, userID)
 	if err != nil {
-		return
-	}
-	rows, err := s.Query(userID)
-	if err != nil {
-		return
+		return make([]gp.PostSmall, 0), err
 	}
-	defer rows.Close()
-	return api.scanPostRows(rows, false)
+	return api.expandPosts(ctx, stored, false)
 }
@@ -1,6 +1,8 @@
 package lib
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"regexp"
@@ -8,8 +10,10 @@ import (
 	"time"
 	"unicode"
 
+	"github.com/Petergatsby/GleepostAPI/lib/conf"
 	"github.com/Petergatsby/GleepostAPI/lib/gp"
 	"github.com/Petergatsby/GleepostAPI/lib/psc"
+	"github.com/Petergatsby/GleepostAPI/lib/store"
 	"github.com/garyburd/redigo/redis"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -33,72 +37,145 @@ var (
 	UserAlreadyExists = gp.APIerror{Reason: "Username or email address already taken"}
 	//NoSuchUser happens when you do an action which specifies a non-existent user.
 	NoSuchUser = gp.APIerror{Reason: "That user does not exist."}
+	//ETOOWEAK - You'll get this when your password is too weak. Passwords which break the policy are rejected with a gp.ValidationErrors saying which rules they broke; errors.Is(err, ETOOWEAK) is true for those.
+	ETOOWEAK = gp.WeakPassword
+	//BadScope means you asked for a token scope which doesn't exist.
+	BadScope = gp.APIerror{Reason: "Unknown scope"}
 )
 
 //Authenticator handles user authentication.
 type Authenticator struct {
-	sc   *psc.StatementCache
-	pool *redis.Pool
-}
-
-//tokenCached returns true if this id:token pair exists.
-func (auth *Authenticator) tokenCached(id gp.UserID, token string) bool {
-	conn := auth.pool.Get()
+	sc       *psc.StatementCache
+	users    store.Users
+	tokens   store.Tokens
+	pool     *redis.Pool
+	config   conf.TokenConfig
+	throttle conf.ThrottleConfig
+	hashCost int
+}
+
+//tokenCached returns the scopes of this id:token pair if it's in the cache.
+//If ctx is already done it doesn't bother asking.
+func (auth *Authenticator) tokenCached(ctx context.Context, id gp.UserID, token string) (scopes []string, ok bool) {
+	if ctx.Err() != nil {
+		return nil, false
+	}
+	conn := redisConn(ctx, auth.pool)
 	defer conn.Close()
 	key := fmt.Sprintf("users:%d:token:%s", id, token)
-	exists, err := redis.Bool(conn.Do("EXISTS", key))
+	cached, err := redis.String(conn.Do("GET", key))
 	if err != nil {
-		return false
+		return nil, false
 	}
-	return exists
+	//Tokens cached before scopes existed hold their expiry instead; treat them as a miss.
+	scopes, err = ParseScopes(cached)
+	if err != nil {
+		return nil, false
+	}
+	return scopes, true
 }
 
-//createToken generates a new gp.Token which expires in 24h. If something goes wrong,
+//createToken generates a new gp.Token which expires after lifetime. If something goes wrong,
 //it issues a token which expires now
-func createToken(userID gp.UserID) gp.Token {
+func createToken(userID gp.UserID, lifetime time.Duration) gp.Token {
 	random, err := randomString()
 	if err != nil {
 		log.Println(err)
 		return gp.Token{UserID: userID, Token: "foo", Expiry: time.Now().UTC()}
 	}
-	expiry := time.Now().AddDate(1, 0, 0).UTC().Round(time.Second)
+	expiry := time.Now().Add(lifetime).UTC().Round(time.Second)
 	token := gp.Token{UserID: userID, Token: random, Expiry: expiry}
 	return token
 }
 
-//ValidateToken returns true if this id:token pair is valid and false otherwise (or if there's a db error).
-func (auth *Authenticator) ValidateToken(id gp.UserID, token string) bool {
+//ValidateToken returns true if this id:token pair is valid and carries scope, and false otherwise (or if there's a db error).
+func (auth *Authenticator) ValidateToken(ctx context.Context, id gp.UserID, token string, scope string) bool {
 	//If the api.db is down, this will fail for everyone who doesn't have a api.cached
 	//token, and so no new requests will be sent.
 	//I'm calling that a "feature" for now.
-	if auth.tokenCached(id, token) {
-		return true
+	scopes, ok := auth.tokenCached(ctx, id, token)
+	if !ok {
+		t, err := auth.tokenExists(ctx, id, token)
+		if err != nil {
+			return false
+		}
+		go auth.cacheToken(t)
+		scopes = t.Scopes
 	}
-	return auth.tokenExists(id, token)
+	if !hasScope(scopes, scope) {
+		return false
+	}
+	go auth.touchToken(id, token)
+	return true
 }
 
-//TokenExists returns true if this user:token pair exists, false otherwise (or in the case of error)
-func (auth *Authenticator) tokenExists(id gp.UserID, token string) bool {
-	var expiry string
-	s, err := auth.sc.Prepare("SELECT expiry FROM tokens WHERE user_id = ? AND token = ?")
+//TokenExists returns this user:token pair if it exists and hasn't expired, or an error otherwise.
+//Legacy (pre-refresh token) tokens are cut off at the configured LegacyCutoff, if there is one.
+func (auth *Authenticator) tokenExists(ctx context.Context, id gp.UserID, token string) (t gp.Token, err error) {
+	record, err := auth.tokens.Token(ctx, id, token)
 	if err != nil {
-		return false
+		return
 	}
-	err = s.QueryRow(id, token).Scan(&expiry)
+	t = gp.Token{UserID: id, Token: token, Expiry: record.Expiry}
+	if cutoff, ok := auth.config.LegacyExpiry(); record.Legacy && ok && cutoff.Before(t.Expiry) {
+		t.Expiry = cutoff
+	}
+	if !t.Expiry.After(time.Now()) {
+		err = sql.ErrNoRows
+		return
+	}
+	t.Scopes, err = ParseScopes(record.Scopes)
+	return
+}
+
+//touchToken records that this token has just been used. It only hits the db once a minute per token.
+//It runs after the request has been let through, so it doesn't share its context.
+func (auth *Authenticator) touchToken(id gp.UserID, token string) {
+	conn := auth.pool.Get()
+	defer conn.Close()
+	key := fmt.Sprintf("users:%d:token:%s:used", id, token)
+	set, err := conn.Do("SET", key, 1, "EX", 60, "NX")
+	if err != nil || set == nil {
+		return
+	}
+	err = auth.tokens.TouchToken(context.Background(), id, token)
 	if err != nil {
-		return false
+		log.Println(err)
 	}
-	t, _ := time.Parse(mysqlTime, expiry)
-	if t.After(time.Now()) {
-		return true
+}
+
+//ParseScopes turns a comma-separated list of scopes into a slice, or returns BadScope if any of them isn't one we know about.
+//An empty list means every scope.
+func ParseScopes(list string) (scopes []string, err error) {
+	if len(strings.TrimSpace(list)) == 0 {
+		return append([]string{}, gp.AllScopes...), nil
+	}
+	for _, scope := range strings.Split(list, ",") {
+		scope = strings.TrimSpace(scope)
+		if !hasScope(gp.AllScopes, scope) {
+			return nil, BadScope
+		}
+		if !hasScope(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
 	}
 	return false
 }
 
 //ValidatePass returns the id of the user with this email:pass pair, or err if the comparison is not valid.
-func (auth *Authenticator) validatePass(email string, pass string) (id gp.UserID, err error) {
+//If the stored hash is out of date, it's upgraded in the background while we have the plaintext.
+func (auth *Authenticator) validatePass(ctx context.Context, email string, pass string) (id gp.UserID, err error) {
 	passBytes := []byte(pass)
-	hash, id, err := auth.getHash(email)
+	hash, version, id, err := auth.getHash(ctx, email)
 	if err != nil {
 		return 0, err
 	}
@@ -106,59 +183,77 @@ func (auth *Authenticator) validatePass(email string, pass string) (id gp.UserID
 	if err != nil {
 		return 0, err
 	}
+	if needsRehash(hash, version, auth.hashCost) {
+		go auth.upgradeHash(id, pass, hash)
+	}
 	return id, nil
 }
 
-//GetHash returns this user's password hash (by username).
-func (auth *Authenticator) getHash(user string) (hash []byte, id gp.UserID, err error) {
-	s, err := auth.sc.Prepare("SELECT id, password FROM users WHERE email = ?")
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(user).Scan(&id, &hash)
+//GetHash returns this user's password hash and its version (by username).
+func (auth *Authenticator) getHash(ctx context.Context, user string) (hash []byte, version int, id gp.UserID, err error) {
+	id, hash, version, err = auth.users.PasswordByEmail(ctx, user)
 	return
 }
 
-//CreateAndStoreToken issues an access token for this user.
-func (auth *Authenticator) createAndStoreToken(id gp.UserID) (gp.Token, error) {
-	token := createToken(id)
-	err := auth.addToken(token)
-	go auth.cacheToken(token)
+//CreateAndStoreToken issues a short-lived access token for this user, limited to these scopes and labelled with the device it was issued to,
+//along with a refresh token which can be swapped for a new one.
+func (auth *Authenticator) createAndStoreToken(ctx context.Context, id gp.UserID, device string, scopes []string) (gp.Token, error) {
+	return auth.createSession(ctx, id, device, scopes, false)
+}
+
+//createSession issues a token as createAndStoreToken does; mfa records whether the user passed a second factor to get it.
+func (auth *Authenticator) createSession(ctx context.Context, id gp.UserID, device string, scopes []string, mfa bool) (gp.Token, error) {
+	token := createToken(id, auth.config.AccessTTL())
+	token.Scopes = scopes
+	session, err := auth.addToken(ctx, token, device, mfa)
 	if err != nil {
 		return token, err
 	}
-	return token, nil
+	go auth.cacheToken(token)
+	token.RefreshToken, err = auth.issueRefreshToken(ctx, id, session)
+	return token, err
 }
 
+//cacheScript caches a token unless it has been revoked. KEYS[1] is the token's key and KEYS[2] its revocation tombstone; ARGV is the expiry and the scopes.
+var cacheScript = redis.NewScript(2, `if redis.call("EXISTS", KEYS[2]) == 1 then return 0 end
+return redis.call("SETEX", KEYS[1], ARGV[1], ARGV[2])`)
+
 //cacheToken records this token in the cache until it expires.
+//A validation which read the token from the db just before it was revoked mustn't put it back, so this won't cache a token which has a tombstone (see evictToken).
 func (auth *Authenticator) cacheToken(token gp.Token) {
 	conn := auth.pool.Get()
 	defer conn.Close()
 	expiry := int(token.Expiry.Sub(time.Now()).Seconds())
 	key := fmt.Sprintf("users:%d:token:%s", token.UserID, token.Token)
-	conn.Send("SETEX", key, expiry, token.Expiry)
-	conn.Flush()
+	_, err := cacheScript.Do(conn, key, key+":revoked", expiry, strings.Join(token.Scopes, ","))
+	if err != nil {
+		log.Println("Error caching token:", err)
+	}
 }
 
 //AddToken records this session token in the database.
-func (auth *Authenticator) addToken(token gp.Token) (err error) {
-	s, err := auth.sc.Prepare("INSERT INTO tokens (user_id, token, expiry) VALUES (?, ?, ?)")
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(token.UserID, token.Token, token.Expiry)
-	return
+func (auth *Authenticator) addToken(ctx context.Context, token gp.Token, device string, mfa bool) (session gp.SessionID, err error) {
+	return auth.tokens.AddToken(ctx, token, device, mfa)
 }
 
-//AttemptLogin will (a) return BadLogin if your email:pass combination isn't correct; (b) return a non-nil verification status (if your account is not yet verified) and (c) if neither of the above, issue you a session token.
-func (api *API) AttemptLogin(email, pass string) (token gp.Token, verification gp.Status, err error) {
-	id, err := api.Auth.validatePass(email, pass)
+//AttemptLogin will (a) return BadLogin if your email:pass combination isn't correct; (b) return a non-nil verification status (if your account is not yet verified) and (c) if neither of the above, issue you a session token for this device, limited to these scopes.
+//If the user has two-factor authentication enabled, instead of a token they get a "2fa_required" status with a challenge to pass to CompleteLogin.
+//If this email or ip has failed too many times recently, it returns RateLimited without checking the password at all.
+func (api *API) AttemptLogin(ctx context.Context, email, pass, ip, device string, scopes []string) (token gp.Token, verification gp.Status, err error) {
+	if wait := api.Auth.throttled(ctx, "login", email, ip); wait > 0 {
+		go api.Statsd.Count(1, "gleepost.auth.login.throttled")
+		err = RateLimited{RetryAfter: wait}
+		return
+	}
+	id, err := api.Auth.validatePass(ctx, email, pass)
 	if err != nil {
 		log.Println("Error validating pass:", err)
+		api.recordFailedLogin(ctx, email, ip)
 		err = BadLogin
 		return
 	}
-	verified, err := api.isVerified(id)
+	api.Auth.clearAttempts("login", email)
+	verified, err := api.isVerified(ctx, id)
 	if err != nil {
 		return
 	}
@@ -166,43 +261,50 @@ func (api *API) AttemptLogin(email, pass string) (token gp.Token, verification g
 		verification = gp.NewStatus("unverified", email)
 		return
 	}
-	token, err = api.Auth.createAndStoreToken(id)
-	return
+	return api.startSession(ctx, id, email, device, scopes)
 }
 
-//AttemptRegister tries to register this user.
-func (api *API) AttemptRegister(email, pass, first, last, invite string) (created gp.NewUser, err error) {
-	switch {
-	case len(first) < 2:
-		err = MissingParamFirst
-		return
-	case len(last) < 1:
-		err = MissingParamLast
-		return
-	case len(pass) == 0:
-		err = MissingParamPass
-		return
-	case len(email) == 0:
-		err = MissingParamEmail
-		return
+//AttemptRegister tries to register this user. If they're verified straight away (by a valid invite) they're also logged in on this device.
+//If anything is wrong with the details they've given, it returns a gp.ValidationErrors listing all of it.
+func (api *API) AttemptRegister(ctx context.Context, email, pass, first, last, invite, device string) (created gp.NewUser, err error) {
+	var errs gp.ValidationErrors
+	missing := func(field string, e gp.APIerror) {
+		errs = append(errs, gp.FieldError{Field: field, Rule: "missing", Reason: e.Reason})
 	}
-	validates, err := api.validateEmail(email)
-	if err != nil {
-		return
+	if len(first) < 2 {
+		missing("first", MissingParamFirst)
 	}
-	if !validates {
-		err = InvalidEmail
-		return
+	if len(last) < 1 {
+		missing("last", MissingParamLast)
+	}
+	if len(pass) == 0 {
+		missing("pass", MissingParamPass)
+	} else {
+		errs = append(errs, api.checkPassword(pass, first, last, email)...)
 	}
-	return api.registerUser(pass, email, first, last, invite)
+	if len(email) == 0 {
+		missing("email", MissingParamEmail)
+	} else {
+		validates, e := api.validateEmail(ctx, email)
+		if e != nil {
+			return created, e
+		}
+		if !validates {
+			errs = append(errs, gp.FieldError{Field: "email", Rule: "invalid", Reason: InvalidEmail.Reason})
+		}
+	}
+	if len(errs) > 0 {
+		return created, errs
+	}
+	return api.registerUser(ctx, pass, email, first, last, invite, device)
 }
 
 //ValidateEmail returns true if this email (a) looks vaguely well-formed and (b) belongs to a domain who is allowed to sign up.
-func (api *API) validateEmail(email string) (validates bool, err error) {
+func (api *API) validateEmail(ctx context.Context, email string) (validates bool, err error) {
 	if !looksLikeEmail(email) {
 		return false, nil
 	}
-	rules, err := api.getRules()
+	rules, err := api.getRules(ctx)
 	if err != nil {
 		return false, err
 	}
@@ -218,32 +320,38 @@ func (api *API) testEmail(email string, rules []gp.Rule) bool {
 	return false
 }
 
-//RegisterUser accepts a password, email address, firstname and lastname. It will return an error if email isn't unique, or if pass is too short.
+//RegisterUser accepts a password, email address, firstname and lastname. It will return an error if email isn't unique.
 //If the optional "invite" is set and corresponds to email, it will skip the verification step.
-func (api *API) registerUser(pass, email, first, last, invite string) (newUser gp.NewUser, err error) {
+func (api *API) registerUser(ctx context.Context, pass, email, first, last, invite, device string) (newUser gp.NewUser, err error) {
 	email = normalizeEmail(email)
 	first = normaliseName(first)
 	last = normaliseName(last)
-	userID, err := api.createUser(first, last, pass, email)
+	userID, err := api.createUser(ctx, first, last, pass, email)
 	if err != nil {
 		return
 	}
-	_, err = api.assignNetworks(userID, email)
+	_, err = api.assignNetworks(ctx, userID, email)
 	if err != nil {
 		return
 	}
-	exists, err := api.inviteExists(email, invite)
+	exists, err := api.inviteExists(ctx, email, invite)
 	newUser.ID = userID
 	newUser.Status = "unverified"
 	if err == nil && exists {
-		err = api.verify(userID)
+		err = api.verify(ctx, userID)
 		if err != nil {
 			return
 		}
 		newUser.Status = "verified"
-		err = api.acceptAllInvites(userID, email)
+		err = api.acceptAllInvites(ctx, userID, email)
+		if err != nil {
+			return
+		}
+		var token gp.Token
+		token, err = api.Auth.createAndStoreToken(ctx, userID, device, gp.AllScopes)
+		newUser.Token = &token
 	} else {
-		err = api.generateAndSendVerification(userID, first, email)
+		err = api.generateAndSendVerification(ctx, userID, first, email)
 	}
 	go api.lookUpDirectory(userID)
 	return
@@ -260,31 +368,28 @@ func normaliseName(name string) (normalised string) {
 
 }
 
-func (api *API) createUser(first, last string, pass string, email string) (userID gp.UserID, err error) {
-	err = checkPassStrength(pass)
-	if err != nil {
-		return
-	}
-	hash, err := bcrypt.GenerateFromPassword([]byte(pass), 10)
+//createUser doesn't check pass against the password policy; callers which take a password from a user must do that first.
+func (api *API) createUser(ctx context.Context, first, last string, pass string, email string) (userID gp.UserID, err error) {
+	hash, err := api.Auth.hashPassword(pass)
 	if err != nil {
 		return 0, err
 	}
-	userID, err = api._registerUser(first, last, hash, email)
+	userID, err = api._registerUser(ctx, first, last, hash, email)
 	if err != nil {
 		return 0, err
 	}
-	api.esIndexUser(userID)
+	api.esIndexUser(ctx, userID)
 	return
 }
 
 //AttemptResendVerification tries to send a new verification email to this address, or returns NoSuchUser if that email isn't one we know about. NB: this allows account enumeration, I guess...
-func (api *API) AttemptResendVerification(email string) error {
-	userID, err := api.userWithEmail(email)
+func (api *API) AttemptResendVerification(ctx context.Context, email string) error {
+	userID, err := api.userWithEmail(ctx, email)
 	switch {
 	case err != nil: //No user with this email
 		fbid, err := api.fBUserWithEmail(email)
 		if err == nil {
-			api.FBissueVerification(fbid)
+			api.FBissueVerification(ctx, fbid)
 			return nil
 		}
 		if err == NoSuchUser {
@@ -292,23 +397,23 @@ func (api *API) AttemptResendVerification(email string) error {
 		}
 		return err
 	default:
-		user, err := api.users.byID(userID)
+		user, err := api.users.byID(ctx, userID)
 		if err != nil {
 			return err
 		}
-		api.generateAndSendVerification(userID, user.Name, email)
+		api.generateAndSendVerification(ctx, userID, user.Name, email)
 		return nil
 	}
 }
 
 //GenerateAndSendVerification generates a random string and sends it embedded in a link to the user.
 //It's probably safe to give it user input -- \r\n is stripped out.
-func (api *API) generateAndSendVerification(userID gp.UserID, user string, email string) (err error) {
+func (api *API) generateAndSendVerification(ctx context.Context, userID gp.UserID, user string, email string) (err error) {
 	random, err := randomString()
 	if err != nil {
 		return
 	}
-	err = api.setVerificationToken(userID, random)
+	err = api.setVerificationToken(ctx, userID, random)
 	if err != nil {
 		return
 	}
@@ -339,13 +444,6 @@ func looksLikeEmail(email string) bool {
 	return (true)
 }
 
-func checkPassStrength(pass string) (err error) {
-	if len(pass) < 5 {
-		return ETOOWEAK
-	}
-	return nil
-}
-
 func (api *API) verificationURL(token string) (url string) {
 	if api.Config.DevelopmentMode {
 		url = "http://localhost:8080/verification.html?token=" + token
@@ -388,59 +486,65 @@ func (api *API) issueRecoveryEmail(email string, user gp.User, token string) (er
 //Additionally, if the token has been issued as part of the facebook login process, Verify will first attempt to match the verified email with an existing gleepost account, and verify that, linking the gleepost account to the facebook id.
 //If no such account exists, Verify will create a new gleepost account for that facebook user and verify it.
 //In addition, Verify adds the user to any networks they've been invited to.
-func (api *API) Verify(token string) (err error) {
-	id, err := api.verificationTokenExists(token)
+//Once verified, the user is logged in on this device.
+func (api *API) Verify(ctx context.Context, token, device string) (session gp.Token, err error) {
+	id, err := api.verificationTokenExists(ctx, token)
 	if err == nil {
-		err = api.verify(id)
+		err = api.verify(ctx, id)
 		if err == nil {
 			var email string
-			email, err = api.getEmail(id)
+			email, err = api.getEmail(ctx, id)
 			if err != nil {
 				log.Println("Error getting user email:", err)
 				return
 			}
-			err = api.acceptAllInvites(id, email)
+			err = api.acceptAllInvites(ctx, id, email)
 		}
 		if err != nil {
 			log.Println("Error with verification/accepting invites:", err)
+			return
 		}
-		return
+		return api.Auth.createAndStoreToken(ctx, id, device, gp.AllScopes)
 	}
-	fbid, err := api.fBVerificationExists(token)
+	fbid, err := api.fBVerificationExists(ctx, token)
 	if err != nil {
 		if err != NoSuchVerificationToken {
 			log.Println("Error verifying (facebook)", err)
 		}
 		return
 	}
-	email, err := api.fBGetEmail(fbid)
+	email, err := api.fBGetEmail(ctx, fbid)
 	if err != nil {
 		log.Println("Couldn't get this facebook account's email:", err)
 		return
 	}
-	userID, err := api.userWithEmail(email)
+	userID, err := api.userWithEmail(ctx, email)
 	if err != nil {
 		log.Println("There isn't a user with this facebook email")
-		userID, err = api.createUserFromFB(fbid, email)
+		userID, err = api.createUserFromFB(ctx, fbid, email)
 		if err != nil {
 			return
 		}
 	}
-	err = api.userSetFB(userID, fbid)
+	err = api.userSetFB(ctx, userID, fbid)
 	if err == nil {
-		err = api.verify(userID)
+		err = api.verify(ctx, userID)
 		if err == nil {
 			log.Println("Verifying worked. Now setting networks from invites...")
-			err = api.acceptAllInvites(userID, email)
+			err = api.acceptAllInvites(ctx, userID, email)
 		}
 	}
-	return
+	if err != nil {
+		return
+	}
+	return api.Auth.createAndStoreToken(ctx, userID, device, gp.AllScopes)
 }
 
-//ChangePass updates a user's password, or gives a bcrypt error if the oldPass isn't valid.
-func (api *API) ChangePass(userID gp.UserID, oldPass, newPass string) (err error) {
+//ChangePass updates a user's password, or gives a bcrypt error if the oldPass isn't valid, or a gp.ValidationErrors if newPass breaks the password policy.
+//Every session other than currentToken is logged out.
+func (api *API) ChangePass(ctx context.Context, userID gp.UserID, currentToken, oldPass, newPass string) (err error) {
 	passBytes := []byte(oldPass)
-	hash, err := api.getHashByID(userID)
+	hash, err := api.getHashByID(ctx, userID)
 	if err != nil {
 		return
 	}
@@ -449,25 +553,35 @@ func (api *API) ChangePass(userID gp.UserID, oldPass, newPass string) (err error
 		err = BadPassword
 		return
 	}
-	err = checkPassStrength(newPass)
+	err = api.checkNewPassword(ctx, userID, newPass)
 	if err != nil {
 		return
 	}
-	hash, err = bcrypt.GenerateFromPassword([]byte(newPass), 10)
+	hash, err = api.Auth.hashPassword(newPass)
 	if err != nil {
 		return
 	}
-	err = api.passUpdate(userID, hash)
+	err = api.passUpdate(ctx, userID, hash)
+	if err != nil {
+		return
+	}
+	err = api.Auth.revokeAllTokens(ctx, userID, currentToken)
 	return
 }
 
 //RequestReset sends a random reset token to this email address. If it doesn't correspond to an existing user, returns an error.
-func (api *API) RequestReset(email string) (err error) {
-	userID, err := api.userWithEmail(email)
+//Every request counts towards the same backoff as failed logins, so it can't be used to flood someone's inbox.
+func (api *API) RequestReset(ctx context.Context, email, ip string) (err error) {
+	if wait := api.Auth.throttled(ctx, "reset", email, ip); wait > 0 {
+		go api.Statsd.Count(1, "gleepost.profile.request_reset.throttled")
+		return RateLimited{RetryAfter: wait}
+	}
+	api.Auth.recordAttempt("reset", email, ip)
+	userID, err := api.userWithEmail(ctx, email)
 	if err != nil {
 		return
 	}
-	user, err := api.users.byID(userID)
+	user, err := api.users.byID(ctx, userID)
 	if err != nil {
 		return
 	}
@@ -475,7 +589,7 @@ func (api *API) RequestReset(email string) (err error) {
 	if err != nil {
 		return
 	}
-	err = api.addPasswordRecovery(userID, token)
+	err = api.addPasswordRecovery(ctx, userID, token)
 	if err != nil {
 		return
 	}
@@ -483,9 +597,9 @@ func (api *API) RequestReset(email string) (err error) {
 	return
 }
 
-//ResetPass takes a reset token and a password and (if the reset token is valid) updates the password.
-func (api *API) ResetPass(userID gp.UserID, token string, newPass string) (err error) {
-	exists, err := api.checkPasswordRecovery(userID, token)
+//ResetPass takes a reset token and a password and (if the reset token is valid, and the password meets the policy) updates the password, logging out every existing session.
+func (api *API) ResetPass(ctx context.Context, userID gp.UserID, token string, newPass string) (err error) {
+	exists, err := api.checkPasswordRecovery(ctx, userID, token)
 	if err != nil {
 		return
 	}
@@ -493,108 +607,68 @@ func (api *API) ResetPass(userID gp.UserID, token string, newPass string) (err e
 		err = EBADREC
 		return
 	}
-	err = checkPassStrength(newPass)
+	err = api.checkNewPassword(ctx, userID, newPass)
 	if err != nil {
 		return
 	}
-	hash, err := bcrypt.GenerateFromPassword([]byte(newPass), 10)
+	hash, err := api.Auth.hashPassword(newPass)
 	if err != nil {
 		return
 	}
-	err = api.passUpdate(userID, hash)
+	err = api.passUpdate(ctx, userID, hash)
 	if err != nil {
 		return
 	}
-	err = api.deletePasswordRecovery(userID, token)
-	return
-}
-
-//GetHashByID returns this user's password hash.
-func (api *API) getHashByID(id gp.UserID) (hash []byte, err error) {
-	s, err := api.sc.Prepare("SELECT password FROM users WHERE id = ?")
+	err = api.Auth.revokeAllTokens(ctx, userID, "")
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(id).Scan(&hash)
+	err = api.deletePasswordRecovery(ctx, userID, token)
 	return
 }
 
-//PassUpdate replaces this user's password hash with a new one.
-func (api *API) passUpdate(id gp.UserID, newHash []byte) (err error) {
-	s, err := api.sc.Prepare("UPDATE users SET password = ? WHERE id = ?")
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(newHash, id)
+//GetHashByID returns this user's password hash.
+func (api *API) getHashByID(ctx context.Context, id gp.UserID) (hash []byte, err error) {
+	hash, _, err = api.store.Users.Password(ctx, id)
 	return
 }
 
+//PassUpdate replaces this user's password hash with a new one (made by hashPassword).
+func (api *API) passUpdate(ctx context.Context, id gp.UserID, newHash []byte) (err error) {
+	return api.store.Users.SetPassword(ctx, id, newHash, CurrentHashVersion)
+}
+
 //SetVerificationToken records a (hopefully random!) verification token for this user.
-func (api *API) setVerificationToken(id gp.UserID, token string) (err error) {
-	s, err := api.sc.Prepare("REPLACE INTO `verification` (user_id, token) VALUES (?, ?)")
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(id, token)
-	return
+func (api *API) setVerificationToken(ctx context.Context, id gp.UserID, token string) (err error) {
+	return api.store.Tokens.SetVerificationToken(ctx, id, token)
 }
 
 //VerificationTokenExists returns the user who this verification token belongs to, or an error if there isn't one.
-func (api *API) verificationTokenExists(token string) (id gp.UserID, err error) {
-	s, err := api.sc.Prepare("SELECT user_id FROM verification WHERE token = ?")
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(token).Scan(&id)
-	return
+func (api *API) verificationTokenExists(ctx context.Context, token string) (id gp.UserID, err error) {
+	return api.store.Tokens.VerificationToken(ctx, token)
 }
 
 //Verify marks a user as verified.
-func (api *API) verify(id gp.UserID) (err error) {
-	s, err := api.sc.Prepare("UPDATE users SET verified = 1 WHERE id = ?")
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(id)
-	return
+func (api *API) verify(ctx context.Context, id gp.UserID) (err error) {
+	return api.store.Users.Verify(ctx, id)
 }
 
 //IsVerified returns true if this user is verified.
-func (api *API) isVerified(user gp.UserID) (verified bool, err error) {
-	s, err := api.sc.Prepare("SELECT verified FROM users WHERE id = ?")
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(user).Scan(&verified)
-	return
+func (api *API) isVerified(ctx context.Context, user gp.UserID) (verified bool, err error) {
+	return api.store.Users.IsVerified(ctx, user)
 }
 
 //AddPasswordRecovery records a password recovery token for this user.
-func (api *API) addPasswordRecovery(userID gp.UserID, token string) (err error) {
-	s, err := api.sc.Prepare("REPLACE INTO password_recovery (token, user) VALUES (?, ?)")
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(token, userID)
-	return
+func (api *API) addPasswordRecovery(ctx context.Context, userID gp.UserID, token string) (err error) {
+	return api.store.Tokens.AddRecoveryToken(ctx, userID, token)
 }
 
 //CheckPasswordRecovery returns true if this password recovery user:token pair exists.
-func (api *API) checkPasswordRecovery(userID gp.UserID, token string) (exists bool, err error) {
-	s, err := api.sc.Prepare("SELECT count(*) FROM password_recovery WHERE user = ? and token = ?")
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(userID, token).Scan(&exists)
-	return
+func (api *API) checkPasswordRecovery(ctx context.Context, userID gp.UserID, token string) (exists bool, err error) {
+	return api.store.Tokens.RecoveryTokenExists(ctx, userID, token)
 }
 
 //DeletePasswordRecovery removes this password recovery token so it can't be used again.
-func (api *API) deletePasswordRecovery(userID gp.UserID, token string) (err error) {
-	s, err := api.sc.Prepare("DELETE FROM password_recovery WHERE user = ? and token = ?")
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(userID, token)
-	return
+func (api *API) deletePasswordRecovery(ctx context.Context, userID gp.UserID, token string) (err error) {
+	return api.store.Tokens.DeleteRecoveryToken(ctx, userID, token)
 }
@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"context"
+	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/events"
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/store"
+)
+
+//badgeCounts counts everything userID hasn't seen yet, per tab.
+func badgeCounts(ctx context.Context, st store.Store, stats PrefixStatter, userID gp.UserID) (counts gp.BadgeCounts, err error) {
+	counts.Notifications, err = st.Notifications.UnseenCount(ctx, userID)
+	if err != nil {
+		return
+	}
+	counts.Messages, err = unreadMessageCount(ctx, st.Conversations, stats, userID)
+	if err != nil {
+		return
+	}
+	counts.Groups, err = groupsNewPosts(ctx, st.Networks, stats, userID)
+	return
+}
+
+//publishBadge tells all of userID's devices what their badge counts are now, so that seeing something on one clears it on the others.
+//It outlives the request which changed the counts, so it doesn't share its context.
+func publishBadge(st store.Store, stats PrefixStatter, broker events.EventBus, userID gp.UserID) {
+	counts, err := badgeCounts(context.Background(), st, stats, userID)
+	if err != nil {
+		log.Println("Error counting badges:", err)
+		return
+	}
+	broker.PublishEvent(events.Badge, "/notifications/count", counts, []string{NotificationChannelKey(userID)})
+}
+
+//BadgeCounts returns how many unseen notifications, unread messages and new group posts userID has.
+func (api *API) BadgeCounts(ctx context.Context, userID gp.UserID) (counts gp.BadgeCounts, err error) {
+	return badgeCounts(ctx, api.store, api.Statsd, userID)
+}
+
+func (api *API) badgeChanged(userID gp.UserID) {
+	go publishBadge(api.store, api.Statsd, api.broker, userID)
+}
+
+//participantsBadgeChanged refreshes the badges of everyone in a conversation other than by, whose own messages never count as unread.
+func (api *API) participantsBadgeChanged(participants []gp.UserPresence, by gp.UserID) {
+	for _, p := range participants {
+		if p.ID != by {
+			api.badgeChanged(p.ID)
+		}
+	}
+}
+
+//groupBadgesChanged refreshes the badges of everyone in netID other than by, when a post there becomes visible. Only groups count towards the badge.
+//It runs in the background, once the post is up, so it has its own context.
+func (api *API) groupBadgesChanged(netID gp.NetworkID, by gp.UserID) {
+	ctx := context.Background()
+	group, err := api.isGroup(ctx, netID)
+	if err != nil || !group {
+		return
+	}
+	members, err := getNetworkUsers(ctx, api.store.Networks, netID)
+	if err != nil {
+		log.Println("Error getting group members; didn't update their badges:", err)
+		return
+	}
+	for _, m := range members {
+		if m.ID != by {
+			api.badgeChanged(m.ID)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 )
 
 var (
@@ -65,16 +66,68 @@ func loadConfig(fail bool) {
 
 //MysqlConfig represents the database configuration.
 type MysqlConfig struct {
-	MaxConns int
-	User     string
-	Pass     string
-	Host     string
-	Port     string
+	MaxConns      int
+	User          string
+	Pass          string
+	Host          string
+	Port          string
+	MaxStatements int    //How many prepared statements to keep. Defaults to psc.DefaultSize.
+	Database      string //Defaults to "gleepost".
+	Replicas      []ReplicaConfig
+	//ReadYourWritesSeconds is how long a user's reads go to the primary after they write, so they see their own changes. Defaults to 5.
+	ReadYourWritesSeconds int
+	//HealthCheckSeconds is how often the replicas are checked. Defaults to 5.
+	HealthCheckSeconds int
+}
+
+//ReplicaConfig is a MySQL read replica. User and Pass default to the primary's.
+type ReplicaConfig struct {
+	Host string
+	Port string
+	User string
+	Pass string
+}
+
+//ReplicaConnectionString returns the db/sql string for connecting to replica.
+func (c *MysqlConfig) ReplicaConnectionString(replica ReplicaConfig) string {
+	if replica.User == "" {
+		replica.User, replica.Pass = c.User, c.Pass
+	}
+	return replica.User + ":" + replica.Pass + "@tcp(" + replica.Host + ":" + replica.Port + ")/" + c.DatabaseName() + "?charset=utf8mb4"
+}
+
+//ReadYourWrites returns how long a user's reads should go to the primary after they write.
+func (c *MysqlConfig) ReadYourWrites() time.Duration {
+	if c.ReadYourWritesSeconds <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(c.ReadYourWritesSeconds) * time.Second
+}
+
+//HealthCheckInterval returns how often to check the replicas.
+func (c *MysqlConfig) HealthCheckInterval() time.Duration {
+	if c.HealthCheckSeconds <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(c.HealthCheckSeconds) * time.Second
+}
+
+//DatabaseName returns the name of the database to use.
+func (c *MysqlConfig) DatabaseName() string {
+	if c.Database == "" {
+		return "gleepost"
+	}
+	return c.Database
 }
 
 //ConnectionString returns the db/sql string for connecting to MySQL based on this config.
 func (c *MysqlConfig) ConnectionString() string {
-	return c.User + ":" + c.Pass + "@tcp(" + c.Host + ":" + c.Port + ")/gleepost?charset=utf8mb4"
+	return c.User + ":" + c.Pass + "@tcp(" + c.Host + ":" + c.Port + ")/" + c.DatabaseName() + "?charset=utf8mb4"
+}
+
+//ServerConnectionString returns the db/sql string for connecting to the MySQL server without choosing a database (eg, to create one). It allows several statements at once.
+func (c *MysqlConfig) ServerConnectionString() string {
+	return c.User + ":" + c.Pass + "@tcp(" + c.Host + ":" + c.Port + ")/?charset=utf8mb4&multiStatements=true"
 }
 
 //RedisConfig represents the cache configuration.
@@ -89,16 +142,34 @@ type AWSConfig struct {
 	SecretKey string
 }
 
-//APNSConfig contains Apple push credentials
+//APNSConfig contains Apple push credentials, for pushing over APNs' HTTP/2 API with token authentication.
 type APNSConfig struct {
-	CertFile   string
-	KeyFile    string
-	Production bool //Targeting real servers or sandbox?
+	AuthKey    string //Path to the .p8 signing key. iOS devices are only pushed to directly if this is set; otherwise they go through SNS.
+	KeyID      string
+	TeamID     string
+	Topic      string //The app's bundle ID.
+	Production bool   //Targeting real servers or sandbox?
+	Endpoint   string //Overrides the APNs server (eg. for testing).
+}
+
+//FCMConfig contains Firebase Cloud Messaging credentials, for pushing over the FCM HTTP v1 API.
+type FCMConfig struct {
+	ServiceAccount string //Path to the service account's JSON key. Android devices are only pushed to directly if this is set; otherwise they go through SNS.
+	Endpoint       string //Overrides the FCM server (eg. for testing).
 }
 
-//GCMConfig contains GCM credentials.
-type GCMConfig struct {
-	APIKey string
+//SNSConfig says where to reach Amazon SNS, for devices which are pushed to through their SNS endpoints.
+type SNSConfig struct {
+	Region   string //Defaults to us-west-2.
+	Endpoint string //Overrides the SNS server (eg. for testing).
+}
+
+//SNSRegion returns the AWS region SNS endpoints live in.
+func (c SNSConfig) SNSRegion() string {
+	if c.Region == "" {
+		return "us-west-2"
+	}
+	return c.Region
 }
 
 //EmailConfig contains SMTP credentials.
@@ -117,6 +188,255 @@ type FacebookConfig struct {
 	AppSecret string
 }
 
+//TokenConfig controls how long issued tokens last.
+type TokenConfig struct {
+	AccessLifetime  int    //In minutes. Defaults to an hour.
+	RefreshLifetime int    //In days. Defaults to 90.
+	LegacyCutoff    string //RFC3339. Tokens issued before refresh tokens existed stop working after this; if it's empty they last until they expire.
+}
+
+//AccessTTL is how long a new access token is valid for.
+func (c TokenConfig) AccessTTL() time.Duration {
+	if c.AccessLifetime <= 0 {
+		return time.Hour
+	}
+	return time.Duration(c.AccessLifetime) * time.Minute
+}
+
+//RefreshTTL is how long a new refresh token is valid for.
+func (c TokenConfig) RefreshTTL() time.Duration {
+	if c.RefreshLifetime <= 0 {
+		return 90 * 24 * time.Hour
+	}
+	return time.Duration(c.RefreshLifetime) * 24 * time.Hour
+}
+
+//LegacyExpiry returns the time after which legacy tokens are no longer honoured, if there is one.
+func (c TokenConfig) LegacyExpiry() (cutoff time.Time, ok bool) {
+	if len(c.LegacyCutoff) == 0 {
+		return
+	}
+	cutoff, err := time.Parse(time.RFC3339, c.LegacyCutoff)
+	if err != nil {
+		log.Println("Bad Tokens.LegacyCutoff:", err)
+		return cutoff, false
+	}
+	return cutoff, true
+}
+
+//ThrottleConfig controls brute-force protection for logging in and requesting password resets.
+type ThrottleConfig struct {
+	FreeAttempts    int //Failures per email before backoff starts. Defaults to 3.
+	FreeAttemptsIP  int //Failures per IP before backoff starts. Defaults to 20.
+	LockoutAttempts int //Failures per email before the account is locked. Defaults to 10.
+	LockoutMinutes  int //How long a lockout lasts, and how long failures are remembered. Defaults to 15.
+}
+
+//Free returns how many failures are allowed per email before backoff starts.
+func (c ThrottleConfig) Free() int {
+	if c.FreeAttempts <= 0 {
+		return 3
+	}
+	return c.FreeAttempts
+}
+
+//FreeIP returns how many failures are allowed per IP before backoff starts.
+func (c ThrottleConfig) FreeIP() int {
+	if c.FreeAttemptsIP <= 0 {
+		return 20
+	}
+	return c.FreeAttemptsIP
+}
+
+//Lockout returns how many failures per email will lock the account.
+func (c ThrottleConfig) Lockout() int {
+	if c.LockoutAttempts <= 0 {
+		return 10
+	}
+	return c.LockoutAttempts
+}
+
+//LockoutTTL returns how long a lockout lasts.
+func (c ThrottleConfig) LockoutTTL() time.Duration {
+	if c.LockoutMinutes <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(c.LockoutMinutes) * time.Minute
+}
+
+//TwoFactorConfig controls two-factor authentication.
+type TwoFactorConfig struct {
+	Issuer                 string //Shown in the user's authenticator app. Defaults to Gleepost.
+	RequireForGlobalAdmins bool   //If set, users with is_admin must use two-factor authentication for /admin and /approve.
+}
+
+//IssuerName is what authenticator apps will label our codes with.
+func (c TwoFactorConfig) IssuerName() string {
+	if len(c.Issuer) == 0 {
+		return "Gleepost"
+	}
+	return c.Issuer
+}
+
+//PasswordConfig is the policy new passwords have to meet, and how they are hashed.
+type PasswordConfig struct {
+	MinLength     int    //Defaults to 8.
+	RequireUpper  bool   //At least one upper-case letter.
+	RequireLower  bool   //At least one lower-case letter.
+	RequireDigit  bool   //At least one digit.
+	RequireSymbol bool   //At least one character which is neither a letter nor a digit.
+	AllowPersonal bool   //If set, passwords may contain the user's name or email address.
+	AllowCommon   bool   //If set, passwords on the common / breached list are allowed.
+	CommonList    string //Path to a file of extra passwords to reject, one per line, on top of the bundled list.
+	HashCost      int    //bcrypt cost for new password hashes. Defaults to 10; existing hashes are upgraded when their owner next logs in.
+}
+
+//Min returns the minimum password length.
+func (c PasswordConfig) Min() int {
+	if c.MinLength <= 0 {
+		return 8
+	}
+	return c.MinLength
+}
+
+//Cost returns the bcrypt cost new password hashes should use.
+func (c PasswordConfig) Cost() int {
+	if c.HashCost <= 0 {
+		return 10
+	}
+	return c.HashCost
+}
+
+//RealtimeConfig limits websocket (and other realtime stream) connections.
+type RealtimeConfig struct {
+	MaxPerUser     int //Connections each user may hold at once. Defaults to 10.
+	MaxConnections int //Connections this server will hold at once. Defaults to 10000.
+	SendBuffer     int //Events queued for each connection; a client which falls further behind than this is disconnected. Defaults to 256.
+	DrainSeconds   int //How long to wait for connections to close on shutdown. Defaults to 10.
+}
+
+//PerUser returns how many connections each user may hold.
+func (c RealtimeConfig) PerUser() int {
+	if c.MaxPerUser <= 0 {
+		return 10
+	}
+	return c.MaxPerUser
+}
+
+//Max returns how many connections this server will hold.
+func (c RealtimeConfig) Max() int {
+	if c.MaxConnections <= 0 {
+		return 10000
+	}
+	return c.MaxConnections
+}
+
+//Buffer returns how many events may be queued for each connection.
+func (c RealtimeConfig) Buffer() int {
+	if c.SendBuffer <= 0 {
+		return 256
+	}
+	return c.SendBuffer
+}
+
+//DrainTimeout returns how long shutdown waits for connections to close.
+func (c RealtimeConfig) DrainTimeout() time.Duration {
+	if c.DrainSeconds <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(c.DrainSeconds) * time.Second
+}
+
+//EventsConfig picks where realtime events are published.
+type EventsConfig struct {
+	Backend string //"redis" (the default), or "memory" for a single server (or tests) with no redis.
+}
+
+//Memory reports whether events stay within this process.
+func (c EventsConfig) Memory() bool {
+	return c.Backend == "memory"
+}
+
+//PushQueueConfig controls how queued push notifications are sent.
+type PushQueueConfig struct {
+	Workers     int //How many pushes are sent at once. Defaults to 4.
+	MaxAttempts int //How many times a push is tried before it's dead-lettered. Defaults to 8.
+	PollSeconds int //How often idle workers check the queue for pushes due a retry. Defaults to 5.
+}
+
+//WorkerCount returns how many workers send pushes.
+func (c PushQueueConfig) WorkerCount() int {
+	if c.Workers <= 0 {
+		return 4
+	}
+	return c.Workers
+}
+
+//Attempts returns how many times a push is tried before it's given up on.
+func (c PushQueueConfig) Attempts() int {
+	if c.MaxAttempts <= 0 {
+		return 8
+	}
+	return c.MaxAttempts
+}
+
+//PollInterval returns how often idle workers check the queue.
+func (c PushQueueConfig) PollInterval() time.Duration {
+	if c.PollSeconds <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(c.PollSeconds) * time.Second
+}
+
+//DigestConfig controls the daily / weekly digest emails.
+type DigestConfig struct {
+	Secret  string //Signs unsubscribe links. Digests aren't sent unless this is set.
+	BaseURL string //Where unsubscribe links point; the API's public address. Defaults to https://gleepost.com/api/v1.
+	Hour    int    //The hour of the day (UTC) digests go out. Defaults to 0 (midnight).
+}
+
+//APIBase returns the address unsubscribe links are relative to.
+func (c DigestConfig) APIBase() string {
+	if c.BaseURL == "" {
+		return "https://gleepost.com/api/v1"
+	}
+	return c.BaseURL
+}
+
+//MessageConfig controls what can be done to chat messages once they've been sent.
+type MessageConfig struct {
+	EditWindowSeconds int //How long senders can edit or delete a message for. Defaults to 900 (15 minutes).
+}
+
+//EditWindow returns how long after sending a message it can be edited or deleted.
+func (c MessageConfig) EditWindow() time.Duration {
+	if c.EditWindowSeconds <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(c.EditWindowSeconds) * time.Second
+}
+
+//TimeoutConfig sets how long a request may take before it's abandoned with a 504.
+type TimeoutConfig struct {
+	DefaultSeconds int            //Defaults to 30.
+	Routes         map[string]int //Seconds, by route (as it's registered, eg "/posts/{id:[0-9]+}"); overrides DefaultSeconds. A negative value means no deadline.
+}
+
+//For returns the deadline for requests to route, or false if it has none.
+func (c TimeoutConfig) For(route string) (timeout time.Duration, ok bool) {
+	seconds, set := c.Routes[route]
+	switch {
+	case set && seconds < 0:
+		return 0, false
+	case set && seconds > 0:
+		return time.Duration(seconds) * time.Second, true
+	case c.DefaultSeconds > 0:
+		return time.Duration(c.DefaultSeconds) * time.Second, true
+	default:
+		return 30 * time.Second, true
+	}
+}
+
 //Config defines all the available configuration for the API.
 type Config struct {
 	DevelopmentMode      bool
@@ -135,11 +455,22 @@ type Config struct {
 	Facebook             FacebookConfig
 	Statsd               string
 	ElasticSearch        string
+	Tokens               TokenConfig
+	Throttle             ThrottleConfig
+	TwoFactor            TwoFactorConfig
+	Passwords            PasswordConfig
+	Realtime             RealtimeConfig
+	Events               EventsConfig
+	PushQueue            PushQueueConfig
+	Digest               DigestConfig
+	Timeouts             TimeoutConfig
+	Messages             MessageConfig
 }
 
 //PusherConfig represents the configuration for sending push notifications to a particular app.
 type PusherConfig struct {
 	AppName string
 	APNS    APNSConfig
-	GCM     GCMConfig
+	FCM     FCMConfig
+	SNS     SNSConfig
 }
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -27,12 +28,19 @@ func platformFor(deviceType string) (platform string, err error) {
 }
 
 //AddDevice records this user's device for the purpose of sending them push notifications.
-func (api *API) AddDevice(user gp.UserID, deviceType, deviceID, application string) (device gp.Device, err error) {
-	device, err = getDevice(api.sc, user, deviceID)
+func (api *API) AddDevice(ctx context.Context, user gp.UserID, deviceType, deviceID, application string) (device gp.Device, err error) {
+	device, err = getDevice(ctx, api.sc, user, deviceID)
 	if err != nil {
 		log.Println("Error when getting device when trying to add device", err)
 		// return
 	}
+	pusher, ok := api.pushers[application]
+	if ok && !pusher.NeedsEndpoint(deviceType) {
+		//We push to this device directly, so there's no need for an SNS endpoint.
+		device = gp.Device{User: user, Type: deviceType, ID: deviceID}
+		err = api.setDevice(ctx, user, deviceType, deviceID, application, "")
+		return
+	}
 	if device.ARN == "" {
 		platform := ""
 		platform, err = platformFor(deviceType)
@@ -45,18 +53,18 @@ func (api *API) AddDevice(user gp.UserID, deviceType, deviceID, application stri
 			log.Println("Error when creating SNS endpoint when trying to add device", err)
 			return
 		}
-		api.setDevice(user, deviceType, deviceID, application, device.ARN)
+		api.setDevice(ctx, user, deviceType, deviceID, application, device.ARN)
 	}
 	return
 }
 
-func getDevice(sc *psc.StatementCache, user gp.UserID, deviceID string) (device gp.Device, err error) {
+func getDevice(ctx context.Context, sc *psc.StatementCache, user gp.UserID, deviceID string) (device gp.Device, err error) {
 	s, err := sc.Prepare("SELECT user_id, device_type, device_id, arn FROM devices WHERE user_id = ? AND device_id = ? LIMIT 1")
 	if err != nil {
 		return
 	}
 	var arn sql.NullString
-	err = s.QueryRow(user, deviceID).Scan(&device.User, &device.Type, &device.ID, &arn)
+	err = s.QueryRowContext(ctx, user, deviceID).Scan(&device.User, &device.Type, &device.ID, &arn)
 	if err != nil {
 		return
 	}
@@ -68,12 +76,12 @@ func getDevice(sc *psc.StatementCache, user gp.UserID, deviceID string) (device
 }
 
 //GetDevices returns all this user's associated devices.
-func getDevices(sc *psc.StatementCache, user gp.UserID, application string) (devices []gp.Device, err error) {
+func getDevices(ctx context.Context, sc *psc.StatementCache, user gp.UserID, application string) (devices []gp.Device, err error) {
 	s, err := sc.Prepare("SELECT user_id, device_type, device_id, arn FROM devices WHERE user_id = ? AND application = ?")
 	if err != nil {
 		return
 	}
-	rows, err := s.Query(user, application)
+	rows, err := s.QueryContext(ctx, user, application)
 	if err != nil {
 		return
 	}
@@ -93,23 +101,17 @@ func getDevices(sc *psc.StatementCache, user gp.UserID, application string) (dev
 }
 
 //DeleteDevice removes this user's device (they are no longer able to receive push notifications)
-func (api *API) DeleteDevice(user gp.UserID, deviceID string) (err error) {
-	return api.deleteDevice(user, deviceID)
-}
-
-//DeviceFeedback is called in response to APNS feedback; it records that a device token was no longer valid at this time and deletes it if it hasn't been re-registered since.
-func (api *API) DeviceFeedback(deviceID string, timestamp uint32) (err error) {
-	t := time.Unix(int64(timestamp), 0)
-	return api.feedback(deviceID, t)
+func (api *API) DeleteDevice(ctx context.Context, user gp.UserID, deviceID string) (err error) {
+	return api.deleteDevice(ctx, user, deviceID)
 }
 
 //AddDevice idempotently records user's ios or android device id for pushing notifications to.
-func (api *API) setDevice(user gp.UserID, deviceType, deviceID, application, arn string) (err error) {
+func (api *API) setDevice(ctx context.Context, user gp.UserID, deviceType, deviceID, application, arn string) (err error) {
 	s, err := api.sc.Prepare("REPLACE INTO devices (user_id, device_type, device_id, application, arn) VALUES (?, ?, ?, ?, ?)")
 	if err != nil {
 		return
 	}
-	_, err = s.Exec(user, deviceType, deviceID, application, arn)
+	_, err = s.ExecContext(ctx, user, deviceType, deviceID, application, arn)
 	return
 }
 
@@ -141,41 +143,49 @@ func (api *API) createEndpoint(token, platform string, user gp.UserID) (arn stri
 }
 
 //DeleteDevice deregisters this device (if it exists).
-func (api *API) deleteDevice(user gp.UserID, device string) (err error) {
+func (api *API) deleteDevice(ctx context.Context, user gp.UserID, device string) (err error) {
 	log.Printf("Deleting %d's device: %s\n", user, device)
 	s, err := api.sc.Prepare("DELETE FROM devices WHERE user_id = ? AND device_id = ?")
 	if err != nil {
 		return
 	}
-	_, err = s.Exec(user, device)
+	_, err = s.ExecContext(ctx, user, device)
 	return
 }
 
-//Feedback deletes the ios device with this ID unless it has been re-registered more recently than timestamp.
-func (api *API) feedback(deviceID string, timestamp time.Time) (err error) {
-	s, err := api.sc.Prepare("DELETE FROM devices WHERE device_id = ? AND last_update < ? AND device_type = 'ios'")
-	r, err := s.Exec(deviceID, timestamp)
+//Feedback deletes the device with this ID unless it has been re-registered more recently than timestamp.
+func (api *API) feedback(ctx context.Context, deviceID string, timestamp time.Time) (err error) {
+	s, err := api.sc.Prepare("DELETE FROM devices WHERE device_id = ? AND last_update < ?")
+	if err != nil {
+		return
+	}
+	r, err := s.ExecContext(ctx, deviceID, timestamp)
+	if err != nil {
+		return
+	}
 	n, _ := r.RowsAffected()
 	log.Printf("Feedback: %d devices deleted\n", n)
 	return
 }
 
 //GetAllDevices returns all pushable devices on this platform. Use with caution!
-func (api *API) getAllDevices(platform string) (devices []gp.Device, err error) {
-	s, err := api.sc.Prepare("SELECT user_id, device_type, device_id FROM devices WHERE device_type = ?")
+func (api *API) getAllDevices(ctx context.Context, platform string) (devices []gp.Device, err error) {
+	s, err := api.sc.Prepare("SELECT user_id, device_type, device_id, arn FROM devices WHERE device_type = ? AND application = 'gleepost'")
 	if err != nil {
 		return
 	}
-	rows, err := s.Query(platform)
+	rows, err := s.QueryContext(ctx, platform)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
 	for rows.Next() {
 		device := gp.Device{}
-		if err = rows.Scan(&device.User, &device.Type, &device.ID); err != nil {
+		var arn sql.NullString
+		if err = rows.Scan(&device.User, &device.Type, &device.ID, &arn); err != nil {
 			return
 		}
+		device.ARN = arn.String
 		devices = append(devices, device)
 	}
 	return
@@ -0,0 +1,319 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"log"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+//How often a user can ask to get a digest email.
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+	DigestNever  = "never"
+	//defaultDigest is the frequency of users who haven't chosen.
+	defaultDigest = DigestWeekly
+)
+
+var (
+	//BadDigestFrequency means the frequency wasn't daily, weekly or never.
+	BadDigestFrequency = gp.APIerror{Reason: "Digest frequency must be daily, weekly or never"}
+	//BadUnsubscribe means an unsubscribe link has been tampered with.
+	BadUnsubscribe = gp.APIerror{Reason: "Invalid unsubscribe link"}
+)
+
+//digestBatch is how many users are looked at each time the digest daemon looks for work.
+const digestBatch = 500
+
+//digestLines say what each type of notification was about, given who it was from.
+var digestLines = map[string]string{
+	"added_group":   "%s added you to %s",
+	"group_post":    "%s posted in %s",
+	"group_request": "%s asked to join %s",
+	"added_you":     "%s added you to their contacts",
+	"accepted_you":  "%s accepted your contact request",
+	"liked":         "%s liked your post",
+	"commented":     "%s commented on your post",
+	"commented2":    "%s commented on a post you commented on",
+	"attended":      "%s is attending your event",
+	"poll_vote":     "%s voted in your poll",
+	"approved_post": "%s approved your post",
+	"rejected_post": "%s rejected your post",
+}
+
+//digest is everything a user has missed.
+type digest struct {
+	Name          string
+	Notifications []string
+	More          int //Unseen notifications which didn't fit.
+	Messages      int
+	GroupPosts    int
+	Unsubscribe   string
+}
+
+func (d digest) empty() bool {
+	return len(d.Notifications) == 0 && d.More == 0 && d.Messages == 0 && d.GroupPosts == 0
+}
+
+var digestTemplate = template.Must(template.New("digest").Parse(`<html><body>
+<p>Hi {{.Name}}, here's what you've missed on Gleepost.</p>
+{{if .Notifications}}<ul>{{range .Notifications}}
+<li>{{.}}</li>{{end}}
+</ul>{{end}}
+{{if .More}}<p>...and {{.More}} more notifications.</p>{{end}}
+{{if .Messages}}<p>You have {{.Messages}} unread messages.</p>{{end}}
+{{if .GroupPosts}}<p>There are {{.GroupPosts}} new posts in your groups.</p>{{end}}
+<p><a href="https://gleepost.com">Open Gleepost</a></p>
+<p style="font-size:small">Don't want these emails? <a href="{{.Unsubscribe}}">Unsubscribe</a>.</p>
+</body></html>`))
+
+func (d digest) render() (html string, err error) {
+	var buf bytes.Buffer
+	err = digestTemplate.Execute(&buf, d)
+	return buf.String(), err
+}
+
+//digestLine describes one notification, like "Alice and 3 others liked your post".
+func digestLine(n gp.Notification, groupName string) string {
+	who := n.By.Name
+	switch {
+	case n.Count == 2:
+		who += " and 1 other"
+	case n.Count > 2:
+		who += fmt.Sprintf(" and %d others", n.Count-1)
+	}
+	line, ok := digestLines[n.Type]
+	if !ok {
+		return ""
+	}
+	if n.Group > 0 {
+		return fmt.Sprintf(line, who, groupName)
+	}
+	return fmt.Sprintf(line, who)
+}
+
+//unsubscribeSignature proves an unsubscribe link was made by us, for this user.
+func unsubscribeSignature(secret string, userID gp.UserID) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "unsubscribe:%d", userID)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (api *API) unsubscribeURL(userID gp.UserID) string {
+	return fmt.Sprintf("%s/unsubscribe?user=%d&sig=%s", api.Config.Digest.APIBase(), userID, unsubscribeSignature(api.Config.Digest.Secret, userID))
+}
+
+//digestHeaders let mail clients offer their own unsubscribe button, which POSTs to the link (RFC 8058) rather than opening it.
+func digestHeaders(unsubscribe string) map[string]string {
+	return map[string]string{
+		"List-Unsubscribe":      "<" + unsubscribe + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+}
+
+//CheckUnsubscribe returns BadUnsubscribe unless signature is the one from the unsubscribe link in userID's digest emails.
+func (api *API) CheckUnsubscribe(userID gp.UserID, signature string) error {
+	if api.Config.Digest.Secret == "" || !hmac.Equal([]byte(signature), []byte(unsubscribeSignature(api.Config.Digest.Secret, userID))) {
+		return BadUnsubscribe
+	}
+	return nil
+}
+
+//Unsubscribe stops digest emails to userID, given the signature from the link in one of them. It doesn't need the user to be logged in.
+func (api *API) Unsubscribe(ctx context.Context, userID gp.UserID, signature string) (err error) {
+	err = api.CheckUnsubscribe(userID, signature)
+	if err != nil {
+		return
+	}
+	go api.Statsd.Count(1, "gleepost.digest.unsubscribe")
+	return api.SetDigestFrequency(ctx, userID, DigestNever)
+}
+
+//SetDigestFrequency sets how often userID gets a digest email: daily, weekly or never.
+func (api *API) SetDigestFrequency(ctx context.Context, userID gp.UserID, frequency string) (err error) {
+	if frequency != DigestDaily && frequency != DigestWeekly && frequency != DigestNever {
+		return BadDigestFrequency
+	}
+	s, err := api.sc.Prepare("INSERT INTO email_digests (user_id, frequency) VALUES (?, ?) ON DUPLICATE KEY UPDATE frequency = VALUES(frequency)")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, userID, frequency)
+	return
+}
+
+func (api *API) digestFrequency(ctx context.Context, userID gp.UserID) (frequency string, err error) {
+	s, err := api.sc.Prepare("SELECT frequency FROM email_digests WHERE user_id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, userID).Scan(&frequency)
+	if err == sql.ErrNoRows {
+		return defaultDigest, nil
+	}
+	return
+}
+
+//DigestDaemon sends digest emails to everyone who's due one, once a day at the configured hour.
+func (api *API) DigestDaemon() {
+	if api.Config.Digest.Secret == "" {
+		log.Println("No Digest.Secret; not sending digest emails")
+		return
+	}
+	ctx := context.Background()
+	for now := range time.Tick(time.Hour) {
+		if now.UTC().Hour() == api.Config.Digest.Hour {
+			api.sendDigests(ctx)
+		}
+	}
+}
+
+func (api *API) sendDigests(ctx context.Context) {
+	for {
+		due, err := api.dueDigests(ctx)
+		if err != nil {
+			log.Println("Error finding digests to send:", err)
+			return
+		}
+		for _, userID := range due {
+			claimed, err := api.claimDigest(ctx, userID)
+			switch {
+			case err != nil:
+				log.Println("Error claiming digest:", err)
+				return
+			case !claimed:
+				continue
+			}
+			err = api.sendDigest(ctx, userID)
+			if err != nil {
+				log.Println("Error sending digest:", err)
+			}
+		}
+		if len(due) < digestBatch {
+			return
+		}
+	}
+}
+
+//dueDigests finds users whose daily or weekly digest is due. Another server may get to them first, so each has to be claimed before it's sent.
+func (api *API) dueDigests(ctx context.Context) (due []gp.UserID, err error) {
+	q := "SELECT users.id FROM users LEFT JOIN email_digests ON email_digests.user_id = users.id " +
+		"WHERE users.verified = 1 AND COALESCE(email_digests.frequency, ?) != 'never' " +
+		"AND (email_digests.last_sent IS NULL " +
+		"OR (COALESCE(email_digests.frequency, ?) = 'daily' AND email_digests.last_sent < NOW() - INTERVAL 23 HOUR) " +
+		"OR (COALESCE(email_digests.frequency, ?) = 'weekly' AND email_digests.last_sent < NOW() - INTERVAL 167 HOUR)) " +
+		"LIMIT ?"
+	s, err := api.sc.Prepare(q)
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, defaultDigest, defaultDigest, defaultDigest, digestBatch)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userID gp.UserID
+		if err = rows.Scan(&userID); err != nil {
+			return
+		}
+		due = append(due, userID)
+	}
+	return due, rows.Err()
+}
+
+//claimDigest marks userID's digest sent, if it's still due. Only one server can claim it, so claimed is false if someone else already has.
+func (api *API) claimDigest(ctx context.Context, userID gp.UserID) (claimed bool, err error) {
+	s, err := api.sc.Prepare("INSERT IGNORE INTO email_digests (user_id, frequency) VALUES (?, ?)")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, userID, defaultDigest)
+	if err != nil {
+		return
+	}
+	s, err = api.sc.Prepare("UPDATE email_digests SET last_sent = NOW() WHERE user_id = ? AND frequency != 'never' " +
+		"AND (last_sent IS NULL " +
+		"OR (frequency = 'daily' AND last_sent < NOW() - INTERVAL 23 HOUR) " +
+		"OR (frequency = 'weekly' AND last_sent < NOW() - INTERVAL 167 HOUR))")
+	if err != nil {
+		return
+	}
+	res, err := s.ExecContext(ctx, userID)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+//collectDigest gathers what userID has missed: their unseen notifications (those they want to hear about by email), unread messages and new posts in their groups.
+func (api *API) collectDigest(ctx context.Context, userID gp.UserID) (d digest, err error) {
+	user, err := api.users.byID(ctx, userID)
+	if err != nil {
+		return
+	}
+	d.Name = user.Name
+	unseen, err := api.userUnreadNotifications(ctx, userID)
+	if err != nil {
+		return
+	}
+	notifications, err := api.GetUserNotifications(ctx, userID, ByOffsetDescending, 0, false)
+	if err != nil {
+		return
+	}
+	for _, n := range notifications {
+		channels, e := notificationChannels(ctx, api.sc, userID, n.Type, n.Group)
+		if e != nil {
+			log.Println(e)
+		} else if !channels.Email {
+			continue
+		}
+		var name string
+		if n.Group > 0 {
+			name, _ = api.store.Networks.Name(ctx, n.Group)
+		}
+		if line := digestLine(n, name); line != "" {
+			d.Notifications = append(d.Notifications, line)
+		}
+	}
+	if more := unseen - len(notifications); more > 0 {
+		d.More = more
+	}
+	d.Messages, err = api.UnreadMessageCount(ctx, userID)
+	if err != nil {
+		return
+	}
+	d.GroupPosts, err = api.totalGroupsNewPosts(ctx, userID)
+	if err != nil {
+		return
+	}
+	d.Unsubscribe = api.unsubscribeURL(userID)
+	return
+}
+
+func (api *API) sendDigest(ctx context.Context, userID gp.UserID) (err error) {
+	d, err := api.collectDigest(ctx, userID)
+	if err != nil || d.empty() {
+		return
+	}
+	html, err := d.render()
+	if err != nil {
+		return
+	}
+	email, err := api.getEmail(ctx, userID)
+	if err != nil {
+		return
+	}
+	go api.Statsd.Count(1, "gleepost.digest.sent")
+	return api.Mail.SendHTMLWithHeaders(email, d.Name+", here's what you've missed on Gleepost", html, digestHeaders(d.Unsubscribe))
+}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
@@ -9,14 +10,14 @@ import (
 	"github.com/mattbaird/elastigo/lib"
 )
 
-func (api *API) esIndexGroup(groupID gp.NetworkID) {
+func (api *API) esIndexGroup(ctx context.Context, groupID gp.NetworkID) {
 	var pgroup gp.ParentedGroup
 	var err error
-	pgroup.Group, err = api.getNetwork(groupID)
+	pgroup.Group, err = api.getNetwork(ctx, groupID)
 	if err != nil {
 		log.Println("Error getting group for ElasticSearch:", groupID, err)
 	}
-	pgroup.Parent, err = api.networkParent(groupID)
+	pgroup.Parent, err = api.networkParent(ctx, groupID)
 	if err != nil {
 		log.Println("Error getting group parent for ElasticSearch:", groupID, err)
 	}
@@ -25,7 +26,7 @@ func (api *API) esIndexGroup(groupID gp.NetworkID) {
 	c.Index("gleepost", "networks", fmt.Sprintf("%d", pgroup.ID), nil, pgroup)
 }
 
-func (api *API) esBulkIndexGroups() {
+func (api *API) esBulkIndexGroups(ctx context.Context) {
 	c := elastigo.NewConn()
 	c.Domain = api.Config.ElasticSearch
 	indexer := c.NewBulkIndexerErrors(10, 60)
@@ -41,7 +42,7 @@ func (api *API) esBulkIndexGroups() {
 		log.Println("Error preparing statement:", err)
 		return
 	}
-	rows, err := s.Query()
+	rows, err := s.QueryContext(ctx)
 	if err != nil {
 		log.Println("Error dumping groups into elasticsearch:", err)
 		return
@@ -60,11 +61,11 @@ func (api *API) esBulkIndexGroups() {
 			group.Image = img.String
 		}
 		if creator.Valid {
-			u, err := api.users.byID(gp.UserID(creator.Int64))
+			u, err := api.users.byID(ctx, gp.UserID(creator.Int64))
 			if err == nil {
 				group.Creator = &u
 			}
-			group.MemberCount, _ = api.groupMemberCount(group.ID)
+			group.MemberCount, _ = api.groupMemberCount(ctx, group.ID)
 		}
 		if desc.Valid {
 			group.Desc = desc.String
@@ -80,7 +81,7 @@ func (api *API) esBulkIndexGroups() {
 }
 
 //ElasticSearchBulkReindex adds all users/groups to the search index.
-func (api *API) ElasticSearchBulkReindex() {
-	api.esBulkIndexUsers()
-	api.esBulkIndexGroups()
+func (api *API) ElasticSearchBulkReindex(ctx context.Context) {
+	api.esBulkIndexUsers(ctx)
+	api.esBulkIndexGroups(ctx)
 }
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"fmt"
 	"log"
 
@@ -8,13 +9,13 @@ import (
 	"github.com/mattbaird/elastigo/lib"
 )
 
-func (api *API) esIndexUser(userID gp.UserID) {
-	user, err := api._getProfile(userID)
+func (api *API) esIndexUser(ctx context.Context, userID gp.UserID) {
+	user, err := api._getProfile(ctx, userID)
 	if err != nil {
 		log.Println("Error getting profile for elasticsearch index:", userID, err)
 		return
 	}
-	user.Network, err = api.getUserUniversity(user.ID)
+	user.Network, err = api.getUserUniversity(ctx, user.ID)
 	if err != nil {
 		return
 	}
@@ -23,37 +24,25 @@ func (api *API) esIndexUser(userID gp.UserID) {
 	c.Index("gleepost", "users", fmt.Sprintf("%d", user.ID), nil, user)
 }
 
-func (api *API) esBulkIndexUsers() {
+func (api *API) esBulkIndexUsers(ctx context.Context) {
 	c := elastigo.NewConn()
 	c.Domain = api.Config.ElasticSearch
 	indexer := c.NewBulkIndexerErrors(10, 60)
 
 	indexer.Start()
 	defer indexer.Stop()
-	s, err := api.sc.Prepare("SELECT id FROM users")
+	ids, err := api.store.Users.IDs(ctx)
 	if err != nil {
 		log.Println("error running elasticsearch dump:", err)
 		return
 	}
-	rows, err := s.Query()
-	if err != nil {
-		log.Println("error running elasticsearch dump:", err)
-		return
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var userID gp.UserID
-		err = rows.Scan(&userID)
-		if err != nil {
-			log.Println("error running elasticsearch dump:", err)
-			continue
-		}
-		user, err := api._getProfile(userID)
+	for _, userID := range ids {
+		user, err := api._getProfile(ctx, userID)
 		if err != nil {
 			log.Println("Error getting profile for elasticsearch index:", userID, err)
 			continue
 		}
-		user.Network, err = api.getUserUniversity(user.ID)
+		user.Network, err = api.getUserUniversity(ctx, user.ID)
 		if err != nil {
 			log.Println("Error getting user university for elasticsearch index:", userID, err)
 			continue
@@ -0,0 +1,28 @@
+package events
+
+import (
+	"github.com/Petergatsby/GleepostAPI/lib/conf"
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+//EventBus carries realtime events from wherever they happen to the clients subscribed to them.
+type EventBus interface {
+	//PublishEvent broadcasts an event of type etype with location "where" and a payload of data encoded as JSON to all of channels.
+	//data must be the payload etype was registered with; anything else is dropped.
+	PublishEvent(etype string, where string, data interface{}, channels []string)
+	//EventSubscribe subscribes to the channels in subscriptions, and returns them as a combined MsgQueue.
+	EventSubscribe(subscriptions []string) (events gp.MsgQueue)
+	//EventsSince returns the events published to channel after since, oldest first, along with the channel's latest sequence number.
+	//If some have already been forgotten, complete is false.
+	EventsSince(channel string, since int64) (messages [][]byte, latest int64, complete bool, err error)
+	//LatestSeqs returns the sequence number of the last event published to each of channels (0 if there hasn't been one).
+	LatestSeqs(channels []string) (latest map[string]int64, err error)
+}
+
+//NewBus returns the EventBus config asks for.
+func NewBus(config conf.EventsConfig, redis conf.RedisConfig) EventBus {
+	if config.Memory() {
+		return NewMemory()
+	}
+	return New(redis)
+}
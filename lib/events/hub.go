@@ -0,0 +1,201 @@
+package events
+
+import (
+	"log"
+	"sync"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/garyburd/redigo/redis"
+)
+
+//subscriberBuffer is how many events a subscriber can fall behind by before it's cut off.
+//Every subscriber shares one redis connection, so one which stops reading mustn't be allowed to hold the rest up.
+const subscriberBuffer = 64
+
+//hub shares a single redis subscription between every local subscriber, instead of each holding its own connection.
+//A redis channel is subscribed to while at least one local subscriber wants it, and every event published to it is copied to each of them.
+//A hub with no dial never talks to redis; events reach its subscribers only through deliver.
+type hub struct {
+	dial func() (redis.Conn, error)
+	mu   sync.Mutex
+	psc  *redis.PubSubConn
+	subs map[string]map[*subscriber]bool
+}
+
+type subscriber struct {
+	messages chan []byte
+	channels map[string]bool
+	closed   bool
+}
+
+func newHub(dial func() (redis.Conn, error)) *hub {
+	return &hub{dial: dial, subs: make(map[string]map[*subscriber]bool)}
+}
+
+//subscribe returns a MsgQueue of the events published to channels, which behaves just as though it had a redis connection to itself:
+//SUBSCRIBE and UNSUBSCRIBE commands change what it receives, and Messages closes once it's unsubscribed from everything (or if redis goes away).
+func (h *hub) subscribe(channels []string) (events gp.MsgQueue) {
+	commands := make(chan gp.QueueCommand)
+	s := &subscriber{messages: make(chan []byte, subscriberBuffer), channels: make(map[string]bool)}
+	events = gp.MsgQueue{Commands: commands, Messages: s.messages}
+	h.mu.Lock()
+	h.add(s, channels)
+	h.mu.Unlock()
+	go h.control(s, commands)
+	return
+}
+
+//control applies a subscriber's commands until they stop, when it's unsubscribed from everything.
+func (h *hub) control(s *subscriber, commands <-chan gp.QueueCommand) {
+	for command := range commands {
+		h.mu.Lock()
+		switch {
+		case command.Command == "SUBSCRIBE":
+			h.add(s, command.Value)
+		case command.Command == "UNSUBSCRIBE" && len(command.Value) == 0:
+			h.remove(s, nil)
+		case command.Command == "UNSUBSCRIBE":
+			h.remove(s, command.Value)
+		}
+		h.mu.Unlock()
+	}
+	h.mu.Lock()
+	h.remove(s, nil)
+	h.mu.Unlock()
+}
+
+//add subscribes s to channels, subscribing to them in redis if nobody else here already is. h.mu must be held.
+func (h *hub) add(s *subscriber, channels []string) {
+	if s.closed {
+		return
+	}
+	var fresh []interface{}
+	for _, channel := range channels {
+		if s.channels[channel] {
+			continue
+		}
+		s.channels[channel] = true
+		if h.subs[channel] == nil {
+			h.subs[channel] = make(map[*subscriber]bool)
+			fresh = append(fresh, channel)
+		}
+		h.subs[channel][s] = true
+	}
+	if len(fresh) == 0 || h.dial == nil {
+		return
+	}
+	if h.psc == nil {
+		conn, err := h.dial()
+		if err != nil {
+			log.Println("Error connecting to redis:", err)
+			h.reset()
+			return
+		}
+		h.psc = &redis.PubSubConn{Conn: conn}
+		go h.receive(h.psc)
+	}
+	err := h.psc.Subscribe(fresh...)
+	if err != nil {
+		log.Println("Error subscribing:", err)
+		h.reset()
+	}
+}
+
+//remove unsubscribes s from channels (or from everything, if channels is nil), and closes it if that leaves it with nothing.
+//Channels nobody here wants any more are unsubscribed from in redis. h.mu must be held.
+func (h *hub) remove(s *subscriber, channels []string) {
+	if s.closed {
+		return
+	}
+	if channels == nil {
+		for channel := range s.channels {
+			channels = append(channels, channel)
+		}
+	}
+	var stale []interface{}
+	for _, channel := range channels {
+		if !s.channels[channel] {
+			continue
+		}
+		delete(s.channels, channel)
+		delete(h.subs[channel], s)
+		if len(h.subs[channel]) == 0 {
+			delete(h.subs, channel)
+			stale = append(stale, channel)
+		}
+	}
+	if len(stale) > 0 && h.psc != nil {
+		err := h.psc.Unsubscribe(stale...)
+		if err != nil {
+			log.Println("Error unsubscribing:", err)
+			h.reset()
+		}
+	}
+	if len(s.channels) == 0 && !s.closed {
+		s.closed = true
+		close(s.messages)
+	}
+}
+
+//reset drops the redis connection and every subscriber along with it; they'll have to subscribe again (and resume what they missed). h.mu must be held.
+func (h *hub) reset() {
+	if h.psc != nil {
+		h.psc.Conn.Close()
+		h.psc = nil
+	}
+	for _, subs := range h.subs {
+		for s := range subs {
+			if !s.closed {
+				s.closed = true
+				close(s.messages)
+			}
+		}
+	}
+	h.subs = make(map[string]map[*subscriber]bool)
+}
+
+//receive copies each event from redis to everyone subscribed to its channel, until the connection fails.
+func (h *hub) receive(psc *redis.PubSubConn) {
+	for {
+		switch n := psc.Receive().(type) {
+		case redis.Message:
+			h.deliver(n.Channel, n.Data)
+		case error:
+			h.mu.Lock()
+			//If we've already replaced this connection, its subscribers have been dealt with.
+			if h.psc == psc {
+				log.Println("Saw an error: ", n)
+				h.reset()
+			}
+			h.mu.Unlock()
+			return
+		}
+	}
+}
+
+//deliver copies message to everyone subscribed to channel.
+func (h *hub) deliver(channel string, message []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs[channel] {
+		select {
+		case s.messages <- message:
+		default:
+			log.Println("Subscriber isn't keeping up; dropping it.")
+			h.remove(s, nil)
+		}
+	}
+}
+
+//count returns how many channels are subscribed to in redis, and how many local subscribers there are.
+func (h *hub) count() (channels, subscribers int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	seen := make(map[*subscriber]bool)
+	for _, subs := range h.subs {
+		for s := range subs {
+			seen[s] = true
+		}
+	}
+	return len(h.subs), len(seen)
+}
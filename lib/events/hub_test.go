@@ -0,0 +1,162 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/garyburd/redigo/redis"
+)
+
+//fakeRedis stands in for a redis server: it tracks what's subscribed to, and delivers whatever's published.
+type fakeRedis struct {
+	mu         sync.Mutex
+	dials      int
+	subscribed map[string]bool
+	replies    chan interface{}
+	closed     chan struct{}
+	closeOnce  sync.Once
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{subscribed: make(map[string]bool), replies: make(chan interface{}, 16), closed: make(chan struct{})}
+}
+
+func (f *fakeRedis) dial() (redis.Conn, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dials++
+	return f, nil
+}
+
+func (f *fakeRedis) publish(channel string, data []byte) {
+	f.replies <- []interface{}{[]byte("message"), []byte(channel), data}
+}
+
+func (f *fakeRedis) isSubscribed(channel string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.subscribed[channel]
+}
+
+func (f *fakeRedis) Close() error {
+	f.closeOnce.Do(func() { close(f.closed) })
+	return nil
+}
+
+func (f *fakeRedis) Err() error { return nil }
+
+func (f *fakeRedis) Do(command string, args ...interface{}) (interface{}, error) {
+	return nil, f.Send(command, args...)
+}
+
+func (f *fakeRedis) Send(command string, args ...interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, arg := range args {
+		f.subscribed[arg.(string)] = command == "SUBSCRIBE"
+	}
+	return nil
+}
+
+func (f *fakeRedis) Flush() error { return nil }
+
+func (f *fakeRedis) Receive() (interface{}, error) {
+	select {
+	case reply := <-f.replies:
+		return reply, nil
+	case <-f.closed:
+		return nil, errors.New("connection closed")
+	}
+}
+
+func receive(t *testing.T, events gp.MsgQueue, expected string) {
+	select {
+	case message := <-events.Messages:
+		if string(message) != expected {
+			t.Fatalf("Expected %s, got %s", expected, message)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected %s, got nothing", expected)
+	}
+}
+
+func TestRefcount(t *testing.T) {
+	f := newFakeRedis()
+	h := newHub(f.dial)
+	first := h.subscribe([]string{"a", "b"})
+	second := h.subscribe([]string{"a"})
+	if f.dials != 1 {
+		t.Fatalf("Expected subscribers to share one connection, got %d", f.dials)
+	}
+	f.publish("a", []byte("1"))
+	receive(t, first, "1")
+	receive(t, second, "1")
+
+	first.Commands <- gp.QueueCommand{Command: "UNSUBSCRIBE", Value: []string{"a"}}
+	if !f.isSubscribed("a") {
+		t.Fatal("a is still wanted by second")
+	}
+	f.publish("b", []byte("2"))
+	receive(t, first, "2")
+
+	second.Commands <- gp.QueueCommand{Command: "UNSUBSCRIBE", Value: []string{}}
+	if _, ok := <-second.Messages; ok {
+		t.Fatal("Expected Messages to close after unsubscribing from everything")
+	}
+	if f.isSubscribed("a") {
+		t.Fatal("Nobody wants a any more")
+	}
+	if channels, subscribers := h.count(); channels != 1 || subscribers != 1 {
+		t.Fatalf("Expected 1 channel and 1 subscriber, got %d and %d", channels, subscribers)
+	}
+}
+
+func TestConnectionLost(t *testing.T) {
+	f := newFakeRedis()
+	h := newHub(f.dial)
+	events := h.subscribe([]string{"a"})
+	f.Close()
+	select {
+	case _, ok := <-events.Messages:
+		if ok {
+			t.Fatal("Expected Messages to close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected Messages to close when redis goes away")
+	}
+}
+
+//BenchmarkFanout publishes to a network channel which 10,000 clients are subscribed to (each along with a channel of their own).
+func BenchmarkFanout(b *testing.B) {
+	const clients = 10000
+	f := newFakeRedis()
+	h := newHub(f.dial)
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	queues := make([]gp.MsgQueue, clients)
+	for i := range queues {
+		queues[i] = h.subscribe([]string{fmt.Sprintf("c:%d", i), "n:1"})
+	}
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	channels, _ := h.count()
+	b.Logf("%d clients: %d redis connection(s), %d channels, ~%d bytes per client", clients, f.dials, channels, (after.HeapAlloc-before.HeapAlloc)/clients)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		f.publish("n:1", []byte("{}"))
+		for _, q := range queues {
+			<-q.Messages
+		}
+	}
+	b.StopTimer()
+	for _, q := range queues {
+		close(q.Commands)
+	}
+}
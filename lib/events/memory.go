@@ -0,0 +1,76 @@
+package events
+
+import (
+	"log"
+	"sync"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+//Memory is an EventBus which never leaves this process: fine for a single server, or for tests, but clients connected to other servers won't hear about anything published here.
+type Memory struct {
+	mu      sync.Mutex
+	seqs    map[string]int64
+	history map[string][][]byte
+	hub     *hub
+}
+
+//NewMemory constructs an empty in-process EventBus.
+func NewMemory() *Memory {
+	return &Memory{seqs: make(map[string]int64), history: make(map[string][][]byte), hub: newHub(nil)}
+}
+
+//PublishEvent broadcasts an event to all of channels, numbering it and keeping it in each channel's history just as Broker does.
+func (m *Memory) PublishEvent(etype string, where string, data interface{}, channels []string) {
+	if err := Validate(etype, data); err != nil {
+		log.Println("Not publishing event:", err)
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, channel := range channels {
+		m.seqs[channel]++
+		JSONEvent := encode(etype, where, data, channel, m.seqs[channel])
+		history := append(m.history[channel], JSONEvent)
+		if len(history) > HistoryLength {
+			history = history[len(history)-HistoryLength:]
+		}
+		m.history[channel] = history
+		m.hub.deliver(channel, JSONEvent)
+	}
+}
+
+//EventSubscribe subscribes to the channels in subscriptions, and returns them as a combined MsgQueue.
+func (m *Memory) EventSubscribe(subscriptions []string) (events gp.MsgQueue) {
+	return m.hub.subscribe(subscriptions)
+}
+
+//EventsSince returns the events published to channel after since; see Broker.EventsSince.
+func (m *Memory) EventsSince(channel string, since int64) (messages [][]byte, latest int64, complete bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	latest = m.seqs[channel]
+	if since >= latest {
+		return nil, latest, since == latest, nil
+	}
+	history := m.history[channel]
+	//history holds the events numbered latest-len(history)+1 to latest.
+	first := latest - int64(len(history)) + 1
+	if since+1 < first {
+		messages = append(messages, history...)
+		return messages, latest, false, nil
+	}
+	messages = append(messages, history[since+1-first:]...)
+	return messages, latest, true, nil
+}
+
+//LatestSeqs returns the sequence number of the last event published to each of channels.
+func (m *Memory) LatestSeqs(channels []string) (latest map[string]int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	latest = make(map[string]int64)
+	for _, channel := range channels {
+		latest[channel] = m.seqs[channel]
+	}
+	return
+}
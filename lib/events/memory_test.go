@@ -0,0 +1,59 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	events := m.EventSubscribe([]string{"c:1"})
+	m.PublishEvent(Presence, "/user/2", gp.PresenceEvent{UserID: 2, Form: "mobile"}, []string{"c:1", "c:2"})
+	var got gp.WrappedEvent
+	err := json.Unmarshal(<-events.Messages, &got)
+	if err != nil {
+		t.Fatal("Error parsing event:", err)
+	}
+	if got.Data.Type != Presence || got.Data.Channel != "c:1" || got.Data.Seq != 1 {
+		t.Fatal("Unexpected event:", got.Data)
+	}
+	events.Commands <- gp.QueueCommand{Command: "UNSUBSCRIBE", Value: []string{}}
+	if _, ok := <-events.Messages; ok {
+		t.Fatal("Expected Messages to close")
+	}
+}
+
+func TestMemoryDropsInvalid(t *testing.T) {
+	m := NewMemory()
+	m.PublishEvent(Views, "/posts/1", 7, []string{"p:1"})
+	m.PublishEvent("nonsense", "/posts/1", nil, []string{"p:1"})
+	seqs, _ := m.LatestSeqs([]string{"p:1"})
+	if seqs["p:1"] != 0 {
+		t.Fatal("Invalid events shouldn't have been published, but p:1 is at", seqs["p:1"])
+	}
+}
+
+func TestMemoryHistory(t *testing.T) {
+	m := NewMemory()
+	for i := 0; i < HistoryLength+10; i++ {
+		m.PublishEvent(Views, "/posts/1", gp.PostViewCount{Post: 1, Count: i}, []string{"p:1"})
+	}
+	messages, latest, complete, err := m.EventsSince("p:1", HistoryLength)
+	if err != nil || latest != HistoryLength+10 || !complete || len(messages) != 10 {
+		t.Fatalf("Expected the last 10 events, got %d (latest %d, complete %v, %v)", len(messages), latest, complete, err)
+	}
+	_, _, complete, _ = m.EventsSince("p:1", 5)
+	if complete {
+		t.Fatal("The first events should have been forgotten")
+	}
+	_, _, complete, _ = m.EventsSince("p:1", latest+1)
+	if complete {
+		t.Fatal("Claiming to have seen events which were never sent should be incomplete")
+	}
+	seqs, _ := m.LatestSeqs([]string{"p:1", "p:2"})
+	if seqs["p:1"] != latest || seqs["p:2"] != 0 {
+		t.Fatal("Unexpected sequence numbers:", seqs)
+	}
+}
@@ -1,7 +1,7 @@
 package events
 
 import (
-	"encoding/json"
+	"fmt"
 	"log"
 
 	"github.com/Petergatsby/GleepostAPI/lib/conf"
@@ -9,9 +9,11 @@ import (
 	"github.com/garyburd/redigo/redis"
 )
 
-//Broker represents a redis cache configuration + pool of connections to operate against.
+//Broker is an EventBus backed by redis, so that events reach clients connected to any server.
+//It represents a redis cache configuration + pool of connections to operate against.
 type Broker struct {
 	pool   *redis.Pool
+	hub    *hub
 	config conf.RedisConfig
 }
 
@@ -20,6 +22,7 @@ func New(conf conf.RedisConfig) (cache *Broker) {
 	cache = new(Broker)
 	cache.config = conf
 	cache.pool = redis.NewPool(GetDialer(conf), 100)
+	cache.hub = newHub(GetDialer(conf))
 	return
 }
 
@@ -32,80 +35,107 @@ func GetDialer(conf conf.RedisConfig) func() (redis.Conn, error) {
 	return f
 }
 
+//HistoryLength is how many events are kept for each channel, for clients which reconnect to catch up on.
+const HistoryLength = 200
+
+//historyTTL is how long (in seconds) a channel's sequence number and history last after its last event.
+const historyTTL = 24 * 60 * 60
+
+func seqKey(channel string) string {
+	return fmt.Sprintf("events:%s:seq", channel)
+}
+
+func historyKey(channel string) string {
+	return fmt.Sprintf("events:%s:history", channel)
+}
+
 //PublishEvent broadcasts an event of type etype with location "where" and a payload of data encoded as JSON to all of channels.
+//Each channel numbers its events in order, and keeps the last HistoryLength of them so they can be replayed with EventsSince.
+//Events which don't match their registered schema are logged and dropped.
 func (b *Broker) PublishEvent(etype string, where string, data interface{}, channels []string) {
+	if err := Validate(etype, data); err != nil {
+		log.Println("Not publishing event:", err)
+		return
+	}
 	conn := b.pool.Get()
 	defer conn.Close()
 
-	event := gp.Event{Type: etype, Location: where, Data: data}
-	//Wrap the event in another layer to appease
-	message := gp.WrappedEvent{Event: "message", Data: event}
-	JSONEvent, _ := json.Marshal(message)
 	for _, channel := range channels {
+		seq, err := redis.Int64(conn.Do("INCR", seqKey(channel)))
+		if err != nil {
+			log.Println("Error numbering event:", err)
+			continue
+		}
+		JSONEvent := encode(etype, where, data, channel, seq)
+		conn.Send("ZADD", historyKey(channel), seq, JSONEvent)
+		conn.Send("ZREMRANGEBYRANK", historyKey(channel), 0, -(HistoryLength + 1))
+		conn.Send("EXPIRE", historyKey(channel), historyTTL)
+		conn.Send("EXPIRE", seqKey(channel), historyTTL)
 		conn.Send("PUBLISH", channel, JSONEvent)
 	}
 	conn.Flush()
 }
 
-//EventSubscribe subscribes to the channels in subscription, and returns them as a combined MsgQueue.
-func (b *Broker) EventSubscribe(subscriptions []string) (events gp.MsgQueue) {
-	commands := make(chan gp.QueueCommand)
-	messages := make(chan []byte)
-	events = gp.MsgQueue{Commands: commands, Messages: messages}
+//EventsSince returns the events published to channel after since, oldest first, along with the channel's latest sequence number.
+//If some of them have already dropped out of the history (or the channel's numbering has been reset), complete is false: the client can't catch up, and has to refetch everything instead.
+func (b *Broker) EventsSince(channel string, since int64) (messages [][]byte, latest int64, complete bool, err error) {
 	conn := b.pool.Get()
-	psc := redis.PubSubConn{Conn: conn}
-	for _, s := range subscriptions {
-		psc.Subscribe(s)
+	defer conn.Close()
+	latest, err = redis.Int64(conn.Do("GET", seqKey(channel)))
+	if err == redis.ErrNil {
+		latest, err = 0, nil
 	}
-	go controller(&psc, events.Commands)
-	go messageReceiver(&psc, events.Messages)
-	log.Println("New websocket connection created.")
-	return events
-}
-
-func messageReceiver(psc *redis.PubSubConn, messages chan<- []byte) {
-	for {
-		switch n := psc.Receive().(type) {
-		case redis.Message:
-			messages <- n.Data
-		case redis.Subscription:
-			if n.Count == 0 {
-				log.Println("Websocket client has unsubscribed from everything; closing connection.")
-				close(messages)
-				psc.Conn.Close()
-				return
-			}
-		case error:
-			log.Println("Saw an error: ", n)
-			close(messages)
-			psc.Conn.Close()
+	if err != nil {
+		return
+	}
+	if since >= latest {
+		return nil, latest, since == latest, nil
+	}
+	values, err := redis.Values(conn.Do("ZRANGEBYSCORE", historyKey(channel), fmt.Sprintf("(%d", since), "+inf", "WITHSCORES"))
+	if err != nil {
+		return
+	}
+	var first int64
+	for len(values) >= 2 {
+		var message []byte
+		var seq int64
+		values, err = redis.Scan(values, &message, &seq)
+		if err != nil {
 			return
 		}
+		if first == 0 {
+			first = seq
+		}
+		messages = append(messages, message)
 	}
+	return messages, latest, first == since+1, nil
 }
 
-func controller(psc *redis.PubSubConn, commands <-chan gp.QueueCommand) {
-	for {
-		command, ok := <-commands
-		if !ok {
-			return
-		}
-		switch {
-		case command.Command == "UNSUBSCRIBE":
-			channels := make([]interface{}, len(command.Value))
-			for i, v := range command.Value {
-				channels[i] = interface{}(v)
-			}
-			psc.Unsubscribe(channels...)
-			if len(channels) == 0 {
-				return
-			}
-		case command.Command == "SUBSCRIBE":
-			channels := make([]interface{}, len(command.Value))
-			for i, v := range command.Value {
-				channels[i] = interface{}(v)
-			}
-			psc.Subscribe(channels...)
-		}
+//LatestSeqs returns the sequence number of the last event published to each of channels (0 if there hasn't been one).
+func (b *Broker) LatestSeqs(channels []string) (latest map[string]int64, err error) {
+	latest = make(map[string]int64)
+	if len(channels) == 0 {
+		return
+	}
+	conn := b.pool.Get()
+	defer conn.Close()
+	keys := make([]interface{}, len(channels))
+	for i, channel := range channels {
+		keys[i] = seqKey(channel)
 	}
+	values, err := redis.Values(conn.Do("MGET", keys...))
+	if err != nil {
+		return
+	}
+	for i, channel := range channels {
+		seq, _ := redis.Int64(values[i], nil)
+		latest[channel] = seq
+	}
+	return
+}
+
+//EventSubscribe subscribes to the channels in subscription, and returns them as a combined MsgQueue.
+//Every subscriber shares the Broker's one subscribing connection to redis.
+func (b *Broker) EventSubscribe(subscriptions []string) (events gp.MsgQueue) {
+	return b.hub.subscribe(subscriptions)
 }
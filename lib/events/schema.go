@@ -0,0 +1,220 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+//The types of event published to clients.
+const (
+	Post                = "post"
+	Comment             = "comment"
+	Vote                = "vote"
+	Views               = "views"
+	Presence            = "presence"
+	Typing              = "typing"
+	Read                = "read"
+	NewConversation     = "new-conversation"
+	EndedConversation   = "ended-conversation"
+	ChangedConversation = "changed-conversation"
+	Message             = "message"
+	MessageEdited       = "message_edited"
+	MessageDeleted      = "message_deleted"
+	Notification        = "notification"
+	VideoReady          = "video-ready"
+	Resync              = "resync"
+	Badge               = "badge"
+)
+
+//Schema describes one type of event. Payload is an example of its data (the zero value will do); its Version goes up whenever the payload changes in a way old clients wouldn't understand.
+type Schema struct {
+	Type        string
+	Version     int
+	Description string
+	Payload     interface{}
+}
+
+var (
+	schemaLock sync.RWMutex
+	schemas    = make(map[string]Schema)
+)
+
+//Register adds an event type to the schema. Like database/sql.Register, it panics if the type is registered twice.
+func Register(s Schema) {
+	schemaLock.Lock()
+	defer schemaLock.Unlock()
+	if _, dup := schemas[s.Type]; dup {
+		panic("events: Register called twice for " + s.Type)
+	}
+	schemas[s.Type] = s
+}
+
+//Lookup returns the schema for an event type.
+func Lookup(etype string) (s Schema, ok bool) {
+	schemaLock.RLock()
+	defer schemaLock.RUnlock()
+	s, ok = schemas[etype]
+	return
+}
+
+//Validate checks that etype is registered, and that data is the payload it was registered with (or a pointer to one). Types registered without a payload carry no data.
+func Validate(etype string, data interface{}) error {
+	s, ok := Lookup(etype)
+	if !ok {
+		return fmt.Errorf("unregistered event type %q", etype)
+	}
+	if s.Payload == nil {
+		if data != nil {
+			return fmt.Errorf("%s events carry no data, got a %T", etype, data)
+		}
+		return nil
+	}
+	want := reflect.TypeOf(s.Payload)
+	got := reflect.TypeOf(data)
+	if got != nil && got.Kind() == reflect.Ptr && !reflect.ValueOf(data).IsNil() {
+		got = got.Elem()
+	}
+	if got != want {
+		return fmt.Errorf("%s events carry a %v, got a %T", etype, want, data)
+	}
+	return nil
+}
+
+//ResyncMessage builds the resync event for channel, which tells a client that it's missed everything up to seq and has to refetch instead.
+func ResyncMessage(channel string, seq int64) []byte {
+	return encode(Resync, "", nil, channel, seq)
+}
+
+//encode builds the message published for one event on one channel, as sent to websocket clients using the wrapped protocol.
+func encode(etype string, where string, data interface{}, channel string, seq int64) []byte {
+	s, _ := Lookup(etype)
+	event := gp.Event{Type: etype, Version: s.Version, Location: where, Data: data, Channel: channel, Seq: seq}
+	//Wrap the event in another layer to appease
+	message, _ := json.Marshal(gp.WrappedEvent{Event: "message", Data: event})
+	return message
+}
+
+//Document is a machine-readable description of every registered event type.
+type Document struct {
+	Events []EventSchema `json:"events"`
+}
+
+//EventSchema describes one event type, and the shape of its data.
+type EventSchema struct {
+	Type        string      `json:"type"`
+	Version     int         `json:"version"`
+	Description string      `json:"description"`
+	Data        *TypeSchema `json:"data,omitempty"`
+}
+
+//TypeSchema is a (JSON Schema flavoured) description of a JSON value.
+type TypeSchema struct {
+	Type       string                 `json:"type,omitempty"`
+	Format     string                 `json:"format,omitempty"`
+	Properties map[string]*TypeSchema `json:"properties,omitempty"`
+	Items      *TypeSchema            `json:"items,omitempty"`
+}
+
+//Describe generates a Document from the registered event types.
+func Describe() (doc Document) {
+	schemaLock.RLock()
+	defer schemaLock.RUnlock()
+	doc.Events = make([]EventSchema, 0, len(schemas))
+	for _, s := range schemas {
+		e := EventSchema{Type: s.Type, Version: s.Version, Description: s.Description}
+		if s.Payload != nil {
+			e.Data = describeType(reflect.TypeOf(s.Payload), make(map[reflect.Type]bool))
+		}
+		doc.Events = append(doc.Events, e)
+	}
+	sort.Sort(byType(doc.Events))
+	return
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+//describeType follows what encoding/json would do with t. Types which marshal themselves, or which contain themselves, are left undescribed.
+func describeType(t reflect.Type, seen map[reflect.Type]bool) *TypeSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &TypeSchema{Type: "string", Format: "date-time"}
+	case t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType):
+		return &TypeSchema{}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &TypeSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &TypeSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &TypeSchema{Type: "number"}
+	case reflect.String:
+		return &TypeSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &TypeSchema{Type: "string", Format: "base64"}
+		}
+		return &TypeSchema{Type: "array", Items: describeType(t.Elem(), seen)}
+	case reflect.Map:
+		return &TypeSchema{Type: "object"}
+	case reflect.Struct:
+		if seen[t] {
+			return &TypeSchema{Type: "object"}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		s := &TypeSchema{Type: "object", Properties: make(map[string]*TypeSchema)}
+		describeFields(t, s, seen)
+		return s
+	}
+	return &TypeSchema{}
+}
+
+func describeFields(t reflect.Type, s *TypeSchema, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			describeFields(ft, s, seen)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if strings.Contains(tag, ",string") {
+			s.Properties[name] = &TypeSchema{Type: "string"}
+			continue
+		}
+		s.Properties[name] = describeType(f.Type, seen)
+	}
+}
+
+type byType []EventSchema
+
+func (e byType) Len() int           { return len(e) }
+func (e byType) Less(i, j int) bool { return e[i].Type < e[j].Type }
+func (e byType) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
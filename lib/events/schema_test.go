@@ -0,0 +1,88 @@
+package events
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+type testPayload struct {
+	ID      int       `json:"id"`
+	At      time.Time `json:"at"`
+	Tags    []string  `json:"tags,omitempty"`
+	Secret  string    `json:"-"`
+	Next    *testPayload
+	private int
+}
+
+func TestDescribe(t *testing.T) {
+	Register(Schema{Type: "test", Version: 3, Description: "A test.", Payload: testPayload{}})
+	defer func() {
+		schemaLock.Lock()
+		delete(schemas, "test")
+		schemaLock.Unlock()
+	}()
+	var found *EventSchema
+	doc := Describe()
+	for i, e := range doc.Events {
+		if e.Type == "test" {
+			found = &doc.Events[i]
+		}
+	}
+	if found == nil || found.Version != 3 {
+		t.Fatalf("Expected the test event in %v", doc.Events)
+	}
+	props := found.Data.Properties
+	switch {
+	case props["id"].Type != "integer":
+		t.Fatal("Expected id to be an integer, got", props["id"])
+	case props["at"].Format != "date-time":
+		t.Fatal("Expected at to be a date-time, got", props["at"])
+	case props["tags"].Items.Type != "string":
+		t.Fatal("Expected tags to be an array of strings, got", props["tags"])
+	case props["Secret"] != nil || props["-"] != nil || props["private"] != nil:
+		t.Fatal("Expected hidden fields to be left out, got", props)
+	case props["Next"].Type != "object" || props["Next"].Properties != nil:
+		t.Fatal("Expected a recursive type not to be followed, got", props["Next"])
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		etype string
+		data  interface{}
+		valid bool
+	}{
+		{Message, gp.Message{}, true},
+		{Message, &gp.Message{}, true},
+		{Message, (*gp.Message)(nil), false},
+		{Message, gp.Conversation{}, false},
+		{Message, nil, false},
+		{Resync, nil, true},
+		{Resync, gp.Message{}, false},
+		{"nonsense", nil, false},
+	}
+	for _, test := range tests {
+		err := Validate(test.etype, test.data)
+		if (err == nil) != test.valid {
+			t.Errorf("Validate(%s, %T): expected valid to be %v, got %v", test.etype, test.data, test.valid, err)
+		}
+	}
+}
+
+func TestBuiltinsRegistered(t *testing.T) {
+	for _, etype := range []string{Post, Comment, Vote, Views, Presence, Typing, Read, NewConversation, EndedConversation, ChangedConversation, Message, MessageEdited, MessageDeleted, Notification, VideoReady, Resync, Badge} {
+		if _, ok := Lookup(etype); !ok {
+			t.Error("Not registered:", etype)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	message := string(ResyncMessage("c:1", 7))
+	if !strings.HasPrefix(message, `{"event":"message","data":{"type":"resync","version":1,`) {
+		t.Fatal("Unexpected message:", message)
+	}
+}
@@ -0,0 +1,24 @@
+package events
+
+import "github.com/Petergatsby/GleepostAPI/lib/gp"
+
+//These are the payloads each type of event carries. Bump an event's Version whenever its payload changes in a way existing clients won't cope with.
+func init() {
+	Register(Schema{Type: Resync, Version: 1, Description: "Events on this channel were missed and can't be replayed; refetch whatever it covers."})
+	Register(Schema{Type: Post, Version: 1, Description: "A post appeared in a network you're subscribed to.", Payload: gp.Post{}})
+	Register(Schema{Type: Comment, Version: 1, Description: "Someone commented on a post you're subscribed to.", Payload: gp.Comment{}})
+	Register(Schema{Type: Vote, Version: 1, Description: "Someone voted in a poll you're subscribed to; carries the new tally.", Payload: gp.Poll{}})
+	Register(Schema{Type: Views, Version: 1, Description: "A post you're subscribed to has been viewed.", Payload: gp.PostViewCount{}})
+	Register(Schema{Type: Presence, Version: 1, Description: "Someone you have a conversation with is online.", Payload: gp.PresenceEvent{}})
+	Register(Schema{Type: Typing, Version: 1, Description: "Someone started or stopped typing in one of your conversations.", Payload: gp.TypingEvent{}})
+	Register(Schema{Type: Read, Version: 1, Description: "Someone read a conversation you're in.", Payload: gp.Read{}})
+	Register(Schema{Type: NewConversation, Version: 1, Description: "You've been added to a conversation.", Payload: gp.Conversation{}})
+	Register(Schema{Type: EndedConversation, Version: 1, Description: "A conversation you're in has ended.", Payload: gp.ConversationAndMessages{}})
+	Register(Schema{Type: ChangedConversation, Version: 1, Description: "A conversation you're in has changed, eg. it no longer expires.", Payload: gp.Conversation{}})
+	Register(Schema{Type: Message, Version: 1, Description: "A new message in one of your conversations.", Payload: gp.Message{}})
+	Register(Schema{Type: MessageEdited, Version: 1, Description: "A message in one of your conversations was edited; carries the message as it is now.", Payload: gp.Message{}})
+	Register(Schema{Type: MessageDeleted, Version: 1, Description: "A message in one of your conversations was deleted; carries its tombstone.", Payload: gp.Message{}})
+	Register(Schema{Type: Badge, Version: 1, Description: "Your unread notification, message or group post counts changed.", Payload: gp.BadgeCounts{}})
+	Register(Schema{Type: Notification, Version: 2, Description: "You have a new notification, or an aggregated one has gathered more people (it has a new id, and replaces the old one).", Payload: gp.Notification{}})
+	Register(Schema{Type: VideoReady, Version: 1, Description: "A video you uploaded has finished processing.", Payload: gp.UploadStatus{}})
+}
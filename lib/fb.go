@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -104,28 +105,29 @@ func (api *API) fBValidateToken(fbToken string, retries int) (token FacebookToke
 //FacebookLogin takes a facebook access token supplied by a user and tries to issue a gleepost session token,
 // or an error if there isn't an associated gleepost user for this facebook account.
 //As long as err != BadToken, the user's fbid is returned.
-func (api *API) FacebookLogin(fbToken, email, invite string) (token gp.Token, FBUser uint64, status gp.Status, err error) {
+//Any session token issued is labelled with device.
+func (api *API) FacebookLogin(ctx context.Context, fbToken, email, invite, device string) (token gp.Token, FBUser uint64, status gp.Status, err error) {
 	t, err := api.fBValidateToken(fbToken, 2)
 	if err != nil {
 		err = BadFBToken
 		return
 	}
 	FBUser = t.FBUser
-	userID, err := api.fBGetGPUser(t.FBUser)
+	userID, err := api.fBGetGPUser(ctx, t.FBUser)
 	switch {
 	case err == nil:
 		err = api.updateFBData(fbToken)
 		if err != nil {
 			log.Println("Error pulling in profile changes from facebook:", err)
 		}
-		token, err = api.Auth.createAndStoreToken(userID)
+		token, err = api.Auth.createAndStoreToken(ctx, userID, device, gp.AllScopes)
 		return
 	case err == NoSuchUser: //No gleepost user already associated with this fb user.
 		//If we have an error here, that means that there is no associated gleepost user account.
 		log.Println("Error logging in with facebook, probably means there's no associated gleepost account:", err)
 		//Did the user provide an email (takes precedence over stored email, because they might have typo'd the first time)
 		var storedEmail string
-		storedEmail, err = api.fBGetEmail(FBUser)
+		storedEmail, err = api.fBGetEmail(ctx, FBUser)
 		switch {
 		//Has this email been seen before for this user?
 		case len(email) > 3 && (err != nil || storedEmail != email):
@@ -133,7 +135,7 @@ func (api *API) FacebookLogin(fbToken, email, invite string) (token gp.Token, FB
 			//(So we should check if there's an existing signed up / verified user)
 			//(and if not, issue a verification email)
 			//(since this is the first time they've signed up with this email)
-			token, status, err = api.fBFirstTimeWithEmail(email, fbToken, invite, FBUser)
+			token, status, err = api.fBFirstTimeWithEmail(ctx, email, fbToken, invite, FBUser, device)
 			return
 		case len(email) > 3 && (err == nil && (storedEmail == email)):
 			//We already saw this user, so we don't need to re-send verification
@@ -141,7 +143,7 @@ func (api *API) FacebookLogin(fbToken, email, invite string) (token gp.Token, FB
 		case len(email) < 3 && (err == nil):
 			//We already saw this user, so we don't need to re-send verification
 			//So it should be "unverified" or "registered" as appropriate
-			_, err = api.userWithEmail(storedEmail)
+			_, err = api.userWithEmail(ctx, storedEmail)
 			if err != nil {
 				log.Println("Should be unverified response")
 				status = gp.NewStatus("unverified", storedEmail)
@@ -166,8 +168,8 @@ func (api *API) updateFBData(fbToken string) (err error) {
 
 //FBGetGPUser returns the associated gleepost user for a given facebook id, or sql.ErrNoRows if that user doesn't exist.
 //TODO: Change to ENOSUCHUSER
-func (api *API) fBGetGPUser(fbid uint64) (id gp.UserID, err error) {
-	id, err = api.userIDFromFB(fbid)
+func (api *API) fBGetGPUser(ctx context.Context, fbid uint64) (id gp.UserID, err error) {
+	id, err = api.userIDFromFB(ctx, fbid)
 	return
 }
 
@@ -177,43 +179,43 @@ func (api *API) fBGetGPUser(fbid uint64) (id gp.UserID, err error) {
 //If the invite is invalid or nonexistent, it issues a verification email
 //(the rest of the association will be handled upon verification in FBVerify.
 //It will either return a token (meaning that the user has logged in successfully) or a verification status (meaning the user should verify their email).
-func (api *API) FacebookRegister(fbToken string, email string, invite string) (token gp.Token, verification gp.Status, err error) {
+func (api *API) FacebookRegister(ctx context.Context, fbToken string, email string, invite string, device string) (token gp.Token, verification gp.Status, err error) {
 	t, err := api.fBValidateToken(fbToken, 3)
 	if err != nil {
 		return
 	}
-	err = api.createFBUser(t.FBUser, email, fbToken)
-	exists, _ := api.inviteExists(email, invite)
+	err = api.createFBUser(ctx, t.FBUser, email, fbToken)
+	exists, _ := api.inviteExists(ctx, email, invite)
 	if exists {
-		id, e := api.fBSetVerified(email, t.FBUser)
+		id, e := api.fBSetVerified(ctx, email, t.FBUser)
 		if e != nil {
 			err = e
 			return
 		}
-		token, err = api.Auth.createAndStoreToken(id)
+		token, err = api.Auth.createAndStoreToken(ctx, id, device, gp.AllScopes)
 		return
 	}
 	if err == nil {
-		err = api.FBissueVerification(t.FBUser)
+		err = api.FBissueVerification(ctx, t.FBUser)
 	}
 	verification = gp.NewStatus("unverified", email)
 	return
 }
 
 //FBSetVerified creates a gleepost user for this fbuser, or associates with an existing one as appropriate.
-func (api *API) fBSetVerified(email string, fbuser uint64) (id gp.UserID, err error) {
-	id, err = api.userWithEmail(email)
+func (api *API) fBSetVerified(ctx context.Context, email string, fbuser uint64) (id gp.UserID, err error) {
+	id, err = api.userWithEmail(ctx, email)
 	if err != nil {
 		log.Println("There isn't a user with this facebook email")
-		id, err = api.createUserFromFB(fbuser, email)
+		id, err = api.createUserFromFB(ctx, fbuser, email)
 		return
 	}
-	err = api.userSetFB(id, fbuser)
+	err = api.userSetFB(ctx, id, fbuser)
 	if err == nil {
-		err = api.verify(id)
+		err = api.verify(ctx, id)
 		if err == nil {
 			log.Println("Verifying worked. Now setting networks from invites...")
-			err = api.acceptAllInvites(id, email)
+			err = api.acceptAllInvites(ctx, id, email)
 		}
 	}
 	return
@@ -221,8 +223,8 @@ func (api *API) fBSetVerified(email string, fbuser uint64) (id gp.UserID, err er
 
 //FBissueVerification creates and sends a verification email for this facebook user, or returns an error if we haven't seen them before (ie, we don't have their email address on file)
 //TODO: Think about decoupling this from the email check
-func (api *API) FBissueVerification(fbid uint64) (err error) {
-	email, err := api.fBGetEmail(fbid)
+func (api *API) FBissueVerification(ctx context.Context, fbid uint64) (err error) {
+	email, err := api.fBGetEmail(ctx, fbid)
 	if err != nil {
 		return
 	}
@@ -230,11 +232,11 @@ func (api *API) FBissueVerification(fbid uint64) (err error) {
 	if err != nil {
 		return
 	}
-	err = api.createFBVerification(fbid, random)
+	err = api.createFBVerification(ctx, fbid, random)
 	if err != nil {
 		return
 	}
-	fbtoken, err := api.fbToken(fbid)
+	fbtoken, err := api.fbToken(ctx, fbid)
 	if err != nil {
 		return
 	}
@@ -246,13 +248,13 @@ func (api *API) FBissueVerification(fbid uint64) (err error) {
 	return
 }
 
-func (api *API) fbToken(fbid uint64) (fbtoken string, err error) {
+func (api *API) fbToken(ctx context.Context, fbid uint64) (fbtoken string, err error) {
 	s, err := api.sc.Prepare("SELECT fb_token FROM facebook WHERE fb_id = ?")
 	if err != nil {
 		return
 	}
 	var token sql.NullString
-	err = s.QueryRow(fbid).Scan(&token)
+	err = s.QueryRowContext(ctx, fbid).Scan(&token)
 	if token.Valid {
 		fbtoken = token.String
 	} else {
@@ -287,23 +289,23 @@ func fBAvatar(username string) (avatar string) {
 }
 
 //FBGetEmail returns the email address we have on file for this facebook id, or an error if we don't have one.
-func (api *API) fBGetEmail(fbid uint64) (email string, err error) {
+func (api *API) fBGetEmail(ctx context.Context, fbid uint64) (email string, err error) {
 	s, err := api.sc.Prepare("SELECT email FROM facebook WHERE fb_id = ?")
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(fbid).Scan(&email)
+	err = s.QueryRowContext(ctx, fbid).Scan(&email)
 	return
 }
 
 //UserSetFB sets the associated facebook account for the gleepost user userID.
-func (api *API) userSetFB(userID gp.UserID, fbid uint64) (err error) {
+func (api *API) userSetFB(ctx context.Context, userID gp.UserID, fbid uint64) (err error) {
 	fbSetGPUser := "REPLACE INTO facebook (user_id, fb_id) VALUES (?, ?)"
 	stmt, err := api.sc.Prepare(fbSetGPUser)
 	if err != nil {
 		return
 	}
-	res, err := stmt.Exec(userID, fbid)
+	res, err := stmt.ExecContext(ctx, userID, fbid)
 	log.Println(res.RowsAffected())
 	return
 }
@@ -314,9 +316,9 @@ func (api *API) fBUserWithEmail(email string) (fbid uint64, err error) {
 }
 
 //UserAddFBUsersToGroup takes a list of facebook users and records that they've been invited to the group netID by userID
-func (api *API) UserAddFBUsersToGroup(userID gp.UserID, fbusers []uint64, netID gp.NetworkID) (count int, err error) {
+func (api *API) UserAddFBUsersToGroup(ctx context.Context, userID gp.UserID, fbusers []uint64, netID gp.NetworkID) (count int, err error) {
 	for _, u := range fbusers {
-		err = api.userAddFBUserToGroup(userID, u, netID)
+		err = api.userAddFBUserToGroup(ctx, userID, u, netID)
 		if err == nil {
 			count++
 		} else {
@@ -327,8 +329,8 @@ func (api *API) UserAddFBUsersToGroup(userID gp.UserID, fbusers []uint64, netID
 }
 
 //CreateUserFromFB takes a facebook id and an email address and creates a gleepost user, returning their newly created id.
-func (api *API) createUserFromFB(fbid uint64, email string) (userID gp.UserID, err error) {
-	fbtoken, err := api.fbToken(fbid)
+func (api *API) createUserFromFB(ctx context.Context, fbid uint64, email string) (userID gp.UserID, err error) {
+	fbtoken, err := api.fbToken(ctx, fbid)
 	if err != nil {
 		log.Println("Couldn't get stored facebook token", err)
 		return
@@ -342,40 +344,40 @@ func (api *API) createUserFromFB(fbid uint64, email string) (userID gp.UserID, e
 	if err != nil {
 		return
 	}
-	userID, err = api.createUser(firstName, lastName, random, email)
+	userID, err = api.createUser(ctx, firstName, lastName, random, email)
 	if err != nil {
 		log.Println("Something went wrong while creating the user from facebook:", err)
 		return
 	}
-	_, err = api.assignNetworks(userID, email)
+	_, err = api.assignNetworks(ctx, userID, email)
 	if err != nil {
 		return
 	}
-	err = api.setProfileImage(userID, fBAvatar(username))
+	err = api.setProfileImage(ctx, userID, fBAvatar(username))
 	if err != nil {
 		log.Println("Problem setting avatar:", err)
 	}
-	err = api.verify(userID)
+	err = api.verify(ctx, userID)
 	if err != nil {
 		log.Println("Verifying failed in the db:", err)
 		return
 	}
-	err = api.userSetFB(userID, fbid)
+	err = api.userSetFB(ctx, userID, fbid)
 	if err != nil {
 		log.Println("associating facebook account with user account failed:", err)
 		return
 	}
-	err = api.acceptAllInvites(userID, email)
+	err = api.acceptAllInvites(ctx, userID, email)
 	if err != nil {
 		log.Println("Something went wrong while accepting invites:", err)
 		return
 	}
-	err = api.assignNetworksFromFBInvites(userID, fbid)
+	err = api.assignNetworksFromFBInvites(ctx, userID, fbid)
 	if err != nil {
 		log.Println("Something went wrong while setting networks from fb invites:", err)
 		return
 	}
-	err = api.acceptAllFBInvites(fbid)
+	err = api.acceptAllFBInvites(ctx, fbid)
 	return
 
 }
@@ -384,17 +386,17 @@ func (api *API) createUserFromFB(fbid uint64, email string) (userID gp.UserID, e
 //This will implicitly verify an account (because they have to have access to that email) and issue a session token if the invite is valid.
 //If the invite is not valid, returns status - registered.
 //(why?? I can't remember.)
-func (api *API) AttemptLoginWithInvite(email, invite string, FBUser uint64) (token gp.Token, status gp.Status, err error) {
-	exists, _ := api.inviteExists(email, invite)
+func (api *API) AttemptLoginWithInvite(ctx context.Context, email, invite string, FBUser uint64, device string) (token gp.Token, status gp.Status, err error) {
+	exists, _ := api.inviteExists(ctx, email, invite)
 	if exists {
 		//Verify
-		id, e := api.fBSetVerified(email, FBUser)
+		id, e := api.fBSetVerified(ctx, email, FBUser)
 		if e != nil {
 			err = e
 			return
 		}
 		//Login
-		token, err = api.Auth.createAndStoreToken(id)
+		token, err = api.Auth.createAndStoreToken(ctx, id, device, gp.AllScopes)
 		if err != nil {
 			return
 		}
@@ -405,44 +407,38 @@ func (api *API) AttemptLoginWithInvite(email, invite string, FBUser uint64) (tok
 }
 
 //AttemptAssociationWithCredentials tries to connect a particular facebook account to a particular user account.
-func (api *API) AttemptAssociationWithCredentials(email, pass, fbToken string) (err error) {
-	id, err := api.Auth.validatePass(email, pass)
+func (api *API) AttemptAssociationWithCredentials(ctx context.Context, email, pass, fbToken string) (err error) {
+	id, err := api.Auth.validatePass(ctx, email, pass)
 	if err != nil {
 		log.Println(err)
 		err = BadLogin
 		return
 	}
-	err = api.AssociateFB(id, fbToken)
+	err = api.AssociateFB(ctx, id, fbToken)
 	return
 }
 
 //AssociateFB tries to connect the facebook account encoded in this facebook token to this gleepost account.
 //It will return BadFBToken if the token doesn't validate; and AlreadyAssociated if this facebook account is already associated with a different gleepost account.
-func (api *API) AssociateFB(id gp.UserID, fbToken string) (err error) {
-	//Ignore status for now - TODO(patrick): what does this imply
-	token, fbuser, _, err := api.FacebookLogin(fbToken, "", "")
+func (api *API) AssociateFB(ctx context.Context, id gp.UserID, fbToken string) (err error) {
+	err = api.LinkIdentity(ctx, id, "facebook", Credential{Token: fbToken})
 	switch {
-	case err == BadFBToken:
-		return
-	case err != nil:
-		//This isn't associated with a gleepost account
-		err = api.userSetFB(id, fbuser)
-		return
-	case token.UserID == id:
-		//The facebook account is already associated with this gleepost account
-		return nil
-	default:
+	case err == BadCredential:
+		return BadFBToken
+	case err == IdentityAlreadyLinked:
 		return AlreadyAssociated
+	default:
+		return
 	}
 }
 
 //FBFirstTimeWithEmail will create a fresh association with this fb:email pair. If there is no existing gleepost user signed up with this email, it will record this fb user and issue a verification email.
 //If there's already a gleepost user, it will associate the two accounts if the invite is valid (proving that this fb user has access to that email; otherwise it will return status:registered.
-func (api *API) fBFirstTimeWithEmail(email, fbToken, invite string, fbUser uint64) (token gp.Token, verification gp.Status, err error) {
-	_, err = api.userWithEmail(email)
+func (api *API) fBFirstTimeWithEmail(ctx context.Context, email, fbToken, invite string, fbUser uint64, device string) (token gp.Token, verification gp.Status, err error) {
+	_, err = api.userWithEmail(ctx, email)
 	if err != nil {
 		//There isn't already a user with this email address.
-		validates, e := api.validateEmail(email)
+		validates, e := api.validateEmail(ctx, email)
 		if !validates {
 			err = InvalidEmail
 			return
@@ -451,32 +447,32 @@ func (api *API) fBFirstTimeWithEmail(email, fbToken, invite string, fbUser uint6
 			err = e
 			return
 		}
-		token, verification, err = api.FacebookRegister(fbToken, email, invite)
+		token, verification, err = api.FacebookRegister(ctx, fbToken, email, invite, device)
 		return
 	}
 	//User has signed up already with a username+pass
 	//If invite is valid, we can log in immediately
-	token, verification, err = api.AttemptLoginWithInvite(email, invite, fbUser)
+	token, verification, err = api.AttemptLoginWithInvite(ctx, email, invite, fbUser, device)
 	return
 }
 
 //CreateFBUser records the existence of this (fbid:email) pair; when the user is verified it will be converted to a full gleepost user.
-func (api *API) createFBUser(fbID uint64, email string, fbtoken string) (err error) {
+func (api *API) createFBUser(ctx context.Context, fbID uint64, email string, fbtoken string) (err error) {
 	s, err := api.sc.Prepare("INSERT INTO facebook (fb_id, email, fb_token) VALUES (?, ?, ?)")
 	if err != nil {
 		return
 	}
-	_, err = s.Exec(fbID, email, fbtoken)
+	_, err = s.ExecContext(ctx, fbID, email, fbtoken)
 	return
 }
 
 //FBUserWithEmail returns the facebook id we've seen associated with this email, or error if none exists.
-func (api *API) FBUserWithEmail(email string) (fbid uint64, err error) {
+func (api *API) FBUserWithEmail(ctx context.Context, email string) (fbid uint64, err error) {
 	s, err := api.sc.Prepare("SELECT fb_id FROM facebook WHERE email = ?")
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(email).Scan(&fbid)
+	err = s.QueryRowContext(ctx, email).Scan(&fbid)
 	if err == sql.ErrNoRows {
 		err = NoSuchUser
 	}
@@ -484,12 +480,12 @@ func (api *API) FBUserWithEmail(email string) (fbid uint64, err error) {
 }
 
 //CreateFBVerification records a (hopefully random!) verification token for this facebook user.
-func (api *API) createFBVerification(fbid uint64, token string) (err error) {
+func (api *API) createFBVerification(ctx context.Context, fbid uint64, token string) (err error) {
 	s, err := api.sc.Prepare("REPLACE INTO facebook_verification (fb_id, token) VALUES (?, ?)")
 	if err != nil {
 		return
 	}
-	_, err = s.Exec(fbid, token)
+	_, err = s.ExecContext(ctx, fbid, token)
 	return
 }
 
@@ -497,26 +493,93 @@ func (api *API) createFBVerification(fbid uint64, token string) (err error) {
 var NoSuchVerificationToken = gp.APIerror{Reason: "No such verification token"}
 
 //FBVerificationExists returns the user this verification token is for, or an error if there is none.
-func (api *API) fBVerificationExists(token string) (fbid uint64, err error) {
+func (api *API) fBVerificationExists(ctx context.Context, token string) (fbid uint64, err error) {
 	s, err := api.sc.Prepare("SELECT fb_id FROM facebook_verification WHERE token = ?")
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(token).Scan(&fbid)
+	err = s.QueryRowContext(ctx, token).Scan(&fbid)
 	if err == sql.ErrNoRows {
 		err = NoSuchVerificationToken
 	}
 	return
 }
 
-func (api *API) fbUser(userID gp.UserID) (fbid uint64, err error) {
+func (api *API) fbUser(ctx context.Context, userID gp.UserID) (fbid uint64, err error) {
 	s, err := api.sc.Prepare("SELECT fb_id FROM facebook WHERE user_id = ? AND fb_id != 0")
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(userID).Scan(&fbid)
+	err = s.QueryRowContext(ctx, userID).Scan(&fbid)
 	if err == sql.ErrNoRows {
 		err = NoSuchUser
 	}
 	return
 }
+
+//facebookProvider is facebook as an IdentityProvider. Facebook logins still go through FacebookLogin, which handles its email verification dance;
+//this lets facebook accounts be linked and unlinked like any other provider's.
+type facebookProvider struct {
+	api *API
+}
+
+func (p *facebookProvider) Name() string {
+	return "facebook"
+}
+
+func (p *facebookProvider) Network() gp.NetworkID {
+	return 0
+}
+
+func (p *facebookProvider) Info() gp.LoginProvider {
+	return gp.LoginProvider{Name: "facebook", DisplayName: "Facebook", Type: "facebook", ClientID: p.api.fb.config.AppID}
+}
+
+//Authenticate validates a facebook access token. Facebook doesn't tell us the user's email, so it's never verified.
+func (p *facebookProvider) Authenticate(ctx context.Context, c Credential) (id Identity, err error) {
+	t, err := p.api.fBValidateToken(c.Token, 2)
+	if err != nil {
+		return id, BadCredential
+	}
+	id.Subject = strconv.FormatUint(t.FBUser, 10)
+	id.Email, _ = p.api.fBGetEmail(ctx, t.FBUser)
+	first, last, username, e := fBName(t.FBUser, c.Token)
+	if e == nil {
+		id.FirstName, id.LastName = first, last
+		if len(username) > 0 {
+			id.Avatar = fBAvatar(username)
+		}
+	}
+	return id, nil
+}
+
+func (p *facebookProvider) linkedUser(ctx context.Context, subject string) (userID gp.UserID, err error) {
+	fbid, err := strconv.ParseUint(subject, 10, 64)
+	if err != nil {
+		return 0, NoSuchUser
+	}
+	return p.api.userIDFromFB(ctx, fbid)
+}
+
+func (p *facebookProvider) link(ctx context.Context, userID gp.UserID, id Identity) (err error) {
+	fbid, err := strconv.ParseUint(id.Subject, 10, 64)
+	if err != nil {
+		return
+	}
+	return p.api.userSetFB(ctx, userID, fbid)
+}
+
+func (p *facebookProvider) unlink(ctx context.Context, userID gp.UserID) (err error) {
+	s, err := p.api.sc.Prepare("UPDATE facebook SET user_id = NULL WHERE user_id = ?")
+	if err != nil {
+		return
+	}
+	res, err := s.ExecContext(ctx, userID)
+	if err != nil {
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return NotLinked
+	}
+	return nil
+}
@@ -1,8 +1,25 @@
 package lib
 
 import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/conf"
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/password"
+	"golang.org/x/crypto/bcrypt"
 )
 
 const (
@@ -10,7 +27,7 @@ const (
 )
 
 func TestCreateToken(t *testing.T) {
-	token := createToken(9)
+	token := createToken(9, time.Hour)
 	if token.UserID != 9 {
 		t.Fail()
 	}
@@ -24,7 +41,7 @@ func TestCreateToken(t *testing.T) {
 
 func BenchmarkCreateToken(b *testing.B) {
 	for i := 0; i < b.N; i++ {
-		token := createToken(9)
+		token := createToken(9, time.Hour)
 		if token.UserID != 9 {
 			b.Fail()
 		}
@@ -37,6 +54,336 @@ func BenchmarkCreateToken(b *testing.B) {
 	}
 }
 
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes("")
+	if err != nil || len(scopes) != len(gp.AllScopes) {
+		t.Fatalf("Expected every scope, got %v (%v)", scopes, err)
+	}
+	scopes, err = ParseScopes("read, read,write")
+	if err != nil || len(scopes) != 2 {
+		t.Fatalf("Expected [read write], got %v (%v)", scopes, err)
+	}
+	_, err = ParseScopes("read,root")
+	if err != BadScope {
+		t.Fatalf("Expected BadScope, got %v", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	max := 15 * time.Minute
+	tests := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{8, 16 * time.Second},
+		{20, max},
+		{200, max},
+	}
+	for _, test := range tests {
+		if wait := backoff(test.failures, 3, max); wait != test.expected {
+			t.Fatalf("%d failures: expected %v, got %v", test.failures, test.expected, wait)
+		}
+	}
+}
+
+func TestPushBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{100, time.Hour},
+	}
+	for _, test := range tests {
+		if wait := pushBackoff(test.attempts); wait != test.expected {
+			t.Fatalf("%d attempts: expected %v, got %v", test.attempts, test.expected, wait)
+		}
+	}
+}
+
+func TestQuietHours(t *testing.T) {
+	at := func(clock string) time.Time {
+		parsed, _ := time.Parse("15:04", clock)
+		return parsed
+	}
+	tests := []struct {
+		start, end string
+		now        string
+		quiet      bool
+	}{
+		{"22:00", "07:00", "23:30", true},
+		{"22:00", "07:00", "03:00", true},
+		{"22:00", "07:00", "07:00", false},
+		{"22:00", "07:00", "12:00", false},
+		{"13:00", "14:00", "13:59", true},
+		{"13:00", "14:00", "12:59", false},
+		{"09:00", "09:00", "09:00", false},
+	}
+	for _, test := range tests {
+		start, err := parseClock(test.start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		end, _ := parseClock(test.end)
+		if isQuiet(start, end, at(test.now)) != test.quiet {
+			t.Errorf("%s at %s-%s: expected quiet = %v", test.now, test.start, test.end, test.quiet)
+		}
+	}
+	if _, err := parseClock("25:00"); err != BadQuietHours {
+		t.Fatalf("Expected BadQuietHours, got %v", err)
+	}
+}
+
+func TestUnsubscribeSignature(t *testing.T) {
+	sig := unsubscribeSignature("sekrit", 9)
+	if sig != unsubscribeSignature("sekrit", 9) {
+		t.Fatal("Signatures should be stable")
+	}
+	if sig == unsubscribeSignature("sekrit", 10) || sig == unsubscribeSignature("other", 9) {
+		t.Fatal("Signatures should depend on the user and the secret")
+	}
+}
+
+func TestDigestHeaders(t *testing.T) {
+	h := digestHeaders("https://gleepost.com/api/v1/unsubscribe?user=9&sig=abc")
+	if h["List-Unsubscribe"] != "<https://gleepost.com/api/v1/unsubscribe?user=9&sig=abc>" || h["List-Unsubscribe-Post"] != "List-Unsubscribe=One-Click" {
+		t.Fatal("Unexpected headers:", h)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	by := gp.User{Name: "<b>Patrick</b>"}
+	d := digest{Name: "Peter", Messages: 3, Unsubscribe: "https://gleepost.com/api/v1/unsubscribe?user=9&sig=abc"}
+	d.Notifications = append(d.Notifications,
+		digestLine(gp.Notification{Type: "liked", By: by, Count: 13}, ""),
+		digestLine(gp.Notification{Type: "group_post", By: by, Group: 5}, "Chess club"),
+	)
+	html, err := d.render()
+	if err != nil {
+		t.Fatalf("Error rendering digest: %v", err)
+	}
+	for _, want := range []string{"&lt;b&gt;Patrick&lt;/b&gt; and 12 others liked your post", "posted in Chess club", "3 unread messages", "user=9&amp;sig=abc"} {
+		if !strings.Contains(html, want) {
+			t.Fatalf("Expected %q in %s", want, html)
+		}
+	}
+	if strings.Contains(html, "new posts in your groups") {
+		t.Fatalf("Empty sections should be left out: %s", html)
+	}
+	if !(digest{}).empty() || d.empty() {
+		t.Fatal("Only a digest with nothing in it is empty")
+	}
+}
+
+func TestPolicyErrors(t *testing.T) {
+	policy := conf.PasswordConfig{RequireDigit: true, RequireSymbol: true}
+	common := password.Bundled()
+	tests := []struct {
+		pass  string
+		rules []string
+	}{
+		{"Tr0ub4dor&3", nil},
+		{"qwerty", []string{"min_length", "digit", "symbol", "common"}},
+		{"patrick99!", []string{"personal"}},
+		{"x", []string{"min_length", "digit", "symbol"}},
+	}
+	for _, test := range tests {
+		errs := policyErrors(policy, common, test.pass, "Patrick", "Molgaard", "patrick@fakestanford.edu")
+		if len(errs) != len(test.rules) {
+			t.Fatalf("%s: expected %v, got %v", test.pass, test.rules, errs)
+		}
+		for i, e := range errs {
+			if e.Rule != test.rules[i] || e.Field != "pass" {
+				t.Fatalf("%s: expected %v, got %v", test.pass, test.rules, errs)
+			}
+		}
+		if weak := errors.Is(errs, ETOOWEAK); weak != (len(test.rules) > 0) {
+			t.Fatalf("%s: expected errors.Is(ETOOWEAK) to be %t", test.pass, !weak)
+		}
+	}
+	missing := gp.ValidationErrors{{Field: "pass", Rule: "missing", Reason: MissingParamPass.Reason}}
+	if errors.Is(missing, ETOOWEAK) {
+		t.Fatal("A missing password isn't a weak one")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("TestingPass"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Error hashing: %v", err)
+	}
+	if needsRehash(hash, CurrentHashVersion, bcrypt.MinCost) {
+		t.Fatalf("A current hash shouldn't need rehashing")
+	}
+	if !needsRehash(hash, CurrentHashVersion, bcrypt.MinCost+1) {
+		t.Fatalf("A hash below the target cost should be rehashed")
+	}
+	if !needsRehash(hash, 0, bcrypt.MinCost) {
+		t.Fatalf("A hash with an old version should be rehashed")
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	key := func(kid string) (*rsa.PublicKey, error) {
+		if kid != "k1" {
+			return nil, errNoKey
+		}
+		return &priv.PublicKey, nil
+	}
+	sign := func(claims map[string]interface{}) string {
+		return signIDToken(t, priv, claims)
+	}
+	now := time.Now()
+	good := map[string]interface{}{"iss": "https://sso.fakestanford.edu", "aud": []string{"gleepost"}, "exp": now.Add(time.Hour).Unix(), "sub": "1234", "email": "Patrick@fakestanford.edu", "email_verified": true}
+	claims, err := verifyIDToken(sign(good), "https://sso.fakestanford.edu", "gleepost", key, now)
+	if err != nil {
+		t.Fatalf("Good token rejected: %v", err)
+	}
+	id, err := identityFromClaims(claims)
+	if err != nil || id.Subject != "1234" || id.Email != "patrick@fakestanford.edu" || !id.EmailVerified {
+		t.Fatalf("Unexpected identity %v (%v)", id, err)
+	}
+	if _, err = verifyIDToken(sign(good), "https://sso.fakestanford.edu", "someone-else", key, now); err == nil {
+		t.Fatalf("Token for another client accepted")
+	}
+	if _, err = verifyIDToken(sign(good), "https://evil.example.com", "gleepost", key, now); err == nil {
+		t.Fatalf("Token from another issuer accepted")
+	}
+	if _, err = verifyIDToken(sign(good), "https://sso.fakestanford.edu", "gleepost", key, now.Add(2*time.Hour)); err == nil {
+		t.Fatalf("Expired token accepted")
+	}
+	tampered := sign(good)
+	tampered = tampered[:len(tampered)-4] + "AAAA"
+	if _, err = verifyIDToken(tampered, "https://sso.fakestanford.edu", "gleepost", key, now); err == nil {
+		t.Fatalf("Tampered token accepted")
+	}
+}
+
+//signIDToken makes an RS256 id_token with key id "k1".
+func signIDToken(t *testing.T, priv *rsa.PrivateKey, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Error signing: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+//fakeIssuer serves a discovery document and priv's public key as "k1".
+func fakeIssuer(priv *rsa.PrivateKey) *httptest.Server {
+	mux := http.NewServeMux()
+	var srv *httptest.Server
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"jwks_uri": srv.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		key := jwk{Kty: "RSA", Kid: "k1", N: base64.RawURLEncoding.EncodeToString(priv.N.Bytes()), E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(priv.E)).Bytes())}
+		json.NewEncoder(w).Encode(map[string][]jwk{"keys": {key}})
+	})
+	srv = httptest.NewServer(mux)
+	return srv
+}
+
+//fakeNonces is a nonceConsumer whose nonces work once each.
+type fakeNonces map[string]bool
+
+func (n fakeNonces) consumeNonce(ctx context.Context, nonce string) bool {
+	ok := n[nonce]
+	delete(n, nonce)
+	return ok
+}
+
+func TestOIDCNonce(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	srv := fakeIssuer(priv)
+	defer srv.Close()
+	p := &oidcProvider{name: "fakestanford", issuer: srv.URL, clientID: "gleepost", discovery: newOIDCDiscovery(), nonces: fakeNonces{"n1": true}}
+	claims := map[string]interface{}{"iss": srv.URL, "aud": "gleepost", "exp": time.Now().Add(time.Hour).Unix(), "sub": "1234", "nonce": "n1"}
+	token := signIDToken(t, priv, claims)
+	if _, err = p.Authenticate(context.Background(), Credential{Token: token}); err != nil {
+		t.Fatalf("Token with a fresh nonce rejected: %v", err)
+	}
+	if _, err = p.Authenticate(context.Background(), Credential{Token: token}); err != BadCredential {
+		t.Fatalf("Replayed token accepted (%v)", err)
+	}
+	delete(claims, "nonce")
+	if _, err = p.Authenticate(context.Background(), Credential{Token: signIDToken(t, priv, claims)}); err != BadCredential {
+		t.Fatalf("Token without a nonce accepted (%v)", err)
+	}
+}
+
+func TestOIDCSlowIssuer(t *testing.T) {
+	arrived, release := make(chan struct{}), make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(arrived)
+		<-release
+		w.Write([]byte("{}"))
+	}))
+	defer slow.Close()
+	defer close(release)
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	fast := fakeIssuer(priv)
+	defer fast.Close()
+	d := newOIDCDiscovery()
+	go d.config(slow.URL)
+	<-arrived
+	done := make(chan error)
+	go func() {
+		_, err := d.key(fast.URL, "k1")
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatalf("Error getting key: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("One slow issuer held up another's discovery")
+	}
+}
+
+func TestMatchesClaim(t *testing.T) {
+	claims := map[string]interface{}{"affiliation": "student", "groups": []interface{}{"cs", "staff"}, "alum": false}
+	tests := []struct {
+		rule    string
+		matches bool
+	}{
+		{"affiliation=student", true},
+		{"affiliation=faculty", false},
+		{"groups=staff", true},
+		{"groups=math", false},
+		{"alum=false", true},
+		{"missing=x", false},
+		{"=student", false},
+	}
+	for _, test := range tests {
+		if matchesClaim(claims, test.rule) != test.matches {
+			t.Fatalf("%s: expected %v", test.rule, test.matches)
+		}
+	}
+}
+
 func TestLooksLikeEmail(t *testing.T) {
 	couldBeEmail := looksLikeEmail("patrick@gleepost.com")
 	if couldBeEmail != true {
@@ -3,9 +3,11 @@ package gp
 import "time"
 
 //Status represents a user's current signup state (You should only ever see "unverified" (you have an account pending email verification" or "registered" (this email is taken by someone else)
+//If a second factor is needed to log in, Status is "2fa_required" and Challenge must be sent back along with the code.
 type Status struct {
-	Status string `json:"status"`
-	Email  string `json:"email"`
+	Status    string `json:"status"`
+	Email     string `json:"email"`
+	Challenge string `json:"challenge,omitempty"`
 }
 
 //NewStatus is a shorthand for creating a Status
@@ -13,11 +15,81 @@ func NewStatus(status, email string) Status {
 	return Status{Status: status, Email: email}
 }
 
+const (
+	//ScopeRead allows a token to make GET requests.
+	ScopeRead = "read"
+	//ScopeWrite allows a token to make anything other than GET requests.
+	ScopeWrite = "write"
+	//ScopeAdmin allows a token to use the /admin endpoints (the user must still be an admin).
+	ScopeAdmin = "admin"
+	//ScopeApprove allows a token to use the /approve endpoints (the user must still have approve access).
+	ScopeApprove = "approve"
+)
+
+//AllScopes is what a token gets unless the client asks for fewer.
+var AllScopes = []string{ScopeRead, ScopeWrite, ScopeAdmin, ScopeApprove}
+
 //Token is a gleepost access token.
-//TODO: Add scopes?
 //TODO: Deprecate in favour of OAuth?
 type Token struct {
 	UserID UserID    `json:"id"`
 	Token  string    `json:"value"`
 	Expiry time.Time `json:"expiry"`
+	Scopes []string  `json:"scopes,omitempty"`
+	//RefreshToken can be swapped for a new Token (and a new RefreshToken) once this one expires.
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+//SessionID identifies a single issued token without revealing it.
+type SessionID uint64
+
+//Session describes a token a user has been issued: what it may do, what it was issued to and when it was last seen.
+type Session struct {
+	ID       SessionID  `json:"id"`
+	Scopes   []string   `json:"scopes"`
+	Device   string     `json:"device,omitempty"`
+	Created  time.Time  `json:"created"`
+	LastUsed *time.Time `json:"last_used,omitempty"`
+	Expiry   time.Time  `json:"expiry"`
+	Current  bool       `json:"current,omitempty"`
+}
+
+//TwoFactorEnrolment is what a user needs to add Gleepost to their authenticator app.
+type TwoFactorEnrolment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+//RecoveryCodes can each be used once instead of a code from the authenticator app.
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+//TwoFactorStatus describes a user's two-factor setup.
+type TwoFactorStatus struct {
+	Enabled           bool `json:"enabled"`
+	Required          bool `json:"required"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+//TwoFactorRequirement indicates whether this network's admins must use two-factor authentication.
+type TwoFactorRequirement struct {
+	Required bool `json:"required"`
+}
+
+//LinkedIdentity is an external account (facebook, or a university's single sign-on) which can be used to log in to a gleepost account.
+type LinkedIdentity struct {
+	Provider string     `json:"provider"`
+	Email    string     `json:"email,omitempty"`
+	Linked   *time.Time `json:"linked,omitempty"`
+}
+
+//LoginProvider describes an identity provider users can log in with, and (for OpenID Connect providers) what a client needs to start logging in with it.
+type LoginProvider struct {
+	Name                  string `json:"name"`
+	DisplayName           string `json:"display_name"`
+	Type                  string `json:"type"`
+	Issuer                string `json:"issuer,omitempty"`
+	ClientID              string `json:"client_id,omitempty"`
+	AuthorizationEndpoint string `json:"authorization_endpoint,omitempty"`
 }
@@ -10,12 +10,20 @@ type ConversationID uint64
 
 //Message is a particular message to a particular conversation.
 type Message struct {
-	ID     MessageID `json:"id"`
-	By     User      `json:"by"`
-	Text   string    `json:"text"`
-	Time   time.Time `json:"timestamp"`
-	System bool      `json:"system,omitempty"`
-	Group  NetworkID `json:"group,omitempty"`
+	ID      MessageID  `json:"id"`
+	By      User       `json:"by"`
+	Text    string     `json:"text"`
+	Time    time.Time  `json:"timestamp"`
+	System  bool       `json:"system,omitempty"`
+	Group   NetworkID  `json:"group,omitempty"`
+	Edited  *time.Time `json:"edited,omitempty"`
+	Deleted bool       `json:"deleted,omitempty"` //A deleted message is a tombstone; its text is gone.
+}
+
+//MessageEdit is a message's text as it was until it was edited at Time.
+type MessageEdit struct {
+	Text string    `json:"text"`
+	Time time.Time `json:"timestamp"`
 }
 
 //Read represents the most recent message a user has seen in a particular conversation (it doesn't make much sense without that context).
@@ -59,3 +67,17 @@ type Presence struct {
 	Form string    `json:"form"`
 	At   time.Time `json:"at"`
 }
+
+//PresenceEvent tells a user's conversation partners that they've come online.
+type PresenceEvent struct {
+	UserID UserID    `json:"user"`
+	Form   string    `json:"form"`
+	At     time.Time `json:"at"`
+}
+
+//TypingEvent tells the rest of a conversation that someone started or stopped typing.
+type TypingEvent struct {
+	UserID         UserID         `json:"user"`
+	ConversationID ConversationID `json:"conversation"`
+	Typing         bool           `json:"typing"`
+}
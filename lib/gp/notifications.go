@@ -16,4 +16,43 @@ type Notification struct {
 	Group   NetworkID      `json:"network,omitempty"`
 	Preview string         `json:"preview,omitempty"`
 	Done    bool           `json:"done,omitempty"`
+	Count   int            `json:"count,omitempty"` //How many people an aggregated notification is about. By is the most recent.
+	Actors  []User         `json:"users,omitempty"` //The most recent few of them.
+	//Replaces is the notification an aggregate has superseded, when it's gathered another person. It's only set on notification events.
+	Replaces NotificationID `json:"replaces,omitempty"`
+}
+
+//BadgeCounts are how many unseen notifications, unread messages and new group posts a user has.
+type BadgeCounts struct {
+	Notifications int `json:"notifications"`
+	Messages      int `json:"messages"`
+	Groups        int `json:"groups"`
+}
+
+//Channels says which ways a user wants to hear about a notification: in the app's notification list, by push, and by email.
+type Channels struct {
+	InApp bool `json:"in_app"`
+	Push  bool `json:"push"`
+	Email bool `json:"email"`
+}
+
+//GroupNotificationSettings overrides a user's channels for every notification about one group.
+type GroupNotificationSettings struct {
+	Group NetworkID `json:"network"`
+	Channels
+}
+
+//QuietHours is a daily window, in the user's own timezone, during which they aren't pushed to. Start and End are "15:04"-style times; the window runs past midnight if End is before Start.
+type QuietHours struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Timezone string `json:"timezone"`
+}
+
+//NotificationSettings is how a user wants to hear about each type of notification.
+type NotificationSettings struct {
+	Types      map[string]Channels         `json:"types"`
+	Groups     []GroupNotificationSettings `json:"networks"`
+	QuietHours *QuietHours                 `json:"quiet_hours,omitempty"`
+	Digest     string                      `json:"digest"` //How often they get an email digest of what they've missed: daily, weekly or never.
 }
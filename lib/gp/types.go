@@ -1,7 +1,11 @@
 //Package gp contains the core datatypes in Gleepost.
 package gp
 
-import "time"
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
 
 //UserID is self explanatory.
 type UserID uint64
@@ -87,6 +91,7 @@ type Created struct {
 type NewUser struct {
 	ID     UserID `json:"id"`
 	Status string `json:"status"`
+	Token  *Token `json:"token,omitempty"`
 }
 
 //URLCreated represents a url you've uploaded.
@@ -104,6 +109,53 @@ func (e APIerror) Error() string {
 	return e.Reason
 }
 
+//FieldError describes one thing wrong with one parameter of a request.
+type FieldError struct {
+	Field  string `json:"field"`
+	Rule   string `json:"rule"`
+	Reason string `json:"error"`
+}
+
+//ValidationErrors is everything wrong with a request, all at once.
+type ValidationErrors []FieldError
+
+//Error - implements the error interface.
+func (e ValidationErrors) Error() string {
+	reasons := make([]string, 0, len(e))
+	for _, f := range e {
+		reasons = append(reasons, f.Reason)
+	}
+	return strings.Join(reasons, "; ")
+}
+
+//WeakPassword is the error a password which didn't meet the requirements used to get, before there was a policy to say which requirement it missed.
+var WeakPassword = APIerror{Reason: "Password too weak!"}
+
+//Is lets errors.Is match a ValidationErrors which rejects a password against WeakPassword, for callers that predate the password policy.
+func (e ValidationErrors) Is(target error) bool {
+	if target != error(WeakPassword) {
+		return false
+	}
+	for _, f := range e {
+		if f.Field == "pass" && f.Rule != "missing" {
+			return true
+		}
+	}
+	return false
+}
+
+//MarshalJSON puts the first error in "error", as for an APIerror, so that clients which only show one error still have something to show.
+func (e ValidationErrors) MarshalJSON() ([]byte, error) {
+	resp := struct {
+		Reason string       `json:"error"`
+		Errors []FieldError `json:"errors"`
+	}{Errors: []FieldError(e)}
+	if len(e) > 0 {
+		resp.Reason = e[0].Reason
+	}
+	return json.Marshal(resp)
+}
+
 //ENOSUCHUSER is the error that should be returned when performing some action against a non-existent user.
 var ENOSUCHUSER = APIerror{Reason: "No such user."}
 
@@ -120,6 +172,42 @@ type QueueCommand struct {
 	Value   []string
 }
 
+//EventBatch is a long-poll's worth of events (each a WrappedEvent, as sent over a websocket), along with the cursor to poll from next time.
+type EventBatch struct {
+	Events []json.RawMessage `json:"events"`
+	Cursor string            `json:"cursor"`
+}
+
+//Connection is a live realtime connection (a websocket, event stream or long-poll), as seen by an admin.
+type Connection struct {
+	ID        uint64    `json:"id"`
+	Transport string    `json:"transport"`
+	Addr      string    `json:"addr"`
+	Opened    time.Time `json:"opened"`
+	Channels  []string  `json:"channels"`
+	Queued    int       `json:"queued"`
+}
+
+//UserConnections is every live realtime connection one user holds.
+type UserConnections struct {
+	User        UserID       `json:"user"`
+	Connections []Connection `json:"connections"`
+}
+
+//PushFailure is a push notification which couldn't be delivered, and was given up on.
+type PushFailure struct {
+	ID          uint64          `json:"id"`
+	Application string          `json:"application"`
+	User        UserID          `json:"user"`
+	DeviceType  string          `json:"device_type"`
+	DeviceID    string          `json:"device_id"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	Error       string          `json:"error"`
+	Created     time.Time       `json:"created"`
+	FailedAt    time.Time       `json:"failed_at"`
+}
+
 //WrappedEvent adds some stuff around an Event so that certain shitty javascript websocket can consume it OK.
 type WrappedEvent struct {
 	Event string `json:"event"`
@@ -128,10 +216,15 @@ type WrappedEvent struct {
 
 //Event represents something that happened which a consumer of a MsgQueue wants to hear about in real time.
 //It has a type, a location (typically a resource) and a json payload.
+//Channel and Seq identify where it was published; Seq increases by one with every event published to Channel, so a client can tell what it's missed.
+//Version is the version of Type's payload; see events.Register.
 type Event struct {
 	Type     string      `json:"type"`
+	Version  int         `json:"version,omitempty"`
 	Location string      `json:"location,omitempty"`
 	Data     interface{} `json:"data"`
+	Channel  string      `json:"channel,omitempty"`
+	Seq      int64       `json:"seq,omitempty"`
 }
 
 //Video contains a URL for an .mp4 and .webm encode of the same video, as well as thumbnails where available.
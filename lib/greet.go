@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"strings"
 
 	"github.com/Petergatsby/GleepostAPI/lib/gp"
@@ -12,12 +13,12 @@ var messages = []string{"Welcome to {app}, {firstname}!"}
 var ErrInvalidPreset = gp.APIerror{Reason: "No such preset message"}
 
 //GreetMe sends a preset welcome message from CampusBot.
-func (api *API) GreetMe(userID gp.UserID, n int) (err error) {
-	greeterID, err := api.greeterID()
+func (api *API) GreetMe(ctx context.Context, userID gp.UserID, n int) (err error) {
+	greeterID, err := api.greeterID(ctx)
 	if err != nil {
 		return
 	}
-	conv, err := api.CreateConversationWith(greeterID, []gp.UserID{userID})
+	conv, err := api.CreateConversationWith(ctx, greeterID, []gp.UserID{userID})
 	if err != nil {
 		return
 	}
@@ -25,7 +26,7 @@ func (api *API) GreetMe(userID gp.UserID, n int) (err error) {
 		return ErrInvalidPreset
 	}
 
-	user, err := api.getProfile(userID, userID)
+	user, err := api.getProfile(ctx, userID, userID)
 	if err != nil {
 		return
 	}
@@ -33,18 +34,10 @@ func (api *API) GreetMe(userID gp.UserID, n int) (err error) {
 	first := names[0]
 	msg := strings.Replace(messages[n], "{app}", "CampusPal", -1)
 	msg = strings.Replace(msg, "{firstname}", first, -1)
-	_, err = api.AddMessage(conv.ID, greeterID, msg)
+	_, err = api.AddMessage(ctx, conv.ID, greeterID, msg)
 	return
 }
 
-func (api *API) greeterID() (greeterID gp.UserID, err error) {
-	s, err := api.sc.Prepare("SELECT id FROM users WHERE greeter = 1")
-	if err != nil {
-		return
-	}
-	err = s.QueryRow().Scan(&greeterID)
-	if err != nil {
-		return
-	}
-	return
+func (api *API) greeterID(ctx context.Context) (greeterID gp.UserID, err error) {
+	return api.store.Users.Greeter(ctx)
 }
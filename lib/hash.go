@@ -0,0 +1,49 @@
+package lib
+
+import (
+	"context"
+	"log"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+//Password hash versions, as stored in users.password_version. Every hash so far is bcrypt; if that ever changes, add a version here and bump CurrentHashVersion.
+const (
+	hashBcrypt = 1
+	//CurrentHashVersion is the version new hashes are made with; anything older is rehashed at login.
+	CurrentHashVersion = hashBcrypt
+)
+
+//hashPassword hashes pass with the current version and the configured cost.
+func (auth *Authenticator) hashPassword(pass string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(pass), auth.hashCost)
+}
+
+//needsRehash returns true if this hash was made with an older version, or a lower cost than we use now.
+func needsRehash(hash []byte, version, cost int) bool {
+	if version < CurrentHashVersion {
+		return true
+	}
+	current, err := bcrypt.Cost(hash)
+	if err != nil {
+		//Not something we can make sense of; leave it alone.
+		return false
+	}
+	return current < cost
+}
+
+//upgradeHash replaces this user's hash with one made by hashPassword. We need the plaintext for that, so it can only happen when they log in.
+//If the password has changed in the meantime, it does nothing. It runs after the login has succeeded, so it has its own context.
+func (auth *Authenticator) upgradeHash(id gp.UserID, pass string, oldHash []byte) {
+	ctx := context.Background()
+	hash, err := auth.hashPassword(pass)
+	if err != nil {
+		log.Println("Error rehashing password:", err)
+		return
+	}
+	err = auth.users.ReplacePassword(ctx, id, oldHash, hash, CurrentHashVersion)
+	if err != nil {
+		log.Println("Error storing rehashed password:", err)
+	}
+}
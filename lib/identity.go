@@ -0,0 +1,408 @@
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/psc"
+)
+
+var (
+	//NoSuchProvider means you tried to log in with (or link) an identity provider we don't know about, or which has been disabled.
+	NoSuchProvider = gp.APIerror{Reason: "No such identity provider"}
+	//BadCredential means the identity provider didn't accept the token or code you gave us.
+	BadCredential = gp.APIerror{Reason: "Identity provider rejected credential"}
+	//IdentityEmailUnverified means the identity provider couldn't vouch for this identity's email address, so we can't create an account from it.
+	IdentityEmailUnverified = gp.APIerror{Reason: "Identity provider hasn't verified this email address"}
+	//IdentityAlreadyLinked means this external identity is already linked to a different gleepost account.
+	IdentityAlreadyLinked = gp.APIerror{Reason: "That identity is already linked to another account"}
+	//NotLinked means you tried to unlink an identity provider you haven't linked.
+	NotLinked = gp.APIerror{Reason: "You haven't linked that identity provider"}
+)
+
+//Credential is whatever the client got from the identity provider: either a token it can verify directly, or an authorization code (and the redirect_uri it was issued to) for us to exchange.
+type Credential struct {
+	Token       string
+	Code        string
+	RedirectURI string
+}
+
+//Identity is a user as an identity provider sees them.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+	Avatar        string
+	Claims        map[string]interface{}
+}
+
+//IdentityProvider is somewhere outside gleepost which can vouch for who a user is.
+type IdentityProvider interface {
+	//Name is how clients refer to this provider.
+	Name() string
+	//Network is the university network this provider belongs to, or 0 if it isn't tied to one (ie, facebook).
+	Network() gp.NetworkID
+	//Authenticate checks this credential with the provider, returning BadCredential if it doesn't accept it.
+	Authenticate(context.Context, Credential) (Identity, error)
+	//Info is what clients need to know to start logging in with this provider.
+	Info() gp.LoginProvider
+}
+
+//linker records which gleepost user an external identity belongs to.
+//Providers which keep their own record of this (facebook) implement it themselves; everyone else uses the external_identities table.
+type linker interface {
+	linkedUser(ctx context.Context, subject string) (gp.UserID, error)
+	link(ctx context.Context, userID gp.UserID, id Identity) error
+	unlink(ctx context.Context, userID gp.UserID) error
+}
+
+//identityProvider returns the provider called name, or NoSuchProvider.
+func (api *API) identityProvider(ctx context.Context, name string) (p IdentityProvider, err error) {
+	if name == "facebook" {
+		return &facebookProvider{api: api}, nil
+	}
+	s, err := api.sc.Prepare("SELECT network_id, display_name, type, issuer, client_id, client_secret FROM identity_providers WHERE name = ? AND enabled = 1")
+	if err != nil {
+		return
+	}
+	var netID gp.NetworkID
+	var displayName, kind, issuer, clientID, clientSecret string
+	err = s.QueryRowContext(ctx, name).Scan(&netID, &displayName, &kind, &issuer, &clientID, &clientSecret)
+	if err == sql.ErrNoRows {
+		return nil, NoSuchProvider
+	}
+	if err != nil {
+		return
+	}
+	switch kind {
+	case "oidc":
+		return &oidcProvider{name: name, displayName: displayName, network: netID, issuer: issuer, clientID: clientID, clientSecret: clientSecret, discovery: api.oidc, nonces: api.Auth}, nil
+	default:
+		log.Printf("Identity provider %s has unsupported type %q\n", name, kind)
+		return nil, NoSuchProvider
+	}
+}
+
+//linkerFor returns how links to p's identities are stored.
+func (api *API) linkerFor(p IdentityProvider) linker {
+	if l, ok := p.(linker); ok {
+		return l
+	}
+	return &externalLinker{sc: api.sc, provider: p.Name()}
+}
+
+//IdentityProviders lists the single sign-on providers for this network, so that the client can offer them on its login screen.
+func (api *API) IdentityProviders(ctx context.Context, netID gp.NetworkID) (providers []gp.LoginProvider, err error) {
+	providers = make([]gp.LoginProvider, 0)
+	s, err := api.sc.Prepare("SELECT name FROM identity_providers WHERE network_id = ? AND enabled = 1 ORDER BY name")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, netID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return
+		}
+		names = append(names, name)
+	}
+	for _, name := range names {
+		p, e := api.identityProvider(ctx, name)
+		if e != nil {
+			continue
+		}
+		providers = append(providers, p.Info())
+	}
+	return
+}
+
+//ExternalLogin logs a user in with an identity provider, issuing a session token for this device limited to these scopes.
+//If nobody has linked this identity yet, and the provider has verified its email address, a new verified account is created for it;
+//if that email address already belongs to an account, the status is "registered" instead: the user must log in and link the provider themselves, so a provider can't take over an existing account.
+//As with AttemptLogin, users with two-factor authentication get a "2fa_required" status instead of a token.
+func (api *API) ExternalLogin(ctx context.Context, provider string, cred Credential, device string, scopes []string) (token gp.Token, status gp.Status, err error) {
+	p, err := api.identityProvider(ctx, provider)
+	if err != nil {
+		return
+	}
+	id, err := p.Authenticate(ctx, cred)
+	if err != nil {
+		go api.Statsd.Count(1, "gleepost.auth.external."+provider+".rejected")
+		return
+	}
+	l := api.linkerFor(p)
+	userID, err := l.linkedUser(ctx, id.Subject)
+	switch {
+	case err == nil:
+		var email string
+		email, err = api.getEmail(ctx, userID)
+		if err != nil {
+			return
+		}
+		//This can finish after they've logged in.
+		go api.assignNetworksFromIdentity(context.Background(), userID, p, id)
+		return api.startSession(ctx, userID, email, device, scopes)
+	case err != NoSuchUser:
+		return
+	}
+	if !id.EmailVerified || !looksLikeEmail(id.Email) {
+		err = IdentityEmailUnverified
+		return
+	}
+	_, err = api.userWithEmail(ctx, id.Email)
+	switch {
+	case err == nil:
+		status = gp.NewStatus("registered", id.Email)
+		return
+	case err != NoSuchUser:
+		return
+	}
+	userID, err = api.createUserFromIdentity(ctx, p, id)
+	if err != nil {
+		return
+	}
+	err = l.link(ctx, userID, id)
+	if err != nil {
+		return
+	}
+	go api.Statsd.Count(1, "gleepost.auth.external."+provider+".registered")
+	go api.lookUpDirectory(userID)
+	return api.startSession(ctx, userID, id.Email, device, scopes)
+}
+
+//createUserFromIdentity creates a verified gleepost account for this identity. They can't log in with a password until they reset it.
+func (api *API) createUserFromIdentity(ctx context.Context, p IdentityProvider, id Identity) (userID gp.UserID, err error) {
+	first, last := normaliseName(id.FirstName), normaliseName(id.LastName)
+	if len(first) == 0 {
+		first = normaliseName(strings.Split(id.Email, "@")[0])
+	}
+	random, err := randomString()
+	if err != nil {
+		return
+	}
+	userID, err = api.createUser(ctx, first, last, random, normalizeEmail(id.Email))
+	if err != nil {
+		return
+	}
+	err = api.verify(ctx, userID)
+	if err != nil {
+		return
+	}
+	if len(id.Avatar) > 0 {
+		err = api.setProfileImage(ctx, userID, id.Avatar)
+		if err != nil {
+			log.Println("Problem setting avatar:", err)
+		}
+	}
+	err = api.assignNetworksFromIdentity(ctx, userID, p, id)
+	if err != nil {
+		return
+	}
+	err = api.acceptAllInvites(ctx, userID, id.Email)
+	return
+}
+
+//assignNetworksFromIdentity puts this user into every network their identity entitles them to: the provider's own network,
+//and any of its sub-networks whose email rules match a verified email address, or whose "claim" rule (name=value) their identity satisfies.
+//A provider only vouches for its own university, so other networks' rules are never checked against its identities; one which doesn't belong to a university (facebook) doesn't get to use any.
+func (api *API) assignNetworksFromIdentity(ctx context.Context, userID gp.UserID, p IdentityProvider, id Identity) (err error) {
+	if p.Network() == 0 {
+		return nil
+	}
+	networks := map[gp.NetworkID]bool{p.Network(): true}
+	rules, err := api.networkRules(ctx, p.Network())
+	if err != nil {
+		return
+	}
+	for _, rule := range rules {
+		switch {
+		case rule.Type == "email" && id.EmailVerified && strings.HasSuffix(id.Email, rule.Value):
+			networks[rule.NetworkID] = true
+		case rule.Type == "claim" && matchesClaim(id.Claims, rule.Value):
+			networks[rule.NetworkID] = true
+		}
+	}
+	for netID := range networks {
+		err = api.setNetwork(ctx, userID, netID)
+		if err != nil && err != AlreadyMember {
+			return
+		}
+	}
+	return nil
+}
+
+//matchesClaim reports whether claims satisfy a "name=value" rule. A list claim (eg, groups) matches if any of its entries do.
+func matchesClaim(claims map[string]interface{}, rule string) bool {
+	i := strings.Index(rule, "=")
+	if i < 1 {
+		return false
+	}
+	name, value := rule[:i], rule[i+1:]
+	switch claim := claims[name].(type) {
+	case string:
+		return claim == value
+	case bool:
+		return fmt.Sprint(claim) == value
+	case []interface{}:
+		for _, c := range claim {
+			if s, ok := c.(string); ok && s == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//startSession logs this (already authenticated, verified) user in on this device: either issuing a token, or if they have two-factor authentication, a challenge.
+func (api *API) startSession(ctx context.Context, userID gp.UserID, email, device string, scopes []string) (token gp.Token, status gp.Status, err error) {
+	enabled, err := api.twoFactorEnabled(ctx, userID)
+	if err != nil {
+		return
+	}
+	if enabled {
+		var challenge string
+		challenge, err = api.Auth.createChallenge(ctx, userID, device, scopes)
+		if err != nil {
+			return
+		}
+		status = gp.Status{Status: "2fa_required", Email: email, Challenge: challenge}
+		return
+	}
+	token, err = api.Auth.createAndStoreToken(ctx, userID, device, scopes)
+	return
+}
+
+//LinkIdentity lets userID log in with this identity provider from now on, replacing any identity from the same provider they'd linked before.
+//It returns IdentityAlreadyLinked if the identity belongs to somebody else.
+func (api *API) LinkIdentity(ctx context.Context, userID gp.UserID, provider string, cred Credential) (err error) {
+	p, err := api.identityProvider(ctx, provider)
+	if err != nil {
+		return
+	}
+	id, err := p.Authenticate(ctx, cred)
+	if err != nil {
+		return
+	}
+	l := api.linkerFor(p)
+	owner, err := l.linkedUser(ctx, id.Subject)
+	switch {
+	case err == nil && owner == userID:
+		return nil
+	case err == nil:
+		return IdentityAlreadyLinked
+	case err != NoSuchUser:
+		return
+	}
+	err = l.unlink(ctx, userID)
+	if err != nil && err != NotLinked {
+		return
+	}
+	err = l.link(ctx, userID, id)
+	if err != nil {
+		return
+	}
+	return api.assignNetworksFromIdentity(ctx, userID, p, id)
+}
+
+//UnlinkIdentity stops userID logging in with this provider, or returns NotLinked if they never could.
+func (api *API) UnlinkIdentity(ctx context.Context, userID gp.UserID, provider string) (err error) {
+	p, err := api.identityProvider(ctx, provider)
+	if err != nil {
+		return
+	}
+	return api.linkerFor(p).unlink(ctx, userID)
+}
+
+//LinkedIdentities lists the external identities this user can log in with.
+func (api *API) LinkedIdentities(ctx context.Context, userID gp.UserID) (identities []gp.LinkedIdentity, err error) {
+	identities = make([]gp.LinkedIdentity, 0)
+	fbid, err := api.fbUser(ctx, userID)
+	switch {
+	case err == nil:
+		email, _ := api.fBGetEmail(ctx, fbid)
+		identities = append(identities, gp.LinkedIdentity{Provider: "facebook", Email: email})
+	case err != NoSuchUser:
+		return
+	}
+	s, err := api.sc.Prepare("SELECT provider, email, created FROM external_identities WHERE user_id = ? ORDER BY provider")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, userID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var identity gp.LinkedIdentity
+		var email sql.NullString
+		var created string
+		if err = rows.Scan(&identity.Provider, &email, &created); err != nil {
+			return
+		}
+		identity.Email = email.String
+		if t, e := time.Parse(mysqlTime, created); e == nil {
+			identity.Linked = &t
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+//externalLinker stores links to a provider's identities in external_identities.
+type externalLinker struct {
+	sc       *psc.StatementCache
+	provider string
+}
+
+func (l *externalLinker) linkedUser(ctx context.Context, subject string) (userID gp.UserID, err error) {
+	s, err := l.sc.Prepare("SELECT user_id FROM external_identities WHERE provider = ? AND subject = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, l.provider, subject).Scan(&userID)
+	if err == sql.ErrNoRows {
+		err = NoSuchUser
+	}
+	return
+}
+
+func (l *externalLinker) link(ctx context.Context, userID gp.UserID, id Identity) (err error) {
+	s, err := l.sc.Prepare("INSERT INTO external_identities (provider, subject, user_id, email) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return
+	}
+	var email sql.NullString
+	if len(id.Email) > 0 {
+		email = sql.NullString{String: id.Email, Valid: true}
+	}
+	_, err = s.ExecContext(ctx, l.provider, id.Subject, userID, email)
+	return
+}
+
+func (l *externalLinker) unlink(ctx context.Context, userID gp.UserID) (err error) {
+	s, err := l.sc.Prepare("DELETE FROM external_identities WHERE provider = ? AND user_id = ?")
+	if err != nil {
+		return
+	}
+	res, err := s.ExecContext(ctx, l.provider, userID)
+	if err != nil {
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return NotLinked
+	}
+	return nil
+}
@@ -12,8 +12,12 @@ import (
 	"github.com/Petergatsby/GleepostAPI/lib/events"
 	"github.com/Petergatsby/GleepostAPI/lib/gp"
 	"github.com/Petergatsby/GleepostAPI/lib/mail"
+	"github.com/Petergatsby/GleepostAPI/lib/password"
 	"github.com/Petergatsby/GleepostAPI/lib/psc"
 	"github.com/Petergatsby/GleepostAPI/lib/push"
+	"github.com/Petergatsby/GleepostAPI/lib/realtime"
+	"github.com/Petergatsby/GleepostAPI/lib/replica"
+	"github.com/Petergatsby/GleepostAPI/lib/store"
 	"github.com/Petergatsby/GleepostAPI/lib/transcode"
 	"github.com/garyburd/redigo/redis"
 	"github.com/mitchellh/goamz/aws"
@@ -24,29 +28,33 @@ import (
 //API contains all the configuration and sub-modules the Gleepost API requires to function.
 type API struct {
 	Auth          *Authenticator
-	broker        *events.Broker
+	broker        events.EventBus
 	db            *sql.DB
 	sc            *psc.StatementCache
+	replicas      *replica.Set //For read-only queries which can stand a little replication lag.
+	store         store.Store
 	fb            *FB
 	Mail          mail.Mailer
 	Config        conf.Config
 	pushers       map[string]push.Pusher
 	Statsd        PrefixStatter
 	notifObserver NotificationObserver
+	pushQueue     *pushQueue
 	TW            TranscodeWorker
 	Viewer        Viewer
 	users         *Users
 	nm            *NetworkManager
 	Presences     Presences
 	comments      comments
+	passwords     password.List
+	oidc          *oidcDiscovery
+	Connections   *realtime.Registry
 }
 
 const inviteCampaignIOS = "http://ad.apps.fm/2sQSPmGhIyIaKGZ01wtHD_E7og6fuV2oOMeOQdRqrE1xKZaHtwHb8iGWO0i4C3przjNn5v5h3werrSfj3HdREnrOdTW3xhZTjoAE5juerBQ8UiWF6mcRlxGSVB6OqmJv"
 const inviteCampaignAndroid = "http://ad.apps.fm/WOIqfW3iWi3krjT_Y-U5uq5px440Px0vtrw1ww5B54zsDQMwj9gVfW3tCxpkeXdizYtt678Ci7Y3djqLAxIATdBAW28aYabvxh6AeQ1YLF8"
 
 var (
-	//ETOOWEAK - You'll get this when your password is too week (ie, less than 5 chars at the moment)
-	ETOOWEAK = gp.APIerror{Reason: "Password too weak!"}
 	//EBADREC means you tried to recover your password with an invalid or missing password reset token.
 	EBADREC = gp.APIerror{Reason: "Bad password recovery token."}
 )
@@ -54,7 +62,7 @@ var (
 //New creates an API from a gp.Config
 func New(conf conf.Config) (api *API) {
 	api = new(API)
-	api.broker = events.New(conf.Redis)
+	api.broker = events.NewBus(conf.Events, conf.Redis)
 	api.Config = conf
 	api.fb = &FB{config: conf.Facebook}
 	api.Mail = mail.New(conf.Email.FromHeader, conf.Email.From, conf.Email.User, conf.Email.Pass, conf.Email.Server, conf.Email.Port)
@@ -63,18 +71,38 @@ func New(conf conf.Config) (api *API) {
 		log.Fatal("error getting db:", err)
 	}
 	db.SetMaxIdleConns(100)
-	api.sc = psc.NewCache(db)
+	api.sc = psc.NewCache(db, conf.Mysql.MaxStatements)
 	api.db = db
 	pool := redis.NewPool(events.GetDialer(conf.Redis), 100)
-	api.Auth = &Authenticator{sc: api.sc, pool: pool}
+	api.replicas = replica.New(api.sc, recentWrites{pool: pool, window: conf.Mysql.ReadYourWrites()})
+	for _, r := range conf.Mysql.Replicas {
+		rdb, err := sql.Open("mysql", conf.Mysql.ReplicaConnectionString(r))
+		if err != nil {
+			log.Println("Couldn't use replica", r.Host, err)
+			continue
+		}
+		rdb.SetMaxIdleConns(100)
+		api.replicas.Add(r.Host+":"+r.Port, rdb, conf.Mysql.MaxStatements)
+	}
+	api.store = store.NewMySQL(db, api.sc, api.replicas)
+	api.Auth = &Authenticator{sc: api.sc, users: api.store.Users, tokens: api.store.Tokens, pool: pool, config: conf.Tokens, throttle: conf.Throttle, hashCost: conf.Passwords.Cost()}
 	auth := aws.Auth{}
 	auth.AccessKey, auth.SecretKey = conf.AWS.KeyID, conf.AWS.SecretKey
 	api.TW = newTranscodeWorker(db, api.sc, transcode.NewTranscoder(), s3.New(auth, aws.USWest).Bucket("gpcali"), api.broker)
 	api.Viewer = &viewer{broker: api.broker, sc: api.sc}
-	api.users = &Users{sc: api.sc, pool: pool}
-	api.nm = &NetworkManager{sc: api.sc}
-	api.Presences = Presences{broker: api.broker, sc: api.sc, pool: pool}
-	api.comments = comments{sc: api.sc, users: api.users}
+	api.users = &Users{store: api.store.Users, pool: pool}
+	api.nm = &NetworkManager{networks: api.store.Networks}
+	api.Presences = Presences{broker: api.broker, conversations: api.store.Conversations, pool: pool}
+	api.comments = comments{posts: api.store.Posts, users: api.users}
+	api.oidc = newOIDCDiscovery()
+	api.Connections = realtime.NewRegistry(conf.Realtime)
+	api.passwords = password.Bundled()
+	if len(conf.Passwords.CommonList) > 0 {
+		err = api.passwords.Load(conf.Passwords.CommonList)
+		if err != nil {
+			log.Println("Couldn't load Passwords.CommonList:", err)
+		}
+	}
 	return
 }
 
@@ -85,15 +113,13 @@ func (api *API) Start() {
 		log.Println("No pushers configured. Are you sure this is right?")
 	}
 	for _, psh := range api.Config.Pushers {
-		api.pushers[psh.AppName] = push.NewFake()
+		api.pushers[psh.AppName] = push.New(psh)
 	}
-	gp, ok := api.pushers["gleepost"]
-	if ok {
-		api.notifObserver = NewObserver(api.db, api.broker, gp, api.sc, api.users, api.nm, api.Presences, api.comments)
-	} else {
-		log.Println("No \"gleepost\" pusher; using blackhole pusher")
-		api.notifObserver = NewObserver(api.db, api.broker, push.NewFake(), api.sc, api.users, api.nm, api.Presences, api.comments)
+	if _, ok := api.pushers["gleepost"]; !ok {
+		log.Println("No \"gleepost\" pusher; notifications won't be pushed")
 	}
+	api.pushQueue = newPushQueue(api.store.PushQueue, api.pushers, api.Config.PushQueue, &api.Statsd, api.feedback)
+	api.notifObserver = NewObserver(api.broker, api.pushQueue, api.sc, api.store, api.users, api.nm, api.Presences, api.comments)
 	statsd, err := g2s.Dial("udp", api.Config.Statsd)
 	if err != nil {
 		log.Printf("Statsd failed: %s\n", err)
@@ -103,7 +129,18 @@ func (api *API) Start() {
 		api.notifObserver.stats = api.Statsd
 		api.Presences.Statsd = api.Statsd
 		api.comments.stats = api.Statsd
+		api.sc.SetStatter(api.Statsd)
+		api.replicas.SetStatter(api.Statsd)
 	}
+	go api.replicas.HealthCheck(api.Config.Mysql.HealthCheckInterval())
+	api.pushQueue.start()
+}
+
+//Close releases the API's prepared statements and database connections. Call it once nothing else will be served.
+func (api *API) Close() {
+	api.replicas.Close()
+	api.sc.Close()
+	api.db.Close()
 }
 
 //RandomString generates a long, random string (currently hex encoded, for some unknown reason.)
@@ -22,6 +22,8 @@ type mailer struct {
 type Mailer interface {
 	SendPlaintext(to, subject, body string) error
 	SendHTML(to, subject, body string) error
+	//SendHTMLWithHeaders is SendHTML with some extra headers, eg. List-Unsubscribe.
+	SendHTMLWithHeaders(to, subject, body string, headers map[string]string) error
 }
 
 //NewHeader generates a Header with from and date pre-populated.
@@ -60,7 +62,15 @@ func (m *mailer) SendPlaintext(to string, subject string, body string) (err erro
 
 //SendHTML - Send, but with HTML
 func (m *mailer) SendHTML(to string, subject string, body string) (err error) {
+	return m.SendHTMLWithHeaders(to, subject, body, nil)
+}
+
+//SendHTMLWithHeaders sends an HTML email with these extra headers.
+func (m *mailer) SendHTMLWithHeaders(to string, subject string, body string, headers map[string]string) (err error) {
 	header := m.newHeader()
+	for k, v := range headers {
+		header[k] = []string{v}
+	}
 	header["Content-Type"] = []string{"text/html; charset=\"UTF-8\""}
 	header["To"] = []string{to}
 	header["Subject"] = []string{subject}
@@ -87,3 +97,8 @@ func (s *stubMailer) SendHTML(to, subject, body string) error {
 	log.Println("Sending html email:", to, subject)
 	return nil
 }
+
+func (s *stubMailer) SendHTMLWithHeaders(to, subject, body string, headers map[string]string) error {
+	log.Println("Sending html email:", to, subject, headers)
+	return nil
+}
@@ -1,14 +1,15 @@
 package lib
 
 import (
+	"context"
 	"log"
 
 	"github.com/Petergatsby/GleepostAPI/lib/gp"
 )
 
 //Massmail sends a standard email to all users. Probably just use MailChimp instead, though.
-func (api *API) Massmail(userID gp.UserID) (err error) {
-	if !api.isAdmin(userID) {
+func (api *API) Massmail(ctx context.Context, userID gp.UserID) (err error) {
+	if !api.isAdmin(ctx, userID) {
 		return ENOTALLOWED
 	}
 	subject := "FREE REDBULL STUDYGRAMS AT TRESIDDER AND GREEN LIBRARY!"
@@ -19,7 +20,7 @@ It’s dead week and we all know that we’re all stressing over exams! You've h
 See you there and Good luck with exams!<br><br> 
 
 Curing FOMO one day at a time, The Gleepost Team.</body></html>`
-	emails, err := api.allEmails()
+	emails, err := api.allEmails(ctx)
 	if err != nil {
 		log.Println(err)
 		return
@@ -38,22 +39,6 @@ Curing FOMO one day at a time, The Gleepost Team.</body></html>`
 }
 
 //AllEmails returns all registered emails.
-func (api *API) allEmails() (emails []string, err error) {
-	s, err := api.sc.Prepare("SELECT email FROM users")
-	if err != nil {
-		return
-	}
-	rows, err := s.Query()
-	if err != nil {
-		return
-	}
-	for rows.Next() {
-		var email string
-		err = rows.Scan(&email)
-		if err != nil {
-			return
-		}
-		emails = append(emails, email)
-	}
-	return
+func (api *API) allEmails(ctx context.Context) (emails []string, err error) {
+	return api.store.Users.Emails(ctx)
 }
@@ -0,0 +1,153 @@
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/events"
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+//NoSuchMessage means the message doesn't exist (or has been deleted), or isn't in that conversation.
+var NoSuchMessage = gp.APIerror{Reason: "No such message", StatusCode: 404}
+
+//EditWindowClosed is returned when a message is too old to edit or delete.
+var EditWindowClosed = gp.APIerror{Reason: "It's too late to change that message", StatusCode: 403}
+
+//EmptyMessage is returned when you try to edit a message to say nothing at all; delete it instead.
+var EmptyMessage = gp.APIerror{Reason: "Message can't be empty", StatusCode: 400}
+
+//storedMessage returns message msgID in convID, and who sent it.
+func (api *API) storedMessage(ctx context.Context, convID gp.ConversationID, msgID gp.MessageID) (message gp.Message, from gp.UserID, err error) {
+	stored, err := api.store.Conversations.Message(ctx, convID, msgID)
+	if err == sql.ErrNoRows {
+		return message, from, NoSuchMessage
+	}
+	if err != nil {
+		return
+	}
+	message, err = api.message(ctx, stored)
+	if err != nil {
+		return
+	}
+	group, err := api.conversationGroup(ctx, convID)
+	if group > 0 && err == nil {
+		message.Group = group
+	}
+	return message, stored.By, nil
+}
+
+//changeableMessage returns message msgID if userID sent it, and sent it recently enough to still edit or delete it.
+func (api *API) changeableMessage(ctx context.Context, userID gp.UserID, convID gp.ConversationID, msgID gp.MessageID) (message gp.Message, err error) {
+	if !api.userCanViewConversation(ctx, userID, convID) {
+		return message, ENOTALLOWED
+	}
+	message, from, err := api.storedMessage(ctx, convID, msgID)
+	switch {
+	case err != nil:
+		return
+	case message.Deleted:
+		return message, NoSuchMessage
+	case from != userID || message.System:
+		return message, ENOTALLOWED
+	case time.Since(message.Time) > api.Config.Messages.EditWindow():
+		return message, EditWindowClosed
+	}
+	return message, nil
+}
+
+//unchanged explains why the store didn't change message msgID after changeableMessage said it could: it was deleted, or its window closed, in the meantime.
+func (api *API) unchanged(ctx context.Context, convID gp.ConversationID, msgID gp.MessageID) error {
+	message, _, err := api.storedMessage(ctx, convID, msgID)
+	switch {
+	case err != nil && err != NoSuchMessage:
+		return err
+	case err == NoSuchMessage || message.Deleted:
+		return NoSuchMessage
+	default:
+		return EditWindowClosed
+	}
+}
+
+//publishMessageChange tells everyone in convID that message has changed.
+func (api *API) publishMessageChange(ctx context.Context, etype string, convID gp.ConversationID, message gp.Message) (participants []gp.UserPresence) {
+	participants, err := api.getParticipants(ctx, convID, false)
+	if err != nil {
+		log.Println("Error getting participants; didn't broadcast event to websockets")
+		return
+	}
+	api.broker.PublishEvent(etype, conversationURI(convID), message, ConversationChannelKeys(participants))
+	return
+}
+
+//EditMessage replaces the text of one of userID's messages, keeping what it said before in its history. Only the sender can edit a message, and only within the configured edit window.
+func (api *API) EditMessage(ctx context.Context, userID gp.UserID, convID gp.ConversationID, msgID gp.MessageID, text string) (message gp.Message, err error) {
+	if strings.TrimSpace(text) == "" {
+		return message, EmptyMessage
+	}
+	message, err = api.changeableMessage(ctx, userID, convID, msgID)
+	if err != nil {
+		return
+	}
+	edited, err := api.store.Conversations.EditMessage(ctx, convID, msgID, userID, text, api.Config.Messages.EditWindow())
+	if err != nil {
+		return
+	}
+	if !edited {
+		return message, api.unchanged(ctx, convID, msgID)
+	}
+	now := time.Now().UTC()
+	message.Text = text
+	message.Edited = &now
+	api.publishMessageChange(ctx, events.MessageEdited, convID, message)
+	go api.spotFiles(message)
+	go api.esIndexMessage(message, convID)
+	return message, nil
+}
+
+//DeleteMessage retracts one of userID's messages, leaving a tombstone in its place. Its text, its history and any files it shared are gone for good.
+//Only the sender can delete a message, and only within the configured edit window.
+func (api *API) DeleteMessage(ctx context.Context, userID gp.UserID, convID gp.ConversationID, msgID gp.MessageID) (err error) {
+	message, err := api.changeableMessage(ctx, userID, convID, msgID)
+	if err != nil {
+		return
+	}
+	deleted, err := api.store.Conversations.DeleteMessage(ctx, convID, msgID, userID, api.Config.Messages.EditWindow())
+	if err != nil {
+		return
+	}
+	if !deleted {
+		return api.unchanged(ctx, convID, msgID)
+	}
+	message.Text = ""
+	message.Edited = nil
+	message.Deleted = true
+	//A deleted message might have been unread.
+	participants := api.publishMessageChange(ctx, events.MessageDeleted, convID, message)
+	api.participantsBadgeChanged(participants, userID)
+	go api.esDeleteMessage(msgID)
+	return nil
+}
+
+//MessageHistory returns what message msgID said before each of its edits, most recent first.
+func (api *API) MessageHistory(ctx context.Context, userID gp.UserID, convID gp.ConversationID, msgID gp.MessageID) (edits []gp.MessageEdit, err error) {
+	edits = make([]gp.MessageEdit, 0)
+	if !api.userCanViewConversation(ctx, userID, convID) {
+		return edits, ENOTALLOWED
+	}
+	message, _, err := api.storedMessage(ctx, convID, msgID)
+	switch {
+	case err != nil:
+		return
+	case message.Deleted:
+		return edits, NoSuchMessage
+	}
+	history, err := api.store.Conversations.MessageHistory(ctx, msgID)
+	if err != nil {
+		return
+	}
+	return append(edits, history...), nil
+}
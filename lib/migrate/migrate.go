@@ -0,0 +1,250 @@
+//Package migrate applies the schema migrations in db/migrations. It keeps track of them in goose's goose_db_version table, so databases which were migrated by hand with goose carry straight on.
+//
+//Each migration registers itself from its own file, which is named for its version (eg 20161017200000_email-digests.go).
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//mysqlTime is how goose's tstamp column comes back when it's scanned as a string.
+const mysqlTime = "2006-01-02 15:04:05"
+
+//Migration is one schema change. Up applies it and Down undoes it; as with goose, either signals failure by rolling txn back.
+type Migration struct {
+	Version int64
+	Name    string //The name of its file.
+	Up      func(txn *sql.Tx)
+	Down    func(txn *sql.Tx)
+}
+
+var (
+	mu         sync.Mutex
+	migrations = make(map[int64]Migration)
+)
+
+//Register adds a migration. Call it from an init in the migration's own file, whose name starts with the migration's version.
+func Register(up, down func(txn *sql.Tx)) {
+	_, file, _, ok := runtime.Caller(1)
+	name := filepath.Base(file)
+	version, err := strconv.ParseInt(strings.SplitN(name, "_", 2)[0], 10, 64)
+	if !ok || err != nil {
+		panic("migrate: can't tell the version of " + file)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if existing, dup := migrations[version]; dup {
+		panic(fmt.Sprintf("migrate: %s and %s have the same version", existing.Name, name))
+	}
+	migrations[version] = Migration{Version: version, Name: name, Up: up, Down: down}
+}
+
+//Migrations lists every registered migration, oldest first.
+func Migrations() (all []Migration) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, m := range migrations {
+		all = append(all, m)
+	}
+	sort.Sort(byVersion(all))
+	return
+}
+
+type byVersion []Migration
+
+func (v byVersion) Len() int           { return len(v) }
+func (v byVersion) Less(i, j int) bool { return v[i].Version < v[j].Version }
+func (v byVersion) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+
+//Latest is the newest migration's version, which is what this build expects the database to be at.
+func Latest() (version int64) {
+	all := Migrations()
+	if len(all) > 0 {
+		version = all[len(all)-1].Version
+	}
+	return
+}
+
+//VersionMismatch is returned by Check when the database isn't at the version this build expects.
+type VersionMismatch struct {
+	Current  int64
+	Expected int64
+}
+
+func (v VersionMismatch) Error() string {
+	if v.Current < v.Expected {
+		return fmt.Sprintf("migrate: the database is at version %d, but this build expects %d; run `gleepost migrate up`", v.Current, v.Expected)
+	}
+	return fmt.Sprintf("migrate: the database is at version %d, which is newer than this build's %d", v.Current, v.Expected)
+}
+
+//Check returns a VersionMismatch if db isn't at the Latest version.
+func Check(db *sql.DB) (err error) {
+	current, err := Current(db)
+	if err != nil {
+		return
+	}
+	if latest := Latest(); current != latest {
+		return VersionMismatch{Current: current, Expected: latest}
+	}
+	return nil
+}
+
+//versionRow is one row of goose_db_version: a migration being applied, or rolled back.
+type versionRow struct {
+	version int64
+	applied bool
+}
+
+//currentVersion works out the schema version from goose_db_version's rows, newest first, the same way goose does: it's the newest version which was applied and hasn't been rolled back since.
+func currentVersion(rows []versionRow) int64 {
+	rolledBack := make(map[int64]bool)
+	for _, row := range rows {
+		switch {
+		case rolledBack[row.version]:
+		case row.applied:
+			return row.version
+		default:
+			rolledBack[row.version] = true
+		}
+	}
+	return 0
+}
+
+//Current returns the version db's schema is at.
+func Current(db *sql.DB) (version int64, err error) {
+	rows, err := db.Query("SELECT version_id, is_applied FROM goose_db_version ORDER BY id DESC")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	var history []versionRow
+	for rows.Next() {
+		var row versionRow
+		if err = rows.Scan(&row.version, &row.applied); err != nil {
+			return
+		}
+		history = append(history, row)
+	}
+	return currentVersion(history), rows.Err()
+}
+
+//ensureTable creates goose_db_version, at version 0, if db doesn't have it yet.
+func ensureTable(db *sql.DB) (err error) {
+	var name string
+	err = db.QueryRow("SHOW TABLES LIKE 'goose_db_version'").Scan(&name)
+	if err != sql.ErrNoRows {
+		return
+	}
+	q := "CREATE TABLE goose_db_version ( "
+	q += "id serial NOT NULL, "
+	q += "version_id bigint NOT NULL, "
+	q += "is_applied boolean NOT NULL, "
+	q += "tstamp timestamp NULL default now(), "
+	q += "PRIMARY KEY(id) )"
+	if _, err = db.Exec(q); err != nil {
+		return
+	}
+	_, err = db.Exec("INSERT INTO goose_db_version (version_id, is_applied) VALUES (0, 1)")
+	return
+}
+
+//Up applies every migration newer than db's current version, oldest first, stopping at the first one which fails.
+func Up(db *sql.DB) (err error) {
+	if err = ensureTable(db); err != nil {
+		return
+	}
+	current, err := Current(db)
+	if err != nil {
+		return
+	}
+	for _, m := range Migrations() {
+		if m.Version <= current {
+			continue
+		}
+		if err = run(db, m, true); err != nil {
+			return
+		}
+	}
+	return nil
+}
+
+//Down rolls back the migration db is currently at.
+func Down(db *sql.DB) (err error) {
+	if err = ensureTable(db); err != nil {
+		return
+	}
+	current, err := Current(db)
+	switch {
+	case err != nil:
+		return
+	case current == 0:
+		return fmt.Errorf("migrate: there's nothing to roll back")
+	}
+	mu.Lock()
+	m, ok := migrations[current]
+	mu.Unlock()
+	if !ok {
+		return fmt.Errorf("migrate: the database is at version %d, which this build doesn't have", current)
+	}
+	return run(db, m, false)
+}
+
+//run applies (or rolls back) m in a transaction. As with goose, the version is recorded in the same transaction, so recording it fails if the migration rolled itself back.
+func run(db *sql.DB, m Migration, up bool) (err error) {
+	txn, err := db.Begin()
+	if err != nil {
+		return
+	}
+	if up {
+		log.Println("Applying", m.Name)
+		m.Up(txn)
+	} else {
+		log.Println("Rolling back", m.Name)
+		m.Down(txn)
+	}
+	_, err = txn.Exec("INSERT INTO goose_db_version (version_id, is_applied) VALUES (?, ?)", m.Version, up)
+	if err != nil {
+		txn.Rollback()
+		return fmt.Errorf("migrate: %s failed: %v", m.Name, err)
+	}
+	return txn.Commit()
+}
+
+//Status is whether one migration has been applied.
+type Status struct {
+	Migration
+	Applied bool
+	At      time.Time //When it was last applied or rolled back; zero if it never has been.
+}
+
+//Statuses lists every migration, oldest first, and whether it's applied to db.
+func Statuses(db *sql.DB) (statuses []Status, err error) {
+	if err = ensureTable(db); err != nil {
+		return
+	}
+	for _, m := range Migrations() {
+		status := Status{Migration: m}
+		var t sql.NullString
+		err = db.QueryRow("SELECT is_applied, tstamp FROM goose_db_version WHERE version_id = ? ORDER BY id DESC LIMIT 1", m.Version).Scan(&status.Applied, &t)
+		switch {
+		case err == sql.ErrNoRows:
+			err = nil
+		case err != nil:
+			return
+		case t.Valid:
+			status.At, _ = time.Parse(mysqlTime, t.String)
+		}
+		statuses = append(statuses, status)
+	}
+	return
+}
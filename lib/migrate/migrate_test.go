@@ -0,0 +1,48 @@
+package migrate
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestCurrentVersion(t *testing.T) {
+	tests := []struct {
+		rows    []versionRow
+		current int64
+	}{
+		{nil, 0},
+		{[]versionRow{{0, true}}, 0},
+		{[]versionRow{{3, true}, {2, true}, {1, true}, {0, true}}, 3},
+		//3 was rolled back, so we're at 2.
+		{[]versionRow{{3, false}, {3, true}, {2, true}, {0, true}}, 2},
+		//2 was rolled back and then applied again.
+		{[]versionRow{{2, true}, {2, false}, {2, true}, {1, true}}, 2},
+		//Everything was rolled back.
+		{[]versionRow{{1, false}, {2, false}, {2, true}, {1, true}, {0, true}}, 0},
+	}
+	for _, test := range tests {
+		if current := currentVersion(test.rows); current != test.current {
+			t.Errorf("Expected version %d from %v, got %d", test.current, test.rows, current)
+		}
+	}
+}
+
+func TestRegisterNeedsVersionedFile(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected a migration registered from migrate_test.go to panic")
+		}
+		if len(Migrations()) != 0 || Latest() != 0 {
+			t.Fatal("The migration was registered anyway")
+		}
+	}()
+	Register(func(*sql.Tx) {}, func(*sql.Tx) {})
+}
+
+func TestVersionMismatch(t *testing.T) {
+	behind := VersionMismatch{Current: 20150302154058, Expected: 20161017200000}
+	ahead := VersionMismatch{Current: 20161017200000, Expected: 20150302154058}
+	if behind.Error() == ahead.Error() {
+		t.Fatal("Being behind and being ahead should be told apart")
+	}
+}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -10,7 +11,7 @@ import (
 var ErrInvalidInput = errors.New("Invalid input")
 
 //ContactFormRequest records a request for contact and emails it out to someone.
-func (api *API) ContactFormRequest(fullName, college, email, phoneNo, ip string) (err error) {
+func (api *API) ContactFormRequest(ctx context.Context, fullName, college, email, phoneNo, ip string) (err error) {
 	log.Println("Contact form request from:", ip, "email:", email)
 	if len(fullName) < 3 || len(college) < 3 || len(phoneNo) < 6 {
 		return ErrInvalidInput
@@ -18,7 +19,7 @@ func (api *API) ContactFormRequest(fullName, college, email, phoneNo, ip string)
 	if !looksLikeEmail(email) {
 		return InvalidEmail
 	}
-	err = api.contactFormRequest(fullName, college, email, phoneNo)
+	err = api.contactFormRequest(ctx, fullName, college, email, phoneNo)
 	if err != nil {
 		return
 	}
@@ -36,12 +37,12 @@ func (api *API) ChasenRequest(where, when string) (err error) {
 }
 
 //ContactFormRequest records a request for contact in the db.
-func (api *API) contactFormRequest(fullName, college, email, phoneNo string) (err error) {
+func (api *API) contactFormRequest(ctx context.Context, fullName, college, email, phoneNo string) (err error) {
 	q := "INSERT INTO contact_requests(full_name, college, email, phone_no) VALUES (?, ?, ?, ?)"
 	s, err := api.sc.Prepare(q)
 	if err != nil {
 		return
 	}
-	_, err = s.Exec(fullName, college, email, phoneNo)
+	_, err = s.ExecContext(ctx, fullName, college, email, phoneNo)
 	return
 }
@@ -1,14 +1,14 @@
 package lib
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"strings"
 	"time"
 
 	"github.com/Petergatsby/GleepostAPI/lib/gp"
-	"github.com/Petergatsby/GleepostAPI/lib/psc"
-	"github.com/go-sql-driver/mysql"
+	"github.com/Petergatsby/GleepostAPI/lib/store"
 )
 
 //ENoRole is given when you try to specify a role which doesn't exist.
@@ -36,41 +36,41 @@ var levels = map[string]int{
 }
 
 //UserGetUserGroups is the same as GetUserNetworks, except it omits "official" networks (ie, universities)
-func (api *API) UserGetUserGroups(perspective, user gp.UserID, index int64, count int, ordering int) (groups []gp.GroupSubjective, err error) {
+func (api *API) UserGetUserGroups(ctx context.Context, perspective, user gp.UserID, index int64, count int, ordering int) (groups []gp.GroupSubjective, err error) {
 	if count <= 0 || count > 100 {
 		count = api.Config.GroupPageSize
 	}
 	groups = make([]gp.GroupSubjective, 0)
 	switch {
 	case perspective == user:
-		groups, err = api.groupsByActivity(user, index, count, ordering)
+		groups, err = api.groupsByActivity(ctx, user, index, count, ordering)
 		return
 	default:
-		shared, err := api.sameUniversity(perspective, user)
+		shared, err := api.sameUniversity(ctx, perspective, user)
 		switch {
 		case err != nil:
 			return groups, err
 		case !shared:
 			return groups, &ENOTALLOWED
 		default:
-			return api.subjectiveMemberships(perspective, user, index, count)
+			return api.subjectiveMemberships(ctx, perspective, user, index, count)
 		}
 	}
 }
 
 //UserAddToGroup adds these gleepost users to this group (if you're allowed) and invites the rest via facebook / email.
-func (api *API) UserAddToGroup(adder gp.UserID, group gp.NetworkID, addees []gp.UserID, fbinvites []uint64, emailInvites []string) (err error) {
+func (api *API) UserAddToGroup(ctx context.Context, adder gp.UserID, group gp.NetworkID, addees []gp.UserID, fbinvites []uint64, emailInvites []string) (err error) {
 	added := false
 	if len(addees) > 0 {
 		added = true
-		_, err = api.UserAddUsersToGroup(adder, addees, group)
+		_, err = api.UserAddUsersToGroup(ctx, adder, addees, group)
 		if err != nil {
 			return
 		}
 	}
 	if len(fbinvites) > 0 {
 		added = true
-		_, err = api.UserAddFBUsersToGroup(adder, fbinvites, group)
+		_, err = api.UserAddFBUsersToGroup(ctx, adder, fbinvites, group)
 		if err != nil {
 			return
 		}
@@ -78,7 +78,7 @@ func (api *API) UserAddToGroup(adder gp.UserID, group gp.NetworkID, addees []gp.
 	if len(emailInvites) > 0 {
 		added = true
 		for _, email := range emailInvites {
-			err = api.UserInviteEmail(adder, group, email)
+			err = api.UserInviteEmail(ctx, adder, group, email)
 			if err != nil {
 				return
 			}
@@ -91,12 +91,12 @@ func (api *API) UserAddToGroup(adder gp.UserID, group gp.NetworkID, addees []gp.
 }
 
 //UserAddUsersToGroup adds all addees to the group until the first error.
-func (api *API) UserAddUsersToGroup(adder gp.UserID, addees []gp.UserID, group gp.NetworkID) (count int, err error) {
+func (api *API) UserAddUsersToGroup(ctx context.Context, adder gp.UserID, addees []gp.UserID, group gp.NetworkID) (count int, err error) {
 	for _, addee := range addees {
 		if adder == addee {
-			err = api.UserJoinGroup(adder, group)
+			err = api.UserJoinGroup(ctx, adder, group)
 		} else {
-			err = api.UserAddUserToGroup(adder, addee, group)
+			err = api.UserAddUserToGroup(ctx, adder, addee, group)
 		}
 		if err == nil {
 			count++
@@ -108,21 +108,21 @@ func (api *API) UserAddUsersToGroup(adder gp.UserID, addees []gp.UserID, group g
 }
 
 //UserChangeRole marks recipient with a new role in this network, if actor is allowed to give it. Valid roles are currently "member" or "administrator".
-func (api *API) UserChangeRole(actor, recipient gp.UserID, network gp.NetworkID, role string) (err error) {
+func (api *API) UserChangeRole(ctx context.Context, actor, recipient gp.UserID, network gp.NetworkID, role string) (err error) {
 	lev, ok := levels[role]
 	if !ok {
 		return ENoRole
 	}
 	//To start with, for simplicity: You can only add/remove roles less / equal to your own.
-	has, err := api.userHasRole(actor, network, role)
+	has, err := api.userHasRole(ctx, actor, network, role)
 	switch {
 	case err != nil:
 		return
 	case !has:
 		return &ENOTALLOWED
 	default:
-		otherRole, err := api.userRole(recipient, network)
-		myRole, err2 := api.userRole(actor, network)
+		otherRole, err := api.userRole(ctx, recipient, network)
+		myRole, err2 := api.userRole(ctx, actor, network)
 		switch {
 		case err != nil || err2 != nil:
 			return &ENOTALLOWED
@@ -130,18 +130,18 @@ func (api *API) UserChangeRole(actor, recipient gp.UserID, network gp.NetworkID,
 		case otherRole.Level > myRole.Level:
 			return &ENOTALLOWED
 		default:
-			return api.userSetRole(recipient, network, gp.Role{Name: role, Level: lev})
+			return api.userSetRole(ctx, recipient, network, gp.Role{Name: role, Level: lev})
 		}
 	}
 }
 
 //UserHasRole returns true if this user has at least this role (or greater) in this group.
-func (api *API) userHasRole(user gp.UserID, network gp.NetworkID, roleName string) (has bool, err error) {
+func (api *API) userHasRole(ctx context.Context, user gp.UserID, network gp.NetworkID, roleName string) (has bool, err error) {
 	lev, ok := levels[roleName]
 	if !ok {
 		return false, ENoRole
 	}
-	role, err := api.userRole(user, network)
+	role, err := api.userRole(ctx, user, network)
 	if err != nil {
 		if err == gp.ENOSUCHUSER {
 			err = nil
@@ -158,9 +158,9 @@ func (api *API) userHasRole(user gp.UserID, network gp.NetworkID, roleName strin
 //UserAddUserToGroup adds addee to group iff adder is in group and group is not a university network (we don't want people to be able to get into universities they're not part of)
 //TODO: Check addee exists
 //TODO: Suppress re-add push notification.
-func (api *API) UserAddUserToGroup(adder, addee gp.UserID, group gp.NetworkID) (err error) {
-	in, neterr := api.UserInNetwork(adder, group)
-	isgroup, grouperr := api.isGroup(group)
+func (api *API) UserAddUserToGroup(ctx context.Context, adder, addee gp.UserID, group gp.NetworkID) (err error) {
+	in, neterr := api.UserInNetwork(ctx, adder, group)
+	isgroup, grouperr := api.isGroup(ctx, group)
 	switch {
 	case neterr != nil:
 		return neterr
@@ -169,93 +169,93 @@ func (api *API) UserAddUserToGroup(adder, addee gp.UserID, group gp.NetworkID) (
 	case !in || !isgroup:
 		return &ENOTALLOWED
 	default:
-		err = api.setNetwork(addee, group)
+		err = api.setNetwork(ctx, addee, group)
 		switch {
 		case err == AlreadyMember:
 			err = nil
 		case err == nil:
 			api.notifObserver.Notify(addedGroupEvent{userID: adder, addeeID: addee, netID: group})
-			e := api.joinGroupConversation(addee, group)
+			e := api.joinGroupConversation(ctx, addee, group)
 			if e != nil {
 				log.Println("Error adding new group member to conversation:", e)
 			}
-			err = api.setRequestStatus(addee, group, "accepted", adder)
+			err = api.setRequestStatus(ctx, addee, group, "accepted", adder)
 			if err != nil {
 				log.Println(err)
 				return
 			}
-			api.esIndexGroup(group)
+			api.esIndexGroup(ctx, group)
 		}
 		return
 	}
 }
 
 //UserJoinGroup makes this user a member of the group iff the group's privacy is "public" and the group is visible to them (ie, within their university network)
-func (api *API) UserJoinGroup(userID gp.UserID, group gp.NetworkID) (err error) {
-	canJoin, err := api.userCanJoin(userID, group)
+func (api *API) UserJoinGroup(ctx context.Context, userID gp.UserID, group gp.NetworkID) (err error) {
+	canJoin, err := api.userCanJoin(ctx, userID, group)
 	switch {
 	case err != nil:
 		return
 	case canJoin:
-		err = api.setNetwork(userID, group)
+		err = api.setNetwork(ctx, userID, group)
 		if err != nil {
 			if err == AlreadyMember {
 				err = nil
 			}
 			return
 		}
-		err = api.joinGroupConversation(userID, group)
+		err = api.joinGroupConversation(ctx, userID, group)
 
-		api.esIndexGroup(group)
+		api.esIndexGroup(ctx, group)
 		return
 	default:
 		return &ENOTALLOWED
 	}
 }
 
-func (api *API) joinGroupConversation(userID gp.UserID, group gp.NetworkID) (err error) {
-	convID, err := api.groupConversation(group)
+func (api *API) joinGroupConversation(ctx context.Context, userID gp.UserID, group gp.NetworkID) (err error) {
+	convID, err := api.groupConversation(ctx, group)
 	if err != nil {
 		return
 	}
-	err = api.addConversationParticipant(userID, userID, convID)
+	err = api.addConversationParticipant(ctx, userID, userID, convID)
 	if err != nil {
 		if err == AlreadyParticipantErr {
 			err = nil
 		}
 		return
 	}
-	conv, err := api.GetConversation(userID, convID)
+	conv, err := api.GetConversation(ctx, userID, convID)
 	if err != nil {
 		return
 	}
 	go api.conversationChangedEvent(conv.Conversation)
-	api.addSystemMessage(convID, userID, group, "JOINED")
+	api.addSystemMessage(ctx, convID, userID, group, "JOINED")
 	return
 }
 
-func (api *API) groupAddConvParticipants(adder, addee gp.UserID, group gp.NetworkID) (err error) {
-	conv, err := api.groupConversation(group)
+func (api *API) groupAddConvParticipants(ctx context.Context, adder, addee gp.UserID, group gp.NetworkID) (err error) {
+	conv, err := api.groupConversation(ctx, group)
 	if err != nil {
 		return
 	}
-	_, err = api.UserAddParticipants(adder, conv, addee)
+	_, err = api.UserAddParticipants(ctx, adder, conv, addee)
 	return
 }
 
 //UserCanJoin returns true if the user is allowed to unilaterally join this network (ie, it is both "public" and a sub-network of one this user already belongs to.)
-func (api *API) userCanJoin(userID gp.UserID, netID gp.NetworkID) (public bool, err error) {
-	net, err := api.getNetwork(netID)
+func (api *API) userCanJoin(ctx context.Context, userID gp.UserID, netID gp.NetworkID) (public bool, err error) {
+	net, err := api.getNetwork(ctx, netID)
 	if err != nil {
 		log.Println("Error getting network:", err)
 		return
 	}
-	parent, err := api.networkParent(netID)
+	parent, err := api.networkParent(ctx, netID)
 	if err != nil {
 		log.Println("Error getting network parent:", err)
 		return
 	}
-	in, err := api.UserInNetwork(userID, parent)
+	in, err := api.UserInNetwork(ctx, userID, parent)
 	if err != nil {
 		log.Println("Error getting whether this user is in the network:", err)
 		return
@@ -266,14 +266,14 @@ func (api *API) userCanJoin(userID gp.UserID, netID gp.NetworkID) (public bool,
 	return false, nil
 }
 
-func (api *API) assignNetworks(user gp.UserID, email string) (networks int, err error) {
-	rules, e := api.getRules()
+func (api *API) assignNetworks(ctx context.Context, user gp.UserID, email string) (networks int, err error) {
+	rules, e := api.getRules(ctx)
 	if e != nil {
 		return 0, e
 	}
 	for _, rule := range rules {
 		if rule.Type == "email" && strings.HasSuffix(email, rule.Value) {
-			e := api.setNetwork(user, rule.NetworkID)
+			e := api.setNetwork(ctx, user, rule.NetworkID)
 			if e != nil {
 				return networks, e
 			}
@@ -284,30 +284,30 @@ func (api *API) assignNetworks(user gp.UserID, email string) (networks int, err
 }
 
 //UserGetNetwork returns the information about a network, if userID is a member of it; ENOTALLOWED otherwise.
-func (api *API) UserGetNetwork(userID gp.UserID, netID gp.NetworkID) (network gp.GroupSubjective, err error) {
-	in, err := api.UserInNetwork(userID, netID)
+func (api *API) UserGetNetwork(ctx context.Context, userID gp.UserID, netID gp.NetworkID) (network gp.GroupSubjective, err error) {
+	in, err := api.UserInNetwork(ctx, userID, netID)
 	switch {
 	case err != nil:
 		return
 	case !in:
 		return network, &ENOTALLOWED
 	default:
-		network.Group, err = api.getNetwork(netID)
+		network.Group, err = api.getNetwork(ctx, netID)
 		if err != nil {
 			return
 		}
-		network.UnreadCount, err = api.userConversationUnread(userID, network.Conversation)
+		network.UnreadCount, err = api.userConversationUnread(ctx, userID, network.Conversation)
 		if err != nil {
 			log.Println(err)
 			return
 		}
 		var role gp.Role
-		role, err = api.userRole(userID, netID)
+		role, err = api.userRole(ctx, userID, netID)
 		if err == nil {
 			network.YourRole = &role
 			//LastActivity
 			var lastActivity time.Time
-			lastActivity, err = api.networkLastActivity(userID, netID)
+			lastActivity, err = api.networkLastActivity(ctx, userID, netID)
 			switch {
 			case err != nil:
 				log.Println("last activity error:", err)
@@ -315,12 +315,12 @@ func (api *API) UserGetNetwork(userID gp.UserID, netID gp.NetworkID) (network gp
 				network.LastActivity = &lastActivity
 			default:
 			}
-			network.NewPosts, err = api.groupNewPosts(userID, netID)
+			network.NewPosts, err = api.groupNewPosts(ctx, userID, netID)
 			if err != nil {
 				return
 			}
 		} else {
-			status, err := api.pendingRequestExists(userID, netID)
+			status, err := api.pendingRequestExists(ctx, userID, netID)
 			if err == nil && (status == "pending" || status == "rejected") {
 				network.PendingRequest = true
 			}
@@ -342,8 +342,8 @@ func validateCategory(cat string) string {
 }
 
 //CreateGroup creates a group and adds the creator as a member.
-func (api *API) CreateGroup(userID gp.UserID, name, url, desc, privacy, category string) (network gp.Group, err error) {
-	exists, eupload := api.userUploadExists(userID, url)
+func (api *API) CreateGroup(ctx context.Context, userID gp.UserID, name, url, desc, privacy, category string) (network gp.Group, err error) {
+	exists, eupload := api.userUploadExists(ctx, userID, url)
 	switch {
 	case eupload != nil:
 		return network, eupload
@@ -351,7 +351,7 @@ func (api *API) CreateGroup(userID gp.UserID, name, url, desc, privacy, category
 		return network, &ENOTALLOWED
 	default:
 		var primary gp.GroupSubjective
-		primary, err = api.getUserUniversity(userID)
+		primary, err = api.getUserUniversity(ctx, userID)
 		if err != nil {
 			return
 		}
@@ -361,51 +361,46 @@ func (api *API) CreateGroup(userID gp.UserID, name, url, desc, privacy, category
 		}
 
 		category = validateCategory(category)
-		network, err = api.createNetwork(name, primary.ID, url, desc, userID, true, privacy, category)
+		network, err = api.createNetwork(ctx, name, primary.ID, url, desc, userID, true, privacy, category)
 		if err != nil {
 			return
 		}
-		err = api.setNetwork(userID, network.ID)
+		err = api.setNetwork(ctx, userID, network.ID)
 		if err != nil {
 			return
 		}
-		err = api.userSetRole(userID, network.ID, gp.Role{Name: "creator", Level: 9})
+		err = api.userSetRole(ctx, userID, network.ID, gp.Role{Name: "creator", Level: 9})
 		if err != nil {
 			return
 		}
 		var user gp.User
-		user, err = api.users.byID(userID)
+		user, err = api.users.byID(ctx, userID)
 		if err != nil {
 			return
 		}
 		var conversation gp.Conversation
-		conversation, err = api.createConversation(userID, []gp.User{user}, false, network.ID)
+		conversation, err = api.createConversation(ctx, userID, []gp.User{user}, false, network.ID)
 		if err == nil {
 			network.Conversation = conversation.ID
 		} else {
 			log.Println(err)
 		}
-		api.esIndexGroup(network.ID)
+		api.esIndexGroup(ctx, network.ID)
 		return
 	}
 }
 
-func (api *API) shareNetwork(a, b gp.UserID) (shared bool, err error) {
-	s, err := api.sc.Prepare("SELECT COUNT(*) > 0 FROM user_network WHERE user_id = ? AND network_id IN (SELECT network_id FROM user_network WHERE user_id = ?)")
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(a, b).Scan(&shared)
-	return
+func (api *API) shareNetwork(ctx context.Context, a, b gp.UserID) (shared bool, err error) {
+	return api.store.Networks.Shared(ctx, a, b)
 }
 
 //sameUniversity returns true if both users a and b are in the same university.
-func (api *API) sameUniversity(a, b gp.UserID) (shared bool, err error) {
-	unia, err := api.getUserUniversity(a)
+func (api *API) sameUniversity(ctx context.Context, a, b gp.UserID) (shared bool, err error) {
+	unia, err := api.getUserUniversity(ctx, a)
 	if err != nil {
 		return
 	}
-	unib, err := api.getUserUniversity(b)
+	unib, err := api.getUserUniversity(ctx, b)
 	if err != nil {
 		return
 	}
@@ -413,10 +408,10 @@ func (api *API) sameUniversity(a, b gp.UserID) (shared bool, err error) {
 }
 
 //UserGetGroupAdmins returns all the admins of the group, or ENOTALLOWED if the requesting user isn't in that group.
-func (api *API) UserGetGroupAdmins(userID gp.UserID, netID gp.NetworkID) (users []gp.UserRole, err error) {
+func (api *API) UserGetGroupAdmins(ctx context.Context, userID gp.UserID, netID gp.NetworkID) (users []gp.UserRole, err error) {
 	users = make([]gp.UserRole, 0)
-	in, errin := api.UserInNetwork(userID, netID)
-	group, errgroup := api.isGroup(netID)
+	in, errin := api.UserInNetwork(ctx, userID, netID)
+	group, errgroup := api.isGroup(ctx, netID)
 	switch {
 	case errin != nil:
 		return users, errin
@@ -425,19 +420,19 @@ func (api *API) UserGetGroupAdmins(userID gp.UserID, netID gp.NetworkID) (users
 	case !in || !group:
 		return users, &ENOTALLOWED
 	default:
-		return api.nm.getNetworkAdmins(netID)
+		return api.nm.getNetworkAdmins(ctx, netID)
 	}
 }
 
 //UserGetGroupMembers returns all the users in the group, or ENOTALLOWED if the user isn't in that group.
-func (api *API) UserGetGroupMembers(userID gp.UserID, netID gp.NetworkID) (users []gp.UserRole, err error) {
+func (api *API) UserGetGroupMembers(ctx context.Context, userID gp.UserID, netID gp.NetworkID) (users []gp.UserRole, err error) {
 	users = make([]gp.UserRole, 0)
-	in, errin := api.UserInNetwork(userID, netID)
-	group, errgroup := api.isGroup(netID)
-	CanJoin, errJoin := api.userCanJoin(userID, netID)
+	in, errin := api.UserInNetwork(ctx, userID, netID)
+	group, errgroup := api.isGroup(ctx, netID)
+	CanJoin, errJoin := api.userCanJoin(ctx, userID, netID)
 	switch {
 	case errJoin == nil && CanJoin:
-		return getNetworkUsers(api.sc, netID)
+		return getNetworkUsers(ctx, api.store.Networks, netID)
 	case errin != nil:
 		return users, errin
 	case errgroup != nil:
@@ -445,27 +440,27 @@ func (api *API) UserGetGroupMembers(userID gp.UserID, netID gp.NetworkID) (users
 	case !in || !group:
 		return users, &ENOTALLOWED
 	default:
-		return getNetworkUsers(api.sc, netID)
+		return getNetworkUsers(ctx, api.store.Networks, netID)
 	}
 }
 
 //UserLeaveGroup removes userId from group netId. If attempted on an official group it will give ENOTALLOWED (you can't leave your university...) but otherwise should always succeed.
-func (api *API) UserLeaveGroup(userID gp.UserID, netID gp.NetworkID) (err error) {
-	group, err := api.isGroup(netID)
+func (api *API) UserLeaveGroup(ctx context.Context, userID gp.UserID, netID gp.NetworkID) (err error) {
+	group, err := api.isGroup(ctx, netID)
 	switch {
 	case err != nil:
 		return
 	case !group:
 		return &ENOTALLOWED
 	default:
-		err = api.leaveNetwork(userID, netID)
+		err = api.leaveNetwork(ctx, userID, netID)
 		if err == nil {
-			convID, e := api.groupConversation(netID)
+			convID, e := api.groupConversation(ctx, netID)
 			if e != nil {
 				log.Println(e)
 				return
 			}
-			go api.UserDeleteConversation(userID, convID)
+			go api.UserDeleteConversation(context.Background(), userID, convID)
 		}
 		return
 	}
@@ -473,9 +468,9 @@ func (api *API) UserLeaveGroup(userID gp.UserID, netID gp.NetworkID) (err error)
 
 //UserInviteEmail sends a group invite from userID to email, or err if something went wrong.
 //If someone has already signed up with email, it just adds them to the group directly.
-func (api *API) UserInviteEmail(userID gp.UserID, netID gp.NetworkID, email string) (err error) {
-	in, neterr := api.UserInNetwork(userID, netID)
-	isgroup, grouperr := api.isGroup(netID)
+func (api *API) UserInviteEmail(ctx context.Context, userID gp.UserID, netID gp.NetworkID, email string) (err error) {
+	in, neterr := api.UserInNetwork(ctx, userID, netID)
+	isgroup, grouperr := api.isGroup(ctx, netID)
 	switch {
 	case neterr != nil:
 		return neterr
@@ -485,9 +480,9 @@ func (api *API) UserInviteEmail(userID gp.UserID, netID gp.NetworkID, email stri
 		return &ENOTALLOWED
 	default:
 		//If the user already exists, add them straight into the group and don't email them.
-		invitee, e := api.userWithEmail(email)
+		invitee, e := api.userWithEmail(ctx, email)
 		if e == nil {
-			err = api.setNetwork(invitee, netID)
+			err = api.setNetwork(ctx, invitee, netID)
 			if err == AlreadyMember {
 				err = nil
 			}
@@ -497,7 +492,7 @@ func (api *API) UserInviteEmail(userID gp.UserID, netID gp.NetworkID, email stri
 		if e != nil {
 			return e
 		}
-		err = api.createInvite(userID, netID, email, token)
+		err = api.createInvite(ctx, userID, netID, email, token)
 		if err != nil {
 			return
 		}
@@ -507,15 +502,15 @@ func (api *API) UserInviteEmail(userID gp.UserID, netID gp.NetworkID, email stri
 }
 
 //UserIsNetworkOwner returns true if userID created netID, and err if the database is down.
-func (api *API) userIsNetworkOwner(userID gp.UserID, netID gp.NetworkID) (owner bool, err error) {
-	creator, err := api.nm.networkCreator(netID)
+func (api *API) userIsNetworkOwner(ctx context.Context, userID gp.UserID, netID gp.NetworkID) (owner bool, err error) {
+	creator, err := api.nm.networkCreator(ctx, netID)
 	return (creator == userID), err
 }
 
 //UserSetNetworkImage sets the network's cover image to url, if userId is allowed to do so (currently, if they are the group's creator) or returns ENOTALLOWED otherwise.
-func (api *API) UserSetNetworkImage(userID gp.UserID, netID gp.NetworkID, url string) (err error) {
-	exists, eupload := api.userUploadExists(userID, url)
-	owner, eowner := api.userIsNetworkOwner(userID, netID)
+func (api *API) UserSetNetworkImage(ctx context.Context, userID gp.UserID, netID gp.NetworkID, url string) (err error) {
+	exists, eupload := api.userUploadExists(ctx, userID, url)
+	owner, eowner := api.userIsNetworkOwner(ctx, userID, netID)
 	switch {
 	case eowner != nil:
 		return eowner
@@ -527,69 +522,63 @@ func (api *API) UserSetNetworkImage(userID gp.UserID, netID gp.NetworkID, url st
 		//TODO: Return a different error
 		return &ENOTALLOWED
 	default:
-		return api.setNetworkImage(netID, url)
+		return api.setNetworkImage(ctx, netID, url)
 	}
 }
 
 //AdminCreateUniversity creates a new university with this name, accepting users registered with emails in these domains.
-func (api *API) AdminCreateUniversity(userID gp.UserID, name string, domains ...string) (university gp.Network, err error) {
-	admin := api.isAdmin(userID)
+func (api *API) AdminCreateUniversity(ctx context.Context, userID gp.UserID, name string, domains ...string) (university gp.Network, err error) {
+	admin := api.isAdmin(ctx, userID)
 	if !admin {
 		err = ENOTALLOWED
 		return
 	}
-	university, err = api.createUniversity(name)
+	university, err = api.createUniversity(ctx, name)
 	if err != nil {
 		return
 	}
-	err = api.addNetworkRules(university.ID, domains...)
+	err = api.addNetworkRules(ctx, university.ID, domains...)
 	return
 }
 
 //GetUserUniversity returns this user's primary network (ie, their university)
-func (api *API) getUserUniversity(id gp.UserID) (network gp.GroupSubjective, err error) {
-	s, err := api.sc.Prepare("SELECT user_network.network_id, network.name, user_network.role, user_network.role_level, network.cover_img, network.`desc`, network.creator, network.privacy, network.category FROM user_network JOIN network ON user_network.network_id = network.id WHERE user_network.user_id = ? AND network.is_university = 1 ")
+func (api *API) getUserUniversity(ctx context.Context, id gp.UserID) (network gp.GroupSubjective, err error) {
+	m, err := api.store.Networks.University(ctx, id)
 	if err != nil {
 		return
 	}
-	var img, desc, privacy, category sql.NullString
-	var creator sql.NullInt64
-	var role gp.Role
-	err = s.QueryRow(id).Scan(&network.ID, &network.Group.Network.Name, &role.Name, &role.Level, &img, &desc, &creator, &privacy, &category)
-	if img.Valid {
-		network.Image = img.String
-	}
-	if desc.Valid {
-		network.Desc = desc.String
-	}
-	if category.Valid {
-		network.Category = category.String
+	network.Group = api.group(ctx, m.StoredNetwork)
+	if m.Creator != 0 {
+		network.MemberCount, _ = api.groupMemberCount(ctx, network.ID)
+		//TODO(patrick) - maybe don't display group conversation id if you're not a member.
+		network.Conversation, _ = api.groupConversation(ctx, network.ID)
+		network.UnreadCount, _ = api.userConversationUnread(ctx, id, network.Conversation)
 	}
-	if creator.Valid {
-		u, err := api.users.byID(gp.UserID(creator.Int64))
+	role := m.Role
+	network.TheirRole = &role
+	return
+}
+
+//group fills in a gp.Group from the store; universities have no creator.
+func (api *API) group(ctx context.Context, n store.StoredNetwork) (group gp.Group) {
+	group.ID = n.ID
+	group.Name = n.Name
+	group.Image = n.Image
+	group.Desc = n.Desc
+	group.Privacy = n.Privacy
+	group.Category = n.Category
+	if n.Creator != 0 {
+		u, err := api.users.byID(ctx, n.Creator)
 		if err == nil {
-			network.Creator = &u
+			group.Creator = &u
 		}
-		network.MemberCount, _ = api.groupMemberCount(network.ID)
-		//TODO(patrick) - maybe don't display group conversation id if you're not a member.
-		network.Conversation, _ = api.groupConversation(network.ID)
-		network.UnreadCount, _ = api.userConversationUnread(id, network.Conversation)
 	}
-	if privacy.Valid {
-		network.Privacy = privacy.String
-	}
-	network.TheirRole = &role
 	return
 }
 
 //MasterGroup returns the id of the group which administrates this network, or NoSuchGroup if there is none.
-func (api *API) masterGroup(netID gp.NetworkID) (master gp.NetworkID, err error) {
-	q := "SELECT master_group FROM network WHERE id = ? AND master_group IS NOT NULL"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(netID).Scan(&master)
+func (api *API) masterGroup(ctx context.Context, netID gp.NetworkID) (master gp.NetworkID, err error) {
+	master, err = api.store.Networks.MasterGroup(ctx, netID)
 	if err == sql.ErrNoRows {
 		err = NoSuchGroup
 	}
@@ -597,351 +586,160 @@ func (api *API) masterGroup(netID gp.NetworkID) (master gp.NetworkID, err error)
 }
 
 //GetRules returns all the network matching rules for every network.
-func (api *API) getRules() (rules []gp.Rule, err error) {
+func (api *API) getRules(ctx context.Context) (rules []gp.Rule, err error) {
 	defer api.Statsd.Time(time.Now(), "gleepost.getRules.db")
-	ruleSelect := "SELECT network_id, rule_type, rule_value FROM net_rules"
-	s, err := api.sc.Prepare(ruleSelect)
-	if err != nil {
-		return
-	}
-	rows, err := s.Query()
-	if err != nil {
-		return
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var rule gp.Rule
-		if err = rows.Scan(&rule.NetworkID, &rule.Type, &rule.Value); err != nil {
-			return
-		}
-		rules = append(rules, rule)
-	}
-	return
+	return api.store.Networks.Rules(ctx)
+}
+
+//networkRules returns the rules for this network and its sub-networks.
+func (api *API) networkRules(ctx context.Context, netID gp.NetworkID) (rules []gp.Rule, err error) {
+	return api.store.Networks.NetworkRules(ctx, netID)
 }
 
 //The available ways to order your own groups
 const (
-	ByPosts = iota
-	ByMessages
-	ByActivity
+	ByPosts    = store.ByPosts
+	ByMessages = store.ByMessages
+	ByActivity = store.ByActivity
 )
 
-var byActivity = "SELECT user_network.network_id, user_network.role, " +
-	"user_network.role_level, network.name, " +
-	"network.cover_img, network.`desc`, network.creator, network.privacy, network.category, " +
-	"GREATEST( " +
-	"COALESCE((SELECT MAX(`timestamp`) FROM chat_messages WHERE conversation_id = conversations.id), '0000-00-00 00:00:00'), " +
-	"COALESCE((SELECT MAX(`time`) FROM wall_posts WHERE network_id = user_network.network_id), '0000-00-00 00:00:00') " +
-	") AS last_activity " +
-	"FROM user_network " +
-	"INNER JOIN network ON user_network.network_id = network.id " +
-	"JOIN conversations ON conversations.group_id = network.id " +
-	"WHERE user_id = ? " +
-	"AND network.user_group = 1 " +
-	"ORDER BY last_activity DESC LIMIT ?, ?"
-
-var byMessages = "SELECT user_network.network_id, user_network.role, " +
-	"user_network.role_level, network.name, " +
-	"network.cover_img, network.`desc`, network.creator, network.privacy, network.category, " +
-	"COALESCE((SELECT MAX(`timestamp`) FROM chat_messages WHERE conversation_id = conversations.id), '0000-00-00 00:00:00') AS last_activity " +
-	"FROM user_network " +
-	"INNER JOIN network ON user_network.network_id = network.id " +
-	"JOIN conversations ON conversations.group_id = network.id " +
-	"WHERE user_id = ? " +
-	"AND network.user_group = 1 " +
-	"ORDER BY last_activity DESC LIMIT ?, ?"
-
-var byPosts = "SELECT user_network.network_id, user_network.role, " +
-	"user_network.role_level, network.name, " +
-	"network.cover_img, network.`desc`, network.creator, network.privacy, network.category, " +
-	"COALESCE((SELECT MAX(`time`) FROM wall_posts WHERE network_id = user_network.network_id), '0000-00-00 00:00:00') " +
-	" AS last_activity " +
-	"FROM user_network " +
-	"INNER JOIN network ON user_network.network_id = network.id " +
-	"JOIN conversations ON conversations.group_id = network.id " +
-	"WHERE user_id = ? " +
-	"AND network.user_group = 1 " +
-	"ORDER BY last_activity DESC LIMIT ?, ?"
-
 //groupsByActivity returns all the networks id is a member of, optionally only returning user-created networks.
-func (api *API) groupsByActivity(id gp.UserID, index int64, count int, orderscheme int) (networks []gp.GroupSubjective, err error) {
+func (api *API) groupsByActivity(ctx context.Context, id gp.UserID, index int64, count int, orderscheme int) (networks []gp.GroupSubjective, err error) {
 	defer api.Statsd.Time(time.Now(), "gleepost.networks.byUser.db")
 	networks = make([]gp.GroupSubjective, 0)
-	var networkSelect string
-	switch {
-	case orderscheme == ByActivity:
-		networkSelect = byActivity
-	case orderscheme == ByMessages:
-		networkSelect = byMessages
-	case orderscheme == ByPosts:
-		networkSelect = byPosts
-	}
-	s, err := api.sc.Prepare(networkSelect)
+	memberships, err := api.store.Networks.Groups(ctx, id, orderscheme, index, count)
 	if err != nil {
 		return
 	}
-	rows, err := s.Query(id, index, count)
-	if err != nil {
-		return
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var network gp.GroupSubjective
-		var img, desc, privacy, category sql.NullString
-		var creator sql.NullInt64
-		var lastActivity string
-		var role gp.Role
-		err = rows.Scan(&network.ID, &role.Name, &role.Level, &network.Group.Name, &img, &desc, &creator, &privacy, &category, &lastActivity)
-		if err != nil {
-			return
-		}
-		t, e := time.Parse(mysqlTime, lastActivity)
-		if e == nil {
-			network.LastActivity = &t
-		}
-		if img.Valid {
-			network.Image = img.String
-		}
-		if desc.Valid {
-			network.Desc = desc.String
+	for _, m := range memberships {
+		network := gp.GroupSubjective{Group: api.group(ctx, m.StoredNetwork)}
+		if !m.LastActivity.IsZero() {
+			lastActivity := m.LastActivity
+			network.LastActivity = &lastActivity
 		}
-		if category.Valid {
-			network.Category = category.String
-		}
-		if creator.Valid {
-			u, err := api.users.byID(gp.UserID(creator.Int64))
-			if err == nil {
-				network.Creator = &u
-			}
-			network.MemberCount, _ = api.groupMemberCount(network.ID)
-			network.Conversation, _ = api.groupConversation(network.ID)
-			network.UnreadCount, _ = api.userConversationUnread(id, network.Conversation)
-			network.NewPosts, err = api.groupNewPosts(id, network.ID)
+		if m.Creator != 0 {
+			network.MemberCount, _ = api.groupMemberCount(ctx, network.ID)
+			network.Conversation, _ = api.groupConversation(ctx, network.ID)
+			network.UnreadCount, _ = api.userConversationUnread(ctx, id, network.Conversation)
+			network.NewPosts, err = api.groupNewPosts(ctx, id, network.ID)
 			if err != nil {
 				log.Println(err)
 			}
-			status, err := api.pendingRequestExists(id, network.ID)
+			status, err := api.pendingRequestExists(ctx, id, network.ID)
 			if err == nil && (status == "pending" || status == "rejected") {
 				network.PendingRequest = true
 			}
 		}
-		if privacy.Valid {
-			network.Privacy = privacy.String
-		}
+		role := m.Role
 		network.YourRole = &role
 		networks = append(networks, network)
 	}
-	return
+	return networks, nil
 }
 
-func (api *API) networkLastActivity(perspective gp.UserID, netID gp.NetworkID) (lastActivity time.Time, err error) {
-	q := "SELECT " +
-		"GREATEST( " +
-		"COALESCE((SELECT MAX(`timestamp`) FROM chat_messages WHERE conversation_id = conversations.id), '0000-00-00 00:00:00'), " +
-		"COALESCE((SELECT MAX(`time`) FROM wall_posts WHERE network_id = ?), '0000-00-00 00:00:00') " +
-		") AS last_activity " +
-		"FROM network " +
-		"JOIN conversations ON conversations.group_id = network.id " +
-		"WHERE network.id = ? "
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	var _time string
-	err = s.QueryRow(netID, netID).Scan(&_time)
-	if err != nil {
-		return
-	}
-	lastActivity, _ = time.Parse(mysqlTime, _time)
-	return
+func (api *API) networkLastActivity(ctx context.Context, perspective gp.UserID, netID gp.NetworkID) (lastActivity time.Time, err error) {
+	return api.store.Networks.LastActivity(ctx, netID)
 }
 
-func (api *API) groupNewPosts(userID gp.UserID, groupID gp.NetworkID) (count int, err error) {
-	q := "SELECT COUNT(DISTINCT id) FROM wall_posts " +
-		"JOIN user_network ON wall_posts.network_id = user_network.network_id " +
-		"WHERE wall_posts.network_id = ? " +
-		"AND user_network.user_id = ? " +
-		"AND wall_posts.id > user_network.seen_upto " +
-		"AND wall_posts.`time` > user_network.join_time " +
-		"AND wall_posts.deleted = 0 " +
-		"AND wall_posts.pending = 0 " +
-		"AND wall_posts.by != user_network.user_id "
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(groupID, userID).Scan(&count)
-	return
+func (api *API) groupNewPosts(ctx context.Context, userID gp.UserID, groupID gp.NetworkID) (count int, err error) {
+	return api.store.Networks.GroupNewPosts(ctx, userID, groupID)
 }
 
 //SubjectiveMembershipCount is the number of groups user belongs to, from the point of view of perspective.
 //That is: the public / private groups they're a part of, plus the secret groups that perspective is also in.
-func (api *API) subjectiveMembershipCount(perspective, user gp.UserID) (count int, err error) {
-	q := "SELECT COUNT(*) FROM user_network JOIN network ON user_network.network_id = network.id "
-	q += "WHERE user_group = 1 AND parent = (SELECT network_id FROM user_network WHERE user_id = ? LIMIT 1) "
-	q += "AND (privacy != 'secret' OR network.id IN (SELECT network_id FROM user_network WHERE user_id = ?)) "
-	q += "AND user_network.user_id = ?"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(perspective, perspective, user).Scan(&count)
-	return
-
+func (api *API) subjectiveMembershipCount(ctx context.Context, perspective, user gp.UserID) (count int, err error) {
+	return api.store.Networks.VisibleGroupCount(ctx, perspective, user)
 }
 
 //SubjectiveMemberships returns all the groups this user is a member of, as far as perspective is concerned.
-func (api *API) subjectiveMemberships(perspective, user gp.UserID, index int64, count int) (groups []gp.GroupSubjective, err error) {
+func (api *API) subjectiveMemberships(ctx context.Context, perspective, user gp.UserID, index int64, count int) (groups []gp.GroupSubjective, err error) {
 	groups = make([]gp.GroupSubjective, 0)
-	q := "SELECT user_network.network_id, user_network.role, user_network.role_level, network.name, network.cover_img, network.`desc`, network.creator, network.privacy, network.category FROM user_network JOIN network ON user_network.network_id = network.id "
-	q += "WHERE user_group = 1 AND parent = (SELECT network_id FROM user_network WHERE user_id = ? LIMIT 1) "
-	q += "AND (privacy != 'secret' OR network.id IN (SELECT network_id FROM user_network WHERE user_id = ?)) "
-	q += "AND user_network.user_id = ? "
-	q += "LIMIT ?, ?"
-	s, err := api.sc.Prepare(q)
+	memberships, err := api.store.Networks.VisibleGroups(ctx, perspective, user, index, count)
 	if err != nil {
 		return
 	}
-	rows, err := s.Query(perspective, perspective, user, index, count)
-	if err != nil {
-		return
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var network gp.GroupSubjective
-		var img, desc, privacy, category sql.NullString
-		var creator sql.NullInt64
-		var role gp.Role
-		err = rows.Scan(&network.ID, &role.Name, &role.Level, &network.Group.Name, &img, &desc, &creator, &privacy, &category)
-		if err != nil {
-			return
-		}
+	for _, m := range memberships {
+		network := gp.GroupSubjective{Group: api.group(ctx, m.StoredNetwork)}
+		role := m.Role
 		network.TheirRole = &role
-		if img.Valid {
-			network.Image = img.String
-		}
-		if desc.Valid {
-			network.Desc = desc.String
-		}
-		if category.Valid {
-			network.Category = category.String
-		}
-		if creator.Valid {
-			u, err := api.users.byID(gp.UserID(creator.Int64))
-			if err == nil {
-				network.Creator = &u
-			}
-			network.MemberCount, _ = api.groupMemberCount(network.ID)
-		}
-		if privacy.Valid {
-			network.Privacy = privacy.String
+		if m.Creator != 0 {
+			network.MemberCount, _ = api.groupMemberCount(ctx, network.ID)
 		}
 		var yourRole gp.Role
-		yourRole, err = api.userRole(perspective, network.ID)
+		yourRole, err = api.userRole(ctx, perspective, network.ID)
 		if err == nil {
 			network.YourRole = &yourRole
 			var lastActivity time.Time
-			lastActivity, err = api.networkLastActivity(perspective, network.ID)
+			lastActivity, err = api.networkLastActivity(ctx, perspective, network.ID)
 			if err == nil {
 				network.LastActivity = &lastActivity
 			}
-			network.NewPosts, err = api.groupNewPosts(perspective, network.ID)
+			network.NewPosts, err = api.groupNewPosts(ctx, perspective, network.ID)
 			if err != nil {
 				return
 			}
-			network.Conversation, _ = api.groupConversation(network.ID)
-			network.UnreadCount, err = api.userConversationUnread(perspective, network.Conversation)
+			network.Conversation, _ = api.groupConversation(ctx, network.ID)
+			network.UnreadCount, err = api.userConversationUnread(ctx, perspective, network.Conversation)
 		}
-		status, err := api.pendingRequestExists(perspective, network.ID)
+		status, err := api.pendingRequestExists(ctx, perspective, network.ID)
 		if err == nil && (status == "pending" || status == "rejected") {
 			network.PendingRequest = true
 		}
 		groups = append(groups, network)
 	}
-	err = nil
-	return
+	return groups, nil
 }
 
 //AlreadyMember indicates you tried to add someone to a network but they were already in it.
 var AlreadyMember = gp.APIerror{Reason: "Already in network"}
 
 //SetNetwork makes userID a member of networkID, returning AlreadyMember instead if they were already in it.
-func (api *API) setNetwork(userID gp.UserID, networkID gp.NetworkID) (err error) {
-	networkInsert := "INSERT INTO user_network (user_id, network_id) VALUES (?, ?)"
-	s, err := api.sc.Prepare(networkInsert)
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(userID, networkID)
-	if err, ok := err.(*mysql.MySQLError); ok {
-		if err.Number == 1062 {
-			//Drop duplicates silently
-			return AlreadyMember
-		}
+func (api *API) setNetwork(ctx context.Context, userID gp.UserID, networkID gp.NetworkID) (err error) {
+	err = api.store.Networks.Join(ctx, userID, networkID)
+	if err == store.ErrExists {
+		return AlreadyMember
 	}
 	return
 }
 
 //GetNetwork returns the network netId. If userID is 0, it will omit the group's unread count.
-func (api *API) getNetwork(netID gp.NetworkID) (network gp.Group, err error) {
-	networkSelect := "SELECT name, cover_img, `desc`, creator, user_group, privacy, category " +
-		"FROM network " +
-		"WHERE network.id = ?"
-	s, err := api.sc.Prepare(networkSelect)
-	if err != nil {
-		return
-	}
-	var coverImg, desc, privacy, category sql.NullString
-	var creator sql.NullInt64
-	var userGroup bool
-	err = s.QueryRow(netID).Scan(&network.Name, &coverImg, &desc, &creator, &userGroup, &privacy, &category)
+func (api *API) getNetwork(ctx context.Context, netID gp.NetworkID) (network gp.Group, err error) {
+	n, err := api.store.Networks.Network(ctx, netID)
 	if err != nil {
 		return
 	}
-	network.ID = netID
-	if coverImg.Valid {
-		network.Image = coverImg.String
-	}
-	if desc.Valid {
-		network.Desc = desc.String
-	}
-	if creator.Valid {
-		u, err := api.users.byID(gp.UserID(creator.Int64))
-		if err == nil {
-			network.Creator = &u
-		}
-		network.MemberCount, _ = api.groupMemberCount(network.ID)
-		network.Conversation, _ = api.groupConversation(network.ID)
-	}
-	if privacy.Valid {
-		network.Privacy = privacy.String
-	}
-	if category.Valid {
-		network.Category = category.String
+	network = api.group(ctx, n)
+	if n.Creator != 0 {
+		network.MemberCount, _ = api.groupMemberCount(ctx, network.ID)
+		network.Conversation, _ = api.groupConversation(ctx, network.ID)
 	}
 	return
 }
 
 //CreateNetwork creates a new network. usergroup indicates that the group is user-defined (created by a user rather than system-defined networks such as universities)
-func (api *API) createNetwork(name string, parent gp.NetworkID, url, desc string, creator gp.UserID, usergroup bool, privacy, category string) (group gp.Group, err error) {
-	networkInsert := "INSERT INTO network (name, parent, cover_img, `desc`, creator, user_group, privacy, category) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
-	s, err := api.sc.Prepare(networkInsert)
-	if err != nil {
-		return
+func (api *API) createNetwork(ctx context.Context, name string, parent gp.NetworkID, url, desc string, creator gp.UserID, usergroup bool, privacy, category string) (group gp.Group, err error) {
+	n := store.StoredNetwork{
+		Name:      name,
+		Parent:    parent,
+		Image:     url,
+		Desc:      desc,
+		Creator:   creator,
+		UserGroup: usergroup,
+		Privacy:   privacy,
+		Category:  category,
 	}
-	res, err := s.Exec(name, parent, url, desc, creator, usergroup, privacy, category)
+	n.ID, err = api.store.Networks.Create(ctx, n)
 	if err != nil {
 		return
 	}
-	id, _ := res.LastInsertId()
-	group.ID = gp.NetworkID(id)
+	group.ID = n.ID
 	group.Name = name
 	group.Image = url
 	group.Desc = desc
 	group.Privacy = privacy
 	group.MemberCount = 1
 	group.Category = category
-	u, err := api.users.byID(creator)
+	u, err := api.users.byID(ctx, creator)
 	if err == nil {
 		group.Creator = &u
 	} else {
@@ -951,329 +749,140 @@ func (api *API) createNetwork(name string, parent gp.NetworkID, url, desc string
 }
 
 //IsGroup returns false if netId isn't a user group, and ErrNoRows if netId doesn't exist.
-func (api *API) isGroup(netID gp.NetworkID) (group bool, err error) {
-	isgroup := "SELECT user_group FROM network WHERE id = ?"
-	s, err := api.sc.Prepare(isgroup)
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(netID).Scan(&group)
-	return
+func (api *API) isGroup(ctx context.Context, netID gp.NetworkID) (group bool, err error) {
+	return api.store.Networks.IsGroup(ctx, netID)
 }
 
 //GetNetworkAdmins returns all the administrators of the group netID
-func (nm *NetworkManager) getNetworkAdmins(netID gp.NetworkID) (users []gp.UserRole, err error) {
-	users = make([]gp.UserRole, 0)
-	memberQuery := "SELECT user_id, users.avatar, users.firstname, users.official, user_network.role, user_network.role_level FROM user_network JOIN users ON user_network.user_id = users.id WHERE user_network.network_id = ? AND user_network.role = 'administrator'"
-	s, err := nm.sc.Prepare(memberQuery)
-	if err != nil {
-		return
-	}
-	rows, err := s.Query(netID)
-	if err != nil {
-		return
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var user gp.UserRole
-		var av sql.NullString
-		err = rows.Scan(&user.ID, &av, &user.User.Name, &user.User.Official, &user.Role.Name, &user.Role.Level)
-		if err != nil {
-			return
-		}
-		if av.Valid {
-			user.Avatar = av.String
-		}
-		users = append(users, user)
+func (nm *NetworkManager) getNetworkAdmins(ctx context.Context, netID gp.NetworkID) (users []gp.UserRole, err error) {
+	users, err = nm.networks.Admins(ctx, netID)
+	if users == nil {
+		users = make([]gp.UserRole, 0)
 	}
 	return
 }
 
 //GetNetworkUsers returns all the members of the group netId
-func getNetworkUsers(sc *psc.StatementCache, netID gp.NetworkID) (users []gp.UserRole, err error) {
-	users = make([]gp.UserRole, 0)
-	memberQuery := "SELECT user_id, users.avatar, users.firstname, users.official, user_network.role, user_network.role_level FROM user_network JOIN users ON user_network.user_id = users.id WHERE user_network.network_id = ?"
-	s, err := sc.Prepare(memberQuery)
-	if err != nil {
-		return
-	}
-	rows, err := s.Query(netID)
-	if err != nil {
-		return
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var user gp.UserRole
-		var av sql.NullString
-		err = rows.Scan(&user.ID, &av, &user.User.Name, &user.User.Official, &user.Role.Name, &user.Role.Level)
-		if err != nil {
-			return
-		}
-		if av.Valid {
-			user.Avatar = av.String
-		}
-		users = append(users, user)
+func getNetworkUsers(ctx context.Context, networks store.Networks, netID gp.NetworkID) (users []gp.UserRole, err error) {
+	users, err = networks.Members(ctx, netID)
+	if users == nil {
+		users = make([]gp.UserRole, 0)
 	}
 	return
 }
 
 //LeaveNetwork idempotently removes userID from the network netID.
-func (api *API) leaveNetwork(userID gp.UserID, netID gp.NetworkID) (err error) {
-	leaveQuery := "DELETE FROM user_network WHERE user_id = ? AND network_id = ?"
-	s, err := api.sc.Prepare(leaveQuery)
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(userID, netID)
-	return
+func (api *API) leaveNetwork(ctx context.Context, userID gp.UserID, netID gp.NetworkID) (err error) {
+	return api.store.Networks.Leave(ctx, userID, netID)
 }
 
 //CreateInvite stores an invite for a particular email to a particular network.
-func (api *API) createInvite(userID gp.UserID, netID gp.NetworkID, email string, token string) (err error) {
-	inviteQuery := "INSERT INTO group_invites (group_id, inviter, email, `key`) VALUES (?, ?, ?, ?)"
-	s, err := api.sc.Prepare(inviteQuery)
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(netID, userID, email, token)
-	return
+func (api *API) createInvite(ctx context.Context, userID gp.UserID, netID gp.NetworkID, email string, token string) (err error) {
+	return api.store.Networks.Invite(ctx, netID, userID, email, token)
 }
 
 //SetNetworkImage updates a network's profile image.
-func (api *API) setNetworkImage(netID gp.NetworkID, url string) (err error) {
-	networkUpdate := "UPDATE network SET cover_img = ? WHERE id = ?"
-	s, err := api.sc.Prepare(networkUpdate)
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(url, netID)
-	return
+func (api *API) setNetworkImage(ctx context.Context, netID gp.NetworkID, url string) (err error) {
+	return api.store.Networks.SetImage(ctx, netID, url)
 }
 
 //NetworkCreator returns the user who created this network.
-func (nm *NetworkManager) networkCreator(netID gp.NetworkID) (creator gp.UserID, err error) {
-	qCreator := "SELECT creator FROM network WHERE id = ?"
-	s, err := nm.sc.Prepare(qCreator)
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(netID).Scan(&creator)
-	return
+func (nm *NetworkManager) networkCreator(ctx context.Context, netID gp.NetworkID) (creator gp.UserID, err error) {
+	return nm.networks.Creator(ctx, netID)
 }
 
 //InviteExists returns true if there is a matching invite for email:invite (that's not already accepted)
-func (api *API) inviteExists(email, invite string) (exists bool, err error) {
-	q := "SELECT COUNT(*) FROM group_invites WHERE `email` = ? AND `key` = ? AND `accepted` = 0"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(email, invite).Scan(&exists)
-	return
+func (api *API) inviteExists(ctx context.Context, email, invite string) (exists bool, err error) {
+	return api.store.Networks.InviteExists(ctx, email, invite)
 }
 
 //AcceptAllInvites marks all invites as accepted for this email address.
-func (api *API) acceptAllInvites(userID gp.UserID, email string) (err error) {
-	q := "REPLACE INTO user_network (user_id, network_id) SELECT ?, group_id FROM group_invites WHERE email = ? AND accepted = 0"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(userID, email)
-	if err != nil {
-		return
-	}
-	q = "UPDATE group_invites SET accepted = 1 WHERE email = ?"
-	s, err = api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(email)
-	return
+func (api *API) acceptAllInvites(ctx context.Context, userID gp.UserID, email string) (err error) {
+	return api.store.Networks.AcceptInvites(ctx, userID, email)
 }
 
 //AssignNetworksFromFBInvites adds user to all networks which this facebook id has been invited to.
 //TODO: only do un-accepted invites (!)
-func (api *API) assignNetworksFromFBInvites(user gp.UserID, facebook uint64) (err error) {
-	q := "REPLACE INTO user_network (user_id, network_id) SELECT ?, network_id FROM fb_group_invites WHERE facebook_id = ?"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(user, facebook)
-	return
+func (api *API) assignNetworksFromFBInvites(ctx context.Context, user gp.UserID, facebook uint64) (err error) {
+	return api.store.Networks.JoinFacebookInvites(ctx, user, facebook)
 }
 
 //AcceptAllFBInvites marks all invites for this facebook user as accepted.
-func (api *API) acceptAllFBInvites(facebook uint64) (err error) {
-	q := "UPDATE fb_group_invites SET accepted = 1 WHERE facebook_id = ?"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(facebook)
-	return
+func (api *API) acceptAllFBInvites(ctx context.Context, facebook uint64) (err error) {
+	return api.store.Networks.AcceptFacebookInvites(ctx, facebook)
 }
 
 //UserAddFBUserToGroup records that this facebook user has been invited to netID.
-func (api *API) userAddFBUserToGroup(user gp.UserID, fbuser uint64, netID gp.NetworkID) (err error) {
-	q := "INSERT INTO fb_group_invites (inviter_user_id, facebook_id, network_id) VALUES (?, ?, ?)"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(user, fbuser, netID)
-	return
-}
-
-//SetNetworkParent records that this network is a sub-network of parent (at the moment just used for visibility).
-func (api *API) setNetworkParent(network, parent gp.NetworkID) (err error) {
-	q := "UPDATE network SET parent = ? WHERE id = ?"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(parent, network)
-	return
+func (api *API) userAddFBUserToGroup(ctx context.Context, user gp.UserID, fbuser uint64, netID gp.NetworkID) (err error) {
+	return api.store.Networks.InviteFacebook(ctx, netID, user, fbuser)
 }
 
 //NetworkParent returns the ID of this network's parent, or zero if it has none.
-func (api *API) networkParent(netID gp.NetworkID) (parent gp.NetworkID, err error) {
-	q := "SELECT parent FROM network WHERE id = ?"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(netID).Scan(&parent)
-	return
+func (api *API) networkParent(ctx context.Context, netID gp.NetworkID) (parent gp.NetworkID, err error) {
+	return api.store.Networks.Parent(ctx, netID)
 }
 
 //UserRole gives this user's role:level in this network, or ENOSUCHUSER if the user isn't part of the network.
-func (api *API) userRole(user gp.UserID, network gp.NetworkID) (role gp.Role, err error) {
-	q := "SELECT role, role_level FROM user_network WHERE user_id = ? AND network_id = ?"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(user, network).Scan(&role.Name, &role.Level)
-	if err != nil && err == sql.ErrNoRows {
+func (api *API) userRole(ctx context.Context, user gp.UserID, network gp.NetworkID) (role gp.Role, err error) {
+	role, err = api.store.Networks.Role(ctx, user, network)
+	if err == sql.ErrNoRows {
 		err = gp.ENOSUCHUSER
 	}
 	return
 }
 
 //UserSetRole sets this user's Role within this network.
-func (api *API) userSetRole(user gp.UserID, network gp.NetworkID, role gp.Role) (err error) {
-	q := "UPDATE user_network SET role = ?, role_level = ? WHERE user_id = ? AND network_id = ?"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(role.Name, role.Level, user, network)
-	return
+func (api *API) userSetRole(ctx context.Context, user gp.UserID, network gp.NetworkID, role gp.Role) (err error) {
+	return api.store.Networks.SetRole(ctx, user, network, role)
 }
 
 //GroupMemberCount returns the number of members this group has.
-func (api *API) groupMemberCount(network gp.NetworkID) (count int, err error) {
-	q := "SELECT COUNT(*) FROM user_network WHERE network_id = ?"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(network).Scan(&count)
-	return
+func (api *API) groupMemberCount(ctx context.Context, network gp.NetworkID) (count int, err error) {
+	return api.store.Networks.MemberCount(ctx, network)
 }
 
 //GroupConversation returns this group's conversation ID.
-func (api *API) groupConversation(group gp.NetworkID) (conversation gp.ConversationID, err error) {
-	q := "SELECT id FROM conversations WHERE group_id = ?"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(group).Scan(&conversation)
-	return
+func (api *API) groupConversation(ctx context.Context, group gp.NetworkID) (conversation gp.ConversationID, err error) {
+	return api.store.Networks.Conversation(ctx, group)
 }
 
 //UserInNetwork returns true iff this user is in this network.
-func (api *API) UserInNetwork(userID gp.UserID, network gp.NetworkID) (in bool, err error) {
-	s, err := api.sc.Prepare("SELECT COUNT(*) FROM user_network WHERE user_id = ? AND network_id = ?")
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(userID, network).Scan(&in)
-	return
+func (api *API) UserInNetwork(ctx context.Context, userID gp.UserID, network gp.NetworkID) (in bool, err error) {
+	return api.store.Networks.IsMember(ctx, userID, network)
 }
 
 //CreateUniversity creates a new university network with this name.
-func (api *API) createUniversity(name string) (network gp.Network, err error) {
-	s, err := api.sc.Prepare("INSERT INTO network (name, is_university, user_group) VALUES (?, 1, 0)")
-	if err != nil {
-		return
-	}
-	res, err := s.Exec(name)
-	if err != nil {
-		return
-	}
-	id, err := res.LastInsertId()
-	if err != nil {
-		return
-	}
-	network.ID = gp.NetworkID(id)
+func (api *API) createUniversity(ctx context.Context, name string) (network gp.Network, err error) {
+	network.ID, err = api.store.Networks.CreateUniversity(ctx, name)
 	network.Name = name
 	return
 }
 
 //AddNetworkRules adds filters to this network: people registering with emails in these domains will be automatically filtered into this network.
-func (api *API) addNetworkRules(netID gp.NetworkID, domains ...string) (err error) {
-	s, err := api.sc.Prepare("INSERT INTO net_rules (network_id, rule_type, rule_value) VALUES (?, 'email', ?)")
-	if err != nil {
-		return
-	}
-	for _, d := range domains {
-		_, err = s.Exec(netID, d)
-		if err != nil {
-			return
-		}
-	}
-	return nil
+func (api *API) addNetworkRules(ctx context.Context, netID gp.NetworkID, domains ...string) (err error) {
+	return api.store.Networks.AddRules(ctx, netID, domains...)
 }
 
 //NetworkDomain returns this network's domain.
-func (api *API) networkDomain(netID gp.NetworkID) (domain string, err error) {
-	s, err := api.sc.Prepare("SELECT rule_value FROM net_rules WHERE rule_type = 'email' AND network_id = ?")
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(netID).Scan(&domain)
-
-	return
-}
-
-func groupName(sc *psc.StatementCache, group gp.NetworkID) (name string, err error) {
-	s, err := sc.Prepare("SELECT name FROM network WHERE id = ?")
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(group).Scan(&name)
-	return
+func (api *API) networkDomain(ctx context.Context, netID gp.NetworkID) (domain string, err error) {
+	return api.store.Networks.Domain(ctx, netID)
 }
 
 //Returns err == nil if this network is visible to this user
-func (api *API) userNetIsVisible(userID gp.UserID, netID gp.NetworkID) (err error) {
-	in, err := api.UserInNetwork(userID, netID)
+func (api *API) userNetIsVisible(ctx context.Context, userID gp.UserID, netID gp.NetworkID) (err error) {
+	in, err := api.UserInNetwork(ctx, userID, netID)
 	if err != nil {
 		return
 	}
 	if in {
 		return nil
 	}
-	parent, err := api.networkParent(netID)
+	parent, err := api.networkParent(ctx, netID)
 	if err != nil {
 		err = NoSuchNetwork
 		return
 	}
-	in, err = api.UserInNetwork(userID, parent)
+	in, err = api.UserInNetwork(ctx, userID, parent)
 	if err != nil {
 		return NoSuchNetwork
 	}
@@ -1282,7 +891,7 @@ func (api *API) userNetIsVisible(userID gp.UserID, netID gp.NetworkID) (err erro
 		err = NoSuchNetwork
 		return
 	}
-	net, err := api.getNetwork(netID)
+	net, err := api.getNetwork(ctx, netID)
 	if err != nil {
 		return
 	}
@@ -1295,8 +904,8 @@ func (api *API) userNetIsVisible(userID gp.UserID, netID gp.NetworkID) (err erro
 }
 
 //UserRequestAccess allows a user to request access to a private group. It's idempotent; requesting multiple times will silently drop the extra requests.
-func (api *API) UserRequestAccess(userID gp.UserID, netID gp.NetworkID) (err error) {
-	in, err := api.UserInNetwork(userID, netID)
+func (api *API) UserRequestAccess(ctx context.Context, userID gp.UserID, netID gp.NetworkID) (err error) {
+	in, err := api.UserInNetwork(ctx, userID, netID)
 	if err != nil {
 		return
 	}
@@ -1305,7 +914,7 @@ func (api *API) UserRequestAccess(userID gp.UserID, netID gp.NetworkID) (err err
 		err = ENOTALLOWED
 		return
 	}
-	isGroup, err := api.isGroup(netID)
+	isGroup, err := api.isGroup(ctx, netID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			//Can't request access to a network which doesn't exist
@@ -1318,11 +927,11 @@ func (api *API) UserRequestAccess(userID gp.UserID, netID gp.NetworkID) (err err
 		err = NoSuchNetwork
 		return
 	}
-	parent, err := api.networkParent(netID)
+	parent, err := api.networkParent(ctx, netID)
 	if err != nil {
 		return
 	}
-	in, err = api.UserInNetwork(userID, parent)
+	in, err = api.UserInNetwork(ctx, userID, parent)
 	if err != nil {
 		return
 	}
@@ -1331,7 +940,7 @@ func (api *API) UserRequestAccess(userID gp.UserID, netID gp.NetworkID) (err err
 		err = NoSuchNetwork
 		return
 	}
-	net, err := api.getNetwork(netID)
+	net, err := api.getNetwork(ctx, netID)
 	if err != nil {
 		return
 	}
@@ -1345,17 +954,11 @@ func (api *API) UserRequestAccess(userID gp.UserID, netID gp.NetworkID) (err err
 		err = ENOTALLOWED
 		return
 	}
-	s, err := api.sc.Prepare("INSERT INTO network_requests(user_id, network_id) VALUES (?, ?)")
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(userID, netID)
+	err = api.store.Networks.Request(ctx, userID, netID)
 	if err != nil {
-		if err, ok := err.(*mysql.MySQLError); ok {
-			if err.Number == 1062 {
-				//Drop duplicates silently
-				return nil
-			}
+		if err == store.ErrExists {
+			//Drop duplicates silently
+			return nil
 		}
 		return
 	}
@@ -1363,26 +966,21 @@ func (api *API) UserRequestAccess(userID gp.UserID, netID gp.NetworkID) (err err
 	return
 }
 
-func (api *API) setRequestStatus(userID gp.UserID, groupID gp.NetworkID, status string, processor gp.UserID) (err error) {
-	s, err := api.sc.Prepare("UPDATE network_requests SET status = ?, processed_by = ? WHERE user_id = ? AND network_id = ?")
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(status, processor, userID, groupID)
-	return
+func (api *API) setRequestStatus(ctx context.Context, userID gp.UserID, groupID gp.NetworkID, status string, processor gp.UserID) (err error) {
+	return api.store.Networks.SetRequestStatus(ctx, userID, groupID, status, processor)
 }
 
 //NetworkManager provides access to network data.
 type NetworkManager struct {
-	sc *psc.StatementCache
+	networks store.Networks
 }
 
-func (nm *NetworkManager) networkStaff(netID gp.NetworkID) (staff []gp.UserID, err error) {
-	admins, err := nm.getNetworkAdmins(netID)
+func (nm *NetworkManager) networkStaff(ctx context.Context, netID gp.NetworkID) (staff []gp.UserID, err error) {
+	admins, err := nm.getNetworkAdmins(ctx, netID)
 	if err != nil {
 		return
 	}
-	creator, err := nm.networkCreator(netID)
+	creator, err := nm.networkCreator(ctx, netID)
 	if err != nil {
 		return
 	}
@@ -1394,85 +992,37 @@ func (nm *NetworkManager) networkStaff(netID gp.NetworkID) (staff []gp.UserID, e
 }
 
 //GroupsByMembershipCount returns the usergroups in this user's university, sorted by membership count / id.
-func (api *API) GroupsByMembershipCount(userID gp.UserID, index int64, count int, filter string) (groups []gp.GroupSubjective, err error) {
-	var filterClause string
-	if len(filter) > 0 {
-		filterClause = "AND category = ? "
-	}
-	q := "SELECT id, name, cover_img, `desc`, creator, privacy, category, COUNT(user_id) as cnt " +
-		"FROM network " +
-		"JOIN user_network ON network.id = user_network.network_id " +
-		"WHERE user_group = 1 " +
-		"AND privacy != 'secret' " +
-		"AND parent = ? " +
-		filterClause +
-		"GROUP BY network.id " +
-		"ORDER BY cnt DESC, id ASC " +
-		"LIMIT ?, ?"
+func (api *API) GroupsByMembershipCount(ctx context.Context, userID gp.UserID, index int64, count int, filter string) (groups []gp.GroupSubjective, err error) {
 	groups = make([]gp.GroupSubjective, 0)
-	primary, err := api.getUserUniversity(userID)
+	primary, err := api.getUserUniversity(ctx, userID)
 	if err != nil {
 		return
 	}
-	s, err := api.sc.Prepare(q)
+	popular, err := api.store.Networks.PopularGroups(ctx, primary.ID, filter, index, count)
 	if err != nil {
 		return
 	}
-	var rows *sql.Rows
-	if len(filter) > 0 {
-		rows, err = s.Query(primary.ID, filter, index, count)
-	} else {
-		rows, err = s.Query(primary.ID, index, count)
-	}
-	if err != nil {
-		return
-	}
-	defer rows.Close()
-	var img, desc, privacy, category sql.NullString
-	var creator sql.NullInt64
-	for rows.Next() {
-		group := gp.GroupSubjective{}
-		err = rows.Scan(&group.ID, &group.Name, &img, &desc, &creator, &privacy, &category, &group.MemberCount)
-		if err != nil {
-			log.Println("Scan err:", err)
-			continue
-		}
-		if img.Valid {
-			group.Image = img.String
-		}
-		if category.Valid {
-			group.Category = category.String
-		}
-		if creator.Valid {
-			u, err := api.users.byID(gp.UserID(creator.Int64))
-			if err == nil {
-				group.Creator = &u
-			}
-		}
-		if desc.Valid {
-			group.Desc = desc.String
-		}
-		if privacy.Valid {
-			group.Privacy = privacy.String
-		}
+	for _, p := range popular {
+		group := gp.GroupSubjective{Group: api.group(ctx, p.StoredNetwork)}
+		group.MemberCount = p.Members
 		var role gp.Role
-		role, err = api.userRole(userID, group.ID)
+		role, err = api.userRole(ctx, userID, group.ID)
 		if err == nil {
 			group.YourRole = &role
-			group.Conversation, err = api.groupConversation(group.ID)
+			group.Conversation, err = api.groupConversation(ctx, group.ID)
 			if err != nil {
 				log.Println("Error getting group conversation:", err)
 			}
-			group.UnreadCount, err = api.userConversationUnread(userID, group.Conversation)
+			group.UnreadCount, err = api.userConversationUnread(ctx, userID, group.Conversation)
 			if err != nil {
 				log.Println("Error getting conversation unread count:", err)
 			}
-			group.NewPosts, err = api.groupNewPosts(userID, group.ID)
+			group.NewPosts, err = api.groupNewPosts(ctx, userID, group.ID)
 			if err != nil {
 				log.Println("Error getting group new post count:", err)
 			}
 		}
-		status, err := api.pendingRequestExists(userID, group.ID)
+		status, err := api.pendingRequestExists(ctx, userID, group.ID)
 		if err == nil && (status == "pending" || status == "rejected") {
 			group.PendingRequest = true
 		}
@@ -1482,9 +1032,9 @@ func (api *API) GroupsByMembershipCount(userID gp.UserID, index int64, count int
 }
 
 //NetworkRequests enumerates the outstanding requests to join this network.
-func (api *API) NetworkRequests(userID gp.UserID, netID gp.NetworkID) (requests []gp.NetRequest, err error) {
+func (api *API) NetworkRequests(ctx context.Context, userID gp.UserID, netID gp.NetworkID) (requests []gp.NetRequest, err error) {
 	requests = make([]gp.NetRequest, 0)
-	in, err := api.UserInNetwork(userID, netID)
+	in, err := api.UserInNetwork(ctx, userID, netID)
 	if err != nil {
 		return
 	}
@@ -1492,32 +1042,17 @@ func (api *API) NetworkRequests(userID gp.UserID, netID gp.NetworkID) (requests
 		err = ENOTALLOWED
 		return
 	}
-	q := "SELECT user_id, request_time FROM network_requests WHERE network_id = ? AND status = 'pending'"
-	s, err := api.sc.Prepare(q)
+	pending, err := api.store.Networks.Requests(ctx, netID)
 	if err != nil {
 		return
 	}
-	rows, err := s.Query(netID)
-	if err != nil {
-		return
-	}
-	defer rows.Close()
-	var id gp.UserID
-	var t string
-	for rows.Next() {
+	for _, p := range pending {
 		req := gp.NetRequest{}
-		err = rows.Scan(&id, &t)
-		if err != nil {
-			return
-		}
-		req.Requester, err = api.users.byID(id)
-		if err != nil {
-			return
-		}
-		req.ReqTime, err = time.Parse(mysqlTime, t)
+		req.Requester, err = api.users.byID(ctx, p.User)
 		if err != nil {
 			return
 		}
+		req.ReqTime = p.Time
 		req.Status = "pending"
 		requests = append(requests, req)
 	}
@@ -1525,20 +1060,20 @@ func (api *API) NetworkRequests(userID gp.UserID, netID gp.NetworkID) (requests
 }
 
 //RejectNetworkRequest marks a request to join a private group as rejected. It can only be used by group administrators, and will not inform the rejectee,
-func (api *API) RejectNetworkRequest(userID gp.UserID, netID gp.NetworkID, reqID gp.UserID) (err error) {
-	err = api.userNetIsVisible(userID, netID)
+func (api *API) RejectNetworkRequest(ctx context.Context, userID gp.UserID, netID gp.NetworkID, reqID gp.UserID) (err error) {
+	err = api.userNetIsVisible(ctx, userID, netID)
 	if err != nil {
 		return
 	}
 
-	has, err := api.userHasRole(userID, netID, "administrator")
+	has, err := api.userHasRole(ctx, userID, netID, "administrator")
 	if err != nil {
 		return
 	}
 	if !has {
 		return ENOTALLOWED
 	}
-	status, err := api.pendingRequestExists(reqID, netID)
+	status, err := api.pendingRequestExists(ctx, reqID, netID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			err = NoSuchRequest
@@ -1551,76 +1086,39 @@ func (api *API) RejectNetworkRequest(userID gp.UserID, netID gp.NetworkID, reqID
 	case status == "accepted":
 		return AlreadyAccepted
 	default:
-		err = api.setRequestStatus(reqID, netID, "rejected", userID)
+		err = api.setRequestStatus(ctx, reqID, netID, "rejected", userID)
 		go api.notifObserver.Notify(rejectedGroupEvent{rejectedID: reqID, netID: netID})
 		return
 	}
 }
 
-func (api *API) pendingRequestExists(reqID gp.UserID, netID gp.NetworkID) (status string, err error) {
-	s, err := api.sc.Prepare("SELECT status FROM network_requests WHERE user_id = ? AND network_id = ?")
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(reqID, netID).Scan(&status)
-	return
-
+func (api *API) pendingRequestExists(ctx context.Context, reqID gp.UserID, netID gp.NetworkID) (status string, err error) {
+	return api.store.Networks.RequestStatus(ctx, reqID, netID)
 }
 
 //PublicUniversity yields the public world-readable description of this university.
-func (api *API) PublicUniversity(netID gp.NetworkID) (university gp.PublicUniversity, err error) {
-	s, err := api.sc.Prepare("SELECT name, cover_img, `desc`, shortname, appname, tagline, ios_url, android_url, covervid_mp4, covervid_webm FROM network WHERE id = ? AND user_group = 0 AND is_university = 1")
-	if err != nil {
-		return
-	}
-	var coverImg, desc, shortname, appname, tagline, iosURL, androidURL, mp4, webm sql.NullString
-	err = s.QueryRow(netID).Scan(&university.Name, &coverImg, &desc, &shortname, &appname, &tagline, &iosURL, &androidURL, &mp4, &webm)
+func (api *API) PublicUniversity(ctx context.Context, netID gp.NetworkID) (university gp.PublicUniversity, err error) {
+	university, err = api.store.Networks.PublicUniversity(ctx, netID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			err = ENOTALLOWED
 		}
 		return
 	}
-	university.ID = netID
-	if coverImg.Valid {
-		university.Image = coverImg.String
-	}
-	if desc.Valid {
-		university.Desc = desc.String
-	}
-	if shortname.Valid {
-		university.ShortName = shortname.String
-	}
-	if appname.Valid {
-		university.AppName = appname.String
-	}
-	if tagline.Valid {
-		university.TagLine = tagline.String
-	}
-	if iosURL.Valid {
-		university.IosURL = iosURL.String
-	} else {
+	if university.IosURL == "" {
 		university.IosURL = "https://itunes.apple.com/us/app/gleepost/id820569024?mt=8"
 	}
-	if androidURL.Valid {
-		university.AndroidURL = androidURL.String
-	} else {
+	if university.AndroidURL == "" {
 		university.AndroidURL = "https://play.google.com/store/apps/details?id=com.gleepost.android"
 	}
-	if webm.Valid {
-		university.Video.WebM = webm.String
-	}
-	if mp4.Valid {
-		university.Video.MP4 = mp4.String
-	}
-	university.MemberCount, _ = api.groupMemberCount(university.ID)
-	liveSummary, _ := api.getLiveSummary(university.ID, time.Now(), time.Now().AddDate(1, 0, 0))
+	university.MemberCount, _ = api.groupMemberCount(ctx, university.ID)
+	liveSummary, _ := api.getLiveSummary(ctx, university.ID, time.Now(), time.Now().AddDate(1, 0, 0))
 	university.EventCount = liveSummary.Posts
-	university.GroupCount, err = api.networkChildGroups(university.ID)
+	university.GroupCount, err = api.networkChildGroups(ctx, university.ID)
 	if err != nil {
 		log.Println(err)
 	}
-	university.MessageCount, err = api.totalMessagesSent(university.ID, time.Time{}, time.Now().UTC())
+	university.MessageCount, err = api.totalMessagesSent(ctx, university.ID, time.Time{}, time.Now().UTC())
 	if err != nil {
 		log.Println(err)
 	}
@@ -1628,44 +1126,25 @@ func (api *API) PublicUniversity(netID gp.NetworkID) (university gp.PublicUniver
 	return
 }
 
-func (api *API) networkChildGroups(netID gp.NetworkID) (groups int, err error) {
-	s, err := api.sc.Prepare("SELECT COUNT(*) FROM network WHERE parent = ?")
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(netID).Scan(&groups)
-	return
+func (api *API) networkChildGroups(ctx context.Context, netID gp.NetworkID) (groups int, err error) {
+	return api.store.Networks.ChildCount(ctx, netID)
 }
 
-func (api *API) totalGroupsNewPosts(userID gp.UserID) (count int, err error) {
-	defer api.Statsd.Time(time.Now(), "gleepost.totalPosts.db")
-	q := "SELECT COUNT(DISTINCT wall_posts.id) FROM wall_posts " +
-		"JOIN user_network ON wall_posts.network_id = user_network.network_id " +
-		"JOIN network ON wall_posts.network_id = network.id " +
-		"WHERE user_network.user_id = ? " +
-		"AND wall_posts.id > user_network.seen_upto " +
-		"AND wall_posts.`time` > user_network.join_time " +
-		"AND wall_posts.deleted = 0 " +
-		"AND wall_posts.pending = 0 " +
-		"AND wall_posts.by != user_network.user_id " +
-		"AND network.is_university = 0 " +
-		"AND network.user_group = 1 " +
-		"AND wall_posts.`time` > (SELECT group_badge_threshold FROM users WHERE users.id = ?)"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(userID, userID).Scan(&count)
-	return
+func (api *API) totalGroupsNewPosts(ctx context.Context, userID gp.UserID) (count int, err error) {
+	return groupsNewPosts(ctx, api.store.Networks, api.Statsd, userID)
+}
+
+//groupsNewPosts counts the posts in userID's groups they haven't seen yet; it's the group tab's badge.
+func groupsNewPosts(ctx context.Context, networks store.Networks, stats PrefixStatter, userID gp.UserID) (count int, err error) {
+	defer stats.Time(time.Now(), "gleepost.totalPosts.db")
+	return networks.NewPostCount(ctx, userID)
 }
 
 //UserMuteGroupBadge omits all (posts, messages) before t from the group tab badge count.
-func (api *API) UserMuteGroupBadge(userID gp.UserID, t time.Time) (err error) {
-	q := "UPDATE users SET group_badge_threshold = ? WHERE id = ?"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
+func (api *API) UserMuteGroupBadge(ctx context.Context, userID gp.UserID, t time.Time) (err error) {
+	err = api.store.Conversations.MuteGroupBadge(ctx, userID, t)
+	if err == nil {
+		api.badgeChanged(userID)
 	}
-	_, err = s.Exec(t, userID)
 	return
 }
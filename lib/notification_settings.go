@@ -0,0 +1,241 @@
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/psc"
+)
+
+var (
+	//BadNotificationType means there's no such type of notification.
+	BadNotificationType = gp.APIerror{Reason: "No such notification type"}
+	//BadQuietHours means the quiet hours' start or end wasn't a time like 22:30.
+	BadQuietHours = gp.APIerror{Reason: "Quiet hours must be given as HH:MM"}
+	//BadTimezone means the timezone wasn't one we know (they should be IANA names, like America/Los_Angeles).
+	BadTimezone = gp.APIerror{Reason: "Unknown timezone"}
+)
+
+//allChannels is how every notification is delivered unless the user says otherwise.
+var allChannels = gp.Channels{InApp: true, Push: true, Email: true}
+
+//NotificationTypes returns every type of notification a user can choose how to receive.
+func NotificationTypes() (types []string) {
+	for t := range nouns {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return
+}
+
+//NotificationSettings returns how userID wants to receive each type of notification, their per-group overrides and their quiet hours.
+func (api *API) NotificationSettings(ctx context.Context, userID gp.UserID) (settings gp.NotificationSettings, err error) {
+	settings.Types = make(map[string]gp.Channels)
+	for _, t := range NotificationTypes() {
+		settings.Types[t] = allChannels
+	}
+	s, err := api.sc.Prepare("SELECT type, in_app, push, email FROM notification_settings WHERE user_id = ?")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, userID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t string
+		var c gp.Channels
+		if err = rows.Scan(&t, &c.InApp, &c.Push, &c.Email); err != nil {
+			return
+		}
+		if _, ok := settings.Types[t]; ok {
+			settings.Types[t] = c
+		}
+	}
+	settings.Groups = make([]gp.GroupNotificationSettings, 0)
+	s, err = api.sc.Prepare("SELECT network_id, in_app, push, email FROM notification_group_settings WHERE user_id = ? ORDER BY network_id")
+	if err != nil {
+		return
+	}
+	groupRows, err := s.QueryContext(ctx, userID)
+	if err != nil {
+		return
+	}
+	defer groupRows.Close()
+	for groupRows.Next() {
+		var g gp.GroupNotificationSettings
+		if err = groupRows.Scan(&g.Group, &g.InApp, &g.Push, &g.Email); err != nil {
+			return
+		}
+		settings.Groups = append(settings.Groups, g)
+	}
+	start, end, tz, err := quietHours(ctx, api.sc, userID)
+	switch {
+	case err == nil:
+		settings.QuietHours = &gp.QuietHours{Start: formatClock(start), End: formatClock(end), Timezone: tz}
+	case err == sql.ErrNoRows:
+		err = nil
+	default:
+		return
+	}
+	settings.Digest, err = api.digestFrequency(ctx, userID)
+	return
+}
+
+//SetNotificationChannels sets how userID receives notifications of this type.
+func (api *API) SetNotificationChannels(ctx context.Context, userID gp.UserID, ntype string, c gp.Channels) (err error) {
+	if _, ok := nouns[ntype]; !ok {
+		return BadNotificationType
+	}
+	s, err := api.sc.Prepare("REPLACE INTO notification_settings (user_id, type, in_app, push, email) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, userID, ntype, c.InApp, c.Push, c.Email)
+	return
+}
+
+//SetGroupNotificationChannels sets how userID receives notifications about this group, whatever their type.
+func (api *API) SetGroupNotificationChannels(ctx context.Context, userID gp.UserID, netID gp.NetworkID, c gp.Channels) (err error) {
+	in, err := api.UserInNetwork(ctx, userID, netID)
+	switch {
+	case err != nil:
+		return
+	case !in:
+		return ENOTALLOWED
+	}
+	s, err := api.sc.Prepare("REPLACE INTO notification_group_settings (user_id, network_id, in_app, push, email) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, userID, netID, c.InApp, c.Push, c.Email)
+	return
+}
+
+//ClearGroupNotificationChannels removes userID's override for this group.
+func (api *API) ClearGroupNotificationChannels(ctx context.Context, userID gp.UserID, netID gp.NetworkID) (err error) {
+	s, err := api.sc.Prepare("DELETE FROM notification_group_settings WHERE user_id = ? AND network_id = ?")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, userID, netID)
+	return
+}
+
+//SetQuietHours stops userID being pushed to between start and end ("22:00", "07:30") each day in timezone.
+func (api *API) SetQuietHours(ctx context.Context, userID gp.UserID, q gp.QuietHours) (err error) {
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return
+	}
+	end, err := parseClock(q.End)
+	if err != nil {
+		return
+	}
+	if q.Timezone == "" {
+		q.Timezone = "UTC"
+	}
+	if _, e := time.LoadLocation(q.Timezone); e != nil {
+		return BadTimezone
+	}
+	s, err := api.sc.Prepare("REPLACE INTO notification_quiet_hours (user_id, `start`, `end`, timezone) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, userID, start, end, q.Timezone)
+	return
+}
+
+//ClearQuietHours turns userID's quiet hours off.
+func (api *API) ClearQuietHours(ctx context.Context, userID gp.UserID) (err error) {
+	s, err := api.sc.Prepare("DELETE FROM notification_quiet_hours WHERE user_id = ?")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, userID)
+	return
+}
+
+//notificationChannels returns how recipient wants to receive this notification: through whichever channels both its type and (if it's about a group) the group allow.
+func notificationChannels(ctx context.Context, sc *psc.StatementCache, recipient gp.UserID, ntype string, netID gp.NetworkID) (c gp.Channels, err error) {
+	c = allChannels
+	s, err := sc.Prepare("SELECT in_app, push, email FROM notification_settings WHERE user_id = ? AND type = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, recipient, ntype).Scan(&c.InApp, &c.Push, &c.Email)
+	if err != nil && err != sql.ErrNoRows {
+		return
+	}
+	err = nil
+	if netID == 0 {
+		return
+	}
+	g := allChannels
+	s, err = sc.Prepare("SELECT in_app, push, email FROM notification_group_settings WHERE user_id = ? AND network_id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, recipient, netID).Scan(&g.InApp, &g.Push, &g.Email)
+	if err != nil && err != sql.ErrNoRows {
+		return
+	}
+	c.InApp, c.Push, c.Email = c.InApp && g.InApp, c.Push && g.Push, c.Email && g.Email
+	return c, nil
+}
+
+func quietHours(ctx context.Context, sc *psc.StatementCache, userID gp.UserID) (start, end int, tz string, err error) {
+	s, err := sc.Prepare("SELECT `start`, `end`, timezone FROM notification_quiet_hours WHERE user_id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, userID).Scan(&start, &end, &tz)
+	return
+}
+
+//inQuietHours reports whether userID shouldn't be pushed to right now.
+func inQuietHours(ctx context.Context, sc *psc.StatementCache, userID gp.UserID) (quiet bool, err error) {
+	start, end, tz, err := quietHours(ctx, sc, userID)
+	switch {
+	case err == sql.ErrNoRows:
+		return false, nil
+	case err != nil:
+		return
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return
+	}
+	return isQuiet(start, end, time.Now().In(loc)), nil
+}
+
+//isQuiet reports whether t falls in the window from start to end (in minutes after midnight), which may wrap past midnight.
+func isQuiet(start, end int, t time.Time) bool {
+	now := t.Hour()*60 + t.Minute()
+	switch {
+	case start == end:
+		return false
+	case start < end:
+		return now >= start && now < end
+	default:
+		return now >= start || now < end
+	}
+}
+
+//parseClock turns a time like "22:30" into minutes after midnight.
+func parseClock(clock string) (minutes int, err error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, BadQuietHours
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func formatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -11,7 +12,7 @@ import (
 	"github.com/Petergatsby/GleepostAPI/lib/gp"
 	"github.com/Petergatsby/GleepostAPI/lib/psc"
 	"github.com/Petergatsby/GleepostAPI/lib/push"
-	"github.com/draaglom/apns"
+	"github.com/Petergatsby/GleepostAPI/lib/store"
 )
 
 func toLocKey(notificationType string) (locKey string) {
@@ -24,90 +25,82 @@ func toLocKey(notificationType string) (locKey string) {
 }
 
 //GetUserNotifications returns all unseen notifications for this user, and the seen ones as well if includeSeen is true.
-func (api *API) GetUserNotifications(id gp.UserID, mode int, index int64, includeSeen bool) (notifications []gp.Notification, err error) {
+func (api *API) GetUserNotifications(ctx context.Context, id gp.UserID, mode int, index int64, includeSeen bool) (notifications []gp.Notification, err error) {
 	notifications = make([]gp.Notification, 0)
-	var notificationSelect string
-	notificationSelect = "SELECT id, type, time, `by`, post_id, network_id, preview_text, seen, done FROM notifications WHERE recipient = ?"
-	if !includeSeen {
-		notificationSelect += " AND seen = 0"
-	}
-	switch {
-	case mode == ChronologicallyAfterID:
-		notificationSelect = "SELECT `id`, `type`, `time`, `by`, `post_id`, `network_id`, `preview_text`, `seen`, `done` FROM (" + notificationSelect + " AND notifications.id > ? ORDER BY `id` ASC LIMIT ?) AS `wp` ORDER BY `id` DESC"
-	case mode == ChronologicallyBeforeID:
-		notificationSelect += " AND notifications.id < ? ORDER BY `id` DESC LIMIT ?"
-	default:
-		notificationSelect += " ORDER BY `id` DESC LIMIT ?"
-	}
-	s, err := api.sc.Prepare(notificationSelect)
-	if err != nil {
-		return
-	}
-	var rows *sql.Rows
-	if mode == ByOffsetDescending {
-		rows, err = s.Query(id, api.Config.NotificationPageSize)
-	} else {
-		rows, err = s.Query(id, index, api.Config.NotificationPageSize)
-	}
-
+	stored, err := api.store.Notifications.List(ctx, id, includeSeen, mode, index, api.Config.NotificationPageSize)
 	if err != nil {
 		return
 	}
-
-	defer rows.Close()
-	for rows.Next() {
-		var notification gp.Notification
-		var t string
-		var postID, netID sql.NullInt64
-		var preview sql.NullString
-		var by gp.UserID
-		if err = rows.Scan(&notification.ID, &notification.Type, &t, &by, &postID, &netID, &preview, &notification.Seen, &notification.Done); err != nil {
-			return
+	for _, s := range stored {
+		notification := gp.Notification{
+			ID:      s.ID,
+			Type:    s.Type,
+			Time:    s.Time,
+			Post:    s.Post,
+			Group:   s.Group,
+			Preview: s.Preview,
+			Seen:    s.Seen,
+			Done:    s.Done,
 		}
-		notification.Time, err = time.Parse(mysqlTime, t)
-		if err != nil {
-			return
-		}
-		notification.By, err = api.users.byID(by)
+		notification.By, err = api.users.byID(ctx, s.By)
 		if err != nil {
 			log.Println(err)
 			continue
 		}
-		if postID.Valid {
-			notification.Post = gp.PostID(postID.Int64)
-		}
-		if netID.Valid {
-			notification.Group = gp.NetworkID(netID.Int64)
-		}
-		if preview.Valid {
-			notification.Preview = preview.String
+		if s.ActorCount > 1 {
+			notification.Count = s.ActorCount
+			notification.Actors, err = notificationActors(ctx, api.store.Notifications, api.users, notification.ID)
+			if err != nil {
+				return
+			}
 		}
 		notifications = append(notifications, notification)
 	}
 	return
 }
 
-func (api *API) userUnreadNotifications(id gp.UserID) (count int, err error) {
-	notificationSelect := "SELECT count(id) FROM notifications WHERE recipient = ? AND seen = 0 AND done = 0"
-	s, err := api.sc.Prepare(notificationSelect)
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(id).Scan(&count)
-	return
+func (api *API) userUnreadNotifications(ctx context.Context, id gp.UserID) (count int, err error) {
+	return api.store.Notifications.UnseenCount(ctx, id)
 }
 
-//createNotification creates a new gleepost notification. location is the id of the object where the notification happened - a post id if the notification is "liked" or "commented", or a network id if the notification type is "added_group". Otherwise, the location will be ignored.
-func (n NotificationObserver) createNotification(ntype string, by gp.UserID, recipient gp.UserID, postID gp.PostID, netID gp.NetworkID, preview string) (err error) {
+//createNotification creates a new gleepost notification. postID is the post it's about, if any, and netID the network: the group for "added_group" and the like, or the post's network for notifications about a post.
+//It's only stored (and pushed) if recipient's notification settings allow, including their settings for netID.
+func (n NotificationObserver) createNotification(ctx context.Context, ntype string, by gp.UserID, recipient gp.UserID, postID gp.PostID, netID gp.NetworkID, preview string) (err error) {
 	if len(preview) > 97 {
 		preview = preview[:97] + "..."
 	}
-	notification, err := n._createNotification(ntype, by, recipient, postID, netID, preview)
-	if err == nil {
-		n.push(notification, recipient)
-		go n.broker.PublishEvent("notification", "/notifications", notification, []string{NotificationChannelKey(recipient)})
+	channels, err := notificationChannels(ctx, n.sc, recipient, ntype, netID)
+	if err != nil {
+		log.Println("Error getting notification settings:", err)
+		channels = allChannels
 	}
-	return
+	var notification gp.Notification
+	switch {
+	case channels.InApp:
+		var ok bool
+		notification, ok, err = n.aggregate(ctx, ntype, by, recipient, postID, netID, preview)
+		if err == nil && !ok {
+			notification, err = n._createNotification(ctx, ntype, by, recipient, postID, netID, preview)
+		}
+		if err != nil {
+			return
+		}
+		go n.broker.PublishEvent(events.Notification, "/notifications", notification, []string{NotificationChannelKey(recipient)})
+		go publishBadge(n.store, n.stats, n.broker, recipient)
+	case channels.Push:
+		//Pushed, but not kept in their notification list.
+		notification = gp.Notification{Type: ntype, Time: time.Now().UTC(), Post: postID, Group: netID, Preview: preview}
+		notification.By, err = n.users.byID(ctx, by)
+		if err != nil {
+			return
+		}
+	default:
+		return nil
+	}
+	if channels.Push {
+		n.push(ctx, notification, recipient)
+	}
+	return nil
 }
 
 //NotificationChannelKey returns the channel used for this user's notifications.
@@ -118,10 +111,10 @@ func NotificationChannelKey(id gp.UserID) (channel string) {
 //NotificationObserver has the responsibility of producing Notifications for users.
 type NotificationObserver struct {
 	events    chan NotificationEvent
-	db        *sql.DB
 	sc        *psc.StatementCache
-	broker    *events.Broker
-	pusher    push.Pusher
+	store     store.Store
+	broker    events.EventBus
+	queue     *pushQueue
 	users     *Users
 	nm        *NetworkManager
 	stats     PrefixStatter
@@ -136,21 +129,22 @@ func (n NotificationObserver) Notify(e NotificationEvent) {
 
 //NotificationEvent is any event which might trigger a notification.
 type NotificationEvent interface {
-	notify(NotificationObserver) error
+	notify(context.Context, NotificationObserver) error
 }
 
 //NewObserver creates a NotificationObserver
-func NewObserver(db *sql.DB, broker *events.Broker, pusher push.Pusher, sc *psc.StatementCache, users *Users, nm *NetworkManager, presences Presences, comments comments) NotificationObserver {
+func NewObserver(broker events.EventBus, queue *pushQueue, sc *psc.StatementCache, st store.Store, users *Users, nm *NetworkManager, presences Presences, comments comments) NotificationObserver {
 	events := make(chan NotificationEvent)
-	n := NotificationObserver{events: events, db: db, sc: sc, broker: broker, pusher: pusher, users: users, nm: nm, presences: presences, comments: comments}
+	n := NotificationObserver{events: events, sc: sc, store: st, broker: broker, queue: queue, users: users, nm: nm, presences: presences, comments: comments}
 	go n.spin()
 	return n
 }
 
 func (n NotificationObserver) spin() {
+	ctx := context.Background()
 	for {
 		event := <-n.events
-		event.notify(n)
+		event.notify(ctx, n)
 	}
 }
 
@@ -161,16 +155,16 @@ type postEvent struct {
 	pending bool
 }
 
-func (p postEvent) notify(n NotificationObserver) error {
-	creator, err := n.networkCreator(p.netID)
+func (p postEvent) notify(ctx context.Context, n NotificationObserver) error {
+	creator, err := n.networkCreator(ctx, p.netID)
 	if err == nil && (creator == p.userID) && !p.pending {
-		users, err := getNetworkUsers(n.sc, p.netID)
+		users, err := getNetworkUsers(ctx, n.store.Networks, p.netID)
 		if err != nil {
 			return err
 		}
 		for _, u := range users {
 			if u.ID != p.userID {
-				n.createNotification("group_post", p.userID, u.ID, p.postID, p.netID, "")
+				n.createNotification(ctx, "group_post", p.userID, u.ID, p.postID, p.netID, "")
 			}
 		}
 	}
@@ -183,8 +177,8 @@ type approvedEvent struct {
 	postID      gp.PostID
 }
 
-func (a approvedEvent) notify(n NotificationObserver) error {
-	err := n.createNotification("approved_post", a.userID, a.recipientID, a.postID, 0, "")
+func (a approvedEvent) notify(ctx context.Context, n NotificationObserver) error {
+	err := n.createNotification(ctx, "approved_post", a.userID, a.recipientID, a.postID, 0, "")
 	return err
 }
 
@@ -194,8 +188,8 @@ type rejectedEvent struct {
 	postID      gp.PostID
 }
 
-func (r rejectedEvent) notify(n NotificationObserver) error {
-	err := n.createNotification("rejected_post", r.userID, r.recipientID, r.postID, 0, "")
+func (r rejectedEvent) notify(ctx context.Context, n NotificationObserver) error {
+	err := n.createNotification(ctx, "rejected_post", r.userID, r.recipientID, r.postID, 0, "")
 	return err
 }
 
@@ -205,12 +199,12 @@ type addedGroupEvent struct {
 	netID   gp.NetworkID
 }
 
-func (a addedGroupEvent) notify(n NotificationObserver) error {
-	err := n.createNotification("added_group", a.userID, a.addeeID, 0, a.netID, "")
+func (a addedGroupEvent) notify(ctx context.Context, n NotificationObserver) error {
+	err := n.createNotification(ctx, "added_group", a.userID, a.addeeID, 0, a.netID, "")
 	if err != nil {
 		return err
 	}
-	err = n.markRequestNotificationDone(a.netID, a.addeeID)
+	err = n.markRequestNotificationDone(ctx, a.netID, a.addeeID)
 	if err != nil {
 		log.Println("Error marking notifications as done:", err)
 	}
@@ -222,8 +216,8 @@ type rejectedGroupEvent struct {
 	netID      gp.NetworkID
 }
 
-func (r rejectedGroupEvent) notify(n NotificationObserver) error {
-	err := n.markRequestNotificationDone(r.netID, r.rejectedID)
+func (r rejectedGroupEvent) notify(ctx context.Context, n NotificationObserver) error {
+	err := n.markRequestNotificationDone(ctx, r.netID, r.rejectedID)
 	if err != nil {
 		log.Println("Error marking notifications as done:", err)
 		return err
@@ -235,11 +229,12 @@ type attendEvent struct {
 	userID      gp.UserID
 	recipientID gp.UserID
 	postID      gp.PostID
+	netID       gp.NetworkID
 }
 
-func (a attendEvent) notify(n NotificationObserver) (err error) {
+func (a attendEvent) notify(ctx context.Context, n NotificationObserver) (err error) {
 	if a.userID != a.recipientID {
-		err = n.createNotification("attended", a.userID, a.recipientID, a.postID, 0, "")
+		err = n.createNotification(ctx, "attended", a.userID, a.recipientID, a.postID, a.netID, "")
 	}
 	return err
 }
@@ -248,19 +243,20 @@ type commentEvent struct {
 	userID      gp.UserID
 	recipientID gp.UserID
 	postID      gp.PostID
+	netID       gp.NetworkID
 	text        string
 }
 
-func (c commentEvent) notify(n NotificationObserver) (err error) {
+func (c commentEvent) notify(ctx context.Context, n NotificationObserver) (err error) {
 	notified := make(map[gp.UserID]bool) //to suppress dupe notifications
 	if c.userID != c.recipientID {
 		notified[c.recipientID] = true
-		err = n.createNotification("commented", c.userID, c.recipientID, c.postID, 0, c.text)
+		err = n.createNotification(ctx, "commented", c.userID, c.recipientID, c.postID, c.netID, c.text)
 	}
 	if err != nil {
 		return err
 	}
-	comments, err := n.comments.getComments(c.postID, 0, 999)
+	comments, err := n.comments.getComments(ctx, c.postID, 0, 999)
 	if err != nil {
 		return err
 	}
@@ -268,7 +264,7 @@ func (c commentEvent) notify(n NotificationObserver) (err error) {
 		_, ok := notified[comment.By.ID]
 		if comment.By.ID != c.userID && !ok {
 			notified[comment.By.ID] = true
-			err = n.createNotification("commented2", c.userID, comment.By.ID, c.postID, 0, c.text)
+			err = n.createNotification(ctx, "commented2", c.userID, comment.By.ID, c.postID, c.netID, c.text)
 			if err != nil {
 				return
 			}
@@ -281,11 +277,12 @@ type likeEvent struct {
 	userID      gp.UserID
 	recipientID gp.UserID
 	postID      gp.PostID
+	netID       gp.NetworkID
 }
 
-func (l likeEvent) notify(n NotificationObserver) (err error) {
+func (l likeEvent) notify(ctx context.Context, n NotificationObserver) (err error) {
 	if l.userID != l.recipientID {
-		err = n.createNotification("liked", l.userID, l.recipientID, l.postID, 0, "")
+		err = n.createNotification(ctx, "liked", l.userID, l.recipientID, l.postID, l.netID, "")
 	}
 	return err
 }
@@ -295,13 +292,17 @@ type voteEvent struct {
 	postID gp.PostID
 }
 
-func (v voteEvent) notify(n NotificationObserver) (err error) {
-	owner, err := postOwner(n.sc, v.postID)
+func (v voteEvent) notify(ctx context.Context, n NotificationObserver) (err error) {
+	owner, err := n.store.Posts.Owner(ctx, v.postID)
+	if err != nil {
+		return
+	}
+	netID, err := n.store.Posts.Network(ctx, v.postID)
 	if err != nil {
 		return
 	}
 	if v.userID != owner {
-		err = n.createNotification("poll_vote", v.userID, owner, v.postID, 0, "")
+		err = n.createNotification(ctx, "poll_vote", v.userID, owner, v.postID, netID, "")
 		if err != nil {
 			log.Println("Error creating poll_vote notification:", err)
 		}
@@ -314,13 +315,13 @@ type requestEvent struct {
 	groupID gp.NetworkID
 }
 
-func (r requestEvent) notify(n NotificationObserver) (err error) {
-	staff, err := n.nm.networkStaff(r.groupID)
+func (r requestEvent) notify(ctx context.Context, n NotificationObserver) (err error) {
+	staff, err := n.nm.networkStaff(ctx, r.groupID)
 	if err != nil {
 		return
 	}
 	for _, st := range staff {
-		err = n.createNotification("group_request", r.userID, st, 0, r.groupID, "")
+		err = n.createNotification(ctx, "group_request", r.userID, st, 0, r.groupID, "")
 		if err != nil {
 			return
 		}
@@ -329,8 +330,8 @@ func (r requestEvent) notify(n NotificationObserver) (err error) {
 }
 
 //Push takes a gleepost notification and sends it as a push notification to all of recipient's devices.
-func (n NotificationObserver) push(notification gp.Notification, recipient gp.UserID) {
-	presence, err := n.presences.getPresence(recipient)
+func (n NotificationObserver) push(ctx context.Context, notification gp.Notification, recipient gp.UserID) {
+	presence, err := n.presences.getPresence(ctx, recipient)
 	if err != nil && err != noPresence {
 		log.Println("Error getting user presence:", err)
 	}
@@ -338,32 +339,29 @@ func (n NotificationObserver) push(notification gp.Notification, recipient gp.Us
 		log.Println("Not pushing to this user (they're active on the desktop in the last 30s) (notifications.go)")
 		return
 	}
-	devices, err := getDevices(n.sc, recipient, "gleepost")
+	quiet, err := inQuietHours(ctx, n.sc, recipient)
+	if err != nil {
+		log.Println("Error checking quiet hours:", err)
+	}
+	if quiet {
+		return
+	}
+	devices, err := getDevices(ctx, n.sc, recipient, "gleepost")
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	count := 0
+	pn, err := n.toPush(ctx, notification, recipient)
+	if err != nil {
+		log.Println("Error generating push notification:", err)
+		return
+	}
 	for _, device := range devices {
-		switch {
-		case device.Type == "ios":
-			pn, err := n.toIOS(notification, recipient, device.ID)
-			if err != nil {
-				log.Println("Error generating push notification:", err)
-			}
-			err = n.pusher.IOSPush(pn)
-			if err != nil {
-				log.Println("Error sending push notification:", err)
-			} else {
-				count++
-			}
+		err = n.queue.enqueue(ctx, "gleepost", device, pn)
+		if err != nil {
+			log.Println("Error queueing push notification:", err)
 		}
 	}
-	if count == len(devices) {
-		log.Printf("Successfully sent %d notifications to %d\n", count, recipient)
-	} else {
-		log.Printf("Failed to send some notifications (%d of %d were successes) to %d\n", count, len(devices), recipient)
-	}
 }
 
 var nouns = map[string]string{
@@ -381,40 +379,40 @@ var nouns = map[string]string{
 	"added_group":   "adder-id",
 }
 
-func (n NotificationObserver) toIOS(notification gp.Notification, recipient gp.UserID, device string) (pn *apns.PushNotification, err error) {
-	payload := apns.NewPayload()
-	d := apns.NewAlertDictionary()
-	pn = apns.NewPushNotification()
-	pn.DeviceToken = device
-	badge, err := n.badgeCount(recipient)
+func (n NotificationObserver) toPush(ctx context.Context, notification gp.Notification, recipient gp.UserID) (pn push.Notification, err error) {
+	badge, err := n.badgeCount(ctx, recipient)
 	if err != nil {
 		return
 	}
-	payload.Badge = badge
-	d.LocKey = toLocKey(notification.Type)
-	d.LocArgs = []string{notification.By.Name}
+	pn.Badge = &badge
+	pn.Data = make(map[string]interface{})
+	pn.Alert.LocKey = toLocKey(notification.Type)
+	pn.Alert.LocArgs = []string{notification.By.Name}
 	if notification.Group > 0 {
 		var name string
-		name, err = groupName(n.sc, notification.Group)
+		name, err = n.store.Networks.Name(ctx, notification.Group)
 		if err != nil {
 			return
 		}
-		d.LocArgs = append(d.LocArgs, name)
-		pn.Set("group-id", notification.Group)
+		pn.Alert.LocArgs = append(pn.Alert.LocArgs, name)
+		pn.Data["group-id"] = notification.Group
 	}
 	if notification.Post > 0 {
-		pn.Set("post-id", notification.Post)
+		pn.Data["post-id"] = notification.Post
+	}
+	if notification.Count > 1 {
+		//Each push about an aggregate replaces the last.
+		pn.Data["count"] = notification.Count
+		pn.CollapseKey = fmt.Sprintf("notification-%d", notification.ID)
 	}
 	noun, ok := nouns[notification.Type]
 	if ok {
-		pn.Set(noun, notification.By.ID)
+		pn.Data[noun] = notification.By.ID
 	} else {
 		err = errors.New("Bad notification type")
 		return
 	}
-	payload.Alert = d
-	payload.Sound = "default"
-	pn.AddPayload(payload)
+	pn.Sound = "default"
 	return
 }
 
@@ -433,13 +431,13 @@ var collapseKeys = map[string]string{
 	"rejected_post": "Someone rejected your post.",
 }
 
-func (n NotificationObserver) badgeCount(user gp.UserID) (count int, err error) {
-	count, err = unreadNotificationCount(n.sc, user)
+func (n NotificationObserver) badgeCount(ctx context.Context, user gp.UserID) (count int, err error) {
+	count, err = n.store.Notifications.UnseenCount(ctx, user)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	unread, e := unreadMessageCount(n.sc, n.stats, user)
+	unread, e := unreadMessageCount(ctx, n.store.Conversations, n.stats, user)
 	if e == nil {
 		count += unread
 	} else {
@@ -449,53 +447,101 @@ func (n NotificationObserver) badgeCount(user gp.UserID) (count int, err error)
 	return
 }
 
-func unreadNotificationCount(sc *psc.StatementCache, userID gp.UserID) (count int, err error) {
-	s, err := sc.Prepare("SELECT COUNT(*) FROM notifications WHERE recipient = ? AND seen = 0 AND done = 0")
+//MarkNotificationsSeen records that this user has seen all their notifications.
+func (api *API) MarkNotificationsSeen(ctx context.Context, user gp.UserID, upTo gp.NotificationID) (err error) {
+	err = api.store.Notifications.MarkSeenUpTo(ctx, user, upTo)
+	if err == nil {
+		api.badgeChanged(user)
+	}
+	return
+}
+
+//NoSuchNotification means the notification doesn't exist, or isn't yours.
+var NoSuchNotification = gp.APIerror{Reason: "No such notification", StatusCode: 404}
+
+//TooManyNotifications is returned when you try to mark more than maxBulkNotifications notifications at once.
+var TooManyNotifications = gp.APIerror{Reason: fmt.Sprintf("You can only mark %d notifications at a time", maxBulkNotifications)}
+
+//maxBulkNotifications is how many notifications MarkNotificationIDsSeen will take at once.
+const maxBulkNotifications = 100
+
+//ownsNotification checks that notification id is one of user's.
+func (api *API) ownsNotification(ctx context.Context, user gp.UserID, id gp.NotificationID) (err error) {
+	recipient, err := api.store.Notifications.Recipient(ctx, id)
+	switch {
+	case err == sql.ErrNoRows || (err == nil && recipient != user):
+		return NoSuchNotification
+	default:
+		return
+	}
+}
+
+//SetNotificationSeen marks one of user's notifications as read, or unread again.
+func (api *API) SetNotificationSeen(ctx context.Context, user gp.UserID, id gp.NotificationID, seen bool) (err error) {
+	err = api.ownsNotification(ctx, user, id)
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(userID).Scan(&count)
+	err = api.store.Notifications.SetSeen(ctx, user, id, seen)
+	if err == nil {
+		api.badgeChanged(user)
+	}
 	return
 }
 
-//MarkNotificationsSeen records that this user has seen all their notifications.
-func (api *API) MarkNotificationsSeen(user gp.UserID, upTo gp.NotificationID) (err error) {
-	s, err := api.sc.Prepare("UPDATE notifications SET seen = 1 WHERE recipient = ? AND id <= ?")
+//MarkNotificationIDsSeen marks each of these notifications as read. Any which aren't user's are ignored.
+func (api *API) MarkNotificationIDsSeen(ctx context.Context, user gp.UserID, ids []gp.NotificationID) (err error) {
+	if len(ids) > maxBulkNotifications {
+		return TooManyNotifications
+	}
+	for _, id := range ids {
+		err = api.store.Notifications.SetSeen(ctx, user, id, true)
+		if err != nil {
+			return
+		}
+	}
+	if len(ids) > 0 {
+		api.badgeChanged(user)
+	}
+	return
+}
+
+//DeleteNotification removes one of user's notifications for good.
+func (api *API) DeleteNotification(ctx context.Context, user gp.UserID, id gp.NotificationID) (err error) {
+	err = api.ownsNotification(ctx, user, id)
 	if err != nil {
 		return
 	}
-	_, err = s.Exec(user, upTo)
+	err = api.store.Notifications.Delete(ctx, user, id)
+	if err == nil {
+		api.badgeChanged(user)
+	}
 	return
 }
 
 //CreateNotification creates a notification ntype for recipient, "from" by, with an optional post, network and preview text.
 //TODO: All this stuff should not be in the db layer.
-func (n NotificationObserver) _createNotification(ntype string, by gp.UserID, recipient gp.UserID, postID gp.PostID, netID gp.NetworkID, preview string) (notification gp.Notification, err error) {
-	var res sql.Result
-	notificationInsert := "INSERT INTO notifications (type, time, `by`, recipient, post_id, network_id, preview_text) VALUES (?, NOW(), ?, ?, ?, ?, ?)"
-	var s *sql.Stmt
+func (n NotificationObserver) _createNotification(ctx context.Context, ntype string, by gp.UserID, recipient gp.UserID, postID gp.PostID, netID gp.NetworkID, preview string) (notification gp.Notification, err error) {
 	notification = gp.Notification{
 		Type: ntype,
 		Time: time.Now().UTC(),
 		Seen: false,
 	}
-	notification.By, err = n.users.byID(by)
-	if err != nil {
-		return
-	}
-	s, err = n.sc.Prepare(notificationInsert)
+	notification.By, err = n.users.byID(ctx, by)
 	if err != nil {
 		return
 	}
-	res, err = s.Exec(ntype, by, recipient, postID, netID, preview)
+	notification.ID, err = n.store.Notifications.Create(ctx, store.StoredNotification{
+		Type:      ntype,
+		By:        by,
+		Recipient: recipient,
+		Post:      postID,
+		Group:     netID,
+		Preview:   preview,
+	}, aggregated[ntype])
 	if err != nil {
 		return
 	}
-	id, iderr := res.LastInsertId()
-	if iderr != nil {
-		return notification, iderr
-	}
-	notification.ID = gp.NotificationID(id)
 	if postID > 0 {
 		notification.Post = postID
 	}
@@ -508,22 +554,72 @@ func (n NotificationObserver) _createNotification(ntype string, by gp.UserID, re
 	return notification, nil
 }
 
-func (n NotificationObserver) networkCreator(netID gp.NetworkID) (creator gp.UserID, err error) {
-	qCreator := "SELECT creator FROM network WHERE id = ?"
-	s, err := n.sc.Prepare(qCreator)
+//aggregated are the notification types which are grouped together when they're about the same post: "Alice and 12 others liked your post".
+var aggregated = map[string]bool{
+	"liked":      true,
+	"attended":   true,
+	"poll_vote":  true,
+	"commented":  true,
+	"commented2": true,
+}
+
+//aggregationWindow is how long an unseen notification keeps gathering actors.
+const aggregationWindow = 24 * time.Hour
+
+//maxActors is how many of an aggregated notification's actors are listed.
+const maxActors = 3
+
+//aggregate folds a new notification into recipient's unseen one of the same type, about the same post, from the last aggregationWindow, if there is one.
+//The aggregate is re-inserted with by as its latest actor, taking its actors with it, and the old row is deleted: it gets a new ID, so clients paging for notifications after the last one they saw pick it up.
+//The notification it returns Replaces the old ID. ok is false if there was nothing to fold it into.
+func (n NotificationObserver) aggregate(ctx context.Context, ntype string, by gp.UserID, recipient gp.UserID, postID gp.PostID, netID gp.NetworkID, preview string) (notification gp.Notification, ok bool, err error) {
+	if !aggregated[ntype] {
+		return
+	}
+	id, old, count, err := n.store.Notifications.Aggregate(ctx, store.StoredNotification{
+		Type:      ntype,
+		By:        by,
+		Recipient: recipient,
+		Post:      postID,
+		Group:     netID,
+		Preview:   preview,
+	}, aggregationWindow)
+	if err == sql.ErrNoRows {
+		return notification, false, nil
+	}
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(netID).Scan(&creator)
-	return
+	notification = gp.Notification{ID: id, Type: ntype, Time: time.Now().UTC(), Post: postID, Group: netID, Preview: preview, Replaces: old, Count: count}
+	notification.By, err = n.users.byID(ctx, by)
+	if err != nil {
+		return notification, true, err
+	}
+	notification.Actors, err = notificationActors(ctx, n.store.Notifications, n.users, id)
+	return notification, true, err
 }
 
-func (n NotificationObserver) markRequestNotificationDone(netID gp.NetworkID, requestor gp.UserID) (err error) {
-	q := "UPDATE notifications SET done = 1 WHERE network_id = ? AND `by` = ? AND type = 'group_request'"
-	s, err := n.sc.Prepare(q)
+//notificationActors returns the most recent people an aggregated notification is about, newest first.
+func notificationActors(ctx context.Context, notifications store.Notifications, users *Users, id gp.NotificationID) (actors []gp.User, err error) {
+	ids, err := notifications.Actors(ctx, id, maxActors)
 	if err != nil {
 		return
 	}
-	_, err = s.Exec(netID, requestor)
-	return
+	for _, userID := range ids {
+		user, e := users.byID(ctx, userID)
+		if e != nil {
+			log.Println(e)
+			continue
+		}
+		actors = append(actors, user)
+	}
+	return actors, nil
+}
+
+func (n NotificationObserver) networkCreator(ctx context.Context, netID gp.NetworkID) (creator gp.UserID, err error) {
+	return n.store.Networks.Creator(ctx, netID)
+}
+
+func (n NotificationObserver) markRequestNotificationDone(ctx context.Context, netID gp.NetworkID, requestor gp.UserID) (err error) {
+	return n.store.Notifications.MarkRequestsDone(ctx, netID, requestor)
 }
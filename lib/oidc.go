@@ -0,0 +1,369 @@
+package lib
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/garyburd/redigo/redis"
+)
+
+const (
+	//How long we trust an issuer's discovery document before fetching it again.
+	oidcConfigTTL = 24 * time.Hour
+	//An unknown key id makes us refetch the issuer's keys (they've probably rotated them), but no more often than this.
+	oidcKeyRefetch = time.Minute
+	//Allowed clock drift between us and the issuer.
+	oidcLeeway = time.Minute
+	//How long a client has to finish logging in with a nonce we've issued.
+	oidcNonceTTL = 10 * time.Minute
+)
+
+var (
+	errBadIDToken = errors.New("malformed id_token")
+	errBadSig     = errors.New("id_token signature doesn't verify")
+	errNoKey      = errors.New("no such signing key")
+)
+
+//nonceConsumer checks the nonce in an id_token is one we issued, and that it hasn't been used before.
+type nonceConsumer interface {
+	consumeNonce(ctx context.Context, nonce string) bool
+}
+
+//oidcProvider is a university's OpenID Connect single sign-on.
+type oidcProvider struct {
+	name         string
+	displayName  string
+	network      gp.NetworkID
+	issuer       string
+	clientID     string
+	clientSecret string
+	discovery    *oidcDiscovery
+	nonces       nonceConsumer
+}
+
+func (p *oidcProvider) Name() string {
+	return p.name
+}
+
+func (p *oidcProvider) Network() gp.NetworkID {
+	return p.network
+}
+
+func (p *oidcProvider) Info() gp.LoginProvider {
+	info := gp.LoginProvider{Name: p.name, DisplayName: p.displayName, Type: "oidc", Issuer: p.issuer, ClientID: p.clientID}
+	config, err := p.discovery.config(p.issuer)
+	if err == nil {
+		info.AuthorizationEndpoint = config.AuthorizationEndpoint
+	}
+	return info
+}
+
+//Authenticate accepts either an id_token the client got directly, or an authorization code (and the redirect_uri it was issued to) which we exchange for one.
+func (p *oidcProvider) Authenticate(ctx context.Context, c Credential) (id Identity, err error) {
+	raw := c.Token
+	if len(raw) == 0 && len(c.Code) > 0 {
+		raw, err = p.exchange(c.Code, c.RedirectURI)
+		if err != nil {
+			log.Printf("Error exchanging %s authorization code: %v\n", p.name, err)
+			return id, BadCredential
+		}
+	}
+	if len(raw) == 0 {
+		return id, BadCredential
+	}
+	key := func(kid string) (*rsa.PublicKey, error) {
+		return p.discovery.key(p.issuer, kid)
+	}
+	claims, err := verifyIDToken(raw, p.issuer, p.clientID, key, time.Now())
+	if err != nil {
+		log.Printf("Rejected %s id_token: %v\n", p.name, err)
+		return id, BadCredential
+	}
+	//Without a nonce, anyone who got hold of an id_token could keep logging in with it until it expired.
+	if nonce, _ := claims["nonce"].(string); !p.nonces.consumeNonce(ctx, nonce) {
+		log.Printf("Rejected %s id_token: missing, unknown or reused nonce\n", p.name)
+		return id, BadCredential
+	}
+	return identityFromClaims(claims)
+}
+
+//exchange swaps an authorization code for an id_token at the issuer's token endpoint.
+func (p *oidcProvider) exchange(code, redirectURI string) (idToken string, err error) {
+	config, err := p.discovery.config(p.issuer)
+	if err != nil {
+		return
+	}
+	resp, err := p.discovery.client.PostForm(config.TokenEndpoint, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {p.clientID},
+		"client_secret": {p.clientSecret},
+	})
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %d", resp.StatusCode)
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&tokens)
+	return tokens.IDToken, err
+}
+
+//oidcConfig is the part of an issuer's discovery document we use, along with its signing keys.
+type oidcConfig struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	fetched               time.Time
+	keys                  map[string]*rsa.PublicKey
+	keysFetched           time.Time
+}
+
+//oidcDiscovery caches issuers' discovery documents and signing keys.
+//mu only guards the cache; it's never held while talking to an issuer, so one slow issuer can't hold up logins with the others.
+type oidcDiscovery struct {
+	mu      sync.Mutex
+	configs map[string]*oidcConfig
+	client  *http.Client
+}
+
+func newOIDCDiscovery() *oidcDiscovery {
+	return &oidcDiscovery{configs: make(map[string]*oidcConfig), client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (d *oidcDiscovery) config(issuer string) (config *oidcConfig, err error) {
+	d.mu.Lock()
+	config, ok := d.configs[issuer]
+	d.mu.Unlock()
+	if ok && time.Since(config.fetched) < oidcConfigTTL {
+		return config, nil
+	}
+	config = &oidcConfig{}
+	err = d.getJSON(strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", config)
+	if err != nil {
+		return
+	}
+	config.fetched = time.Now()
+	d.mu.Lock()
+	d.configs[issuer] = config
+	d.mu.Unlock()
+	return
+}
+
+//key returns the issuer's signing key with this id, refetching their keys if it's one we haven't seen.
+func (d *oidcDiscovery) key(issuer, kid string) (key *rsa.PublicKey, err error) {
+	config, err := d.config(issuer)
+	if err != nil {
+		return
+	}
+	d.mu.Lock()
+	key, ok := config.keys[kid]
+	recent := time.Since(config.keysFetched) < oidcKeyRefetch
+	d.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if recent {
+		return nil, errNoKey
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	err = d.getJSON(config.JWKSURI, &set)
+	if err != nil {
+		return
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		pub, e := k.rsaKey()
+		if e != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	//The map is replaced rather than filled in, so it's never written to while someone else reads it.
+	d.mu.Lock()
+	config.keys = keys
+	config.keysFetched = time.Now()
+	d.mu.Unlock()
+	key, ok = keys[kid]
+	if !ok {
+		return nil, errNoKey
+	}
+	return key, nil
+}
+
+func (d *oidcDiscovery) getJSON(url string, v interface{}) (err error) {
+	resp, err := d.client.Get(url)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+//jwk is an RSA public key in JSON Web Key format.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func (k jwk) rsaKey() (key *rsa.PublicKey, err error) {
+	if k.Kty != "RSA" {
+		return nil, errNoKey
+	}
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+//verifyIDToken checks an RS256-signed id_token was issued by issuer, for clientID, and hasn't expired, and returns its claims.
+func verifyIDToken(raw, issuer, clientID string, key func(kid string) (*rsa.PublicKey, error), now time.Time) (claims map[string]interface{}, err error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errBadIDToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err = decodeSegment(parts[0], &header)
+	if err != nil {
+		return
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported id_token algorithm %q", header.Alg)
+	}
+	pub, err := key(header.Kid)
+	if err != nil {
+		return
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errBadIDToken
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) != nil {
+		return nil, errBadSig
+	}
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return
+	}
+	if iss, _ := claims["iss"].(string); iss != issuer {
+		return nil, fmt.Errorf("id_token issued by %q, not %q", iss, issuer)
+	}
+	if !audienceContains(claims["aud"], clientID) {
+		return nil, errors.New("id_token wasn't issued to us")
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(oidcLeeway)) {
+		return nil, errors.New("id_token expired")
+	}
+	return claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return errBadIDToken
+	}
+	if json.Unmarshal(b, v) != nil {
+		return errBadIDToken
+	}
+	return nil
+}
+
+//audienceContains handles aud being either a single string or a list of them.
+func audienceContains(aud interface{}, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//identityFromClaims picks out the standard OpenID Connect claims we care about.
+func identityFromClaims(claims map[string]interface{}) (id Identity, err error) {
+	id.Subject, _ = claims["sub"].(string)
+	if len(id.Subject) == 0 {
+		return id, BadCredential
+	}
+	id.Email, _ = claims["email"].(string)
+	id.Email = strings.ToLower(id.Email)
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		id.EmailVerified = verified
+	case string:
+		id.EmailVerified = verified == "true"
+	}
+	id.FirstName, _ = claims["given_name"].(string)
+	id.LastName, _ = claims["family_name"].(string)
+	id.Avatar, _ = claims["picture"].(string)
+	id.Claims = claims
+	return
+}
+
+//issueNonce creates a nonce for a client to send with its authorization request; the id_token it gets back must carry it.
+func (auth *Authenticator) issueNonce(ctx context.Context) (nonce string, err error) {
+	nonce, err = randomString()
+	if err != nil {
+		return
+	}
+	conn := redisConn(ctx, auth.pool)
+	defer conn.Close()
+	_, err = conn.Do("SET", "oidc:nonce:"+nonce, 1, "EX", int(oidcNonceTTL/time.Second))
+	return
+}
+
+//consumeNonce is true if we issued this nonce and nobody has logged in with it yet. Either way, it can't be used again.
+func (auth *Authenticator) consumeNonce(ctx context.Context, nonce string) bool {
+	if len(nonce) == 0 {
+		return false
+	}
+	conn := redisConn(ctx, auth.pool)
+	defer conn.Close()
+	deleted, err := redis.Int(conn.Do("DEL", "oidc:nonce:"+nonce))
+	return err == nil && deleted == 1
+}
+
+//LoginNonce issues a nonce for an OpenID Connect login. It expires if it isn't used within oidcNonceTTL.
+func (api *API) LoginNonce(ctx context.Context) (nonce string, err error) {
+	return api.Auth.issueNonce(ctx)
+}
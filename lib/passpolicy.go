@@ -0,0 +1,103 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/Petergatsby/GleepostAPI/lib/conf"
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/password"
+)
+
+//minPersonalLength is the shortest name (or email local part) we'll look for inside a password; any shorter and we'd reject half of all passwords.
+const minPersonalLength = 3
+
+//policyErrors returns every way pass breaks the password policy, or nil if it doesn't.
+//personal is anything about the user (their names, their email address) which shouldn't appear in it.
+func policyErrors(policy conf.PasswordConfig, common password.List, pass string, personal ...string) (errs gp.ValidationErrors) {
+	fail := func(rule, reason string) {
+		errs = append(errs, gp.FieldError{Field: "pass", Rule: rule, Reason: reason})
+	}
+	if len([]rune(pass)) < policy.Min() {
+		fail("min_length", fmt.Sprintf("Password must be at least %d characters", policy.Min()))
+	}
+	var upper, lower, digit, symbol bool
+	for _, r := range pass {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r):
+			symbol = true
+		}
+	}
+	if policy.RequireUpper && !upper {
+		fail("upper", "Password must contain an upper-case letter")
+	}
+	if policy.RequireLower && !lower {
+		fail("lower", "Password must contain a lower-case letter")
+	}
+	if policy.RequireDigit && !digit {
+		fail("digit", "Password must contain a digit")
+	}
+	if policy.RequireSymbol && !symbol {
+		fail("symbol", "Password must contain a symbol")
+	}
+	if !policy.AllowPersonal && containsPersonal(pass, personal) {
+		fail("personal", "Password must not contain your name or email address")
+	}
+	if !policy.AllowCommon && common.Contains(pass) {
+		fail("common", "Password is too common")
+	}
+	return
+}
+
+func containsPersonal(pass string, personal []string) bool {
+	pass = strings.ToLower(pass)
+	for _, p := range personal {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if at := strings.Index(p, "@"); at >= 0 {
+			p = p[:at]
+		}
+		if len(p) >= minPersonalLength && strings.Contains(pass, p) {
+			return true
+		}
+	}
+	return false
+}
+
+//checkPassword checks pass against the configured policy and password list.
+func (api *API) checkPassword(pass string, personal ...string) gp.ValidationErrors {
+	return policyErrors(api.Config.Passwords, api.passwords, pass, personal...)
+}
+
+//checkNewPassword checks a new password for an existing user, returning a gp.ValidationErrors if it breaks the policy.
+func (api *API) checkNewPassword(ctx context.Context, userID gp.UserID, pass string) (err error) {
+	personal, err := api.personalDetails(ctx, userID)
+	if err != nil {
+		return
+	}
+	if errs := api.checkPassword(pass, personal...); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+//personalDetails returns the things about this user which shouldn't appear in their password.
+func (api *API) personalDetails(ctx context.Context, userID gp.UserID) (personal []string, err error) {
+	first, last, email, err := api.store.Users.Details(ctx, userID)
+	if err != nil {
+		return
+	}
+	for _, p := range []string{first, last, email} {
+		if p != "" {
+			personal = append(personal, p)
+		}
+	}
+	return
+}
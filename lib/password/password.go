@@ -0,0 +1,45 @@
+//Package password knows which passwords are too common to be allowed.
+package password
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+//List is a set of passwords nobody should be allowed to use.
+type List map[string]bool
+
+//Bundled returns the list of common and breached passwords which ships with the API.
+func Bundled() List {
+	l := make(List)
+	l.add(strings.NewReader(bundled))
+	return l
+}
+
+//Load adds every line of the file at path to the list.
+func (l List) Load(path string) (err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return l.add(f)
+}
+
+func (l List) add(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) > 0 {
+			l[strings.ToLower(line)] = true
+		}
+	}
+	return scanner.Err()
+}
+
+//Contains returns true if pass is on the list. Case doesn't matter.
+func (l List) Contains(pass string) bool {
+	return l[strings.ToLower(pass)]
+}
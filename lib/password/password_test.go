@@ -0,0 +1,15 @@
+package password
+
+import "testing"
+
+func TestContains(t *testing.T) {
+	l := Bundled()
+	for _, pass := range []string{"password", "Password", "QWERTY", "letmein"} {
+		if !l.Contains(pass) {
+			t.Fatalf("%s should be on the bundled list", pass)
+		}
+	}
+	if l.Contains("correct horse battery staple") {
+		t.Fatalf("That one's fine")
+	}
+}
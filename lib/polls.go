@@ -1,11 +1,13 @@
 package lib
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strconv"
 	"time"
 
+	"github.com/Petergatsby/GleepostAPI/lib/events"
 	"github.com/Petergatsby/GleepostAPI/lib/gp"
 	"github.com/go-sql-driver/mysql"
 )
@@ -71,25 +73,25 @@ func validatePollInput(expiry time.Time, pollOptions []string) (err error) {
 	return
 }
 
-func (api *API) getPoll(postID gp.PostID) (poll gp.Poll, err error) {
-	poll.Expiry, err = api.getPollExpiry(postID)
+func (api *API) getPoll(ctx context.Context, postID gp.PostID) (poll gp.Poll, err error) {
+	poll.Expiry, err = api.getPollExpiry(ctx, postID)
 	if err != nil {
 		return
 	}
-	poll.Options, err = api.getPollOptions(postID)
+	poll.Options, err = api.getPollOptions(ctx, postID)
 	if err != nil {
 		return
 	}
-	poll.Votes, err = api.getPollVotes(postID)
+	poll.Votes, err = api.getPollVotes(ctx, postID)
 	return
 }
 
-func (api *API) userGetPoll(userID gp.UserID, postID gp.PostID) (poll gp.SubjectivePoll, err error) {
-	poll.Poll, err = api.getPoll(postID)
+func (api *API) userGetPoll(ctx context.Context, userID gp.UserID, postID gp.PostID) (poll gp.SubjectivePoll, err error) {
+	poll.Poll, err = api.getPoll(ctx, postID)
 	if err != nil {
 		return
 	}
-	vote, err := api.getUserVote(userID, postID)
+	vote, err := api.getUserVote(ctx, userID, postID)
 	if err == nil {
 		poll.YourVote = vote
 	}
@@ -97,12 +99,12 @@ func (api *API) userGetPoll(userID gp.UserID, postID gp.PostID) (poll gp.Subject
 }
 
 //UserCastVote records this user's vote, or errors if this is not a poll
-func (api *API) UserCastVote(userID gp.UserID, postID gp.PostID, option int) (err error) {
-	canView, err := api.canViewPost(userID, postID)
+func (api *API) UserCastVote(ctx context.Context, userID gp.UserID, postID gp.PostID, option int) (err error) {
+	canView, err := api.canViewPost(ctx, userID, postID)
 	if err != nil || !canView {
 		return ENOTALLOWED
 	}
-	poll, err := api.getPoll(postID)
+	poll, err := api.getPoll(ctx, postID)
 	if err != nil {
 		//Assuming error means not a poll, but could in fact be eg. db down
 		return NotAPoll
@@ -113,11 +115,11 @@ func (api *API) UserCastVote(userID gp.UserID, postID gp.PostID, option int) (er
 	if time.Now().After(poll.Expiry) {
 		return PollExpired
 	}
-	err = api.userCastVote(userID, postID, option)
+	err = api.userCastVote(ctx, userID, postID, option)
 	if err == nil {
-		poll, err = api.getPoll(postID)
+		poll, err = api.getPoll(ctx, postID)
 		if err == nil {
-			go api.broker.PublishEvent("vote", "/posts/"+strconv.Itoa(int(postID)), poll, []string{PostChannel(postID)})
+			go api.broker.PublishEvent(events.Vote, "/posts/"+strconv.Itoa(int(postID)), poll, []string{PostChannel(postID)})
 		} else {
 			log.Println("Problem getting poll:", err)
 		}
@@ -127,12 +129,12 @@ func (api *API) UserCastVote(userID gp.UserID, postID gp.PostID, option int) (er
 }
 
 //SavePoll adds this poll to this post.
-func (api *API) savePoll(postID gp.PostID, pollExpiry time.Time, pollOptions []string) (err error) {
+func (api *API) savePoll(ctx context.Context, postID gp.PostID, pollExpiry time.Time, pollOptions []string) (err error) {
 	s, err := api.sc.Prepare("INSERT INTO post_polls (post_id, expiry_time) VALUES (?, ?)")
 	if err != nil {
 		return
 	}
-	_, err = s.Exec(postID, pollExpiry.Format(mysqlTime))
+	_, err = s.ExecContext(ctx, postID, pollExpiry.Format(mysqlTime))
 	if err != nil {
 		return
 	}
@@ -141,7 +143,7 @@ func (api *API) savePoll(postID gp.PostID, pollExpiry time.Time, pollOptions []s
 		return
 	}
 	for i, opt := range pollOptions {
-		_, err = s.Exec(postID, i, opt)
+		_, err = s.ExecContext(ctx, postID, i, opt)
 		if err != nil {
 			return
 		}
@@ -150,13 +152,13 @@ func (api *API) savePoll(postID gp.PostID, pollExpiry time.Time, pollOptions []s
 }
 
 //GetPollExpiry returns this poll's expiry time -- or err if this is not a poll.
-func (api *API) getPollExpiry(postID gp.PostID) (expiry time.Time, err error) {
+func (api *API) getPollExpiry(ctx context.Context, postID gp.PostID) (expiry time.Time, err error) {
 	s, err := api.sc.Prepare("SELECT expiry_time FROM post_polls WHERE post_id = ?")
 	if err != nil {
 		return
 	}
 	var t string
-	err = s.QueryRow(postID).Scan(&t)
+	err = s.QueryRowContext(ctx, postID).Scan(&t)
 	if err != nil {
 		return
 	}
@@ -165,12 +167,12 @@ func (api *API) getPollExpiry(postID gp.PostID) (expiry time.Time, err error) {
 }
 
 //GetPollOptions returns this poll's options -- or err if this is not a poll.
-func (api *API) getPollOptions(postID gp.PostID) (options []string, err error) {
+func (api *API) getPollOptions(ctx context.Context, postID gp.PostID) (options []string, err error) {
 	s, err := api.sc.Prepare("SELECT `option` FROM poll_options WHERE post_id = ? ORDER BY option_id ASC")
 	if err != nil {
 		return
 	}
-	rows, err := s.Query(postID)
+	rows, err := s.QueryContext(ctx, postID)
 	if err != nil {
 		return
 	}
@@ -187,13 +189,13 @@ func (api *API) getPollOptions(postID gp.PostID) (options []string, err error) {
 }
 
 //GetPollVotes returns a map of option-name:vote count for this poll, or err if this is not a poll.
-func (api *API) getPollVotes(postID gp.PostID) (votes map[string]int, err error) {
+func (api *API) getPollVotes(ctx context.Context, postID gp.PostID) (votes map[string]int, err error) {
 	votes = make(map[string]int)
 	s, err := api.sc.Prepare("SELECT COUNT(*) as votes, `option` FROM poll_votes JOIN poll_options ON poll_votes.option_id = poll_options.option_id WHERE poll_votes.post_id = ? AND poll_votes.post_id = poll_options.post_id GROUP BY poll_votes.option_id")
 	if err != nil {
 		return
 	}
-	rows, err := s.Query(postID)
+	rows, err := s.QueryContext(ctx, postID)
 	if err != nil {
 		return
 	}
@@ -211,22 +213,22 @@ func (api *API) getPollVotes(postID gp.PostID) (votes map[string]int, err error)
 }
 
 //GetUserVote returns the way this user voted in this poll.
-func (api *API) getUserVote(userID gp.UserID, postID gp.PostID) (vote string, err error) {
+func (api *API) getUserVote(ctx context.Context, userID gp.UserID, postID gp.PostID) (vote string, err error) {
 	s, err := api.sc.Prepare("SELECT `option` FROM poll_votes JOIN poll_options ON poll_votes.option_id = poll_options.option_id WHERE poll_votes.post_id = ? AND poll_votes.post_id = poll_options.post_id AND poll_votes.user_id = ?")
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(postID, userID).Scan(&vote)
+	err = s.QueryRowContext(ctx, postID, userID).Scan(&vote)
 	return
 }
 
 //UserCastVote records this user's vote in this poll.
-func (api *API) userCastVote(userID gp.UserID, postID gp.PostID, option int) (err error) {
+func (api *API) userCastVote(ctx context.Context, userID gp.UserID, postID gp.PostID, option int) (err error) {
 	s, err := api.sc.Prepare("INSERT INTO poll_votes (post_id, option_id, user_id) VALUES (?, ?, ?)")
 	if err != nil {
 		return
 	}
-	_, err = s.Exec(postID, option, userID)
+	_, err = s.ExecContext(ctx, postID, option, userID)
 	if err != nil {
 		if err, ok := err.(*mysql.MySQLError); ok {
 			if err.Number == 1062 {
@@ -1,14 +1,16 @@
 package lib
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"strconv"
 	"time"
 
+	"github.com/Petergatsby/GleepostAPI/lib/events"
 	"github.com/Petergatsby/GleepostAPI/lib/gp"
-	"github.com/Petergatsby/GleepostAPI/lib/psc"
+	"github.com/Petergatsby/GleepostAPI/lib/store"
 )
 
 const (
@@ -44,76 +46,76 @@ var (
 )
 
 //UserGetPost returns the post identified by postId, if the user is allowed to access it; otherwise, ENOTALLOWED.
-func (api *API) UserGetPost(userID gp.UserID, postID gp.PostID) (post gp.PostFull, err error) {
-	canView, err := api.canViewPost(userID, postID)
+func (api *API) UserGetPost(ctx context.Context, userID gp.UserID, postID gp.PostID) (post gp.PostFull, err error) {
+	canView, err := api.canViewPost(ctx, userID, postID)
 	switch {
 	case err != nil:
 		return post, err
 	case !canView:
 		return post, &ENOTALLOWED
 	default:
-		return api.getPostFull(userID, postID)
+		return api.getPostFull(ctx, userID, postID)
 	}
 }
 
-func (api *API) canViewPost(userID gp.UserID, postID gp.PostID) (canView bool, err error) {
-	p, err := api.getPostFull(userID, postID)
+func (api *API) canViewPost(ctx context.Context, userID gp.UserID, postID gp.PostID) (canView bool, err error) {
+	p, err := api.getPostFull(ctx, userID, postID)
 	if err != nil {
 		return
 	}
-	in, err := api.UserInNetwork(userID, p.Network)
+	in, err := api.UserInNetwork(ctx, userID, p.Network)
 	return in, err
 }
 
-func (api *API) getPostFull(userID gp.UserID, postID gp.PostID) (post gp.PostFull, err error) {
-	post.Post, err = api.userGetPost(userID, postID)
+func (api *API) getPostFull(ctx context.Context, userID gp.UserID, postID gp.PostID) (post gp.PostFull, err error) {
+	post.Post, err = api.userGetPost(ctx, userID, postID)
 	if err != nil {
 		return
 	}
-	post.Categories, err = api.postCategories(postID)
+	post.Categories, err = api.postCategories(ctx, postID)
 	if err != nil {
 		return
 	}
 	for _, c := range post.Categories {
 		if c.Tag == "event" {
 			//Don't squelch the error. Those things are useful as it turns out.
-			post.Popularity, post.Attendees, err = api.getEventPopularity(postID)
+			post.Popularity, post.Attendees, err = api.getEventPopularity(ctx, postID)
 			if err != nil {
 				log.Println("Error getting popularity:", err)
 			}
 			break
 		}
 	}
-	post.Attribs, err = api.getPostAttribs(postID)
+	post.Attribs, err = api.getPostAttribs(ctx, postID)
 	if err != nil {
 		return
 	}
-	post.CommentCount = api.getCommentCount(postID)
-	post.Comments, err = api.comments.getComments(postID, 0, api.Config.CommentPageSize)
+	post.CommentCount = api.getCommentCount(ctx, postID)
+	post.Comments, err = api.comments.getComments(ctx, postID, 0, api.Config.CommentPageSize)
 	if err != nil {
 		return
 	}
-	post.LikeCount, post.Likes, err = api.likesAndCount(postID)
+	post.LikeCount, post.Likes, err = api.likesAndCount(ctx, postID)
 	if err != nil {
 		return
 	}
 	if post.By.ID == userID {
-		post.ReviewHistory, err = api.reviewHistory(post.ID)
+		post.ReviewHistory, err = api.reviewHistory(ctx, post.ID)
 		if err != nil {
 			return
 		}
 	}
-	post.Views, err = api.Viewer.postViewCount(postID)
+	post.Views, err = api.Viewer.postViewCount(ctx, postID)
 	if err != nil {
 		log.Println(err)
 		err = nil
 	}
-	post.Attending, err = api.isAttending(userID, postID)
+	post.Attending, err = api.isAttending(ctx, userID, postID)
 	if err != nil {
 		log.Println(err)
 		err = nil
 	}
-	poll, err := api.userGetPoll(userID, postID)
+	poll, err := api.userGetPoll(ctx, userID, postID)
 	if err == nil {
 		post.Poll = &poll
 	}
@@ -135,7 +137,7 @@ func parseTime(tstring string) (t time.Time, err error) {
 }
 
 //UserGetLiveSummary gives a summary of the upcoming events in this user's university.
-func (api *API) UserGetLiveSummary(userID gp.UserID, after, until string) (summary gp.LiveSummary, err error) {
+func (api *API) UserGetLiveSummary(ctx context.Context, userID gp.UserID, after, until string) (summary gp.LiveSummary, err error) {
 	afterTime, err := parseTime(after)
 	if err != nil {
 		return
@@ -144,54 +146,20 @@ func (api *API) UserGetLiveSummary(userID gp.UserID, after, until string) (summa
 	if err != nil {
 		return
 	}
-	primary, err := api.getUserUniversity(userID)
+	primary, err := api.getUserUniversity(ctx, userID)
 	if err != nil {
 		return
 	}
 
-	return api.getLiveSummary(primary.ID, afterTime, untilTime)
+	return api.getLiveSummary(ctx, primary.ID, afterTime, untilTime)
 }
 
-func (api *API) getLiveSummary(netID gp.NetworkID, after, until time.Time) (summary gp.LiveSummary, err error) {
-	q := "SELECT COUNT(*) FROM wall_posts " +
-		"JOIN post_attribs ON wall_posts.id = post_attribs.post_id " +
-		"WHERE deleted = 0 AND pending = 0 AND network_id = ? AND attrib = 'event-time' AND value > ? AND value < ? "
-	totalStmt, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	err = totalStmt.QueryRow(netID, after.Unix(), until.Unix()).Scan(&summary.Posts)
-	if err != nil {
-		return
-	}
-	q = "SELECT categories.tag, COUNT(*) FROM wall_posts " +
-		"JOIN post_attribs ON wall_posts.id = post_attribs.post_id " + categoryClause +
-		"WHERE deleted = 0 AND pending = 0 AND network_id = ? AND attrib = 'event-time' AND value > ? AND value < ? " +
-		"GROUP BY categories.tag"
-	catsStmt, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	rows, err := catsStmt.Query(netID, after.Unix(), until.Unix())
-	if err != nil {
-		return
-	}
-	defer rows.Close()
-	summary.CatCounts = make(map[string]int)
-	for rows.Next() {
-		var cat string
-		var count int
-		err = rows.Scan(&cat, &count)
-		if err != nil {
-			return
-		}
-		summary.CatCounts[cat] = count
-	}
-	return
+func (api *API) getLiveSummary(ctx context.Context, netID gp.NetworkID, after, until time.Time) (summary gp.LiveSummary, err error) {
+	return api.store.Posts.LiveSummary(ctx, netID, after, until)
 }
 
 //UserGetLive gets the live events (soonest first, starting from after) from the perspective of userId.
-func (api *API) UserGetLive(userID gp.UserID, after, until string, count int, category string) (posts []gp.PostSmall, err error) {
+func (api *API) UserGetLive(ctx context.Context, userID gp.UserID, after, until string, count int, category string) (posts []gp.PostSmall, err error) {
 	posts = make([]gp.PostSmall, 0)
 	afterTime, err := parseTime(after)
 	if err != nil {
@@ -201,22 +169,22 @@ func (api *API) UserGetLive(userID gp.UserID, after, until string, count int, ca
 	if err != nil {
 		untilTime = time.Now().AddDate(10, 0, 0).UTC()
 	}
-	primary, err := api.getUserUniversity(userID)
+	primary, err := api.getUserUniversity(ctx, userID)
 	if err != nil {
 		return
 	}
-	return api.getLive(primary.ID, afterTime, untilTime, count, userID, category)
+	return api.getLive(ctx, primary.ID, afterTime, untilTime, count, userID, category)
 }
 
 //getLive returns the first count events happening after after, within network netId.
-func (api *API) getLive(netID gp.NetworkID, after, until time.Time, count int, userID gp.UserID, category string) (posts []gp.PostSmall, err error) {
+func (api *API) getLive(ctx context.Context, netID gp.NetworkID, after, until time.Time, count int, userID gp.UserID, category string) (posts []gp.PostSmall, err error) {
 	posts = make([]gp.PostSmall, 0)
-	posts, err = api._getLive(netID, after, until, count, category)
+	posts, err = api._getLive(ctx, netID, after, until, count, category)
 	if err != nil {
 		return
 	}
 	for i := range posts {
-		processed, err := api.postProcess(posts[i], userID)
+		processed, err := api.postProcess(ctx, posts[i], userID)
 		if err == nil {
 			posts[i] = processed
 		}
@@ -225,14 +193,14 @@ func (api *API) getLive(netID gp.NetworkID, after, until time.Time, count int, u
 }
 
 //GetUserPosts returns the count most recent posts by userId since post `after`.
-func (api *API) GetUserPosts(userID gp.UserID, perspective gp.UserID, mode int, index int64, count int, category string) (posts []gp.PostSmall, err error) {
+func (api *API) GetUserPosts(ctx context.Context, userID gp.UserID, perspective gp.UserID, mode int, index int64, count int, category string) (posts []gp.PostSmall, err error) {
 	posts = make([]gp.PostSmall, 0)
-	posts, err = api.getUserPosts(userID, perspective, mode, index, count, category)
+	posts, err = api.getUserPosts(ctx, userID, perspective, mode, index, count, category)
 	if err != nil {
 		return
 	}
 	for i := range posts {
-		processed, err := api.postProcess(posts[i], perspective)
+		processed, err := api.postProcess(ctx, posts[i], perspective)
 		if err == nil {
 			posts[i] = processed
 		}
@@ -241,36 +209,36 @@ func (api *API) GetUserPosts(userID gp.UserID, perspective gp.UserID, mode int,
 }
 
 //UserGetPrimaryNetworkPosts returns the posts in the user's primary network (ie, their university)
-func (api *API) UserGetPrimaryNetworkPosts(userID gp.UserID, mode int, index int64, count int, category string) (posts []gp.PostSmall, err error) {
-	primary, err := api.getUserUniversity(userID)
+func (api *API) UserGetPrimaryNetworkPosts(ctx context.Context, userID gp.UserID, mode int, index int64, count int, category string) (posts []gp.PostSmall, err error) {
+	primary, err := api.getUserUniversity(ctx, userID)
 	if err != nil {
 		return
 	}
-	return api.UserGetNetworkPosts(userID, primary.ID, mode, index, count, category)
+	return api.UserGetNetworkPosts(ctx, userID, primary.ID, mode, index, count, category)
 }
 
 //UserGetNetworkPosts returns the posts in netId if userId can access it, or ENOTALLOWED otherwise.
-func (api *API) UserGetNetworkPosts(userID gp.UserID, netID gp.NetworkID, mode int, index int64, count int, category string) (posts []gp.PostSmall, err error) {
+func (api *API) UserGetNetworkPosts(ctx context.Context, userID gp.UserID, netID gp.NetworkID, mode int, index int64, count int, category string) (posts []gp.PostSmall, err error) {
 	posts = make([]gp.PostSmall, 0)
-	in, err := api.UserInNetwork(userID, netID)
+	in, err := api.UserInNetwork(ctx, userID, netID)
 	switch {
 	case err != nil:
 		return posts, err
 	case !in:
 		return posts, &ENOTALLOWED
 	default:
-		return api.getPosts(netID, mode, index, count, category, userID)
+		return api.getPosts(ctx, netID, mode, index, count, category, userID)
 	}
 }
 
-func (api *API) getPosts(netID gp.NetworkID, mode int, index int64, count int, category string, userID gp.UserID) (posts []gp.PostSmall, err error) {
+func (api *API) getPosts(ctx context.Context, netID gp.NetworkID, mode int, index int64, count int, category string, userID gp.UserID) (posts []gp.PostSmall, err error) {
 	posts = make([]gp.PostSmall, 0)
-	posts, err = api._getPosts(netID, mode, index, count, category)
+	posts, err = api._getPosts(ctx, netID, mode, index, count, category, userID)
 	if err != nil {
 		return
 	}
 	for i := range posts {
-		processed, err := api.postProcess(posts[i], userID)
+		processed, err := api.postProcess(ctx, posts[i], userID)
 		if err == nil {
 			posts[i] = processed
 		} else {
@@ -281,14 +249,14 @@ func (api *API) getPosts(netID gp.NetworkID, mode int, index int64, count int, c
 }
 
 //UserGetGroupsPosts returns up to count posts from this user's user-groups (ie, networks which aren't universities). Acts exactly the same as GetPosts in other respects, except that it will also populate the post's Group attribute.
-func (api *API) UserGetGroupsPosts(user gp.UserID, mode int, index int64, count int, category string) (posts []gp.PostSmall, err error) {
+func (api *API) UserGetGroupsPosts(ctx context.Context, user gp.UserID, mode int, index int64, count int, category string) (posts []gp.PostSmall, err error) {
 	posts = make([]gp.PostSmall, 0)
-	posts, err = api.userGetGroupsPosts(user, mode, index, count, category)
+	posts, err = api.userGetGroupsPosts(ctx, user, mode, index, count, category)
 	if err != nil {
 		return
 	}
 	for i := range posts {
-		processed, err := api.postProcess(posts[i], user)
+		processed, err := api.postProcess(ctx, posts[i], user)
 		if err == nil {
 			posts[i] = processed
 		} else {
@@ -300,38 +268,38 @@ func (api *API) UserGetGroupsPosts(user gp.UserID, mode int, index int64, count
 }
 
 //postProcess fetches all the parts of a post which the newGetPosts style methods don't provide
-func (api *API) postProcess(post gp.PostSmall, userID gp.UserID) (processed gp.PostSmall, err error) {
+func (api *API) postProcess(ctx context.Context, post gp.PostSmall, userID gp.UserID) (processed gp.PostSmall, err error) {
 	//Ha! I am so funny...
 	processed = post
-	processed.Likes, err = api.getLikes(processed.ID)
+	processed.Likes, err = api.getLikes(ctx, processed.ID)
 	if err != nil {
 		return
 	}
-	processed.Attribs, err = api.getPostAttribs(processed.ID)
+	processed.Attribs, err = api.getPostAttribs(ctx, processed.ID)
 	if err != nil {
 		return
 	}
-	processed.Categories, err = api.postCategories(processed.ID)
+	processed.Categories, err = api.postCategories(ctx, processed.ID)
 	if err != nil {
 		return
 	}
 	for _, c := range processed.Categories {
 		if c.Tag == "event" {
 			//Don't squelch the error, that shit's useful yo
-			processed.Popularity, processed.Attendees, err = api.getEventPopularity(processed.ID)
+			processed.Popularity, processed.Attendees, err = api.getEventPopularity(ctx, processed.ID)
 			if err != nil {
 				log.Println(err)
 			}
 			break
 		}
 	}
-	processed.Views, err = api.Viewer.postViewCount(processed.ID)
+	processed.Views, err = api.Viewer.postViewCount(ctx, processed.ID)
 	if err != nil {
 		log.Println(err)
 		err = nil
 	}
-	processed.Attending, err = api.isAttending(userID, processed.ID)
-	poll, err := api.userGetPoll(userID, processed.ID)
+	processed.Attending, err = api.isAttending(ctx, userID, processed.ID)
+	poll, err := api.userGetPoll(ctx, userID, processed.ID)
 	if err == nil {
 		processed.Poll = &poll
 	}
@@ -340,13 +308,13 @@ func (api *API) postProcess(post gp.PostSmall, userID gp.UserID) (processed gp.P
 
 //UserGetComments returns comments for this post, chronologically ordered starting from the start-th.
 //If you are unable to view this post, it will return ENOTALLOWED
-func (api *API) UserGetComments(userID gp.UserID, postID gp.PostID, start int64, count int) (comments []gp.Comment, err error) {
+func (api *API) UserGetComments(ctx context.Context, userID gp.UserID, postID gp.PostID, start int64, count int) (comments []gp.Comment, err error) {
 	comments = make([]gp.Comment, 0)
-	p, err := api.getPostFull(userID, postID)
+	p, err := api.getPostFull(ctx, userID, postID)
 	if err != nil {
 		return
 	}
-	in, err := api.UserInNetwork(userID, p.Network)
+	in, err := api.UserInNetwork(ctx, userID, p.Network)
 	switch {
 	case err != nil:
 		return comments, err
@@ -354,17 +322,13 @@ func (api *API) UserGetComments(userID gp.UserID, postID gp.PostID, start int64,
 		log.Printf("User %d not in %d\n", userID, p.Network)
 		return comments, &ENOTALLOWED
 	default:
-		return api.comments.getComments(postID, start, count)
+		return api.comments.getComments(ctx, postID, start, count)
 	}
 }
 
 //GetCommentCount returns the total number of comments for this post
-func (api *API) getCommentCount(id gp.PostID) (count int) {
-	s, err := api.sc.Prepare("SELECT COUNT(*) FROM post_comments WHERE post_id = ?")
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(id).Scan(&count)
+func (api *API) getCommentCount(ctx context.Context, id gp.PostID) (count int) {
+	count, err := api.store.Posts.CommentCount(ctx, id)
 	if err != nil {
 		return 0
 	}
@@ -372,155 +336,66 @@ func (api *API) getCommentCount(id gp.PostID) (count int) {
 }
 
 //GetPostImages returns all the images attached to postID.
-func (api *API) getPostImages(postID gp.PostID) (images []string) {
+func (api *API) getPostImages(ctx context.Context, postID gp.PostID) (images []string) {
 	defer api.Statsd.Time(time.Now(), "gleepost.postImages.byPostID.db")
-	s, err := api.sc.Prepare("SELECT url FROM post_images WHERE post_id = ?")
+	images, err := api.store.Posts.Images(ctx, postID)
 	if err != nil {
 		log.Println(err)
-		return
-	}
-	rows, err := s.Query(postID)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var image string
-		err = rows.Scan(&image)
-		if err != nil {
-			log.Println(err)
-			return
-		}
-		images = append(images, image)
 	}
 	return
 }
 
 //GetPostVideos returns all the videos attached to postID.
-func (api *API) getPostVideos(postID gp.PostID) (videos []gp.Video) {
+func (api *API) getPostVideos(ctx context.Context, postID gp.PostID) (videos []gp.Video) {
 	defer api.Statsd.Time(time.Now(), "gleepost.postVideos.byPostID.db")
-	s, err := api.sc.Prepare("SELECT url, mp4_url, webm_url FROM uploads JOIN post_videos ON upload_id = video_id WHERE post_id = ? AND status = 'ready'")
+	videos, err := api.store.Posts.Videos(ctx, postID)
 	if err != nil {
 		log.Println(err)
-		return
-	}
-	rows, err := s.Query(postID)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-	defer rows.Close()
-	var thumb, mp4, webm sql.NullString
-	for rows.Next() {
-		err = rows.Scan(&thumb, &mp4, &webm)
-		if err != nil {
-			log.Println(err)
-			return
-		}
-		video := gp.Video{}
-		if mp4.Valid {
-			video.MP4 = mp4.String
-		}
-		if webm.Valid {
-			video.WebM = webm.String
-		}
-		if thumb.Valid {
-			video.Thumbs = append(video.Thumbs, thumb.String)
-		}
-		videos = append(videos, video)
 	}
 	return
 }
 
 //PostCategories returns all the categories which post belongs to.
-func (api *API) postCategories(post gp.PostID) (categories []gp.PostCategory, err error) {
-	s, err := api.sc.Prepare("SELECT categories.id, categories.tag, categories.name FROM post_categories JOIN categories ON post_categories.category_id = categories.id WHERE post_categories.post_id = ?")
-	if err != nil {
-		return
-	}
-	rows, err := s.Query(post)
-	if err != nil {
-		return
-	}
-	defer rows.Close()
-	for rows.Next() {
-		c := gp.PostCategory{}
-		err = rows.Scan(&c.ID, &c.Tag, &c.Name)
-		if err != nil {
-			return
-		}
-		categories = append(categories, c)
-	}
-	return
+func (api *API) postCategories(ctx context.Context, post gp.PostID) (categories []gp.PostCategory, err error) {
+	return api.store.Posts.Categories(ctx, post)
 }
 
 //GetLikes returns all the likes for a particular post.
-func (api *API) getLikes(post gp.PostID) (likes []gp.LikeFull, err error) {
+func (api *API) getLikes(ctx context.Context, post gp.PostID) (likes []gp.LikeFull, err error) {
 	defer api.Statsd.Time(time.Now(), "gleepost.likes.byPostID.db")
-	s, err := api.sc.Prepare("SELECT user_id, timestamp FROM post_likes WHERE post_id = ?")
+	stored, err := api.store.Posts.Likes(ctx, post)
 	if err != nil {
 		return
 	}
-	rows, err := s.Query(post)
-	if err != nil {
-		return
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var t string
-		var like gp.LikeFull
-		var userID gp.UserID
-		err = rows.Scan(&userID, &t)
+	for _, l := range stored {
+		like := gp.LikeFull{Time: l.Time}
+		like.User, err = api.users.byID(ctx, l.UserID)
 		if err != nil {
-			return
-		}
-		like.Time, err = time.Parse(mysqlTime, t)
-		if err != nil {
-			return
-		}
-		like.User, err = api.users.byID(userID)
-		if err != nil {
-			log.Println("Bad like: no such user:", userID)
+			log.Println("Bad like: no such user:", l.UserID)
 			continue
 		}
 		likes = append(likes, like)
 	}
-	return
-}
-
-//HasLiked retuns true if this user has already liked this post.
-func (api *API) hasLiked(user gp.UserID, post gp.PostID) (liked bool, err error) {
-	s, err := api.sc.Prepare("SELECT COUNT(*) FROM post_likes WHERE post_id = ? AND user_id = ?")
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(post, user).Scan(&liked)
-	return
+	return likes, nil
 }
 
 //LikeCount returns the number of likes this post has.
-func (api *API) likeCount(post gp.PostID) (count int, err error) {
-	s, err := api.sc.Prepare("SELECT COUNT(*) FROM post_likes WHERE post_id = ?")
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(post).Scan(&count)
-	return
+func (api *API) likeCount(ctx context.Context, post gp.PostID) (count int, err error) {
+	return api.store.Posts.LikeCount(ctx, post)
 }
 
 //LikesAndCount retrieves both the likes and the total count of likes for a post.
-func (api *API) likesAndCount(post gp.PostID) (count int, likes []gp.LikeFull, err error) {
-	likes, err = api.getLikes(post)
+func (api *API) likesAndCount(ctx context.Context, post gp.PostID) (count int, likes []gp.LikeFull, err error) {
+	likes, err = api.getLikes(ctx, post)
 	if err != nil {
 		return
 	}
-	count, err = api.likeCount(post)
+	count, err = api.likeCount(ctx, post)
 	return
 }
 
 //CreateComment adds a comment to a post.
-func (api *API) CreateComment(postID gp.PostID, userID gp.UserID, text string) (commID gp.CommentID, err error) {
+func (api *API) CreateComment(ctx context.Context, postID gp.PostID, userID gp.UserID, text string) (commID gp.CommentID, err error) {
 	if len(text) == 0 {
 		err = CommentTooShort
 		return
@@ -528,11 +403,11 @@ func (api *API) CreateComment(postID gp.PostID, userID gp.UserID, text string) (
 		err = CommentTooLong
 		return
 	}
-	post, err := api.getPost(postID)
+	post, err := api.getPost(ctx, postID)
 	if err != nil {
 		return
 	}
-	in, err := api.UserInNetwork(userID, post.Network)
+	in, err := api.UserInNetwork(ctx, userID, post.Network)
 	switch {
 	case err != nil:
 		return
@@ -540,32 +415,32 @@ func (api *API) CreateComment(postID gp.PostID, userID gp.UserID, text string) (
 		err = &ENOTALLOWED
 		return
 	default:
-		commID, err = api.createComment(postID, userID, text)
+		commID, err = api.createComment(ctx, postID, userID, text)
 		if err == nil {
-			api.notifObserver.Notify(commentEvent{userID: userID, recipientID: post.By.ID, postID: postID, text: text})
+			api.notifObserver.Notify(commentEvent{userID: userID, recipientID: post.By.ID, postID: postID, netID: post.Network, text: text})
 			comment := gp.Comment{ID: commID, Post: postID, Time: time.Now().UTC(), Text: text}
-			comment.By, err = api.users.byID(userID)
+			comment.By, err = api.users.byID(ctx, userID)
 			if err != nil {
 				log.Println(err)
 				return
 			}
-			go api.broker.PublishEvent("comment", "/posts/"+strconv.Itoa(int(postID)), comment, []string{PostChannel(postID)})
+			go api.broker.PublishEvent(events.Comment, "/posts/"+strconv.Itoa(int(postID)), comment, []string{PostChannel(postID)})
 		}
 		return commID, err
 	}
 }
 
 //UserAddPostImage adds an image (by url) to a post.
-func (api *API) UserAddPostImage(userID gp.UserID, postID gp.PostID, url string) (images []string, err error) {
-	post, err := api.getPost(postID)
+func (api *API) UserAddPostImage(ctx context.Context, userID gp.UserID, postID gp.PostID, url string) (images []string, err error) {
+	post, err := api.getPost(ctx, postID)
 	if err != nil {
 		return
 	}
-	exists, err := api.userUploadExists(userID, url)
+	exists, err := api.userUploadExists(ctx, userID, url)
 	if !exists || err != nil {
 		return nil, NoSuchUpload
 	}
-	in, err := api.UserInNetwork(userID, post.Network)
+	in, err := api.UserInNetwork(ctx, userID, post.Network)
 	switch {
 	case err != nil:
 		return
@@ -576,74 +451,56 @@ func (api *API) UserAddPostImage(userID gp.UserID, postID gp.PostID, url string)
 		err = ENOTALLOWED
 		return
 	default:
-		err = api.addPostImage(postID, url)
+		err = api.addPostImage(ctx, postID, url)
 		if err == nil {
-			return api.getPostImages(postID), nil
+			return api.getPostImages(ctx, postID), nil
 		}
 		return
 	}
 }
 
 //AddPostImage adds an image (url) to postID.
-func (api *API) addPostImage(postID gp.PostID, url string) (err error) {
-	s, err := api.sc.Prepare("INSERT INTO post_images (post_id, url) VALUES (?, ?)")
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(postID, url)
-	return
+func (api *API) addPostImage(ctx context.Context, postID gp.PostID, url string) (err error) {
+	return api.store.Posts.AddImage(ctx, postID, url)
 }
 
 //AddPostVideo attaches a URL of a video file to a post.
-func (api *API) addPostVideo(userID gp.UserID, postID gp.PostID, videoID gp.VideoID) (err error) {
-	s, err := api.sc.Prepare("INSERT INTO post_videos (post_id, video_id) SELECT ?, upload_id FROM uploads WHERE upload_id = ? AND user_id = ?")
-	if err != nil {
-		return
-	}
-	result, err := s.Exec(postID, videoID, userID)
-	if err != nil {
-		return
-	}
-	rowsAffected, err := result.RowsAffected()
-	if rowsAffected <= 0 {
+func (api *API) addPostVideo(ctx context.Context, userID gp.UserID, postID gp.PostID, videoID gp.VideoID) (err error) {
+	ok, err := api.store.Posts.AddVideo(ctx, postID, userID, videoID)
+	if err == nil && !ok {
 		err = InvalidVideo
 	}
 	return
 }
 
 //UserAddPostVideo attaches a video to a post, or errors if the user isn't allowed.
-func (api *API) UserAddPostVideo(userID gp.UserID, postID gp.PostID, videoID gp.VideoID) (videos []gp.Video, err error) {
-	p, err := api.getPost(postID)
+func (api *API) UserAddPostVideo(ctx context.Context, userID gp.UserID, postID gp.PostID, videoID gp.VideoID) (videos []gp.Video, err error) {
+	p, err := api.getPost(ctx, postID)
 	if err != nil {
 		return
 	}
-	in, err := api.UserInNetwork(userID, p.Network)
+	in, err := api.UserInNetwork(ctx, userID, p.Network)
 	switch {
 	case err != nil:
 		return
 	case !in:
 		return nil, &ENOTALLOWED
 	default:
-		err = api.addPostVideo(userID, postID, videoID)
+		err = api.addPostVideo(ctx, userID, postID, videoID)
 		if err == nil {
-			return api.getPostVideos(postID), nil
+			return api.getPostVideos(ctx, postID), nil
 		}
 		return
 	}
 }
 
 //ClearPostVideos deletes all videos from this post.
-func (api *API) clearPostVideos(postID gp.PostID) (err error) {
-	s, err := api.sc.Prepare("DELETE FROM post_videos WHERE post_id = ?")
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(postID)
-	return
+func (api *API) clearPostVideos(ctx context.Context, postID gp.PostID) (err error) {
+	return api.store.Posts.ClearVideos(ctx, postID)
 }
 
-func (api *API) needsReview(netID gp.NetworkID, categories ...string) (needsReview bool, err error) {
-	level, e := api.approveLevel(netID)
+func (api *API) needsReview(ctx context.Context, netID gp.NetworkID, categories ...string) (needsReview bool, err error) {
+	level, e := api.approveLevel(ctx, netID)
 	switch {
 	case e != nil:
 		return false, e
@@ -715,17 +572,17 @@ func validatePost(text string, attribs map[string]string, video gp.VideoID, imag
 }
 
 //UserAddPostToPrimary creates a post in the user's university.
-func (api *API) UserAddPostToPrimary(userID gp.UserID, text string, attribs map[string]string, video gp.VideoID, allowUnowned bool, imageURL string, pollExpiry string, pollOptions []string, tags ...string) (postID gp.PostID, pending bool, err error) {
-	primary, err := api.getUserUniversity(userID)
+func (api *API) UserAddPostToPrimary(ctx context.Context, userID gp.UserID, text string, attribs map[string]string, video gp.VideoID, allowUnowned bool, imageURL string, pollExpiry string, pollOptions []string, tags ...string) (postID gp.PostID, pending bool, err error) {
+	primary, err := api.getUserUniversity(ctx, userID)
 	if err != nil {
 		return
 	}
-	return api.UserAddPost(userID, primary.ID, text, attribs, video, allowUnowned, imageURL, pollExpiry, pollOptions, tags...)
+	return api.UserAddPost(ctx, userID, primary.ID, text, attribs, video, allowUnowned, imageURL, pollExpiry, pollOptions, tags...)
 }
 
 //UserAddPost creates a post in the network netID, with the categories in []tags, or returns an ENOTALLOWED if userID is not a member of netID. If imageURL is set, the post will be created with this image. If allowUnowned, it will allow the post to be created without checking if the user "owns" this image. If video > 0, the post will be created with this video.
-func (api *API) UserAddPost(userID gp.UserID, netID gp.NetworkID, text string, attribs map[string]string, video gp.VideoID, allowUnowned bool, imageURL string, pollExpiry string, pollOptions []string, tags ...string) (postID gp.PostID, pending bool, err error) {
-	in, err := api.UserInNetwork(userID, netID)
+func (api *API) UserAddPost(ctx context.Context, userID gp.UserID, netID gp.NetworkID, text string, attribs map[string]string, video gp.VideoID, allowUnowned bool, imageURL string, pollExpiry string, pollOptions []string, tags ...string) (postID gp.PostID, pending bool, err error) {
+	in, err := api.UserInNetwork(ctx, userID, netID)
 	switch {
 	case err != nil:
 		return
@@ -737,19 +594,19 @@ func (api *API) UserAddPost(userID gp.UserID, netID gp.NetworkID, text string, a
 			return postID, false, errs[0]
 		}
 		//If the post matches one of the filters for this network, we want to hide it for now
-		pending, err = api.needsReview(netID, tags...)
+		pending, err = api.needsReview(ctx, netID, tags...)
 		if err != nil {
 			return
 		}
-		postID, err = api.addPost(userID, text, netID, pending, tags, attribs)
+		postID, err = api.addPost(ctx, userID, text, netID, pending, tags, attribs)
 		if err != nil {
 			return
 		}
 		if len(imageURL) > 0 {
 			var exists bool
-			exists, err = api.userUploadExists(userID, imageURL)
+			exists, err = api.userUploadExists(ctx, userID, imageURL)
 			if allowUnowned || (exists && err == nil) {
-				err = api.addPostImage(postID, imageURL)
+				err = api.addPostImage(ctx, postID, imageURL)
 				if err != nil {
 					return
 				}
@@ -759,74 +616,59 @@ func (api *API) UserAddPost(userID gp.UserID, netID gp.NetworkID, text string, a
 			}
 		}
 		if video > 0 {
-			err = api.addPostVideo(userID, postID, video)
+			err = api.addPostVideo(ctx, userID, postID, video)
 			if err != nil {
 				return
 			}
 		}
 		if hasTag("poll", tags) {
-			err = api.savePoll(postID, expiry, pollOptions)
+			err = api.savePoll(ctx, postID, expiry, pollOptions)
 			if err != nil {
 				return
 			}
 		}
 		api.notifObserver.Notify(postEvent{userID: userID, netID: netID, postID: postID, pending: pending})
 		if pending {
-			api.postsToApproveNotification(userID, netID)
+			api.postsToApproveNotification(ctx, userID, netID)
 		} else {
-			post, err := api.getPost(postID)
+			post, err := api.getPost(ctx, postID)
 			if err == nil {
-				go api.broker.PublishEvent("post", fmt.Sprintf("/networks/%d/posts", netID), post, []string{NetworkChannel(netID)})
+				go api.broker.PublishEvent(events.Post, fmt.Sprintf("/networks/%d/posts", netID), post, []string{NetworkChannel(netID)})
 			}
+			go api.groupBadgesChanged(netID, userID)
 		}
 		return
 	}
 }
 
 //TagPost adds these tags/categories to the post if they're not already.
-func (api *API) tagPost(post gp.PostID, tags ...string) (err error) {
+func (api *API) tagPost(ctx context.Context, post gp.PostID, tags ...string) (err error) {
 	if len(tags) == 0 {
 		return
 	}
-	s, err := api.sc.Prepare("INSERT INTO post_categories( post_id, category_id ) SELECT ? , categories.id FROM categories WHERE categories.tag = ?")
-	if err != nil {
-		return
-	}
-	for _, tag := range tags {
-		_, err = s.Exec(post, tag)
-		if err != nil {
-			return
-		}
-	}
-	return
+	return api.store.Posts.Tag(ctx, post, tags...)
 }
 
 //UserSetLike marks a post as "liked" or "unliked" by this user.
-func (api *API) UserSetLike(user gp.UserID, postID gp.PostID, liked bool) (err error) {
-	post, err := api.getPost(postID)
+func (api *API) UserSetLike(ctx context.Context, user gp.UserID, postID gp.PostID, liked bool) (err error) {
+	post, err := api.getPost(ctx, postID)
 	if err != nil {
 		return
 	}
-	in, err := api.UserInNetwork(user, post.Network)
+	in, err := api.UserInNetwork(ctx, user, post.Network)
 	switch {
 	case err != nil:
 		return
 	case !in:
 		return ENOTALLOWED
 	case !liked:
-		var s *sql.Stmt
-		s, err = api.sc.Prepare("DELETE FROM post_likes WHERE post_id = ? AND user_id = ?")
-		if err != nil {
-			return
-		}
-		_, err = s.Exec(postID, user)
-		return
+		return api.store.Posts.Unlike(ctx, user, postID)
 	default:
-		err = api.createLike(user, postID)
+		err = api.createLike(ctx, user, postID)
 		if err != nil {
 			return
 		}
-		api.notifObserver.Notify(likeEvent{userID: user, recipientID: post.By.ID, postID: postID})
+		api.notifObserver.Notify(likeEvent{userID: user, recipientID: post.By.ID, postID: postID, netID: post.Network})
 		return
 	}
 }
@@ -835,14 +677,11 @@ func (api *API) UserSetLike(user gp.UserID, postID gp.PostID, liked bool) (err e
 //At the moment, it doesn't check if these attributes are at all reasonable;
 //the onus is on the viewer of the attributes to look for just the ones which make sense,
 //and on the caller of this function to ensure that the values conform to a particular format.
-func (api *API) setPostAttribs(post gp.PostID, attribs map[string]string) (err error) {
+func (api *API) setPostAttribs(ctx context.Context, post gp.PostID, attribs map[string]string) (err error) {
 	if len(attribs) == 0 {
 		return
 	}
-	s, err := api.sc.Prepare("REPLACE INTO post_attribs (post_id, attrib, value) VALUES (?, ?, ?)")
-	if err != nil {
-		return
-	}
+	values := make(map[string]string)
 	for attrib, value := range attribs {
 		//How could I be so foolish to store time strings rather than unix timestamps...
 		if attrib == "event-time" {
@@ -857,49 +696,46 @@ func (api *API) setPostAttribs(post gp.PostID, attribs map[string]string) (err e
 			unix := t.Unix()
 			value = strconv.FormatInt(unix, 10)
 		}
-		_, err = s.Exec(post, attrib, value)
-		if err != nil {
-			return
-		}
+		values[attrib] = value
 	}
-	return nil
+	return api.store.Posts.SetAttribs(ctx, post, values)
 }
 
 //UserAttend adds the user to the "attending" list for this event. It's idempotent, and should only return an error if the database is down.
 //The results are undefined for a post which isn't an event.
 //(ie: it will work even though it shouldn't, until I can get round to enforcing it.)
-func (api *API) UserAttend(event gp.PostID, user gp.UserID, attending bool) (err error) {
-	post, err := api.getPost(event)
+func (api *API) UserAttend(ctx context.Context, event gp.PostID, user gp.UserID, attending bool) (err error) {
+	post, err := api.getPost(ctx, event)
 	if err != nil {
 		return
 	}
-	in, err := api.UserInNetwork(user, post.Network)
+	in, err := api.UserInNetwork(ctx, user, post.Network)
 	switch {
 	case err != nil || !in:
 		err = &ENOTALLOWED
 		return
 	case attending:
 		var changed bool
-		changed, err = api.attend(event, user)
+		changed, err = api.attend(ctx, event, user)
 		if err == nil && changed {
-			api.notifObserver.Notify(attendEvent{userID: user, recipientID: post.By.ID, postID: event})
+			api.notifObserver.Notify(attendEvent{userID: user, recipientID: post.By.ID, postID: event, netID: post.Network})
 		}
 		return
 	default:
-		return api.unAttend(event, user)
+		return api.unAttend(ctx, event, user)
 	}
 }
 
 //UserEvents returns all the events that a user is attending.
-func (api *API) UserEvents(perspective, user gp.UserID, category string, mode int, index int64, count int) (events []gp.PostSmall, err error) {
+func (api *API) UserEvents(ctx context.Context, perspective, user gp.UserID, category string, mode int, index int64, count int) (events []gp.PostSmall, err error) {
 	events = make([]gp.PostSmall, 0)
-	events, err = api.userAttending(perspective, user, category, mode, index, count)
+	events, err = api.userAttending(ctx, perspective, user, category, mode, index, count)
 	if err != nil {
 		log.Println("Error getting events:", err)
 		return
 	}
 	for i := range events {
-		processed, err := api.postProcess(events[i], perspective)
+		processed, err := api.postProcess(ctx, events[i], perspective)
 		if err == nil {
 			events[i] = processed
 		} else {
@@ -910,32 +746,17 @@ func (api *API) UserEvents(perspective, user gp.UserID, category string, mode in
 }
 
 //UserAttends returns all event IDs that a user is attending.
-func (api *API) UserAttends(user gp.UserID) (events []gp.PostID, err error) {
-	events = make([]gp.PostID, 0)
-	query := "SELECT post_id FROM event_attendees WHERE user_id = ?"
-	s, err := api.sc.Prepare(query)
-	if err != nil {
-		return
-	}
-	rows, err := s.Query(user)
-	if err != nil {
-		return
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var post gp.PostID
-		err = rows.Scan(&post)
-		if err != nil {
-			return
-		}
-		events = append(events, post)
+func (api *API) UserAttends(ctx context.Context, user gp.UserID) (events []gp.PostID, err error) {
+	events, err = api.store.Posts.UserAttends(ctx, user)
+	if events == nil {
+		events = make([]gp.PostID, 0)
 	}
 	return
 }
 
 //UserDeletePost marks a post as deleted (it remains in the db but doesn't show up in feeds). You can only delete your own posts.
-func (api *API) UserDeletePost(user gp.UserID, post gp.PostID) (err error) {
-	p, err := api.getPostFull(user, post)
+func (api *API) UserDeletePost(ctx context.Context, user gp.UserID, post gp.PostID) (err error) {
+	p, err := api.getPostFull(ctx, user, post)
 	switch {
 	case err != nil && err == gp.NoSuchPost:
 		return nil //You're allowed to "delete" any post which doesn't exist from your perspective.
@@ -945,25 +766,19 @@ func (api *API) UserDeletePost(user gp.UserID, post gp.PostID) (err error) {
 	case p.By.ID != user:
 		return &ENOTALLOWED
 	default:
-		err = api.deletePost(post)
+		err = api.deletePost(ctx, post)
 	}
 	return
 }
 
 //DeletePost marks a post as deleted in the database.
-func (api *API) deletePost(post gp.PostID) (err error) {
-	q := "UPDATE wall_posts SET deleted = 1 WHERE id = ?"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(post)
-	return
+func (api *API) deletePost(ctx context.Context, post gp.PostID) (err error) {
+	return api.store.Posts.Delete(ctx, post)
 }
 
 //UserEditPost updates this post with entirely new information. Any fields which aren't set are unchanged.
-func (api *API) UserEditPost(userID gp.UserID, postID gp.PostID, text string, attribs map[string]string, url string, videoID gp.VideoID, reason string, tags ...string) (post gp.PostFull, err error) {
-	editable, err := api.canEdit(userID, postID)
+func (api *API) UserEditPost(ctx context.Context, userID gp.UserID, postID gp.PostID, text string, attribs map[string]string, url string, videoID gp.VideoID, reason string, tags ...string) (post gp.PostFull, err error) {
+	editable, err := api.canEdit(ctx, userID, postID)
 	switch {
 	case err != nil:
 		return
@@ -971,64 +786,64 @@ func (api *API) UserEditPost(userID gp.UserID, postID gp.PostID, text string, at
 		return post, &ENOTALLOWED
 	default:
 		if len(text) > 0 {
-			err = api.changePostText(postID, text)
+			err = api.changePostText(ctx, postID, text)
 			if err != nil {
 				return
 			}
 		}
 		//Set attribs
 		if len(attribs) > 0 {
-			err = api.setPostAttribs(postID, attribs)
+			err = api.setPostAttribs(ctx, postID, attribs)
 			if err != nil {
 				return
 			}
 		}
 		if len(url) > 0 {
-			err = api.clearPostImages(postID)
+			err = api.clearPostImages(ctx, postID)
 			if err != nil {
 				return
 			}
-			_, err = api.UserAddPostImage(userID, postID, url)
+			_, err = api.UserAddPostImage(ctx, userID, postID, url)
 			if err != nil {
 				return
 			}
 		}
 		if videoID > 0 {
-			err = api.clearPostVideos(postID)
+			err = api.clearPostVideos(ctx, postID)
 			if err != nil {
 				return
 			}
 			//Set new video
-			_, err = api.UserAddPostVideo(userID, postID, videoID)
+			_, err = api.UserAddPostVideo(ctx, userID, postID, videoID)
 			if err != nil {
 				return
 			}
 		}
 		if len(tags) > 0 {
 			//Delete and re-set the categories
-			err = api.clearCategories(postID)
+			err = api.clearCategories(ctx, postID)
 			if err != nil {
 				return
 			}
-			err = api.tagPost(postID, tags...)
+			err = api.tagPost(ctx, postID, tags...)
 			if err != nil {
 				return
 			}
 		}
 	}
-	post, err = api.getPostFull(userID, postID)
+	post, err = api.getPostFull(ctx, userID, postID)
 	if err != nil {
 		return
 	}
-	err = api.maybeResubmitPost(userID, postID, post.Network, reason)
+	err = api.maybeResubmitPost(ctx, userID, postID, post.Network, reason)
 	if err != nil {
 		return
 	}
 	return post, nil
 }
 
-func (api *API) canEdit(userID gp.UserID, postID gp.PostID) (editable bool, err error) {
-	post, err := api.getPost(postID)
+func (api *API) canEdit(ctx context.Context, userID gp.UserID, postID gp.PostID) (editable bool, err error) {
+	post, err := api.getPost(ctx, postID)
 	if err != nil {
 		return
 	}
@@ -1039,112 +854,62 @@ func (api *API) canEdit(userID gp.UserID, postID gp.PostID) (editable bool, err
 }
 
 //UserGetEventAttendees returns all the attendees of a given event, or ENOTALLOWED if user isn't in its network.
-func (api *API) UserGetEventAttendees(user gp.UserID, postID gp.PostID) (attendeeSummary gp.AttendeeSummary, err error) {
-	post, err := api.getPost(postID)
+func (api *API) UserGetEventAttendees(ctx context.Context, user gp.UserID, postID gp.PostID) (attendeeSummary gp.AttendeeSummary, err error) {
+	post, err := api.getPost(ctx, postID)
 	if err != nil {
 		return
 	}
-	in, err := api.UserInNetwork(user, post.Network)
+	in, err := api.UserInNetwork(ctx, user, post.Network)
 	switch {
 	case err != nil || !in:
 		return attendeeSummary, ENOTALLOWED
 	default:
-		attendeeSummary.Attendees, err = api.eventAttendees(postID)
+		attendeeSummary.Attendees, err = api.eventAttendees(ctx, postID)
 		if err != nil {
 			return
 		}
-		attendeeSummary.Popularity, attendeeSummary.AttendeeCount, err = api.userGetEventPopularity(user, postID)
+		attendeeSummary.Popularity, attendeeSummary.AttendeeCount, err = api.userGetEventPopularity(ctx, user, postID)
 		return
 	}
 }
 
 //UserGetEventPopularity returns popularity (an arbitrary score between 0 and 100), and the number of attendees. If user isn't in the same network as the event, it will return ENOTALLOWED instead.
-func (api *API) userGetEventPopularity(user gp.UserID, postID gp.PostID) (popularity int, attendees int, err error) {
-	post, err := api.getPost(postID)
+func (api *API) userGetEventPopularity(ctx context.Context, user gp.UserID, postID gp.PostID) (popularity int, attendees int, err error) {
+	post, err := api.getPost(ctx, postID)
 	if err != nil {
 		return
 	}
-	in, err := api.UserInNetwork(user, post.Network)
+	in, err := api.UserInNetwork(ctx, user, post.Network)
 	switch {
 	case err != nil || !in:
 		err = ENOTALLOWED
 		return
 	default:
-		return api.getEventPopularity(postID)
+		return api.getEventPopularity(ctx, postID)
 	}
 }
 
-const (
-	//Base
-	baseQuery = "SELECT wall_posts.id, `by`, wall_posts.time, text, network_id FROM wall_posts "
-	//Joins
-	categoryClause = "JOIN post_categories ON wall_posts.id = post_categories.post_id " +
-		"JOIN categories ON post_categories.category_id = categories.id "
-
-	attendClause = "JOIN event_attendees ON wall_posts.id = event_attendees.post_id "
-	//Wheres
-	notDeleted    = "WHERE deleted = 0 "
-	notPending    = "AND pending = 0 "
-	whereCategory = "AND categories.tag = ? "
-
-	whereBefore = "AND wall_posts.id < ? "
-	whereAfter  = "AND wall_posts.id > ? "
-
-	whereBeforeAtt = "AND event_attendees.time < (SELECT time FROM event_attendees WHERE post_id = ? AND user_id = ?) "
-	whereAfterAtt  = "AND event_attendees.time < (SELECT time FROM event_attendees WHERE post_id = ? AND user_id = ?) "
-
-	byNetwork = "AND network_id = ? "
-	byPoster  = "AND `by` = ? AND network_id IN ( " +
-		"SELECT network_id FROM user_network WHERE user_id = ? ) "
-	byUserGroups = "AND network_id IN ( " +
-		"SELECT network_id FROM user_network " +
-		"JOIN network ON user_network.network_id = network.id " +
-		"WHERE user_id = ? AND network.user_group = 1 ) "
-	byVisibleAttendance = "AND network_id IN ( " +
-		"SELECT network_id FROM user_network WHERE user_id = ? ) " +
-		"AND event_attendees.user_id = ? "
-
-	//Orders
-	orderLinear               = "ORDER BY time DESC, id DESC LIMIT ?, ?"
-	orderChronological        = "ORDER BY time DESC, id DESC LIMIT 0, ?"
-	orderReverseChronological = "ORDER BY time ASC, id ASC limit 0, ?"
-
-	reverse = "SELECT `id`, `by`, `time`, `text`, `network_id` FROM ( %s ) AS `wp` ORDER BY `time` DESC, `id` DESC"
-
-	orderLinearAttend        = "ORDER BY event_attendees.time DESC, id DESC LIMIT ?, ?"
-	orderChronologicalAttend = "ORDER BY event_attendees.time DESC, id DESC LIMIT 0, ?"
-)
-
 var (
 	//EBADORDER means you tried to order a post query in an unexpected way.
 	EBADORDER = gp.APIerror{Reason: "Invalid order clause!"}
 )
 
-func (api *API) scanPostRows(rows *sql.Rows, expandNetworks bool) (posts []gp.PostSmall, err error) {
+//expandPosts fills in posts from the store with their author, comment and like counts, images and videos, and (if expandNetworks) their group.
+func (api *API) expandPosts(ctx context.Context, stored []store.StoredPost, expandNetworks bool) (posts []gp.PostSmall, err error) {
 	posts = make([]gp.PostSmall, 0)
-	for rows.Next() {
-		var post gp.PostSmall
-		var t string
-		var by gp.UserID
-		err = rows.Scan(&post.ID, &by, &t, &post.Text, &post.Network)
-		if err != nil {
-			return posts, err
-		}
-		post.Time, err = time.Parse(mysqlTime, t)
-		if err != nil {
-			return posts, err
-		}
-		post.By, err = api.users.byID(by)
+	for _, s := range stored {
+		post := gp.PostSmall{Post: gp.Post{ID: s.ID, Time: s.Time, Text: s.Text, Network: s.Network}}
+		post.By, err = api.users.byID(ctx, s.By)
 		if err == nil {
-			post.CommentCount = api.getCommentCount(post.ID)
-			post.Images = api.getPostImages(post.ID)
-			post.Videos = api.getPostVideos(post.ID)
-			post.LikeCount, err = api.likeCount(post.ID)
+			post.CommentCount = api.getCommentCount(ctx, post.ID)
+			post.Images = api.getPostImages(ctx, post.ID)
+			post.Videos = api.getPostVideos(ctx, post.ID)
+			post.LikeCount, err = api.likeCount(ctx, post.ID)
 			if err != nil {
 				return
 			}
 			if expandNetworks {
-				net, err := api.getNetwork(post.Network)
+				net, err := api.getNetwork(ctx, post.Network)
 				if err == nil {
 					post.Group = &net
 				} else {
@@ -1160,59 +925,25 @@ func (api *API) scanPostRows(rows *sql.Rows, expandNetworks bool) (posts []gp.Po
 }
 
 //GetUserPosts returns the most recent count posts by userId after the post with id after.
-func (api *API) getUserPosts(userID, perspective gp.UserID, mode int, index int64, count int, category string) (posts []gp.PostSmall, err error) {
-	posts = make([]gp.PostSmall, 0)
-	var q string
-	if len(category) > 0 {
-		q = baseQuery + categoryClause + notDeleted + notPending + byPoster + category
-	} else {
-		q = baseQuery + notDeleted + notPending + byPoster
-	}
-	switch {
-	case mode == ByOffsetDescending:
-		q += orderLinear
-	case mode == ChronologicallyAfterID:
-		q += whereAfter + orderChronological
-	case mode == ChronologicallyBeforeID:
-		q += whereBefore + orderChronological
-	}
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	var rows *sql.Rows
-	if len(category) > 0 {
-		rows, err = s.Query(userID, perspective, category, index, count)
-	} else {
-		rows, err = s.Query(userID, perspective, index, count)
-	}
+func (api *API) getUserPosts(ctx context.Context, userID, perspective gp.UserID, mode int, index int64, count int, category string) (posts []gp.PostSmall, err error) {
+	stored, err := api.store.Posts.UserPosts(ctx, perspective, userID, category, mode, index, count)
 	if err != nil {
-		return
+		return make([]gp.PostSmall, 0), err
 	}
-	defer rows.Close()
-	return api.scanPostRows(rows, true)
+	return api.expandPosts(ctx, stored, true)
 }
 
 //AddPost creates a post, returning the created ID. It only handles the core of the post; other attributes, images and so on must be created separately.
-func (api *API) addPost(userID gp.UserID, text string, network gp.NetworkID, pending bool, tags []string, attribs map[string]string) (postID gp.PostID, err error) {
-	s, err := api.sc.Prepare("INSERT INTO wall_posts(`by`, `text`, network_id, pending) VALUES (?,?,?,?)")
-	if err != nil {
-		return
-	}
-	res, err := s.Exec(userID, text, network, pending)
-	if err != nil {
-		return 0, err
-	}
-	_postID, err := res.LastInsertId()
+func (api *API) addPost(ctx context.Context, userID gp.UserID, text string, network gp.NetworkID, pending bool, tags []string, attribs map[string]string) (postID gp.PostID, err error) {
+	postID, err = api.store.Posts.Create(ctx, userID, network, text, pending)
 	if err != nil {
 		return 0, err
 	}
-	postID = gp.PostID(_postID)
-	err = api.tagPost(postID, tags...)
+	err = api.tagPost(ctx, postID, tags...)
 	if err != nil {
 		return 0, err
 	}
-	err = api.setPostAttribs(postID, attribs)
+	err = api.setPostAttribs(ctx, postID, attribs)
 	if err != nil {
 		return 0, err
 	}
@@ -1220,131 +951,52 @@ func (api *API) addPost(userID gp.UserID, text string, network gp.NetworkID, pen
 }
 
 //GetLive returns a list of events whose event time is after "after", ordered by time.
-func (api *API) _getLive(netID gp.NetworkID, after time.Time, until time.Time, count int, category string) (posts []gp.PostSmall, err error) {
-	posts = make([]gp.PostSmall, 0)
-	q := "SELECT wall_posts.id, `by`, time, text, network_id " +
-		"FROM wall_posts " +
-		"JOIN post_attribs ON wall_posts.id = post_attribs.post_id "
-	if len(category) > 0 {
-		q += categoryClause
-	}
-	q += "WHERE deleted = 0 AND pending = 0 AND network_id = ? AND attrib = 'event-time' AND value > ? AND value < ? "
-	if len(category) > 0 {
-		q += whereCategory
-	}
-	q += "ORDER BY value ASC LIMIT 0, ?"
-	s, err := api.sc.Prepare(q)
+func (api *API) _getLive(ctx context.Context, netID gp.NetworkID, after time.Time, until time.Time, count int, category string) (posts []gp.PostSmall, err error) {
+	stored, err := api.store.Posts.Live(ctx, netID, after, until, category, count)
 	if err != nil {
-		return
-	}
-	var rows *sql.Rows
-	if len(category) > 0 {
-		rows, err = s.Query(netID, after.Unix(), until.Unix(), category, count)
-	} else {
-		rows, err = s.Query(netID, after.Unix(), until.Unix(), count)
+		return make([]gp.PostSmall, 0), err
 	}
-	if err != nil {
-		return
-	}
-	defer rows.Close() //The second argument is meaningless and should be removed.
-	return api.scanPostRows(rows, false)
+	return api.expandPosts(ctx, stored, false)
 }
 
 //GetPosts finds posts in the network netId.
-func (api *API) _getPosts(netID gp.NetworkID, mode int, index int64, count int, category string) (posts []gp.PostSmall, err error) {
-	posts = make([]gp.PostSmall, 0)
-	var q string
-	if len(category) > 0 {
-		q = baseQuery + categoryClause + notDeleted + notPending + byNetwork + whereCategory
-	} else {
-		q = baseQuery + notDeleted + notPending + byNetwork
-	}
-	switch {
-	case mode == ByOffsetDescending:
-		q += orderLinear
-	case mode == ChronologicallyAfterID:
-		q += whereAfter + orderReverseChronological
-		q = fmt.Sprintf(reverse, q)
-	case mode == ChronologicallyBeforeID:
-		q += whereBefore + orderChronological
-	}
-	s, err := api.sc.Prepare(q)
+func (api *API) _getPosts(ctx context.Context, netID gp.NetworkID, mode int, index int64, count int, category string, userID gp.UserID) (posts []gp.PostSmall, err error) {
+	stored, err := api.store.Posts.NetworkPosts(ctx, userID, netID, category, mode, index, count)
 	if err != nil {
-		return
-	}
-	var rows *sql.Rows
-	if len(category) > 0 {
-		rows, err = s.Query(netID, category, index, count)
-	} else {
-		rows, err = s.Query(netID, index, count)
-	}
-	if err != nil {
-		return
+		return make([]gp.PostSmall, 0), err
 	}
-	defer rows.Close()
-	return api.scanPostRows(rows, false)
+	return api.expandPosts(ctx, stored, false)
 }
 
 //ClearPostImages deletes all images from this post.
-func (api *API) clearPostImages(postID gp.PostID) (err error) {
-	s, err := api.sc.Prepare("DELETE FROM post_images WHERE post_id = ?")
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(postID)
-	return
+func (api *API) clearPostImages(ctx context.Context, postID gp.PostID) (err error) {
+	return api.store.Posts.ClearImages(ctx, postID)
 }
 
 //CreateComment adds a comment on this post.
-func (api *API) createComment(postID gp.PostID, userID gp.UserID, text string) (commID gp.CommentID, err error) {
-	s, err := api.sc.Prepare("INSERT INTO post_comments (post_id, `by`, text) VALUES (?, ?, ?)")
-	if err != nil {
-		return
-	}
-	if res, err := s.Exec(postID, userID, text); err == nil {
-		cID, err := res.LastInsertId()
-		commID = gp.CommentID(cID)
-		return commID, err
-	}
-	return 0, err
+func (api *API) createComment(ctx context.Context, postID gp.PostID, userID gp.UserID, text string) (commID gp.CommentID, err error) {
+	return api.store.Posts.AddComment(ctx, postID, userID, text)
 }
 
 type comments struct {
-	sc    *psc.StatementCache
+	posts store.Posts
 	stats PrefixStatter
 	users *Users
 }
 
 //GetComments returns up to count comments for this post.
-func (comm comments) getComments(postID gp.PostID, start int64, count int) (comments []gp.Comment, err error) {
+func (comm comments) getComments(ctx context.Context, postID gp.PostID, start int64, count int) (comments []gp.Comment, err error) {
 	defer comm.stats.Time(time.Now(), "gleepost.comments.byPostID.db")
 	comments = make([]gp.Comment, 0)
-	q := "SELECT id, `by`, text, `timestamp` " +
-		"FROM post_comments " +
-		"WHERE post_id = ? " +
-		"ORDER BY `timestamp` DESC LIMIT ?, ?"
-	s, err := comm.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	rows, err := s.Query(postID, start, count)
+	stored, err := comm.posts.Comments(ctx, postID, start, count)
 	if err != nil {
 		return comments, err
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var comment gp.Comment
-		comment.Post = postID
-		var timeString string
-		var by gp.UserID
-		err := rows.Scan(&comment.ID, &by, &comment.Text, &timeString)
+	for _, c := range stored {
+		comment := gp.Comment{ID: c.ID, Post: postID, Text: c.Text, Time: c.Time}
+		comment.By, err = comm.users.byID(ctx, c.By)
 		if err != nil {
-			return comments, err
-		}
-		comment.Time, _ = time.Parse(mysqlTime, timeString)
-		comment.By, err = comm.users.byID(by)
-		if err != nil {
-			log.Printf("error getting user %d: %v\n", by, err)
+			log.Printf("error getting user %d: %v\n", c.By, err)
 		}
 		comments = append(comments, comment)
 	}
@@ -1353,82 +1005,50 @@ func (comm comments) getComments(postID gp.PostID, start int64, count int) (comm
 
 //UserGetPost returns the post postId or an error if it doesn't exist.
 //TODO: This could return without an embedded user or images array
-func (api *API) userGetPost(userID gp.UserID, postID gp.PostID) (post gp.Post, err error) {
-	s, err := api.sc.Prepare("SELECT `network_id`, `by`, `time`, text FROM wall_posts WHERE deleted = 0 AND id = ? AND (pending = 0 OR `by` = ?)")
-	if err != nil {
-		if err == sql.ErrNoRows {
-			err = gp.NoSuchPost
-		}
-		return
-	}
-	post.ID = postID
-	var by gp.UserID
-	var t string
-	err = s.QueryRow(postID, userID).Scan(&post.Network, &by, &t, &post.Text)
-	if err != nil {
-		return
+func (api *API) userGetPost(ctx context.Context, userID gp.UserID, postID gp.PostID) (post gp.Post, err error) {
+	stored, err := api.store.Posts.VisiblePost(ctx, postID, userID)
+	if err == sql.ErrNoRows {
+		err = gp.NoSuchPost
 	}
-	post.By, err = api.users.byID(by)
 	if err != nil {
 		return
 	}
-	post.Time, err = time.Parse(mysqlTime, t)
-	if err != nil {
-		return
-	}
-	post.Images = api.getPostImages(postID)
-	post.Videos = api.getPostVideos(postID)
-	return
+	return api.post(ctx, stored)
 }
 
 //GetPost returns the post postId or an error if it doesn't exist.
 //TODO: This could return without an embedded user or images array
-func (api *API) getPost(postID gp.PostID) (post gp.Post, err error) {
-	s, err := api.sc.Prepare("SELECT `network_id`, `by`, `time`, text FROM wall_posts WHERE deleted = 0 AND id = ?")
-	if err != nil {
-		return
-	}
-	post.ID = postID
-	var by gp.UserID
-	var t string
-	err = s.QueryRow(postID).Scan(&post.Network, &by, &t, &post.Text)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			err = gp.NoSuchPost
-		}
-		return
+func (api *API) getPost(ctx context.Context, postID gp.PostID) (post gp.Post, err error) {
+	stored, err := api.store.Posts.Post(ctx, postID)
+	if err == sql.ErrNoRows {
+		err = gp.NoSuchPost
 	}
-	post.By, err = api.users.byID(by)
 	if err != nil {
 		return
 	}
-	post.Time, err = time.Parse(mysqlTime, t)
+	return api.post(ctx, stored)
+}
+
+//post fills in a post from the store with its author, images and videos.
+func (api *API) post(ctx context.Context, stored store.StoredPost) (post gp.Post, err error) {
+	post = gp.Post{ID: stored.ID, Time: stored.Time, Text: stored.Text, Network: stored.Network}
+	post.By, err = api.users.byID(ctx, stored.By)
 	if err != nil {
 		return
 	}
-	post.Images = api.getPostImages(postID)
-	post.Videos = api.getPostVideos(postID)
+	post.Images = api.getPostImages(ctx, post.ID)
+	post.Videos = api.getPostVideos(ctx, post.ID)
 	return
 }
 
 //GetPostAttribs returns a map of all attributes associated with post.
-func (api *API) getPostAttribs(post gp.PostID) (attribs map[string]interface{}, err error) {
-	s, err := api.sc.Prepare("SELECT attrib, value FROM post_attribs WHERE post_id=?")
-	if err != nil {
-		return
-	}
-	rows, err := s.Query(post)
+func (api *API) getPostAttribs(ctx context.Context, post gp.PostID) (attribs map[string]interface{}, err error) {
+	values, err := api.store.Posts.Attribs(ctx, post)
 	if err != nil {
 		return
 	}
-	defer rows.Close()
 	attribs = make(map[string]interface{})
-	for rows.Next() {
-		var attrib, val string
-		err = rows.Scan(&attrib, &val)
-		if err != nil {
-			return
-		}
+	for attrib, val := range values {
 		switch {
 		case attrib == "event-time":
 			var unix int64
@@ -1444,13 +1064,8 @@ func (api *API) getPostAttribs(post gp.PostID) (attribs map[string]interface{},
 }
 
 //GetEventPopularity returns the popularity score (0 - 99) and the actual attendees count
-func (api *API) getEventPopularity(post gp.PostID) (popularity int, attendees int, err error) {
-	query := "SELECT COUNT(*) FROM event_attendees WHERE post_id = ?"
-	s, err := api.sc.Prepare(query)
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(post).Scan(&attendees)
+func (api *API) getEventPopularity(ctx context.Context, post gp.PostID) (popularity int, attendees int, err error) {
+	attendees, err = api.store.Posts.AttendeeCount(ctx, post)
 	if err != nil {
 		return
 	}
@@ -1471,287 +1086,90 @@ func (api *API) getEventPopularity(post gp.PostID) (popularity int, attendees in
 
 //UserGetGroupsPosts retrieves posts from this user's groups (non-university networks)
 //TODO: Verify shit doesn't break when a user has no user-groups
-func (api *API) userGetGroupsPosts(user gp.UserID, mode int, index int64, count int, category string) (posts []gp.PostSmall, err error) {
-	posts = make([]gp.PostSmall, 0)
-	var q string
-	if len(category) > 0 {
-		q = baseQuery + categoryClause + notDeleted + notPending + byUserGroups + whereCategory
-	} else {
-		q = baseQuery + notDeleted + notPending + byUserGroups
-	}
-	switch {
-	case mode == ByOffsetDescending:
-		q += orderLinear
-	case mode == ChronologicallyAfterID:
-		q += whereAfter + orderChronological
-	case mode == ChronologicallyBeforeID:
-		q += whereBefore + orderChronological
-	}
-	s, err := api.sc.Prepare(q)
+func (api *API) userGetGroupsPosts(ctx context.Context, user gp.UserID, mode int, index int64, count int, category string) (posts []gp.PostSmall, err error) {
+	stored, err := api.store.Posts.GroupPosts(ctx, user, category, mode, index, count)
 	if err != nil {
-		return
-	}
-	var rows *sql.Rows
-	if len(category) > 0 {
-		rows, err = s.Query(user, category, index, count)
-	} else {
-		rows, err = s.Query(user, index, count)
-	}
-	if err != nil {
-		return
+		return make([]gp.PostSmall, 0), err
 	}
-	defer rows.Close()
-	return api.scanPostRows(rows, true)
+	return api.expandPosts(ctx, stored, true)
 }
 
 //EventAttendees returns all users who are attending this event.
-func (api *API) eventAttendees(post gp.PostID) (attendees []gp.User, err error) {
-	q := "SELECT id, firstname, avatar, official FROM users JOIN event_attendees ON user_id = id WHERE post_id = ?"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	rows, err := s.Query(post)
-	if err != nil {
-		return
-	}
-	var avatar sql.NullString
-	for rows.Next() {
-		var user gp.User
-		err = rows.Scan(&user.ID, &user.Name, &avatar, &user.Official)
-		if avatar.Valid {
-			user.Avatar = avatar.String
-		}
-		attendees = append(attendees, user)
-	}
-	return
+func (api *API) eventAttendees(ctx context.Context, post gp.PostID) (attendees []gp.User, err error) {
+	return api.store.Posts.Attendees(ctx, post)
 }
 
 //UserPostCount returns this user's number of posts, from the other user's perspective (ie, only the posts in groups they share).
-func (api *API) userPostCount(perspective, user gp.UserID) (count int, err error) {
-	q := "SELECT COUNT(*) FROM wall_posts "
-	q += "WHERE `by` = ? "
-	q += "AND deleted = 0 AND pending = 0 "
-	q += "AND network_id IN (SELECT network_id FROM user_network WHERE user_id = ?)"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(user, perspective).Scan(&count)
-	return
+func (api *API) userPostCount(ctx context.Context, perspective, user gp.UserID) (count int, err error) {
+	return api.store.Posts.PostCount(ctx, perspective, user)
 }
 
 //UserAttending returns all the events this user is attending.
-func (api *API) userAttending(perspective, user gp.UserID, category string, mode int, index int64, count int) (events []gp.PostSmall, err error) {
-	events = make([]gp.PostSmall, 0)
-	q := baseQuery + attendClause
-	if len(category) > 0 {
-		q += categoryClause + notDeleted + notPending + byVisibleAttendance + category
-	} else {
-		q += notDeleted + notPending + byVisibleAttendance
-	}
-	switch {
-	case mode == ByOffsetDescending:
-		q += orderLinearAttend
-	case mode == ChronologicallyAfterID:
-		q += whereAfterAtt + orderChronologicalAttend
-	case mode == ChronologicallyBeforeID:
-		q += whereBeforeAtt + orderChronologicalAttend
-	}
-	s, err := api.sc.Prepare(q)
+func (api *API) userAttending(ctx context.Context, perspective, user gp.UserID, category string, mode int, index int64, count int) (events []gp.PostSmall, err error) {
+	stored, err := api.store.Posts.Attending(ctx, perspective, user, category, mode, index, count)
 	if err != nil {
-		log.Println("Error preparing statement:", err, "Statement:", q)
-		return
-	}
-	var rows *sql.Rows
-	switch {
-	case len(category) > 0 && mode != ByOffsetDescending:
-		rows, err = s.Query(perspective, user, category, index, user, count)
-	case len(category) > 0 && mode == ByOffsetDescending:
-		rows, err = s.Query(perspective, user, category, index, count)
-	case mode != ByOffsetDescending:
-		rows, err = s.Query(perspective, user, index, user, count)
-	default:
-		rows, err = s.Query(perspective, user, index, count)
-	}
-	if err != nil {
-		log.Println("Error querying:", err, q)
-		return
+		log.Println("Error getting events:", err)
+		return make([]gp.PostSmall, 0), err
 	}
-	return api.scanPostRows(rows, false)
+	return api.expandPosts(ctx, stored, false)
 }
 
 //IsAttending returns true iff this user is attending/has attended this post.
-func (api *API) isAttending(userID gp.UserID, postID gp.PostID) (attending bool, err error) {
-	q := "SELECT COUNT(*) FROM event_attendees WHERE user_id = ? AND post_id = ?"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(userID, postID).Scan(&attending)
-	return
+func (api *API) isAttending(ctx context.Context, userID gp.UserID, postID gp.PostID) (attending bool, err error) {
+	return api.store.Posts.IsAttending(ctx, userID, postID)
 }
 
 //ChangePostText sets this post's text.
-func (api *API) changePostText(postID gp.PostID, text string) (err error) {
-	q := "UPDATE wall_posts SET text = ? WHERE id = ?"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(text, postID)
-	return
-}
-
-//AddCategory marks the post id as a member of category.
-func (api *API) addCategory(id gp.PostID, category gp.CategoryID) (err error) {
-	s, err := api.sc.Prepare("INSERT INTO post_categories (post_id, category_id) VALUES (?, ?)")
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(id, category)
-	return
+func (api *API) changePostText(ctx context.Context, postID gp.PostID, text string) (err error) {
+	return api.store.Posts.SetText(ctx, postID, text)
 }
 
 //CategoryList returns all existing categories.
-func (api *API) CategoryList() (categories []gp.PostCategory, err error) {
-	s, err := api.sc.Prepare("SELECT id, tag, name FROM categories WHERE 1")
-	if err != nil {
-		return
-	}
-	rows, err := s.Query()
-	if err != nil {
-		return
-	}
-	defer rows.Close()
-	for rows.Next() {
-		c := gp.PostCategory{}
-		err = rows.Scan(&c.ID, &c.Tag, &c.Name)
-		if err != nil {
-			return
-		}
-		categories = append(categories, c)
-	}
-	return
+func (api *API) CategoryList(ctx context.Context) (categories []gp.PostCategory, err error) {
+	return api.store.Posts.AllCategories(ctx)
 }
 
 //ClearCategories removes all this post's categories.
-func (api *API) clearCategories(post gp.PostID) (err error) {
-	s, err := api.sc.Prepare("DELETE FROM categories WHERE post_id = ?")
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(post)
-	return
+func (api *API) clearCategories(ctx context.Context, post gp.PostID) (err error) {
+	return api.store.Posts.ClearCategories(ctx, post)
 }
 
 //CreateLike records that this user has liked this post. Acts idempotently.
-func (api *API) createLike(user gp.UserID, post gp.PostID) (err error) {
-	s, err := api.sc.Prepare("REPLACE INTO post_likes (post_id, user_id) VALUES (?, ?)")
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(post, user)
-	return
-}
-
-//GetLikes returns all this post's likes
-func (api *API) _getLikes(post gp.PostID) (likes []gp.Like, err error) {
-	s, err := api.sc.Prepare("SELECT user_id, timestamp FROM post_likes WHERE post_id = ?")
-	if err != nil {
-		return
-	}
-	rows, err := s.Query(post)
-	if err != nil {
-		return
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var t string
-		var like gp.Like
-		err = rows.Scan(&like.UserID, &t)
-		if err != nil {
-			return
-		}
-		like.Time, err = time.Parse(mysqlTime, t)
-		if err != nil {
-			return
-		}
-		likes = append(likes, like)
-	}
-	return
+func (api *API) createLike(ctx context.Context, user gp.UserID, post gp.PostID) (err error) {
+	return api.store.Posts.Like(ctx, user, post)
 }
 
 //Attend adds the user to the "attending" list for this event. It's idempotent, and should only return an error if the database is down.
 //The results are undefined for a post which isn't an event.
 //(ie: it will work even though it shouldn't, until I can get round to enforcing it.)
-func (api *API) attend(event gp.PostID, user gp.UserID) (changed bool, err error) {
-	query := "REPLACE INTO event_attendees (post_id, user_id) VALUES (?, ?)"
-	s, err := api.sc.Prepare(query)
-	if err != nil {
-		return
-	}
-	res, err := s.Exec(event, user)
-	if err != nil {
-		return
-	}
-	affected, err := res.RowsAffected()
-	if err != nil {
-		return
-	}
-	if affected > 0 {
-		changed = true
-	}
-	return
+func (api *API) attend(ctx context.Context, event gp.PostID, user gp.UserID) (changed bool, err error) {
+	return api.store.Posts.Attend(ctx, event, user)
 }
 
 //UnAttend removes a user's attendance to an event. Idempotent, returns an error if the DB is down.
-func (api *API) unAttend(event gp.PostID, user gp.UserID) (err error) {
-	query := "DELETE FROM event_attendees WHERE post_id = ? AND user_id = ?"
-	s, err := api.sc.Prepare(query)
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(event, user)
-	return
+func (api *API) unAttend(ctx context.Context, event gp.PostID, user gp.UserID) (err error) {
+	return api.store.Posts.Unattend(ctx, event, user)
 }
 
 //SubjectiveRSVPCount shows the number of events otherID has attended, from the perspective of the `perspective` user (ie, not counting those events perspective can't see...)
-func (api *API) subjectiveRSVPCount(perspective gp.UserID, otherID gp.UserID) (count int, err error) {
-	q := "SELECT COUNT(*) FROM event_attendees JOIN wall_posts ON event_attendees.post_id = wall_posts.id "
-	q += "WHERE wall_posts.network_id IN ( SELECT network_id FROM user_network WHERE user_network.user_id = ? ) "
-	q += "AND wall_posts.deleted = 0 AND wall_posts.pending = 0 "
-	q += "AND event_attendees.user_id = ?"
-	s, err := api.sc.Prepare(q)
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(perspective, otherID).Scan(&count)
-	return
+func (api *API) subjectiveRSVPCount(ctx context.Context, perspective gp.UserID, otherID gp.UserID) (count int, err error) {
+	return api.store.Posts.RSVPCount(ctx, perspective, otherID)
 }
 
 //KeepPostsInFuture returns all the posts which should be kept in the future
-func (api *API) keepPostsInFuture() (err error) {
-	s, err := api.sc.Prepare("SELECT post_id, value FROM post_attribs WHERE attrib = 'meta-future'")
+func (api *API) keepPostsInFuture(ctx context.Context) (err error) {
+	futures, err := api.store.Posts.AttribValues(ctx, "meta-future")
 	if err != nil {
 		return
 	}
-	rows, err := s.Query()
-	if err != nil {
-		return
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var post gp.PostID
-		var tstring string
-		err := rows.Scan(&post, &tstring)
+	for post, tstring := range futures {
 		d, err := time.ParseDuration(tstring)
 		if err != nil {
 			return err
 		}
 		attribs := make(map[string]string)
 		attribs["event-time"] = strconv.FormatInt(time.Now().UTC().Add(d).Unix(), 10)
-		err = api.setPostAttribs(post, attribs)
+		err = api.setPostAttribs(ctx, post, attribs)
 		if err != nil {
 			return err
 		}
@@ -1759,23 +1177,9 @@ func (api *API) keepPostsInFuture() (err error) {
 	return nil
 }
 
-func postOwner(sc *psc.StatementCache, post gp.PostID) (by gp.UserID, err error) {
-	s, err := sc.Prepare("SELECT `by` FROM wall_posts WHERE id = ?")
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(post).Scan(&by)
-	return
-}
-
 //MarkPostsSeen eliminates posts up to and including upTo from any badge value calculations.
-func (api *API) MarkPostsSeen(userID gp.UserID, netID gp.NetworkID, upTo gp.PostID) (err error) {
-	s, err := api.sc.Prepare("UPDATE user_network SET seen_upto = (SELECT MAX(id) FROM wall_posts WHERE id <= ?) WHERE user_id = ? AND network_id = ?")
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(upTo, userID, netID)
-	return
+func (api *API) MarkPostsSeen(ctx context.Context, userID gp.UserID, netID gp.NetworkID, upTo gp.PostID) (err error) {
+	return api.store.Networks.MarkPostsSeen(ctx, userID, netID, upTo)
 }
 
 //NetworkChannel gives the event channel for this network
@@ -1,41 +1,36 @@
 package lib
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"time"
 
 	"github.com/Petergatsby/GleepostAPI/lib/events"
 	"github.com/Petergatsby/GleepostAPI/lib/gp"
-	"github.com/Petergatsby/GleepostAPI/lib/psc"
+	"github.com/Petergatsby/GleepostAPI/lib/store"
 	"github.com/garyburd/redigo/redis"
 )
 
 //Presences handles users' presence.
 type Presences struct {
-	broker *events.Broker
-	sc     *psc.StatementCache
-	Statsd PrefixStatter
-	pool   *redis.Pool
-}
-
-type presenceEvent struct {
-	UserID gp.UserID `json:"user"`
-	Form   string    `json:"form"`
-	At     time.Time `json:"at"`
+	broker        events.EventBus
+	conversations store.Conversations
+	Statsd        PrefixStatter
+	pool          *redis.Pool
 }
 
 //InvalidFormFactor occurs when a client attempts to register Presence with an unsupported form factor.
 var InvalidFormFactor = gp.APIerror{Reason: "Form must be either 'desktop' or 'mobile'"}
 
 //Broadcast sends this user's presence to all conversations they participate in.
-func (p Presences) Broadcast(userID gp.UserID, FormFactor string) error {
+func (p Presences) Broadcast(ctx context.Context, userID gp.UserID, FormFactor string) error {
 	if FormFactor != "desktop" && FormFactor != "mobile" {
 		return InvalidFormFactor
 	}
 	at := time.Now().UTC().Round(time.Second)
-	p.setPresence(userID, FormFactor, at)
-	people, err := p.everyConversationParticipants(userID)
+	p.setPresence(ctx, userID, FormFactor, at)
+	people, err := p.everyConversationParticipants(ctx, userID)
 	if err != nil {
 		log.Println(err)
 		return err
@@ -44,8 +39,8 @@ func (p Presences) Broadcast(userID gp.UserID, FormFactor string) error {
 	for _, u := range people {
 		chans = append(chans, fmt.Sprintf("c:%d", u))
 	}
-	event := presenceEvent{UserID: userID, Form: FormFactor, At: at}
-	go p.broker.PublishEvent("presence", userURL(userID), event, chans)
+	event := gp.PresenceEvent{UserID: userID, Form: FormFactor, At: at}
+	go p.broker.PublishEvent(events.Presence, userURL(userID), event, chans)
 	return nil
 }
 
@@ -53,8 +48,8 @@ func userURL(userID gp.UserID) (url string) {
 	return fmt.Sprintf("/user/%d", userID)
 }
 
-func (p Presences) setPresence(userID gp.UserID, FormFactor string, at time.Time) {
-	conn := p.pool.Get()
+func (p Presences) setPresence(ctx context.Context, userID gp.UserID, FormFactor string, at time.Time) {
+	conn := redisConn(ctx, p.pool)
 	defer conn.Close()
 	key := fmt.Sprintf("users:%d:presence:%s", userID, FormFactor)
 	conn.Send("SET", key, at.Format(time.RFC3339))
@@ -63,8 +58,8 @@ func (p Presences) setPresence(userID gp.UserID, FormFactor string, at time.Time
 
 var noPresence = gp.APIerror{Reason: "User has no presence"}
 
-func (p Presences) getPresence(userID gp.UserID) (presence gp.Presence, err error) {
-	conn := p.pool.Get()
+func (p Presences) getPresence(ctx context.Context, userID gp.UserID) (presence gp.Presence, err error) {
+	conn := redisConn(ctx, p.pool)
 	defer conn.Close()
 	mobileKey := fmt.Sprintf("users:%d:presence:mobile", userID)
 	desktopKey := fmt.Sprintf("users:%d:presence:desktop", userID)
@@ -95,24 +90,7 @@ func (p Presences) getPresence(userID gp.UserID) (presence gp.Presence, err erro
 	return
 }
 
-func (p Presences) everyConversationParticipants(user gp.UserID) (participants []gp.UserID, err error) {
+func (p Presences) everyConversationParticipants(ctx context.Context, user gp.UserID) (participants []gp.UserID, err error) {
 	defer p.Statsd.Time(time.Now(), "gleepost.conversations.everyConversationParticipants.db")
-	s, err := p.sc.Prepare("SELECT DISTINCT(participant_id) FROM conversation_participants WHERE conversation_id IN (SELECT conversation_id from conversation_participants WHERE participant_id = ? AND deleted = 0)")
-	if err != nil {
-		return
-	}
-	rows, err := s.Query(user)
-	if err != nil {
-		return
-	}
-	defer rows.Close()
-	var u gp.UserID
-	for rows.Next() {
-		err = rows.Scan(&u)
-		if err != nil {
-			return
-		}
-		participants = append(participants, u)
-	}
-	return
+	return p.conversations.Contacts(ctx, user)
 }
@@ -1,30 +1,154 @@
 package psc
 
-import "database/sql"
+import (
+	"container/list"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
 
-//StatementCache caches prepared statements.
+//DefaultSize is how many statements a cache holds if you don't say.
+const DefaultSize = 1000
+
+//ErrClosed is returned by Prepare once the cache has been closed.
+var ErrClosed = errors.New("psc: statement cache is closed")
+
+//evictionGrace is how long an evicted statement is kept open, so that whoever was just handed it can still use it.
+var evictionGrace = time.Minute
+
+//Statter receives the cache's hit, miss and eviction counts. lib's PrefixStatter is one.
+type Statter interface {
+	Count(count int, bucket string)
+}
+
+//entry is one cached query. ready is closed once stmt or err has been set, so everyone asking for a query which is still being prepared waits for the one preparation.
+type entry struct {
+	query string
+	stmt  *sql.Stmt
+	err   error
+	ready chan struct{}
+}
+
+//StatementCache caches prepared statements. It's safe to use from many goroutines; it holds at most size statements, closing the least recently used.
 type StatementCache struct {
-	db    *sql.DB
-	stmts map[string]*sql.Stmt
+	db     *sql.DB
+	size   int
+	mu     sync.Mutex
+	stmts  map[string]*list.Element
+	lru    *list.List //Most recently used at the front.
+	stats  Statter
+	closed bool
 }
 
 //Prepare gives you an already prepared statement if available, otherwise prepares one with the underlying sql.db.
 func (s *StatementCache) Prepare(query string) (stmt *sql.Stmt, err error) {
-	stmt, ok := s.stmts[query]
-	if ok {
-		return stmt, nil
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, ErrClosed
+	}
+	if el, ok := s.stmts[query]; ok {
+		s.lru.MoveToFront(el)
+		e := el.Value.(*entry)
+		s.mu.Unlock()
+		s.count("hit")
+		<-e.ready
+		return e.stmt, e.err
 	}
-	stmt, err = s.db.Prepare(query)
-	if err != nil {
+	e := &entry{query: query, ready: make(chan struct{})}
+	s.stmts[query] = s.lru.PushFront(e)
+	var evicted []*entry
+	for s.lru.Len() > s.size {
+		evicted = append(evicted, s.remove(s.lru.Back()))
+	}
+	s.mu.Unlock()
+	s.count("miss")
+	for _, old := range evicted {
+		s.count("evict")
+		go old.closeAfter(evictionGrace)
+	}
+
+	e.stmt, e.err = s.db.Prepare(query)
+	if e.err != nil {
+		//Don't cache failures; the next caller gets to try again.
+		s.mu.Lock()
+		if el, ok := s.stmts[query]; ok && el.Value == e {
+			s.remove(el)
+		}
+		s.mu.Unlock()
+	}
+	close(e.ready)
+	return e.stmt, e.err
+}
+
+//remove forgets el. s.mu must be held.
+func (s *StatementCache) remove(el *list.Element) *entry {
+	e := s.lru.Remove(el).(*entry)
+	delete(s.stmts, e.query)
+	return e
+}
+
+//closeAfter closes e's statement (once it's been prepared) after wait.
+func (e *entry) closeAfter(wait time.Duration) {
+	<-e.ready
+	if e.stmt == nil {
 		return
 	}
-	s.stmts[query] = stmt
-	return stmt, nil
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+	e.stmt.Close()
+}
+
+func (s *StatementCache) count(what string) {
+	s.mu.Lock()
+	stats := s.stats
+	s.mu.Unlock()
+	if stats != nil {
+		stats.Count(1, "gleepost.psc."+what)
+	}
+}
+
+//SetStatter starts reporting hits, misses and evictions to stats.
+func (s *StatementCache) SetStatter(stats Statter) {
+	s.mu.Lock()
+	s.stats = stats
+	s.mu.Unlock()
+}
+
+//Len is how many statements are cached.
+func (s *StatementCache) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
 }
 
-//NewCache creates a new prepared statement cache.
-func NewCache(db *sql.DB) (s *StatementCache) {
-	s = &StatementCache{db: db}
-	s.stmts = make(map[string]*sql.Stmt)
+//Close closes every cached statement. Afterwards Prepare only returns ErrClosed.
+func (s *StatementCache) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	var all []*entry
+	for s.lru.Len() > 0 {
+		all = append(all, s.remove(s.lru.Back()))
+	}
+	s.mu.Unlock()
+	for _, e := range all {
+		e.closeAfter(0)
+	}
+}
+
+//NewCache creates a new prepared statement cache holding up to size statements (or DefaultSize, if size isn't positive).
+func NewCache(db *sql.DB, size int) (s *StatementCache) {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	s = &StatementCache{db: db, size: size}
+	s.stmts = make(map[string]*list.Element)
+	s.lru = list.New()
 	return
 }
@@ -0,0 +1,181 @@
+package psc
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//countingDriver is just enough of a database/sql driver to count how many statements are prepared and closed.
+type countingDriver struct {
+	prepared int64
+	closed   int64
+}
+
+func (d *countingDriver) Open(name string) (driver.Conn, error) {
+	return countingConn{d}, nil
+}
+
+type countingConn struct {
+	d *countingDriver
+}
+
+func (c countingConn) Prepare(query string) (driver.Stmt, error) {
+	if strings.HasPrefix(query, "BAD") {
+		return nil, errors.New("syntax error")
+	}
+	//Slow enough that concurrent callers overlap.
+	time.Sleep(time.Millisecond)
+	atomic.AddInt64(&c.d.prepared, 1)
+	return countingStmt{c.d}, nil
+}
+
+func (c countingConn) Close() error { return nil }
+
+func (c countingConn) Begin() (driver.Tx, error) { return nil, errors.New("no transactions") }
+
+type countingStmt struct {
+	d *countingDriver
+}
+
+func (s countingStmt) Close() error {
+	atomic.AddInt64(&s.d.closed, 1)
+	return nil
+}
+
+func (s countingStmt) NumInput() int { return -1 }
+
+func (s countingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+
+func (s countingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("no rows")
+}
+
+type countingStatter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *countingStatter) Count(count int, bucket string) {
+	c.mu.Lock()
+	c.counts[bucket] += count
+	c.mu.Unlock()
+}
+
+var drivers int64
+
+func testCache(t *testing.T, size int) (*StatementCache, *countingDriver) {
+	d := &countingDriver{}
+	name := fmt.Sprintf("psc-counting-%d", atomic.AddInt64(&drivers, 1))
+	sql.Register(name, d)
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewCache(db, size), d
+}
+
+func TestSingleFlight(t *testing.T) {
+	s, d := testCache(t, 10)
+	stats := &countingStatter{counts: make(map[string]int)}
+	s.SetStatter(stats)
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stmt, err := s.Prepare("SELECT 1")
+			if err != nil || stmt == nil {
+				t.Errorf("Prepare failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt64(&d.prepared); n != 1 {
+		t.Fatalf("Expected the query to be prepared once, it was prepared %d times", n)
+	}
+	if stats.counts["gleepost.psc.miss"] != 1 || stats.counts["gleepost.psc.hit"] != 99 {
+		t.Fatalf("Expected 1 miss and 99 hits, got %v", stats.counts)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	evictionGrace = 0
+	s, d := testCache(t, 5)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_, err := s.Prepare(fmt.Sprintf("SELECT %d", (i+j)%12))
+				if err != nil {
+					t.Errorf("Prepare failed: %v", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if s.Len() != 5 {
+		t.Fatalf("Expected 5 cached statements, got %d", s.Len())
+	}
+	//The least recently used goes first.
+	for i := 0; i < 5; i++ {
+		s.Prepare(fmt.Sprintf("SELECT %d", i))
+	}
+	s.Prepare("SELECT 0")
+	s.Prepare("SELECT new")
+	s.mu.Lock()
+	_, kept := s.stmts["SELECT 0"]
+	_, evicted := s.stmts["SELECT 1"]
+	s.mu.Unlock()
+	if !kept || evicted {
+		t.Fatal("Expected SELECT 1 to be evicted, and SELECT 0 kept")
+	}
+	s.Close()
+	deadline := time.Now().Add(time.Second)
+	for {
+		prepared, closed := atomic.LoadInt64(&d.prepared), atomic.LoadInt64(&d.closed)
+		if prepared == closed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Prepared %d statements but only closed %d", prepared, closed)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPrepareError(t *testing.T) {
+	s, _ := testCache(t, 10)
+	for i := 0; i < 2; i++ {
+		if _, err := s.Prepare("BAD QUERY"); err == nil {
+			t.Fatal("Expected an error")
+		}
+	}
+	if s.Len() != 0 {
+		t.Fatal("Failed statements shouldn't be cached")
+	}
+}
+
+func TestClose(t *testing.T) {
+	s, d := testCache(t, 10)
+	s.Prepare("SELECT 1")
+	s.Prepare("SELECT 2")
+	s.Close()
+	s.Close()
+	if closed := atomic.LoadInt64(&d.closed); closed != 2 {
+		t.Fatalf("Expected 2 statements to be closed, got %d", closed)
+	}
+	if _, err := s.Prepare("SELECT 1"); err != ErrClosed {
+		t.Fatalf("Expected ErrClosed, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"github.com/Petergatsby/GleepostAPI/lib/gp"
 )
 
@@ -10,3 +11,21 @@ func (api *API) EventSubscribe(subscriptions []string) (events gp.MsgQueue) {
 	events = api.broker.EventSubscribe(subscriptions)
 	return
 }
+
+//EventsSince returns the events published to channel after sequence number since, for a client which is reconnecting; see events.EventBus.
+func (api *API) EventsSince(channel string, since int64) (messages [][]byte, latest int64, complete bool, err error) {
+	return api.broker.EventsSince(channel, since)
+}
+
+//LatestSeqs returns the sequence number of the last event published to each of channels.
+func (api *API) LatestSeqs(channels []string) (latest map[string]int64, err error) {
+	return api.broker.LatestSeqs(channels)
+}
+
+//LiveConnections lists the realtime connections this server holds, for each user (or just for forUser, if it isn't 0). Only global admins may see them.
+func (api *API) LiveConnections(ctx context.Context, userID, forUser gp.UserID) (connections []gp.UserConnections, err error) {
+	if !api.isAdmin(ctx, userID) {
+		return nil, ENOTALLOWED
+	}
+	return api.Connections.Connections(forUser), nil
+}
@@ -1,20 +1,16 @@
 package lib
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
-	"fmt"
 	"log"
 	"regexp"
 	"strconv"
 	"time"
 
 	"github.com/Petergatsby/GleepostAPI/lib/gp"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/sns"
-	"github.com/draaglom/apns"
+	"github.com/Petergatsby/GleepostAPI/lib/push"
 )
 
 var normRegex = regexp.MustCompile(`<@[\w:]+\|(@\w+)>`)
@@ -23,129 +19,61 @@ func normalizeMessage(message string) (textified string) {
 	return normRegex.ReplaceAllString(message, "$1")
 }
 
-type Push struct {
-	Alert   *string     `json:"alert,omitempty"`
-	Sound   *string     `json:"sound,omitempty"`
-	Message *string     `json:"message,omitempty"`
-	Data    interface{} `json:"custom_data,omitempty"`
-	Badge   *int        `json:"badge,omitempty"`
-}
-
-type wrapper struct {
-	APNS        string `json:"APNS,omitempty"`
-	APNSSandbox string `json:"APNS_SANDBOX,omitempty"`
-	GCM         string `json:"GCM,omitempty"`
-	Default     string `json:"default,omitempty"`
-}
-
-type pushContainer struct {
-	APS Push `json:"aps,omitempty"`
-}
-
-func publishToEndpoint(device gp.Device, data *Push) (err error) {
-	svc := sns.New(session.New(), &aws.Config{Region: aws.String("us-west-2")})
-
-	// arn is arn:aws:sns:us-west-2:807138844328:endpoint/{service_type}/CampusWire-GP-API-Prod/{uuid} where {service_type} is either APNS or GCM (depending on the type of token received) and {uuid} is the uuid that aws returned in the createplatformendpoint call
-
-	log.Println("Device", device)
-
-	arn := device.ARN
-
-	msg := wrapper{}
-	ios := pushContainer{
-		APS: *data,
-	}
-	b, err := json.Marshal(ios)
-	if err != nil {
-		log.Println("Publishing error", err)
-		return err
-	}
-	msg.APNS = string(b[:])
-	// msg.APNSSandbox = string(b[:])
-	// msg.Default = msg.Default
-	pushData, err := json.Marshal(msg)
-	if err != nil {
-		log.Println("Publishing marshal error", err)
-		return err
-	}
-	m := string(pushData[:])
-
-	params := &sns.PublishInput{
-		Message:          aws.String(m),
-		MessageStructure: aws.String("json"),
-		TargetArn:        aws.String(arn),
-	}
-	log.Println("Params", params)
-	_, err = svc.Publish(params)
-	return
-}
+//messagePush notifies everyone else in the conversation (who hasn't muted it, unless they're mentioned) about a new message.
+//The pushes go out after the message has been sent, so they don't share its request's context.
 func (api *API) messagePush(message gp.Message, convID gp.ConversationID) {
-	devices, err := api.pushableDevices(convID)
+	ctx := context.Background()
+	devices, err := api.pushableDevices(ctx, convID)
 	if err != nil {
 		log.Println("Get pushable devices error", err)
 		return
 	}
+	mentions := api.spotMentions(ctx, message.Text, convID)
 	for _, device := range devices {
-		if device.ARN == "" {
-			log.Println("No Arn exists for the device")
+		if device.User == message.By.ID {
 			continue
 		}
-		// mentioned := false
-		// presence, err := api.Presences.getPresence(device.User)
-		// if err != nil && err != noPresence {
-		// 	log.Println("Error getting user presence:", err)
-		// }
-		// if presence.Form == "desktop" && presence.At.Add(30*time.Second).After(time.Now()) {
-		// 	log.Println("Not pushing to this user (they're active on the desktop in the last 30s) (push.go)")
-		// 	continue
-		// }
-		// muted, err := api.conversationMuted(device.User, convID)
-		// if err != nil {
-		// 	log.Println(err)
-		// 	continue
-		// }
-		// mentions := api.spotMentions(message.Text, convID)
-		// if mentions.Contains(message.By.ID) {
-		// 	mentioned = true
-		// }
-		log.Println("Device", device)
-		log.Println("Message", message)
-		// if device.User != message.By.ID && (!muted || mentioned) {
-		if device.User != message.By.ID {
-			// TODO: Send push notifications here
-			// At this point you have a bunch of gp.Device, which have a device.ARN on each of them.
-			// You probably want to use (a) normalizeMessage to make our attachment/embed syntax nicer for the notification and
-			// (b) use api.badgeCount() to work out what your badge should be
-			// You have a profile image available in message.By.Avatar
-			// You may have a group ID at message.Group, that's probably important to send if it's there
-			normalized := normalizeMessage(message.Text)
-			badgeCount, badgeErr := api.badgeCount(device.User)
-			if badgeErr != nil {
-				log.Println("Error when getting users badge count", badgeErr)
-			}
-			alertString := fmt.Sprintf("%s: %s", message.By.Name, normalized)
-			sound := "default"
-			pushObj := &Push{
-				Alert: &alertString,
-				Badge: &badgeCount,
-				Sound: &sound,
-			}
-			snsErr := publishToEndpoint(device, pushObj)
-			if snsErr != nil {
-				log.Println("Error when pushing to SNS", snsErr)
-			}
-			log.Println("Pushed to SNS!!!")
+		presence, err := api.Presences.getPresence(ctx, device.User)
+		if err != nil && err != noPresence {
+			log.Println("Error getting user presence:", err)
+		}
+		if presence.Form == "desktop" && presence.At.Add(30*time.Second).After(time.Now()) {
+			continue
+		}
+		mentioned := mentions.Contains(device.User)
+		muted, err := api.conversationMuted(ctx, device.User, convID)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if muted && !mentioned {
+			continue
+		}
+		quiet, err := inQuietHours(ctx, api.sc, device.User)
+		if err != nil {
+			log.Println("Error checking quiet hours:", err)
+		}
+		if quiet {
+			continue
+		}
+		n, err := api.messageNotification(ctx, message, convID, device.User, mentioned)
+		if err != nil {
+			log.Println("Error generating push notification:", err)
+		}
+		err = api.pushQueue.enqueue(ctx, "gleepost", device, n)
+		if err != nil {
+			log.Println("Error queueing push notification:", err)
 		}
 	}
 }
 
-func (api *API) pushableDevices(convID gp.ConversationID) (devices []gp.Device, err error) {
+func (api *API) pushableDevices(ctx context.Context, convID gp.ConversationID) (devices []gp.Device, err error) {
 	defer api.Statsd.Time(time.Now(), "gleepost.pushable_devices.byConversationID.db")
 	s, err := api.sc.Prepare("SELECT participant_id, device_type, device_id, arn FROM conversation_participants JOIN users ON conversation_participants.participant_id = users.id JOIN devices ON participant_id = devices.user_id WHERE conversation_id = ? AND deleted = 0 AND application = 'gleepost'")
 	if err != nil {
 		return
 	}
-	rows, err := s.Query(convID)
+	rows, err := s.QueryContext(ctx, convID)
 	if err != nil {
 		log.Println("Error getting participant device:", err)
 		return
@@ -166,112 +94,86 @@ func (api *API) pushableDevices(convID gp.ConversationID) (devices []gp.Device,
 	return
 }
 
-func (api *API) iosPushMessage(device string, message gp.Message, convID gp.ConversationID, user gp.UserID, mentioned bool) (err error) {
-	payload := apns.NewPayload()
-	d := apns.NewAlertDictionary()
+func (api *API) messageNotification(ctx context.Context, message gp.Message, convID gp.ConversationID, user gp.UserID, mentioned bool) (n push.Notification, err error) {
+	n.Alert.LocKey = "MSG"
 	if mentioned {
-		d.LocKey = "mentioned"
-	} else {
-		d.LocKey = "MSG"
+		n.Alert.LocKey = "mentioned"
 	}
-	d.LocArgs = []string{message.By.Name}
+	n.Alert.LocArgs = []string{message.By.Name}
 	message.Text = normalizeMessage(message.Text)
 	if len(message.Text) > 64 {
-		d.LocArgs = append(d.LocArgs, message.Text[:64]+"...")
+		n.Alert.LocArgs = append(n.Alert.LocArgs, message.Text[:64]+"...")
 	} else {
-		d.LocArgs = append(d.LocArgs, message.Text)
+		n.Alert.LocArgs = append(n.Alert.LocArgs, message.Text)
 	}
-	payload.Alert = d
-	payload.Sound = "default"
-	payload.Badge, err = api.badgeCount(user)
-	pn := apns.NewPushNotification()
-	pn.DeviceToken = device
-	pn.AddPayload(payload)
-	pn.Set("conv", convID)
+	n.Sound = "default"
+	badge, err := api.badgeCount(ctx, user)
+	n.Badge = &badge
+	n.Data = map[string]interface{}{"conv": convID, "profile_image": message.By.Avatar}
 	if message.Group > 0 {
-		pn.Set("group", message.Group)
+		n.Data["group"] = message.Group
 	}
-	pn.Set("profile_image", message.By.Avatar)
 	return
 }
 
-//FeedbackDaemon checks the APNS feedback service every frequency seconds.
-func (api *API) FeedbackDaemon(frequency int) {
-	duration := time.Duration(frequency) * time.Second
-	c := time.Tick(duration)
-	for {
-		<-c
-		for _, psh := range api.pushers {
-			go psh.CheckFeedbackService(api.DeviceFeedback)
-		}
-	}
-}
-
 //SendUpdateNotification sends an update notification to all devices which, when pressed, prompts the user to update if version > installed version.
-func (api *API) SendUpdateNotification(userID gp.UserID, message, version, platform string) (count int, err error) {
-	if !api.isAdmin(userID) {
+func (api *API) SendUpdateNotification(ctx context.Context, userID gp.UserID, message, version, platform string) (count int, err error) {
+	if !api.isAdmin(ctx, userID) {
 		err = ENOTALLOWED
 		return
 	}
-	return api.massNotification(message, version, platform)
+	return api.massNotification(ctx, message, version, platform)
 }
 
 //MassNotification sends an update notification to all devices which, when pressed, prompts the user to update if version > installed version.
-func (api *API) massNotification(message string, version string, platform string) (count int, err error) {
-	devices, err := api.getAllDevices(platform)
+func (api *API) massNotification(ctx context.Context, message string, version string, platform string) (count int, err error) {
+	devices, err := api.getAllDevices(ctx, platform)
 	if err != nil {
 		return
 	}
 	if len(devices) == 0 {
 		return 0, errors.New("no devices on that platform")
 	}
+	if _, ok := api.pushers["gleepost"]; !ok {
+		return 0, errors.New("no gleepost pusher")
+	}
 	for _, device := range devices {
-		switch {
-		case device.Type == "ios":
-			err = api.iOSUpdateNotification(device, message, version)
-			if err == nil {
-				count++
-			} else {
-				log.Println(err)
-			}
-		default:
+		err = api.pushQueue.enqueue(ctx, "gleepost", device, api.updateNotification(ctx, device, message, version))
+		if err == nil {
+			count++
+		} else {
+			log.Println(err)
 		}
 	}
 	return
 }
 
-func (api *API) iOSUpdateNotification(device gp.Device, message string, version string) (err error) {
-	payload := apns.NewPayload()
-	payload.Alert = message
-	payload.Sound = "default"
-	payload.Badge, err = api.badgeCount(device.User)
+func (api *API) updateNotification(ctx context.Context, device gp.Device, message string, version string) (n push.Notification) {
+	badge, err := api.badgeCount(ctx, device.User)
 	if err != nil {
 		log.Println(err)
 	}
-	pn := apns.NewPushNotification()
-	pn.DeviceToken = device.ID
-	pn.AddPayload(payload)
-	pn.Set("version", version)
-	pusher, ok := api.pushers["gleepost"]
-	if ok {
-		pusher.IOSPush(pn)
+	return push.Notification{
+		Alert: push.Alert{Body: message},
+		Sound: "default",
+		Badge: &badge,
+		Data:  map[string]interface{}{"version": version},
 	}
-	return
 }
 
-func (api *API) badgeCount(user gp.UserID) (count int, err error) {
-	count, err = api.userUnreadNotifications(user)
+func (api *API) badgeCount(ctx context.Context, user gp.UserID) (count int, err error) {
+	count, err = api.userUnreadNotifications(ctx, user)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	unread, err := api.UnreadMessageCount(user)
+	unread, err := api.UnreadMessageCount(ctx, user)
 	if err == nil {
 		count += unread
 	} else {
 		log.Println(err)
 	}
-	newPosts, err := api.totalGroupsNewPosts(user)
+	newPosts, err := api.totalGroupsNewPosts(ctx, user)
 	if err == nil {
 		count += newPosts
 	} else {
@@ -283,9 +185,9 @@ func (api *API) badgeCount(user gp.UserID) (count int, err error) {
 
 var captureIDRegex = regexp.MustCompile(`<@(\w+)\|@?\w+>`)
 
-func (api *API) spotMentions(message string, convID gp.ConversationID) (mentioned mentioned) {
+func (api *API) spotMentions(ctx context.Context, message string, convID gp.ConversationID) (mentioned mentioned) {
 	m := make(map[gp.UserID]bool)
-	participants, err := api.getParticipants(convID, false)
+	participants, err := api.getParticipants(ctx, convID, false)
 	if err != nil {
 		log.Println(err)
 	}
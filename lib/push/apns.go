@@ -0,0 +1,161 @@
+package push
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/conf"
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+//apnsTokenLifetime is how long a provider token is reused. Apple rejects tokens older than an hour, and throttles ones refreshed more often than every 20 minutes.
+const apnsTokenLifetime = 40 * time.Minute
+
+//apnsPusher pushes to iOS devices over APNs' HTTP/2 API, authenticating with a signed provider token.
+type apnsPusher struct {
+	config conf.APNSConfig
+	key    crypto.Signer
+	client *http.Client
+	mu     sync.Mutex
+	token  string
+	issued time.Time
+}
+
+func newAPNS(config conf.APNSConfig) (p *apnsPusher, err error) {
+	data, err := ioutil.ReadFile(config.AuthKey)
+	if err != nil {
+		return
+	}
+	key, err := parsePrivateKey(data)
+	if err != nil {
+		return
+	}
+	if _, ok := key.(*ecdsa.PrivateKey); !ok {
+		return nil, errors.New("push: APNs auth key must be an ECDSA key")
+	}
+	return &apnsPusher{config: config, key: key, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+func (p *apnsPusher) endpoint() string {
+	switch {
+	case p.config.Endpoint != "":
+		return p.config.Endpoint
+	case p.config.Production:
+		return "https://api.push.apple.com"
+	default:
+		return "https://api.sandbox.push.apple.com"
+	}
+}
+
+//bearer returns the current provider token, signing a new one if it's getting old.
+func (p *apnsPusher) bearer() (token string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token != "" && time.Since(p.issued) < apnsTokenLifetime {
+		return p.token, nil
+	}
+	now := time.Now()
+	header := map[string]string{"alg": "ES256", "kid": p.config.KeyID}
+	claims := map[string]interface{}{"iss": p.config.TeamID, "iat": now.Unix()}
+	token, err = signJWT(header, claims, p.key)
+	if err != nil {
+		return
+	}
+	p.token, p.issued = token, now
+	return
+}
+
+type aps struct {
+	Alert            interface{} `json:"alert,omitempty"`
+	Badge            *int        `json:"badge,omitempty"`
+	Sound            string      `json:"sound,omitempty"`
+	ContentAvailable int         `json:"content-available,omitempty"`
+}
+
+type apnsAlert struct {
+	Body         string   `json:"body,omitempty"`
+	LocKey       string   `json:"loc-key,omitempty"`
+	LocArgs      []string `json:"loc-args,omitempty"`
+	ActionLocKey string   `json:"action-loc-key,omitempty"`
+}
+
+//apnsPayload lays n out as APNs expects: the standard fields in "aps", and the app's own data alongside it.
+func apnsPayload(n Notification) map[string]interface{} {
+	payload := make(map[string]interface{})
+	for k, v := range n.Data {
+		payload[k] = v
+	}
+	a := aps{Badge: n.Badge, Sound: n.Sound}
+	if n.Alert.Empty() {
+		a.ContentAvailable = 1
+	} else {
+		a.Alert = apnsAlert{Body: n.Alert.Body, LocKey: n.Alert.LocKey, LocArgs: n.Alert.LocArgs, ActionLocKey: n.Alert.ActionLocKey}
+	}
+	payload["aps"] = a
+	return payload
+}
+
+type apnsError struct {
+	Reason    string `json:"reason"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+//Push sends n to an iOS device.
+func (p *apnsPusher) Push(device gp.Device, n Notification) (err error) {
+	body, err := json.Marshal(apnsPayload(n))
+	if err != nil {
+		return
+	}
+	token, err := p.bearer()
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest("POST", p.endpoint()+"/3/device/"+device.ID, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("apns-topic", p.config.Topic)
+	if n.Alert.Empty() {
+		req.Header.Set("apns-push-type", "background")
+		req.Header.Set("apns-priority", "5")
+	} else {
+		req.Header.Set("apns-push-type", "alert")
+		req.Header.Set("apns-priority", "10")
+	}
+	if n.CollapseKey != "" {
+		req.Header.Set("apns-collapse-id", n.CollapseKey)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	var e apnsError
+	json.NewDecoder(resp.Body).Decode(&e)
+	perr := &Error{Service: "apns", Status: resp.StatusCode, Reason: e.Reason}
+	if resp.StatusCode == http.StatusGone || e.Reason == "BadDeviceToken" || e.Reason == "Unregistered" {
+		perr.Unregistered = true
+		perr.At = time.Now()
+		if e.Timestamp > 0 {
+			perr.At = time.Unix(e.Timestamp/1000, 0)
+		}
+	}
+	return perr
+}
+
+//NeedsEndpoint is false: APNs is pushed to directly.
+func (p *apnsPusher) NeedsEndpoint(string) bool {
+	return false
+}
@@ -0,0 +1,211 @@
+package push
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/conf"
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+//serviceAccount is the part of a Google service account key we need to get access tokens.
+type serviceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+//fcmPusher pushes to android devices over the FCM HTTP v1 API, as a service account.
+type fcmPusher struct {
+	config  conf.FCMConfig
+	account serviceAccount
+	key     crypto.Signer
+	client  *http.Client
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newFCM(config conf.FCMConfig) (p *fcmPusher, err error) {
+	data, err := ioutil.ReadFile(config.ServiceAccount)
+	if err != nil {
+		return
+	}
+	p = &fcmPusher{config: config, client: &http.Client{Timeout: 10 * time.Second}}
+	err = json.Unmarshal(data, &p.account)
+	if err != nil {
+		return nil, err
+	}
+	if p.account.ProjectID == "" || p.account.ClientEmail == "" || p.account.TokenURI == "" {
+		return nil, errors.New("push: incomplete FCM service account")
+	}
+	p.key, err = parsePrivateKey([]byte(p.account.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *fcmPusher) endpoint() string {
+	if p.config.Endpoint != "" {
+		return p.config.Endpoint
+	}
+	return "https://fcm.googleapis.com"
+}
+
+//bearer returns an OAuth access token for FCM, exchanging a freshly signed assertion for a new one when the last is about to expire.
+func (p *fcmPusher) bearer() (token string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token != "" && time.Now().Add(time.Minute).Before(p.expires) {
+		return p.token, nil
+	}
+	now := time.Now()
+	header := map[string]string{"alg": "RS256", "typ": "JWT"}
+	claims := map[string]interface{}{
+		"iss":   p.account.ClientEmail,
+		"scope": fcmScope,
+		"aud":   p.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+	assertion, err := signJWT(header, claims, p.key)
+	if err != nil {
+		return
+	}
+	form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+	resp, err := p.client.PostForm(p.account.TokenURI, form)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", &Error{Service: "fcm", Status: resp.StatusCode, Reason: "couldn't get an access token"}
+	}
+	var t struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&t)
+	if err != nil {
+		return
+	}
+	p.token, p.expires = t.AccessToken, now.Add(time.Duration(t.ExpiresIn)*time.Second)
+	return p.token, nil
+}
+
+type fcmMessage struct {
+	Message fcmTarget `json:"message"`
+}
+
+type fcmTarget struct {
+	Token   string            `json:"token"`
+	Data    map[string]string `json:"data,omitempty"`
+	Android fcmAndroid        `json:"android"`
+}
+
+type fcmAndroid struct {
+	CollapseKey  string                  `json:"collapse_key,omitempty"`
+	Priority     string                  `json:"priority"`
+	Notification *fcmAndroidNotification `json:"notification,omitempty"`
+}
+
+type fcmAndroidNotification struct {
+	Body              string   `json:"body,omitempty"`
+	BodyLocKey        string   `json:"body_loc_key,omitempty"`
+	BodyLocArgs       []string `json:"body_loc_args,omitempty"`
+	Sound             string   `json:"sound,omitempty"`
+	NotificationCount *int     `json:"notification_count,omitempty"`
+}
+
+//fcmPayload lays n out as FCM expects. FCM data can only hold strings, so the badge (which android has no direct equivalent of) goes in there too.
+func fcmPayload(token string, n Notification) fcmMessage {
+	m := fcmMessage{Message: fcmTarget{Token: token, Data: make(map[string]string)}}
+	for k, v := range n.Data {
+		m.Message.Data[k] = fmt.Sprint(v)
+	}
+	if n.Badge != nil {
+		m.Message.Data["badge"] = fmt.Sprint(*n.Badge)
+	}
+	m.Message.Android = fcmAndroid{CollapseKey: n.CollapseKey, Priority: "normal"}
+	if !n.Alert.Empty() {
+		m.Message.Android.Priority = "high"
+		m.Message.Android.Notification = &fcmAndroidNotification{
+			Body:              n.Alert.Body,
+			BodyLocKey:        n.Alert.LocKey,
+			BodyLocArgs:       n.Alert.LocArgs,
+			Sound:             n.Sound,
+			NotificationCount: n.Badge,
+		}
+	}
+	return m
+}
+
+type fcmError struct {
+	Error struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		Details []struct {
+			ErrorCode string `json:"errorCode"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+func (e fcmError) unregistered() bool {
+	for _, d := range e.Error.Details {
+		if d.ErrorCode == "UNREGISTERED" {
+			return true
+		}
+	}
+	return false
+}
+
+//Push sends n to an android device.
+func (p *fcmPusher) Push(device gp.Device, n Notification) (err error) {
+	body, err := json.Marshal(fcmPayload(device.ID, n))
+	if err != nil {
+		return
+	}
+	token, err := p.bearer()
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest("POST", p.endpoint()+"/v1/projects/"+p.account.ProjectID+"/messages:send", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	var e fcmError
+	json.NewDecoder(resp.Body).Decode(&e)
+	perr := &Error{Service: "fcm", Status: resp.StatusCode, Reason: e.Error.Status + " " + e.Error.Message}
+	if resp.StatusCode == http.StatusNotFound || e.unregistered() {
+		perr.Unregistered = true
+		perr.At = time.Now()
+	}
+	return perr
+}
+
+//NeedsEndpoint is false: FCM is pushed to directly.
+func (p *fcmPusher) NeedsEndpoint(string) bool {
+	return false
+}
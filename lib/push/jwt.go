@@ -0,0 +1,69 @@
+package push
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+)
+
+//signJWT builds a JSON web token from header and claims, signed with key: ES256 for an ECDSA key (as APNs wants), or RS256 for an RSA one (as Google wants).
+func signJWT(header, claims interface{}, key crypto.Signer) (token string, err error) {
+	h, err := json.Marshal(header)
+	if err != nil {
+		return
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return
+	}
+	signing := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(signing))
+	var sig []byte
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			return
+		}
+		//JWS wants r and s as fixed-width big-endian integers, not ASN.1.
+		size := (k.Curve.Params().BitSize + 7) / 8
+		sig = make([]byte, 2*size)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(sig[size-len(rb):size], rb)
+		copy(sig[2*size-len(sb):], sb)
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			return
+		}
+	default:
+		return "", errors.New("push: unsupported signing key")
+	}
+	return signing + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+//parsePrivateKey reads a PEM-encoded PKCS #8 private key, as Apple and Google both hand out.
+func parsePrivateKey(data []byte) (key crypto.Signer, err error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("push: no PEM data in key")
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return
+	}
+	key, ok := k.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("push: unsupported private key")
+	}
+	return
+}
@@ -1,97 +1,153 @@
 package push
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"time"
 
 	"github.com/Petergatsby/GleepostAPI/lib/conf"
-	"github.com/draaglom/apns"
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
 )
 
+//Notification is a push notification, independent of the platform it's delivered to.
+type Notification struct {
+	Alert       Alert
+	Badge       *int                   //Nil leaves the badge alone.
+	Sound       string                 //Empty for a silent notification.
+	Data        map[string]interface{} //Extra values for the app, eg. which post the notification is about.
+	CollapseKey string                 //Notifications with the same collapse key replace each other, rather than piling up.
+}
+
+//Alert is the text of a notification: either Body, or a localizable string (LocKey, with LocArgs substituted in) which the app translates.
+//A notification with no alert just updates the badge or delivers data.
+type Alert struct {
+	Body         string
+	LocKey       string
+	LocArgs      []string
+	ActionLocKey string
+}
+
+//Empty reports whether there's nothing to show.
+func (a Alert) Empty() bool {
+	return a.Body == "" && a.LocKey == ""
+}
+
 //Pusher is able to push notifications to iOS and android devices.
 type Pusher interface {
-	CheckFeedbackService(Feedbacker)
-	IOSPush(*apns.PushNotification) error
+	Push(device gp.Device, n Notification) error
+	//NeedsEndpoint reports whether devices of this type are pushed to through SNS, and so need an SNS endpoint registered for them.
+	NeedsEndpoint(deviceType string) bool
 }
 
-type realPusher struct {
-	APNSconfig conf.APNSConfig
-	Connection *apns.Connection
+//Error is a push which APNs, FCM or SNS refused.
+type Error struct {
+	Service      string
+	Status       int
+	Reason       string
+	Unregistered bool      //The device token is no longer valid, and shouldn't be pushed to again.
+	At           time.Time //When the token stopped being valid, if Unregistered.
 }
 
-//Feedbacker is a function which processes APNS feedback.
-type Feedbacker func(string, uint32) error
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %d %s", e.Service, e.Status, e.Reason)
+}
 
-//CheckFeedbackService receives any bad device tokens from APNS and processes the result with f.
-func (pusher *realPusher) CheckFeedbackService(f Feedbacker) {
-	url := "feedback.sandbox.push.apple.com:2196"
-	if pusher.APNSconfig.Production {
-		url = "feedback.push.apple.com:2196"
-	}
-	client := apns.NewClient(url, pusher.APNSconfig.CertFile, pusher.APNSconfig.KeyFile)
-	go client.ListenForFeedback()
-	for {
-		select {
-		case resp := <-apns.FeedbackChannel:
-			log.Println("Bad device:", resp.DeviceToken, resp.Timestamp)
-			f(resp.DeviceToken, resp.Timestamp)
-		case <-apns.ShutdownChannel:
-			return
-		}
-	}
+//Temporary reports whether the push might succeed if it's tried again later.
+func (e *Error) Temporary() bool {
+	return e.Status == 429 || e.Status >= 500
 }
 
-type fakePusher struct{}
+//Temporary reports whether a push which failed with err is worth retrying: anything which isn't a refusal (eg. a network error) is assumed to be.
+func Temporary(err error) bool {
+	switch e := err.(type) {
+	case *Error:
+		return e.Temporary()
+	case nil:
+		return false
+	}
+	return err != UnsupportedDevice && err != NoEndpoint
+}
 
-func (f *fakePusher) CheckFeedbackService(feed Feedbacker) {
-	return
+//Unregistered reports whether err means the device should be forgotten.
+func Unregistered(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Unregistered
 }
 
-func (f *fakePusher) IOSPush(*apns.PushNotification) error {
-	return nil
+var (
+	//UnsupportedDevice means there's no way to push to this type of device.
+	UnsupportedDevice = errors.New("push: unsupported device type")
+	//NoEndpoint means the device would be pushed to through SNS, but it doesn't have an SNS endpoint.
+	NoEndpoint = errors.New("push: device has no SNS endpoint")
+)
+
+//router picks how to deliver to each device by its type: directly through APNs or FCM when they're configured, or through the device's SNS endpoint otherwise.
+type router struct {
+	ios     Pusher
+	android Pusher
+	sns     Pusher
 }
 
-//New constructs a Pusher from a Config
-func New(conf conf.PusherConfig) (pusher Pusher) {
-	log.Println("Building pusher")
-	p := new(realPusher)
-	p.APNSconfig = conf.APNS
-	url := "gateway.sandbox.push.apple.com:2195"
-	if p.APNSconfig.Production {
-		url = "gateway.push.apple.com:2195"
+//New constructs a Pusher from a Config.
+func New(config conf.PusherConfig) Pusher {
+	r := &router{sns: newSNS(config.SNS)}
+	if config.APNS.AuthKey != "" {
+		p, err := newAPNS(config.APNS)
+		if err != nil {
+			log.Printf("Error setting up APNs for %s; falling back to SNS: %v\n", config.AppName, err)
+		} else {
+			r.ios = p
+		}
 	}
-	log.Println("Pusher is using url:", url)
-	client := apns.NewClient(url, p.APNSconfig.CertFile, p.APNSconfig.KeyFile)
-	conn := apns.NewConnection(client)
-	p.Connection = conn
-	errs := p.Connection.Errors()
-	go func(c <-chan apns.BadPushNotification) {
-		for {
-			n := <-c
-			log.Println(n)
+	if config.FCM.ServiceAccount != "" {
+		p, err := newFCM(config.FCM)
+		if err != nil {
+			log.Printf("Error setting up FCM for %s; falling back to SNS: %v\n", config.AppName, err)
+		} else {
+			r.android = p
 		}
-	}(errs)
-	err := conn.Start()
-	if err != nil {
-		log.Println("ERROR STARTING APNS CONNECTION:", err)
 	}
-	pusher = p
-	return
+	return r
 }
 
-//NewFake gives a pusher which simply blackholes every notification.
-func NewFake() Pusher {
-	return &fakePusher{}
+func (r *router) direct(deviceType string) Pusher {
+	switch deviceType {
+	case "ios":
+		return r.ios
+	case "android":
+		return r.android
+	}
+	return nil
 }
 
-//IOSPush sends an apns notification to its recipient.
-func (pusher *realPusher) IOSPush(pn *apns.PushNotification) (err error) {
-	if pusher != nil {
-		pusher.Connection.Enqueue(pn)
+//Push sends n to device.
+func (r *router) Push(device gp.Device, n Notification) error {
+	if device.Type != "ios" && device.Type != "android" {
+		return UnsupportedDevice
 	}
+	if p := r.direct(device.Type); p != nil {
+		return p.Push(device, n)
+	}
+	return r.sns.Push(device, n)
+}
+
+//NeedsEndpoint reports whether this type of device is pushed to through SNS.
+func (r *router) NeedsEndpoint(deviceType string) bool {
+	return r.direct(deviceType) == nil
+}
+
+type fakePusher struct{}
+
+func (f *fakePusher) Push(gp.Device, Notification) error {
 	return nil
 }
 
-//Pushable represents something which can turn itself into a push notification.
-type Pushable interface {
-	IOSNotification() *apns.PushNotification
+func (f *fakePusher) NeedsEndpoint(string) bool {
+	return false
+}
+
+//NewFake gives a pusher which simply blackholes every notification.
+func NewFake() Pusher {
+	return &fakePusher{}
 }
@@ -0,0 +1,211 @@
+package push
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Petergatsby/GleepostAPI/lib/conf"
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+func writeKey(t *testing.T, dir, name string, key interface{}) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal("Error encoding key:", err)
+	}
+	path := filepath.Join(dir, name)
+	err = ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal("Error writing key:", err)
+	}
+	return path
+}
+
+func badge(n int) *int {
+	return &n
+}
+
+func TestAPNS(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "push")
+	defer os.RemoveAll(dir)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !validES256(strings.TrimPrefix(r.Header.Get("Authorization"), "bearer "), &key.PublicKey) {
+			w.WriteHeader(403)
+			w.Write([]byte(`{"reason":"InvalidProviderToken"}`))
+			return
+		}
+		if r.URL.Path == "/3/device/gone" {
+			w.WriteHeader(410)
+			w.Write([]byte(`{"reason":"Unregistered","timestamp":1476720000000}`))
+			return
+		}
+		if r.URL.Path != "/3/device/abc" || r.Header.Get("apns-topic") != "com.example.app" || r.Header.Get("apns-collapse-id") != "k" {
+			w.WriteHeader(400)
+			w.Write([]byte(`{"reason":"BadRequest"}`))
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer server.Close()
+
+	config := conf.PusherConfig{APNS: conf.APNSConfig{AuthKey: writeKey(t, dir, "key.p8", key), KeyID: "K", TeamID: "T", Topic: "com.example.app", Endpoint: server.URL}}
+	p := New(config)
+	n := Notification{Alert: Alert{LocKey: "MSG", LocArgs: []string{"Patrick", "hi"}}, Badge: badge(3), Sound: "default", Data: map[string]interface{}{"conv": 5}, CollapseKey: "k"}
+	err := p.Push(gp.Device{Type: "ios", ID: "abc"}, n)
+	if err != nil {
+		t.Fatal("Error pushing:", err)
+	}
+	aps, _ := got["aps"].(map[string]interface{})
+	alert, _ := aps["alert"].(map[string]interface{})
+	if alert["loc-key"] != "MSG" || aps["badge"] != 3.0 || got["conv"] != 5.0 {
+		t.Fatal("Unexpected payload:", got)
+	}
+	if p.NeedsEndpoint("ios") || !p.NeedsEndpoint("android") {
+		t.Fatal("iOS should be pushed directly, and android through SNS")
+	}
+
+	err = p.Push(gp.Device{Type: "ios", ID: "gone"}, n)
+	if !Unregistered(err) || Temporary(err) || err.(*Error).At.Unix() != 1476720000 {
+		t.Fatal("Expected the device to be reported unregistered, got", err)
+	}
+}
+
+func validES256(token string, key *ecdsa.PublicKey) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(sig) != 64 {
+		return false
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	return ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]))
+}
+
+func TestFCM(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "push")
+	defer os.RemoveAll(dir)
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	var got fcmMessage
+	tokens := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || r.FormValue("assertion") == "" {
+			w.WriteHeader(400)
+			return
+		}
+		tokens++
+		w.Write([]byte(`{"access_token":"sesame","expires_in":3600}`))
+	})
+	mux.HandleFunc("/v1/projects/gleepost/messages:send", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sesame" {
+			w.WriteHeader(401)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		if got.Message.Token == "gone" {
+			w.WriteHeader(404)
+			w.Write([]byte(`{"error":{"status":"NOT_FOUND","details":[{"errorCode":"UNREGISTERED"}]}}`))
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	account, _ := json.Marshal(serviceAccount{
+		ProjectID:   "gleepost",
+		ClientEmail: "push@gleepost.iam.gserviceaccount.com",
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		TokenURI:    server.URL + "/token",
+	})
+	path := filepath.Join(dir, "account.json")
+	ioutil.WriteFile(path, account, 0600)
+
+	p := New(conf.PusherConfig{FCM: conf.FCMConfig{ServiceAccount: path, Endpoint: server.URL}})
+	n := Notification{Alert: Alert{Body: "Hello"}, Badge: badge(2), Sound: "default", Data: map[string]interface{}{"post-id": 9}}
+	err := p.Push(gp.Device{Type: "android", ID: "xyz"}, n)
+	if err != nil {
+		t.Fatal("Error pushing:", err)
+	}
+	if got.Message.Token != "xyz" || got.Message.Data["post-id"] != "9" || got.Message.Data["badge"] != "2" || got.Message.Android.Notification == nil || got.Message.Android.Notification.Body != "Hello" {
+		t.Fatal("Unexpected message:", got)
+	}
+
+	err = p.Push(gp.Device{Type: "android", ID: "gone"}, n)
+	if !Unregistered(err) {
+		t.Fatal("Expected the device to be reported unregistered, got", err)
+	}
+	if tokens != 1 {
+		t.Fatal("Expected the access token to be reused, but fetched", tokens)
+	}
+}
+
+func TestSNS(t *testing.T) {
+	os.Setenv("AWS_ACCESS_KEY_ID", "test")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	var got snsMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("Action") != "Publish" || r.FormValue("TargetArn") != "arn:test" || r.FormValue("MessageStructure") != "json" {
+			w.WriteHeader(400)
+			return
+		}
+		json.Unmarshal([]byte(r.FormValue("Message")), &got)
+		w.Write([]byte(`<PublishResponse><PublishResult><MessageId>1</MessageId></PublishResult></PublishResponse>`))
+	}))
+	defer server.Close()
+
+	p := New(conf.PusherConfig{SNS: conf.SNSConfig{Endpoint: server.URL}})
+	n := Notification{Alert: Alert{Body: "Hello"}, Sound: "default"}
+	err := p.Push(gp.Device{Type: "ios", ID: "abc"}, n)
+	if err != NoEndpoint {
+		t.Fatalf("Expected %v, got %v", NoEndpoint, err)
+	}
+	err = p.Push(gp.Device{Type: "ios", ID: "abc", ARN: "arn:test"}, n)
+	if err != nil {
+		t.Fatal("Error pushing:", err)
+	}
+	if got.Default != "Hello" || !strings.Contains(got.APNS, `"body":"Hello"`) || !strings.Contains(got.GCM, `"body":"Hello"`) {
+		t.Fatal("Unexpected message:", got)
+	}
+	if err = p.Push(gp.Device{Type: "blackberry", ID: "abc", ARN: "arn:test"}, n); err != UnsupportedDevice || Temporary(err) {
+		t.Fatalf("Expected %v, got %v", UnsupportedDevice, err)
+	}
+}
+
+func TestTemporary(t *testing.T) {
+	tests := []struct {
+		err       error
+		temporary bool
+	}{
+		{&Error{Status: 503}, true},
+		{&Error{Status: 429}, true},
+		{&Error{Status: 400, Reason: "BadCollapseId"}, false},
+		{&Error{Status: 410, Unregistered: true}, false},
+		{NoEndpoint, false},
+		{errors.New("connection reset by peer"), true},
+	}
+	for _, test := range tests {
+		if Temporary(test.err) != test.temporary {
+			t.Errorf("Temporary(%v) should be %v", test.err, test.temporary)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package push
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/conf"
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+)
+
+//snsPusher pushes to a device through the SNS platform endpoint it was registered with (its ARN), which relays to APNs or GCM.
+type snsPusher struct {
+	svc *sns.SNS
+}
+
+func newSNS(config conf.SNSConfig) *snsPusher {
+	c := &aws.Config{Region: aws.String(config.SNSRegion())}
+	if config.Endpoint != "" {
+		c.Endpoint = aws.String(config.Endpoint)
+	}
+	return &snsPusher{svc: sns.New(session.New(), c)}
+}
+
+//snsMessage holds a payload for each platform; SNS sends whichever suits the endpoint.
+type snsMessage struct {
+	APNS        string `json:"APNS,omitempty"`
+	APNSSandbox string `json:"APNS_SANDBOX,omitempty"`
+	GCM         string `json:"GCM,omitempty"`
+	Default     string `json:"default"`
+}
+
+type gcmMessage struct {
+	CollapseKey  string            `json:"collapse_key,omitempty"`
+	Data         map[string]string `json:"data,omitempty"`
+	Notification interface{}       `json:"notification,omitempty"`
+}
+
+//Push publishes n to device's SNS endpoint.
+func (p *snsPusher) Push(device gp.Device, n Notification) (err error) {
+	if device.ARN == "" {
+		return NoEndpoint
+	}
+	ios, err := json.Marshal(apnsPayload(n))
+	if err != nil {
+		return
+	}
+	fcm := fcmPayload(device.ID, n).Message
+	gcm := gcmMessage{CollapseKey: n.CollapseKey, Data: fcm.Data}
+	if fcm.Android.Notification != nil {
+		gcm.Notification = fcm.Android.Notification
+	}
+	android, err := json.Marshal(gcm)
+	if err != nil {
+		return
+	}
+	msg := snsMessage{APNS: string(ios), APNSSandbox: string(ios), GCM: string(android), Default: n.Alert.Body}
+	if msg.Default == "" {
+		msg.Default = n.Alert.LocKey
+	}
+	m, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	params := &sns.PublishInput{
+		Message:          aws.String(string(m)),
+		MessageStructure: aws.String("json"),
+		TargetArn:        aws.String(device.ARN),
+	}
+	_, err = p.svc.Publish(params)
+	if rf, ok := err.(awserr.RequestFailure); ok {
+		//A disabled endpoint is one APNs or GCM has told SNS is no longer valid.
+		e := &Error{Service: "sns", Status: rf.StatusCode(), Reason: rf.Code(), Unregistered: rf.Code() == sns.ErrCodeEndpointDisabledException}
+		if e.Unregistered {
+			e.At = time.Now()
+		}
+		return e
+	}
+	return
+}
+
+//NeedsEndpoint is true: devices can only be pushed to through SNS once they have an endpoint.
+func (p *snsPusher) NeedsEndpoint(string) bool {
+	return true
+}
@@ -0,0 +1,172 @@
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/conf"
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/push"
+	"github.com/Petergatsby/GleepostAPI/lib/store"
+)
+
+const (
+	//pushLock is how long a worker may hold a push before another worker assumes it died and takes over.
+	pushLock = 5 * time.Minute
+	//maxBackoff caps how long a push waits between retries.
+	maxBackoff = time.Hour
+)
+
+//pushQueue is the outbound push queue. Pushes are stored (in push_queue) so that they survive a restart,
+//and sent by a pool of workers which retry transient failures with exponential backoff.
+//Pushes which fail permanently, or run out of retries, are moved to push_dead_letters.
+//The workers outlive any request, so the queue never uses a request's context.
+type pushQueue struct {
+	store   store.PushQueue
+	pushers map[string]push.Pusher
+	apps    []string
+	config  conf.PushQueueConfig
+	stats   *PrefixStatter
+	prune   func(ctx context.Context, deviceID string, at time.Time) error
+	wake    chan struct{}
+}
+
+func newPushQueue(st store.PushQueue, pushers map[string]push.Pusher, config conf.PushQueueConfig, stats *PrefixStatter, prune func(context.Context, string, time.Time) error) *pushQueue {
+	var apps []string
+	for app := range pushers {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+	return &pushQueue{store: st, pushers: pushers, apps: apps, config: config, stats: stats, prune: prune, wake: make(chan struct{}, 1)}
+}
+
+//enqueue stores n to be pushed to device by application's pusher. Pushes for an application with no pusher configured are dropped.
+func (q *pushQueue) enqueue(ctx context.Context, application string, device gp.Device, n push.Notification) (err error) {
+	if _, ok := q.pushers[application]; !ok {
+		return nil
+	}
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return
+	}
+	err = q.store.Enqueue(ctx, application, device, string(payload))
+	if err != nil {
+		return
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+//start launches the workers.
+func (q *pushQueue) start() {
+	for i := 0; i < q.config.WorkerCount(); i++ {
+		go q.work()
+	}
+}
+
+func (q *pushQueue) work() {
+	ctx := context.Background()
+	poll := time.NewTicker(q.config.PollInterval())
+	defer poll.Stop()
+	for {
+		job, err := q.claim(ctx)
+		switch {
+		case err == sql.ErrNoRows:
+			select {
+			case <-q.wake:
+			case <-poll.C:
+			}
+		case err != nil:
+			log.Println("Error claiming push:", err)
+			<-poll.C
+		default:
+			q.send(ctx, job)
+		}
+	}
+}
+
+//claim takes the push which has been waiting longest, locking it so no other worker (on this server or another) sends it too.
+//It only takes pushes for applications this server has a pusher for; any others are left for a server which does.
+func (q *pushQueue) claim(ctx context.Context) (job store.PushJob, err error) {
+	token, err := randomString()
+	if err != nil {
+		return
+	}
+	return q.store.Claim(ctx, token, pushLock, q.apps)
+}
+
+//send tries to deliver job, then deletes it, schedules a retry or dead-letters it depending on how that went.
+func (q *pushQueue) send(ctx context.Context, job store.PushJob) {
+	var n push.Notification
+	err := json.Unmarshal([]byte(job.Payload), &n)
+	if err == nil {
+		pusher, ok := q.pushers[job.Application]
+		if !ok {
+			err = errors.New("no pusher configured for " + job.Application)
+		} else {
+			err = pusher.Push(job.Device, n)
+		}
+	}
+	job.Attempts++
+	switch {
+	case err == nil:
+		go q.stats.Count(1, "gleepost.push.sent")
+		err = q.store.Remove(ctx, job.ID)
+	case push.Unregistered(err):
+		go q.stats.Count(1, "gleepost.push.pruned")
+		err = q.prune(ctx, job.Device.ID, err.(*push.Error).At)
+		if err != nil {
+			log.Println("Error pruning device:", err)
+		}
+		err = q.store.Remove(ctx, job.ID)
+	case push.Temporary(err) && job.Attempts < q.config.Attempts():
+		go q.stats.Count(1, "gleepost.push.retry")
+		err = q.store.Retry(ctx, job.ID, job.Attempts, pushBackoff(job.Attempts), truncateError(err))
+	default:
+		go q.stats.Count(1, "gleepost.push.dead")
+		log.Printf("Giving up on push to %s device %s after %d attempts: %v\n", job.Device.Type, job.Device.ID, job.Attempts, err)
+		err = q.store.DeadLetter(ctx, job, truncateError(err))
+	}
+	if err != nil {
+		log.Println("Error updating push queue:", err)
+	}
+}
+
+//pushBackoff is how long to wait before trying a push again, after it has failed attempts times.
+func pushBackoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	if attempts > 8 {
+		return maxBackoff
+	}
+	d := 30 * time.Second << uint(attempts-1)
+	if d > maxBackoff {
+		return maxBackoff
+	}
+	return d
+}
+
+func truncateError(err error) string {
+	e := err.Error()
+	if len(e) > 255 {
+		return e[:255]
+	}
+	return e
+}
+
+//PushFailures lists the most recent pushes which were given up on (optionally only those to forUser's devices). Only global admins may see them.
+func (api *API) PushFailures(ctx context.Context, userID, forUser gp.UserID, limit int) ([]gp.PushFailure, error) {
+	if !api.isAdmin(ctx, userID) {
+		return nil, ENOTALLOWED
+	}
+	return api.store.PushQueue.DeadLetters(ctx, forUser, limit)
+}
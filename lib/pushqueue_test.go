@@ -0,0 +1,234 @@
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/conf"
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/push"
+	"github.com/Petergatsby/GleepostAPI/lib/store"
+)
+
+//scriptedPusher fails with each of errs in turn, then succeeds.
+type scriptedPusher struct {
+	mu     sync.Mutex
+	errs   []error
+	pushed int
+}
+
+func (p *scriptedPusher) Push(gp.Device, push.Notification) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pushed++
+	if len(p.errs) == 0 {
+		return nil
+	}
+	err := p.errs[0]
+	p.errs = p.errs[1:]
+	return err
+}
+
+func (p *scriptedPusher) NeedsEndpoint(string) bool { return false }
+
+type pruned struct {
+	device string
+	at     time.Time
+}
+
+func testPushQueue(pusher push.Pusher) (*pushQueue, *store.Memory, *[]pruned) {
+	m := store.NewMemory()
+	var prunes []pruned
+	prune := func(ctx context.Context, device string, at time.Time) error {
+		prunes = append(prunes, pruned{device, at})
+		return nil
+	}
+	q := newPushQueue(m.Store().PushQueue, map[string]push.Pusher{"gleepost": pusher}, conf.PushQueueConfig{MaxAttempts: 3}, &PrefixStatter{}, prune)
+	return q, m, &prunes
+}
+
+func enqueueTestPush(t *testing.T, q *pushQueue, deviceID string) {
+	err := q.enqueue(context.Background(), "gleepost", gp.Device{User: 1, Type: "ios", ID: deviceID}, push.Notification{})
+	if err != nil {
+		t.Fatal("Error enqueueing push:", err)
+	}
+}
+
+func TestPushQueueConcurrentClaims(t *testing.T) {
+	q, _, _ := testPushQueue(&scriptedPusher{})
+	for i := 0; i < 20; i++ {
+		enqueueTestPush(t, q, "device")
+	}
+	var mu sync.Mutex
+	claimed := make(map[uint64]int)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, err := q.claim(context.Background())
+				if err != nil {
+					if err != sql.ErrNoRows {
+						t.Error("Error claiming push:", err)
+					}
+					return
+				}
+				mu.Lock()
+				claimed[job.ID]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(claimed) != 20 {
+		t.Fatalf("Expected all 20 pushes to be claimed, got %d", len(claimed))
+	}
+	for id, n := range claimed {
+		if n != 1 {
+			t.Fatalf("Push %d was claimed %d times", id, n)
+		}
+	}
+}
+
+func TestPushQueueLeaseExpiry(t *testing.T) {
+	q, _, _ := testPushQueue(&scriptedPusher{})
+	enqueueTestPush(t, q, "device")
+	ctx := context.Background()
+	first, err := q.store.Claim(ctx, "worker-1", 20*time.Millisecond, q.apps)
+	if err != nil {
+		t.Fatal("Error claiming push:", err)
+	}
+	if _, err = q.store.Claim(ctx, "worker-2", time.Minute, q.apps); err != sql.ErrNoRows {
+		t.Fatal("A leased push shouldn't be claimable, got", err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	second, err := q.store.Claim(ctx, "worker-2", time.Minute, q.apps)
+	if err != nil || second.ID != first.ID {
+		t.Fatalf("Expected push %d to be taken over once its lease ran out, got %d (%v)", first.ID, second.ID, err)
+	}
+}
+
+func TestPushQueueSent(t *testing.T) {
+	pusher := &scriptedPusher{}
+	q, m, _ := testPushQueue(pusher)
+	enqueueTestPush(t, q, "device")
+	job, err := q.claim(context.Background())
+	if err != nil {
+		t.Fatal("Error claiming push:", err)
+	}
+	q.send(context.Background(), job)
+	if pusher.pushed != 1 || len(m.QueuedPushes()) != 0 || len(m.DeadPushes()) != 0 {
+		t.Fatalf("Expected the push to be sent and removed, got %d pushed, %v queued, %v dead", pusher.pushed, m.QueuedPushes(), m.DeadPushes())
+	}
+}
+
+func TestPushQueueRetry(t *testing.T) {
+	q, m, _ := testPushQueue(&scriptedPusher{errs: []error{&push.Error{Service: "APNs", Status: 503, Reason: "ServiceUnavailable"}}})
+	enqueueTestPush(t, q, "device")
+	job, err := q.claim(context.Background())
+	if err != nil {
+		t.Fatal("Error claiming push:", err)
+	}
+	before := time.Now()
+	q.send(context.Background(), job)
+	queued := m.QueuedPushes()
+	if len(queued) != 1 {
+		t.Fatal("Expected the push to stay queued, got", queued)
+	}
+	retry := queued[0]
+	if retry.Attempts != 1 || retry.LastError != "APNs: 503 ServiceUnavailable" {
+		t.Fatalf("Expected 1 failed attempt, got %d (%q)", retry.Attempts, retry.LastError)
+	}
+	if wait := retry.NextAttempt.Sub(before); wait < pushBackoff(1) || wait > pushBackoff(1)+time.Second {
+		t.Fatal("Expected the retry to back off for", pushBackoff(1), "got", wait)
+	}
+	if _, err = q.claim(context.Background()); err != sql.ErrNoRows {
+		t.Fatal("A push which is backing off shouldn't be claimable, got", err)
+	}
+}
+
+func TestPushQueueDeadLetter(t *testing.T) {
+	temporary := &push.Error{Service: "FCM", Status: 500, Reason: "InternalServerError"}
+	q, m, _ := testPushQueue(&scriptedPusher{errs: []error{temporary, temporary, temporary}})
+	enqueueTestPush(t, q, "device")
+	ctx := context.Background()
+	for attempt := 1; attempt <= 3; attempt++ {
+		job, err := q.store.Claim(ctx, "worker", time.Minute, q.apps)
+		if err != nil {
+			t.Fatalf("Attempt %d: error claiming push: %v", attempt, err)
+		}
+		q.send(context.Background(), job)
+		if attempt < 3 {
+			//Skip the backoff.
+			err = q.store.Retry(ctx, job.ID, attempt, 0, "")
+			if err != nil {
+				t.Fatal("Error rescheduling push:", err)
+			}
+		}
+	}
+	dead := m.DeadPushes()
+	if len(dead) != 1 || dead[0].Attempts != 3 || dead[0].Error != temporary.Error() {
+		t.Fatal("Expected the push to be dead-lettered after 3 attempts, got", dead)
+	}
+	if queued := m.QueuedPushes(); len(queued) != 0 {
+		t.Fatal("Expected the queue to be empty, got", queued)
+	}
+	failures, err := q.store.DeadLetters(ctx, 1, 10)
+	if err != nil || len(failures) != 1 || failures[0].Error != temporary.Error() {
+		t.Fatalf("Expected the dead letter to be listed, got %v (%v)", failures, err)
+	}
+	if failures, _ = q.store.DeadLetters(ctx, 2, 10); len(failures) != 0 {
+		t.Fatal("Expected no dead letters for another user, got", failures)
+	}
+}
+
+func TestPushQueuePermanentFailure(t *testing.T) {
+	q, m, _ := testPushQueue(&scriptedPusher{errs: []error{push.UnsupportedDevice}})
+	enqueueTestPush(t, q, "device")
+	job, err := q.claim(context.Background())
+	if err != nil {
+		t.Fatal("Error claiming push:", err)
+	}
+	q.send(context.Background(), job)
+	dead := m.DeadPushes()
+	if len(dead) != 1 || dead[0].Attempts != 1 {
+		t.Fatal("Expected a permanent failure to be dead-lettered straight away, got", dead)
+	}
+}
+
+func TestPushQueuePrune(t *testing.T) {
+	at := time.Date(2016, 10, 17, 12, 0, 0, 0, time.UTC)
+	q, m, prunes := testPushQueue(&scriptedPusher{errs: []error{&push.Error{Service: "APNs", Status: 410, Reason: "Unregistered", Unregistered: true, At: at}}})
+	enqueueTestPush(t, q, "stale-device")
+	job, err := q.claim(context.Background())
+	if err != nil {
+		t.Fatal("Error claiming push:", err)
+	}
+	q.send(context.Background(), job)
+	if len(*prunes) != 1 || (*prunes)[0] != (pruned{"stale-device", at}) {
+		t.Fatal("Expected the device to be pruned, got", *prunes)
+	}
+	if len(m.QueuedPushes()) != 0 || len(m.DeadPushes()) != 0 {
+		t.Fatal("An unregistered device's push should just be dropped")
+	}
+}
+
+func TestPushQueueUnknownApplication(t *testing.T) {
+	q, m, _ := testPushQueue(&scriptedPusher{})
+	err := q.enqueue(context.Background(), "nonexistent", gp.Device{User: 1, Type: "ios", ID: "device"}, push.Notification{})
+	if err != nil || len(m.QueuedPushes()) != 0 {
+		t.Fatal("Pushes for an application with no pusher should be dropped, got", m.QueuedPushes(), err)
+	}
+	//Another server might have a pusher for it, though.
+	err = m.Store().PushQueue.Enqueue(context.Background(), "approve", gp.Device{User: 1, Type: "ios", ID: "device"}, "{}")
+	if err != nil {
+		t.Fatal("Error enqueueing push:", err)
+	}
+	if _, err = q.claim(context.Background()); err != sql.ErrNoRows {
+		t.Fatal("Pushes for an application with no pusher here should be left for another server, got", err)
+	}
+}
@@ -0,0 +1,257 @@
+//Package realtime keeps track of the realtime (websocket, event stream and long-poll) connections this server holds.
+package realtime
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/conf"
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+var (
+	//TooManyConnections means this user already holds as many connections as they're allowed.
+	TooManyConnections = gp.APIerror{Reason: "Too many connections"}
+	//ServerFull means this server already holds as many connections as it's allowed.
+	ServerFull = gp.APIerror{Reason: "Server is at capacity"}
+	//ShuttingDown means this server is draining its connections and won't take new ones.
+	ShuttingDown = gp.APIerror{Reason: "Server is shutting down"}
+)
+
+//Why a connection was closed by the server.
+const (
+	ReasonSlow     = "slow"
+	ReasonDraining = "draining"
+)
+
+//Conn is one client's realtime connection. Events for it are queued with Pump and sent from Send;
+//if the client falls too far behind, or the server is shutting down, Done fires and the connection should be closed.
+type Conn struct {
+	id        uint64
+	user      gp.UserID
+	transport string
+	addr      string
+	opened    time.Time
+	send      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+	mu        sync.Mutex
+	channels  map[string]bool
+	reason    string
+}
+
+//Send delivers this connection's queued events. It's closed once the events it's pumping from are.
+func (c *Conn) Send() <-chan []byte {
+	return c.send
+}
+
+//Done fires when the server wants this connection closed; Reason says why.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+//Reason is why Done fired: ReasonSlow or ReasonDraining.
+func (c *Conn) Reason() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reason
+}
+
+//User is who this connection belongs to.
+func (c *Conn) User() gp.UserID {
+	return c.user
+}
+
+//Pump queues events for this connection until events is closed, then closes Send.
+//If the queue is full the client isn't keeping up, so it's disconnected rather than being allowed to hold events (and redis) up for everyone else.
+func (c *Conn) Pump(events <-chan []byte) {
+	for message := range events {
+		select {
+		case c.send <- message:
+		default:
+			c.close(ReasonSlow)
+		}
+	}
+	close(c.send)
+}
+
+func (c *Conn) close(reason string) {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.reason = reason
+		c.mu.Unlock()
+		close(c.done)
+	})
+}
+
+//Subscribed records that this connection is now (or, if on is false, no longer) subscribed to channels.
+func (c *Conn) Subscribed(channels []string, on bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, channel := range channels {
+		if on {
+			c.channels[channel] = true
+		} else {
+			delete(c.channels, channel)
+		}
+	}
+}
+
+//IsSubscribed reports whether this connection is subscribed to channel.
+func (c *Conn) IsSubscribed(channel string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.channels[channel]
+}
+
+//Info describes this connection.
+func (c *Conn) Info() gp.Connection {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info := gp.Connection{ID: c.id, Transport: c.transport, Addr: c.addr, Opened: c.opened, Channels: make([]string, 0, len(c.channels)), Queued: len(c.send)}
+	for channel := range c.channels {
+		info.Channels = append(info.Channels, channel)
+	}
+	sort.Strings(info.Channels)
+	return info
+}
+
+//Registry is every realtime connection this server holds, enforcing per-user and overall limits.
+type Registry struct {
+	config   conf.RealtimeConfig
+	mu       sync.Mutex
+	nextID   uint64
+	conns    map[uint64]*Conn
+	byUser   map[gp.UserID]map[uint64]*Conn
+	draining bool
+	empty    *sync.Cond
+}
+
+//NewRegistry creates an empty Registry.
+func NewRegistry(config conf.RealtimeConfig) *Registry {
+	r := &Registry{config: config, conns: make(map[uint64]*Conn), byUser: make(map[gp.UserID]map[uint64]*Conn)}
+	r.empty = sync.NewCond(&r.mu)
+	return r
+}
+
+//Register records a new connection for user, or returns TooManyConnections, ServerFull or ShuttingDown if it can't have one.
+//Every connection registered must be Unregistered when it closes.
+func (r *Registry) Register(user gp.UserID, transport, addr string) (c *Conn, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case r.draining:
+		return nil, ShuttingDown
+	case len(r.conns) >= r.config.Max():
+		return nil, ServerFull
+	case len(r.byUser[user]) >= r.config.PerUser():
+		return nil, TooManyConnections
+	}
+	r.nextID++
+	c = &Conn{
+		id:        r.nextID,
+		user:      user,
+		transport: transport,
+		addr:      addr,
+		opened:    time.Now().UTC(),
+		send:      make(chan []byte, r.config.Buffer()),
+		done:      make(chan struct{}),
+		channels:  make(map[string]bool),
+	}
+	r.conns[c.id] = c
+	if r.byUser[user] == nil {
+		r.byUser[user] = make(map[uint64]*Conn)
+	}
+	r.byUser[user][c.id] = c
+	return c, nil
+}
+
+//Unregister forgets a closed connection.
+func (r *Registry) Unregister(c *Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.conns, c.id)
+	delete(r.byUser[c.user], c.id)
+	if len(r.byUser[c.user]) == 0 {
+		delete(r.byUser, c.user)
+	}
+	if len(r.conns) == 0 {
+		r.empty.Broadcast()
+	}
+}
+
+//Count returns how many connections are open.
+func (r *Registry) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.conns)
+}
+
+//Connections lists the live connections of each user, or just of user if it isn't 0.
+func (r *Registry) Connections(user gp.UserID) (users []gp.UserConnections) {
+	r.mu.Lock()
+	var ids []gp.UserID
+	for u := range r.byUser {
+		if user == 0 || u == user {
+			ids = append(ids, u)
+		}
+	}
+	conns := make(map[gp.UserID][]*Conn)
+	for _, u := range ids {
+		for _, c := range r.byUser[u] {
+			conns[u] = append(conns[u], c)
+		}
+	}
+	r.mu.Unlock()
+
+	sort.Sort(userIDs(ids))
+	users = make([]gp.UserConnections, 0, len(ids))
+	for _, u := range ids {
+		uc := gp.UserConnections{User: u}
+		for _, c := range conns[u] {
+			uc.Connections = append(uc.Connections, c.Info())
+		}
+		sort.Sort(byID(uc.Connections))
+		users = append(users, uc)
+	}
+	return
+}
+
+//Drain stops new connections, asks every open one to close, and waits (for at most timeout) until they have.
+//It returns how many were still open when it gave up.
+func (r *Registry) Drain(timeout time.Duration) (remaining int) {
+	r.mu.Lock()
+	r.draining = true
+	for _, c := range r.conns {
+		c.close(ReasonDraining)
+	}
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.mu.Lock()
+		for len(r.conns) > 0 {
+			r.empty.Wait()
+		}
+		r.mu.Unlock()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+	return r.Count()
+}
+
+type userIDs []gp.UserID
+
+func (u userIDs) Len() int           { return len(u) }
+func (u userIDs) Less(i, j int) bool { return u[i] < u[j] }
+func (u userIDs) Swap(i, j int)      { u[i], u[j] = u[j], u[i] }
+
+type byID []gp.Connection
+
+func (c byID) Len() int           { return len(c) }
+func (c byID) Less(i, j int) bool { return c[i].ID < c[j].ID }
+func (c byID) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
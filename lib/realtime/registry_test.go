@@ -0,0 +1,76 @@
+package realtime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/conf"
+)
+
+func TestLimits(t *testing.T) {
+	r := NewRegistry(conf.RealtimeConfig{MaxPerUser: 2, MaxConnections: 3})
+	a, err := r.Register(1, "websocket", "")
+	if err != nil {
+		t.Fatalf("Error registering: %v", err)
+	}
+	if _, err = r.Register(1, "websocket", ""); err != nil {
+		t.Fatalf("Error registering: %v", err)
+	}
+	if _, err = r.Register(1, "sse", ""); err != TooManyConnections {
+		t.Fatalf("Expected %v, got %v", TooManyConnections, err)
+	}
+	if _, err = r.Register(2, "websocket", ""); err != nil {
+		t.Fatalf("Error registering: %v", err)
+	}
+	if _, err = r.Register(3, "websocket", ""); err != ServerFull {
+		t.Fatalf("Expected %v, got %v", ServerFull, err)
+	}
+	r.Unregister(a)
+	if _, err = r.Register(3, "websocket", ""); err != nil {
+		t.Fatalf("Closing a connection should free up space: %v", err)
+	}
+	users := r.Connections(0)
+	if len(users) != 3 || users[0].User != 1 || len(users[0].Connections) != 1 {
+		t.Fatalf("Unexpected connections: %v", users)
+	}
+}
+
+func TestSlowConsumer(t *testing.T) {
+	r := NewRegistry(conf.RealtimeConfig{SendBuffer: 2})
+	c, err := r.Register(1, "websocket", "")
+	if err != nil {
+		t.Fatalf("Error registering: %v", err)
+	}
+	events := make(chan []byte)
+	go c.Pump(events)
+	for i := 0; i < 3; i++ {
+		events <- []byte("{}")
+	}
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("A client which doesn't read should be dropped")
+	}
+	if c.Reason() != ReasonSlow {
+		t.Fatalf("Expected %s, got %s", ReasonSlow, c.Reason())
+	}
+	close(events)
+}
+
+func TestDrain(t *testing.T) {
+	r := NewRegistry(conf.RealtimeConfig{})
+	c, err := r.Register(1, "websocket", "")
+	if err != nil {
+		t.Fatalf("Error registering: %v", err)
+	}
+	go func() {
+		<-c.Done()
+		r.Unregister(c)
+	}()
+	if remaining := r.Drain(time.Second); remaining != 0 {
+		t.Fatalf("Expected every connection to close, %d still open", remaining)
+	}
+	if _, err = r.Register(2, "websocket", ""); err != ShuttingDown {
+		t.Fatalf("Expected %v, got %v", ShuttingDown, err)
+	}
+}
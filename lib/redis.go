@@ -0,0 +1,32 @@
+package lib
+
+import (
+	"context"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+//redisConn gets a connection from pool for a request, which won't run any more commands once ctx is done.
+//Our redigo can't interrupt a command which has already been sent, but those are quick; it's the queue of them behind a cancelled request we want to skip.
+func redisConn(ctx context.Context, pool *redis.Pool) redis.Conn {
+	return ctxConn{Conn: pool.Get(), ctx: ctx}
+}
+
+type ctxConn struct {
+	redis.Conn
+	ctx context.Context
+}
+
+func (c ctxConn) Do(command string, args ...interface{}) (reply interface{}, err error) {
+	if err = c.ctx.Err(); err != nil {
+		return
+	}
+	return c.Conn.Do(command, args...)
+}
+
+func (c ctxConn) Send(command string, args ...interface{}) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	return c.Conn.Send(command, args...)
+}
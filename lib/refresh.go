@@ -0,0 +1,111 @@
+package lib
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+var (
+	//BadRefreshToken means the refresh token doesn't exist, has expired or its session has been logged out.
+	BadRefreshToken = gp.APIerror{Reason: "Invalid refresh token"}
+	//RefreshTokenReused means this refresh token has already been swapped once, so it's probably been stolen; its whole session has been logged out.
+	RefreshTokenReused = gp.APIerror{Reason: "Refresh token already used; please log in again"}
+)
+
+//RefreshToken swaps a refresh token for a new access token and a new refresh token.
+func (api *API) RefreshToken(ctx context.Context, refresh string) (token gp.Token, err error) {
+	token, err = api.Auth.refresh(ctx, refresh)
+	if err == RefreshTokenReused {
+		go api.Statsd.Count(1, "gleepost.auth.refresh.reused")
+	}
+	return
+}
+
+//issueRefreshToken creates a single-use refresh token for this session.
+func (auth *Authenticator) issueRefreshToken(ctx context.Context, userID gp.UserID, session gp.SessionID) (refresh string, err error) {
+	refresh, err = randomString()
+	if err != nil {
+		return
+	}
+	expiry := time.Now().Add(auth.config.RefreshTTL()).UTC().Round(time.Second)
+	err = auth.tokens.AddRefreshToken(ctx, refresh, userID, session, expiry)
+	return
+}
+
+//refresh rotates the access token of the session this refresh token belongs to.
+//Each refresh token only works once: presenting one a second time means someone else has a copy, so the whole session (every token descended from the same login) is revoked.
+func (auth *Authenticator) refresh(ctx context.Context, refresh string) (token gp.Token, err error) {
+	record, err := auth.tokens.RefreshToken(ctx, refresh)
+	if err == sql.ErrNoRows {
+		return token, BadRefreshToken
+	}
+	if err != nil {
+		return
+	}
+	userID, session := record.UserID, record.Session
+	if record.Used {
+		return token, auth.revokeReused(ctx, userID, session)
+	}
+	if !record.Expiry.After(time.Now()) {
+		return token, BadRefreshToken
+	}
+	swapped, err := auth.tokens.UseRefreshToken(ctx, refresh)
+	if err != nil {
+		return
+	}
+	if !swapped {
+		//Someone else swapped it between our lookup and now.
+		return token, auth.revokeReused(ctx, userID, session)
+	}
+
+	old, scopes, err := auth.tokens.Session(ctx, userID, session)
+	if err == sql.ErrNoRows {
+		return token, BadRefreshToken
+	}
+	if err != nil {
+		return
+	}
+	token = createToken(userID, auth.config.AccessTTL())
+	token.Scopes, err = ParseScopes(scopes)
+	if err != nil {
+		return
+	}
+	err = auth.tokens.ReplaceToken(ctx, userID, session, token.Token, token.Expiry)
+	if err != nil {
+		return
+	}
+	auth.evictToken(userID, old)
+	go auth.cacheToken(token)
+	token.RefreshToken, err = auth.issueRefreshToken(ctx, userID, session)
+	return
+}
+
+//revokeReused logs out the session a reused refresh token belongs to, and returns RefreshTokenReused.
+func (auth *Authenticator) revokeReused(ctx context.Context, userID gp.UserID, session gp.SessionID) error {
+	err := auth.revokeSession(ctx, userID, session)
+	if err != nil && err != NoSuchSession {
+		return err
+	}
+	return RefreshTokenReused
+}
+
+//evictToken removes this token from the cache, and leaves a tombstone so that a validation which is still in flight can't cache it again.
+//The tombstone only has to outlive those, but it's kept for an access token's lifetime to be safe.
+//The token has already gone from the db by now, so this has to happen even if the client has given up: it doesn't take the request's context.
+func (auth *Authenticator) evictToken(userID gp.UserID, token string) {
+	conn := auth.pool.Get()
+	defer conn.Close()
+	key := fmt.Sprintf("users:%d:token:%s", userID, token)
+	conn.Send("MULTI")
+	conn.Send("SET", key+":revoked", 1, "EX", int(auth.config.AccessTTL()/time.Second))
+	conn.Send("DEL", key, key+":used")
+	_, err := conn.Do("EXEC")
+	if err != nil {
+		log.Println("Error evicting token:", err)
+	}
+}
@@ -0,0 +1,173 @@
+//Package replica sends read-only queries to MySQL read replicas. It falls back to the primary when no replica is healthy, and for users who have just written something, so that they see their own changes despite replication lag.
+package replica
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/psc"
+)
+
+//Preparer prepares statements; psc.StatementCache is one.
+type Preparer interface {
+	Prepare(query string) (*sql.Stmt, error)
+}
+
+//Writes remembers who has written recently.
+type Writes interface {
+	//Wrote records that user has just written something.
+	Wrote(ctx context.Context, user gp.UserID)
+	//WroteRecently is true if user might not see their last write on a replica yet.
+	WroteRecently(ctx context.Context, user gp.UserID) bool
+}
+
+//Statter receives the set's read, fallback and failover counts. lib's PrefixStatter is one.
+type Statter interface {
+	Count(count int, bucket string)
+}
+
+//member is one replica, with a statement cache of its own.
+type member struct {
+	name    string
+	db      *sql.DB
+	sc      *psc.StatementCache
+	healthy int32 //Accessed atomically; 1 if the last check succeeded.
+}
+
+func (m *member) isHealthy() bool {
+	return atomic.LoadInt32(&m.healthy) == 1
+}
+
+//setHealthy records whether m is up, returning true if that's a change.
+func (m *member) setHealthy(healthy bool) bool {
+	var v int32
+	if healthy {
+		v = 1
+	}
+	return atomic.SwapInt32(&m.healthy, v) != v
+}
+
+//Set is a primary and any number of replicas. Add all the replicas before using it.
+type Set struct {
+	primary   Preparer
+	writes    Writes
+	members   []*member
+	next      uint32
+	stats     Statter
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+//New creates a Set which has no replicas yet, so everything goes to primary.
+func New(primary Preparer, writes Writes) *Set {
+	return &Set{primary: primary, writes: writes, stop: make(chan struct{})}
+}
+
+//Add adds a replica, which keeps up to size prepared statements. It's assumed healthy until a check says otherwise.
+func (s *Set) Add(name string, db *sql.DB, size int) {
+	s.members = append(s.members, &member{name: name, db: db, sc: psc.NewCache(db, size), healthy: 1})
+}
+
+//SetStatter starts sending the set's stats to stats.
+func (s *Set) SetStatter(stats Statter) {
+	s.stats = stats
+}
+
+func (s *Set) count(bucket string) {
+	if s.stats != nil {
+		s.stats.Count(1, bucket)
+	}
+}
+
+//Prepare prepares a read-only query on the next healthy replica, or on the primary if there isn't one.
+func (s *Set) Prepare(query string) (stmt *sql.Stmt, err error) {
+	for range s.members {
+		m := s.members[int(atomic.AddUint32(&s.next, 1))%len(s.members)]
+		if !m.isHealthy() {
+			continue
+		}
+		stmt, err = m.sc.Prepare(query)
+		if err == nil {
+			s.count("gleepost.replica.read")
+			return
+		}
+		//Most likely the replica's gone away; the health check will bring it back.
+		s.down(m, err)
+	}
+	if len(s.members) > 0 {
+		s.count("gleepost.replica.fallback")
+	}
+	return s.primary.Prepare(query)
+}
+
+//PrepareFor is Prepare for a query made on user's behalf. If they have written recently it uses the primary, so that they're sure to see what they wrote.
+func (s *Set) PrepareFor(ctx context.Context, user gp.UserID, query string) (*sql.Stmt, error) {
+	if len(s.members) > 0 && s.writes.WroteRecently(ctx, user) {
+		s.count("gleepost.replica.read_your_writes")
+		return s.primary.Prepare(query)
+	}
+	return s.Prepare(query)
+}
+
+//Wrote records that user has just written, so their reads go to the primary for a while.
+func (s *Set) Wrote(ctx context.Context, user gp.UserID) {
+	if len(s.members) > 0 {
+		s.writes.Wrote(ctx, user)
+	}
+}
+
+func (s *Set) down(m *member, err error) {
+	if m.setHealthy(false) {
+		log.Printf("Replica %s is down, failing over: %v\n", m.name, err)
+		s.count("gleepost.replica.down")
+	}
+}
+
+//check pings every replica, taking those which don't answer within timeout out of rotation and putting back those which do.
+func (s *Set) check(timeout time.Duration) {
+	for _, m := range s.members {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := m.db.PingContext(ctx)
+		cancel()
+		switch {
+		case err != nil:
+			s.down(m, err)
+		case m.setHealthy(true):
+			log.Printf("Replica %s is back up\n", m.name)
+			s.count("gleepost.replica.up")
+		}
+	}
+}
+
+//HealthCheck checks the replicas every interval, until the set is closed.
+func (s *Set) HealthCheck(interval time.Duration) {
+	if len(s.members) == 0 {
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			s.check(interval)
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+//Close stops the health check and closes every replica. The primary is left alone.
+func (s *Set) Close() {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		for _, m := range s.members {
+			m.sc.Close()
+			m.db.Close()
+		}
+	})
+}
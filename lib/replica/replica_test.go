@@ -0,0 +1,185 @@
+package replica
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+//fakeDriver is a database/sql driver for a replica which can be switched off, and which counts what's prepared on it.
+type fakeDriver struct {
+	down     int32
+	prepared int64
+}
+
+var errDown = errors.New("connection refused")
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	if atomic.LoadInt32(&d.down) == 1 {
+		return nil, errDown
+	}
+	return fakeConn{d}, nil
+}
+
+type fakeConn struct {
+	d *fakeDriver
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	if atomic.LoadInt32(&c.d.down) == 1 {
+		return nil, driver.ErrBadConn
+	}
+	atomic.AddInt64(&c.d.prepared, 1)
+	return fakeStmt{}, nil
+}
+
+func (c fakeConn) Ping(ctx context.Context) error {
+	if atomic.LoadInt32(&c.d.down) == 1 {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func (c fakeConn) Close() error { return nil }
+
+func (c fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("no transactions") }
+
+type fakeStmt struct{}
+
+func (s fakeStmt) Close() error { return nil }
+
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("no rows")
+}
+
+var drivers int64
+
+func fakeDB(t *testing.T) (*sql.DB, *fakeDriver) {
+	d := &fakeDriver{}
+	name := fmt.Sprintf("replica-fake-%d", atomic.AddInt64(&drivers, 1))
+	sql.Register(name, d)
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, d
+}
+
+//fakePrimary is a primary which counts what's prepared on it.
+type fakePrimary struct {
+	db       *sql.DB
+	prepared int64
+}
+
+func (p *fakePrimary) Prepare(query string) (*sql.Stmt, error) {
+	atomic.AddInt64(&p.prepared, 1)
+	return p.db.Prepare(query)
+}
+
+//fakeWrites remembers writes forever.
+type fakeWrites struct {
+	mu    sync.Mutex
+	wrote map[gp.UserID]bool
+}
+
+func (w *fakeWrites) Wrote(ctx context.Context, user gp.UserID) {
+	w.mu.Lock()
+	w.wrote[user] = true
+	w.mu.Unlock()
+}
+
+func (w *fakeWrites) WroteRecently(ctx context.Context, user gp.UserID) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.wrote[user]
+}
+
+func testSet(t *testing.T) (*Set, *fakePrimary, *fakeDriver, *fakeDriver) {
+	primaryDB, _ := fakeDB(t)
+	primary := &fakePrimary{db: primaryDB}
+	s := New(primary, &fakeWrites{wrote: make(map[gp.UserID]bool)})
+	a, da := fakeDB(t)
+	b, db := fakeDB(t)
+	s.Add("a", a, 10)
+	s.Add("b", b, 10)
+	return s, primary, da, db
+}
+
+func TestRoundRobin(t *testing.T) {
+	s, primary, a, b := testSet(t)
+	defer s.Close()
+	for i := 0; i < 4; i++ {
+		if _, err := s.Prepare(fmt.Sprintf("SELECT %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a.prepared != 2 || b.prepared != 2 || primary.prepared != 0 {
+		t.Fatalf("Expected 2 queries on each replica, got %d and %d (and %d on the primary)", a.prepared, b.prepared, primary.prepared)
+	}
+}
+
+func TestReadYourWrites(t *testing.T) {
+	s, primary, _, _ := testSet(t)
+	defer s.Close()
+	s.Wrote(context.Background(), 9)
+	s.PrepareFor(context.Background(), 9, "SELECT 1")
+	s.PrepareFor(context.Background(), 10, "SELECT 1")
+	if primary.prepared != 1 {
+		t.Fatalf("Expected only the user who wrote to read from the primary, got %d reads", primary.prepared)
+	}
+}
+
+func TestFailover(t *testing.T) {
+	s, primary, a, b := testSet(t)
+	defer s.Close()
+	atomic.StoreInt32(&a.down, 1)
+	atomic.StoreInt32(&b.down, 1)
+	if _, err := s.Prepare("SELECT 1"); err != nil {
+		t.Fatalf("Expected to fall back to the primary, got %v", err)
+	}
+	if primary.prepared != 1 {
+		t.Fatal("Expected the primary to be used with every replica down")
+	}
+	s.check(time.Second)
+	for _, m := range s.members {
+		if m.isHealthy() {
+			t.Fatalf("Expected %s to be down", m.name)
+		}
+	}
+	atomic.StoreInt32(&b.down, 0)
+	s.check(time.Second)
+	for i := 0; i < 3; i++ {
+		s.Prepare(fmt.Sprintf("SELECT %d", i))
+	}
+	if primary.prepared != 1 || b.prepared != 3 {
+		t.Fatalf("Expected every read to go to b once it's back, got %d on b and %d on the primary", b.prepared, primary.prepared)
+	}
+}
+
+func TestNoReplicas(t *testing.T) {
+	primaryDB, _ := fakeDB(t)
+	primary := &fakePrimary{db: primaryDB}
+	s := New(primary, nil)
+	s.Wrote(context.Background(), 9)
+	s.PrepareFor(context.Background(), 9, "SELECT 1")
+	s.Prepare("SELECT 2")
+	if primary.prepared != 2 {
+		t.Fatalf("Expected everything on the primary, got %d", primary.prepared)
+	}
+	s.HealthCheck(time.Millisecond)
+	s.Close()
+}
@@ -0,0 +1,43 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/garyburd/redigo/redis"
+)
+
+//recentWrites remembers who has written within window. It's kept in redis so that every API server agrees.
+type recentWrites struct {
+	pool   *redis.Pool
+	window time.Duration
+}
+
+func (w recentWrites) key(user gp.UserID) string {
+	return fmt.Sprintf("users:%d:wrote", user)
+}
+
+func (w recentWrites) Wrote(ctx context.Context, user gp.UserID) {
+	conn := redisConn(ctx, w.pool)
+	defer conn.Close()
+	_, err := conn.Do("SET", w.key(user), 1, "EX", int(w.window/time.Second))
+	if err != nil {
+		log.Println("Error recording write:", err)
+	}
+}
+
+//WroteRecently errs on the side of the primary if redis can't say.
+func (w recentWrites) WroteRecently(ctx context.Context, user gp.UserID) bool {
+	conn := redisConn(ctx, w.pool)
+	defer conn.Close()
+	wrote, err := redis.Bool(conn.Do("EXISTS", w.key(user)))
+	return wrote || err != nil
+}
+
+//UserWrote records that userID is changing something, so that their reads go to the primary database until the replicas have caught up.
+func (api *API) UserWrote(ctx context.Context, userID gp.UserID) {
+	api.replicas.Wrote(ctx, userID)
+}
@@ -1,18 +1,19 @@
 package lib
 
 import (
+	"context"
 	"log"
 
 	"github.com/Petergatsby/GleepostAPI/lib/gp"
 )
 
 //ReportPost records that this user reported this post, with this (optional) reason.
-func (api *API) ReportPost(user gp.UserID, post gp.PostID, reason string) error {
-	p, err := api.getPostFull(user, post)
+func (api *API) ReportPost(ctx context.Context, user gp.UserID, post gp.PostID, reason string) error {
+	p, err := api.getPostFull(ctx, user, post)
 	if err != nil {
 		return err
 	}
-	in, err := api.UserInNetwork(user, p.Network)
+	in, err := api.UserInNetwork(ctx, user, p.Network)
 	switch {
 	case err != nil:
 		return err
@@ -20,16 +21,16 @@ func (api *API) ReportPost(user gp.UserID, post gp.PostID, reason string) error
 		log.Printf("User %d not in %d\n", user, p.Network)
 		return &ENOTALLOWED
 	default:
-		return api.reportPost(user, post, reason)
+		return api.reportPost(ctx, user, post, reason)
 	}
 }
 
 //ReportPost records that this post has been flagged by user, because of reason.
-func (api *API) reportPost(user gp.UserID, post gp.PostID, reason string) (err error) {
+func (api *API) reportPost(ctx context.Context, user gp.UserID, post gp.PostID, reason string) (err error) {
 	s, err := api.sc.Prepare("REPLACE INTO user_reports (reporter_id, type, entity_id, reason) VALUES (?, 'post', ?, ?)")
 	if err != nil {
 		return
 	}
-	_, err = s.Exec(user, post, reason)
+	_, err = s.ExecContext(ctx, user, post, reason)
 	return
 }
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -22,27 +23,27 @@ type MatchedMessage struct {
 }
 
 //SearchMessagesInConversation does exactly what it says on the tin.
-func (api *API) SearchMessagesInConversation(userID gp.UserID, convID gp.ConversationID, query string, mode int, index int64) (hits []MessageResult, err error) {
+func (api *API) SearchMessagesInConversation(ctx context.Context, userID gp.UserID, convID gp.ConversationID, query string, mode int, index int64) (hits []MessageResult, err error) {
 	hits = make([]MessageResult, 0)
-	if !api.userCanViewConversation(userID, convID) {
+	if !api.userCanViewConversation(ctx, userID, convID) {
 		return hits, ENOTALLOWED
 	}
-	threshold, err := api.getDeletionThreshold(userID, convID)
+	threshold, err := api.getDeletionThreshold(ctx, userID, convID)
 	if err != nil {
 		return hits, err
 	}
-	messages, err := api.esSearchConversation(convID, query, threshold)
+	messages, err := api.esSearchConversation(ctx, convID, query, threshold)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 	for _, message := range messages {
 		var before, since []gp.Message
-		before, err = api.getMessages(userID, convID, ChronologicallyBeforeID, int64(message.Message.ID), 2)
+		before, err = api.getMessages(ctx, userID, convID, ChronologicallyBeforeID, int64(message.Message.ID), 2)
 		if err != nil {
 			return
 		}
-		since, err = api.getMessages(userID, convID, ChronologicallyAfterID, int64(message.Message.ID), 2)
+		since, err = api.getMessages(ctx, userID, convID, ChronologicallyAfterID, int64(message.Message.ID), 2)
 		if err != nil {
 			return
 		}
@@ -74,7 +75,17 @@ func (api *API) esIndexMessage(message gp.Message, conversation gp.ConversationI
 	return
 }
 
-func (api *API) esSearchConversation(convID gp.ConversationID, query string, threshold gp.MessageID) (messages []esMessage, err error) {
+//esDeleteMessage removes a deleted message from the index, so it can't be found any more.
+func (api *API) esDeleteMessage(id gp.MessageID) {
+	c := elastigo.NewConn()
+	c.Domain = api.Config.ElasticSearch
+	_, err := c.Delete("gleepost", "messages", fmt.Sprintf("%d", id), nil)
+	if err != nil {
+		log.Println("Error removing message from the index:", err)
+	}
+}
+
+func (api *API) esSearchConversation(ctx context.Context, convID gp.ConversationID, query string, threshold gp.MessageID) (messages []esMessage, err error) {
 	c := elastigo.NewConn()
 	c.Domain = api.Config.ElasticSearch
 	esQuery := esMsgQuery{}
@@ -98,7 +109,7 @@ func (api *API) esSearchConversation(convID gp.ConversationID, query string, thr
 	sort := make(map[string]string)
 	sort["timestamp"] = "desc"
 	esQuery.Sort = append(esQuery.Sort, sort)
-	results, err := c.Search("gleepost", "messages", nil, esQuery)
+	results, err := esSearch(ctx, c, "messages", esQuery)
 	if err != nil {
 		return
 	}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -11,42 +12,42 @@ import (
 )
 
 //UserSearchGroups searches all the groups in userID's university. It will error out if this user is not in at least one network.
-func (api *API) UserSearchGroups(userID gp.UserID, name, category string) (groups []gp.GroupSubjective, err error) {
+func (api *API) UserSearchGroups(ctx context.Context, userID gp.UserID, name, category string) (groups []gp.GroupSubjective, err error) {
 	groups = make([]gp.GroupSubjective, 0)
-	primary, err := api.getUserUniversity(userID)
+	primary, err := api.getUserUniversity(ctx, userID)
 	if err != nil {
 		return
 	}
-	gs, err := api.searchGroups(primary.ID, name, category)
+	gs, err := api.searchGroups(ctx, primary.ID, name, category)
 	if err != nil {
 		return
 	}
 	for _, g := range gs {
 		var group gp.GroupSubjective
 		group.Group = g
-		group.UnreadCount, err = api.userConversationUnread(userID, group.Conversation)
+		group.UnreadCount, err = api.userConversationUnread(ctx, userID, group.Conversation)
 		if err != nil {
 			log.Println("error getting unread", err)
 			return
 		}
 		var role gp.Role
-		role, err = api.userRole(userID, group.ID)
+		role, err = api.userRole(ctx, userID, group.ID)
 		if err == nil {
 			group.YourRole = &role
 			var lastActivity time.Time
-			lastActivity, err = api.networkLastActivity(userID, group.ID)
+			lastActivity, err = api.networkLastActivity(ctx, userID, group.ID)
 			if err == nil {
 				group.LastActivity = &lastActivity
 			} else {
 				err = nil
 			}
-			group.NewPosts, err = api.groupNewPosts(userID, group.ID)
+			group.NewPosts, err = api.groupNewPosts(ctx, userID, group.ID)
 			if err != nil {
 				log.Println("error getting new posts", err)
 				return
 			}
 		}
-		status, err := api.pendingRequestExists(userID, group.ID)
+		status, err := api.pendingRequestExists(ctx, userID, group.ID)
 		if err == nil && (status == "pending" || status == "rejected") {
 			group.PendingRequest = true
 		}
@@ -56,7 +57,7 @@ func (api *API) UserSearchGroups(userID gp.UserID, name, category string) (group
 }
 
 //SearchGroups searches for groups which are sub-groups of `parent` - ie, groups in a particular university.
-func (api *API) searchGroups(parent gp.NetworkID, query, category string) (groups []gp.Group, err error) {
+func (api *API) searchGroups(ctx context.Context, parent gp.NetworkID, query, category string) (groups []gp.Group, err error) {
 	groups = make([]gp.Group, 0)
 	c := elastigo.NewConn()
 	c.Domain = api.Config.ElasticSearch
@@ -78,7 +79,7 @@ func (api *API) searchGroups(parent gp.NetworkID, query, category string) (group
 	}
 	q, _ := json.Marshal(groupQuery)
 	log.Printf("%s", q)
-	results, err := c.Search("gleepost", "networks", nil, groupQuery)
+	results, err := esSearch(ctx, c, "networks", groupQuery)
 	if err != nil {
 		return
 	}
@@ -93,6 +94,26 @@ func (api *API) searchGroups(parent gp.NetworkID, query, category string) (group
 	return
 }
 
+//esSearch runs query against this type in the gleepost index, giving up once ctx is done.
+//elastigo can't cancel a request, so an abandoned search still finishes in the background; we just stop waiting for it.
+func esSearch(ctx context.Context, c *elastigo.Conn, _type string, query interface{}) (results elastigo.SearchResult, err error) {
+	type searched struct {
+		results elastigo.SearchResult
+		err     error
+	}
+	done := make(chan searched, 1)
+	go func() {
+		r, e := c.Search("gleepost", _type, nil, query)
+		done <- searched{r, e}
+	}()
+	select {
+	case s := <-done:
+		return s.results, s.err
+	case <-ctx.Done():
+		return results, ctx.Err()
+	}
+}
+
 type esgroupquery struct {
 	Query innergroupquery `json:"query"`
 }
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -10,27 +11,27 @@ import (
 
 //UserSearchUsersInNetwork returns all the users with names beginning with first, last in netId, or ENOTALLOWED if user isn't part of this network.
 //last may be omitted but first must be at least 2 characters.
-func (api *API) userSearchUsersInNetwork(user gp.UserID, query string, netID gp.NetworkID) (users []gp.PublicProfile, err error) {
+func (api *API) userSearchUsersInNetwork(ctx context.Context, user gp.UserID, query string, netID gp.NetworkID) (users []gp.PublicProfile, err error) {
 	users = make([]gp.PublicProfile, 0)
-	in, err := api.UserInNetwork(user, netID)
+	in, err := api.UserInNetwork(ctx, user, netID)
 	switch {
 	case err != nil:
 		return
 	case !in:
 		return users, &ENOTALLOWED
 	default:
-		return api.searchUsersInNetwork(query, netID)
+		return api.searchUsersInNetwork(ctx, query, netID)
 	}
 }
 
 //UserSearchUsersInPrimaryNetwork returns all the users with names beginning with first, last in netId, or ENOTALLOWED if user isn't part of this network.
 //last may be omitted but first must be at least 2 characters.
-func (api *API) UserSearchUsersInPrimaryNetwork(userID gp.UserID, query string) (users []gp.PublicProfile, err error) {
-	primary, err := api.getUserUniversity(userID)
+func (api *API) UserSearchUsersInPrimaryNetwork(ctx context.Context, userID gp.UserID, query string) (users []gp.PublicProfile, err error) {
+	primary, err := api.getUserUniversity(ctx, userID)
 	if err != nil {
 		return
 	}
-	return api.userSearchUsersInNetwork(userID, query, primary.ID)
+	return api.userSearchUsersInNetwork(ctx, userID, query, primary.ID)
 }
 
 func userQuery(query string, netID gp.NetworkID) (esQuery esquery) {
@@ -48,12 +49,12 @@ func userQuery(query string, netID gp.NetworkID) (esQuery esquery) {
 }
 
 //SearchUsersInNetwork returns users whose name begins with first and last within netId.
-func (api *API) searchUsersInNetwork(query string, netID gp.NetworkID) (users []gp.PublicProfile, err error) {
+func (api *API) searchUsersInNetwork(ctx context.Context, query string, netID gp.NetworkID) (users []gp.PublicProfile, err error) {
 	users = make([]gp.PublicProfile, 0)
 	c := elastigo.NewConn()
 	c.Domain = api.Config.ElasticSearch
 	esQuery := userQuery(query, netID)
-	results, err := c.Search("gleepost", "users", nil, esQuery)
+	results, err := esSearch(ctx, c, "users", esQuery)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,88 @@
+package lib
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+//NoSuchSession is returned when you try to revoke a session which doesn't exist (or isn't yours).
+var NoSuchSession = gp.APIerror{Reason: "No such session"}
+
+//UserSessions returns all the unexpired sessions this user has, marking the one which belongs to currentToken.
+func (api *API) UserSessions(ctx context.Context, userID gp.UserID, currentToken string) (sessions []gp.Session, err error) {
+	return api.Auth.sessions(ctx, userID, currentToken)
+}
+
+//RevokeSession logs out one of this user's sessions.
+func (api *API) RevokeSession(ctx context.Context, userID gp.UserID, session gp.SessionID) (err error) {
+	return api.Auth.revokeSession(ctx, userID, session)
+}
+
+//RevokeAllSessions logs this user out everywhere, except for the session belonging to keepToken (if any).
+func (api *API) RevokeAllSessions(ctx context.Context, userID gp.UserID, keepToken string) (err error) {
+	return api.Auth.revokeAllTokens(ctx, userID, keepToken)
+}
+
+func (auth *Authenticator) sessions(ctx context.Context, userID gp.UserID, currentToken string) (sessions []gp.Session, err error) {
+	sessions = make([]gp.Session, 0)
+	records, err := auth.tokens.Sessions(ctx, userID)
+	if err != nil {
+		return
+	}
+	for _, record := range records {
+		session := gp.Session{
+			ID:       record.ID,
+			Device:   record.Device,
+			Created:  record.Created,
+			LastUsed: record.LastUsed,
+			Expiry:   record.Expiry,
+			Current:  record.Token == currentToken,
+		}
+		session.Scopes, err = ParseScopes(record.Scopes)
+		if err != nil {
+			return
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+func (auth *Authenticator) revokeSession(ctx context.Context, userID gp.UserID, session gp.SessionID) (err error) {
+	token, _, err := auth.tokens.Session(ctx, userID, session)
+	if err == sql.ErrNoRows {
+		return NoSuchSession
+	}
+	if err != nil {
+		return
+	}
+	return auth.revokeTokens(ctx, userID, token)
+}
+
+//revokeAllTokens revokes every token this user has other than except.
+func (auth *Authenticator) revokeAllTokens(ctx context.Context, userID gp.UserID, except string) (err error) {
+	all, err := auth.tokens.UserTokens(ctx, userID)
+	if err != nil {
+		return
+	}
+	var tokens []string
+	for _, token := range all {
+		if token != except {
+			tokens = append(tokens, token)
+		}
+	}
+	return auth.revokeTokens(ctx, userID, tokens...)
+}
+
+//revokeTokens deletes these tokens (and their refresh tokens) and then evicts them from the cache, so they stop working immediately.
+func (auth *Authenticator) revokeTokens(ctx context.Context, userID gp.UserID, tokens ...string) (err error) {
+	for _, token := range tokens {
+		err = auth.tokens.DeleteToken(ctx, userID, token)
+		if err != nil {
+			return
+		}
+		auth.evictToken(userID, token)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"testing"
 
 	"github.com/Petergatsby/GleepostAPI/lib/conf"
@@ -47,7 +48,7 @@ func TestSpotMentions(t *testing.T) {
 		},
 	}
 	for _, test := range tests {
-		mentioned := api.spotMentions(test.message, test.conversationID)
+		mentioned := api.spotMentions(context.Background(), test.message, test.conversationID)
 		if len(mentioned) != len(test.expectedMentions) {
 			t.Fatalf("Number of mentioned users didn't match expectations. (%d) vs expected (%d)\n", len(mentioned), len(test.expectedMentions))
 		}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -54,17 +55,17 @@ const (
 //Used for OVERVIEW
 var Stats = []Stat{LIKES, COMMENTS, VIEWS, RSVPS, POSTS}
 
-func blankF(user gp.UserID, start, finish time.Time) (count int, err error) {
+func blankF(ctx context.Context, user gp.UserID, start, finish time.Time) (count int, err error) {
 	return 0, nil
 }
 
-func blankPF(post gp.PostID, start, finish time.Time) (count int, err error) {
+func blankPF(ctx context.Context, post gp.PostID, start, finish time.Time) (count int, err error) {
 	return 0, nil
 }
 
 //AggregateStatsForUser aggregates the given Stat in the period between start and finish, grouped into buckets of length bucket.
 //If no stats are given, it will return all.
-func (api *API) AggregateStatsForUser(user gp.UserID, start, finish time.Time, bucket time.Duration, stats ...Stat) (view *View, err error) {
+func (api *API) AggregateStatsForUser(ctx context.Context, user gp.UserID, start, finish time.Time, bucket time.Duration, stats ...Stat) (view *View, err error) {
 	view = newView()
 	view.Start = start.Round(time.Duration(time.Second))
 	view.Finish = finish.Round(time.Duration(time.Second))
@@ -75,7 +76,7 @@ func (api *API) AggregateStatsForUser(user gp.UserID, start, finish time.Time, b
 	for _, stat := range stats {
 		start = view.Start
 
-		var statF func(gp.UserID, time.Time, time.Time) (int, error)
+		var statF func(context.Context, gp.UserID, time.Time, time.Time) (int, error)
 		switch {
 		case stat == LIKES:
 			statF = api.likesForUserBetween
@@ -97,12 +98,14 @@ func (api *API) AggregateStatsForUser(user gp.UserID, start, finish time.Time, b
 		for start.Before(finish) {
 			end := start.Add(bucket)
 			var count int
-			count, err = statF(user, start, end)
+			count, err = statF(ctx, user, start, end)
 			if err == nil {
 				if count > 0 {
 					result := Bucket{Start: start.Round(time.Duration(time.Second)), Count: count}
 					data = append(data, result)
 				}
+			} else if ctx.Err() != nil {
+				return nil, ctx.Err()
 			} else {
 				log.Println(err)
 			}
@@ -114,7 +117,7 @@ func (api *API) AggregateStatsForUser(user gp.UserID, start, finish time.Time, b
 }
 
 //AggregateStatsForPost - Same as AggregateStatsForUser, but for an individual post (therefore POSTS is no longer a valid stat).
-func (api *API) AggregateStatsForPost(post gp.PostID, start, finish time.Time, bucket time.Duration, stats ...Stat) (view *View, err error) {
+func (api *API) AggregateStatsForPost(ctx context.Context, post gp.PostID, start, finish time.Time, bucket time.Duration, stats ...Stat) (view *View, err error) {
 	view = newView()
 	view.Start = start.Round(time.Duration(time.Second))
 	view.Finish = finish.Round(time.Duration(time.Second))
@@ -125,7 +128,7 @@ func (api *API) AggregateStatsForPost(post gp.PostID, start, finish time.Time, b
 	for _, stat := range stats {
 		start = view.Start
 
-		var statF func(gp.PostID, time.Time, time.Time) (int, error)
+		var statF func(context.Context, gp.PostID, time.Time, time.Time) (int, error)
 		switch {
 		case stat == LIKES:
 			statF = api.likesForPostBetween
@@ -147,12 +150,14 @@ func (api *API) AggregateStatsForPost(post gp.PostID, start, finish time.Time, b
 		for start.Before(finish) {
 			end := start.Add(bucket)
 			var count int
-			count, err = statF(post, start, end)
+			count, err = statF(ctx, post, start, end)
 			if err == nil {
 				if count > 0 {
 					result := Bucket{Start: start.Round(time.Duration(time.Second)), Count: count}
 					data = append(data, result)
 				}
+			} else if ctx.Err() != nil {
+				return nil, ctx.Err()
 			} else {
 				log.Println(err)
 			}
@@ -164,16 +169,16 @@ func (api *API) AggregateStatsForPost(post gp.PostID, start, finish time.Time, b
 }
 
 //InteractionsForUserBetween returns the number of interactions this user has received in the period between start and finish.
-func (api *API) interactionsForUserBetween(user gp.UserID, start, finish time.Time) (count int, err error) {
-	likes, err := api.likesForUserBetween(user, start, finish)
+func (api *API) interactionsForUserBetween(ctx context.Context, user gp.UserID, start, finish time.Time) (count int, err error) {
+	likes, err := api.likesForUserBetween(ctx, user, start, finish)
 	if err != nil {
 		return
 	}
-	comments, err := api.commentsForUserBetween(user, start, finish)
+	comments, err := api.commentsForUserBetween(ctx, user, start, finish)
 	if err != nil {
 		return
 	}
-	rsvps, err := api.rsvpsForUserBetween(user, start, finish)
+	rsvps, err := api.rsvpsForUserBetween(ctx, user, start, finish)
 	if err != nil {
 		return
 	}
@@ -182,16 +187,16 @@ func (api *API) interactionsForUserBetween(user gp.UserID, start, finish time.Ti
 }
 
 //InteractionsForPostBetween - the number of interactions this post has received in the period between start and finish.
-func (api *API) interactionsForPostBetween(post gp.PostID, start, finish time.Time) (count int, err error) {
-	likes, err := api.likesForPostBetween(post, start, finish)
+func (api *API) interactionsForPostBetween(ctx context.Context, post gp.PostID, start, finish time.Time) (count int, err error) {
+	likes, err := api.likesForPostBetween(ctx, post, start, finish)
 	if err != nil {
 		return
 	}
-	comments, err := api.commentsForPostBetween(post, start, finish)
+	comments, err := api.commentsForPostBetween(ctx, post, start, finish)
 	if err != nil {
 		return
 	}
-	rsvps, err := api.rsvpsForPostBetween(post, start, finish)
+	rsvps, err := api.rsvpsForPostBetween(ctx, post, start, finish)
 	if err != nil {
 		return
 	}
@@ -202,11 +207,11 @@ func (api *API) interactionsForPostBetween(post gp.PostID, start, finish time.Ti
 
 //ActivatedUsersInCohort finds, among the cohort of users signed up between start and finish, all the users who have performed each activity
 //"liked", "commented", "posted", "attended", "initiated", "messaged".
-func (api *API) activatedUsersInCohort(start, finish time.Time) (ActiveUsers map[string][]gp.UserID, err error) {
+func (api *API) activatedUsersInCohort(ctx context.Context, start, finish time.Time) (ActiveUsers map[string][]gp.UserID, err error) {
 	ActiveUsers = make(map[string][]gp.UserID)
 	activities := []string{"liked", "commented", "posted", "attended", "initiated", "messaged"}
 	for _, activity := range activities {
-		users, err := api.usersActivityInCohort(activity, start, finish)
+		users, err := api.usersActivityInCohort(ctx, activity, start, finish)
 		if err != nil {
 			log.Println("Error getting active cohort:", err)
 		} else {
@@ -230,20 +235,20 @@ func deduplicate(userLists ...[]gp.UserID) (deduplicated []gp.UserID) {
 }
 
 //SummarizePeriod returns an overview of all the users who have signed up, verified, performed specific actions and performed any action, in a given period.
-func (api *API) SummarizePeriod(start, finish time.Time) (stats map[string]int) {
-	statFs := make(map[string]func(time.Time, time.Time) ([]gp.UserID, error))
+func (api *API) SummarizePeriod(ctx context.Context, start, finish time.Time) (stats map[string]int) {
+	statFs := make(map[string]func(context.Context, time.Time, time.Time) ([]gp.UserID, error))
 	stats = make(map[string]int)
 	statFs["signups"] = api.cohortSignedUpBetween
 	statFs["verified"] = api.usersVerifiedInCohort
 	for k, f := range statFs {
-		users, err := f(start, finish)
+		users, err := f(ctx, start, finish)
 		if err != nil {
 			log.Printf("Error getting %s: %s\n", k, err)
 		} else {
 			stats[k] = len(users)
 		}
 	}
-	UsersByActivity, err := api.activatedUsersInCohort(start, finish)
+	UsersByActivity, err := api.activatedUsersInCohort(ctx, start, finish)
 	if err != nil {
 		return
 	}
@@ -257,8 +262,8 @@ func (api *API) SummarizePeriod(start, finish time.Time) (stats map[string]int)
 }
 
 //SummaryEmail sends out an email to everyone in the Admin group, summarizing what the users have done in this period.
-func (api *API) summaryEmail(start, finish time.Time) {
-	stats := api.SummarizePeriod(start, finish)
+func (api *API) summaryEmail(ctx context.Context, start, finish time.Time) {
+	stats := api.SummarizePeriod(ctx, start, finish)
 	title := fmt.Sprintf("Report card for %s - %s\n", start.UTC().Round(time.Hour), finish.UTC().Round(time.Hour))
 	var text string
 	if stats["signups"] > 0 {
@@ -276,13 +281,13 @@ func (api *API) summaryEmail(start, finish time.Time) {
 	} else {
 		text = "There were no signups in this period :(\n"
 	}
-	users, err := api.getGlobalAdmins()
+	users, err := api.getGlobalAdmins(ctx)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 	for _, u := range users {
-		email, err := api.getEmail(u.ID)
+		email, err := api.getEmail(ctx, u.ID)
 		if err != nil {
 			log.Println(err)
 		} else {
@@ -298,12 +303,13 @@ func (api *API) summaryEmail(start, finish time.Time) {
 //What it actually does, however, is send an email summarizing the previous day every interval.
 func (api *API) PeriodicSummary(start time.Time, interval time.Duration) {
 	f := func() {
-		api.summaryEmail(time.Now().AddDate(0, 0, -1), time.Now())
+		ctx := context.Background()
+		api.summaryEmail(ctx, time.Now().AddDate(0, 0, -1), time.Now())
 		tick := time.Tick(interval)
 		for {
 			select {
 			case <-tick:
-				api.summaryEmail(time.Now().AddDate(0, 0, -1), time.Now())
+				api.summaryEmail(ctx, time.Now().AddDate(0, 0, -1), time.Now())
 			}
 		}
 	}
@@ -319,61 +325,61 @@ func (api *API) PeriodicSummary(start time.Time, interval time.Duration) {
 }
 
 //LikesForUserBetween finds all likes for user's posts in the interval between start and finish.
-func (api *API) likesForUserBetween(user gp.UserID, start, finish time.Time) (count int, err error) {
-	s, err := api.sc.Prepare("SELECT COUNT(*) FROM post_likes WHERE post_id IN (SELECT id FROM wall_posts WHERE `by` = ?) AND `timestamp` > ? AND `timestamp` < ?")
+func (api *API) likesForUserBetween(ctx context.Context, user gp.UserID, start, finish time.Time) (count int, err error) {
+	s, err := api.replicas.Prepare("SELECT COUNT(*) FROM post_likes WHERE post_id IN (SELECT id FROM wall_posts WHERE `by` = ?) AND `timestamp` > ? AND `timestamp` < ?")
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(user, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
+	err = s.QueryRowContext(ctx, user, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
 	return
 }
 
 //CommentsForUserBetween - Same as LikesForUserBetween, but for comments
-func (api *API) commentsForUserBetween(user gp.UserID, start, finish time.Time) (count int, err error) {
-	s, err := api.sc.Prepare("SELECT COUNT(*) FROM post_comments WHERE post_id IN (SELECT id FROM wall_posts WHERE `by` = ?) AND `timestamp` > ? AND `timestamp` < ?")
+func (api *API) commentsForUserBetween(ctx context.Context, user gp.UserID, start, finish time.Time) (count int, err error) {
+	s, err := api.replicas.Prepare("SELECT COUNT(*) FROM post_comments WHERE post_id IN (SELECT id FROM wall_posts WHERE `by` = ?) AND `timestamp` > ? AND `timestamp` < ?")
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(user, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
+	err = s.QueryRowContext(ctx, user, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
 	return
 }
 
 //PostsForUserBetween returns the number of posts a user has made in this interval.
-func (api *API) postsForUserBetween(user gp.UserID, start, finish time.Time) (count int, err error) {
-	s, err := api.sc.Prepare("SELECT COUNT(*) FROM wall_posts WHERE `by` = ? AND `time` > ? AND `time` < ? AND pending = 0 AND deleted = 0")
+func (api *API) postsForUserBetween(ctx context.Context, user gp.UserID, start, finish time.Time) (count int, err error) {
+	s, err := api.replicas.Prepare("SELECT COUNT(*) FROM wall_posts WHERE `by` = ? AND `time` > ? AND `time` < ? AND pending = 0 AND deleted = 0")
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(user, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
+	err = s.QueryRowContext(ctx, user, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
 	return
 }
 
 //RsvpsForUserBetween - Same as LikesForUserBetween, but for "attending"s
-func (api *API) rsvpsForUserBetween(user gp.UserID, start, finish time.Time) (count int, err error) {
-	s, err := api.sc.Prepare("SELECT COUNT(*) FROM event_attendees WHERE post_id IN (SELECT id FROM wall_posts WHERE `by` = ?) AND `time` > ? AND `time` < ?")
+func (api *API) rsvpsForUserBetween(ctx context.Context, user gp.UserID, start, finish time.Time) (count int, err error) {
+	s, err := api.replicas.Prepare("SELECT COUNT(*) FROM event_attendees WHERE post_id IN (SELECT id FROM wall_posts WHERE `by` = ?) AND `time` > ? AND `time` < ?")
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(user, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
+	err = s.QueryRowContext(ctx, user, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
 	return
 }
 
-func (api *API) viewsForUserBetween(user gp.UserID, start, finish time.Time) (count int, err error) {
-	s, err := api.sc.Prepare("SELECT COUNT(*) FROM post_views JOIN wall_posts ON post_views.post_id = wall_posts.id WHERE `by` = ? AND `ts` > ? AND `ts` < ?")
+func (api *API) viewsForUserBetween(ctx context.Context, user gp.UserID, start, finish time.Time) (count int, err error) {
+	s, err := api.replicas.Prepare("SELECT COUNT(*) FROM post_views JOIN wall_posts ON post_views.post_id = wall_posts.id WHERE `by` = ? AND `ts` > ? AND `ts` < ?")
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(user, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
+	err = s.QueryRowContext(ctx, user, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
 	return
 }
 
 //CohortSignedUpBetween returns all the users who signed up between start and finish.
-func (api *API) cohortSignedUpBetween(start, finish time.Time) (users []gp.UserID, err error) {
-	s, err := api.sc.Prepare("SELECT id FROM users WHERE `timestamp` > ? AND `timestamp` < ?")
+func (api *API) cohortSignedUpBetween(ctx context.Context, start, finish time.Time) (users []gp.UserID, err error) {
+	s, err := api.replicas.Prepare("SELECT id FROM users WHERE `timestamp` > ? AND `timestamp` < ?")
 	if err != nil {
 		return
 	}
-	rows, err := s.Query(start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime))
+	rows, err := s.QueryContext(ctx, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime))
 	if err != nil {
 		return
 	}
@@ -390,9 +396,9 @@ func (api *API) cohortSignedUpBetween(start, finish time.Time) (users []gp.UserI
 }
 
 //UsersVerifiedInCohort returns all the users who have verified their account in the cohort signed up between start and finish.
-func (api *API) usersVerifiedInCohort(start, finish time.Time) (users []gp.UserID, err error) {
-	s, err := api.sc.Prepare("SELECT id FROM users WHERE `verified` = 1 AND `timestamp` > ? AND `timestamp` < ?")
-	rows, err := s.Query(start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime))
+func (api *API) usersVerifiedInCohort(ctx context.Context, start, finish time.Time) (users []gp.UserID, err error) {
+	s, err := api.replicas.Prepare("SELECT id FROM users WHERE `verified` = 1 AND `timestamp` > ? AND `timestamp` < ?")
+	rows, err := s.QueryContext(ctx, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime))
 	if err != nil {
 		return
 	}
@@ -409,21 +415,21 @@ func (api *API) usersVerifiedInCohort(start, finish time.Time) (users []gp.UserI
 }
 
 //UsersActivityInCohort returns all the users in the cohort (see CohortSignedUpBetween) who performed this activity, where activity is one of: liked, commented, posted, attended, initiated, messaged
-func (api *API) usersActivityInCohort(activity string, start, finish time.Time) (users []gp.UserID, err error) {
+func (api *API) usersActivityInCohort(ctx context.Context, activity string, start, finish time.Time) (users []gp.UserID, err error) {
 	var s *sql.Stmt
 	switch {
 	case activity == "liked":
-		s, err = api.sc.Prepare("SELECT DISTINCT user_id FROM post_likes WHERE user_id IN (SELECT id FROM users WHERE `timestamp` > ? AND `timestamp` < ?)")
+		s, err = api.replicas.Prepare("SELECT DISTINCT user_id FROM post_likes WHERE user_id IN (SELECT id FROM users WHERE `timestamp` > ? AND `timestamp` < ?)")
 	case activity == "commented":
-		s, err = api.sc.Prepare("SELECT DISTINCT `by` FROM post_comments WHERE `by` IN (SELECT id FROM users WHERE `timestamp` > ? AND `timestamp` < ?)")
+		s, err = api.replicas.Prepare("SELECT DISTINCT `by` FROM post_comments WHERE `by` IN (SELECT id FROM users WHERE `timestamp` > ? AND `timestamp` < ?)")
 	case activity == "posted":
-		s, err = api.sc.Prepare("SELECT DISTINCT `by` FROM wall_posts WHERE `by` IN (SELECT id FROM users WHERE `timestamp` > ? AND `timestamp` < ?) AND deleted = 0")
+		s, err = api.replicas.Prepare("SELECT DISTINCT `by` FROM wall_posts WHERE `by` IN (SELECT id FROM users WHERE `timestamp` > ? AND `timestamp` < ?) AND deleted = 0")
 	case activity == "attended":
-		s, err = api.sc.Prepare("SELECT DISTINCT `user_id` FROM event_attendees WHERE `user_id` IN (SELECT id FROM users WHERE `timestamp` > ? AND `timestamp` < ?)")
+		s, err = api.replicas.Prepare("SELECT DISTINCT `user_id` FROM event_attendees WHERE `user_id` IN (SELECT id FROM users WHERE `timestamp` > ? AND `timestamp` < ?)")
 	case activity == "initiated":
-		s, err = api.sc.Prepare("SELECT DISTINCT `initiator` FROM conversations WHERE `initiator` IN (SELECT id FROM users WHERE `timestamp` > ? AND `timestamp` < ?)")
+		s, err = api.replicas.Prepare("SELECT DISTINCT `initiator` FROM conversations WHERE `initiator` IN (SELECT id FROM users WHERE `timestamp` > ? AND `timestamp` < ?)")
 	case activity == "messaged":
-		s, err = api.sc.Prepare("SELECT DISTINCT `from` FROM chat_messages WHERE `from` IN (SELECT id FROM users WHERE `timestamp` > ? AND `timestamp` < ?)")
+		s, err = api.replicas.Prepare("SELECT DISTINCT `from` FROM chat_messages WHERE `from` IN (SELECT id FROM users WHERE `timestamp` > ? AND `timestamp` < ?)")
 	default:
 		err = errors.New("no such activity")
 		return
@@ -431,7 +437,7 @@ func (api *API) usersActivityInCohort(activity string, start, finish time.Time)
 	if err != nil {
 		return
 	}
-	rows, err := s.Query(start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime))
+	rows, err := s.QueryContext(ctx, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime))
 	if err != nil {
 		return
 	}
@@ -448,132 +454,132 @@ func (api *API) usersActivityInCohort(activity string, start, finish time.Time)
 }
 
 //LikesForPostBetween returns the number of likes this post has gained in the interval between start and finish.
-func (api *API) likesForPostBetween(post gp.PostID, start, finish time.Time) (count int, err error) {
-	s, err := api.sc.Prepare("SELECT COUNT(*) FROM post_likes WHERE post_id = ? AND `timestamp` > ? AND `timestamp` < ?")
+func (api *API) likesForPostBetween(ctx context.Context, post gp.PostID, start, finish time.Time) (count int, err error) {
+	s, err := api.replicas.Prepare("SELECT COUNT(*) FROM post_likes WHERE post_id = ? AND `timestamp` > ? AND `timestamp` < ?")
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(post, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
+	err = s.QueryRowContext(ctx, post, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
 	return
 
 }
 
 //CommentsForPostBetween returns the number of comments this post has gained in the interval between start and finish.
-func (api *API) commentsForPostBetween(post gp.PostID, start, finish time.Time) (count int, err error) {
-	s, err := api.sc.Prepare("SELECT COUNT(*) FROM post_comments WHERE post_id = ? AND `timestamp` > ? AND `timestamp` < ?")
+func (api *API) commentsForPostBetween(ctx context.Context, post gp.PostID, start, finish time.Time) (count int, err error) {
+	s, err := api.replicas.Prepare("SELECT COUNT(*) FROM post_comments WHERE post_id = ? AND `timestamp` > ? AND `timestamp` < ?")
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(post, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
+	err = s.QueryRowContext(ctx, post, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
 	return
 
 }
 
 //RsvpsForPostBetween returns the number of RSVPs this post has gained in the interval between start and finish.
-func (api *API) rsvpsForPostBetween(post gp.PostID, start, finish time.Time) (count int, err error) {
-	s, err := api.sc.Prepare("SELECT COUNT(*) FROM event_attendees WHERE post_id = ? AND `time` > ? AND `time` < ?")
+func (api *API) rsvpsForPostBetween(ctx context.Context, post gp.PostID, start, finish time.Time) (count int, err error) {
+	s, err := api.replicas.Prepare("SELECT COUNT(*) FROM event_attendees WHERE post_id = ? AND `time` > ? AND `time` < ?")
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(post, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
+	err = s.QueryRowContext(ctx, post, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
 	return
 }
 
-func (api *API) viewsForPostBetween(post gp.PostID, start, finish time.Time) (count int, err error) {
-	s, err := api.sc.Prepare("SELECT COUNT(*) FROM post_views WHERE post_id = ? AND `ts` > ? AND `ts` < ?")
+func (api *API) viewsForPostBetween(ctx context.Context, post gp.PostID, start, finish time.Time) (count int, err error) {
+	s, err := api.replicas.Prepare("SELECT COUNT(*) FROM post_views WHERE post_id = ? AND `ts` > ? AND `ts` < ?")
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(post, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
+	err = s.QueryRowContext(ctx, post, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
 	return
 
 }
 
-func (api *API) attendeesInNetwork(network gp.NetworkID, start, finish time.Time) (count int, err error) {
+func (api *API) attendeesInNetwork(ctx context.Context, network gp.NetworkID, start, finish time.Time) (count int, err error) {
 	q := "SELECT COUNT(DISTINCT user_id) FROM event_attendees JOIN user_network ON event_attendees.user_id = user_network.user_id " +
 		"JOIN post_attribs ON event_attendees.post_id = post_attribs.post_id " +
 		"WHERE user_network.network_id = ? " +
 		"AND post_attribs.attrib = 'event-time' AND post_attribs.value > ? AND post_attribs.value < ? "
-	s, err := api.sc.Prepare(q)
+	s, err := api.replicas.Prepare(q)
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(network, start.Unix(), finish.Unix()).Scan(&count)
+	err = s.QueryRowContext(ctx, network, start.Unix(), finish.Unix()).Scan(&count)
 	return
 }
 
-func (api *API) uniquePostViewers(network gp.NetworkID, start, finish time.Time) (count int, err error) {
+func (api *API) uniquePostViewers(ctx context.Context, network gp.NetworkID, start, finish time.Time) (count int, err error) {
 	q := "SELECT COUNT(DISTINCT user_id) FROM post_views JOIN user_network ON post_views.user_id = user_network.user_id " +
 		"WHERE user_network.network_id = ? " +
 		"AND post_views.`ts` > ? AND post_views.`ts` < ?"
-	s, err := api.sc.Prepare(q)
+	s, err := api.replicas.Prepare(q)
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(network, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
+	err = s.QueryRowContext(ctx, network, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
 	return
 }
 
-func (api *API) uniquePostsViewed(network gp.NetworkID, start, finish time.Time) (count int, err error) {
+func (api *API) uniquePostsViewed(ctx context.Context, network gp.NetworkID, start, finish time.Time) (count int, err error) {
 	q := "SELECT COUNT(DISTINCT post_id) FROM post_views JOIN user_network ON post_views.user_id = user_network.user_id " +
 		"WHERE user_network.network_id = ? " +
 		"AND post_views.`ts` > ? AND post_views.`ts` < ?"
-	s, err := api.sc.Prepare(q)
+	s, err := api.replicas.Prepare(q)
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(network, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
+	err = s.QueryRowContext(ctx, network, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
 	return
 }
 
-func (api *API) totalPostsViewed(network gp.NetworkID, start, finish time.Time) (count int, err error) {
+func (api *API) totalPostsViewed(ctx context.Context, network gp.NetworkID, start, finish time.Time) (count int, err error) {
 	q := "SELECT COUNT(*) FROM post_views JOIN user_network ON post_views.user_id = user_network.user_id " +
 		"WHERE user_network.network_id = ? " +
 		"AND post_views.`ts` > ? AND post_views.`ts` < ?"
-	s, err := api.sc.Prepare(q)
+	s, err := api.replicas.Prepare(q)
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(network, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
+	err = s.QueryRowContext(ctx, network, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
 	return
 }
 
-func (api *API) uniqueMessageSenders(network gp.NetworkID, start, finish time.Time) (count int, err error) {
+func (api *API) uniqueMessageSenders(ctx context.Context, network gp.NetworkID, start, finish time.Time) (count int, err error) {
 	q := "SELECT COUNT(DISTINCT `from`) FROM chat_messages JOIN user_network ON chat_messages.from = user_network.user_id " +
 		"WHERE user_network.network_id = ? " +
 		"AND chat_messages.`timestamp` > ? AND chat_messages.`timestamp` < ?"
-	s, err := api.sc.Prepare(q)
+	s, err := api.replicas.Prepare(q)
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(network, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
+	err = s.QueryRowContext(ctx, network, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
 	return
 }
 
-func (api *API) totalMessagesSent(network gp.NetworkID, start, finish time.Time) (count int, err error) {
+func (api *API) totalMessagesSent(ctx context.Context, network gp.NetworkID, start, finish time.Time) (count int, err error) {
 	q := "SELECT COUNT(*) FROM chat_messages JOIN user_network ON chat_messages.from = user_network.user_id " +
 		"WHERE user_network.network_id = ? " +
 		"AND chat_messages.`timestamp` > ? AND chat_messages.`timestamp` < ?"
-	s, err := api.sc.Prepare(q)
+	s, err := api.replicas.Prepare(q)
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(network, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
+	err = s.QueryRowContext(ctx, network, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime)).Scan(&count)
 	return
 }
 
 //UsersOnline is using post-views as a proxy for users being online.
-func (api *API) UsersOnline(network gp.NetworkID, start, finish time.Time) (total, students, staff, faculty, alumni int, err error) {
+func (api *API) UsersOnline(ctx context.Context, network gp.NetworkID, start, finish time.Time) (total, students, staff, faculty, alumni int, err error) {
 	q := "SELECT COUNT(DISTINCT post_views.user_id), users.type FROM post_views JOIN user_network ON post_views.user_id = user_network.user_id " +
 		"JOIN users ON post_views.user_id = users.id " +
 		"WHERE user_network.network_id = ? " +
 		"AND post_views.`ts` > ? AND post_views.`ts` < ? " +
 		"GROUP BY users.type"
-	s, err := api.sc.Prepare(q)
+	s, err := api.replicas.Prepare(q)
 	if err != nil {
 		return
 	}
-	rows, err := s.Query(network, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime))
+	rows, err := s.QueryContext(ctx, network, start.UTC().Format(mysqlTime), finish.UTC().Format(mysqlTime))
 	if err != nil {
 		return
 	}
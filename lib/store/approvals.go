@@ -0,0 +1,187 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/psc"
+)
+
+type mysqlApprovals struct {
+	db *sql.DB
+	sc *psc.StatementCache
+}
+
+//Approval statuses, in wall_posts.pending.
+const (
+	statusApproved = iota
+	statusPending
+	statusRejected
+)
+
+func (a mysqlApprovals) ReviewerLevel(ctx context.Context, network gp.NetworkID, user gp.UserID) (level int, err error) {
+	s, err := a.sc.Prepare("SELECT role_level FROM user_network JOIN network ON network.master_group = user_network.network_id WHERE network.id = ? AND user_network.user_id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, network, user).Scan(&level)
+	return
+}
+
+func (a mysqlApprovals) Level(ctx context.Context, network gp.NetworkID) (level gp.ApproveLevel, err error) {
+	s, err := a.sc.Prepare("SELECT approval_level, approved_categories FROM network WHERE id = ?")
+	if err != nil {
+		return
+	}
+	var categories sql.NullString
+	if err = s.QueryRowContext(ctx, network).Scan(&level.Level, &categories); err != nil {
+		return
+	}
+	level.Categories = []string{}
+	if categories.Valid {
+		level.Categories = strings.Split(categories.String, ",")
+	}
+	return level, nil
+}
+
+func (a mysqlApprovals) SetLevel(ctx context.Context, network gp.NetworkID, level int, categories string) (changed bool, err error) {
+	s, err := a.sc.Prepare("UPDATE network SET approval_level = ?, approved_categories = ? WHERE id = ?")
+	if err != nil {
+		return
+	}
+	res, err := s.ExecContext(ctx, level, categories, network)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (a mysqlApprovals) Status(ctx context.Context, post gp.PostID) (status int, err error) {
+	s, err := a.sc.Prepare("SELECT pending FROM wall_posts WHERE id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, post).Scan(&status)
+	return
+}
+
+func (a mysqlApprovals) Pending(ctx context.Context, network gp.NetworkID) ([]StoredPost, error) {
+	return a.posts(ctx, "SELECT "+postColumns+"FROM wall_posts WHERE deleted = 0 AND pending = 1 AND network_id = ? ORDER BY time DESC", network)
+}
+
+func (a mysqlApprovals) UserPending(ctx context.Context, by gp.UserID) ([]StoredPost, error) {
+	q := "SELECT DISTINCT " + postColumns +
+		"FROM wall_posts " +
+		"LEFT JOIN post_reviews ON wall_posts.id = post_reviews.post_id " +
+		"WHERE deleted = 0 AND pending > 0 AND wall_posts.`by` = ? " +
+		"GROUP BY wall_posts.id " +
+		"ORDER BY CASE WHEN MAX(post_reviews.timestamp) IS NULL THEN wall_posts.time ELSE MAX(post_reviews.timestamp) END DESC "
+	return a.posts(ctx, q, by)
+}
+
+func (a mysqlApprovals) Approved(ctx context.Context, network gp.NetworkID, mode int, index int64, count int) ([]StoredPost, error) {
+	return a.reviewed(ctx, network, statusApproved, "approved", mode, index, count)
+}
+
+func (a mysqlApprovals) Rejected(ctx context.Context, network gp.NetworkID, mode int, index int64, count int) ([]StoredPost, error) {
+	return a.reviewed(ctx, network, statusRejected, "rejected", mode, index, count)
+}
+
+//reviewed returns a page of the posts in network with this status, most recently given it (by a review of this action) first.
+func (a mysqlApprovals) reviewed(ctx context.Context, network gp.NetworkID, status int, action string, mode int, index int64, count int) ([]StoredPost, error) {
+	q := "SELECT " + postColumns +
+		"FROM wall_posts JOIN post_reviews ON post_reviews.post_id = wall_posts.id " +
+		"WHERE wall_posts.deleted = 0 AND pending = ? AND post_reviews.action = ? " +
+		"AND network_id = ? "
+	switch mode {
+	case ChronologicallyAfterID:
+		q += "AND wall_posts.time > (SELECT time FROM wall_posts WHERE id = ?) " +
+			"ORDER BY post_reviews.timestamp DESC LIMIT 0, ?"
+	case ChronologicallyBeforeID:
+		q += "AND wall_posts.time < (SELECT time FROM wall_posts WHERE id = ?) " +
+			"ORDER BY post_reviews.timestamp DESC LIMIT 0, ?"
+	default:
+		q += "ORDER BY post_reviews.timestamp DESC LIMIT ?, ?"
+	}
+	return a.posts(ctx, q, status, action, network, index, count)
+}
+
+func (a mysqlApprovals) posts(ctx context.Context, q string, args ...interface{}) (posts []StoredPost, err error) {
+	s, err := a.sc.Prepare(q)
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return scanPosts(rows)
+}
+
+func (a mysqlApprovals) History(ctx context.Context, post gp.PostID) (history []StoredReview, err error) {
+	s, err := a.sc.Prepare("SELECT action, `by`, reason, `timestamp` FROM post_reviews WHERE post_id = ?")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, post)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var review StoredReview
+		var reason sql.NullString
+		var t string
+		if err = rows.Scan(&review.Action, &review.By, &reason, &t); err != nil {
+			return
+		}
+		review.Reason = reason.String
+		if review.At, err = time.Parse(mysqlTime, t); err != nil {
+			return
+		}
+		history = append(history, review)
+	}
+	return history, rows.Err()
+}
+
+func (a mysqlApprovals) Approve(ctx context.Context, post gp.PostID, by gp.UserID, reason string) error {
+	return a.review(ctx, post, by, "approved", reason, "UPDATE wall_posts SET pending = 0, time = NOW() WHERE id = ?")
+}
+
+func (a mysqlApprovals) Reject(ctx context.Context, post gp.PostID, by gp.UserID, reason string) error {
+	return a.review(ctx, post, by, "rejected", reason, "UPDATE wall_posts SET pending = 2 WHERE id = ?")
+}
+
+func (a mysqlApprovals) Resubmit(ctx context.Context, post gp.PostID, by gp.UserID, reason string) error {
+	return a.review(ctx, post, by, "edited", reason, "UPDATE wall_posts SET pending = 1 WHERE id = ?")
+}
+
+//review records a review of post, and updates it with update, in one transaction.
+func (a mysqlApprovals) review(ctx context.Context, post gp.PostID, by gp.UserID, action, reason, update string) (err error) {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+		}
+	}()
+	_, err = tx.ExecContext(ctx, "INSERT INTO post_reviews (post_id, action, `by`, reason) VALUES (?, ?, ?, ?)", post, action, by, reason)
+	if err != nil {
+		return
+	}
+	_, err = tx.ExecContext(ctx, update, post)
+	if err != nil {
+		return
+	}
+	err = tx.Commit()
+	committed = err == nil
+	return
+}
@@ -0,0 +1,552 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/psc"
+)
+
+type mysqlConversations struct {
+	db       *sql.DB
+	sc       *psc.StatementCache
+	replicas Replicas
+}
+
+//messageColumns are what scanMessages expects, in order.
+const messageColumns = "id, `from`, text, `timestamp`, `system`, edited, deleted"
+
+func (c mysqlConversations) Create(ctx context.Context, initiator gp.UserID, primary bool, group gp.NetworkID) (id gp.ConversationID, err error) {
+	var s *sql.Stmt
+	var res sql.Result
+	if group > 0 {
+		s, err = c.sc.Prepare("INSERT INTO conversations (initiator, primary_conversation, group_id) VALUES (?, ?, ?)")
+		if err != nil {
+			return
+		}
+		res, err = s.ExecContext(ctx, initiator, primary, group)
+	} else {
+		s, err = c.sc.Prepare("INSERT INTO conversations (initiator, primary_conversation) VALUES (?, ?)")
+		if err != nil {
+			return
+		}
+		res, err = s.ExecContext(ctx, initiator, primary)
+	}
+	if err != nil {
+		return
+	}
+	_id, err := res.LastInsertId()
+	return gp.ConversationID(_id), err
+}
+
+func (c mysqlConversations) AddParticipant(ctx context.Context, conv gp.ConversationID, user gp.UserID) (err error) {
+	s, err := c.sc.Prepare("INSERT INTO conversation_participants (conversation_id, participant_id, deleted) VALUES (?, ?, 0)")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, conv, user)
+	return duplicate(err)
+}
+
+func (c mysqlConversations) Participants(ctx context.Context, conv gp.ConversationID, includeDeleted bool) (participants []gp.UserID, err error) {
+	q := "SELECT participant_id " +
+		"FROM conversation_participants " +
+		"JOIN users ON conversation_participants.participant_id = users.id " +
+		"WHERE conversation_id=?"
+	if !includeDeleted {
+		q += " AND deleted = 0"
+	}
+	return c.users(ctx, q, conv)
+}
+
+func (c mysqlConversations) Contacts(ctx context.Context, user gp.UserID) ([]gp.UserID, error) {
+	return c.users(ctx, "SELECT DISTINCT(participant_id) FROM conversation_participants WHERE conversation_id IN (SELECT conversation_id from conversation_participants WHERE participant_id = ? AND deleted = 0)", user)
+}
+
+func (c mysqlConversations) users(ctx context.Context, q string, args ...interface{}) (users []gp.UserID, err error) {
+	s, err := c.sc.Prepare(q)
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id gp.UserID
+		if err = rows.Scan(&id); err != nil {
+			return
+		}
+		users = append(users, id)
+	}
+	return users, rows.Err()
+}
+
+func (c mysqlConversations) UserConversations(ctx context.Context, user gp.UserID, start int64, count int) (conversations []ConversationActivity, err error) {
+	q := "SELECT conversation_participants.conversation_id, MAX( chat_messages.`timestamp` ) AS last_mod " +
+		"FROM conversation_participants " +
+		"JOIN  `chat_messages` ON conversation_participants.conversation_id = chat_messages.conversation_id " +
+		"JOIN conversations ON conversation_participants.conversation_id = conversations.id " +
+		"WHERE conversation_participants.participant_id = ? " +
+		"AND conversation_participants.deleted =0 " +
+		"AND conversations.group_id IS NULL " +
+		"AND chat_messages.id > conversation_participants.deletion_threshold " +
+		"GROUP BY chat_messages.conversation_id " +
+		"ORDER BY last_mod DESC " +
+		"LIMIT ? , ? "
+	s, err := c.replicas.PrepareFor(ctx, user, q)
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, user, start, count)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var conv ConversationActivity
+		var t string
+		if err = rows.Scan(&conv.ID, &t); err != nil {
+			return
+		}
+		conv.LastActivity, _ = time.Parse(mysqlTime, t)
+		conversations = append(conversations, conv)
+	}
+	return conversations, rows.Err()
+}
+
+func (c mysqlConversations) Activity(ctx context.Context, user gp.UserID, conv gp.ConversationID) (t time.Time, err error) {
+	s, err := c.sc.Prepare("SELECT MAX(chat_messages.`timestamp`) AS last_mod FROM conversation_participants JOIN chat_messages ON conversation_participants.conversation_id = chat_messages.conversation_id WHERE conversation_participants.participant_id = ? AND conversation_participants.conversation_id = ?")
+	if err != nil {
+		return
+	}
+	var last sql.NullString
+	err = s.QueryRowContext(ctx, user, conv).Scan(&last)
+	if err != nil {
+		return
+	}
+	if !last.Valid {
+		return t, sql.ErrNoRows
+	}
+	return time.Parse(mysqlTime, last.String)
+}
+
+func (c mysqlConversations) Leave(ctx context.Context, user gp.UserID, conv gp.ConversationID) error {
+	return c.exec(ctx, "UPDATE conversation_participants SET deleted = 1 WHERE participant_id = ? AND conversation_id = ?", user, conv)
+}
+
+func (c mysqlConversations) SetDeletionThreshold(ctx context.Context, user gp.UserID, conv gp.ConversationID, threshold gp.MessageID) error {
+	return c.exec(ctx, "UPDATE conversation_participants SET deletion_threshold = (SELECT MAX(id) FROM chat_messages WHERE chat_messages.conversation_id = ? AND chat_messages.id <= ?) WHERE conversation_participants.conversation_id = ? AND conversation_participants.participant_id = ? AND conversation_participants.deletion_threshold < ?",
+		conv, threshold, conv, user, threshold)
+}
+
+func (c mysqlConversations) DeletionThreshold(ctx context.Context, user gp.UserID, conv gp.ConversationID) (threshold gp.MessageID, err error) {
+	s, err := c.sc.Prepare("SELECT deletion_threshold FROM conversation_participants WHERE participant_id = ? AND conversation_id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, user, conv).Scan(&threshold)
+	return
+}
+
+func (c mysqlConversations) ReadStatus(ctx context.Context, conv gp.ConversationID) (read []gp.Read, err error) {
+	s, err := c.sc.Prepare("SELECT participant_id, last_read, read_at FROM conversation_participants WHERE conversation_id = ?")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, conv)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r gp.Read
+		var t sql.NullString
+		if err = rows.Scan(&r.UserID, &r.LastRead, &t); err != nil {
+			return
+		}
+		if t.Valid {
+			if at, e := time.Parse(mysqlTime, t.String); e == nil {
+				r.At = &at
+			}
+		}
+		read = append(read, r)
+	}
+	return read, rows.Err()
+}
+
+func (c mysqlConversations) MarkRead(ctx context.Context, user gp.UserID, conv gp.ConversationID, upTo gp.MessageID, at time.Time) (read gp.MessageID, err error) {
+	err = c.exec(ctx, "UPDATE conversation_participants "+
+		"SET last_read = (SELECT MAX(id) FROM chat_messages WHERE conversation_id = ? AND id <= ?), "+
+		"read_at = ? "+
+		"WHERE `conversation_id` = ? AND `participant_id` = ? AND last_read < ?",
+		conv, upTo, at, conv, user, upTo)
+	if err != nil {
+		return
+	}
+	s, err := c.sc.Prepare("SELECT last_read FROM conversation_participants WHERE conversation_id = ? AND participant_id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, conv, user).Scan(&read)
+	return
+}
+
+func (c mysqlConversations) AddMessage(ctx context.Context, conv gp.ConversationID, by gp.UserID, text string, system bool) (id gp.MessageID, err error) {
+	s, err := c.sc.Prepare("INSERT INTO chat_messages (conversation_id, `from`, `text`, `system`) VALUES (?,?,?,?)")
+	if err != nil {
+		return
+	}
+	res, err := s.ExecContext(ctx, conv, by, text, system)
+	if err != nil {
+		return
+	}
+	_id, err := res.LastInsertId()
+	return gp.MessageID(_id), err
+}
+
+func (c mysqlConversations) LastMessage(ctx context.Context, conv gp.ConversationID) (message StoredMessage, err error) {
+	//Ordered by id rather than timestamp because timestamps are limited to 1-second resolution.
+	messages, err := c.messages(ctx, "SELECT "+messageColumns+" FROM chat_messages WHERE conversation_id = ? ORDER BY `id` DESC LIMIT 1", conv)
+	if err != nil {
+		return
+	}
+	if len(messages) == 0 {
+		return message, sql.ErrNoRows
+	}
+	return messages[0], nil
+}
+
+func (c mysqlConversations) Message(ctx context.Context, conv gp.ConversationID, id gp.MessageID) (message StoredMessage, err error) {
+	messages, err := c.messages(ctx, "SELECT "+messageColumns+" FROM chat_messages WHERE id = ? AND conversation_id = ?", id, conv)
+	if err != nil {
+		return
+	}
+	if len(messages) == 0 {
+		return message, sql.ErrNoRows
+	}
+	return messages[0], nil
+}
+
+//changeable picks out a message which can still be edited or deleted.
+const changeable = "WHERE id = ? AND conversation_id = ? AND `from` = ? AND `system` = 0 AND deleted = 0 AND `timestamp` > NOW() - INTERVAL ? SECOND"
+
+//EditMessage copies the old text into message_edits and updates it in one transaction, both under the changeable conditions.
+func (c mysqlConversations) EditMessage(ctx context.Context, conv gp.ConversationID, id gp.MessageID, by gp.UserID, text string, window time.Duration) (ok bool, err error) {
+	seconds := int(window.Seconds())
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+		}
+	}()
+	res, err := tx.ExecContext(ctx, "INSERT INTO message_edits (message_id, text, `time`) SELECT id, text, NOW() FROM chat_messages "+changeable, id, conv, by, seconds)
+	if err != nil {
+		return
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	res, err = tx.ExecContext(ctx, "UPDATE chat_messages SET text = ?, edited = NOW() "+changeable, text, id, conv, by, seconds)
+	if err != nil {
+		return
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	//The files it shared may have changed along with its text.
+	_, err = tx.ExecContext(ctx, "DELETE FROM conversation_files WHERE message_id = ?", id)
+	if err != nil {
+		return
+	}
+	err = tx.Commit()
+	committed = err == nil
+	return committed, err
+}
+
+func (c mysqlConversations) DeleteMessage(ctx context.Context, conv gp.ConversationID, id gp.MessageID, by gp.UserID, window time.Duration) (ok bool, err error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+		}
+	}()
+	res, err := tx.ExecContext(ctx, "UPDATE chat_messages SET text = '', deleted = 1 "+changeable, id, conv, by, int(window.Seconds()))
+	if err != nil {
+		return
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM message_edits WHERE message_id = ?", id)
+	if err != nil {
+		return
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM conversation_files WHERE message_id = ?", id)
+	if err != nil {
+		return
+	}
+	err = tx.Commit()
+	committed = err == nil
+	return committed, err
+}
+
+func (c mysqlConversations) MessageHistory(ctx context.Context, id gp.MessageID) (edits []gp.MessageEdit, err error) {
+	s, err := c.sc.Prepare("SELECT text, `time` FROM message_edits WHERE message_id = ? ORDER BY id DESC")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, id)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var edit gp.MessageEdit
+		var t string
+		if err = rows.Scan(&edit.Text, &t); err != nil {
+			return
+		}
+		edit.Time, err = time.Parse(mysqlTime, t)
+		if err != nil {
+			return
+		}
+		edits = append(edits, edit)
+	}
+	return edits, rows.Err()
+}
+
+func (c mysqlConversations) Messages(ctx context.Context, user gp.UserID, conv gp.ConversationID, mode int, index int64, count int) ([]StoredMessage, error) {
+	visible := "FROM chat_messages " +
+		"WHERE chat_messages.conversation_id = ? " +
+		"AND chat_messages.id > (SELECT deletion_threshold FROM conversation_participants WHERE participant_id = ? AND conversation_id = ?) "
+	var q string
+	switch mode {
+	case ChronologicallyAfterID:
+		q = "SELECT " + messageColumns + " " + visible + "AND id > ? ORDER BY `timestamp` ASC LIMIT ?"
+		q = fmt.Sprintf("SELECT %s FROM ( %s ) AS `msgs` ORDER BY `timestamp` DESC", messageColumns, q)
+	case ChronologicallyBeforeID:
+		q = "SELECT " + messageColumns + " " + visible + "AND id < ? ORDER BY `timestamp` DESC LIMIT ?"
+	default:
+		q = "SELECT " + messageColumns + " " + visible + "ORDER BY `timestamp` DESC LIMIT ?, ?"
+	}
+	return c.messages(ctx, q, conv, user, conv, index, count)
+}
+
+func (c mysqlConversations) messages(ctx context.Context, q string, args ...interface{}) (messages []StoredMessage, err error) {
+	s, err := c.sc.Prepare(q)
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var message StoredMessage
+		var t string
+		var edited sql.NullString
+		if err = rows.Scan(&message.ID, &message.By, &message.Text, &t, &message.System, &edited, &message.Deleted); err != nil {
+			return
+		}
+		message.Time, err = time.Parse(mysqlTime, t)
+		if err != nil {
+			return
+		}
+		message.Edited = nullTime(edited)
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+func (c mysqlConversations) AddFile(ctx context.Context, message gp.MessageID, fileType, url, caption string) error {
+	return c.exec(ctx, "INSERT INTO conversation_files (message_id, `type`, `url`, `caption`) VALUES (?, ?, ?, ?)", message, fileType, url, caption)
+}
+
+func (c mysqlConversations) Files(ctx context.Context, user gp.UserID, conv gp.ConversationID, mode int, index int64, count int) (files []StoredFile, err error) {
+	columns := "id, `from`, text, `timestamp`, `system`, edited, deleted, `type`, `url`, `caption`"
+	visible := "FROM chat_messages JOIN conversation_files ON chat_messages.id = conversation_files.message_id " +
+		"WHERE chat_messages.conversation_id = ? " +
+		"AND chat_messages.id > (SELECT deletion_threshold FROM conversation_participants WHERE participant_id = ? AND conversation_id = ?) "
+	var q string
+	switch mode {
+	case ChronologicallyAfterID:
+		q = "SELECT " + columns + " " + visible + "AND id > ? ORDER BY `timestamp` ASC LIMIT ?"
+		q = fmt.Sprintf("SELECT %s FROM ( %s ) AS `fi` ORDER BY `timestamp` DESC, `id` DESC", columns, q)
+	case ChronologicallyBeforeID:
+		q = "SELECT " + columns + " " + visible + "AND id < ? ORDER BY `timestamp` DESC LIMIT ?"
+	default:
+		q = "SELECT " + columns + " " + visible + "ORDER BY `timestamp` DESC LIMIT ?, ?"
+	}
+	s, err := c.sc.Prepare(q)
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, conv, user, conv, index, count)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var file StoredFile
+		var t string
+		var edited, caption sql.NullString
+		err = rows.Scan(&file.Message.ID, &file.Message.By, &file.Message.Text, &t, &file.Message.System, &edited, &file.Message.Deleted, &file.Type, &file.URL, &caption)
+		if err != nil {
+			return
+		}
+		file.Message.Time, err = time.Parse(mysqlTime, t)
+		if err != nil {
+			return
+		}
+		file.Message.Edited = nullTime(edited)
+		file.Caption = caption.String
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+//unread counts the messages which user hasn't read, from after their threshold column in users; where narrows it down further.
+func (c mysqlConversations) unread(ctx context.Context, user gp.UserID, threshold, where string) (count int, err error) {
+	q := "SELECT count(*) FROM chat_messages " +
+		"JOIN conversation_participants " +
+		"ON chat_messages.conversation_id = conversation_participants.conversation_id " +
+		"JOIN conversations " +
+		"ON conversations.id = chat_messages.conversation_id " +
+		"WHERE conversation_participants.participant_id = ? " +
+		"AND chat_messages.id > conversation_participants.last_read " +
+		"AND chat_messages.id > conversation_participants.deletion_threshold " +
+		"AND chat_messages.`system` = 0 " +
+		"AND chat_messages.deleted = 0 " +
+		"AND chat_messages.`from` != conversation_participants.participant_id " +
+		"AND chat_messages.timestamp > (SELECT " + threshold + " FROM users WHERE id = ?)" + where
+	s, err := c.sc.Prepare(q)
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, user, user).Scan(&count)
+	return
+}
+
+func (c mysqlConversations) UnreadCount(ctx context.Context, user gp.UserID) (int, error) {
+	return c.unread(ctx, user, "new_message_threshold", "")
+}
+
+func (c mysqlConversations) UnreadDirectCount(ctx context.Context, user gp.UserID) (int, error) {
+	return c.unread(ctx, user, "new_message_threshold", " AND conversations.group_id IS NULL")
+}
+
+func (c mysqlConversations) UnreadGroupCount(ctx context.Context, user gp.UserID) (int, error) {
+	return c.unread(ctx, user, "group_badge_threshold", " AND conversations.group_id IS NOT NULL")
+}
+
+func (c mysqlConversations) ConversationUnread(ctx context.Context, user gp.UserID, conv gp.ConversationID) (unread int, err error) {
+	q := "SELECT COUNT(*) FROM chat_messages " +
+		"JOIN conversation_participants ON conversation_participants.conversation_id = chat_messages.conversation_id " +
+		"WHERE chat_messages.conversation_id = ? " +
+		"AND conversation_participants.participant_id = ? " +
+		"AND chat_messages.id > conversation_participants.last_read " +
+		"AND chat_messages.id > conversation_participants.deletion_threshold " +
+		"AND chat_messages.`system` = 0 " +
+		"AND chat_messages.deleted = 0 " +
+		"AND chat_messages.`from` != ?"
+	s, err := c.sc.Prepare(q)
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, conv, user, user).Scan(&unread)
+	return
+}
+
+func (c mysqlConversations) MuteBadge(ctx context.Context, user gp.UserID, t time.Time) error {
+	return c.exec(ctx, "UPDATE users SET new_message_threshold = ? WHERE id = ?", t, user)
+}
+
+func (c mysqlConversations) MuteGroupBadge(ctx context.Context, user gp.UserID, t time.Time) error {
+	return c.exec(ctx, "UPDATE users SET group_badge_threshold = ? WHERE id = ?", t, user)
+}
+
+func (c mysqlConversations) Primary(ctx context.Context, a, b gp.UserID) (conv gp.ConversationID, err error) {
+	s, err := c.sc.Prepare("SELECT conversation_id FROM conversation_participants JOIN conversations ON conversations.id = conversation_participants.conversation_id WHERE conversations.primary_conversation=1 AND participant_id IN (?, ?) GROUP BY conversation_id HAVING count(*) = 2")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, a, b).Scan(&conv)
+	return
+}
+
+func (c mysqlConversations) IsPrimary(ctx context.Context, conv gp.ConversationID) (primary bool, err error) {
+	s, err := c.sc.Prepare("SELECT primary_conversation FROM conversations WHERE id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, conv).Scan(&primary)
+	return
+}
+
+func (c mysqlConversations) MergedInto(ctx context.Context, conv gp.ConversationID) (merged gp.ConversationID, err error) {
+	s, err := c.sc.Prepare("SELECT merged FROM conversations WHERE id = ?")
+	if err != nil {
+		return
+	}
+	var m sql.NullInt64
+	err = s.QueryRowContext(ctx, conv).Scan(&m)
+	return gp.ConversationID(m.Int64), err
+}
+
+func (c mysqlConversations) Group(ctx context.Context, conv gp.ConversationID) (group gp.NetworkID, err error) {
+	s, err := c.sc.Prepare("SELECT group_id FROM conversations WHERE id = ?")
+	if err != nil {
+		return
+	}
+	var g sql.NullInt64
+	err = s.QueryRowContext(ctx, conv).Scan(&g)
+	return gp.NetworkID(g.Int64), err
+}
+
+func (c mysqlConversations) Muted(ctx context.Context, user gp.UserID, conv gp.ConversationID) (muted bool, err error) {
+	s, err := c.sc.Prepare("SELECT muted FROM conversation_participants WHERE participant_id = ? AND conversation_id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, user, conv).Scan(&muted)
+	return
+}
+
+func (c mysqlConversations) SetMuted(ctx context.Context, user gp.UserID, conv gp.ConversationID, muted bool) error {
+	return c.exec(ctx, "UPDATE conversation_participants SET muted = ? WHERE participant_id = ? AND conversation_id = ?", muted, user, conv)
+}
+
+func (c mysqlConversations) exec(ctx context.Context, q string, args ...interface{}) error {
+	s, err := c.sc.Prepare(q)
+	if err != nil {
+		return err
+	}
+	_, err = s.ExecContext(ctx, args...)
+	return err
+}
+
+//nullTime parses a nullable DATETIME column.
+func nullTime(t sql.NullString) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	parsed, err := time.Parse(mysqlTime, t.String)
+	if err != nil {
+		return nil
+	}
+	return &parsed
+}
@@ -0,0 +1,2901 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+//Memory is a Store which only lives in memory, for tests. Fill it with the Add and Set methods, then use Store().
+type Memory struct {
+	mu            sync.Mutex
+	users         map[gp.UserID]*memoryUser
+	lastUser      gp.UserID
+	sessions      map[gp.SessionID]*memorySession
+	lastSession   gp.SessionID
+	refresh       map[string]*RefreshRecord
+	verification  map[string]gp.UserID
+	recovery      map[memoryTokenKey]bool
+	posts         map[gp.PostID]*memoryPost
+	lastPost      gp.PostID
+	categories    []gp.PostCategory
+	uploads       map[gp.VideoID]memoryUpload
+	comments      []*memoryComment //Oldest first.
+	lastComment   gp.CommentID
+	reviews       map[gp.PostID][]StoredReview //Oldest first.
+	networks      map[gp.NetworkID]*memoryNetwork
+	lastNetwork   gp.NetworkID
+	members       map[gp.NetworkID]map[gp.UserID]*memoryMember
+	newPosts      map[gp.UserID]int
+	rules         []gp.Rule
+	invites       []*memoryInvite
+	fbInvites     []*memoryFacebookInvite
+	requests      map[memoryRequestKey]*memoryRequest
+	conversations map[gp.ConversationID]*memoryConversation
+	lastConv      gp.ConversationID
+	messages      []*memoryMessage                  //Oldest first.
+	edits         map[gp.MessageID][]gp.MessageEdit //Most recent first.
+	files         []memoryFile
+	notifications map[gp.NotificationID]*StoredNotification
+	actors        map[gp.NotificationID][]gp.UserID //Most recent first.
+	lastID        gp.NotificationID
+	pushes        map[uint64]*memoryPush
+	lastPush      uint64
+	deadPushes    []DeadPush
+}
+
+type memoryUser struct {
+	gp.User
+	first, last      string
+	email            string
+	admin            bool
+	greeter          bool
+	verified         bool
+	busy             bool
+	hash             []byte
+	hashVersion      int
+	desc             string
+	userType         string
+	externalID       string
+	tutorials        []string
+	messageThreshold time.Time
+	groupThreshold   time.Time
+}
+
+type memoryPost struct {
+	StoredPost
+	pending    int
+	deleted    bool
+	attribs    map[string]string
+	categories []gp.CategoryID
+	images     []string
+	videos     []gp.VideoID
+	likes      map[gp.UserID]time.Time
+	attendees  map[gp.UserID]time.Time
+}
+
+type memoryUpload struct {
+	gp.Video
+	ready bool
+}
+
+type memoryComment struct {
+	StoredComment
+	post gp.PostID
+}
+
+type memoryNetwork struct {
+	StoredNetwork
+	university         bool
+	master             gp.NetworkID
+	approvalLevel      int
+	approvedCategories sql.NullString
+}
+
+type memoryMember struct {
+	role     gp.Role
+	joined   time.Time
+	seenUpto gp.PostID
+}
+
+type memoryInvite struct {
+	network    gp.NetworkID
+	inviter    gp.UserID
+	email, key string
+	accepted   bool
+}
+
+type memoryFacebookInvite struct {
+	network  gp.NetworkID
+	inviter  gp.UserID
+	fbid     uint64
+	accepted bool
+}
+
+type memoryRequestKey struct {
+	user    gp.UserID
+	network gp.NetworkID
+}
+
+type memoryRequest struct {
+	status    string
+	processor gp.UserID
+	time      time.Time
+}
+
+type memoryTokenKey struct {
+	id    gp.UserID
+	token string
+}
+
+type memorySession struct {
+	user     gp.UserID
+	token    string
+	record   TokenRecord
+	device   string
+	created  time.Time
+	lastUsed *time.Time
+	touches  int
+}
+
+type memoryConversation struct {
+	primary      bool
+	group        gp.NetworkID
+	merged       gp.ConversationID
+	participants map[gp.UserID]*memoryParticipant
+}
+
+type memoryParticipant struct {
+	deleted           bool
+	deletionThreshold gp.MessageID
+	lastRead          gp.MessageID
+	readAt            *time.Time
+	muted             bool
+}
+
+type memoryMessage struct {
+	StoredMessage
+	conv gp.ConversationID
+}
+
+type memoryFile struct {
+	message                gp.MessageID
+	fileType, url, caption string
+}
+
+type memoryPush struct {
+	QueuedPush
+	lockedUntil time.Time
+}
+
+//QueuedPush is a push waiting in a Memory's queue.
+type QueuedPush struct {
+	PushJob
+	NextAttempt time.Time
+	LastError   string
+}
+
+//DeadPush is a push a Memory's queue gave up on.
+type DeadPush struct {
+	PushJob
+	Error    string
+	FailedAt time.Time
+}
+
+//NewMemory creates an empty Memory.
+func NewMemory() *Memory {
+	return &Memory{
+		users:         make(map[gp.UserID]*memoryUser),
+		sessions:      make(map[gp.SessionID]*memorySession),
+		refresh:       make(map[string]*RefreshRecord),
+		verification:  make(map[string]gp.UserID),
+		recovery:      make(map[memoryTokenKey]bool),
+		posts:         make(map[gp.PostID]*memoryPost),
+		uploads:       make(map[gp.VideoID]memoryUpload),
+		reviews:       make(map[gp.PostID][]StoredReview),
+		networks:      make(map[gp.NetworkID]*memoryNetwork),
+		members:       make(map[gp.NetworkID]map[gp.UserID]*memoryMember),
+		newPosts:      make(map[gp.UserID]int),
+		requests:      make(map[memoryRequestKey]*memoryRequest),
+		conversations: make(map[gp.ConversationID]*memoryConversation),
+		edits:         make(map[gp.MessageID][]gp.MessageEdit),
+		notifications: make(map[gp.NotificationID]*StoredNotification),
+		actors:        make(map[gp.NotificationID][]gp.UserID),
+		pushes:        make(map[uint64]*memoryPush),
+	}
+}
+
+//Store gives you every domain's store, all backed by m.
+func (m *Memory) Store() Store {
+	return Store{
+		Users:         memoryUsers{m},
+		Tokens:        memoryTokens{m},
+		Posts:         memoryPosts{m},
+		Approvals:     memoryApprovals{m},
+		Conversations: memoryConversations{m},
+		Networks:      memoryNetworks{m},
+		Notifications: memoryNotifications{m},
+		PushQueue:     memoryPushQueue{m},
+	}
+}
+
+//AddUser adds (or replaces) a verified user.
+func (m *Memory) AddUser(user gp.User, email string, admin bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.users[user.ID] = &memoryUser{User: user, first: user.Name, email: email, admin: admin, verified: true}
+	if user.ID > m.lastUser {
+		m.lastUser = user.ID
+	}
+}
+
+//AddToken stores a token as it would be in the database, in a new session.
+func (m *Memory) AddToken(id gp.UserID, token string, record TokenRecord) gp.SessionID {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastSession++
+	m.sessions[m.lastSession] = &memorySession{user: id, token: token, record: record, created: time.Now()}
+	return m.lastSession
+}
+
+//Touches is how many times this token has been touched.
+func (m *Memory) Touches(id gp.UserID, token string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if session := m.session(id, token); session != nil {
+		return session.touches
+	}
+	return 0
+}
+
+//AddCategory adds a category posts can be tagged with.
+func (m *Memory) AddCategory(category gp.PostCategory) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.categories = append(m.categories, category)
+}
+
+//AddUpload records that by uploaded video, which is ready to use if it has finished transcoding.
+func (m *Memory) AddUpload(by gp.UserID, video gp.Video, ready bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	video.Owner = by
+	m.uploads[video.ID] = memoryUpload{Video: video, ready: ready}
+}
+
+//SetMasterGroup makes master the group which administrates network.
+func (m *Memory) SetMasterGroup(network, master gp.NetworkID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n, ok := m.networks[network]; ok {
+		n.master = master
+	}
+}
+
+//AddMember puts user in network.
+func (m *Memory) AddMember(user gp.UserID, network gp.NetworkID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.join(user, network)
+}
+
+//SetNewPosts sets how many new posts there are in user's groups.
+func (m *Memory) SetNewPosts(user gp.UserID, count int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.newPosts[user] = count
+}
+
+//AddNotification gives recipient a new, unseen notification.
+func (m *Memory) AddNotification(recipient gp.UserID) gp.NotificationID {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastID++
+	m.notifications[m.lastID] = &StoredNotification{ID: m.lastID, Recipient: recipient, Time: time.Now()}
+	return m.lastID
+}
+
+//Notifications lists user's notifications, and whether each has been seen.
+func (m *Memory) Notifications(user gp.UserID) map[gp.NotificationID]bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seen := make(map[gp.NotificationID]bool)
+	for id, n := range m.notifications {
+		if n.Recipient == user {
+			seen[id] = n.Seen
+		}
+	}
+	return seen
+}
+
+//QueuedPushes lists the pushes waiting to be sent, oldest first.
+func (m *Memory) QueuedPushes() (queued []QueuedPush) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range m.pushes {
+		queued = append(queued, p.QueuedPush)
+	}
+	sort.Slice(queued, func(i, j int) bool { return queued[i].ID < queued[j].ID })
+	return
+}
+
+//DeadPushes lists the pushes which have been given up on.
+func (m *Memory) DeadPushes() []DeadPush {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]DeadPush(nil), m.deadPushes...)
+}
+
+//lock takes m's lock, unless ctx is already done.
+func (m *Memory) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	return nil
+}
+
+//session finds this user's session with this token. Hold the lock.
+func (m *Memory) session(id gp.UserID, token string) *memorySession {
+	for _, session := range m.sessions {
+		if session.user == id && session.token == token {
+			return session
+		}
+	}
+	return nil
+}
+
+//join puts user in network as a plain member, replacing any membership they had. Hold the lock.
+func (m *Memory) join(user gp.UserID, network gp.NetworkID) {
+	if m.members[network] == nil {
+		m.members[network] = make(map[gp.UserID]*memoryMember)
+	}
+	m.members[network][user] = &memoryMember{role: gp.Role{Name: "member", Level: 1}, joined: time.Now()}
+}
+
+//inNetworksOf is true if post is in one of user's networks. Hold the lock.
+func (m *Memory) inNetworksOf(user gp.UserID, post *memoryPost) bool {
+	_, ok := m.members[post.Network][user]
+	return ok
+}
+
+//participant finds user in conv, if they're in it. Hold the lock.
+func (m *Memory) participant(user gp.UserID, conv gp.ConversationID) (*memoryParticipant, bool) {
+	c, ok := m.conversations[conv]
+	if !ok {
+		return nil, false
+	}
+	p, ok := c.participants[user]
+	return p, ok
+}
+
+//page gives the bounds of the page of a list sorted by descending ID, in one of the paging modes.
+func page(n int, id func(i int) int64, mode int, index int64, count int) (from, to int) {
+	switch mode {
+	case ChronologicallyBeforeID:
+		from = sort.Search(n, func(i int) bool { return id(i) < index })
+		to = from + count
+	case ChronologicallyAfterID:
+		to = sort.Search(n, func(i int) bool { return id(i) <= index })
+		from = to - count
+	default:
+		from = int(index)
+		to = from + count
+	}
+	if from < 0 {
+		from = 0
+	}
+	if from > n {
+		from = n
+	}
+	if to > n {
+		to = n
+	}
+	if to < from {
+		to = from
+	}
+	return
+}
+
+type memoryUsers struct{ m *Memory }
+
+//update runs f on user id, with the lock held.
+func (u memoryUsers) update(ctx context.Context, id gp.UserID, f func(user *memoryUser)) error {
+	if err := u.m.lock(ctx); err != nil {
+		return err
+	}
+	defer u.m.mu.Unlock()
+	if user, ok := u.m.users[id]; ok {
+		f(user)
+	}
+	return nil
+}
+
+func (u memoryUsers) user(ctx context.Context, id gp.UserID) (memoryUser, error) {
+	if err := u.m.lock(ctx); err != nil {
+		return memoryUser{}, err
+	}
+	defer u.m.mu.Unlock()
+	user, ok := u.m.users[id]
+	if !ok {
+		return memoryUser{}, sql.ErrNoRows
+	}
+	return *user, nil
+}
+
+//find returns the first user matching f.
+func (u memoryUsers) find(ctx context.Context, f func(user *memoryUser) bool) (memoryUser, error) {
+	if err := u.m.lock(ctx); err != nil {
+		return memoryUser{}, err
+	}
+	defer u.m.mu.Unlock()
+	for _, user := range u.m.users {
+		if f(user) {
+			return *user, nil
+		}
+	}
+	return memoryUser{}, sql.ErrNoRows
+}
+
+func (u memoryUsers) ByID(ctx context.Context, id gp.UserID) (gp.User, error) {
+	user, err := u.user(ctx, id)
+	return user.User, err
+}
+
+func (u memoryUsers) Profile(ctx context.Context, id gp.UserID) (gp.Profile, error) {
+	user, err := u.user(ctx, id)
+	if err != nil {
+		return gp.Profile{}, err
+	}
+	profile := gp.Profile{User: user.User, Desc: user.desc, Type: user.userType, InstitutionID: user.externalID}
+	profile.Name = user.first
+	if user.last != "" {
+		profile.FullName = user.first + " " + user.last
+	}
+	return profile, nil
+}
+
+func (u memoryUsers) Email(ctx context.Context, id gp.UserID) (string, error) {
+	user, err := u.user(ctx, id)
+	return user.email, err
+}
+
+func (u memoryUsers) Details(ctx context.Context, id gp.UserID) (first, last, email string, err error) {
+	user, err := u.user(ctx, id)
+	return user.first, user.last, user.email, err
+}
+
+func (u memoryUsers) IsAdmin(ctx context.Context, id gp.UserID) (bool, error) {
+	user, err := u.user(ctx, id)
+	return user.admin, err
+}
+
+func (u memoryUsers) Admins(ctx context.Context) (admins []gp.User, err error) {
+	if err = u.m.lock(ctx); err != nil {
+		return
+	}
+	defer u.m.mu.Unlock()
+	for _, user := range u.m.users {
+		if user.admin {
+			admin := user.User
+			admin.Name = user.first
+			admins = append(admins, admin)
+		}
+	}
+	sort.Slice(admins, func(i, j int) bool { return admins[i].ID < admins[j].ID })
+	return
+}
+
+func (u memoryUsers) Greeter(ctx context.Context) (gp.UserID, error) {
+	user, err := u.find(ctx, func(user *memoryUser) bool { return user.greeter })
+	return user.ID, err
+}
+
+func (u memoryUsers) IDs(ctx context.Context) (ids []gp.UserID, err error) {
+	if err = u.m.lock(ctx); err != nil {
+		return
+	}
+	defer u.m.mu.Unlock()
+	for id := range u.m.users {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return
+}
+
+func (u memoryUsers) Emails(ctx context.Context) (emails []string, err error) {
+	ids, err := u.IDs(ctx)
+	if err != nil {
+		return
+	}
+	for _, id := range ids {
+		email, err := u.Email(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+	return
+}
+
+func (u memoryUsers) ByEmail(ctx context.Context, email string) (gp.UserID, error) {
+	user, err := u.find(ctx, func(user *memoryUser) bool { return user.email == email })
+	return user.ID, err
+}
+
+func (u memoryUsers) ByFacebook(ctx context.Context, fbid uint64) (gp.UserID, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return 0, sql.ErrNoRows
+}
+
+func (u memoryUsers) Register(ctx context.Context, first, last, email string, hash []byte, hashVersion int) (gp.UserID, error) {
+	if err := u.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer u.m.mu.Unlock()
+	for _, user := range u.m.users {
+		if user.email == email {
+			return 0, ErrExists
+		}
+	}
+	u.m.lastUser++
+	user := &memoryUser{first: first, last: last, email: email, hash: hash, hashVersion: hashVersion}
+	user.ID = u.m.lastUser
+	user.Name = strings.TrimSpace(first + " " + last)
+	u.m.users[user.ID] = user
+	return user.ID, nil
+}
+
+func (u memoryUsers) Password(ctx context.Context, id gp.UserID) ([]byte, int, error) {
+	user, err := u.user(ctx, id)
+	return user.hash, user.hashVersion, err
+}
+
+func (u memoryUsers) PasswordByEmail(ctx context.Context, email string) (gp.UserID, []byte, int, error) {
+	user, err := u.find(ctx, func(user *memoryUser) bool { return user.email == email })
+	return user.ID, user.hash, user.hashVersion, err
+}
+
+func (u memoryUsers) SetPassword(ctx context.Context, id gp.UserID, hash []byte, version int) error {
+	return u.update(ctx, id, func(user *memoryUser) {
+		user.hash, user.hashVersion = hash, version
+	})
+}
+
+func (u memoryUsers) ReplacePassword(ctx context.Context, id gp.UserID, old, hash []byte, version int) error {
+	return u.update(ctx, id, func(user *memoryUser) {
+		if string(user.hash) == string(old) {
+			user.hash, user.hashVersion = hash, version
+		}
+	})
+}
+
+func (u memoryUsers) IsVerified(ctx context.Context, id gp.UserID) (bool, error) {
+	user, err := u.user(ctx, id)
+	return user.verified, err
+}
+
+func (u memoryUsers) Verify(ctx context.Context, id gp.UserID) error {
+	return u.update(ctx, id, func(user *memoryUser) { user.verified = true })
+}
+
+func (u memoryUsers) SetName(ctx context.Context, id gp.UserID, first, last string) error {
+	return u.update(ctx, id, func(user *memoryUser) {
+		user.first, user.last = first, last
+		user.Name = strings.TrimSpace(first + " " + last)
+	})
+}
+
+func (u memoryUsers) SetAvatar(ctx context.Context, id gp.UserID, url string) error {
+	return u.update(ctx, id, func(user *memoryUser) { user.Avatar = url })
+}
+
+func (u memoryUsers) SetTagline(ctx context.Context, id gp.UserID, tagline string) error {
+	return u.update(ctx, id, func(user *memoryUser) { user.desc = tagline })
+}
+
+func (u memoryUsers) SetDirectoryEntry(ctx context.Context, id gp.UserID, userType, externalID string) error {
+	return u.update(ctx, id, func(user *memoryUser) { user.userType, user.externalID = userType, externalID })
+}
+
+func (u memoryUsers) Busy(ctx context.Context, id gp.UserID) (bool, error) {
+	user, err := u.user(ctx, id)
+	return user.busy, err
+}
+
+func (u memoryUsers) SetBusy(ctx context.Context, id gp.UserID, busy bool) error {
+	return u.update(ctx, id, func(user *memoryUser) { user.busy = busy })
+}
+
+func (u memoryUsers) TutorialState(ctx context.Context, id gp.UserID) ([]string, error) {
+	user, err := u.user(ctx, id)
+	return user.tutorials, err
+}
+
+func (u memoryUsers) SetTutorialState(ctx context.Context, id gp.UserID, tutorials []string) error {
+	return u.update(ctx, id, func(user *memoryUser) { user.tutorials = tutorials })
+}
+
+type memoryTokens struct{ m *Memory }
+
+func (t memoryTokens) Token(ctx context.Context, id gp.UserID, token string) (TokenRecord, error) {
+	if err := t.m.lock(ctx); err != nil {
+		return TokenRecord{}, err
+	}
+	defer t.m.mu.Unlock()
+	session := t.m.session(id, token)
+	if session == nil {
+		return TokenRecord{}, sql.ErrNoRows
+	}
+	return session.record, nil
+}
+
+func (t memoryTokens) AddToken(ctx context.Context, token gp.Token, device string, mfa bool) (gp.SessionID, error) {
+	if err := t.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer t.m.mu.Unlock()
+	t.m.lastSession++
+	t.m.sessions[t.m.lastSession] = &memorySession{
+		user:    token.UserID,
+		token:   token.Token,
+		record:  TokenRecord{Expiry: token.Expiry, Scopes: strings.Join(token.Scopes, ","), MFA: mfa},
+		device:  device,
+		created: time.Now(),
+	}
+	return t.m.lastSession, nil
+}
+
+func (t memoryTokens) TouchToken(ctx context.Context, id gp.UserID, token string) error {
+	if err := t.m.lock(ctx); err != nil {
+		return err
+	}
+	defer t.m.mu.Unlock()
+	if session := t.m.session(id, token); session != nil {
+		now := time.Now()
+		session.lastUsed = &now
+		session.touches++
+	}
+	return nil
+}
+
+func (t memoryTokens) MarkMFA(ctx context.Context, id gp.UserID, token string) error {
+	if err := t.m.lock(ctx); err != nil {
+		return err
+	}
+	defer t.m.mu.Unlock()
+	if session := t.m.session(id, token); session != nil {
+		session.record.MFA = true
+	}
+	return nil
+}
+
+func (t memoryTokens) ClearMFA(ctx context.Context, id gp.UserID) error {
+	if err := t.m.lock(ctx); err != nil {
+		return err
+	}
+	defer t.m.mu.Unlock()
+	for _, session := range t.m.sessions {
+		if session.user == id {
+			session.record.MFA = false
+		}
+	}
+	return nil
+}
+
+func (t memoryTokens) Sessions(ctx context.Context, id gp.UserID) (sessions []SessionRecord, err error) {
+	if err = t.m.lock(ctx); err != nil {
+		return
+	}
+	defer t.m.mu.Unlock()
+	now := time.Now()
+	for sid, session := range t.m.sessions {
+		if session.user != id || !session.record.Expiry.After(now) {
+			continue
+		}
+		sessions = append(sessions, SessionRecord{
+			ID:       sid,
+			Token:    session.token,
+			Scopes:   session.record.Scopes,
+			Device:   session.device,
+			Created:  session.created,
+			LastUsed: session.lastUsed,
+			Expiry:   session.record.Expiry,
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID > sessions[j].ID })
+	return
+}
+
+func (t memoryTokens) Session(ctx context.Context, id gp.UserID, sid gp.SessionID) (token, scopes string, err error) {
+	if err = t.m.lock(ctx); err != nil {
+		return
+	}
+	defer t.m.mu.Unlock()
+	session, ok := t.m.sessions[sid]
+	if !ok || session.user != id {
+		return "", "", sql.ErrNoRows
+	}
+	return session.token, session.record.Scopes, nil
+}
+
+func (t memoryTokens) UserTokens(ctx context.Context, id gp.UserID) (tokens []string, err error) {
+	if err = t.m.lock(ctx); err != nil {
+		return
+	}
+	defer t.m.mu.Unlock()
+	for _, session := range t.m.sessions {
+		if session.user == id {
+			tokens = append(tokens, session.token)
+		}
+	}
+	sort.Strings(tokens)
+	return
+}
+
+func (t memoryTokens) DeleteToken(ctx context.Context, id gp.UserID, token string) error {
+	if err := t.m.lock(ctx); err != nil {
+		return err
+	}
+	defer t.m.mu.Unlock()
+	for sid, session := range t.m.sessions {
+		if session.user != id || session.token != token {
+			continue
+		}
+		delete(t.m.sessions, sid)
+		for refresh, record := range t.m.refresh {
+			if record.Session == sid {
+				delete(t.m.refresh, refresh)
+			}
+		}
+	}
+	return nil
+}
+
+func (t memoryTokens) ReplaceToken(ctx context.Context, id gp.UserID, sid gp.SessionID, token string, expiry time.Time) error {
+	if err := t.m.lock(ctx); err != nil {
+		return err
+	}
+	defer t.m.mu.Unlock()
+	if session, ok := t.m.sessions[sid]; ok && session.user == id {
+		session.token = token
+		session.record.Expiry = expiry
+		session.record.Legacy = false
+	}
+	return nil
+}
+
+func (t memoryTokens) AddRefreshToken(ctx context.Context, refresh string, id gp.UserID, session gp.SessionID, expiry time.Time) error {
+	if err := t.m.lock(ctx); err != nil {
+		return err
+	}
+	defer t.m.mu.Unlock()
+	if _, ok := t.m.refresh[refresh]; ok {
+		return ErrExists
+	}
+	t.m.refresh[refresh] = &RefreshRecord{UserID: id, Session: session, Expiry: expiry}
+	return nil
+}
+
+func (t memoryTokens) RefreshToken(ctx context.Context, refresh string) (RefreshRecord, error) {
+	if err := t.m.lock(ctx); err != nil {
+		return RefreshRecord{}, err
+	}
+	defer t.m.mu.Unlock()
+	record, ok := t.m.refresh[refresh]
+	if !ok {
+		return RefreshRecord{}, sql.ErrNoRows
+	}
+	return *record, nil
+}
+
+func (t memoryTokens) UseRefreshToken(ctx context.Context, refresh string) (bool, error) {
+	if err := t.m.lock(ctx); err != nil {
+		return false, err
+	}
+	defer t.m.mu.Unlock()
+	record, ok := t.m.refresh[refresh]
+	if !ok || record.Used {
+		return false, nil
+	}
+	record.Used = true
+	return true, nil
+}
+
+func (t memoryTokens) SetVerificationToken(ctx context.Context, id gp.UserID, token string) error {
+	if err := t.m.lock(ctx); err != nil {
+		return err
+	}
+	defer t.m.mu.Unlock()
+	for old, user := range t.m.verification {
+		if user == id {
+			delete(t.m.verification, old)
+		}
+	}
+	t.m.verification[token] = id
+	return nil
+}
+
+func (t memoryTokens) VerificationToken(ctx context.Context, token string) (gp.UserID, error) {
+	if err := t.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer t.m.mu.Unlock()
+	id, ok := t.m.verification[token]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return id, nil
+}
+
+func (t memoryTokens) AddRecoveryToken(ctx context.Context, id gp.UserID, token string) error {
+	if err := t.m.lock(ctx); err != nil {
+		return err
+	}
+	defer t.m.mu.Unlock()
+	t.m.recovery[memoryTokenKey{id, token}] = true
+	return nil
+}
+
+func (t memoryTokens) RecoveryTokenExists(ctx context.Context, id gp.UserID, token string) (bool, error) {
+	if err := t.m.lock(ctx); err != nil {
+		return false, err
+	}
+	defer t.m.mu.Unlock()
+	return t.m.recovery[memoryTokenKey{id, token}], nil
+}
+
+func (t memoryTokens) DeleteRecoveryToken(ctx context.Context, id gp.UserID, token string) error {
+	if err := t.m.lock(ctx); err != nil {
+		return err
+	}
+	defer t.m.mu.Unlock()
+	delete(t.m.recovery, memoryTokenKey{id, token})
+	return nil
+}
+
+type memoryPosts struct{ m *Memory }
+
+func (p memoryPosts) post(ctx context.Context, id gp.PostID) (memoryPost, error) {
+	if err := p.m.lock(ctx); err != nil {
+		return memoryPost{}, err
+	}
+	defer p.m.mu.Unlock()
+	post, ok := p.m.posts[id]
+	if !ok {
+		return memoryPost{}, sql.ErrNoRows
+	}
+	return *post, nil
+}
+
+//update runs f on post id, if it exists, with the lock held.
+func (p memoryPosts) update(ctx context.Context, id gp.PostID, f func(post *memoryPost)) error {
+	if err := p.m.lock(ctx); err != nil {
+		return err
+	}
+	defer p.m.mu.Unlock()
+	if post, ok := p.m.posts[id]; ok {
+		f(post)
+	}
+	return nil
+}
+
+//approved lists the approved posts for which keep is true, newest first. Hold the lock.
+func (p memoryPosts) approved(category string, keep func(post *memoryPost) bool) (posts []*memoryPost) {
+	for _, post := range p.m.posts {
+		if !post.deleted && post.pending == 0 && keep(post) && (len(category) == 0 || p.inCategory(post, category)) {
+			posts = append(posts, post)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		if !posts[i].Time.Equal(posts[j].Time) {
+			return posts[i].Time.After(posts[j].Time)
+		}
+		return posts[i].ID > posts[j].ID
+	})
+	return
+}
+
+//inCategory is true if post is in the category with this tag. Hold the lock.
+func (p memoryPosts) inCategory(post *memoryPost, tag string) bool {
+	for _, c := range p.m.categories {
+		if c.Tag != tag {
+			continue
+		}
+		for _, id := range post.categories {
+			if id == c.ID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//feed returns a page of the approved posts for which keep is true, in one of the paging modes.
+func (p memoryPosts) feed(ctx context.Context, category string, mode int, index int64, count int, keep func(post *memoryPost) bool) ([]StoredPost, error) {
+	if err := p.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer p.m.mu.Unlock()
+	var posts []*memoryPost
+	for _, post := range p.approved(category, keep) {
+		switch {
+		case mode == ChronologicallyBeforeID && int64(post.ID) >= index:
+		case mode == ChronologicallyAfterID && int64(post.ID) <= index:
+		default:
+			posts = append(posts, post)
+		}
+	}
+	from := int(index)
+	switch mode {
+	case ChronologicallyBeforeID:
+		from = 0
+	case ChronologicallyAfterID:
+		from = len(posts) - count
+	}
+	return window(posts, from, count), nil
+}
+
+//window copies out count of posts, starting at from.
+func window(posts []*memoryPost, from, count int) (page []StoredPost) {
+	if from < 0 {
+		from = 0
+	}
+	for i := from; i < len(posts) && i < from+count; i++ {
+		page = append(page, posts[i].StoredPost)
+	}
+	return
+}
+
+func (p memoryPosts) Owner(ctx context.Context, id gp.PostID) (gp.UserID, error) {
+	post, err := p.post(ctx, id)
+	return post.By, err
+}
+
+func (p memoryPosts) Network(ctx context.Context, id gp.PostID) (gp.NetworkID, error) {
+	post, err := p.post(ctx, id)
+	return post.Network, err
+}
+
+func (p memoryPosts) Create(ctx context.Context, by gp.UserID, network gp.NetworkID, text string, pending bool) (gp.PostID, error) {
+	if err := p.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer p.m.mu.Unlock()
+	p.m.lastPost++
+	post := &memoryPost{
+		StoredPost: StoredPost{ID: p.m.lastPost, By: by, Time: time.Now(), Text: text, Network: network},
+		attribs:    make(map[string]string),
+		likes:      make(map[gp.UserID]time.Time),
+		attendees:  make(map[gp.UserID]time.Time),
+	}
+	if pending {
+		post.pending = 1
+	}
+	p.m.posts[post.ID] = post
+	return post.ID, nil
+}
+
+func (p memoryPosts) Post(ctx context.Context, id gp.PostID) (StoredPost, error) {
+	post, err := p.post(ctx, id)
+	if err == nil && post.deleted {
+		err = sql.ErrNoRows
+	}
+	return post.StoredPost, err
+}
+
+func (p memoryPosts) VisiblePost(ctx context.Context, id gp.PostID, viewer gp.UserID) (StoredPost, error) {
+	post, err := p.post(ctx, id)
+	if err == nil && (post.deleted || (post.pending != 0 && post.By != viewer)) {
+		err = sql.ErrNoRows
+	}
+	return post.StoredPost, err
+}
+
+func (p memoryPosts) SetText(ctx context.Context, id gp.PostID, text string) error {
+	return p.update(ctx, id, func(post *memoryPost) { post.Text = text })
+}
+
+func (p memoryPosts) Delete(ctx context.Context, id gp.PostID) error {
+	return p.update(ctx, id, func(post *memoryPost) { post.deleted = true })
+}
+
+func (p memoryPosts) NetworkPosts(ctx context.Context, viewer gp.UserID, network gp.NetworkID, category string, mode int, index int64, count int) ([]StoredPost, error) {
+	return p.feed(ctx, category, mode, index, count, func(post *memoryPost) bool { return post.Network == network })
+}
+
+func (p memoryPosts) UserPosts(ctx context.Context, perspective, by gp.UserID, category string, mode int, index int64, count int) ([]StoredPost, error) {
+	return p.feed(ctx, category, mode, index, count, func(post *memoryPost) bool {
+		return post.By == by && p.m.inNetworksOf(perspective, post)
+	})
+}
+
+func (p memoryPosts) GroupPosts(ctx context.Context, user gp.UserID, category string, mode int, index int64, count int) ([]StoredPost, error) {
+	return p.feed(ctx, category, mode, index, count, func(post *memoryPost) bool {
+		n, ok := p.m.networks[post.Network]
+		return ok && n.UserGroup && p.m.inNetworksOf(user, post)
+	})
+}
+
+func (p memoryPosts) PostCount(ctx context.Context, perspective, by gp.UserID) (int, error) {
+	if err := p.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer p.m.mu.Unlock()
+	return len(p.approved("", func(post *memoryPost) bool {
+		return post.By == by && p.m.inNetworksOf(perspective, post)
+	})), nil
+}
+
+//live lists the approved events in network which happen between after and until, soonest first. Hold the lock.
+func (p memoryPosts) live(network gp.NetworkID, after, until time.Time, category string) []*memoryPost {
+	times := make(map[gp.PostID]int64)
+	posts := p.approved(category, func(post *memoryPost) bool {
+		t, err := strconv.ParseInt(post.attribs["event-time"], 10, 64)
+		if err != nil || post.Network != network || t <= after.Unix() || t >= until.Unix() {
+			return false
+		}
+		times[post.ID] = t
+		return true
+	})
+	sort.SliceStable(posts, func(i, j int) bool { return times[posts[i].ID] < times[posts[j].ID] })
+	return posts
+}
+
+func (p memoryPosts) Live(ctx context.Context, network gp.NetworkID, after, until time.Time, category string, count int) ([]StoredPost, error) {
+	if err := p.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer p.m.mu.Unlock()
+	return window(p.live(network, after, until, category), 0, count), nil
+}
+
+func (p memoryPosts) LiveSummary(ctx context.Context, network gp.NetworkID, after, until time.Time) (gp.LiveSummary, error) {
+	if err := p.m.lock(ctx); err != nil {
+		return gp.LiveSummary{}, err
+	}
+	defer p.m.mu.Unlock()
+	events := p.live(network, after, until, "")
+	summary := gp.LiveSummary{Posts: len(events), CatCounts: make(map[string]int)}
+	for _, c := range p.m.categories {
+		for _, event := range events {
+			if p.inCategory(event, c.Tag) {
+				summary.CatCounts[c.Tag]++
+			}
+		}
+	}
+	return summary, nil
+}
+
+func (p memoryPosts) Images(ctx context.Context, id gp.PostID) ([]string, error) {
+	post, err := p.post(ctx, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return append([]string(nil), post.images...), err
+}
+
+func (p memoryPosts) AddImage(ctx context.Context, id gp.PostID, url string) error {
+	return p.update(ctx, id, func(post *memoryPost) { post.images = append(post.images, url) })
+}
+
+func (p memoryPosts) ClearImages(ctx context.Context, id gp.PostID) error {
+	return p.update(ctx, id, func(post *memoryPost) { post.images = nil })
+}
+
+func (p memoryPosts) Videos(ctx context.Context, id gp.PostID) ([]gp.Video, error) {
+	if err := p.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer p.m.mu.Unlock()
+	post, ok := p.m.posts[id]
+	if !ok {
+		return nil, nil
+	}
+	var videos []gp.Video
+	for _, v := range post.videos {
+		if upload, ok := p.m.uploads[v]; ok && upload.ready {
+			videos = append(videos, gp.Video{MP4: upload.MP4, WebM: upload.WebM, Thumbs: append([]string(nil), upload.Thumbs...)})
+		}
+	}
+	return videos, nil
+}
+
+func (p memoryPosts) AddVideo(ctx context.Context, id gp.PostID, by gp.UserID, video gp.VideoID) (ok bool, err error) {
+	err = p.update(ctx, id, func(post *memoryPost) {
+		if upload, uploaded := p.m.uploads[video]; uploaded && upload.Owner == by {
+			post.videos = append(post.videos, video)
+			ok = true
+		}
+	})
+	return
+}
+
+func (p memoryPosts) ClearVideos(ctx context.Context, id gp.PostID) error {
+	return p.update(ctx, id, func(post *memoryPost) { post.videos = nil })
+}
+
+func (p memoryPosts) Categories(ctx context.Context, id gp.PostID) ([]gp.PostCategory, error) {
+	if err := p.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer p.m.mu.Unlock()
+	post, ok := p.m.posts[id]
+	if !ok {
+		return nil, nil
+	}
+	var categories []gp.PostCategory
+	for _, c := range p.m.categories {
+		if p.inCategory(post, c.Tag) {
+			categories = append(categories, c)
+		}
+	}
+	return categories, nil
+}
+
+func (p memoryPosts) AllCategories(ctx context.Context) ([]gp.PostCategory, error) {
+	if err := p.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer p.m.mu.Unlock()
+	return append([]gp.PostCategory(nil), p.m.categories...), nil
+}
+
+func (p memoryPosts) Tag(ctx context.Context, id gp.PostID, tags ...string) error {
+	return p.update(ctx, id, func(post *memoryPost) {
+		for _, tag := range tags {
+			for _, c := range p.m.categories {
+				if c.Tag == tag && !p.inCategory(post, tag) {
+					post.categories = append(post.categories, c.ID)
+				}
+			}
+		}
+	})
+}
+
+func (p memoryPosts) ClearCategories(ctx context.Context, id gp.PostID) error {
+	return p.update(ctx, id, func(post *memoryPost) { post.categories = nil })
+}
+
+func (p memoryPosts) Attribs(ctx context.Context, id gp.PostID) (map[string]string, error) {
+	attribs := make(map[string]string)
+	err := p.update(ctx, id, func(post *memoryPost) {
+		for attrib, value := range post.attribs {
+			attribs[attrib] = value
+		}
+	})
+	return attribs, err
+}
+
+func (p memoryPosts) SetAttribs(ctx context.Context, id gp.PostID, attribs map[string]string) error {
+	return p.update(ctx, id, func(post *memoryPost) {
+		for attrib, value := range attribs {
+			post.attribs[attrib] = value
+		}
+	})
+}
+
+func (p memoryPosts) AttribValues(ctx context.Context, attrib string) (map[gp.PostID]string, error) {
+	if err := p.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer p.m.mu.Unlock()
+	values := make(map[gp.PostID]string)
+	for id, post := range p.m.posts {
+		if value, ok := post.attribs[attrib]; ok {
+			values[id] = value
+		}
+	}
+	return values, nil
+}
+
+func (p memoryPosts) Comments(ctx context.Context, id gp.PostID, start int64, count int) ([]StoredComment, error) {
+	if err := p.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer p.m.mu.Unlock()
+	var comments []StoredComment
+	for i := len(p.m.comments) - 1; i >= 0; i-- {
+		if p.m.comments[i].post == id {
+			comments = append(comments, p.m.comments[i].StoredComment)
+		}
+	}
+	from, to := page(len(comments), nil, ByOffsetDescending, start, count)
+	return comments[from:to], nil
+}
+
+func (p memoryPosts) CommentCount(ctx context.Context, id gp.PostID) (int, error) {
+	if err := p.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer p.m.mu.Unlock()
+	count := 0
+	for _, comment := range p.m.comments {
+		if comment.post == id {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (p memoryPosts) AddComment(ctx context.Context, id gp.PostID, by gp.UserID, text string) (gp.CommentID, error) {
+	if err := p.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer p.m.mu.Unlock()
+	p.m.lastComment++
+	p.m.comments = append(p.m.comments, &memoryComment{StoredComment{ID: p.m.lastComment, By: by, Text: text, Time: time.Now()}, id})
+	return p.m.lastComment, nil
+}
+
+func (p memoryPosts) Likes(ctx context.Context, id gp.PostID) ([]gp.Like, error) {
+	var likes []gp.Like
+	err := p.update(ctx, id, func(post *memoryPost) {
+		for user, t := range post.likes {
+			likes = append(likes, gp.Like{UserID: user, Time: t})
+		}
+	})
+	sort.Slice(likes, func(i, j int) bool { return likes[i].UserID < likes[j].UserID })
+	return likes, err
+}
+
+func (p memoryPosts) LikeCount(ctx context.Context, id gp.PostID) (count int, err error) {
+	err = p.update(ctx, id, func(post *memoryPost) { count = len(post.likes) })
+	return
+}
+
+func (p memoryPosts) Like(ctx context.Context, user gp.UserID, id gp.PostID) error {
+	return p.update(ctx, id, func(post *memoryPost) { post.likes[user] = time.Now() })
+}
+
+func (p memoryPosts) Unlike(ctx context.Context, user gp.UserID, id gp.PostID) error {
+	return p.update(ctx, id, func(post *memoryPost) { delete(post.likes, user) })
+}
+
+func (p memoryPosts) Attend(ctx context.Context, event gp.PostID, user gp.UserID) (changed bool, err error) {
+	err = p.update(ctx, event, func(post *memoryPost) {
+		if _, attending := post.attendees[user]; !attending {
+			post.attendees[user] = time.Now()
+			changed = true
+		}
+	})
+	return
+}
+
+func (p memoryPosts) Unattend(ctx context.Context, event gp.PostID, user gp.UserID) error {
+	return p.update(ctx, event, func(post *memoryPost) { delete(post.attendees, user) })
+}
+
+func (p memoryPosts) IsAttending(ctx context.Context, user gp.UserID, event gp.PostID) (attending bool, err error) {
+	err = p.update(ctx, event, func(post *memoryPost) { _, attending = post.attendees[user] })
+	return
+}
+
+func (p memoryPosts) AttendeeCount(ctx context.Context, event gp.PostID) (count int, err error) {
+	err = p.update(ctx, event, func(post *memoryPost) { count = len(post.attendees) })
+	return
+}
+
+func (p memoryPosts) Attendees(ctx context.Context, event gp.PostID) ([]gp.User, error) {
+	var attendees []gp.User
+	err := p.update(ctx, event, func(post *memoryPost) {
+		for id := range post.attendees {
+			if user, ok := p.m.users[id]; ok {
+				attendees = append(attendees, gp.User{ID: user.ID, Name: user.first, Avatar: user.Avatar, Official: user.Official})
+			}
+		}
+	})
+	sort.Slice(attendees, func(i, j int) bool { return attendees[i].ID < attendees[j].ID })
+	return attendees, err
+}
+
+func (p memoryPosts) UserAttends(ctx context.Context, user gp.UserID) ([]gp.PostID, error) {
+	if err := p.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer p.m.mu.Unlock()
+	var events []gp.PostID
+	for id, post := range p.m.posts {
+		if _, attending := post.attendees[user]; attending {
+			events = append(events, id)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i] < events[j] })
+	return events, nil
+}
+
+func (p memoryPosts) Attending(ctx context.Context, perspective, user gp.UserID, category string, mode int, index int64, count int) ([]StoredPost, error) {
+	if err := p.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer p.m.mu.Unlock()
+	events := p.approved(category, func(post *memoryPost) bool {
+		_, attending := post.attendees[user]
+		return attending && p.m.inNetworksOf(perspective, post)
+	})
+	sort.SliceStable(events, func(i, j int) bool { return events[i].attendees[user].After(events[j].attendees[user]) })
+	if mode == ByOffsetDescending {
+		return window(events, int(index), count), nil
+	}
+	pivot, ok := p.m.posts[gp.PostID(index)]
+	if !ok {
+		return nil, nil
+	}
+	joined, ok := pivot.attendees[user]
+	if !ok {
+		return nil, nil
+	}
+	var page []*memoryPost
+	for _, event := range events {
+		t := event.attendees[user]
+		if (mode == ChronologicallyBeforeID && t.Before(joined)) || (mode == ChronologicallyAfterID && t.After(joined)) {
+			page = append(page, event)
+		}
+	}
+	return window(page, 0, count), nil
+}
+
+func (p memoryPosts) RSVPCount(ctx context.Context, perspective, user gp.UserID) (int, error) {
+	if err := p.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer p.m.mu.Unlock()
+	return len(p.approved("", func(post *memoryPost) bool {
+		_, attending := post.attendees[user]
+		return attending && p.m.inNetworksOf(perspective, post)
+	})), nil
+}
+
+type memoryApprovals struct{ m *Memory }
+
+func (a memoryApprovals) ReviewerLevel(ctx context.Context, network gp.NetworkID, user gp.UserID) (int, error) {
+	if err := a.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer a.m.mu.Unlock()
+	n, ok := a.m.networks[network]
+	if !ok || n.master == 0 {
+		return 0, sql.ErrNoRows
+	}
+	member, ok := a.m.members[n.master][user]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return member.role.Level, nil
+}
+
+func (a memoryApprovals) Level(ctx context.Context, network gp.NetworkID) (gp.ApproveLevel, error) {
+	if err := a.m.lock(ctx); err != nil {
+		return gp.ApproveLevel{}, err
+	}
+	defer a.m.mu.Unlock()
+	n, ok := a.m.networks[network]
+	if !ok {
+		return gp.ApproveLevel{}, sql.ErrNoRows
+	}
+	level := gp.ApproveLevel{Level: n.approvalLevel, Categories: []string{}}
+	if n.approvedCategories.Valid {
+		level.Categories = strings.Split(n.approvedCategories.String, ",")
+	}
+	return level, nil
+}
+
+func (a memoryApprovals) SetLevel(ctx context.Context, network gp.NetworkID, level int, categories string) (changed bool, err error) {
+	if err = a.m.lock(ctx); err != nil {
+		return
+	}
+	defer a.m.mu.Unlock()
+	n, ok := a.m.networks[network]
+	if !ok {
+		return false, nil
+	}
+	set := sql.NullString{String: categories, Valid: true}
+	changed = n.approvalLevel != level || n.approvedCategories != set
+	n.approvalLevel, n.approvedCategories = level, set
+	return changed, nil
+}
+
+func (a memoryApprovals) Status(ctx context.Context, post gp.PostID) (int, error) {
+	if err := a.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer a.m.mu.Unlock()
+	p, ok := a.m.posts[post]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return p.pending, nil
+}
+
+//posts lists the undeleted posts for which keep is true, newest first. Hold the lock.
+func (a memoryApprovals) posts(keep func(post *memoryPost) bool) (posts []*memoryPost) {
+	for _, post := range a.m.posts {
+		if !post.deleted && keep(post) {
+			posts = append(posts, post)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		if !posts[i].Time.Equal(posts[j].Time) {
+			return posts[i].Time.After(posts[j].Time)
+		}
+		return posts[i].ID > posts[j].ID
+	})
+	return
+}
+
+func (a memoryApprovals) Pending(ctx context.Context, network gp.NetworkID) ([]StoredPost, error) {
+	if err := a.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer a.m.mu.Unlock()
+	posts := a.posts(func(post *memoryPost) bool { return post.pending == statusPending && post.Network == network })
+	return window(posts, 0, len(posts)), nil
+}
+
+func (a memoryApprovals) UserPending(ctx context.Context, by gp.UserID) ([]StoredPost, error) {
+	if err := a.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer a.m.mu.Unlock()
+	posts := a.posts(func(post *memoryPost) bool { return post.pending > 0 && post.By == by })
+	last := func(post *memoryPost) time.Time {
+		reviews := a.m.reviews[post.ID]
+		if len(reviews) == 0 {
+			return post.Time
+		}
+		return reviews[len(reviews)-1].At
+	}
+	sort.SliceStable(posts, func(i, j int) bool { return last(posts[i]).After(last(posts[j])) })
+	return window(posts, 0, len(posts)), nil
+}
+
+func (a memoryApprovals) Approved(ctx context.Context, network gp.NetworkID, mode int, index int64, count int) ([]StoredPost, error) {
+	return a.reviewed(ctx, network, statusApproved, "approved", mode, index, count)
+}
+
+func (a memoryApprovals) Rejected(ctx context.Context, network gp.NetworkID, mode int, index int64, count int) ([]StoredPost, error) {
+	return a.reviewed(ctx, network, statusRejected, "rejected", mode, index, count)
+}
+
+//reviewed returns a page of the posts in network with this status, once for each review of this action, most recent first.
+func (a memoryApprovals) reviewed(ctx context.Context, network gp.NetworkID, status int, action string, mode int, index int64, count int) ([]StoredPost, error) {
+	if err := a.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer a.m.mu.Unlock()
+	type row struct {
+		post *memoryPost
+		at   time.Time
+	}
+	var rows []row
+	for _, post := range a.posts(func(post *memoryPost) bool { return post.pending == status && post.Network == network }) {
+		for _, review := range a.m.reviews[post.ID] {
+			if review.Action == action {
+				rows = append(rows, row{post, review.At})
+			}
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].at.After(rows[j].at) })
+	from := int(index)
+	if mode != ByOffsetDescending {
+		from = 0
+		pivot, ok := a.m.posts[gp.PostID(index)]
+		if !ok {
+			return nil, nil
+		}
+		var after []row
+		for _, r := range rows {
+			if (mode == ChronologicallyBeforeID && r.post.Time.Before(pivot.Time)) || (mode == ChronologicallyAfterID && r.post.Time.After(pivot.Time)) {
+				after = append(after, r)
+			}
+		}
+		rows = after
+	}
+	var posts []*memoryPost
+	for _, r := range rows {
+		posts = append(posts, r.post)
+	}
+	return window(posts, from, count), nil
+}
+
+func (a memoryApprovals) History(ctx context.Context, post gp.PostID) ([]StoredReview, error) {
+	if err := a.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer a.m.mu.Unlock()
+	return append([]StoredReview(nil), a.m.reviews[post]...), nil
+}
+
+func (a memoryApprovals) Approve(ctx context.Context, post gp.PostID, by gp.UserID, reason string) error {
+	return a.review(ctx, post, by, "approved", reason, func(p *memoryPost) {
+		p.pending = statusApproved
+		p.Time = time.Now()
+	})
+}
+
+func (a memoryApprovals) Reject(ctx context.Context, post gp.PostID, by gp.UserID, reason string) error {
+	return a.review(ctx, post, by, "rejected", reason, func(p *memoryPost) { p.pending = statusRejected })
+}
+
+func (a memoryApprovals) Resubmit(ctx context.Context, post gp.PostID, by gp.UserID, reason string) error {
+	return a.review(ctx, post, by, "edited", reason, func(p *memoryPost) { p.pending = statusPending })
+}
+
+//review records a review of post, and runs update on it.
+func (a memoryApprovals) review(ctx context.Context, post gp.PostID, by gp.UserID, action, reason string, update func(p *memoryPost)) error {
+	if err := a.m.lock(ctx); err != nil {
+		return err
+	}
+	defer a.m.mu.Unlock()
+	a.m.reviews[post] = append(a.m.reviews[post], StoredReview{Action: action, By: by, Reason: reason, At: time.Now()})
+	if p, ok := a.m.posts[post]; ok {
+		update(p)
+	}
+	return nil
+}
+
+type memoryConversations struct{ m *Memory }
+
+//visible returns the messages user can see in conv, newest first. Hold the lock.
+func (c memoryConversations) visible(user gp.UserID, conv gp.ConversationID) (visible []*memoryMessage) {
+	p, ok := c.m.participant(user, conv)
+	if !ok {
+		return nil
+	}
+	for i := len(c.m.messages) - 1; i >= 0; i-- {
+		message := c.m.messages[i]
+		if message.conv == conv && message.ID > p.deletionThreshold {
+			visible = append(visible, message)
+		}
+	}
+	return
+}
+
+func (c memoryConversations) Create(ctx context.Context, initiator gp.UserID, primary bool, group gp.NetworkID) (gp.ConversationID, error) {
+	if err := c.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer c.m.mu.Unlock()
+	c.m.lastConv++
+	c.m.conversations[c.m.lastConv] = &memoryConversation{primary: primary, group: group, participants: make(map[gp.UserID]*memoryParticipant)}
+	return c.m.lastConv, nil
+}
+
+func (c memoryConversations) AddParticipant(ctx context.Context, conv gp.ConversationID, user gp.UserID) error {
+	if err := c.m.lock(ctx); err != nil {
+		return err
+	}
+	defer c.m.mu.Unlock()
+	conversation, ok := c.m.conversations[conv]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if _, ok = conversation.participants[user]; ok {
+		return ErrExists
+	}
+	conversation.participants[user] = &memoryParticipant{}
+	return nil
+}
+
+func (c memoryConversations) Participants(ctx context.Context, conv gp.ConversationID, includeDeleted bool) (participants []gp.UserID, err error) {
+	if err = c.m.lock(ctx); err != nil {
+		return
+	}
+	defer c.m.mu.Unlock()
+	conversation, ok := c.m.conversations[conv]
+	if !ok {
+		return
+	}
+	for user, p := range conversation.participants {
+		if _, exists := c.m.users[user]; exists && (includeDeleted || !p.deleted) {
+			participants = append(participants, user)
+		}
+	}
+	sort.Slice(participants, func(i, j int) bool { return participants[i] < participants[j] })
+	return
+}
+
+func (c memoryConversations) Contacts(ctx context.Context, user gp.UserID) (contacts []gp.UserID, err error) {
+	if err = c.m.lock(ctx); err != nil {
+		return
+	}
+	defer c.m.mu.Unlock()
+	seen := make(map[gp.UserID]bool)
+	for _, conversation := range c.m.conversations {
+		if p, ok := conversation.participants[user]; !ok || p.deleted {
+			continue
+		}
+		for contact := range conversation.participants {
+			if !seen[contact] {
+				seen[contact] = true
+				contacts = append(contacts, contact)
+			}
+		}
+	}
+	sort.Slice(contacts, func(i, j int) bool { return contacts[i] < contacts[j] })
+	return
+}
+
+func (c memoryConversations) UserConversations(ctx context.Context, user gp.UserID, start int64, count int) ([]ConversationActivity, error) {
+	if err := c.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer c.m.mu.Unlock()
+	var conversations []ConversationActivity
+	var last []gp.MessageID
+	for id, conversation := range c.m.conversations {
+		if p, ok := conversation.participants[user]; !ok || p.deleted || conversation.group != 0 {
+			continue
+		}
+		visible := c.visible(user, id)
+		if len(visible) == 0 {
+			continue
+		}
+		conversations = append(conversations, ConversationActivity{ID: id, LastActivity: visible[0].Time})
+		last = append(last, visible[0].ID)
+	}
+	sort.Sort(byActivity{conversations, last})
+	from, to := page(len(conversations), nil, ByOffsetDescending, start, count)
+	return conversations[from:to], nil
+}
+
+//byActivity sorts conversations by their last message, newest first.
+type byActivity struct {
+	conversations []ConversationActivity
+	last          []gp.MessageID
+}
+
+func (a byActivity) Len() int           { return len(a.conversations) }
+func (a byActivity) Less(i, j int) bool { return a.last[i] > a.last[j] }
+func (a byActivity) Swap(i, j int) {
+	a.conversations[i], a.conversations[j] = a.conversations[j], a.conversations[i]
+	a.last[i], a.last[j] = a.last[j], a.last[i]
+}
+
+func (c memoryConversations) Activity(ctx context.Context, user gp.UserID, conv gp.ConversationID) (time.Time, error) {
+	if err := c.m.lock(ctx); err != nil {
+		return time.Time{}, err
+	}
+	defer c.m.mu.Unlock()
+	if _, ok := c.m.participant(user, conv); ok {
+		for i := len(c.m.messages) - 1; i >= 0; i-- {
+			if c.m.messages[i].conv == conv {
+				return c.m.messages[i].Time, nil
+			}
+		}
+	}
+	return time.Time{}, sql.ErrNoRows
+}
+
+//update runs f on user's membership of conv, if they're in it, with the lock held.
+func (c memoryConversations) update(ctx context.Context, user gp.UserID, conv gp.ConversationID, f func(p *memoryParticipant)) error {
+	if err := c.m.lock(ctx); err != nil {
+		return err
+	}
+	defer c.m.mu.Unlock()
+	if p, ok := c.m.participant(user, conv); ok {
+		f(p)
+	}
+	return nil
+}
+
+func (c memoryConversations) Leave(ctx context.Context, user gp.UserID, conv gp.ConversationID) error {
+	return c.update(ctx, user, conv, func(p *memoryParticipant) { p.deleted = true })
+}
+
+//lastUpTo is the ID of conv's last message up to and including upTo, or 0. Hold the lock.
+func (c memoryConversations) lastUpTo(conv gp.ConversationID, upTo gp.MessageID) gp.MessageID {
+	for i := len(c.m.messages) - 1; i >= 0; i-- {
+		if message := c.m.messages[i]; message.conv == conv && message.ID <= upTo {
+			return message.ID
+		}
+	}
+	return 0
+}
+
+func (c memoryConversations) SetDeletionThreshold(ctx context.Context, user gp.UserID, conv gp.ConversationID, threshold gp.MessageID) error {
+	return c.update(ctx, user, conv, func(p *memoryParticipant) {
+		if p.deletionThreshold < threshold {
+			p.deletionThreshold = c.lastUpTo(conv, threshold)
+		}
+	})
+}
+
+func (c memoryConversations) DeletionThreshold(ctx context.Context, user gp.UserID, conv gp.ConversationID) (gp.MessageID, error) {
+	if err := c.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer c.m.mu.Unlock()
+	p, ok := c.m.participant(user, conv)
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return p.deletionThreshold, nil
+}
+
+func (c memoryConversations) ReadStatus(ctx context.Context, conv gp.ConversationID) (read []gp.Read, err error) {
+	if err = c.m.lock(ctx); err != nil {
+		return
+	}
+	defer c.m.mu.Unlock()
+	conversation, ok := c.m.conversations[conv]
+	if !ok {
+		return
+	}
+	for user, p := range conversation.participants {
+		read = append(read, gp.Read{UserID: user, LastRead: p.lastRead, At: p.readAt})
+	}
+	sort.Slice(read, func(i, j int) bool { return read[i].UserID < read[j].UserID })
+	return
+}
+
+func (c memoryConversations) MarkRead(ctx context.Context, user gp.UserID, conv gp.ConversationID, upTo gp.MessageID, at time.Time) (gp.MessageID, error) {
+	if err := c.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer c.m.mu.Unlock()
+	p, ok := c.m.participant(user, conv)
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	if p.lastRead < upTo {
+		p.lastRead = c.lastUpTo(conv, upTo)
+		p.readAt = &at
+	}
+	return p.lastRead, nil
+}
+
+func (c memoryConversations) AddMessage(ctx context.Context, conv gp.ConversationID, by gp.UserID, text string, system bool) (gp.MessageID, error) {
+	if err := c.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer c.m.mu.Unlock()
+	id := gp.MessageID(len(c.m.messages) + 1)
+	c.m.messages = append(c.m.messages, &memoryMessage{
+		StoredMessage: StoredMessage{ID: id, By: by, Text: text, Time: time.Now().UTC(), System: system},
+		conv:          conv,
+	})
+	return id, nil
+}
+
+func (c memoryConversations) LastMessage(ctx context.Context, conv gp.ConversationID) (StoredMessage, error) {
+	if err := c.m.lock(ctx); err != nil {
+		return StoredMessage{}, err
+	}
+	defer c.m.mu.Unlock()
+	for i := len(c.m.messages) - 1; i >= 0; i-- {
+		if c.m.messages[i].conv == conv {
+			return c.m.messages[i].StoredMessage, nil
+		}
+	}
+	return StoredMessage{}, sql.ErrNoRows
+}
+
+//message finds message id in conv. Hold the lock.
+func (c memoryConversations) message(conv gp.ConversationID, id gp.MessageID) (*memoryMessage, bool) {
+	if id < 1 || int(id) > len(c.m.messages) || c.m.messages[id-1].conv != conv {
+		return nil, false
+	}
+	return c.m.messages[id-1], true
+}
+
+//changeable finds message id in conv if by can still edit or delete it. Hold the lock.
+func (c memoryConversations) changeable(conv gp.ConversationID, id gp.MessageID, by gp.UserID, window time.Duration) (*memoryMessage, bool) {
+	message, ok := c.message(conv, id)
+	if !ok || message.By != by || message.System || message.Deleted || !message.Time.After(time.Now().Add(-window)) {
+		return nil, false
+	}
+	return message, true
+}
+
+//forgetFiles removes the files message id shared. Hold the lock.
+func (c memoryConversations) forgetFiles(id gp.MessageID) {
+	files := c.m.files[:0]
+	for _, f := range c.m.files {
+		if f.message != id {
+			files = append(files, f)
+		}
+	}
+	c.m.files = files
+}
+
+func (c memoryConversations) Message(ctx context.Context, conv gp.ConversationID, id gp.MessageID) (StoredMessage, error) {
+	if err := c.m.lock(ctx); err != nil {
+		return StoredMessage{}, err
+	}
+	defer c.m.mu.Unlock()
+	message, ok := c.message(conv, id)
+	if !ok {
+		return StoredMessage{}, sql.ErrNoRows
+	}
+	return message.StoredMessage, nil
+}
+
+func (c memoryConversations) EditMessage(ctx context.Context, conv gp.ConversationID, id gp.MessageID, by gp.UserID, text string, window time.Duration) (bool, error) {
+	if err := c.m.lock(ctx); err != nil {
+		return false, err
+	}
+	defer c.m.mu.Unlock()
+	message, ok := c.changeable(conv, id, by, window)
+	if !ok {
+		return false, nil
+	}
+	now := time.Now().UTC()
+	c.m.edits[id] = append([]gp.MessageEdit{{Text: message.Text, Time: now}}, c.m.edits[id]...)
+	message.Text = text
+	message.Edited = &now
+	c.forgetFiles(id)
+	return true, nil
+}
+
+func (c memoryConversations) DeleteMessage(ctx context.Context, conv gp.ConversationID, id gp.MessageID, by gp.UserID, window time.Duration) (bool, error) {
+	if err := c.m.lock(ctx); err != nil {
+		return false, err
+	}
+	defer c.m.mu.Unlock()
+	message, ok := c.changeable(conv, id, by, window)
+	if !ok {
+		return false, nil
+	}
+	message.Text = ""
+	message.Deleted = true
+	delete(c.m.edits, id)
+	c.forgetFiles(id)
+	return true, nil
+}
+
+func (c memoryConversations) MessageHistory(ctx context.Context, id gp.MessageID) ([]gp.MessageEdit, error) {
+	if err := c.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer c.m.mu.Unlock()
+	return append([]gp.MessageEdit(nil), c.m.edits[id]...), nil
+}
+
+func (c memoryConversations) Messages(ctx context.Context, user gp.UserID, conv gp.ConversationID, mode int, index int64, count int) (messages []StoredMessage, err error) {
+	if err = c.m.lock(ctx); err != nil {
+		return
+	}
+	defer c.m.mu.Unlock()
+	visible := c.visible(user, conv)
+	from, to := page(len(visible), func(i int) int64 { return int64(visible[i].ID) }, mode, index, count)
+	for _, message := range visible[from:to] {
+		messages = append(messages, message.StoredMessage)
+	}
+	return
+}
+
+func (c memoryConversations) AddFile(ctx context.Context, message gp.MessageID, fileType, url, caption string) error {
+	if err := c.m.lock(ctx); err != nil {
+		return err
+	}
+	defer c.m.mu.Unlock()
+	c.m.files = append(c.m.files, memoryFile{message: message, fileType: fileType, url: url, caption: caption})
+	return nil
+}
+
+func (c memoryConversations) Files(ctx context.Context, user gp.UserID, conv gp.ConversationID, mode int, index int64, count int) ([]StoredFile, error) {
+	if err := c.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer c.m.mu.Unlock()
+	var files []StoredFile
+	for _, message := range c.visible(user, conv) {
+		for i := len(c.m.files) - 1; i >= 0; i-- {
+			if f := c.m.files[i]; f.message == message.ID {
+				files = append(files, StoredFile{Message: message.StoredMessage, Type: f.fileType, URL: f.url, Caption: f.caption})
+			}
+		}
+	}
+	from, to := page(len(files), func(i int) int64 { return int64(files[i].Message.ID) }, mode, index, count)
+	return files[from:to], nil
+}
+
+//unread counts the messages user hasn't read in the conversations include picks, from after threshold. Hold the lock.
+func (c memoryConversations) unread(user gp.UserID, threshold time.Time, include func(conv *memoryConversation) bool) (count int) {
+	for _, message := range c.m.messages {
+		p, ok := c.m.participant(user, message.conv)
+		if !ok || !include(c.m.conversations[message.conv]) {
+			continue
+		}
+		if message.ID > p.lastRead && message.ID > p.deletionThreshold && !message.System && !message.Deleted && message.By != user && message.Time.After(threshold) {
+			count++
+		}
+	}
+	return
+}
+
+//unreadSince is unread, from after one of user's badge thresholds.
+func (c memoryConversations) unreadSince(ctx context.Context, user gp.UserID, group bool, include func(conv *memoryConversation) bool) (int, error) {
+	if err := c.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer c.m.mu.Unlock()
+	var threshold time.Time
+	if u, ok := c.m.users[user]; ok {
+		threshold = u.messageThreshold
+		if group {
+			threshold = u.groupThreshold
+		}
+	}
+	return c.unread(user, threshold, include), nil
+}
+
+func (c memoryConversations) UnreadCount(ctx context.Context, user gp.UserID) (int, error) {
+	return c.unreadSince(ctx, user, false, func(conv *memoryConversation) bool { return true })
+}
+
+func (c memoryConversations) UnreadDirectCount(ctx context.Context, user gp.UserID) (int, error) {
+	return c.unreadSince(ctx, user, false, func(conv *memoryConversation) bool { return conv.group == 0 })
+}
+
+func (c memoryConversations) UnreadGroupCount(ctx context.Context, user gp.UserID) (int, error) {
+	return c.unreadSince(ctx, user, true, func(conv *memoryConversation) bool { return conv.group != 0 })
+}
+
+func (c memoryConversations) ConversationUnread(ctx context.Context, user gp.UserID, conv gp.ConversationID) (int, error) {
+	if err := c.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer c.m.mu.Unlock()
+	conversation := c.m.conversations[conv]
+	return c.unread(user, time.Time{}, func(other *memoryConversation) bool { return other == conversation }), nil
+}
+
+func (c memoryConversations) MuteBadge(ctx context.Context, user gp.UserID, t time.Time) error {
+	if err := c.m.lock(ctx); err != nil {
+		return err
+	}
+	defer c.m.mu.Unlock()
+	if u, ok := c.m.users[user]; ok {
+		u.messageThreshold = t
+	}
+	return nil
+}
+
+func (c memoryConversations) MuteGroupBadge(ctx context.Context, user gp.UserID, t time.Time) error {
+	if err := c.m.lock(ctx); err != nil {
+		return err
+	}
+	defer c.m.mu.Unlock()
+	if u, ok := c.m.users[user]; ok {
+		u.groupThreshold = t
+	}
+	return nil
+}
+
+func (c memoryConversations) Primary(ctx context.Context, a, b gp.UserID) (gp.ConversationID, error) {
+	if err := c.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer c.m.mu.Unlock()
+	for id := gp.ConversationID(1); id <= c.m.lastConv; id++ {
+		conversation, ok := c.m.conversations[id]
+		if !ok || !conversation.primary {
+			continue
+		}
+		_, hasA := conversation.participants[a]
+		_, hasB := conversation.participants[b]
+		if hasA && hasB {
+			return id, nil
+		}
+	}
+	return 0, sql.ErrNoRows
+}
+
+//conversation returns a copy of conv.
+func (c memoryConversations) conversation(ctx context.Context, conv gp.ConversationID) (memoryConversation, error) {
+	if err := c.m.lock(ctx); err != nil {
+		return memoryConversation{}, err
+	}
+	defer c.m.mu.Unlock()
+	conversation, ok := c.m.conversations[conv]
+	if !ok {
+		return memoryConversation{}, sql.ErrNoRows
+	}
+	return *conversation, nil
+}
+
+func (c memoryConversations) IsPrimary(ctx context.Context, conv gp.ConversationID) (bool, error) {
+	conversation, err := c.conversation(ctx, conv)
+	return conversation.primary, err
+}
+
+func (c memoryConversations) MergedInto(ctx context.Context, conv gp.ConversationID) (gp.ConversationID, error) {
+	conversation, err := c.conversation(ctx, conv)
+	return conversation.merged, err
+}
+
+func (c memoryConversations) Group(ctx context.Context, conv gp.ConversationID) (gp.NetworkID, error) {
+	conversation, err := c.conversation(ctx, conv)
+	return conversation.group, err
+}
+
+func (c memoryConversations) Muted(ctx context.Context, user gp.UserID, conv gp.ConversationID) (bool, error) {
+	if err := c.m.lock(ctx); err != nil {
+		return false, err
+	}
+	defer c.m.mu.Unlock()
+	p, ok := c.m.participant(user, conv)
+	if !ok {
+		return false, sql.ErrNoRows
+	}
+	return p.muted, nil
+}
+
+func (c memoryConversations) SetMuted(ctx context.Context, user gp.UserID, conv gp.ConversationID, muted bool) error {
+	return c.update(ctx, user, conv, func(p *memoryParticipant) { p.muted = muted })
+}
+
+type memoryNetworks struct{ m *Memory }
+
+//network finds network id. Hold the lock.
+func (n memoryNetworks) network(id gp.NetworkID) (*memoryNetwork, error) {
+	network, ok := n.m.networks[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return network, nil
+}
+
+//get copies out network id.
+func (n memoryNetworks) get(ctx context.Context, id gp.NetworkID) (memoryNetwork, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return memoryNetwork{}, err
+	}
+	defer n.m.mu.Unlock()
+	network, err := n.network(id)
+	if err != nil {
+		return memoryNetwork{}, err
+	}
+	return *network, nil
+}
+
+//update runs f on network id, if it exists, with the lock held.
+func (n memoryNetworks) update(ctx context.Context, id gp.NetworkID, f func(network *memoryNetwork)) error {
+	if err := n.m.lock(ctx); err != nil {
+		return err
+	}
+	defer n.m.mu.Unlock()
+	if network, ok := n.m.networks[id]; ok {
+		f(network)
+	}
+	return nil
+}
+
+//sorted lists the networks for which keep is true, by ID. Hold the lock.
+func (n memoryNetworks) sorted(keep func(network *memoryNetwork) bool) (networks []*memoryNetwork) {
+	for _, network := range n.m.networks {
+		if keep(network) {
+			networks = append(networks, network)
+		}
+	}
+	sort.Slice(networks, func(i, j int) bool { return networks[i].ID < networks[j].ID })
+	return
+}
+
+//membership is user's membership of network, if they're in it. Hold the lock.
+func (n memoryNetworks) membership(user gp.UserID, network *memoryNetwork) (Membership, bool) {
+	member, ok := n.m.members[network.ID][user]
+	if !ok {
+		return Membership{}, false
+	}
+	return Membership{StoredNetwork: network.StoredNetwork, Role: member.role}, true
+}
+
+func (n memoryNetworks) IsMember(ctx context.Context, user gp.UserID, network gp.NetworkID) (bool, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return false, err
+	}
+	defer n.m.mu.Unlock()
+	_, in := n.m.members[network][user]
+	return in, nil
+}
+
+func (n memoryNetworks) NewPostCount(ctx context.Context, user gp.UserID) (int, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer n.m.mu.Unlock()
+	return n.m.newPosts[user], nil
+}
+
+func (n memoryNetworks) Creator(ctx context.Context, network gp.NetworkID) (gp.UserID, error) {
+	found, err := n.get(ctx, network)
+	return found.Creator, err
+}
+
+func (n memoryNetworks) Network(ctx context.Context, network gp.NetworkID) (StoredNetwork, error) {
+	found, err := n.get(ctx, network)
+	return found.StoredNetwork, err
+}
+
+func (n memoryNetworks) Name(ctx context.Context, network gp.NetworkID) (string, error) {
+	found, err := n.get(ctx, network)
+	return found.Name, err
+}
+
+func (n memoryNetworks) Create(ctx context.Context, network StoredNetwork) (gp.NetworkID, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer n.m.mu.Unlock()
+	n.m.lastNetwork++
+	network.ID = n.m.lastNetwork
+	n.m.networks[network.ID] = &memoryNetwork{StoredNetwork: network}
+	return network.ID, nil
+}
+
+func (n memoryNetworks) CreateUniversity(ctx context.Context, name string) (gp.NetworkID, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer n.m.mu.Unlock()
+	n.m.lastNetwork++
+	n.m.networks[n.m.lastNetwork] = &memoryNetwork{StoredNetwork: StoredNetwork{ID: n.m.lastNetwork, Name: name}, university: true}
+	return n.m.lastNetwork, nil
+}
+
+func (n memoryNetworks) IsGroup(ctx context.Context, network gp.NetworkID) (bool, error) {
+	found, err := n.get(ctx, network)
+	return found.UserGroup, err
+}
+
+func (n memoryNetworks) Parent(ctx context.Context, network gp.NetworkID) (gp.NetworkID, error) {
+	found, err := n.get(ctx, network)
+	return found.Parent, err
+}
+
+func (n memoryNetworks) SetImage(ctx context.Context, network gp.NetworkID, url string) error {
+	return n.update(ctx, network, func(network *memoryNetwork) { network.Image = url })
+}
+
+func (n memoryNetworks) MasterGroup(ctx context.Context, network gp.NetworkID) (gp.NetworkID, error) {
+	found, err := n.get(ctx, network)
+	if err == nil && found.master == 0 {
+		err = sql.ErrNoRows
+	}
+	return found.master, err
+}
+
+func (n memoryNetworks) ChildCount(ctx context.Context, network gp.NetworkID) (int, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer n.m.mu.Unlock()
+	return len(n.sorted(func(child *memoryNetwork) bool { return child.Parent == network })), nil
+}
+
+func (n memoryNetworks) Conversation(ctx context.Context, group gp.NetworkID) (gp.ConversationID, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer n.m.mu.Unlock()
+	conv, ok := n.conversation(group)
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return conv, nil
+}
+
+//conversation finds group's conversation. Hold the lock.
+func (n memoryNetworks) conversation(group gp.NetworkID) (gp.ConversationID, bool) {
+	for id, conv := range n.m.conversations {
+		if conv.group == group {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+func (n memoryNetworks) PublicUniversity(ctx context.Context, network gp.NetworkID) (gp.PublicUniversity, error) {
+	found, err := n.get(ctx, network)
+	if err == nil && (!found.university || found.UserGroup) {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		return gp.PublicUniversity{}, err
+	}
+	return gp.PublicUniversity{Network: gp.Network{ID: found.ID, Name: found.Name}, Image: found.Image, Desc: found.Desc}, nil
+}
+
+func (n memoryNetworks) University(ctx context.Context, user gp.UserID) (Membership, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return Membership{}, err
+	}
+	defer n.m.mu.Unlock()
+	for _, network := range n.sorted(func(network *memoryNetwork) bool { return network.university }) {
+		if m, ok := n.membership(user, network); ok {
+			return m, nil
+		}
+	}
+	return Membership{}, sql.ErrNoRows
+}
+
+func (n memoryNetworks) Shared(ctx context.Context, a, b gp.UserID) (bool, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return false, err
+	}
+	defer n.m.mu.Unlock()
+	for _, members := range n.m.members {
+		_, inA := members[a]
+		_, inB := members[b]
+		if inA && inB {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (n memoryNetworks) Join(ctx context.Context, user gp.UserID, network gp.NetworkID) error {
+	if err := n.m.lock(ctx); err != nil {
+		return err
+	}
+	defer n.m.mu.Unlock()
+	if _, in := n.m.members[network][user]; in {
+		return ErrExists
+	}
+	n.m.join(user, network)
+	return nil
+}
+
+func (n memoryNetworks) Leave(ctx context.Context, user gp.UserID, network gp.NetworkID) error {
+	if err := n.m.lock(ctx); err != nil {
+		return err
+	}
+	defer n.m.mu.Unlock()
+	delete(n.m.members[network], user)
+	return nil
+}
+
+func (n memoryNetworks) Role(ctx context.Context, user gp.UserID, network gp.NetworkID) (gp.Role, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return gp.Role{}, err
+	}
+	defer n.m.mu.Unlock()
+	member, ok := n.m.members[network][user]
+	if !ok {
+		return gp.Role{}, sql.ErrNoRows
+	}
+	return member.role, nil
+}
+
+func (n memoryNetworks) SetRole(ctx context.Context, user gp.UserID, network gp.NetworkID, role gp.Role) error {
+	if err := n.m.lock(ctx); err != nil {
+		return err
+	}
+	defer n.m.mu.Unlock()
+	if member, ok := n.m.members[network][user]; ok {
+		member.role = role
+	}
+	return nil
+}
+
+func (n memoryNetworks) MemberCount(ctx context.Context, network gp.NetworkID) (int, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer n.m.mu.Unlock()
+	return len(n.m.members[network]), nil
+}
+
+func (n memoryNetworks) Members(ctx context.Context, network gp.NetworkID) ([]gp.UserRole, error) {
+	return n.members(ctx, network, func(role gp.Role) bool { return true })
+}
+
+func (n memoryNetworks) Admins(ctx context.Context, network gp.NetworkID) ([]gp.UserRole, error) {
+	return n.members(ctx, network, func(role gp.Role) bool { return role.Name == "administrator" })
+}
+
+//members lists network's members whose role passes keep, by ID.
+func (n memoryNetworks) members(ctx context.Context, network gp.NetworkID, keep func(role gp.Role) bool) ([]gp.UserRole, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer n.m.mu.Unlock()
+	var members []gp.UserRole
+	for id, member := range n.m.members[network] {
+		user, ok := n.m.users[id]
+		if ok && keep(member.role) {
+			members = append(members, gp.UserRole{User: gp.User{ID: id, Name: user.first, Avatar: user.Avatar, Official: user.Official}, Role: member.role})
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	return members, nil
+}
+
+//lastActivity is when group last had a post, and a message in its conversation. Hold the lock.
+func (n memoryNetworks) lastActivity(group gp.NetworkID) (post, message time.Time) {
+	for _, p := range n.m.posts {
+		if p.Network == group && p.Time.After(post) {
+			post = p.Time
+		}
+	}
+	conv, _ := n.conversation(group)
+	for _, m := range n.m.messages {
+		if m.conv == conv && m.Time.After(message) {
+			message = m.Time
+		}
+	}
+	return
+}
+
+func (n memoryNetworks) Groups(ctx context.Context, user gp.UserID, ordering int, index int64, count int) ([]Membership, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer n.m.mu.Unlock()
+	var groups []Membership
+	for _, network := range n.sorted(func(network *memoryNetwork) bool { return network.UserGroup }) {
+		m, in := n.membership(user, network)
+		if _, hasConversation := n.conversation(network.ID); !in || !hasConversation {
+			continue
+		}
+		post, message := n.lastActivity(network.ID)
+		switch {
+		case ordering == ByPosts:
+			m.LastActivity = post
+		case ordering == ByMessages, message.After(post):
+			m.LastActivity = message
+		default:
+			m.LastActivity = post
+		}
+		groups = append(groups, m)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].LastActivity.After(groups[j].LastActivity) })
+	from, to := page(len(groups), nil, ByOffsetDescending, index, count)
+	return groups[from:to], nil
+}
+
+func (n memoryNetworks) LastActivity(ctx context.Context, group gp.NetworkID) (time.Time, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return time.Time{}, err
+	}
+	defer n.m.mu.Unlock()
+	if _, ok := n.conversation(group); !ok {
+		return time.Time{}, sql.ErrNoRows
+	}
+	post, message := n.lastActivity(group)
+	if message.After(post) {
+		return message, nil
+	}
+	return post, nil
+}
+
+func (n memoryNetworks) GroupNewPosts(ctx context.Context, user gp.UserID, group gp.NetworkID) (int, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer n.m.mu.Unlock()
+	member, ok := n.m.members[group][user]
+	if !ok {
+		return 0, nil
+	}
+	count := 0
+	for _, post := range n.m.posts {
+		if post.Network == group && post.ID > member.seenUpto && post.Time.After(member.joined) && !post.deleted && post.pending == 0 && post.By != user {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (n memoryNetworks) MarkPostsSeen(ctx context.Context, user gp.UserID, network gp.NetworkID, upTo gp.PostID) error {
+	if err := n.m.lock(ctx); err != nil {
+		return err
+	}
+	defer n.m.mu.Unlock()
+	member, ok := n.m.members[network][user]
+	if !ok {
+		return nil
+	}
+	member.seenUpto = 0
+	for id := range n.m.posts {
+		if id <= upTo && id > member.seenUpto {
+			member.seenUpto = id
+		}
+	}
+	return nil
+}
+
+//visibleGroups lists user's groups which perspective can see, with user's role in each. Hold the lock.
+func (n memoryNetworks) visibleGroups(perspective, user gp.UserID) (groups []Membership) {
+	var university gp.NetworkID
+	for _, network := range n.sorted(func(network *memoryNetwork) bool { return network.university }) {
+		if _, in := n.m.members[network.ID][perspective]; in {
+			university = network.ID
+			break
+		}
+	}
+	for _, network := range n.sorted(func(network *memoryNetwork) bool { return network.UserGroup && network.Parent == university }) {
+		_, shared := n.m.members[network.ID][perspective]
+		if m, in := n.membership(user, network); in && (network.Privacy != "secret" || shared) {
+			groups = append(groups, m)
+		}
+	}
+	return
+}
+
+func (n memoryNetworks) VisibleGroupCount(ctx context.Context, perspective, user gp.UserID) (int, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer n.m.mu.Unlock()
+	return len(n.visibleGroups(perspective, user)), nil
+}
+
+func (n memoryNetworks) VisibleGroups(ctx context.Context, perspective, user gp.UserID, index int64, count int) ([]Membership, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer n.m.mu.Unlock()
+	groups := n.visibleGroups(perspective, user)
+	from, to := page(len(groups), nil, ByOffsetDescending, index, count)
+	return groups[from:to], nil
+}
+
+func (n memoryNetworks) PopularGroups(ctx context.Context, parent gp.NetworkID, category string, index int64, count int) ([]PopularGroup, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer n.m.mu.Unlock()
+	var groups []PopularGroup
+	for _, network := range n.sorted(func(network *memoryNetwork) bool {
+		return network.UserGroup && network.Privacy != "secret" && network.Parent == parent && (len(category) == 0 || network.Category == category)
+	}) {
+		if members := len(n.m.members[network.ID]); members > 0 {
+			groups = append(groups, PopularGroup{StoredNetwork: network.StoredNetwork, Members: members})
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Members > groups[j].Members })
+	from, to := page(len(groups), nil, ByOffsetDescending, index, count)
+	return groups[from:to], nil
+}
+
+func (n memoryNetworks) Rules(ctx context.Context) ([]gp.Rule, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer n.m.mu.Unlock()
+	return append([]gp.Rule(nil), n.m.rules...), nil
+}
+
+func (n memoryNetworks) NetworkRules(ctx context.Context, network gp.NetworkID) ([]gp.Rule, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer n.m.mu.Unlock()
+	var rules []gp.Rule
+	for _, rule := range n.m.rules {
+		if child, ok := n.m.networks[rule.NetworkID]; rule.NetworkID == network || (ok && child.Parent == network) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+func (n memoryNetworks) AddRules(ctx context.Context, network gp.NetworkID, domains ...string) error {
+	if err := n.m.lock(ctx); err != nil {
+		return err
+	}
+	defer n.m.mu.Unlock()
+	for _, d := range domains {
+		n.m.rules = append(n.m.rules, gp.Rule{NetworkID: network, Type: "email", Value: d})
+	}
+	return nil
+}
+
+func (n memoryNetworks) Domain(ctx context.Context, network gp.NetworkID) (string, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return "", err
+	}
+	defer n.m.mu.Unlock()
+	for _, rule := range n.m.rules {
+		if rule.NetworkID == network && rule.Type == "email" {
+			return rule.Value, nil
+		}
+	}
+	return "", sql.ErrNoRows
+}
+
+func (n memoryNetworks) Invite(ctx context.Context, network gp.NetworkID, inviter gp.UserID, email, key string) error {
+	if err := n.m.lock(ctx); err != nil {
+		return err
+	}
+	defer n.m.mu.Unlock()
+	n.m.invites = append(n.m.invites, &memoryInvite{network: network, inviter: inviter, email: email, key: key})
+	return nil
+}
+
+func (n memoryNetworks) InviteExists(ctx context.Context, email, key string) (bool, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return false, err
+	}
+	defer n.m.mu.Unlock()
+	for _, invite := range n.m.invites {
+		if invite.email == email && invite.key == key && !invite.accepted {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (n memoryNetworks) AcceptInvites(ctx context.Context, user gp.UserID, email string) error {
+	if err := n.m.lock(ctx); err != nil {
+		return err
+	}
+	defer n.m.mu.Unlock()
+	for _, invite := range n.m.invites {
+		if invite.email != email {
+			continue
+		}
+		if !invite.accepted {
+			n.m.join(user, invite.network)
+		}
+		invite.accepted = true
+	}
+	return nil
+}
+
+func (n memoryNetworks) InviteFacebook(ctx context.Context, network gp.NetworkID, inviter gp.UserID, fbid uint64) error {
+	if err := n.m.lock(ctx); err != nil {
+		return err
+	}
+	defer n.m.mu.Unlock()
+	n.m.fbInvites = append(n.m.fbInvites, &memoryFacebookInvite{network: network, inviter: inviter, fbid: fbid})
+	return nil
+}
+
+func (n memoryNetworks) JoinFacebookInvites(ctx context.Context, user gp.UserID, fbid uint64) error {
+	if err := n.m.lock(ctx); err != nil {
+		return err
+	}
+	defer n.m.mu.Unlock()
+	for _, invite := range n.m.fbInvites {
+		if invite.fbid == fbid {
+			n.m.join(user, invite.network)
+		}
+	}
+	return nil
+}
+
+func (n memoryNetworks) AcceptFacebookInvites(ctx context.Context, fbid uint64) error {
+	if err := n.m.lock(ctx); err != nil {
+		return err
+	}
+	defer n.m.mu.Unlock()
+	for _, invite := range n.m.fbInvites {
+		if invite.fbid == fbid {
+			invite.accepted = true
+		}
+	}
+	return nil
+}
+
+func (n memoryNetworks) Request(ctx context.Context, user gp.UserID, network gp.NetworkID) error {
+	if err := n.m.lock(ctx); err != nil {
+		return err
+	}
+	defer n.m.mu.Unlock()
+	key := memoryRequestKey{user, network}
+	if _, ok := n.m.requests[key]; ok {
+		return ErrExists
+	}
+	n.m.requests[key] = &memoryRequest{status: "pending", time: time.Now()}
+	return nil
+}
+
+func (n memoryNetworks) RequestStatus(ctx context.Context, user gp.UserID, network gp.NetworkID) (string, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return "", err
+	}
+	defer n.m.mu.Unlock()
+	req, ok := n.m.requests[memoryRequestKey{user, network}]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return req.status, nil
+}
+
+func (n memoryNetworks) SetRequestStatus(ctx context.Context, user gp.UserID, network gp.NetworkID, status string, processor gp.UserID) error {
+	if err := n.m.lock(ctx); err != nil {
+		return err
+	}
+	defer n.m.mu.Unlock()
+	if req, ok := n.m.requests[memoryRequestKey{user, network}]; ok {
+		req.status, req.processor = status, processor
+	}
+	return nil
+}
+
+func (n memoryNetworks) Requests(ctx context.Context, network gp.NetworkID) ([]JoinRequest, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer n.m.mu.Unlock()
+	var requests []JoinRequest
+	for key, req := range n.m.requests {
+		if key.network == network && req.status == "pending" {
+			requests = append(requests, JoinRequest{User: key.user, Time: req.time})
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool { return requests[i].Time.Before(requests[j].Time) })
+	return requests, nil
+}
+
+type memoryNotifications struct{ m *Memory }
+
+func (n memoryNotifications) List(ctx context.Context, user gp.UserID, includeSeen bool, mode int, index int64, count int) ([]StoredNotification, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer n.m.mu.Unlock()
+	var notifications []StoredNotification
+	for _, notification := range n.m.notifications {
+		if notification.Recipient == user && (includeSeen || !notification.Seen) {
+			notifications = append(notifications, *notification)
+		}
+	}
+	sort.Slice(notifications, func(i, j int) bool { return notifications[i].ID > notifications[j].ID })
+	from, to := page(len(notifications), func(i int) int64 { return int64(notifications[i].ID) }, mode, index, count)
+	return notifications[from:to], nil
+}
+
+//create stores a copy of notification under a new ID. Hold the lock.
+func (n memoryNotifications) create(notification StoredNotification) gp.NotificationID {
+	n.m.lastID++
+	notification.ID = n.m.lastID
+	notification.Time = time.Now()
+	notification.Seen, notification.Done = false, false
+	n.m.notifications[notification.ID] = &notification
+	return notification.ID
+}
+
+//addActor makes user id's most recent actor. Hold the lock.
+func (n memoryNotifications) addActor(id gp.NotificationID, user gp.UserID) {
+	actors := []gp.UserID{user}
+	for _, actor := range n.m.actors[id] {
+		if actor != user {
+			actors = append(actors, actor)
+		}
+	}
+	n.m.actors[id] = actors
+	n.m.notifications[id].ActorCount = len(actors)
+}
+
+func (n memoryNotifications) Create(ctx context.Context, notification StoredNotification, aggregated bool) (gp.NotificationID, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer n.m.mu.Unlock()
+	notification.ActorCount = 0
+	id := n.create(notification)
+	if aggregated {
+		n.addActor(id, notification.By)
+	}
+	return id, nil
+}
+
+func (n memoryNotifications) Aggregate(ctx context.Context, notification StoredNotification, window time.Duration) (id, old gp.NotificationID, actors int, err error) {
+	if err = n.m.lock(ctx); err != nil {
+		return
+	}
+	defer n.m.mu.Unlock()
+	since := time.Now().Add(-window)
+	for oid, o := range n.m.notifications {
+		if o.Recipient == notification.Recipient && o.Type == notification.Type && o.Post == notification.Post && o.Group == notification.Group &&
+			!o.Seen && !o.Done && o.Time.After(since) && oid > old {
+			old = oid
+		}
+	}
+	if old == 0 {
+		return 0, 0, 0, sql.ErrNoRows
+	}
+	notification.ActorCount = 0
+	id = n.create(notification)
+	n.m.actors[id] = n.m.actors[old]
+	n.addActor(id, notification.By)
+	delete(n.m.notifications, old)
+	delete(n.m.actors, old)
+	return id, old, n.m.notifications[id].ActorCount, nil
+}
+
+func (n memoryNotifications) Actors(ctx context.Context, id gp.NotificationID, count int) ([]gp.UserID, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer n.m.mu.Unlock()
+	actors := n.m.actors[id]
+	if len(actors) > count {
+		actors = actors[:count]
+	}
+	return append([]gp.UserID(nil), actors...), nil
+}
+
+func (n memoryNotifications) MarkRequestsDone(ctx context.Context, network gp.NetworkID, by gp.UserID) error {
+	if err := n.m.lock(ctx); err != nil {
+		return err
+	}
+	defer n.m.mu.Unlock()
+	for _, notification := range n.m.notifications {
+		if notification.Group == network && notification.By == by && notification.Type == "group_request" {
+			notification.Done = true
+		}
+	}
+	return nil
+}
+
+func (n memoryNotifications) UnseenCount(ctx context.Context, user gp.UserID) (count int, err error) {
+	if err := n.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer n.m.mu.Unlock()
+	for _, notification := range n.m.notifications {
+		if notification.Recipient == user && !notification.Seen && !notification.Done {
+			count++
+		}
+	}
+	return
+}
+
+func (n memoryNotifications) Recipient(ctx context.Context, id gp.NotificationID) (gp.UserID, error) {
+	if err := n.m.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer n.m.mu.Unlock()
+	notification, ok := n.m.notifications[id]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return notification.Recipient, nil
+}
+
+func (n memoryNotifications) SetSeen(ctx context.Context, user gp.UserID, id gp.NotificationID, seen bool) error {
+	if err := n.m.lock(ctx); err != nil {
+		return err
+	}
+	defer n.m.mu.Unlock()
+	if notification, ok := n.m.notifications[id]; ok && notification.Recipient == user {
+		notification.Seen = seen
+	}
+	return nil
+}
+
+func (n memoryNotifications) MarkSeenUpTo(ctx context.Context, user gp.UserID, upTo gp.NotificationID) error {
+	if err := n.m.lock(ctx); err != nil {
+		return err
+	}
+	defer n.m.mu.Unlock()
+	for id, notification := range n.m.notifications {
+		if notification.Recipient == user && id <= upTo {
+			notification.Seen = true
+		}
+	}
+	return nil
+}
+
+func (n memoryNotifications) Delete(ctx context.Context, user gp.UserID, id gp.NotificationID) error {
+	if err := n.m.lock(ctx); err != nil {
+		return err
+	}
+	defer n.m.mu.Unlock()
+	if notification, ok := n.m.notifications[id]; ok && notification.Recipient == user {
+		delete(n.m.notifications, id)
+		delete(n.m.actors, id)
+	}
+	return nil
+}
+
+type memoryPushQueue struct{ m *Memory }
+
+func (q memoryPushQueue) Enqueue(ctx context.Context, application string, device gp.Device, payload string) error {
+	if err := q.m.lock(ctx); err != nil {
+		return err
+	}
+	defer q.m.mu.Unlock()
+	q.m.lastPush++
+	now := time.Now()
+	job := PushJob{ID: q.m.lastPush, Application: application, Device: device, Payload: payload, Created: now}
+	q.m.pushes[job.ID] = &memoryPush{QueuedPush: QueuedPush{PushJob: job, NextAttempt: now}}
+	return nil
+}
+
+func (q memoryPushQueue) Claim(ctx context.Context, claim string, lease time.Duration, applications []string) (PushJob, error) {
+	if err := q.m.lock(ctx); err != nil {
+		return PushJob{}, err
+	}
+	defer q.m.mu.Unlock()
+	now := time.Now()
+	var oldest *memoryPush
+	for _, p := range q.m.pushes {
+		if p.NextAttempt.After(now) || p.lockedUntil.After(now) || !contains(applications, p.Application) {
+			continue
+		}
+		if oldest == nil || p.NextAttempt.Before(oldest.NextAttempt) || (p.NextAttempt.Equal(oldest.NextAttempt) && p.ID < oldest.ID) {
+			oldest = p
+		}
+	}
+	if oldest == nil {
+		return PushJob{}, sql.ErrNoRows
+	}
+	oldest.lockedUntil = now.Add(lease)
+	return oldest.PushJob, nil
+}
+
+func (q memoryPushQueue) Retry(ctx context.Context, id uint64, attempts int, wait time.Duration, lastErr string) error {
+	if err := q.m.lock(ctx); err != nil {
+		return err
+	}
+	defer q.m.mu.Unlock()
+	if p, ok := q.m.pushes[id]; ok {
+		p.Attempts = attempts
+		p.NextAttempt = time.Now().Add(wait)
+		p.LastError = lastErr
+		p.lockedUntil = time.Time{}
+	}
+	return nil
+}
+
+func (q memoryPushQueue) DeadLetter(ctx context.Context, job PushJob, lastErr string) error {
+	if err := q.m.lock(ctx); err != nil {
+		return err
+	}
+	defer q.m.mu.Unlock()
+	q.m.deadPushes = append(q.m.deadPushes, DeadPush{PushJob: job, Error: lastErr, FailedAt: time.Now().UTC()})
+	delete(q.m.pushes, job.ID)
+	return nil
+}
+
+func (q memoryPushQueue) DeadLetters(ctx context.Context, forUser gp.UserID, limit int) ([]gp.PushFailure, error) {
+	if err := q.m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer q.m.mu.Unlock()
+	failures := make([]gp.PushFailure, 0)
+	for i := len(q.m.deadPushes) - 1; i >= 0 && len(failures) < limit; i-- {
+		d := q.m.deadPushes[i]
+		if forUser > 0 && d.Device.User != forUser {
+			continue
+		}
+		failures = append(failures, gp.PushFailure{
+			ID:          uint64(i + 1),
+			Application: d.Application,
+			User:        d.Device.User,
+			DeviceType:  d.Device.Type,
+			DeviceID:    d.Device.ID,
+			Payload:     json.RawMessage(d.Payload),
+			Attempts:    d.Attempts,
+			Error:       d.Error,
+			Created:     d.Created,
+			FailedAt:    d.FailedAt,
+		})
+	}
+	return failures, nil
+}
+
+func (q memoryPushQueue) Remove(ctx context.Context, id uint64) error {
+	if err := q.m.lock(ctx); err != nil {
+		return err
+	}
+	defer q.m.mu.Unlock()
+	delete(q.m.pushes, id)
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
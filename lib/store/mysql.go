@@ -0,0 +1,30 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/Petergatsby/GleepostAPI/lib/psc"
+	"github.com/go-sql-driver/mysql"
+)
+
+//NewMySQL gives you a Store backed by MySQL, preparing its statements with sc. Transactions run on db, and reads which can stand a little lag on replicas.
+func NewMySQL(db *sql.DB, sc *psc.StatementCache, replicas Replicas) Store {
+	return Store{
+		Users:         mysqlUsers{sc: sc},
+		Tokens:        mysqlTokens{sc: sc},
+		Posts:         mysqlPosts{sc: sc, replicas: replicas},
+		Approvals:     mysqlApprovals{db: db, sc: sc},
+		Conversations: mysqlConversations{db: db, sc: sc, replicas: replicas},
+		Networks:      mysqlNetworks{db: db, sc: sc},
+		Notifications: mysqlNotifications{db: db, sc: sc, replicas: replicas},
+		PushQueue:     mysqlPushQueue{sc: sc},
+	}
+}
+
+//duplicate turns MySQL's duplicate key error into ErrExists.
+func duplicate(err error) error {
+	if e, ok := err.(*mysql.MySQLError); ok && e.Number == 1062 {
+		return ErrExists
+	}
+	return err
+}
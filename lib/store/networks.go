@@ -0,0 +1,541 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/psc"
+)
+
+type mysqlNetworks struct {
+	db *sql.DB
+	sc *psc.StatementCache
+}
+
+//networkColumns are what scanNetwork expects, in order.
+const networkColumns = "network.id, network.name, network.parent, network.cover_img, network.`desc`, network.creator, network.user_group, network.privacy, network.category"
+
+//membershipColumns are networkColumns, followed by a member's role.
+const membershipColumns = networkColumns + ", user_network.role, user_network.role_level"
+
+//scanNetwork reads networkColumns, followed by extra.
+func scanNetwork(row interface {
+	Scan(dest ...interface{}) error
+}, extra ...interface{}) (n StoredNetwork, err error) {
+	var parent, creator sql.NullInt64
+	var img, desc, privacy, category sql.NullString
+	dest := append([]interface{}{&n.ID, &n.Name, &parent, &img, &desc, &creator, &n.UserGroup, &privacy, &category}, extra...)
+	if err = row.Scan(dest...); err != nil {
+		return
+	}
+	n.Parent = gp.NetworkID(parent.Int64)
+	n.Creator = gp.UserID(creator.Int64)
+	n.Image, n.Desc, n.Privacy, n.Category = img.String, desc.String, privacy.String, category.String
+	return n, nil
+}
+
+func (n mysqlNetworks) IsMember(ctx context.Context, user gp.UserID, network gp.NetworkID) (in bool, err error) {
+	s, err := n.sc.Prepare("SELECT COUNT(*) FROM user_network WHERE user_id = ? AND network_id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, user, network).Scan(&in)
+	return
+}
+
+func (n mysqlNetworks) NewPostCount(ctx context.Context, user gp.UserID) (count int, err error) {
+	q := "SELECT COUNT(DISTINCT wall_posts.id) FROM wall_posts " +
+		"JOIN user_network ON wall_posts.network_id = user_network.network_id " +
+		"JOIN network ON wall_posts.network_id = network.id " +
+		"WHERE user_network.user_id = ? " +
+		"AND wall_posts.id > user_network.seen_upto " +
+		"AND wall_posts.`time` > user_network.join_time " +
+		"AND wall_posts.deleted = 0 " +
+		"AND wall_posts.pending = 0 " +
+		"AND wall_posts.by != user_network.user_id " +
+		"AND network.is_university = 0 " +
+		"AND network.user_group = 1 " +
+		"AND wall_posts.`time` > (SELECT group_badge_threshold FROM users WHERE users.id = ?)"
+	s, err := n.sc.Prepare(q)
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, user, user).Scan(&count)
+	return
+}
+
+func (n mysqlNetworks) Creator(ctx context.Context, network gp.NetworkID) (creator gp.UserID, err error) {
+	s, err := n.sc.Prepare("SELECT creator FROM network WHERE id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, network).Scan(&creator)
+	return
+}
+
+func (n mysqlNetworks) Network(ctx context.Context, network gp.NetworkID) (StoredNetwork, error) {
+	s, err := n.sc.Prepare("SELECT " + networkColumns + " FROM network WHERE id = ?")
+	if err != nil {
+		return StoredNetwork{}, err
+	}
+	return scanNetwork(s.QueryRowContext(ctx, network))
+}
+
+func (n mysqlNetworks) Name(ctx context.Context, network gp.NetworkID) (name string, err error) {
+	s, err := n.sc.Prepare("SELECT name FROM network WHERE id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, network).Scan(&name)
+	return
+}
+
+func (n mysqlNetworks) Create(ctx context.Context, network StoredNetwork) (gp.NetworkID, error) {
+	return n.insert(ctx, "INSERT INTO network (name, parent, cover_img, `desc`, creator, user_group, privacy, category) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		network.Name, network.Parent, network.Image, network.Desc, network.Creator, network.UserGroup, network.Privacy, network.Category)
+}
+
+func (n mysqlNetworks) CreateUniversity(ctx context.Context, name string) (gp.NetworkID, error) {
+	return n.insert(ctx, "INSERT INTO network (name, is_university, user_group) VALUES (?, 1, 0)", name)
+}
+
+func (n mysqlNetworks) insert(ctx context.Context, q string, args ...interface{}) (id gp.NetworkID, err error) {
+	s, err := n.sc.Prepare(q)
+	if err != nil {
+		return
+	}
+	res, err := s.ExecContext(ctx, args...)
+	if err != nil {
+		return
+	}
+	_id, err := res.LastInsertId()
+	return gp.NetworkID(_id), err
+}
+
+func (n mysqlNetworks) IsGroup(ctx context.Context, network gp.NetworkID) (group bool, err error) {
+	s, err := n.sc.Prepare("SELECT user_group FROM network WHERE id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, network).Scan(&group)
+	return
+}
+
+func (n mysqlNetworks) Parent(ctx context.Context, network gp.NetworkID) (parent gp.NetworkID, err error) {
+	s, err := n.sc.Prepare("SELECT COALESCE(parent, 0) FROM network WHERE id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, network).Scan(&parent)
+	return
+}
+
+func (n mysqlNetworks) SetImage(ctx context.Context, network gp.NetworkID, url string) error {
+	return n.exec(ctx, "UPDATE network SET cover_img = ? WHERE id = ?", url, network)
+}
+
+func (n mysqlNetworks) MasterGroup(ctx context.Context, network gp.NetworkID) (master gp.NetworkID, err error) {
+	s, err := n.sc.Prepare("SELECT master_group FROM network WHERE id = ? AND master_group IS NOT NULL")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, network).Scan(&master)
+	return
+}
+
+func (n mysqlNetworks) ChildCount(ctx context.Context, network gp.NetworkID) (int, error) {
+	return n.count(ctx, "SELECT COUNT(*) FROM network WHERE parent = ?", network)
+}
+
+func (n mysqlNetworks) Conversation(ctx context.Context, group gp.NetworkID) (conv gp.ConversationID, err error) {
+	s, err := n.sc.Prepare("SELECT id FROM conversations WHERE group_id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, group).Scan(&conv)
+	return
+}
+
+func (n mysqlNetworks) PublicUniversity(ctx context.Context, network gp.NetworkID) (university gp.PublicUniversity, err error) {
+	s, err := n.sc.Prepare("SELECT name, cover_img, `desc`, shortname, appname, tagline, ios_url, android_url, covervid_mp4, covervid_webm FROM network WHERE id = ? AND user_group = 0 AND is_university = 1")
+	if err != nil {
+		return
+	}
+	var coverImg, desc, shortname, appname, tagline, iosURL, androidURL, mp4, webm sql.NullString
+	err = s.QueryRowContext(ctx, network).Scan(&university.Name, &coverImg, &desc, &shortname, &appname, &tagline, &iosURL, &androidURL, &mp4, &webm)
+	if err != nil {
+		return
+	}
+	university.ID = network
+	university.Image, university.Desc = coverImg.String, desc.String
+	university.ShortName, university.AppName, university.TagLine = shortname.String, appname.String, tagline.String
+	university.IosURL, university.AndroidURL = iosURL.String, androidURL.String
+	university.Video.MP4, university.Video.WebM = mp4.String, webm.String
+	return
+}
+
+func (n mysqlNetworks) University(ctx context.Context, user gp.UserID) (m Membership, err error) {
+	s, err := n.sc.Prepare("SELECT " + membershipColumns + " FROM user_network JOIN network ON user_network.network_id = network.id WHERE user_network.user_id = ? AND network.is_university = 1")
+	if err != nil {
+		return
+	}
+	m.StoredNetwork, err = scanNetwork(s.QueryRowContext(ctx, user), &m.Role.Name, &m.Role.Level)
+	return
+}
+
+func (n mysqlNetworks) Shared(ctx context.Context, a, b gp.UserID) (shared bool, err error) {
+	s, err := n.sc.Prepare("SELECT COUNT(*) > 0 FROM user_network WHERE user_id = ? AND network_id IN (SELECT network_id FROM user_network WHERE user_id = ?)")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, a, b).Scan(&shared)
+	return
+}
+
+func (n mysqlNetworks) Join(ctx context.Context, user gp.UserID, network gp.NetworkID) error {
+	return duplicate(n.exec(ctx, "INSERT INTO user_network (user_id, network_id) VALUES (?, ?)", user, network))
+}
+
+func (n mysqlNetworks) Leave(ctx context.Context, user gp.UserID, network gp.NetworkID) error {
+	return n.exec(ctx, "DELETE FROM user_network WHERE user_id = ? AND network_id = ?", user, network)
+}
+
+func (n mysqlNetworks) Role(ctx context.Context, user gp.UserID, network gp.NetworkID) (role gp.Role, err error) {
+	s, err := n.sc.Prepare("SELECT role, role_level FROM user_network WHERE user_id = ? AND network_id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, user, network).Scan(&role.Name, &role.Level)
+	return
+}
+
+func (n mysqlNetworks) SetRole(ctx context.Context, user gp.UserID, network gp.NetworkID, role gp.Role) error {
+	return n.exec(ctx, "UPDATE user_network SET role = ?, role_level = ? WHERE user_id = ? AND network_id = ?", role.Name, role.Level, user, network)
+}
+
+func (n mysqlNetworks) MemberCount(ctx context.Context, network gp.NetworkID) (int, error) {
+	return n.count(ctx, "SELECT COUNT(*) FROM user_network WHERE network_id = ?", network)
+}
+
+//memberQuery selects a network's members, with their roles.
+const memberQuery = "SELECT user_id, users.avatar, users.firstname, users.official, user_network.role, user_network.role_level FROM user_network JOIN users ON user_network.user_id = users.id WHERE user_network.network_id = ?"
+
+func (n mysqlNetworks) Members(ctx context.Context, network gp.NetworkID) ([]gp.UserRole, error) {
+	return n.members(ctx, memberQuery, network)
+}
+
+func (n mysqlNetworks) Admins(ctx context.Context, network gp.NetworkID) ([]gp.UserRole, error) {
+	return n.members(ctx, memberQuery+" AND user_network.role = 'administrator'", network)
+}
+
+func (n mysqlNetworks) members(ctx context.Context, q string, args ...interface{}) (members []gp.UserRole, err error) {
+	s, err := n.sc.Prepare(q)
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var member gp.UserRole
+		var avatar sql.NullString
+		if err = rows.Scan(&member.ID, &avatar, &member.User.Name, &member.User.Official, &member.Role.Name, &member.Role.Level); err != nil {
+			return
+		}
+		member.Avatar = avatar.String
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+//Each ordering's last_activity column, in Groups.
+var (
+	lastMessage = "COALESCE((SELECT MAX(`timestamp`) FROM chat_messages WHERE conversation_id = conversations.id), '0000-00-00 00:00:00')"
+	lastPost    = "COALESCE((SELECT MAX(`time`) FROM wall_posts WHERE network_id = network.id), '0000-00-00 00:00:00')"
+	orderings   = map[int]string{
+		ByPosts:    lastPost,
+		ByMessages: lastMessage,
+		ByActivity: "GREATEST(" + lastMessage + ", " + lastPost + ")",
+	}
+)
+
+func (n mysqlNetworks) Groups(ctx context.Context, user gp.UserID, ordering int, index int64, count int) (groups []Membership, err error) {
+	q := "SELECT " + membershipColumns + ", " + orderings[ordering] + " AS last_activity " +
+		"FROM user_network " +
+		"JOIN network ON user_network.network_id = network.id " +
+		"JOIN conversations ON conversations.group_id = network.id " +
+		"WHERE user_id = ? " +
+		"AND network.user_group = 1 " +
+		"ORDER BY last_activity DESC LIMIT ?, ?"
+	s, err := n.sc.Prepare(q)
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, user, index, count)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m Membership
+		var last string
+		m.StoredNetwork, err = scanNetwork(rows, &m.Role.Name, &m.Role.Level, &last)
+		if err != nil {
+			return
+		}
+		m.LastActivity, _ = time.Parse(mysqlTime, last)
+		groups = append(groups, m)
+	}
+	return groups, rows.Err()
+}
+
+func (n mysqlNetworks) LastActivity(ctx context.Context, group gp.NetworkID) (last time.Time, err error) {
+	s, err := n.sc.Prepare("SELECT " + orderings[ByActivity] + " FROM network JOIN conversations ON conversations.group_id = network.id WHERE network.id = ?")
+	if err != nil {
+		return
+	}
+	var t string
+	if err = s.QueryRowContext(ctx, group).Scan(&t); err != nil {
+		return
+	}
+	last, _ = time.Parse(mysqlTime, t)
+	return
+}
+
+func (n mysqlNetworks) GroupNewPosts(ctx context.Context, user gp.UserID, group gp.NetworkID) (int, error) {
+	q := "SELECT COUNT(DISTINCT id) FROM wall_posts " +
+		"JOIN user_network ON wall_posts.network_id = user_network.network_id " +
+		"WHERE wall_posts.network_id = ? " +
+		"AND user_network.user_id = ? " +
+		"AND wall_posts.id > user_network.seen_upto " +
+		"AND wall_posts.`time` > user_network.join_time " +
+		"AND wall_posts.deleted = 0 " +
+		"AND wall_posts.pending = 0 " +
+		"AND wall_posts.by != user_network.user_id "
+	return n.count(ctx, q, group, user)
+}
+
+func (n mysqlNetworks) MarkPostsSeen(ctx context.Context, user gp.UserID, network gp.NetworkID, upTo gp.PostID) error {
+	return n.exec(ctx, "UPDATE user_network SET seen_upto = (SELECT MAX(id) FROM wall_posts WHERE id <= ?) WHERE user_id = ? AND network_id = ?", upTo, user, network)
+}
+
+//visibleGroups is where user (the third argument) is in a group which perspective (the first two) can see.
+const visibleGroups = "WHERE user_group = 1 AND parent = (SELECT network_id FROM user_network WHERE user_id = ? LIMIT 1) " +
+	"AND (privacy != 'secret' OR network.id IN (SELECT network_id FROM user_network WHERE user_id = ?)) " +
+	"AND user_network.user_id = ? "
+
+func (n mysqlNetworks) VisibleGroupCount(ctx context.Context, perspective, user gp.UserID) (int, error) {
+	return n.count(ctx, "SELECT COUNT(*) FROM user_network JOIN network ON user_network.network_id = network.id "+visibleGroups, perspective, perspective, user)
+}
+
+func (n mysqlNetworks) VisibleGroups(ctx context.Context, perspective, user gp.UserID, index int64, count int) (groups []Membership, err error) {
+	s, err := n.sc.Prepare("SELECT " + membershipColumns + " FROM user_network JOIN network ON user_network.network_id = network.id " + visibleGroups + "LIMIT ?, ?")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, perspective, perspective, user, index, count)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m Membership
+		m.StoredNetwork, err = scanNetwork(rows, &m.Role.Name, &m.Role.Level)
+		if err != nil {
+			return
+		}
+		groups = append(groups, m)
+	}
+	return groups, rows.Err()
+}
+
+func (n mysqlNetworks) PopularGroups(ctx context.Context, parent gp.NetworkID, category string, index int64, count int) (groups []PopularGroup, err error) {
+	q := "SELECT " + networkColumns + ", COUNT(user_id) AS cnt " +
+		"FROM network " +
+		"JOIN user_network ON network.id = user_network.network_id " +
+		"WHERE user_group = 1 " +
+		"AND privacy != 'secret' " +
+		"AND parent = ? "
+	args := []interface{}{parent}
+	if len(category) > 0 {
+		q += "AND category = ? "
+		args = append(args, category)
+	}
+	q += "GROUP BY network.id ORDER BY cnt DESC, id ASC LIMIT ?, ?"
+	s, err := n.sc.Prepare(q)
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, append(args, index, count)...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var g PopularGroup
+		g.StoredNetwork, err = scanNetwork(rows, &g.Members)
+		if err != nil {
+			return
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+func (n mysqlNetworks) Rules(ctx context.Context) ([]gp.Rule, error) {
+	return n.rules(ctx, "SELECT network_id, rule_type, rule_value FROM net_rules")
+}
+
+func (n mysqlNetworks) NetworkRules(ctx context.Context, network gp.NetworkID) ([]gp.Rule, error) {
+	return n.rules(ctx, "SELECT network_id, rule_type, rule_value FROM net_rules WHERE network_id = ? OR network_id IN (SELECT id FROM network WHERE parent = ?)", network, network)
+}
+
+func (n mysqlNetworks) rules(ctx context.Context, q string, args ...interface{}) (rules []gp.Rule, err error) {
+	s, err := n.sc.Prepare(q)
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rule gp.Rule
+		if err = rows.Scan(&rule.NetworkID, &rule.Type, &rule.Value); err != nil {
+			return
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func (n mysqlNetworks) AddRules(ctx context.Context, network gp.NetworkID, domains ...string) (err error) {
+	s, err := n.sc.Prepare("INSERT INTO net_rules (network_id, rule_type, rule_value) VALUES (?, 'email', ?)")
+	if err != nil {
+		return
+	}
+	for _, d := range domains {
+		if _, err = s.ExecContext(ctx, network, d); err != nil {
+			return
+		}
+	}
+	return nil
+}
+
+func (n mysqlNetworks) Domain(ctx context.Context, network gp.NetworkID) (domain string, err error) {
+	s, err := n.sc.Prepare("SELECT rule_value FROM net_rules WHERE rule_type = 'email' AND network_id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, network).Scan(&domain)
+	return
+}
+
+func (n mysqlNetworks) Invite(ctx context.Context, network gp.NetworkID, inviter gp.UserID, email, key string) error {
+	return n.exec(ctx, "INSERT INTO group_invites (group_id, inviter, email, `key`) VALUES (?, ?, ?, ?)", network, inviter, email, key)
+}
+
+func (n mysqlNetworks) InviteExists(ctx context.Context, email, key string) (bool, error) {
+	count, err := n.count(ctx, "SELECT COUNT(*) FROM group_invites WHERE `email` = ? AND `key` = ? AND `accepted` = 0", email, key)
+	return count > 0, err
+}
+
+func (n mysqlNetworks) AcceptInvites(ctx context.Context, user gp.UserID, email string) (err error) {
+	tx, err := n.db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+		}
+	}()
+	_, err = tx.ExecContext(ctx, "REPLACE INTO user_network (user_id, network_id) SELECT ?, group_id FROM group_invites WHERE email = ? AND accepted = 0", user, email)
+	if err != nil {
+		return
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE group_invites SET accepted = 1 WHERE email = ?", email)
+	if err != nil {
+		return
+	}
+	err = tx.Commit()
+	committed = err == nil
+	return
+}
+
+func (n mysqlNetworks) InviteFacebook(ctx context.Context, network gp.NetworkID, inviter gp.UserID, fbid uint64) error {
+	return n.exec(ctx, "INSERT INTO fb_group_invites (inviter_user_id, facebook_id, network_id) VALUES (?, ?, ?)", inviter, fbid, network)
+}
+
+func (n mysqlNetworks) JoinFacebookInvites(ctx context.Context, user gp.UserID, fbid uint64) error {
+	return n.exec(ctx, "REPLACE INTO user_network (user_id, network_id) SELECT ?, network_id FROM fb_group_invites WHERE facebook_id = ?", user, fbid)
+}
+
+func (n mysqlNetworks) AcceptFacebookInvites(ctx context.Context, fbid uint64) error {
+	return n.exec(ctx, "UPDATE fb_group_invites SET accepted = 1 WHERE facebook_id = ?", fbid)
+}
+
+func (n mysqlNetworks) Request(ctx context.Context, user gp.UserID, network gp.NetworkID) error {
+	return duplicate(n.exec(ctx, "INSERT INTO network_requests(user_id, network_id) VALUES (?, ?)", user, network))
+}
+
+func (n mysqlNetworks) RequestStatus(ctx context.Context, user gp.UserID, network gp.NetworkID) (status string, err error) {
+	s, err := n.sc.Prepare("SELECT status FROM network_requests WHERE user_id = ? AND network_id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, user, network).Scan(&status)
+	return
+}
+
+func (n mysqlNetworks) SetRequestStatus(ctx context.Context, user gp.UserID, network gp.NetworkID, status string, processor gp.UserID) error {
+	return n.exec(ctx, "UPDATE network_requests SET status = ?, processed_by = ? WHERE user_id = ? AND network_id = ?", status, processor, user, network)
+}
+
+func (n mysqlNetworks) Requests(ctx context.Context, network gp.NetworkID) (requests []JoinRequest, err error) {
+	s, err := n.sc.Prepare("SELECT user_id, request_time FROM network_requests WHERE network_id = ? AND status = 'pending'")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, network)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var req JoinRequest
+		var t string
+		if err = rows.Scan(&req.User, &t); err != nil {
+			return
+		}
+		if req.Time, err = time.Parse(mysqlTime, t); err != nil {
+			return
+		}
+		requests = append(requests, req)
+	}
+	return requests, rows.Err()
+}
+
+func (n mysqlNetworks) count(ctx context.Context, q string, args ...interface{}) (count int, err error) {
+	s, err := n.sc.Prepare(q)
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, args...).Scan(&count)
+	return
+}
+
+func (n mysqlNetworks) exec(ctx context.Context, q string, args ...interface{}) error {
+	s, err := n.sc.Prepare(q)
+	if err != nil {
+		return err
+	}
+	_, err = s.ExecContext(ctx, args...)
+	return err
+}
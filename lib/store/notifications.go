@@ -0,0 +1,224 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/psc"
+)
+
+type mysqlNotifications struct {
+	db       *sql.DB
+	sc       *psc.StatementCache
+	replicas Replicas
+}
+
+func (n mysqlNotifications) List(ctx context.Context, user gp.UserID, includeSeen bool, mode int, index int64, count int) (notifications []StoredNotification, err error) {
+	q := "SELECT id, type, time, `by`, post_id, network_id, preview_text, seen, done, actor_count FROM notifications WHERE recipient = ?"
+	if !includeSeen {
+		q += " AND seen = 0"
+	}
+	switch {
+	case mode == ChronologicallyAfterID:
+		q = "SELECT `id`, `type`, `time`, `by`, `post_id`, `network_id`, `preview_text`, `seen`, `done`, `actor_count` FROM (" + q + " AND notifications.id > ? ORDER BY `id` ASC LIMIT ?) AS `wp` ORDER BY `id` DESC"
+	case mode == ChronologicallyBeforeID:
+		q += " AND notifications.id < ? ORDER BY `id` DESC LIMIT ?"
+	default:
+		q += " ORDER BY `id` DESC LIMIT ?"
+	}
+	s, err := n.replicas.PrepareFor(ctx, user, q)
+	if err != nil {
+		return
+	}
+	var rows *sql.Rows
+	if mode == ByOffsetDescending {
+		rows, err = s.QueryContext(ctx, user, count)
+	} else {
+		rows, err = s.QueryContext(ctx, user, index, count)
+	}
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		notification := StoredNotification{Recipient: user}
+		var t string
+		var postID, netID sql.NullInt64
+		var preview sql.NullString
+		if err = rows.Scan(&notification.ID, &notification.Type, &t, &notification.By, &postID, &netID, &preview, &notification.Seen, &notification.Done, &notification.ActorCount); err != nil {
+			return
+		}
+		notification.Time, err = time.Parse(mysqlTime, t)
+		if err != nil {
+			return
+		}
+		notification.Post = gp.PostID(postID.Int64)
+		notification.Group = gp.NetworkID(netID.Int64)
+		notification.Preview = preview.String
+		notifications = append(notifications, notification)
+	}
+	return notifications, rows.Err()
+}
+
+func (n mysqlNotifications) Create(ctx context.Context, notification StoredNotification, aggregated bool) (id gp.NotificationID, err error) {
+	s, err := n.sc.Prepare("INSERT INTO notifications (type, time, `by`, recipient, post_id, network_id, preview_text) VALUES (?, NOW(), ?, ?, ?, ?, ?)")
+	if err != nil {
+		return
+	}
+	res, err := s.ExecContext(ctx, notification.Type, notification.By, notification.Recipient, notification.Post, notification.Group, notification.Preview)
+	if err != nil {
+		return
+	}
+	_id, err := res.LastInsertId()
+	if err != nil {
+		return
+	}
+	id = gp.NotificationID(_id)
+	if !aggregated {
+		return
+	}
+	s, err = n.sc.Prepare("INSERT INTO notification_actors (notification_id, user_id, time) VALUES (?, ?, NOW()) ON DUPLICATE KEY UPDATE time = NOW()")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, id, notification.By)
+	return
+}
+
+func (n mysqlNotifications) Aggregate(ctx context.Context, notification StoredNotification, window time.Duration) (id, old gp.NotificationID, actors int, err error) {
+	tx, err := n.db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+		}
+	}()
+	err = tx.QueryRowContext(ctx, "SELECT id FROM notifications WHERE recipient = ? AND type = ? AND post_id = ? AND network_id = ? AND seen = 0 AND done = 0 AND time > NOW() - INTERVAL ? SECOND ORDER BY id DESC LIMIT 1 FOR UPDATE",
+		notification.Recipient, notification.Type, notification.Post, notification.Group, int(window.Seconds())).Scan(&old)
+	if err != nil {
+		return
+	}
+	res, err := tx.ExecContext(ctx, "INSERT INTO notifications (type, time, `by`, recipient, post_id, network_id, preview_text) VALUES (?, NOW(), ?, ?, ?, ?, ?)",
+		notification.Type, notification.By, notification.Recipient, notification.Post, notification.Group, notification.Preview)
+	if err != nil {
+		return
+	}
+	_id, err := res.LastInsertId()
+	if err != nil {
+		return
+	}
+	id = gp.NotificationID(_id)
+	_, err = tx.ExecContext(ctx, "UPDATE notification_actors SET notification_id = ? WHERE notification_id = ?", id, old)
+	if err != nil {
+		return
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO notification_actors (notification_id, user_id, time) VALUES (?, ?, NOW()) ON DUPLICATE KEY UPDATE time = NOW()", id, notification.By)
+	if err != nil {
+		return
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE notifications SET actor_count = (SELECT COUNT(*) FROM notification_actors WHERE notification_id = ?) WHERE id = ?", id, id)
+	if err != nil {
+		return
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM notifications WHERE id = ?", old)
+	if err != nil {
+		return
+	}
+	err = tx.QueryRowContext(ctx, "SELECT actor_count FROM notifications WHERE id = ?", id).Scan(&actors)
+	if err != nil {
+		return
+	}
+	err = tx.Commit()
+	committed = err == nil
+	return
+}
+
+func (n mysqlNotifications) Actors(ctx context.Context, id gp.NotificationID, count int) (actors []gp.UserID, err error) {
+	s, err := n.sc.Prepare("SELECT user_id FROM notification_actors WHERE notification_id = ? ORDER BY time DESC LIMIT ?")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, id, count)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var user gp.UserID
+		if err = rows.Scan(&user); err != nil {
+			return
+		}
+		actors = append(actors, user)
+	}
+	return actors, rows.Err()
+}
+
+func (n mysqlNotifications) MarkRequestsDone(ctx context.Context, network gp.NetworkID, by gp.UserID) (err error) {
+	s, err := n.sc.Prepare("UPDATE notifications SET done = 1 WHERE network_id = ? AND `by` = ? AND type = 'group_request'")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, network, by)
+	return
+}
+
+func (n mysqlNotifications) UnseenCount(ctx context.Context, user gp.UserID) (count int, err error) {
+	s, err := n.sc.Prepare("SELECT COUNT(*) FROM notifications WHERE recipient = ? AND seen = 0 AND done = 0")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, user).Scan(&count)
+	return
+}
+
+func (n mysqlNotifications) Recipient(ctx context.Context, id gp.NotificationID) (recipient gp.UserID, err error) {
+	s, err := n.sc.Prepare("SELECT recipient FROM notifications WHERE id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, id).Scan(&recipient)
+	return
+}
+
+func (n mysqlNotifications) SetSeen(ctx context.Context, user gp.UserID, id gp.NotificationID, seen bool) (err error) {
+	s, err := n.sc.Prepare("UPDATE notifications SET seen = ? WHERE id = ? AND recipient = ?")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, seen, id, user)
+	return
+}
+
+func (n mysqlNotifications) MarkSeenUpTo(ctx context.Context, user gp.UserID, upTo gp.NotificationID) (err error) {
+	s, err := n.sc.Prepare("UPDATE notifications SET seen = 1 WHERE recipient = ? AND id <= ?")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, user, upTo)
+	return
+}
+
+func (n mysqlNotifications) Delete(ctx context.Context, user gp.UserID, id gp.NotificationID) (err error) {
+	s, err := n.sc.Prepare("DELETE FROM notifications WHERE id = ? AND recipient = ?")
+	if err != nil {
+		return
+	}
+	res, err := s.ExecContext(ctx, id, user)
+	if err != nil {
+		return
+	}
+	if deleted, _ := res.RowsAffected(); deleted == 0 {
+		return
+	}
+	s, err = n.sc.Prepare("DELETE FROM notification_actors WHERE notification_id = ?")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, id)
+	return
+}
@@ -0,0 +1,589 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/psc"
+)
+
+type mysqlPosts struct {
+	sc       *psc.StatementCache
+	replicas Replicas
+}
+
+const (
+	//postColumns are what scanPosts expects, in order.
+	postColumns = "wall_posts.id, wall_posts.`by`, wall_posts.`time`, wall_posts.text, wall_posts.network_id "
+
+	categoryJoin = "JOIN post_categories ON wall_posts.id = post_categories.post_id " +
+		"JOIN categories ON post_categories.category_id = categories.id "
+	attendJoin = "JOIN event_attendees ON wall_posts.id = event_attendees.post_id "
+
+	approved      = "WHERE wall_posts.deleted = 0 AND wall_posts.pending = 0 "
+	whereCategory = "AND categories.tag = ? "
+	whereBefore   = "AND wall_posts.id < ? "
+	whereAfter    = "AND wall_posts.id > ? "
+
+	byNetwork    = "AND wall_posts.network_id = ? "
+	byPoster     = "AND wall_posts.`by` = ? "
+	inUserGroups = "AND wall_posts.network_id IN ( " +
+		"SELECT network_id FROM user_network " +
+		"JOIN network ON user_network.network_id = network.id " +
+		"WHERE user_id = ? AND network.user_group = 1 ) "
+	inNetworksOf = "AND wall_posts.network_id IN ( SELECT network_id FROM user_network WHERE user_id = ? ) "
+
+	orderLinear               = "ORDER BY wall_posts.`time` DESC, wall_posts.id DESC LIMIT ?, ?"
+	orderChronological        = "ORDER BY wall_posts.`time` DESC, wall_posts.id DESC LIMIT 0, ?"
+	orderReverseChronological = "ORDER BY wall_posts.`time` ASC, wall_posts.id ASC LIMIT 0, ?"
+
+	reverse = "SELECT `id`, `by`, `time`, `text`, `network_id` FROM ( %s ) AS `wp` ORDER BY `time` DESC, `id` DESC"
+)
+
+//feed builds a query for a page of approved posts matching where (whose arguments come first), in one of the paging modes.
+func feed(where string, category string, mode int, args []interface{}, index int64, count int) (q string, all []interface{}) {
+	q = "SELECT " + postColumns + "FROM wall_posts "
+	if len(category) > 0 {
+		q += categoryJoin
+	}
+	q += approved + where
+	all = args
+	if len(category) > 0 {
+		q += whereCategory
+		all = append(all, category)
+	}
+	switch mode {
+	case ChronologicallyAfterID:
+		q = fmt.Sprintf(reverse, q+whereAfter+orderReverseChronological)
+	case ChronologicallyBeforeID:
+		q += whereBefore + orderChronological
+	default:
+		q += orderLinear
+	}
+	return q, append(all, index, count)
+}
+
+func (p mysqlPosts) Owner(ctx context.Context, post gp.PostID) (by gp.UserID, err error) {
+	s, err := p.sc.Prepare("SELECT `by` FROM wall_posts WHERE id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, post).Scan(&by)
+	return
+}
+
+func (p mysqlPosts) Network(ctx context.Context, post gp.PostID) (network gp.NetworkID, err error) {
+	s, err := p.sc.Prepare("SELECT network_id FROM wall_posts WHERE id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, post).Scan(&network)
+	return
+}
+
+func (p mysqlPosts) Create(ctx context.Context, by gp.UserID, network gp.NetworkID, text string, pending bool) (id gp.PostID, err error) {
+	s, err := p.sc.Prepare("INSERT INTO wall_posts(`by`, `text`, network_id, pending) VALUES (?,?,?,?)")
+	if err != nil {
+		return
+	}
+	res, err := s.ExecContext(ctx, by, text, network, pending)
+	if err != nil {
+		return
+	}
+	_id, err := res.LastInsertId()
+	return gp.PostID(_id), err
+}
+
+func (p mysqlPosts) Post(ctx context.Context, post gp.PostID) (StoredPost, error) {
+	return p.post(ctx, "SELECT "+postColumns+"FROM wall_posts WHERE deleted = 0 AND id = ?", post)
+}
+
+func (p mysqlPosts) VisiblePost(ctx context.Context, post gp.PostID, viewer gp.UserID) (StoredPost, error) {
+	return p.post(ctx, "SELECT "+postColumns+"FROM wall_posts WHERE deleted = 0 AND id = ? AND (pending = 0 OR `by` = ?)", post, viewer)
+}
+
+func (p mysqlPosts) post(ctx context.Context, q string, args ...interface{}) (post StoredPost, err error) {
+	posts, err := p.posts(ctx, q, args...)
+	if err != nil {
+		return
+	}
+	if len(posts) == 0 {
+		return post, sql.ErrNoRows
+	}
+	return posts[0], nil
+}
+
+func (p mysqlPosts) SetText(ctx context.Context, post gp.PostID, text string) error {
+	return p.exec(ctx, "UPDATE wall_posts SET text = ? WHERE id = ?", text, post)
+}
+
+func (p mysqlPosts) Delete(ctx context.Context, post gp.PostID) error {
+	return p.exec(ctx, "UPDATE wall_posts SET deleted = 1 WHERE id = ?", post)
+}
+
+func (p mysqlPosts) NetworkPosts(ctx context.Context, viewer gp.UserID, network gp.NetworkID, category string, mode int, index int64, count int) (posts []StoredPost, err error) {
+	q, args := feed(byNetwork, category, mode, []interface{}{network}, index, count)
+	s, err := p.replicas.PrepareFor(ctx, viewer, q)
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return scanPosts(rows)
+}
+
+func (p mysqlPosts) UserPosts(ctx context.Context, perspective, by gp.UserID, category string, mode int, index int64, count int) ([]StoredPost, error) {
+	q, args := feed(byPoster+inNetworksOf, category, mode, []interface{}{by, perspective}, index, count)
+	return p.posts(ctx, q, args...)
+}
+
+func (p mysqlPosts) GroupPosts(ctx context.Context, user gp.UserID, category string, mode int, index int64, count int) ([]StoredPost, error) {
+	q, args := feed(inUserGroups, category, mode, []interface{}{user}, index, count)
+	return p.posts(ctx, q, args...)
+}
+
+func (p mysqlPosts) PostCount(ctx context.Context, perspective, by gp.UserID) (int, error) {
+	return p.count(ctx, "SELECT COUNT(*) FROM wall_posts "+approved+byPoster+inNetworksOf, by, perspective)
+}
+
+//eventTimes and liveWhere pick out the approved events in a network which happen between two unix times.
+const (
+	eventTimes = "JOIN post_attribs ON wall_posts.id = post_attribs.post_id "
+	liveWhere  = "WHERE deleted = 0 AND pending = 0 AND network_id = ? AND attrib = 'event-time' AND value > ? AND value < ? "
+)
+
+func (p mysqlPosts) Live(ctx context.Context, network gp.NetworkID, after, until time.Time, category string, count int) ([]StoredPost, error) {
+	q := "SELECT " + postColumns + "FROM wall_posts " + eventTimes
+	args := []interface{}{network, after.Unix(), until.Unix()}
+	if len(category) > 0 {
+		q += categoryJoin + liveWhere + whereCategory
+		args = append(args, category)
+	} else {
+		q += liveWhere
+	}
+	q += "ORDER BY value ASC LIMIT 0, ?"
+	return p.posts(ctx, q, append(args, count)...)
+}
+
+func (p mysqlPosts) LiveSummary(ctx context.Context, network gp.NetworkID, after, until time.Time) (summary gp.LiveSummary, err error) {
+	summary.Posts, err = p.count(ctx, "SELECT COUNT(*) FROM wall_posts "+eventTimes+liveWhere, network, after.Unix(), until.Unix())
+	if err != nil {
+		return
+	}
+	s, err := p.sc.Prepare("SELECT categories.tag, COUNT(*) FROM wall_posts " + eventTimes + categoryJoin + liveWhere + "GROUP BY categories.tag")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, network, after.Unix(), until.Unix())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	summary.CatCounts = make(map[string]int)
+	for rows.Next() {
+		var cat string
+		var count int
+		if err = rows.Scan(&cat, &count); err != nil {
+			return
+		}
+		summary.CatCounts[cat] = count
+	}
+	return summary, rows.Err()
+}
+
+func (p mysqlPosts) Images(ctx context.Context, post gp.PostID) (images []string, err error) {
+	s, err := p.sc.Prepare("SELECT url FROM post_images WHERE post_id = ?")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, post)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var image string
+		if err = rows.Scan(&image); err != nil {
+			return
+		}
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
+func (p mysqlPosts) AddImage(ctx context.Context, post gp.PostID, url string) error {
+	return p.exec(ctx, "INSERT INTO post_images (post_id, url) VALUES (?, ?)", post, url)
+}
+
+func (p mysqlPosts) ClearImages(ctx context.Context, post gp.PostID) error {
+	return p.exec(ctx, "DELETE FROM post_images WHERE post_id = ?", post)
+}
+
+func (p mysqlPosts) Videos(ctx context.Context, post gp.PostID) (videos []gp.Video, err error) {
+	s, err := p.sc.Prepare("SELECT url, mp4_url, webm_url FROM uploads JOIN post_videos ON upload_id = video_id WHERE post_id = ? AND status = 'ready'")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, post)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var thumb, mp4, webm sql.NullString
+		if err = rows.Scan(&thumb, &mp4, &webm); err != nil {
+			return
+		}
+		video := gp.Video{MP4: mp4.String, WebM: webm.String}
+		if thumb.Valid {
+			video.Thumbs = append(video.Thumbs, thumb.String)
+		}
+		videos = append(videos, video)
+	}
+	return videos, rows.Err()
+}
+
+func (p mysqlPosts) AddVideo(ctx context.Context, post gp.PostID, by gp.UserID, video gp.VideoID) (ok bool, err error) {
+	s, err := p.sc.Prepare("INSERT INTO post_videos (post_id, video_id) SELECT ?, upload_id FROM uploads WHERE upload_id = ? AND user_id = ?")
+	if err != nil {
+		return
+	}
+	res, err := s.ExecContext(ctx, post, video, by)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (p mysqlPosts) ClearVideos(ctx context.Context, post gp.PostID) error {
+	return p.exec(ctx, "DELETE FROM post_videos WHERE post_id = ?", post)
+}
+
+func (p mysqlPosts) Categories(ctx context.Context, post gp.PostID) ([]gp.PostCategory, error) {
+	return p.categories(ctx, "SELECT categories.id, categories.tag, categories.name FROM post_categories JOIN categories ON post_categories.category_id = categories.id WHERE post_categories.post_id = ?", post)
+}
+
+func (p mysqlPosts) AllCategories(ctx context.Context) ([]gp.PostCategory, error) {
+	return p.categories(ctx, "SELECT id, tag, name FROM categories WHERE 1")
+}
+
+func (p mysqlPosts) categories(ctx context.Context, q string, args ...interface{}) (categories []gp.PostCategory, err error) {
+	s, err := p.sc.Prepare(q)
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c gp.PostCategory
+		if err = rows.Scan(&c.ID, &c.Tag, &c.Name); err != nil {
+			return
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+func (p mysqlPosts) Tag(ctx context.Context, post gp.PostID, tags ...string) (err error) {
+	s, err := p.sc.Prepare("INSERT INTO post_categories( post_id, category_id ) SELECT ? , categories.id FROM categories WHERE categories.tag = ?")
+	if err != nil {
+		return
+	}
+	for _, tag := range tags {
+		if _, err = s.ExecContext(ctx, post, tag); err != nil {
+			return
+		}
+	}
+	return nil
+}
+
+func (p mysqlPosts) ClearCategories(ctx context.Context, post gp.PostID) error {
+	return p.exec(ctx, "DELETE FROM post_categories WHERE post_id = ?", post)
+}
+
+func (p mysqlPosts) Attribs(ctx context.Context, post gp.PostID) (attribs map[string]string, err error) {
+	s, err := p.sc.Prepare("SELECT attrib, value FROM post_attribs WHERE post_id = ?")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, post)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	attribs = make(map[string]string)
+	for rows.Next() {
+		var attrib, value string
+		if err = rows.Scan(&attrib, &value); err != nil {
+			return
+		}
+		attribs[attrib] = value
+	}
+	return attribs, rows.Err()
+}
+
+func (p mysqlPosts) SetAttribs(ctx context.Context, post gp.PostID, attribs map[string]string) (err error) {
+	s, err := p.sc.Prepare("REPLACE INTO post_attribs (post_id, attrib, value) VALUES (?, ?, ?)")
+	if err != nil {
+		return
+	}
+	for attrib, value := range attribs {
+		if _, err = s.ExecContext(ctx, post, attrib, value); err != nil {
+			return
+		}
+	}
+	return nil
+}
+
+func (p mysqlPosts) AttribValues(ctx context.Context, attrib string) (values map[gp.PostID]string, err error) {
+	s, err := p.sc.Prepare("SELECT post_id, value FROM post_attribs WHERE attrib = ?")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, attrib)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	values = make(map[gp.PostID]string)
+	for rows.Next() {
+		var post gp.PostID
+		var value string
+		if err = rows.Scan(&post, &value); err != nil {
+			return
+		}
+		values[post] = value
+	}
+	return values, rows.Err()
+}
+
+func (p mysqlPosts) Comments(ctx context.Context, post gp.PostID, start int64, count int) (comments []StoredComment, err error) {
+	s, err := p.sc.Prepare("SELECT id, `by`, text, `timestamp` FROM post_comments WHERE post_id = ? ORDER BY `timestamp` DESC LIMIT ?, ?")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, post, start, count)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var comment StoredComment
+		var t string
+		if err = rows.Scan(&comment.ID, &comment.By, &comment.Text, &t); err != nil {
+			return
+		}
+		comment.Time, _ = time.Parse(mysqlTime, t)
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+func (p mysqlPosts) CommentCount(ctx context.Context, post gp.PostID) (int, error) {
+	return p.count(ctx, "SELECT COUNT(*) FROM post_comments WHERE post_id = ?", post)
+}
+
+func (p mysqlPosts) AddComment(ctx context.Context, post gp.PostID, by gp.UserID, text string) (id gp.CommentID, err error) {
+	s, err := p.sc.Prepare("INSERT INTO post_comments (post_id, `by`, text) VALUES (?, ?, ?)")
+	if err != nil {
+		return
+	}
+	res, err := s.ExecContext(ctx, post, by, text)
+	if err != nil {
+		return
+	}
+	_id, err := res.LastInsertId()
+	return gp.CommentID(_id), err
+}
+
+func (p mysqlPosts) Likes(ctx context.Context, post gp.PostID) (likes []gp.Like, err error) {
+	s, err := p.sc.Prepare("SELECT user_id, timestamp FROM post_likes WHERE post_id = ?")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, post)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var like gp.Like
+		var t string
+		if err = rows.Scan(&like.UserID, &t); err != nil {
+			return
+		}
+		if like.Time, err = time.Parse(mysqlTime, t); err != nil {
+			return
+		}
+		likes = append(likes, like)
+	}
+	return likes, rows.Err()
+}
+
+func (p mysqlPosts) LikeCount(ctx context.Context, post gp.PostID) (int, error) {
+	return p.count(ctx, "SELECT COUNT(*) FROM post_likes WHERE post_id = ?", post)
+}
+
+func (p mysqlPosts) Like(ctx context.Context, user gp.UserID, post gp.PostID) error {
+	return p.exec(ctx, "REPLACE INTO post_likes (post_id, user_id) VALUES (?, ?)", post, user)
+}
+
+func (p mysqlPosts) Unlike(ctx context.Context, user gp.UserID, post gp.PostID) error {
+	return p.exec(ctx, "DELETE FROM post_likes WHERE post_id = ? AND user_id = ?", post, user)
+}
+
+func (p mysqlPosts) Attend(ctx context.Context, event gp.PostID, user gp.UserID) (changed bool, err error) {
+	s, err := p.sc.Prepare("INSERT IGNORE INTO event_attendees (post_id, user_id) VALUES (?, ?)")
+	if err != nil {
+		return
+	}
+	res, err := s.ExecContext(ctx, event, user)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (p mysqlPosts) Unattend(ctx context.Context, event gp.PostID, user gp.UserID) error {
+	return p.exec(ctx, "DELETE FROM event_attendees WHERE post_id = ? AND user_id = ?", event, user)
+}
+
+func (p mysqlPosts) IsAttending(ctx context.Context, user gp.UserID, event gp.PostID) (attending bool, err error) {
+	n, err := p.count(ctx, "SELECT COUNT(*) FROM event_attendees WHERE user_id = ? AND post_id = ?", user, event)
+	return n > 0, err
+}
+
+func (p mysqlPosts) AttendeeCount(ctx context.Context, event gp.PostID) (int, error) {
+	return p.count(ctx, "SELECT COUNT(*) FROM event_attendees WHERE post_id = ?", event)
+}
+
+func (p mysqlPosts) Attendees(ctx context.Context, event gp.PostID) (attendees []gp.User, err error) {
+	s, err := p.sc.Prepare("SELECT id, firstname, avatar, official FROM users JOIN event_attendees ON user_id = id WHERE post_id = ?")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, event)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var user gp.User
+		var avatar sql.NullString
+		if err = rows.Scan(&user.ID, &user.Name, &avatar, &user.Official); err != nil {
+			return
+		}
+		user.Avatar = avatar.String
+		attendees = append(attendees, user)
+	}
+	return attendees, rows.Err()
+}
+
+func (p mysqlPosts) UserAttends(ctx context.Context, user gp.UserID) (events []gp.PostID, err error) {
+	s, err := p.sc.Prepare("SELECT post_id FROM event_attendees WHERE user_id = ?")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, user)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var event gp.PostID
+		if err = rows.Scan(&event); err != nil {
+			return
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (p mysqlPosts) Attending(ctx context.Context, perspective, user gp.UserID, category string, mode int, index int64, count int) ([]StoredPost, error) {
+	q := "SELECT " + postColumns + "FROM wall_posts " + attendJoin
+	args := []interface{}{perspective, user}
+	if len(category) > 0 {
+		q += categoryJoin
+	}
+	q += approved + inNetworksOf + "AND event_attendees.user_id = ? "
+	if len(category) > 0 {
+		q += whereCategory
+		args = append(args, category)
+	}
+	switch mode {
+	case ChronologicallyAfterID:
+		q += "AND event_attendees.time > (SELECT time FROM event_attendees WHERE post_id = ? AND user_id = ?) " +
+			"ORDER BY event_attendees.time DESC, wall_posts.id DESC LIMIT 0, ?"
+		args = append(args, index, user)
+	case ChronologicallyBeforeID:
+		q += "AND event_attendees.time < (SELECT time FROM event_attendees WHERE post_id = ? AND user_id = ?) " +
+			"ORDER BY event_attendees.time DESC, wall_posts.id DESC LIMIT 0, ?"
+		args = append(args, index, user)
+	default:
+		q += "ORDER BY event_attendees.time DESC, wall_posts.id DESC LIMIT ?, ?"
+		args = append(args, index)
+	}
+	return p.posts(ctx, q, append(args, count)...)
+}
+
+func (p mysqlPosts) RSVPCount(ctx context.Context, perspective, user gp.UserID) (int, error) {
+	return p.count(ctx, "SELECT COUNT(*) FROM wall_posts "+attendJoin+approved+inNetworksOf+"AND event_attendees.user_id = ?", perspective, user)
+}
+
+func (p mysqlPosts) posts(ctx context.Context, q string, args ...interface{}) (posts []StoredPost, err error) {
+	s, err := p.sc.Prepare(q)
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return scanPosts(rows)
+}
+
+//scanPosts reads rows of postColumns.
+func scanPosts(rows *sql.Rows) (posts []StoredPost, err error) {
+	for rows.Next() {
+		var post StoredPost
+		var t string
+		if err = rows.Scan(&post.ID, &post.By, &t, &post.Text, &post.Network); err != nil {
+			return
+		}
+		if post.Time, err = time.Parse(mysqlTime, t); err != nil {
+			return
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+func (p mysqlPosts) count(ctx context.Context, q string, args ...interface{}) (count int, err error) {
+	s, err := p.sc.Prepare(q)
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, args...).Scan(&count)
+	return
+}
+
+func (p mysqlPosts) exec(ctx context.Context, q string, args ...interface{}) error {
+	s, err := p.sc.Prepare(q)
+	if err != nil {
+		return err
+	}
+	_, err = s.ExecContext(ctx, args...)
+	return err
+}
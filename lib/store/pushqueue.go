@@ -0,0 +1,131 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/psc"
+)
+
+type mysqlPushQueue struct {
+	sc *psc.StatementCache
+}
+
+func (q mysqlPushQueue) Enqueue(ctx context.Context, application string, device gp.Device, payload string) (err error) {
+	s, err := q.sc.Prepare("INSERT INTO push_queue (application, user_id, device_type, device_id, arn, payload) VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return
+	}
+	var arn *string
+	if device.ARN != "" {
+		arn = &device.ARN
+	}
+	_, err = s.ExecContext(ctx, application, device.User, device.Type, device.ID, arn, payload)
+	return
+}
+
+func (q mysqlPushQueue) Claim(ctx context.Context, claim string, lease time.Duration, applications []string) (job PushJob, err error) {
+	if len(applications) == 0 {
+		return job, sql.ErrNoRows
+	}
+	s, err := q.sc.Prepare("UPDATE push_queue SET claim = ?, locked_until = NOW() + INTERVAL ? SECOND WHERE application IN (?" + strings.Repeat(", ?", len(applications)-1) + ") AND next_attempt <= NOW() AND (locked_until IS NULL OR locked_until < NOW()) ORDER BY next_attempt ASC LIMIT 1")
+	if err != nil {
+		return
+	}
+	args := []interface{}{claim, int(lease.Seconds())}
+	for _, a := range applications {
+		args = append(args, a)
+	}
+	res, err := s.ExecContext(ctx, args...)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return
+	}
+	if n == 0 {
+		return job, sql.ErrNoRows
+	}
+	s, err = q.sc.Prepare("SELECT id, application, user_id, device_type, device_id, arn, payload, attempts, created FROM push_queue WHERE claim = ?")
+	if err != nil {
+		return
+	}
+	var arn sql.NullString
+	var created string
+	err = s.QueryRowContext(ctx, claim).Scan(&job.ID, &job.Application, &job.Device.User, &job.Device.Type, &job.Device.ID, &arn, &job.Payload, &job.Attempts, &created)
+	if err != nil {
+		return
+	}
+	job.Device.ARN = arn.String
+	job.Created, err = time.Parse(mysqlTime, created)
+	return
+}
+
+func (q mysqlPushQueue) Retry(ctx context.Context, id uint64, attempts int, wait time.Duration, lastErr string) (err error) {
+	s, err := q.sc.Prepare("UPDATE push_queue SET attempts = ?, next_attempt = NOW() + INTERVAL ? SECOND, claim = NULL, locked_until = NULL, last_error = ? WHERE id = ?")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, attempts, int(wait.Seconds()), lastErr, id)
+	return
+}
+
+func (q mysqlPushQueue) DeadLetter(ctx context.Context, job PushJob, lastErr string) (err error) {
+	s, err := q.sc.Prepare("INSERT INTO push_dead_letters (application, user_id, device_type, device_id, payload, attempts, error, created) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, job.Application, job.Device.User, job.Device.Type, job.Device.ID, job.Payload, job.Attempts, lastErr, job.Created.Format(mysqlTime))
+	if err != nil {
+		return
+	}
+	return q.Remove(ctx, job.ID)
+}
+
+func (q mysqlPushQueue) DeadLetters(ctx context.Context, forUser gp.UserID, limit int) (failures []gp.PushFailure, err error) {
+	failures = make([]gp.PushFailure, 0)
+	query := "SELECT id, application, user_id, device_type, device_id, payload, attempts, error, created, failed_at FROM push_dead_letters "
+	args := []interface{}{}
+	if forUser > 0 {
+		query += "WHERE user_id = ? "
+		args = append(args, forUser)
+	}
+	query += "ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+	s, err := q.sc.Prepare(query)
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var f gp.PushFailure
+		var payload, created, failed string
+		err = rows.Scan(&f.ID, &f.Application, &f.User, &f.DeviceType, &f.DeviceID, &payload, &f.Attempts, &f.Error, &created, &failed)
+		if err != nil {
+			return
+		}
+		f.Payload = json.RawMessage(payload)
+		f.Created, _ = time.Parse(mysqlTime, created)
+		f.FailedAt, _ = time.Parse(mysqlTime, failed)
+		failures = append(failures, f)
+	}
+	return failures, rows.Err()
+}
+
+func (q mysqlPushQueue) Remove(ctx context.Context, id uint64) (err error) {
+	s, err := q.sc.Prepare("DELETE FROM push_queue WHERE id = ?")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, id)
+	return
+}
@@ -0,0 +1,611 @@
+//Package store keeps lib's persistence behind one interface per domain, so that the business logic can run against MySQL in production and an in-memory Memory in unit tests.
+//
+//Users, tokens (sessions, refresh tokens, verification and password recovery), posts, networks, post approval, conversations and notifications live here entirely.
+//lib still prepares the SQL for side tables like devices, uploads, facebook accounts, two-factor secrets and notification settings itself, and for the email digest and stats queries, which join across all of them.
+//New persistence code belongs here all the same.
+//
+//Lookups of rows which don't exist return sql.ErrNoRows, whichever implementation you're using. Every method takes the context of the request it's for, and gives up (returning the context's error) once that's done.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+//mysqlTime is how MySQL's DATETIME columns come back when they're scanned as strings.
+const mysqlTime = "2006-01-02 15:04:05"
+
+//ErrExists is returned when adding something which is already there: a user whose email address is taken, or a participant who is already in the conversation.
+var ErrExists = errors.New("store: already exists")
+
+//Paging modes, for methods which return a page of a list, newest first. index is an offset for ByOffsetDescending, and an ID otherwise.
+const (
+	//ByOffsetDescending starts index items in.
+	ByOffsetDescending = iota
+	//ChronologicallyBeforeID starts just before the item with ID index.
+	ChronologicallyBeforeID
+	//ChronologicallyAfterID gives the items just after the item with ID index (still newest first).
+	ChronologicallyAfterID
+)
+
+//Replicas prepares read-only queries made on a user's behalf, on a replica where that won't hide something they've just written.
+type Replicas interface {
+	PrepareFor(ctx context.Context, user gp.UserID, query string) (*sql.Stmt, error)
+}
+
+//Store is every domain's store.
+type Store struct {
+	Users         Users
+	Tokens        Tokens
+	Posts         Posts
+	Approvals     Approvals
+	Conversations Conversations
+	Networks      Networks
+	Notifications Notifications
+	PushQueue     PushQueue
+}
+
+//Users stores users.
+type Users interface {
+	//ByID returns this user's public details.
+	ByID(ctx context.Context, id gp.UserID) (gp.User, error)
+	//Profile returns the parts of this user's profile which are kept with them; not their network, or any of the counts.
+	Profile(ctx context.Context, id gp.UserID) (gp.Profile, error)
+	//Email returns this user's email address.
+	Email(ctx context.Context, id gp.UserID) (string, error)
+	//Details returns this user's names and email address.
+	Details(ctx context.Context, id gp.UserID) (first, last, email string, err error)
+	//IsAdmin is true if this user has their admin flag set.
+	IsAdmin(ctx context.Context, id gp.UserID) (bool, error)
+	//Admins returns every user with their admin flag set.
+	Admins(ctx context.Context) ([]gp.User, error)
+	//Greeter returns the user who welcomes new users.
+	Greeter(ctx context.Context) (gp.UserID, error)
+	//IDs returns every user's id.
+	IDs(ctx context.Context) ([]gp.UserID, error)
+	//Emails returns every user's email address.
+	Emails(ctx context.Context) ([]string, error)
+	//ByEmail returns the user with this email address.
+	ByEmail(ctx context.Context, email string) (gp.UserID, error)
+	//ByFacebook returns the user this facebook account is linked to.
+	ByFacebook(ctx context.Context, fbid uint64) (gp.UserID, error)
+	//Register creates an unverified user, or returns ErrExists if their email address is taken.
+	Register(ctx context.Context, first, last, email string, hash []byte, hashVersion int) (gp.UserID, error)
+	//Password returns this user's password hash, and the version of the scheme which made it.
+	Password(ctx context.Context, id gp.UserID) (hash []byte, version int, err error)
+	//PasswordByEmail is Password for the user with this email address, who it also returns.
+	PasswordByEmail(ctx context.Context, email string) (id gp.UserID, hash []byte, version int, err error)
+	//SetPassword replaces this user's password hash.
+	SetPassword(ctx context.Context, id gp.UserID, hash []byte, version int) error
+	//ReplacePassword is SetPassword, but only if their hash is still old.
+	ReplacePassword(ctx context.Context, id gp.UserID, old, hash []byte, version int) error
+	//IsVerified is true once this user has verified their email address.
+	IsVerified(ctx context.Context, id gp.UserID) (bool, error)
+	//Verify marks this user verified.
+	Verify(ctx context.Context, id gp.UserID) error
+	//SetName changes this user's name.
+	SetName(ctx context.Context, id gp.UserID, first, last string) error
+	//SetAvatar changes this user's profile image.
+	SetAvatar(ctx context.Context, id gp.UserID, url string) error
+	//SetTagline changes this user's tagline.
+	SetTagline(ctx context.Context, id gp.UserID, tagline string) error
+	//SetDirectoryEntry records what their university's directory says this user is.
+	SetDirectoryEntry(ctx context.Context, id gp.UserID, userType, externalID string) error
+	//Busy is this user's busy status.
+	Busy(ctx context.Context, id gp.UserID) (bool, error)
+	//SetBusy changes this user's busy status.
+	SetBusy(ctx context.Context, id gp.UserID, busy bool) error
+	//TutorialState lists the tutorials this user has done.
+	TutorialState(ctx context.Context, id gp.UserID) ([]string, error)
+	//SetTutorialState replaces the list of tutorials this user has done.
+	SetTutorialState(ctx context.Context, id gp.UserID, tutorials []string) error
+}
+
+//TokenRecord is a session token as it's stored.
+type TokenRecord struct {
+	Expiry time.Time
+	Scopes string //Comma-separated.
+	Legacy bool   //Issued before refresh tokens existed.
+	MFA    bool   //Its user passed a second factor.
+}
+
+//SessionRecord is a session as it's stored.
+type SessionRecord struct {
+	ID       gp.SessionID
+	Token    string
+	Scopes   string //Comma-separated.
+	Device   string
+	Created  time.Time
+	LastUsed *time.Time
+	Expiry   time.Time
+}
+
+//RefreshRecord is a refresh token as it's stored.
+type RefreshRecord struct {
+	UserID  gp.UserID
+	Session gp.SessionID
+	Expiry  time.Time
+	Used    bool
+}
+
+//Tokens stores session tokens and their refresh tokens, along with the one-off tokens which verify an email address or reset a password.
+type Tokens interface {
+	//Token looks up this user's token, whether or not it has expired.
+	Token(ctx context.Context, id gp.UserID, token string) (TokenRecord, error)
+	//AddToken stores a new token, returning the id of the session it starts.
+	AddToken(ctx context.Context, token gp.Token, device string, mfa bool) (gp.SessionID, error)
+	//TouchToken records that this token has just been used.
+	TouchToken(ctx context.Context, id gp.UserID, token string) error
+	//MarkMFA records that this token's user has passed a second factor.
+	MarkMFA(ctx context.Context, id gp.UserID, token string) error
+	//ClearMFA forgets that any of this user's tokens passed a second factor.
+	ClearMFA(ctx context.Context, id gp.UserID) error
+	//Sessions returns this user's unexpired sessions, newest first.
+	Sessions(ctx context.Context, id gp.UserID) ([]SessionRecord, error)
+	//Session returns the current token of one of this user's sessions, and its scopes.
+	Session(ctx context.Context, id gp.UserID, session gp.SessionID) (token, scopes string, err error)
+	//UserTokens returns every token this user has.
+	UserTokens(ctx context.Context, id gp.UserID) ([]string, error)
+	//DeleteToken removes this token, along with its session's refresh tokens.
+	DeleteToken(ctx context.Context, id gp.UserID, token string) error
+	//ReplaceToken gives a session a new token, which isn't a legacy one.
+	ReplaceToken(ctx context.Context, id gp.UserID, session gp.SessionID, token string, expiry time.Time) error
+	//AddRefreshToken stores a refresh token for this session.
+	AddRefreshToken(ctx context.Context, refresh string, id gp.UserID, session gp.SessionID, expiry time.Time) error
+	//RefreshToken looks up a refresh token, whether or not it has expired or been used.
+	RefreshToken(ctx context.Context, refresh string) (RefreshRecord, error)
+	//UseRefreshToken marks a refresh token used. It's false if it already was.
+	UseRefreshToken(ctx context.Context, refresh string) (bool, error)
+	//SetVerificationToken replaces this user's email verification token.
+	SetVerificationToken(ctx context.Context, id gp.UserID, token string) error
+	//VerificationToken returns who this verification token belongs to.
+	VerificationToken(ctx context.Context, token string) (gp.UserID, error)
+	//AddRecoveryToken stores a password recovery token for this user.
+	AddRecoveryToken(ctx context.Context, id gp.UserID, token string) error
+	//RecoveryTokenExists is true if this user has this password recovery token.
+	RecoveryTokenExists(ctx context.Context, id gp.UserID, token string) (bool, error)
+	//DeleteRecoveryToken removes a password recovery token, so it can't be used again.
+	DeleteRecoveryToken(ctx context.Context, id gp.UserID, token string) error
+}
+
+//StoredPost is a post as it's stored: its author is only an ID, and its images, likes and so on aren't included.
+type StoredPost struct {
+	ID      gp.PostID
+	By      gp.UserID
+	Time    time.Time
+	Text    string
+	Network gp.NetworkID
+}
+
+//StoredComment is a comment as it's stored: its author is only an ID.
+type StoredComment struct {
+	ID   gp.CommentID
+	By   gp.UserID
+	Text string
+	Time time.Time
+}
+
+//Posts stores posts, along with their comments, likes, attributes, categories, images, videos and (for events) attendees.
+//A post's approval status is 0 once it's approved (or if it never needed to be), 1 while it's pending and 2 once it's rejected. Feeds only have approved posts in them, and nothing returns deleted posts apart from Owner and Network.
+type Posts interface {
+	//Owner returns who made this post.
+	Owner(ctx context.Context, post gp.PostID) (gp.UserID, error)
+	//Network returns the network this post is in.
+	Network(ctx context.Context, post gp.PostID) (gp.NetworkID, error)
+	//Create stores a new post, pending approval or already approved.
+	Create(ctx context.Context, by gp.UserID, network gp.NetworkID, text string, pending bool) (gp.PostID, error)
+	//Post returns a post, whatever its approval status.
+	Post(ctx context.Context, post gp.PostID) (StoredPost, error)
+	//VisiblePost is Post, but only if the post is approved or viewer made it.
+	VisiblePost(ctx context.Context, post gp.PostID, viewer gp.UserID) (StoredPost, error)
+	//SetText replaces a post's text.
+	SetText(ctx context.Context, post gp.PostID, text string) error
+	//Delete marks a post deleted.
+	Delete(ctx context.Context, post gp.PostID) error
+	//NetworkPosts returns a page of the posts in network (only those in category, if it's set) in one of the paging modes. It's read on viewer's behalf.
+	NetworkPosts(ctx context.Context, viewer gp.UserID, network gp.NetworkID, category string, mode int, index int64, count int) ([]StoredPost, error)
+	//UserPosts is NetworkPosts for by's posts in every network perspective is in.
+	UserPosts(ctx context.Context, perspective, by gp.UserID, category string, mode int, index int64, count int) ([]StoredPost, error)
+	//GroupPosts is NetworkPosts for every group (network which isn't a university) user is in.
+	GroupPosts(ctx context.Context, user gp.UserID, category string, mode int, index int64, count int) ([]StoredPost, error)
+	//PostCount is how many posts by has in the networks perspective is in.
+	PostCount(ctx context.Context, perspective, by gp.UserID) (int, error)
+	//Live returns up to count of the events in network (only those in category, if it's set) which happen between after and until, soonest first.
+	Live(ctx context.Context, network gp.NetworkID, after, until time.Time, category string, count int) ([]StoredPost, error)
+	//LiveSummary counts the events in network which happen between after and until, in total and by category.
+	LiveSummary(ctx context.Context, network gp.NetworkID, after, until time.Time) (gp.LiveSummary, error)
+	//Images lists the URLs of a post's images.
+	Images(ctx context.Context, post gp.PostID) ([]string, error)
+	//AddImage attaches an image to a post.
+	AddImage(ctx context.Context, post gp.PostID, url string) error
+	//ClearImages removes all of a post's images.
+	ClearImages(ctx context.Context, post gp.PostID) error
+	//Videos lists a post's videos which have finished transcoding.
+	Videos(ctx context.Context, post gp.PostID) ([]gp.Video, error)
+	//AddVideo attaches one of by's uploaded videos to a post. ok is false if by didn't upload it.
+	AddVideo(ctx context.Context, post gp.PostID, by gp.UserID, video gp.VideoID) (ok bool, err error)
+	//ClearVideos removes all of a post's videos.
+	ClearVideos(ctx context.Context, post gp.PostID) error
+	//Categories lists the categories a post is in.
+	Categories(ctx context.Context, post gp.PostID) ([]gp.PostCategory, error)
+	//AllCategories lists every category.
+	AllCategories(ctx context.Context) ([]gp.PostCategory, error)
+	//Tag puts a post in the categories with these tags. Tags which aren't a category are ignored.
+	Tag(ctx context.Context, post gp.PostID, tags ...string) error
+	//ClearCategories takes a post out of all its categories.
+	ClearCategories(ctx context.Context, post gp.PostID) error
+	//Attribs returns a post's attributes. Event times are unix timestamps.
+	Attribs(ctx context.Context, post gp.PostID) (map[string]string, error)
+	//SetAttribs sets these of a post's attributes, leaving the rest alone.
+	SetAttribs(ctx context.Context, post gp.PostID, attribs map[string]string) error
+	//AttribValues returns the value of attrib for every post which has it.
+	AttribValues(ctx context.Context, attrib string) (map[gp.PostID]string, error)
+	//Comments returns a page of a post's comments, newest first.
+	Comments(ctx context.Context, post gp.PostID, start int64, count int) ([]StoredComment, error)
+	//CommentCount is how many comments a post has.
+	CommentCount(ctx context.Context, post gp.PostID) (int, error)
+	//AddComment comments on a post.
+	AddComment(ctx context.Context, post gp.PostID, by gp.UserID, text string) (gp.CommentID, error)
+	//Likes lists a post's likes.
+	Likes(ctx context.Context, post gp.PostID) ([]gp.Like, error)
+	//LikeCount is how many likes a post has.
+	LikeCount(ctx context.Context, post gp.PostID) (int, error)
+	//Like records that user likes a post. Liking it again changes nothing.
+	Like(ctx context.Context, user gp.UserID, post gp.PostID) error
+	//Unlike forgets that user liked a post.
+	Unlike(ctx context.Context, user gp.UserID, post gp.PostID) error
+	//Attend adds user to an event's attendees. changed is false if they were already attending.
+	Attend(ctx context.Context, event gp.PostID, user gp.UserID) (changed bool, err error)
+	//Unattend removes user from an event's attendees.
+	Unattend(ctx context.Context, event gp.PostID, user gp.UserID) error
+	//IsAttending is true if user is attending the event.
+	IsAttending(ctx context.Context, user gp.UserID, event gp.PostID) (bool, error)
+	//AttendeeCount is how many people are attending an event.
+	AttendeeCount(ctx context.Context, event gp.PostID) (int, error)
+	//Attendees lists the people attending an event.
+	Attendees(ctx context.Context, event gp.PostID) ([]gp.User, error)
+	//UserAttends lists every event user is attending.
+	UserAttends(ctx context.Context, user gp.UserID) ([]gp.PostID, error)
+	//Attending is UserPosts for the events user is attending, most recently joined first. Except with ByOffsetDescending, index is one of those events.
+	Attending(ctx context.Context, perspective, user gp.UserID, category string, mode int, index int64, count int) ([]StoredPost, error)
+	//RSVPCount is how many events user is attending in the networks perspective is in.
+	RSVPCount(ctx context.Context, perspective, user gp.UserID) (int, error)
+}
+
+//StoredReview is something which happened to a post in review, as it's stored: the reviewer is only an ID.
+type StoredReview struct {
+	Action string //"approved", "rejected" or "edited".
+	By     gp.UserID
+	Reason string
+	At     time.Time
+}
+
+//Approvals stores how closely each network reviews its posts, and the reviews.
+//A network's reviewers are the members of its master group; their role level there is their access.
+type Approvals interface {
+	//ReviewerLevel returns user's role level in network's master group, or sql.ErrNoRows if they aren't in it.
+	ReviewerLevel(ctx context.Context, network gp.NetworkID, user gp.UserID) (int, error)
+	//Level returns network's approval level, and the categories it reviews.
+	Level(ctx context.Context, network gp.NetworkID) (gp.ApproveLevel, error)
+	//SetLevel changes network's approval level, and the categories (comma-separated) it reviews. changed is false if it was already set that way.
+	SetLevel(ctx context.Context, network gp.NetworkID, level int, categories string) (changed bool, err error)
+	//Status returns a post's approval status.
+	Status(ctx context.Context, post gp.PostID) (int, error)
+	//Pending lists the posts in network which are pending, newest first.
+	Pending(ctx context.Context, network gp.NetworkID) ([]StoredPost, error)
+	//UserPending lists by's posts which are pending or rejected, most recently reviewed (or made) first.
+	UserPending(ctx context.Context, by gp.UserID) ([]StoredPost, error)
+	//Approved returns a page of the posts approved in network, most recently approved first, in one of the paging modes.
+	Approved(ctx context.Context, network gp.NetworkID, mode int, index int64, count int) ([]StoredPost, error)
+	//Rejected is Approved for the posts which are rejected.
+	Rejected(ctx context.Context, network gp.NetworkID, mode int, index int64, count int) ([]StoredPost, error)
+	//History lists a post's reviews, oldest first.
+	History(ctx context.Context, post gp.PostID) ([]StoredReview, error)
+	//Approve approves a post, moving it up to the top of its network's feed.
+	Approve(ctx context.Context, post gp.PostID, by gp.UserID, reason string) error
+	//Reject rejects a post.
+	Reject(ctx context.Context, post gp.PostID, by gp.UserID, reason string) error
+	//Resubmit puts a post which has been edited back up for review.
+	Resubmit(ctx context.Context, post gp.PostID, by gp.UserID, reason string) error
+}
+
+//StoredMessage is a message as it's stored: its sender is only an ID.
+type StoredMessage struct {
+	ID      gp.MessageID
+	By      gp.UserID
+	Text    string
+	Time    time.Time
+	System  bool
+	Edited  *time.Time
+	Deleted bool
+}
+
+//StoredFile is a file which was shared by linking to it in a message.
+type StoredFile struct {
+	Message StoredMessage
+	Type    string
+	URL     string
+	Caption string
+}
+
+//ConversationActivity is when a conversation last had a message.
+type ConversationActivity struct {
+	ID           gp.ConversationID
+	LastActivity time.Time
+}
+
+//Conversations stores conversations and their messages.
+//Each participant sees the messages after their deletion threshold, and has read the ones up to their read marker.
+type Conversations interface {
+	//Create starts a conversation with no participants. group is 0 unless it's a group's conversation.
+	Create(ctx context.Context, initiator gp.UserID, primary bool, group gp.NetworkID) (gp.ConversationID, error)
+	//AddParticipant adds user to the conversation, or returns ErrExists if they're already in it.
+	AddParticipant(ctx context.Context, conv gp.ConversationID, user gp.UserID) error
+	//Participants lists who's in a conversation, leaving out those who have deleted it unless includeDeleted.
+	Participants(ctx context.Context, conv gp.ConversationID, includeDeleted bool) ([]gp.UserID, error)
+	//Contacts lists everyone who's in a conversation with user, including user.
+	Contacts(ctx context.Context, user gp.UserID) ([]gp.UserID, error)
+	//UserConversations returns a page of user's conversations which have messages they can see, most recently active first. Groups' conversations are left out.
+	UserConversations(ctx context.Context, user gp.UserID, start int64, count int) ([]ConversationActivity, error)
+	//Activity returns when the conversation last had a message, if user is in it.
+	Activity(ctx context.Context, user gp.UserID, conv gp.ConversationID) (time.Time, error)
+	//Leave removes the conversation from user's list.
+	Leave(ctx context.Context, user gp.UserID, conv gp.ConversationID) error
+	//SetDeletionThreshold hides the messages up to and including threshold from user. It never moves the threshold back.
+	SetDeletionThreshold(ctx context.Context, user gp.UserID, conv gp.ConversationID, threshold gp.MessageID) error
+	//DeletionThreshold returns the last message user has hidden.
+	DeletionThreshold(ctx context.Context, user gp.UserID, conv gp.ConversationID) (gp.MessageID, error)
+	//ReadStatus returns how far each participant has read.
+	ReadStatus(ctx context.Context, conv gp.ConversationID) ([]gp.Read, error)
+	//MarkRead moves user's read marker forward to the last message up to upTo, and returns where it is now.
+	MarkRead(ctx context.Context, user gp.UserID, conv gp.ConversationID, upTo gp.MessageID, at time.Time) (gp.MessageID, error)
+	//AddMessage adds a message to the conversation.
+	AddMessage(ctx context.Context, conv gp.ConversationID, by gp.UserID, text string, system bool) (gp.MessageID, error)
+	//LastMessage returns the conversation's newest message.
+	LastMessage(ctx context.Context, conv gp.ConversationID) (StoredMessage, error)
+	//Message returns message id, if it's in conv.
+	Message(ctx context.Context, conv gp.ConversationID, id gp.MessageID) (StoredMessage, error)
+	//EditMessage replaces the text of a message by sent within window, keeping what it said before in its history, and forgets the files it shared.
+	//ok is false (and nothing changes) if there's no such message in conv which hasn't been deleted.
+	EditMessage(ctx context.Context, conv gp.ConversationID, id gp.MessageID, by gp.UserID, text string, window time.Duration) (ok bool, err error)
+	//DeleteMessage blanks a message by sent within window, leaving a tombstone, and forgets its history and files. ok is as in EditMessage.
+	DeleteMessage(ctx context.Context, conv gp.ConversationID, id gp.MessageID, by gp.UserID, window time.Duration) (ok bool, err error)
+	//MessageHistory returns what a message said before each of its edits, most recent first.
+	MessageHistory(ctx context.Context, id gp.MessageID) ([]gp.MessageEdit, error)
+	//Messages returns a page of the messages user can see in a conversation, in one of the paging modes.
+	Messages(ctx context.Context, user gp.UserID, conv gp.ConversationID, mode int, index int64, count int) ([]StoredMessage, error)
+	//AddFile records a file shared by a message.
+	AddFile(ctx context.Context, message gp.MessageID, fileType, url, caption string) error
+	//Files returns a page of the files shared in the messages user can see in a conversation, in one of the paging modes.
+	Files(ctx context.Context, user gp.UserID, conv gp.ConversationID, mode int, index int64, count int) ([]StoredFile, error)
+	//UnreadCount is how many messages user hasn't read, ignoring those from before their badge threshold.
+	UnreadCount(ctx context.Context, user gp.UserID) (int, error)
+	//UnreadDirectCount is UnreadCount, leaving out groups' conversations.
+	UnreadDirectCount(ctx context.Context, user gp.UserID) (int, error)
+	//UnreadGroupCount is how many messages user hasn't read in groups' conversations, ignoring those from before their group badge threshold.
+	UnreadGroupCount(ctx context.Context, user gp.UserID) (int, error)
+	//ConversationUnread is how many messages user hasn't read in this conversation.
+	ConversationUnread(ctx context.Context, user gp.UserID, conv gp.ConversationID) (int, error)
+	//MuteBadge leaves messages from before t out of user's UnreadCount.
+	MuteBadge(ctx context.Context, user gp.UserID, t time.Time) error
+	//MuteGroupBadge leaves messages from before t out of user's UnreadGroupCount, and posts from before t out of their NewPostCount.
+	MuteGroupBadge(ctx context.Context, user gp.UserID, t time.Time) error
+	//Primary returns the primary conversation between a and b.
+	Primary(ctx context.Context, a, b gp.UserID) (gp.ConversationID, error)
+	//IsPrimary is true if this is the primary conversation between its participants.
+	IsPrimary(ctx context.Context, conv gp.ConversationID) (bool, error)
+	//MergedInto returns the conversation this one was merged into, or 0 if it wasn't.
+	MergedInto(ctx context.Context, conv gp.ConversationID) (gp.ConversationID, error)
+	//Group returns the group this conversation belongs to, or 0.
+	Group(ctx context.Context, conv gp.ConversationID) (gp.NetworkID, error)
+	//Muted is true if user has muted the conversation.
+	Muted(ctx context.Context, user gp.UserID, conv gp.ConversationID) (bool, error)
+	//SetMuted mutes or unmutes the conversation for user.
+	SetMuted(ctx context.Context, user gp.UserID, conv gp.ConversationID, muted bool) error
+}
+
+//StoredNetwork is a network as it's stored: its creator is only an ID, or 0 if nobody made it.
+type StoredNetwork struct {
+	ID        gp.NetworkID
+	Name      string
+	Parent    gp.NetworkID
+	Image     string
+	Desc      string
+	Creator   gp.UserID
+	UserGroup bool //It's a group, rather than a university.
+	Privacy   string
+	Category  string
+}
+
+//Membership is a network along with a member's role in it.
+type Membership struct {
+	StoredNetwork
+	Role         gp.Role
+	LastActivity time.Time //Only Groups sets it.
+}
+
+//PopularGroup is a group and how many members it has.
+type PopularGroup struct {
+	StoredNetwork
+	Members int
+}
+
+//JoinRequest is someone's request to join a private group.
+type JoinRequest struct {
+	User gp.UserID
+	Time time.Time
+}
+
+//Orderings for Groups, most recent first.
+const (
+	//ByPosts orders groups by their last post.
+	ByPosts = iota
+	//ByMessages orders groups by the last message in their conversation.
+	ByMessages
+	//ByActivity orders groups by whichever of those was later.
+	ByActivity
+)
+
+//Networks stores networks (universities and groups), their members, the rules which put new users in them, and the invites and requests to join them.
+type Networks interface {
+	//IsMember is true if user is in network.
+	IsMember(ctx context.Context, user gp.UserID, network gp.NetworkID) (bool, error)
+	//NewPostCount is how many posts there are in user's groups since their group badge threshold.
+	NewPostCount(ctx context.Context, user gp.UserID) (int, error)
+	//Creator returns who created network.
+	Creator(ctx context.Context, network gp.NetworkID) (gp.UserID, error)
+	//Network returns a network.
+	Network(ctx context.Context, network gp.NetworkID) (StoredNetwork, error)
+	//Name returns a network's name.
+	Name(ctx context.Context, network gp.NetworkID) (string, error)
+	//Create stores a new network from n's Name, Parent, Image, Desc, Creator, UserGroup, Privacy and Category.
+	Create(ctx context.Context, n StoredNetwork) (gp.NetworkID, error)
+	//CreateUniversity stores a new university.
+	CreateUniversity(ctx context.Context, name string) (gp.NetworkID, error)
+	//IsGroup is true if network is a group, rather than a university.
+	IsGroup(ctx context.Context, network gp.NetworkID) (bool, error)
+	//Parent returns the network network is in, or 0.
+	Parent(ctx context.Context, network gp.NetworkID) (gp.NetworkID, error)
+	//SetImage changes a network's cover image.
+	SetImage(ctx context.Context, network gp.NetworkID, url string) error
+	//MasterGroup returns the group which administrates network, or sql.ErrNoRows if it has none.
+	MasterGroup(ctx context.Context, network gp.NetworkID) (gp.NetworkID, error)
+	//ChildCount is how many networks are in network.
+	ChildCount(ctx context.Context, network gp.NetworkID) (int, error)
+	//Conversation returns a group's conversation.
+	Conversation(ctx context.Context, group gp.NetworkID) (gp.ConversationID, error)
+	//PublicUniversity returns what the world can see of a university. Its counts aren't filled in.
+	PublicUniversity(ctx context.Context, network gp.NetworkID) (gp.PublicUniversity, error)
+	//University returns user's university, and their role in it.
+	University(ctx context.Context, user gp.UserID) (Membership, error)
+	//Shared is true if a and b have a network in common.
+	Shared(ctx context.Context, a, b gp.UserID) (bool, error)
+	//Join puts user in network, or returns ErrExists if they're already in it.
+	Join(ctx context.Context, user gp.UserID, network gp.NetworkID) error
+	//Leave takes user out of network.
+	Leave(ctx context.Context, user gp.UserID, network gp.NetworkID) error
+	//Role returns user's role in network, or sql.ErrNoRows if they aren't in it.
+	Role(ctx context.Context, user gp.UserID, network gp.NetworkID) (gp.Role, error)
+	//SetRole changes user's role in network.
+	SetRole(ctx context.Context, user gp.UserID, network gp.NetworkID, role gp.Role) error
+	//MemberCount is how many members network has.
+	MemberCount(ctx context.Context, network gp.NetworkID) (int, error)
+	//Members lists network's members, and their roles.
+	Members(ctx context.Context, network gp.NetworkID) ([]gp.UserRole, error)
+	//Admins is Members, leaving out everyone who isn't an administrator.
+	Admins(ctx context.Context, network gp.NetworkID) ([]gp.UserRole, error)
+	//Groups returns a page of user's groups, in one of the orderings.
+	Groups(ctx context.Context, user gp.UserID, ordering int, index int64, count int) ([]Membership, error)
+	//LastActivity is when group last had a post, or a message in its conversation.
+	LastActivity(ctx context.Context, group gp.NetworkID) (time.Time, error)
+	//GroupNewPosts is how many posts other people have made in group since user joined it, which they haven't seen.
+	GroupNewPosts(ctx context.Context, user gp.UserID, group gp.NetworkID) (int, error)
+	//MarkPostsSeen records that user has seen the posts in network up to upTo.
+	MarkPostsSeen(ctx context.Context, user gp.UserID, network gp.NetworkID, upTo gp.PostID) error
+	//VisibleGroupCount is how many of user's groups perspective can see: those in perspective's university which aren't secret, or which perspective is in too.
+	VisibleGroupCount(ctx context.Context, perspective, user gp.UserID) (int, error)
+	//VisibleGroups returns a page of the groups VisibleGroupCount counts, with user's role in each.
+	VisibleGroups(ctx context.Context, perspective, user gp.UserID, index int64, count int) ([]Membership, error)
+	//PopularGroups returns a page of the groups in parent which aren't secret (only those in category, if it's set), most members first.
+	PopularGroups(ctx context.Context, parent gp.NetworkID, category string, index int64, count int) ([]PopularGroup, error)
+	//Rules lists every network's rules.
+	Rules(ctx context.Context) ([]gp.Rule, error)
+	//NetworkRules lists the rules of network and the networks in it.
+	NetworkRules(ctx context.Context, network gp.NetworkID) ([]gp.Rule, error)
+	//AddRules puts people who register with an email address in one of these domains in network.
+	AddRules(ctx context.Context, network gp.NetworkID, domains ...string) error
+	//Domain returns the domain of network's email rule.
+	Domain(ctx context.Context, network gp.NetworkID) (string, error)
+	//Invite stores an invite to network for this email address.
+	Invite(ctx context.Context, network gp.NetworkID, inviter gp.UserID, email, key string) error
+	//InviteExists is true if there's an invite with this key for this email address which hasn't been accepted.
+	InviteExists(ctx context.Context, email, key string) (bool, error)
+	//AcceptInvites puts user in every network their email address has been invited to, and marks the invites accepted.
+	AcceptInvites(ctx context.Context, user gp.UserID, email string) error
+	//InviteFacebook stores an invite to network for this facebook user.
+	InviteFacebook(ctx context.Context, network gp.NetworkID, inviter gp.UserID, fbid uint64) error
+	//JoinFacebookInvites puts user in every network this facebook user has been invited to.
+	JoinFacebookInvites(ctx context.Context, user gp.UserID, fbid uint64) error
+	//AcceptFacebookInvites marks this facebook user's invites accepted.
+	AcceptFacebookInvites(ctx context.Context, fbid uint64) error
+	//Request asks for user to join network, or returns ErrExists if they already have.
+	Request(ctx context.Context, user gp.UserID, network gp.NetworkID) error
+	//RequestStatus returns whether user's request to join network is "pending", "accepted" or "rejected".
+	RequestStatus(ctx context.Context, user gp.UserID, network gp.NetworkID) (string, error)
+	//SetRequestStatus records that processor has accepted or rejected user's request to join network.
+	SetRequestStatus(ctx context.Context, user gp.UserID, network gp.NetworkID, status string, processor gp.UserID) error
+	//Requests lists the pending requests to join network.
+	Requests(ctx context.Context, network gp.NetworkID) ([]JoinRequest, error)
+}
+
+//StoredNotification is a notification as it's stored: the people it's about are only IDs.
+type StoredNotification struct {
+	ID         gp.NotificationID
+	Type       string
+	Time       time.Time
+	By         gp.UserID
+	Recipient  gp.UserID
+	Post       gp.PostID
+	Group      gp.NetworkID
+	Preview    string
+	Seen       bool
+	Done       bool
+	ActorCount int
+}
+
+//Notifications stores users' notifications.
+//Aggregated notifications are about several people, their actors: "Alice and 12 others liked your post".
+type Notifications interface {
+	//List returns a page of user's notifications in one of the paging modes; only the unseen ones unless includeSeen.
+	List(ctx context.Context, user gp.UserID, includeSeen bool, mode int, index int64, count int) ([]StoredNotification, error)
+	//Create stores a new notification from n's Type, By, Recipient, Post, Group and Preview, and returns its ID. If aggregated, By is its first actor.
+	Create(ctx context.Context, n StoredNotification, aggregated bool) (gp.NotificationID, error)
+	//Aggregate folds n into its recipient's unseen notification of the same type, about the same post and group, from within window, if there is one; otherwise it returns sql.ErrNoRows.
+	//The aggregate is stored anew with n.By as its latest actor, and the old one is removed. It returns both IDs, and how many actors it has now.
+	Aggregate(ctx context.Context, n StoredNotification, window time.Duration) (id, old gp.NotificationID, actors int, err error)
+	//Actors returns up to count of an aggregated notification's actors, most recent first.
+	Actors(ctx context.Context, id gp.NotificationID, count int) ([]gp.UserID, error)
+	//MarkRequestsDone marks by's requests to join network done.
+	MarkRequestsDone(ctx context.Context, network gp.NetworkID, by gp.UserID) error
+	//UnseenCount is how many notifications user hasn't seen (and which aren't done).
+	UnseenCount(ctx context.Context, user gp.UserID) (int, error)
+	//Recipient returns who a notification is for.
+	Recipient(ctx context.Context, id gp.NotificationID) (gp.UserID, error)
+	//SetSeen marks one of user's notifications seen or unseen. Notifications which aren't user's are left alone.
+	SetSeen(ctx context.Context, user gp.UserID, id gp.NotificationID, seen bool) error
+	//MarkSeenUpTo marks all of user's notifications up to and including upTo as seen.
+	MarkSeenUpTo(ctx context.Context, user gp.UserID, upTo gp.NotificationID) error
+	//Delete removes one of user's notifications, along with its actors.
+	Delete(ctx context.Context, user gp.UserID, id gp.NotificationID) error
+}
+
+//PushJob is one push waiting to be sent to one device.
+type PushJob struct {
+	ID          uint64
+	Application string
+	Device      gp.Device
+	Payload     string
+	Attempts    int //How many times it's been tried already.
+	Created     time.Time
+}
+
+//PushQueue stores outbound pushes, so that they survive a restart and can be shared between workers (on this server or another).
+type PushQueue interface {
+	//Enqueue stores a push to be sent straight away.
+	Enqueue(ctx context.Context, application string, device gp.Device, payload string) error
+	//Claim takes the push for one of applications which has been due longest, and locks it for lease under claim so that no other worker sends it too.
+	//Once the lease runs out, another worker may take it over. It returns sql.ErrNoRows if nothing is due.
+	Claim(ctx context.Context, claim string, lease time.Duration, applications []string) (PushJob, error)
+	//Retry releases a claimed push to be tried again after wait, having now been tried attempts times.
+	Retry(ctx context.Context, id uint64, attempts int, wait time.Duration, lastErr string) error
+	//DeadLetter gives up on a push, moving it to the dead letters.
+	DeadLetter(ctx context.Context, job PushJob, lastErr string) error
+	//DeadLetters lists up to limit of the most recent dead letters, newest first (only those to forUser's devices, if forUser is set).
+	DeadLetters(ctx context.Context, forUser gp.UserID, limit int) ([]gp.PushFailure, error)
+	//Remove deletes a push which has been sent (or doesn't need to be any more).
+	Remove(ctx context.Context, id uint64) error
+}
@@ -0,0 +1,242 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/psc"
+)
+
+type mysqlTokens struct {
+	sc *psc.StatementCache
+}
+
+func (t mysqlTokens) Token(ctx context.Context, id gp.UserID, token string) (record TokenRecord, err error) {
+	s, err := t.sc.Prepare("SELECT expiry, scopes, legacy, mfa FROM tokens WHERE user_id = ? AND token = ?")
+	if err != nil {
+		return
+	}
+	var expiry string
+	err = s.QueryRowContext(ctx, id, token).Scan(&expiry, &record.Scopes, &record.Legacy, &record.MFA)
+	if err != nil {
+		return
+	}
+	record.Expiry, err = time.Parse(mysqlTime, expiry)
+	return
+}
+
+func (t mysqlTokens) AddToken(ctx context.Context, token gp.Token, device string, mfa bool) (session gp.SessionID, err error) {
+	s, err := t.sc.Prepare("INSERT INTO tokens (user_id, token, expiry, scopes, device, mfa) VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return
+	}
+	res, err := s.ExecContext(ctx, token.UserID, token.Token, token.Expiry, strings.Join(token.Scopes, ","), device, mfa)
+	if err != nil {
+		return
+	}
+	id, err := res.LastInsertId()
+	return gp.SessionID(id), err
+}
+
+func (t mysqlTokens) TouchToken(ctx context.Context, id gp.UserID, token string) (err error) {
+	s, err := t.sc.Prepare("UPDATE tokens SET last_used = NOW() WHERE user_id = ? AND token = ?")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, id, token)
+	return
+}
+
+func (t mysqlTokens) MarkMFA(ctx context.Context, id gp.UserID, token string) (err error) {
+	s, err := t.sc.Prepare("UPDATE tokens SET mfa = 1 WHERE user_id = ? AND token = ?")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, id, token)
+	return
+}
+
+func (t mysqlTokens) ClearMFA(ctx context.Context, id gp.UserID) (err error) {
+	s, err := t.sc.Prepare("UPDATE tokens SET mfa = 0 WHERE user_id = ?")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, id)
+	return
+}
+
+func (t mysqlTokens) Sessions(ctx context.Context, id gp.UserID) (sessions []SessionRecord, err error) {
+	s, err := t.sc.Prepare("SELECT id, token, scopes, device, created, last_used, expiry FROM tokens WHERE user_id = ? AND expiry > NOW() ORDER BY created DESC")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, id)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var session SessionRecord
+		var created, expiry string
+		var device, lastUsed sql.NullString
+		err = rows.Scan(&session.ID, &session.Token, &session.Scopes, &device, &created, &lastUsed, &expiry)
+		if err != nil {
+			return
+		}
+		session.Device = device.String
+		session.Created, err = time.Parse(mysqlTime, created)
+		if err != nil {
+			return
+		}
+		if lastUsed.Valid {
+			if used, e := time.Parse(mysqlTime, lastUsed.String); e == nil {
+				session.LastUsed = &used
+			}
+		}
+		session.Expiry, err = time.Parse(mysqlTime, expiry)
+		if err != nil {
+			return
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (t mysqlTokens) Session(ctx context.Context, id gp.UserID, session gp.SessionID) (token, scopes string, err error) {
+	s, err := t.sc.Prepare("SELECT token, scopes FROM tokens WHERE user_id = ? AND id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, id, session).Scan(&token, &scopes)
+	return
+}
+
+func (t mysqlTokens) UserTokens(ctx context.Context, id gp.UserID) (tokens []string, err error) {
+	s, err := t.sc.Prepare("SELECT token FROM tokens WHERE user_id = ?")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx, id)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var token string
+		if err = rows.Scan(&token); err != nil {
+			return
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (t mysqlTokens) DeleteToken(ctx context.Context, id gp.UserID, token string) (err error) {
+	s, err := t.sc.Prepare("DELETE refresh_tokens FROM refresh_tokens JOIN tokens ON tokens.id = refresh_tokens.session_id WHERE tokens.user_id = ? AND tokens.token = ?")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, id, token)
+	if err != nil {
+		return
+	}
+	s, err = t.sc.Prepare("DELETE FROM tokens WHERE user_id = ? AND token = ?")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, id, token)
+	return
+}
+
+func (t mysqlTokens) ReplaceToken(ctx context.Context, id gp.UserID, session gp.SessionID, token string, expiry time.Time) (err error) {
+	s, err := t.sc.Prepare("UPDATE tokens SET token = ?, expiry = ?, legacy = 0 WHERE user_id = ? AND id = ?")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, token, expiry, id, session)
+	return
+}
+
+func (t mysqlTokens) AddRefreshToken(ctx context.Context, refresh string, id gp.UserID, session gp.SessionID, expiry time.Time) (err error) {
+	s, err := t.sc.Prepare("INSERT INTO refresh_tokens (token, user_id, session_id, expiry) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, refresh, id, session, expiry)
+	return
+}
+
+func (t mysqlTokens) RefreshToken(ctx context.Context, refresh string) (record RefreshRecord, err error) {
+	s, err := t.sc.Prepare("SELECT user_id, session_id, expiry, used FROM refresh_tokens WHERE token = ?")
+	if err != nil {
+		return
+	}
+	var expiry string
+	err = s.QueryRowContext(ctx, refresh).Scan(&record.UserID, &record.Session, &expiry, &record.Used)
+	if err != nil {
+		return
+	}
+	record.Expiry, err = time.Parse(mysqlTime, expiry)
+	return
+}
+
+func (t mysqlTokens) UseRefreshToken(ctx context.Context, refresh string) (used bool, err error) {
+	s, err := t.sc.Prepare("UPDATE refresh_tokens SET used = 1 WHERE token = ? AND used = 0")
+	if err != nil {
+		return
+	}
+	res, err := s.ExecContext(ctx, refresh)
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (t mysqlTokens) SetVerificationToken(ctx context.Context, id gp.UserID, token string) (err error) {
+	s, err := t.sc.Prepare("REPLACE INTO `verification` (user_id, token) VALUES (?, ?)")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, id, token)
+	return
+}
+
+func (t mysqlTokens) VerificationToken(ctx context.Context, token string) (id gp.UserID, err error) {
+	s, err := t.sc.Prepare("SELECT user_id FROM verification WHERE token = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, token).Scan(&id)
+	return
+}
+
+func (t mysqlTokens) AddRecoveryToken(ctx context.Context, id gp.UserID, token string) (err error) {
+	s, err := t.sc.Prepare("REPLACE INTO password_recovery (token, user) VALUES (?, ?)")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, token, id)
+	return
+}
+
+func (t mysqlTokens) RecoveryTokenExists(ctx context.Context, id gp.UserID, token string) (exists bool, err error) {
+	s, err := t.sc.Prepare("SELECT count(*) FROM password_recovery WHERE user = ? and token = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, id, token).Scan(&exists)
+	return
+}
+
+func (t mysqlTokens) DeleteRecoveryToken(ctx context.Context, id gp.UserID, token string) (err error) {
+	s, err := t.sc.Prepare("DELETE FROM password_recovery WHERE user = ? and token = ?")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, id, token)
+	return
+}
@@ -0,0 +1,283 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/psc"
+)
+
+type mysqlUsers struct {
+	sc *psc.StatementCache
+}
+
+func (u mysqlUsers) ByID(ctx context.Context, id gp.UserID) (user gp.User, err error) {
+	var av, lastName sql.NullString
+	s, err := u.sc.Prepare("SELECT id, avatar, firstname, lastname, official FROM users WHERE id=?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, id).Scan(&user.ID, &av, &user.Name, &lastName, &user.Official)
+	if err != nil {
+		return
+	}
+	if av.Valid {
+		user.Avatar = av.String
+	}
+	if lastName.Valid {
+		user.Name = user.Name + " " + lastName.String
+	}
+	return
+}
+
+func (u mysqlUsers) Email(ctx context.Context, id gp.UserID) (email string, err error) {
+	s, err := u.sc.Prepare("SELECT email FROM users WHERE id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, id).Scan(&email)
+	return
+}
+
+func (u mysqlUsers) IsAdmin(ctx context.Context, id gp.UserID) (admin bool, err error) {
+	s, err := u.sc.Prepare("SELECT is_admin FROM users WHERE id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, id).Scan(&admin)
+	return
+}
+
+func (u mysqlUsers) Profile(ctx context.Context, id gp.UserID) (user gp.Profile, err error) {
+	var av, desc, lastName, externalID sql.NullString
+	s, err := u.sc.Prepare("SELECT `desc`, avatar, firstname, lastname, official, type, external_id FROM users WHERE id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, id).Scan(&desc, &av, &user.Name, &lastName, &user.Official, &user.Type, &externalID)
+	if err != nil {
+		return
+	}
+	if av.Valid {
+		user.Avatar = av.String
+	}
+	if desc.Valid {
+		user.Desc = desc.String
+	}
+	if lastName.Valid {
+		user.FullName = user.Name + " " + lastName.String
+	}
+	if externalID.Valid {
+		user.InstitutionID = externalID.String
+	}
+	user.ID = id
+	return
+}
+
+func (u mysqlUsers) Details(ctx context.Context, id gp.UserID) (first, last, email string, err error) {
+	s, err := u.sc.Prepare("SELECT firstname, lastname, email FROM users WHERE id = ?")
+	if err != nil {
+		return
+	}
+	var f, l, e sql.NullString
+	err = s.QueryRowContext(ctx, id).Scan(&f, &l, &e)
+	return f.String, l.String, e.String, err
+}
+
+func (u mysqlUsers) Admins(ctx context.Context) (users []gp.User, err error) {
+	s, err := u.sc.Prepare("SELECT id, firstname, avatar, official FROM users WHERE is_admin = 1")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var user gp.User
+		var av sql.NullString
+		if err = rows.Scan(&user.ID, &user.Name, &av, &user.Official); err != nil {
+			return
+		}
+		user.Avatar = av.String
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (u mysqlUsers) Greeter(ctx context.Context) (id gp.UserID, err error) {
+	s, err := u.sc.Prepare("SELECT id FROM users WHERE greeter = 1")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx).Scan(&id)
+	return
+}
+
+func (u mysqlUsers) IDs(ctx context.Context) (ids []gp.UserID, err error) {
+	s, err := u.sc.Prepare("SELECT id FROM users")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id gp.UserID
+		if err = rows.Scan(&id); err != nil {
+			return
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (u mysqlUsers) Emails(ctx context.Context) (emails []string, err error) {
+	s, err := u.sc.Prepare("SELECT email FROM users")
+	if err != nil {
+		return
+	}
+	rows, err := s.QueryContext(ctx)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var email string
+		if err = rows.Scan(&email); err != nil {
+			return
+		}
+		emails = append(emails, email)
+	}
+	return emails, rows.Err()
+}
+
+func (u mysqlUsers) ByEmail(ctx context.Context, email string) (id gp.UserID, err error) {
+	s, err := u.sc.Prepare("SELECT id FROM users WHERE email = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, email).Scan(&id)
+	return
+}
+
+func (u mysqlUsers) ByFacebook(ctx context.Context, fbid uint64) (id gp.UserID, err error) {
+	s, err := u.sc.Prepare("SELECT user_id FROM facebook WHERE fb_id = ? AND user_id IS NOT NULL")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, fbid).Scan(&id)
+	return
+}
+
+func (u mysqlUsers) Register(ctx context.Context, first, last, email string, hash []byte, hashVersion int) (gp.UserID, error) {
+	s, err := u.sc.Prepare("INSERT INTO users(firstname, lastname, password, password_version, email) VALUES (?,?,?,?,?)")
+	if err != nil {
+		return 0, err
+	}
+	res, err := s.ExecContext(ctx, first, last, hash, hashVersion, email)
+	if err != nil {
+		return 0, duplicate(err)
+	}
+	id, err := res.LastInsertId()
+	return gp.UserID(id), err
+}
+
+func (u mysqlUsers) Password(ctx context.Context, id gp.UserID) (hash []byte, version int, err error) {
+	s, err := u.sc.Prepare("SELECT password, password_version FROM users WHERE id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, id).Scan(&hash, &version)
+	return
+}
+
+func (u mysqlUsers) PasswordByEmail(ctx context.Context, email string) (id gp.UserID, hash []byte, version int, err error) {
+	s, err := u.sc.Prepare("SELECT id, password, password_version FROM users WHERE email = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, email).Scan(&id, &hash, &version)
+	return
+}
+
+func (u mysqlUsers) SetPassword(ctx context.Context, id gp.UserID, hash []byte, version int) error {
+	return u.exec(ctx, "UPDATE users SET password = ?, password_version = ? WHERE id = ?", hash, version, id)
+}
+
+func (u mysqlUsers) ReplacePassword(ctx context.Context, id gp.UserID, old, hash []byte, version int) error {
+	return u.exec(ctx, "UPDATE users SET password = ?, password_version = ? WHERE id = ? AND password = ?", hash, version, id, old)
+}
+
+func (u mysqlUsers) IsVerified(ctx context.Context, id gp.UserID) (verified bool, err error) {
+	s, err := u.sc.Prepare("SELECT verified FROM users WHERE id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, id).Scan(&verified)
+	return
+}
+
+func (u mysqlUsers) Verify(ctx context.Context, id gp.UserID) error {
+	return u.exec(ctx, "UPDATE users SET verified = 1 WHERE id = ?", id)
+}
+
+func (u mysqlUsers) SetName(ctx context.Context, id gp.UserID, first, last string) error {
+	return u.exec(ctx, "UPDATE users SET firstname = ?, lastname = ? WHERE id = ?", first, last, id)
+}
+
+func (u mysqlUsers) SetAvatar(ctx context.Context, id gp.UserID, url string) error {
+	return u.exec(ctx, "UPDATE users SET avatar = ? WHERE id = ?", url, id)
+}
+
+func (u mysqlUsers) SetTagline(ctx context.Context, id gp.UserID, tagline string) error {
+	return u.exec(ctx, "UPDATE users SET `desc` = ? WHERE id = ?", tagline, id)
+}
+
+func (u mysqlUsers) SetDirectoryEntry(ctx context.Context, id gp.UserID, userType, externalID string) error {
+	return u.exec(ctx, "UPDATE users SET type = ?, external_id = ? WHERE id = ?", userType, externalID, id)
+}
+
+func (u mysqlUsers) Busy(ctx context.Context, id gp.UserID) (busy bool, err error) {
+	s, err := u.sc.Prepare("SELECT busy FROM users WHERE id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, id).Scan(&busy)
+	return
+}
+
+func (u mysqlUsers) SetBusy(ctx context.Context, id gp.UserID, busy bool) error {
+	return u.exec(ctx, "UPDATE users SET busy = ? WHERE id = ?", busy, id)
+}
+
+func (u mysqlUsers) TutorialState(ctx context.Context, id gp.UserID) (tutorials []string, err error) {
+	s, err := u.sc.Prepare("SELECT tutorial_state FROM users WHERE id = ?")
+	if err != nil {
+		return
+	}
+	var ts sql.NullString
+	err = s.QueryRowContext(ctx, id).Scan(&ts)
+	if err != nil || !ts.Valid {
+		return
+	}
+	return strings.Split(ts.String, ","), nil
+}
+
+func (u mysqlUsers) SetTutorialState(ctx context.Context, id gp.UserID, tutorials []string) error {
+	return u.exec(ctx, "UPDATE users SET tutorial_state = ? WHERE id = ?", strings.Join(tutorials, ","), id)
+}
+
+func (u mysqlUsers) exec(ctx context.Context, q string, args ...interface{}) error {
+	s, err := u.sc.Prepare(q)
+	if err != nil {
+		return err
+	}
+	_, err = s.ExecContext(ctx, args...)
+	return err
+}
@@ -0,0 +1,557 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/conf"
+	"github.com/Petergatsby/GleepostAPI/lib/events"
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/store"
+)
+
+//memoryAPI is an API backed by an in-memory store and event bus, for testing without MySQL or redis.
+func memoryAPI(m *store.Memory, bus *events.Memory) *API {
+	st := m.Store()
+	return &API{
+		store:  st,
+		broker: bus,
+		users:  &Users{store: st.Users},
+		Auth:   &Authenticator{users: st.Users, tokens: st.Tokens},
+		nm:     &NetworkManager{networks: st.Networks},
+	}
+}
+
+func TestNotificationActionsInMemory(t *testing.T) {
+	m := store.NewMemory()
+	bus := events.NewMemory()
+	api := memoryAPI(m, bus)
+	ctx := context.Background()
+	var mine []gp.NotificationID
+	for i := 0; i < 3; i++ {
+		mine = append(mine, m.AddNotification(9))
+	}
+	theirs := m.AddNotification(10)
+	m.AddUser(gp.User{ID: 9, Name: "Nine"}, "nine@example.com", false)
+	m.AddUser(gp.User{ID: 10, Name: "Ten"}, "ten@example.com", false)
+	conv, err := api.store.Conversations.Create(ctx, 10, true, 0)
+	if err != nil {
+		t.Fatalf("Error creating conversation: %v", err)
+	}
+	for _, user := range []gp.UserID{9, 10} {
+		if err = api.store.Conversations.AddParticipant(ctx, conv, user); err != nil {
+			t.Fatalf("Error adding participant: %v", err)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		if _, err = api.store.Conversations.AddMessage(ctx, conv, 10, "hi", false); err != nil {
+			t.Fatalf("Error adding message: %v", err)
+		}
+	}
+	m.SetNewPosts(9, 2)
+
+	counts, err := api.BadgeCounts(ctx, 9)
+	if err != nil || counts != (gp.BadgeCounts{Notifications: 3, Messages: 4, Groups: 2}) {
+		t.Fatalf("Unexpected badge counts %+v (%v)", counts, err)
+	}
+	if err = api.SetNotificationSeen(ctx, 9, theirs, true); err != NoSuchNotification {
+		t.Fatalf("Expected NoSuchNotification for someone else's notification, got %v", err)
+	}
+	if err = api.MarkNotificationIDsSeen(ctx, 9, []gp.NotificationID{mine[0], mine[1], theirs}); err != nil {
+		t.Fatalf("Error marking notifications seen: %v", err)
+	}
+	if seen := m.Notifications(10); seen[theirs] {
+		t.Fatal("Someone else's notification was marked seen")
+	}
+	if err = api.SetNotificationSeen(ctx, 9, mine[0], false); err != nil {
+		t.Fatalf("Error marking notification unseen: %v", err)
+	}
+	if err = api.DeleteNotification(ctx, 9, mine[2]); err != nil {
+		t.Fatalf("Error deleting notification: %v", err)
+	}
+	if err = api.DeleteNotification(ctx, 9, mine[2]); err != NoSuchNotification {
+		t.Fatalf("Expected NoSuchNotification deleting twice, got %v", err)
+	}
+	seen := m.Notifications(9)
+	if len(seen) != 2 || seen[mine[0]] || !seen[mine[1]] {
+		t.Fatalf("Unexpected notifications %v", seen)
+	}
+	if err = api.MarkNotificationIDsSeen(ctx, 9, make([]gp.NotificationID, maxBulkNotifications+1)); err != TooManyNotifications {
+		t.Fatalf("Expected TooManyNotifications, got %v", err)
+	}
+
+	//Each change is published to the user's other devices.
+	deadline := time.Now().Add(time.Second)
+	for {
+		messages, _, _, _ := bus.EventsSince(NotificationChannelKey(9), 0)
+		if len(messages) == 3 {
+			for _, message := range messages {
+				var event gp.WrappedEvent
+				if err = json.Unmarshal(message, &event); err != nil || event.Data.Type != events.Badge {
+					t.Fatalf("Expected a badge event, got %s (%v)", message, err)
+				}
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 3 badge events, got %d", len(messages))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTokenExistsInMemory(t *testing.T) {
+	m := store.NewMemory()
+	api := memoryAPI(m, events.NewMemory())
+	ctx := context.Background()
+	now := time.Now().UTC()
+	m.AddToken(9, "current", store.TokenRecord{Expiry: now.Add(time.Hour), Scopes: "read"})
+	m.AddToken(9, "expired", store.TokenRecord{Expiry: now.Add(-time.Minute), Scopes: "read"})
+	m.AddToken(9, "legacy", store.TokenRecord{Expiry: now.Add(24 * time.Hour), Scopes: "", Legacy: true})
+
+	token, err := api.Auth.tokenExists(ctx, 9, "current")
+	if err != nil || len(token.Scopes) != 1 || token.Scopes[0] != "read" {
+		t.Fatalf("Expected a read token, got %+v (%v)", token, err)
+	}
+	if _, err = api.Auth.tokenExists(ctx, 9, "expired"); err == nil {
+		t.Fatal("Expired token accepted")
+	}
+	if _, err = api.Auth.tokenExists(ctx, 10, "current"); err == nil {
+		t.Fatal("Someone else's token accepted")
+	}
+	if _, err = api.Auth.tokenExists(ctx, 9, "legacy"); err != nil {
+		t.Fatalf("Legacy token rejected with no cutoff: %v", err)
+	}
+	api.Auth.config = conf.TokenConfig{LegacyCutoff: now.Add(-time.Hour).Format(time.RFC3339)}
+	if _, err = api.Auth.tokenExists(ctx, 9, "legacy"); err == nil {
+		t.Fatal("Legacy token accepted after the cutoff")
+	}
+}
+
+func TestUsersInMemory(t *testing.T) {
+	m := store.NewMemory()
+	api := memoryAPI(m, events.NewMemory())
+	m.AddUser(gp.User{ID: 9, Name: "Patrick Molgaard"}, "patrick@fakestanford.edu", true)
+	m.AddUser(gp.User{ID: 10, Name: "Bonnie"}, "bonnie@fakestanford.edu", false)
+	m.AddMember(10, 5)
+
+	user, err := api.users.byID(context.Background(), 9)
+	if err != nil || user.Name != "Patrick Molgaard" {
+		t.Fatalf("Unexpected user %+v (%v)", user, err)
+	}
+	if _, err = api.users.byID(context.Background(), 11); err != &gp.ENOSUCHUSER {
+		t.Fatalf("Expected ENOSUCHUSER, got %v", err)
+	}
+	if !api.isAdmin(context.Background(), 9) || api.isAdmin(context.Background(), 10) || api.isAdmin(context.Background(), 11) {
+		t.Fatal("Only Patrick is an admin")
+	}
+	if email, _ := api.getEmail(context.Background(), 10); email != "bonnie@fakestanford.edu" {
+		t.Fatalf("Unexpected email %s", email)
+	}
+	if in, _ := api.UserInNetwork(context.Background(), 10, 5); !in {
+		t.Fatal("Bonnie should be in network 5")
+	}
+	if in, _ := api.UserInNetwork(context.Background(), 9, 5); in {
+		t.Fatal("Patrick shouldn't be in network 5")
+	}
+}
+
+func TestCancelledInMemory(t *testing.T) {
+	m := store.NewMemory()
+	api := memoryAPI(m, events.NewMemory())
+	id := m.AddNotification(9)
+	m.AddToken(9, "current", store.TokenRecord{Expiry: time.Now().Add(time.Hour), Scopes: "read"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := api.BadgeCounts(ctx, 9); err != context.Canceled {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if err := api.SetNotificationSeen(ctx, 9, id, true); err != context.Canceled {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if seen := m.Notifications(9); seen[id] {
+		t.Fatal("Notification marked seen after the request was cancelled")
+	}
+	if api.Auth.ValidateToken(ctx, 9, "current", "read") {
+		t.Fatal("Token validated after the request was cancelled")
+	}
+}
+
+func TestConversationsInMemory(t *testing.T) {
+	m := store.NewMemory()
+	api := memoryAPI(m, events.NewMemory())
+	ctx := context.Background()
+	m.AddUser(gp.User{ID: 9, Name: "Patrick"}, "patrick@fakestanford.edu", false)
+	m.AddUser(gp.User{ID: 10, Name: "Bonnie"}, "bonnie@fakestanford.edu", false)
+	conv, err := api.store.Conversations.Create(ctx, 9, true, 0)
+	if err != nil {
+		t.Fatalf("Error creating conversation: %v", err)
+	}
+	for _, user := range []gp.UserID{9, 10} {
+		if err = api.store.Conversations.AddParticipant(ctx, conv, user); err != nil {
+			t.Fatalf("Error adding participant: %v", err)
+		}
+	}
+	var ids []gp.MessageID
+	for i := 0; i < 5; i++ {
+		id, err := api.addMessage(context.Background(), conv, 10, "hi", false)
+		if err != nil {
+			t.Fatalf("Error adding message: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if unread, _ := api.userConversationUnread(context.Background(), 9, conv); unread != 5 {
+		t.Fatalf("Expected 5 unread, got %d", unread)
+	}
+	if unread, _ := api.userConversationUnread(context.Background(), 10, conv); unread != 0 {
+		t.Fatalf("Your own messages aren't unread, got %d", unread)
+	}
+	if _, err = api.markRead(context.Background(), 9, conv, ids[2]); err != nil {
+		t.Fatalf("Error marking read: %v", err)
+	}
+	if unread, _ := api.userConversationUnread(context.Background(), 9, conv); unread != 2 {
+		t.Fatalf("Expected 2 unread, got %d", unread)
+	}
+	messages, err := api.getMessages(context.Background(), 9, conv, ChronologicallyAfterID, int64(ids[1]), 20)
+	if err != nil || len(messages) != 3 || messages[0].By.Name != "Bonnie" {
+		t.Fatalf("Expected Bonnie's last 3 messages, got %+v (%v)", messages, err)
+	}
+
+	//Deleting the conversation hides what's in it so far.
+	if err = api.setDeletionThreshold(context.Background(), 9, conv, ids[3]); err != nil {
+		t.Fatalf("Error setting deletion threshold: %v", err)
+	}
+	messages, err = api.getMessages(context.Background(), 9, conv, ByOffsetDescending, 0, 20)
+	if err != nil || len(messages) != 1 || messages[0].ID != ids[4] {
+		t.Fatalf("Expected only the last message, got %+v (%v)", messages, err)
+	}
+	if messages, _ = api.getMessages(context.Background(), 10, conv, ByOffsetDescending, 0, 20); len(messages) != 5 {
+		t.Fatalf("Bonnie's copy shouldn't change, got %d messages", len(messages))
+	}
+	if threshold, _ := api.getDeletionThreshold(context.Background(), 9, conv); threshold != ids[3] {
+		t.Fatalf("Expected threshold %d, got %d", ids[3], threshold)
+	}
+}
+
+func TestMessageEditsInMemory(t *testing.T) {
+	m := store.NewMemory()
+	api := memoryAPI(m, events.NewMemory())
+	ctx := context.Background()
+	m.AddUser(gp.User{ID: 9, Name: "Patrick"}, "patrick@fakestanford.edu", false)
+	conv, err := api.store.Conversations.Create(ctx, 9, true, 0)
+	if err != nil {
+		t.Fatalf("Error creating conversation: %v", err)
+	}
+	id, err := api.store.Conversations.AddMessage(ctx, conv, 9, "Helo", false)
+	if err != nil {
+		t.Fatalf("Error adding message: %v", err)
+	}
+	convs := api.store.Conversations
+
+	//The window is checked as the edit happens, not just beforehand.
+	if ok, err := convs.EditMessage(ctx, conv, id, 9, "Hello", 0); ok || err != nil {
+		t.Fatalf("Edited a message outside its window (%v)", err)
+	}
+	if err = api.unchanged(ctx, conv, id); err != EditWindowClosed {
+		t.Fatalf("Expected EditWindowClosed, got %v", err)
+	}
+	if ok, _ := convs.EditMessage(ctx, conv, id, 10, "Hello", time.Hour); ok {
+		t.Fatal("Edited someone else's message")
+	}
+	if ok, err := convs.EditMessage(ctx, conv, id, 9, "Hello", time.Hour); !ok || err != nil {
+		t.Fatalf("Couldn't edit message (%v)", err)
+	}
+	edits, _ := convs.MessageHistory(ctx, id)
+	if len(edits) != 1 || edits[0].Text != "Helo" {
+		t.Fatalf("Expected the original text in the history, got %+v", edits)
+	}
+
+	if ok, err := convs.DeleteMessage(ctx, conv, id, 9, time.Hour); !ok || err != nil {
+		t.Fatalf("Couldn't delete message (%v)", err)
+	}
+	if ok, _ := convs.DeleteMessage(ctx, conv, id, 9, time.Hour); ok {
+		t.Fatal("Deleted a message twice")
+	}
+	if err = api.unchanged(ctx, conv, id); err != NoSuchMessage {
+		t.Fatalf("Expected NoSuchMessage, got %v", err)
+	}
+	message, _ := convs.Message(ctx, conv, id)
+	if !message.Deleted || message.Text != "" {
+		t.Fatalf("Expected a tombstone, got %+v", message)
+	}
+	if edits, _ = convs.MessageHistory(ctx, id); len(edits) != 0 {
+		t.Fatalf("A deleted message's history should go with it, got %+v", edits)
+	}
+}
+
+func TestPostsInMemory(t *testing.T) {
+	m := store.NewMemory()
+	api := memoryAPI(m, events.NewMemory())
+	ctx := context.Background()
+	m.AddUser(gp.User{ID: 9, Name: "Patrick"}, "patrick@fakestanford.edu", false)
+	m.AddUser(gp.User{ID: 10, Name: "Bonnie"}, "bonnie@fakestanford.edu", false)
+	m.AddUser(gp.User{ID: 11, Name: "Mallory"}, "mallory@fakeberkeley.edu", false)
+	m.AddCategory(gp.PostCategory{ID: 1, Tag: "event", Name: "Event"})
+	uni, err := api.createUniversity(ctx, "Stanford")
+	if err != nil {
+		t.Fatalf("Error creating university: %v", err)
+	}
+	if err = api.addNetworkRules(ctx, uni.ID, "fakestanford.edu"); err != nil {
+		t.Fatalf("Error adding rules: %v", err)
+	}
+	for _, email := range []string{"patrick@fakestanford.edu", "bonnie@fakestanford.edu"} {
+		user, _ := api.userWithEmail(ctx, email)
+		if n, err := api.assignNetworks(ctx, user, email); err != nil || n != 1 {
+			t.Fatalf("Expected %s to be put in 1 network, got %d (%v)", email, n, err)
+		}
+	}
+
+	event, err := api.addPost(ctx, 9, "Party", uni.ID, false, []string{"event"}, map[string]string{"event-time": "2026-11-01T18:00:00Z"})
+	if err != nil {
+		t.Fatalf("Error adding post: %v", err)
+	}
+	plain, err := api.addPost(ctx, 9, "Hello", uni.ID, false, nil, nil)
+	if err != nil {
+		t.Fatalf("Error adding post: %v", err)
+	}
+	if _, err = api.addPost(ctx, 9, "Pending", uni.ID, true, nil, nil); err != nil {
+		t.Fatalf("Error adding post: %v", err)
+	}
+	if post, err := api.getPost(ctx, plain); err != nil || post.Text != "Hello" || post.By.ID != 9 {
+		t.Fatalf("Unexpected post %+v (%v)", post, err)
+	}
+	if categories, err := api.postCategories(ctx, event); err != nil || len(categories) != 1 || categories[0].Tag != "event" {
+		t.Fatalf("Unexpected categories %+v (%v)", categories, err)
+	}
+	attribs, err := api.getPostAttribs(ctx, event)
+	if when, ok := attribs["event-time"].(time.Time); err != nil || !ok || !when.Equal(time.Date(2026, 11, 1, 18, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Unexpected attribs %+v (%v)", attribs, err)
+	}
+
+	if changed, err := api.attend(ctx, event, 10); err != nil || !changed {
+		t.Fatalf("Expected attending to change something, got %v (%v)", changed, err)
+	}
+	if changed, err := api.attend(ctx, event, 10); err != nil || changed {
+		t.Fatalf("Attending twice shouldn't change anything, got %v (%v)", changed, err)
+	}
+	if popularity, attendees, err := api.getEventPopularity(ctx, event); err != nil || popularity != 25 || attendees != 1 {
+		t.Fatalf("Unexpected popularity %d, %d (%v)", popularity, attendees, err)
+	}
+	if err = api.createLike(ctx, 10, event); err != nil {
+		t.Fatalf("Error liking post: %v", err)
+	}
+	if _, err = api.createComment(ctx, event, 10, "See you there"); err != nil {
+		t.Fatalf("Error commenting: %v", err)
+	}
+
+	posts, err := api.getUserPosts(ctx, 9, 10, ByOffsetDescending, 0, 10, "")
+	if err != nil || len(posts) != 2 || posts[0].ID != plain || posts[1].ID != event {
+		t.Fatalf("Expected the approved posts, newest first, got %+v (%v)", posts, err)
+	}
+	if posts[1].LikeCount != 1 || posts[1].CommentCount != 1 {
+		t.Fatalf("Expected a like and a comment, got %+v", posts[1])
+	}
+	if posts, _ = api.getUserPosts(ctx, 9, 10, ByOffsetDescending, 0, 10, "event"); len(posts) != 1 || posts[0].ID != event {
+		t.Fatalf("Expected just the event, got %+v", posts)
+	}
+	if posts, _ = api.getUserPosts(ctx, 9, 10, ChronologicallyBeforeID, int64(plain), 10, ""); len(posts) != 1 || posts[0].ID != event {
+		t.Fatalf("Expected the post before %d, got %+v", plain, posts)
+	}
+	if posts, _ = api.getUserPosts(ctx, 9, 11, ByOffsetDescending, 0, 10, ""); len(posts) != 0 {
+		t.Fatalf("Someone in another university shouldn't see these posts, got %+v", posts)
+	}
+	if events, err := api.userAttending(ctx, 9, 10, "", ByOffsetDescending, 0, 10); err != nil || len(events) != 1 || events[0].ID != event {
+		t.Fatalf("Unexpected events %+v (%v)", events, err)
+	}
+
+	if err = api.deletePost(ctx, event); err != nil {
+		t.Fatalf("Error deleting post: %v", err)
+	}
+	if _, err = api.getPost(ctx, event); err != gp.NoSuchPost {
+		t.Fatalf("Expected NoSuchPost for a deleted post, got %v", err)
+	}
+}
+
+func TestNetworksInMemory(t *testing.T) {
+	m := store.NewMemory()
+	api := memoryAPI(m, events.NewMemory())
+	ctx := context.Background()
+	m.AddUser(gp.User{ID: 9, Name: "Patrick"}, "patrick@fakestanford.edu", false)
+	m.AddUser(gp.User{ID: 10, Name: "Bonnie"}, "bonnie@fakestanford.edu", false)
+	uni, err := api.createUniversity(ctx, "Stanford")
+	if err != nil {
+		t.Fatalf("Error creating university: %v", err)
+	}
+	for _, user := range []gp.UserID{9, 10} {
+		if err = api.setNetwork(ctx, user, uni.ID); err != nil {
+			t.Fatalf("Error joining university: %v", err)
+		}
+	}
+	if err = api.setNetwork(ctx, 9, uni.ID); err != AlreadyMember {
+		t.Fatalf("Expected AlreadyMember joining twice, got %v", err)
+	}
+	if _, err = api.masterGroup(ctx, uni.ID); err != NoSuchGroup {
+		t.Fatalf("Expected NoSuchGroup for a university without a master group, got %v", err)
+	}
+
+	group, err := api.createNetwork(ctx, "Running", uni.ID, "", "We run", 9, true, "private", "sports")
+	if err != nil {
+		t.Fatalf("Error creating group: %v", err)
+	}
+	secret, err := api.createNetwork(ctx, "Cabal", uni.ID, "", "", 9, true, "secret", "social")
+	if err != nil {
+		t.Fatalf("Error creating group: %v", err)
+	}
+	for _, g := range []gp.NetworkID{group.ID, secret.ID} {
+		if _, err = api.store.Conversations.Create(ctx, 9, false, g); err != nil {
+			t.Fatalf("Error creating group conversation: %v", err)
+		}
+		if err = api.setNetwork(ctx, 9, g); err != nil {
+			t.Fatalf("Error joining group: %v", err)
+		}
+		if err = api.userSetRole(ctx, 9, g, gp.Role{Name: "creator", Level: 9}); err != nil {
+			t.Fatalf("Error setting role: %v", err)
+		}
+	}
+	if got, err := api.getNetwork(ctx, group.ID); err != nil || got.Creator == nil || got.Creator.ID != 9 || got.MemberCount != 1 || got.Privacy != "private" {
+		t.Fatalf("Unexpected group %+v (%v)", got, err)
+	}
+	if _, err = api.userRole(ctx, 10, group.ID); err != gp.ENOSUCHUSER {
+		t.Fatalf("Expected ENOSUCHUSER for a non-member's role, got %v", err)
+	}
+	if admins, err := api.UserGetGroupAdmins(ctx, 9, group.ID); err != nil || admins == nil || len(admins) != 0 {
+		t.Fatalf("Expected no admins, got %+v (%v)", admins, err)
+	}
+
+	mine, err := api.groupsByActivity(ctx, 9, 0, 10, ByActivity)
+	if err != nil || len(mine) != 2 || mine[0].YourRole == nil || mine[0].YourRole.Name != "creator" {
+		t.Fatalf("Unexpected groups %+v (%v)", mine, err)
+	}
+	if count, err := api.subjectiveMembershipCount(ctx, 10, 9); err != nil || count != 1 {
+		t.Fatalf("Expected Bonnie to see 1 of Patrick's groups, got %d (%v)", count, err)
+	}
+	theirs, err := api.subjectiveMemberships(ctx, 10, 9, 0, 10)
+	if err != nil || len(theirs) != 1 || theirs[0].ID != group.ID || theirs[0].TheirRole.Name != "creator" || theirs[0].YourRole != nil {
+		t.Fatalf("Unexpected groups %+v (%v)", theirs, err)
+	}
+	if popular, err := api.GroupsByMembershipCount(ctx, 10, 0, 10, "sports"); err != nil || len(popular) != 1 || popular[0].MemberCount != 1 {
+		t.Fatalf("Unexpected popular groups %+v (%v)", popular, err)
+	}
+	if popular, _ := api.GroupsByMembershipCount(ctx, 10, 0, 10, "social"); len(popular) != 0 {
+		t.Fatalf("Secret groups shouldn't be popular, got %+v", popular)
+	}
+
+	if err = api.store.Networks.Request(ctx, 10, group.ID); err != nil {
+		t.Fatalf("Error requesting access: %v", err)
+	}
+	if err = api.store.Networks.Request(ctx, 10, group.ID); err != store.ErrExists {
+		t.Fatalf("Expected ErrExists requesting twice, got %v", err)
+	}
+	requests, err := api.NetworkRequests(ctx, 9, group.ID)
+	if err != nil || len(requests) != 1 || requests[0].Requester.ID != 10 {
+		t.Fatalf("Unexpected requests %+v (%v)", requests, err)
+	}
+	if err = api.setRequestStatus(ctx, 10, group.ID, "accepted", 9); err != nil {
+		t.Fatalf("Error accepting request: %v", err)
+	}
+	if status, err := api.pendingRequestExists(ctx, 10, group.ID); err != nil || status != "accepted" {
+		t.Fatalf("Unexpected request status %q (%v)", status, err)
+	}
+	if requests, _ = api.NetworkRequests(ctx, 9, group.ID); len(requests) != 0 {
+		t.Fatalf("Expected no pending requests, got %+v", requests)
+	}
+
+	if err = api.leaveNetwork(ctx, 9, secret.ID); err != nil {
+		t.Fatalf("Error leaving group: %v", err)
+	}
+	if in, _ := api.UserInNetwork(ctx, 9, secret.ID); in {
+		t.Fatal("Still in a group after leaving it")
+	}
+}
+
+func TestApprovalsInMemory(t *testing.T) {
+	m := store.NewMemory()
+	api := memoryAPI(m, events.NewMemory())
+	ctx := context.Background()
+	m.AddUser(gp.User{ID: 9, Name: "Patrick"}, "patrick@fakestanford.edu", false)
+	m.AddUser(gp.User{ID: 10, Name: "Bonnie"}, "bonnie@fakestanford.edu", false)
+	uni, err := api.createUniversity(ctx, "Stanford")
+	if err != nil {
+		t.Fatalf("Error creating university: %v", err)
+	}
+	staff, err := api.createNetwork(ctx, "Staff", uni.ID, "", "", 9, true, "secret", "")
+	if err != nil {
+		t.Fatalf("Error creating group: %v", err)
+	}
+	m.SetMasterGroup(uni.ID, staff.ID)
+	m.AddMember(9, uni.ID)
+	m.AddMember(10, uni.ID)
+	m.AddMember(9, staff.ID)
+	if err = api.userSetRole(ctx, 9, staff.ID, gp.Role{Name: "administrator", Level: 8}); err != nil {
+		t.Fatalf("Error setting role: %v", err)
+	}
+
+	if perm, err := api.approveAccess(ctx, 10, uni.ID); err != nil || perm.ApproveAccess || perm.LevelChange {
+		t.Fatalf("Bonnie shouldn't be able to review, got %+v (%v)", perm, err)
+	}
+	if perm, err := api.approveAccess(ctx, 9, uni.ID); err != nil || !perm.ApproveAccess || !perm.LevelChange {
+		t.Fatalf("Patrick should be able to review, got %+v (%v)", perm, err)
+	}
+	if err = api.setApproveLevel(ctx, uni.ID, 2); err != nil {
+		t.Fatalf("Error setting approve level: %v", err)
+	}
+	if err = api.setApproveLevel(ctx, uni.ID, 2); err != NotChanged {
+		t.Fatalf("Expected NotChanged setting the same level, got %v", err)
+	}
+	if level, err := api.approveLevel(ctx, uni.ID); err != nil || level.Level != 2 || len(level.Categories) != 1 || level.Categories[0] != "event" {
+		t.Fatalf("Unexpected approve level %+v (%v)", level, err)
+	}
+
+	post, err := api.addPost(ctx, 10, "Party", uni.ID, true, nil, nil)
+	if err != nil {
+		t.Fatalf("Error adding post: %v", err)
+	}
+	if pending, err := api.pendingPosts(ctx, uni.ID); err != nil || len(pending) != 1 || pending[0].ID != post {
+		t.Fatalf("Unexpected pending posts %+v (%v)", pending, err)
+	}
+	if err = api.rejectPost(ctx, 9, post, "Too loud"); err != nil {
+		t.Fatalf("Error rejecting post: %v", err)
+	}
+	if rejected, err := api.getNetworkRejected(ctx, uni.ID, ByOffsetDescending, 0, 10); err != nil || len(rejected) != 1 {
+		t.Fatalf("Unexpected rejected posts %+v (%v)", rejected, err)
+	}
+	if mine, err := api.userPendingPosts(ctx, 10); err != nil || len(mine) != 1 {
+		t.Fatalf("A rejected post should still be the author's to fix, got %+v (%v)", mine, err)
+	}
+	if err = api.resubmitPost(ctx, 10, post, "Quieter"); err != nil {
+		t.Fatalf("Error resubmitting post: %v", err)
+	}
+	if err = api.approvePost(ctx, 9, post, ""); err != nil {
+		t.Fatalf("Error approving post: %v", err)
+	}
+	if status, err := api.pendingStatus(ctx, post); err != nil || status != 0 {
+		t.Fatalf("Expected the post to be approved, got %d (%v)", status, err)
+	}
+	if approved, err := api.getNetworkApproved(ctx, uni.ID, ByOffsetDescending, 0, 10); err != nil || len(approved) != 1 {
+		t.Fatalf("Unexpected approved posts %+v (%v)", approved, err)
+	}
+	if rejected, _ := api.getNetworkRejected(ctx, uni.ID, ByOffsetDescending, 0, 10); len(rejected) != 0 {
+		t.Fatalf("An approved post isn't rejected any more, got %+v", rejected)
+	}
+	history, err := api.reviewHistory(ctx, post)
+	if err != nil || len(history) != 3 {
+		t.Fatalf("Unexpected history %+v (%v)", history, err)
+	}
+	for i, action := range []string{"rejected", "edited", "approved"} {
+		if history[i].Action != action {
+			t.Fatalf("Expected %s at %d, got %+v", action, i, history)
+		}
+	}
+	if history[1].By.ID != 10 {
+		t.Fatalf("Expected Bonnie to have edited the post, got %+v", history[1].By)
+	}
+}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"math/rand"
@@ -11,22 +12,22 @@ import (
 )
 
 //AdminCreateTemplateFromPost saves a Post as a Template, so it can be used again.
-func (api *API) AdminCreateTemplateFromPost(admin gp.UserID, post gp.PostID) (templateID gp.TemplateID, err error) {
-	if !api.isAdmin(admin) {
+func (api *API) AdminCreateTemplateFromPost(ctx context.Context, admin gp.UserID, post gp.PostID) (templateID gp.TemplateID, err error) {
+	if !api.isAdmin(ctx, admin) {
 		err = ENOTALLOWED
 		return
 	}
-	p, err := api.getPostFull(admin, post)
+	p, err := api.getPostFull(ctx, admin, post)
 	if err != nil {
 		return
 	}
-	return api.createTemplateFromPost(p)
+	return api.createTemplateFromPost(ctx, p)
 }
 
 //CreateTemplateFromPost saves a Post as a Template, so it can be used again.
-func (api *API) createTemplateFromPost(post gp.PostFull) (templateID gp.TemplateID, err error) {
+func (api *API) createTemplateFromPost(ctx context.Context, post gp.PostFull) (templateID gp.TemplateID, err error) {
 	template, err := json.MarshalIndent(post, "", "\t")
-	templateID, err = api.createTemplate(1, string(template))
+	templateID, err = api.createTemplate(ctx, 1, string(template))
 	return
 }
 
@@ -39,22 +40,22 @@ func (api *API) CreatePostFromTemplate(network gp.NetworkID, template string) (p
 }
 
 //AdminPrefillUniversity adds posts generated from this template set to this university, filling in any instances of <university> with universityName.
-func (api *API) AdminPrefillUniversity(admin gp.UserID, network gp.NetworkID, universityName string) (err error) {
-	if !api.isAdmin(admin) {
+func (api *API) AdminPrefillUniversity(ctx context.Context, admin gp.UserID, network gp.NetworkID, universityName string) (err error) {
+	if !api.isAdmin(ctx, admin) {
 		err = ENOTALLOWED
 		return
 	}
-	return api.prefillUniversity(network, 1, universityName)
+	return api.prefillUniversity(ctx, network, 1, universityName)
 }
 
 //PrefillUniversity adds posts generated from this template set to this university, filling in any instances of <university> with universityName.
-func (api *API) prefillUniversity(network gp.NetworkID, templateSet gp.TemplateGroupID, universityName string) (err error) {
+func (api *API) prefillUniversity(ctx context.Context, network gp.NetworkID, templateSet gp.TemplateGroupID, universityName string) (err error) {
 	//Retreive all posts in this template set
-	templates, err := api.getTemplateSet(templateSet)
+	templates, err := api.getTemplateSet(ctx, templateSet)
 	if err != nil {
 		return
 	}
-	domain, err := api.networkDomain(network)
+	domain, err := api.networkDomain(ctx, network)
 	if err != nil {
 		return
 	}
@@ -86,7 +87,7 @@ func (api *API) prefillUniversity(network gp.NetworkID, templateSet gp.TemplateG
 		if shouldFuturize {
 			post.Attribs["meta-future"] = randomFuture()
 		}
-		user, e := up.DuplicateUser(post.By.ID)
+		user, e := up.DuplicateUser(ctx, post.By.ID)
 		if e != nil {
 			return e
 		}
@@ -104,7 +105,7 @@ func (api *API) prefillUniversity(network gp.NetworkID, templateSet gp.TemplateG
 			tags = append(tags, cat.Tag)
 		}
 		//TODO(patrick) -- come back here and add the polling stuff
-		_, _, err = api.UserAddPost(user, network, post.Text, attribs, video, true, image, "", []string{}, tags...)
+		_, _, err = api.UserAddPost(ctx, user, network, post.Text, attribs, video, true, image, "", []string{}, tags...)
 		if err != nil {
 			return
 		}
@@ -121,9 +122,9 @@ type userPool struct {
 }
 
 //DuplicateUser creates a new user in this userPool, or returns the existing one if it's an id we've seen before.
-func (up *userPool) DuplicateUser(userID gp.UserID) (u gp.UserID, err error) {
+func (up *userPool) DuplicateUser(ctx context.Context, userID gp.UserID) (u gp.UserID, err error) {
 	var userProfile gp.Profile
-	userProfile, err = up.api.getProfile(userID, userID)
+	userProfile, err = up.api.getProfile(ctx, userID, userID)
 	if err != nil {
 		return
 	}
@@ -138,11 +139,11 @@ func (up *userPool) DuplicateUser(userID gp.UserID) (u gp.UserID, err error) {
 		return u, nil
 	}
 	//TODO(patrick): Add check here if this email address already exists. Maybe change the map to email[userID]
-	u, err = up.api.createUserSpecial(userProfile.Name, lastName, email, "TestingPass", true, up.network)
+	u, err = up.api.createUserSpecial(ctx, userProfile.Name, lastName, email, "TestingPass", true, up.network)
 	if err != nil {
 		return
 	}
-	err = up.api.setProfileImage(userID, userProfile.Avatar)
+	err = up.api.setProfileImage(ctx, userID, userProfile.Avatar)
 	if err != nil {
 		return
 	}
@@ -155,12 +156,12 @@ func randomFuture() string {
 }
 
 //CreateTemplate saves this post template to the db, as part of template-set group, returning its id.
-func (api *API) createTemplate(group gp.TemplateGroupID, template string) (id gp.TemplateID, err error) {
+func (api *API) createTemplate(ctx context.Context, group gp.TemplateGroupID, template string) (id gp.TemplateID, err error) {
 	s, err := api.sc.Prepare("INSERT INTO post_templates (`set`, template) VALUES (?, ?)")
 	if err != nil {
 		return
 	}
-	res, err := s.Exec(group, template)
+	res, err := s.ExecContext(ctx, group, template)
 	if err != nil {
 		return
 	}
@@ -173,22 +174,22 @@ func (api *API) createTemplate(group gp.TemplateGroupID, template string) (id gp
 }
 
 //GetTemplate returns a specific template.
-func (api *API) getTemplate(id gp.TemplateID) (template string, err error) {
+func (api *API) getTemplate(ctx context.Context, id gp.TemplateID) (template string, err error) {
 	s, err := api.sc.Prepare("SELECT template FROM post_templates WHERE id = ?")
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(id).Scan(&template)
+	err = s.QueryRowContext(ctx, id).Scan(&template)
 	return
 }
 
 //GetTemplateSet returns all the post templates in this set.
-func (api *API) getTemplateSet(set gp.TemplateGroupID) (templates []string, err error) {
+func (api *API) getTemplateSet(ctx context.Context, set gp.TemplateGroupID) (templates []string, err error) {
 	s, err := api.sc.Prepare("SELECT template FROM post_templates WHERE `set` = ?")
 	if err != nil {
 		return
 	}
-	rows, err := s.Query(set)
+	rows, err := s.QueryContext(ctx, set)
 	if err != nil {
 		return
 	}
@@ -205,11 +206,11 @@ func (api *API) getTemplateSet(set gp.TemplateGroupID) (templates []string, err
 }
 
 //UpdateTemplate saves a new Template
-func (api *API) updateTemplate(id gp.TemplateID, group gp.TemplateGroupID, template string) (err error) {
+func (api *API) updateTemplate(ctx context.Context, id gp.TemplateID, group gp.TemplateGroupID, template string) (err error) {
 	s, err := api.sc.Prepare("REPLACE INTO post_templates (id, `set`, template) VALUES (?, ?, ?)")
 	if err != nil {
 		return
 	}
-	_, err = s.Exec(id, group, template)
+	_, err = s.ExecContext(ctx, id, group, template)
 	return
 }
@@ -0,0 +1,137 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+//RateLimited is returned when there have been too many failed attempts from this email or IP, and the client has to wait before trying again.
+type RateLimited struct {
+	RetryAfter time.Duration
+}
+
+func (e RateLimited) Error() string {
+	return "Too many attempts; try again later"
+}
+
+//throttleKey is where we count attempts at action (login, reset) by this email or ip.
+func throttleKey(action, kind, who string) string {
+	return fmt.Sprintf("throttle:%s:%s:%s", action, kind, strings.ToLower(who))
+}
+
+//backoff is how long to wait after this many failures: nothing for the first few, then doubling from one second up to max.
+func backoff(failures, free int, max time.Duration) time.Duration {
+	if failures <= free {
+		return 0
+	}
+	exp := uint(failures - free - 1)
+	if exp > 30 {
+		return max
+	}
+	wait := time.Second << exp
+	if wait > max {
+		return max
+	}
+	return wait
+}
+
+//throttled returns how long this email and ip have to wait before they may attempt action again.
+//If redis is unavailable we let everyone through rather than locking everyone out.
+func (auth *Authenticator) throttled(ctx context.Context, action, email, ip string) (wait time.Duration) {
+	conn := redisConn(ctx, auth.pool)
+	defer conn.Close()
+	for _, key := range []string{throttleKey(action, "email", email), throttleKey(action, "ip", ip)} {
+		ttl, err := redis.Int(conn.Do("PTTL", key+":until"))
+		if err != nil {
+			log.Println("Error checking throttle:", err)
+			continue
+		}
+		if d := time.Duration(ttl) * time.Millisecond; d > wait {
+			wait = d
+		}
+	}
+	return
+}
+
+//recordAttempt counts an attempt at action by this email and ip and sets their backoff accordingly.
+//It returns the number of recent attempts by this email; once that reaches the lockout threshold the email is locked out for the lockout period.
+//Hanging up early mustn't let an attempt go uncounted, so it doesn't take the request's context.
+func (auth *Authenticator) recordAttempt(action, email, ip string) (attempts int) {
+	conn := auth.pool.Get()
+	defer conn.Close()
+	window := int(auth.throttle.LockoutTTL().Seconds())
+	emailKey := throttleKey(action, "email", email)
+	ipKey := throttleKey(action, "ip", ip)
+	attempts, err := redis.Int(conn.Do("INCR", emailKey))
+	if err != nil {
+		log.Println("Error recording attempt:", err)
+		return 0
+	}
+	conn.Send("EXPIRE", emailKey, window)
+	wait := backoff(attempts, auth.throttle.Free(), auth.throttle.LockoutTTL())
+	if attempts >= auth.throttle.Lockout() {
+		wait = auth.throttle.LockoutTTL()
+	}
+	if wait > 0 {
+		conn.Send("SET", emailKey+":until", 1, "PX", int64(wait/time.Millisecond))
+	}
+	conn.Flush()
+	if len(ip) == 0 {
+		return
+	}
+	ipAttempts, err := redis.Int(conn.Do("INCR", ipKey))
+	if err != nil {
+		log.Println("Error recording attempt:", err)
+		return
+	}
+	conn.Send("EXPIRE", ipKey, window)
+	if wait := backoff(ipAttempts, auth.throttle.FreeIP(), auth.throttle.LockoutTTL()); wait > 0 {
+		conn.Send("SET", ipKey+":until", 1, "PX", int64(wait/time.Millisecond))
+	}
+	conn.Flush()
+	return
+}
+
+//clearAttempts forgets about this email's failed attempts, eg once they've logged in successfully.
+//The IP's count stays, otherwise an attacker could reset it by logging in to their own account.
+func (auth *Authenticator) clearAttempts(action, email string) {
+	conn := auth.pool.Get()
+	defer conn.Close()
+	key := throttleKey(action, "email", email)
+	conn.Do("DEL", key, key+":until")
+}
+
+//notifyLockout lets a user know their account has been locked after too many failed logins.
+//It sends its email after the login has been refused, so it doesn't share the request's context.
+func (api *API) notifyLockout(email string) {
+	ctx := context.Background()
+	userID, err := api.userWithEmail(ctx, email)
+	if err != nil {
+		return
+	}
+	user, err := api.users.byID(ctx, userID)
+	if err != nil {
+		log.Println("Error getting locked out user:", err)
+		return
+	}
+	minutes := int(api.Config.Throttle.LockoutTTL().Minutes())
+	html := fmt.Sprintf("<html><body>There were too many failed attempts to log in to your Gleepost account, so we've locked it for %d minutes.<br>If this wasn't you, you may want to <a href=\"https://gleepost.com/reset_password.html\">reset your password</a>.</body></html>", minutes)
+	err = api.Mail.SendHTML(email, user.Name+", your Gleepost account has been locked", html)
+	if err != nil {
+		log.Println("Error sending lockout email:", err)
+	}
+}
+
+//recordFailedLogin counts a failed login, and emails the user if it's just locked their account.
+func (api *API) recordFailedLogin(ctx context.Context, email, ip string) {
+	attempts := api.Auth.recordAttempt("login", email, ip)
+	if attempts == api.Config.Throttle.Lockout() {
+		go api.Statsd.Count(1, "gleepost.auth.login.lockout")
+		go api.notifyLockout(email)
+	}
+}
@@ -0,0 +1,88 @@
+//Package totp implements the time-based one-time passwords (RFC 6238) used by authenticator apps.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	//Period is the number of seconds each code is valid for.
+	Period = 30
+	//Digits is the length of a code.
+	Digits = 6
+	//Skew is how many periods either side of now we will still accept, to allow for clock drift.
+	Skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+//NewSecret generates a random 160-bit secret, base32 encoded as authenticator apps expect.
+func NewSecret() (secret string, err error) {
+	b := make([]byte, 20)
+	_, err = rand.Read(b)
+	if err != nil {
+		return
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+//URI returns an otpauth:// URI which authenticator apps can import (usually from a QR code).
+func URI(secret, issuer, account string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprintf("%d", Digits))
+	v.Set("period", fmt.Sprintf("%d", Period))
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+//Step returns the time step which t falls in.
+func Step(t time.Time) int64 {
+	return t.Unix() / Period
+}
+
+//Code computes the code for the given secret at time step.
+func Code(secret string, step int64) (code string, err error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return
+	}
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, value%1000000), nil
+}
+
+//Validate checks code against secret at time t, allowing Skew steps of drift.
+//It returns the matching step so that callers can refuse to accept the same code twice.
+func Validate(secret, code string, t time.Time) (step int64, ok bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+	now := Step(t)
+	for s := now - Skew; s <= now+Skew; s++ {
+		expected, err := Code(secret, s)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return s, true
+		}
+	}
+	return 0, false
+}
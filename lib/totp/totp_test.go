@@ -0,0 +1,52 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+//The SHA1 vectors from RFC 6238 appendix B, truncated to six digits.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+type codeTest struct {
+	unix int64
+	code string
+}
+
+func TestCode(t *testing.T) {
+	tests := []codeTest{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1111111111, code: "050471"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 2000000000, code: "279037"},
+	}
+	for _, test := range tests {
+		code, err := Code(rfcSecret, Step(time.Unix(test.unix, 0)))
+		if err != nil {
+			t.Fatalf("Error generating code: %v", err)
+		}
+		if code != test.code {
+			t.Fatalf("Wrong code at %d: expected %s, got %s", test.unix, test.code, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatalf("Error generating secret: %v", err)
+	}
+	now := time.Now()
+	previous, _ := Code(secret, Step(now)-1)
+	if _, ok := Validate(secret, previous, now); !ok {
+		t.Fatalf("Code from the previous step should be accepted")
+	}
+	stale, _ := Code(secret, Step(now)-3)
+	if _, ok := Validate(secret, stale, now); ok {
+		t.Fatalf("Code from three steps ago should be rejected")
+	}
+	if _, ok := Validate(secret, "12345", now); ok {
+		t.Fatalf("Short code should be rejected")
+	}
+}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
@@ -49,11 +50,11 @@ type s3bucket struct {
 	name   string
 }
 
-func (api *API) getBucket(user gp.UserID) (b *s3.Bucket) {
+func (api *API) getBucket(ctx context.Context, user gp.UserID) (b *s3.Bucket) {
 	var auth aws.Auth
 	auth.AccessKey, auth.SecretKey = api.Config.AWS.KeyID, api.Config.AWS.SecretKey
 	bucketMapping := map[gp.NetworkID]s3bucket{1911: {region: aws.USWest, name: "gpcali"}}
-	primary, _ := api.getUserUniversity(user)
+	primary, _ := api.getUserUniversity(ctx, user)
 	s3bucket, ok := bucketMapping[primary.ID]
 	if ok {
 		b = s3.New(auth, s3bucket.region).Bucket(s3bucket.name)
@@ -64,7 +65,7 @@ func (api *API) getBucket(user gp.UserID) (b *s3.Bucket) {
 }
 
 //EnqueueVideo takes a user-uploaded video and enqueues it for processing.
-func (api *API) EnqueueVideo(user gp.UserID, file multipart.File, header *multipart.FileHeader, shouldRotate bool) (inProgress gp.UploadStatus, err error) {
+func (api *API) EnqueueVideo(ctx context.Context, user gp.UserID, file multipart.File, header *multipart.FileHeader, shouldRotate bool) (inProgress gp.UploadStatus, err error) {
 	ext := filepath.Ext(header.Filename)
 	if ext == "" {
 		return inProgress, errors.New("unsupported video type")
@@ -87,22 +88,22 @@ func (api *API) EnqueueVideo(user gp.UserID, file multipart.File, header *multip
 	video.ShouldRotate = shouldRotate
 	video.Status = "uploaded"
 	video.Owner = user
-	id, err := api.setUploadStatus(video)
+	id, err := api.setUploadStatus(ctx, video)
 	if err != nil {
 		return video, err
 	}
-	err = api.createJob(url, "webm", shouldRotate, id)
+	err = api.createJob(ctx, url, "webm", shouldRotate, id)
 	if err != nil {
 		return video, err
 	}
-	err = api.createJob(url, "jpg", shouldRotate, id)
+	err = api.createJob(ctx, url, "jpg", shouldRotate, id)
 	if err != nil {
 		return video, err
 	}
 	video.ID = id
 	video.MP4 = url
 	video.Uploaded = true
-	_, err = api.setUploadStatus(video)
+	_, err = api.setUploadStatus(ctx, video)
 	if err != nil {
 		log.Println("Error saving mp4 url:", err)
 	}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -25,7 +26,7 @@ type transcodeWorker struct {
 	sc     *psc.StatementCache
 	tq     transcode.Queue
 	b      *s3.Bucket
-	broker *events.Broker
+	broker events.EventBus
 }
 
 //TranscodeWorker reads jobs from a queue, transcodes them and marks them as "done" in the queue.
@@ -35,7 +36,7 @@ type TranscodeWorker interface {
 	handleDone()
 }
 
-func newTranscodeWorker(db *sql.DB, sc *psc.StatementCache, tq transcode.Queue, b *s3.Bucket, broker *events.Broker) (t TranscodeWorker) {
+func newTranscodeWorker(db *sql.DB, sc *psc.StatementCache, tq transcode.Queue, b *s3.Bucket, broker events.EventBus) (t TranscodeWorker) {
 	t = transcodeWorker{db: db, sc: sc, tq: tq, b: b, broker: broker}
 	go t.claimLoop()
 	go t.handleDone()
@@ -58,13 +59,13 @@ func (s StubTranscodeWorker) handleDone() {
 	return
 }
 
-func (t transcodeWorker) claimJobs() (err error) {
+func (t transcodeWorker) claimJobs(ctx context.Context) (err error) {
 	s, err := t.sc.Prepare("SELECT id, source, target, rotate FROM `video_jobs` WHERE completion_time IS NULL AND (claim_time IS NULL OR claim_time < ?)")
 	if err != nil {
 		return
 	}
 	since := time.Now().UTC().Add(-30 * time.Second)
-	rows, err := s.Query(since)
+	rows, err := s.QueryContext(ctx, since)
 	if err != nil {
 		return
 	}
@@ -81,7 +82,7 @@ func (t transcodeWorker) claimJobs() (err error) {
 		if err != nil {
 			return
 		}
-		_, err = claimStmt.Exec(id)
+		_, err = claimStmt.ExecContext(ctx, id)
 		if err != nil {
 			return
 		}
@@ -110,9 +111,10 @@ func (t transcodeWorker) claimJobs() (err error) {
 }
 
 func (t transcodeWorker) claimLoop() {
+	ctx := context.Background()
 	tick := time.Tick(500 * time.Millisecond)
 	for {
-		err := t.claimJobs()
+		err := t.claimJobs(ctx)
 		if err != nil {
 			log.Println("Error claiming some transcode jobs?", err)
 		}
@@ -121,6 +123,7 @@ func (t transcodeWorker) claimLoop() {
 }
 
 func (t transcodeWorker) handleDone() {
+	ctx := context.Background()
 	results := t.tq.Results()
 	for res := range results {
 		if res.Error != nil {
@@ -137,7 +140,7 @@ func (t transcodeWorker) handleDone() {
 			continue
 		}
 		//Mark job "done"
-		err = t.done(res.ID, url)
+		err = t.done(ctx, res.ID, url)
 		if err != nil {
 			log.Println("Couldn't mark job as done:", err)
 		}
@@ -145,36 +148,36 @@ func (t transcodeWorker) handleDone() {
 		if err != nil {
 			log.Println("Error removing tmp file:", err)
 		}
-		t.maybeReady(res.ID)
+		t.maybeReady(ctx, res.ID)
 	}
 }
 
-func (t transcodeWorker) maybeReady(jobID uint64) {
+func (t transcodeWorker) maybeReady(ctx context.Context, jobID uint64) {
 	var video gp.UploadStatus
 	var thumb string
-	err := t.db.QueryRow("SELECT upload_id, url, mp4_url, webm_url, user_id FROM uploads JOIN video_jobs ON upload_id = video_jobs.parent_id WHERE url IS NOT NULL AND mp4_url IS NOT NULL AND webm_url IS NOT NULL AND video_jobs.id = ?", jobID).Scan(&video.ID, &thumb, &video.MP4, &video.WebM, &video.Owner)
+	err := t.db.QueryRowContext(ctx, "SELECT upload_id, url, mp4_url, webm_url, user_id FROM uploads JOIN video_jobs ON upload_id = video_jobs.parent_id WHERE url IS NOT NULL AND mp4_url IS NOT NULL AND webm_url IS NOT NULL AND video_jobs.id = ?", jobID).Scan(&video.ID, &thumb, &video.MP4, &video.WebM, &video.Owner)
 	if err != nil {
 		log.Println("Error getting parent video:", err)
 		return
 	}
-	_, err = t.db.Exec("UPDATE uploads SET status = 'ready' WHERE upload_id = ?", video.ID)
+	_, err = t.db.ExecContext(ctx, "UPDATE uploads SET status = 'ready' WHERE upload_id = ?", video.ID)
 	if err != nil {
 		log.Println("Error marking ready:", err)
 		return
 	}
 	video.Status = "ready"
 	video.Thumbs = append(video.Thumbs, thumb)
-	t.broker.PublishEvent("video-ready", fmt.Sprintf("/videos/%d", video.ID), video, []string{NotificationChannelKey(video.Owner)})
+	t.broker.PublishEvent(events.VideoReady, fmt.Sprintf("/videos/%d", video.ID), video, []string{NotificationChannelKey(video.Owner)})
 
 }
 
-func (t transcodeWorker) done(jobID uint64, URL string) (err error) {
-	_, err = t.db.Query("UPDATE `video_jobs` SET completion_time = NOW() WHERE id = ?", jobID)
+func (t transcodeWorker) done(ctx context.Context, jobID uint64, URL string) (err error) {
+	_, err = t.db.QueryContext(ctx, "UPDATE `video_jobs` SET completion_time = NOW() WHERE id = ?", jobID)
 	if err != nil {
 		return
 	}
 	var fileType string
-	err = t.db.QueryRow("SELECT target FROM video_jobs WHERE id = ?", jobID).Scan(&fileType)
+	err = t.db.QueryRowContext(ctx, "SELECT target FROM video_jobs WHERE id = ?", jobID).Scan(&fileType)
 	if err != nil {
 		return
 	}
@@ -188,7 +191,7 @@ func (t transcodeWorker) done(jobID uint64, URL string) (err error) {
 		q = "UPDATE uploads SET url = ? WHERE upload_id = (SELECT parent_id FROM video_jobs WHERE id = ?)"
 	}
 
-	_, err = t.db.Exec(q, URL, jobID)
+	_, err = t.db.ExecContext(ctx, q, URL, jobID)
 	return
 }
 
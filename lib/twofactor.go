@@ -0,0 +1,495 @@
+package lib
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/totp"
+	"github.com/garyburd/redigo/redis"
+)
+
+var (
+	//BadChallenge means the login challenge you're answering has expired, been used, or never existed.
+	BadChallenge = gp.APIerror{Reason: "Login challenge expired or invalid"}
+	//BadTwoFactorCode means the code (or recovery code) you gave was wrong.
+	BadTwoFactorCode = gp.APIerror{Reason: "Invalid two-factor code"}
+	//TwoFactorNotEnrolled means you tried to use two-factor authentication without setting it up first.
+	TwoFactorNotEnrolled = gp.APIerror{Reason: "Two-factor authentication is not set up"}
+	//TwoFactorAlreadyEnabled means you tried to set up two-factor authentication twice.
+	TwoFactorAlreadyEnabled = gp.APIerror{Reason: "Two-factor authentication is already enabled"}
+	//SecondFactorRequired means this session has to be logged in with two-factor authentication to do this.
+	SecondFactorRequired = gp.APIerror{Reason: "You must log in with two-factor authentication to do this"}
+	//TwoFactorEnrolmentRequired means you have to set up two-factor authentication before you can do this.
+	TwoFactorEnrolmentRequired = gp.APIerror{Reason: "You must set up two-factor authentication to do this"}
+	//CantDisableTwoFactor means one of your networks requires you to keep two-factor authentication on.
+	CantDisableTwoFactor = gp.APIerror{Reason: "Two-factor authentication is required for your account"}
+)
+
+const (
+	challengeTTL      = 300 //seconds
+	challengeFailures = 5
+	recoveryCodeCount = 10
+)
+
+//challenge is what we remember between the two steps of a two-factor login.
+type challenge struct {
+	UserID gp.UserID `json:"user"`
+	Device string    `json:"device"`
+	Scopes []string  `json:"scopes"`
+}
+
+func challengeKey(id string) string {
+	return fmt.Sprintf("2fa:challenge:%s", id)
+}
+
+//createChallenge remembers that this user has given the right password, for long enough to give us their code.
+func (auth *Authenticator) createChallenge(ctx context.Context, userID gp.UserID, device string, scopes []string) (id string, err error) {
+	id, err = randomString()
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(challenge{UserID: userID, Device: device, Scopes: scopes})
+	if err != nil {
+		return
+	}
+	conn := redisConn(ctx, auth.pool)
+	defer conn.Close()
+	_, err = conn.Do("SETEX", challengeKey(id), challengeTTL, data)
+	return
+}
+
+//challenge looks up an outstanding login challenge, or returns BadChallenge.
+func (auth *Authenticator) challenge(ctx context.Context, id string) (c challenge, err error) {
+	conn := redisConn(ctx, auth.pool)
+	defer conn.Close()
+	data, err := redis.Bytes(conn.Do("GET", challengeKey(id)))
+	if err != nil {
+		return c, BadChallenge
+	}
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return c, BadChallenge
+	}
+	return
+}
+
+//failChallenge counts a wrong code against this challenge, and throws it away once there have been too many.
+//Like recordAttempt, it counts even if the client has hung up.
+func (auth *Authenticator) failChallenge(id string) {
+	conn := auth.pool.Get()
+	defer conn.Close()
+	key := challengeKey(id) + ":failures"
+	failures, err := redis.Int(conn.Do("INCR", key))
+	if err != nil {
+		log.Println("Error counting challenge failure:", err)
+		return
+	}
+	conn.Do("EXPIRE", key, challengeTTL)
+	if failures >= challengeFailures {
+		conn.Do("DEL", challengeKey(id), key)
+	}
+}
+
+//discardChallenge uses up this challenge. It returns false if someone else got there first.
+func (auth *Authenticator) discardChallenge(ctx context.Context, id string) bool {
+	conn := redisConn(ctx, auth.pool)
+	defer conn.Close()
+	deleted, err := redis.Int(conn.Do("DEL", challengeKey(id), challengeKey(id)+":failures"))
+	return err == nil && deleted > 0
+}
+
+//checkCode returns true if code is currently valid for secret. Each code is only accepted once.
+//Marking a code used can't be skipped once it's been accepted, so this doesn't take the request's context either.
+func (auth *Authenticator) checkCode(userID gp.UserID, secret, code string) bool {
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return false
+	}
+	conn := auth.pool.Get()
+	defer conn.Close()
+	key := fmt.Sprintf("users:%d:2fa:last_step", userID)
+	last, err := redis.Int64(conn.Do("GET", key))
+	if err == nil && step <= last {
+		return false
+	}
+	conn.Do("SET", key, step, "EX", (2*totp.Skew+1)*totp.Period)
+	return true
+}
+
+//sessionMFA returns true if this session was issued after passing a second factor.
+func (auth *Authenticator) sessionMFA(ctx context.Context, userID gp.UserID, token string) (mfa bool, err error) {
+	record, err := auth.tokens.Token(ctx, userID, token)
+	return record.MFA, err
+}
+
+//markSecondFactor records that this session has passed a second factor.
+func (auth *Authenticator) markSecondFactor(ctx context.Context, userID gp.UserID, token string) (err error) {
+	return auth.tokens.MarkMFA(ctx, userID, token)
+}
+
+//CompleteLogin is the second step of a two-factor login: given the challenge from AttemptLogin and either a code from the user's app or one of their recovery codes, it issues their token.
+func (api *API) CompleteLogin(ctx context.Context, challengeID, code, recoveryCode string) (token gp.Token, err error) {
+	c, err := api.Auth.challenge(ctx, challengeID)
+	if err != nil {
+		return
+	}
+	secret, err := api.enabledSecret(ctx, c.UserID)
+	if err != nil {
+		return
+	}
+	err = api.secondFactor(ctx, c.UserID, secret, code, recoveryCode)
+	if err == BadTwoFactorCode {
+		go api.Statsd.Count(1, "gleepost.auth.login.2fa.fail")
+		api.Auth.failChallenge(challengeID)
+	}
+	if err != nil {
+		return
+	}
+	if !api.Auth.discardChallenge(ctx, challengeID) {
+		err = BadChallenge
+		return
+	}
+	return api.Auth.createSession(ctx, c.UserID, c.Device, c.Scopes, true)
+}
+
+//secondFactor checks code (or, failing that, recoveryCode) for this user. Failures count towards a backoff, just like logins.
+func (api *API) secondFactor(ctx context.Context, userID gp.UserID, secret, code, recoveryCode string) (err error) {
+	who := strconv.FormatUint(uint64(userID), 10)
+	if wait := api.Auth.throttled(ctx, "2fa", who, ""); wait > 0 {
+		return RateLimited{RetryAfter: wait}
+	}
+	var ok bool
+	switch {
+	case len(code) > 0:
+		ok = api.Auth.checkCode(userID, secret, code)
+	case len(recoveryCode) > 0:
+		ok, err = api.useRecoveryCode(ctx, userID, recoveryCode)
+		if err != nil {
+			return
+		}
+	}
+	if !ok {
+		api.Auth.recordAttempt("2fa", who, "")
+		return BadTwoFactorCode
+	}
+	api.Auth.clearAttempts("2fa", who)
+	return nil
+}
+
+//CheckSecondFactor returns nil if this session may use the /admin and /approve endpoints as far as two-factor authentication is concerned:
+//either it passed a second factor when it logged in, or the user hasn't enabled two-factor authentication and isn't required to.
+func (api *API) CheckSecondFactor(ctx context.Context, userID gp.UserID, token string) (err error) {
+	mfa, err := api.Auth.sessionMFA(ctx, userID, token)
+	if err != nil || mfa {
+		return
+	}
+	enabled, err := api.twoFactorEnabled(ctx, userID)
+	if err != nil {
+		return
+	}
+	if enabled {
+		return SecondFactorRequired
+	}
+	required, err := api.twoFactorRequired(ctx, userID)
+	if err != nil {
+		return
+	}
+	if required {
+		return TwoFactorEnrolmentRequired
+	}
+	return nil
+}
+
+//TwoFactorStatus returns whether this user has two-factor authentication enabled, whether they have to, and how many recovery codes they have left.
+func (api *API) TwoFactorStatus(ctx context.Context, userID gp.UserID) (status gp.TwoFactorStatus, err error) {
+	status.Enabled, err = api.twoFactorEnabled(ctx, userID)
+	if err != nil {
+		return
+	}
+	status.Required, err = api.twoFactorRequired(ctx, userID)
+	if err != nil || !status.Enabled {
+		return
+	}
+	status.RecoveryCodesLeft, err = api.recoveryCodesLeft(ctx, userID)
+	return
+}
+
+//BeginTwoFactor generates a new secret for this user. It isn't used until they confirm it with a code from their app.
+func (api *API) BeginTwoFactor(ctx context.Context, userID gp.UserID) (enrolment gp.TwoFactorEnrolment, err error) {
+	enabled, err := api.twoFactorEnabled(ctx, userID)
+	switch {
+	case err != nil:
+		return
+	case enabled:
+		err = TwoFactorAlreadyEnabled
+		return
+	}
+	email, err := api.getEmail(ctx, userID)
+	if err != nil {
+		return
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return
+	}
+	s, err := api.sc.Prepare("REPLACE INTO two_factor (user_id, secret, enabled) VALUES (?, ?, 0)")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, userID, secret)
+	if err != nil {
+		return
+	}
+	enrolment = gp.TwoFactorEnrolment{Secret: secret, URI: totp.URI(secret, api.Config.TwoFactor.IssuerName(), email)}
+	return
+}
+
+//ConfirmTwoFactor turns on two-factor authentication once the user has proved their app is set up by giving a code from it, and returns their recovery codes.
+//The session they confirmed it from counts as having passed a second factor.
+func (api *API) ConfirmTwoFactor(ctx context.Context, userID gp.UserID, currentToken, code string) (codes gp.RecoveryCodes, err error) {
+	secret, enabled, err := api.twoFactorSecret(ctx, userID)
+	switch {
+	case err == sql.ErrNoRows:
+		err = TwoFactorNotEnrolled
+		return
+	case err != nil:
+		return
+	case enabled:
+		err = TwoFactorAlreadyEnabled
+		return
+	}
+	err = api.secondFactor(ctx, userID, secret, code, "")
+	if err != nil {
+		return
+	}
+	s, err := api.sc.Prepare("UPDATE two_factor SET enabled = 1 WHERE user_id = ?")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, userID)
+	if err != nil {
+		return
+	}
+	codes, err = api.newRecoveryCodes(ctx, userID)
+	if err != nil {
+		return
+	}
+	err = api.Auth.markSecondFactor(ctx, userID, currentToken)
+	return
+}
+
+//DisableTwoFactor turns off two-factor authentication, given a current code or a recovery code. It returns CantDisableTwoFactor if the user is required to keep it.
+func (api *API) DisableTwoFactor(ctx context.Context, userID gp.UserID, code, recoveryCode string) (err error) {
+	secret, err := api.enabledSecret(ctx, userID)
+	if err != nil {
+		return
+	}
+	required, err := api.twoFactorRequired(ctx, userID)
+	switch {
+	case err != nil:
+		return
+	case required:
+		return CantDisableTwoFactor
+	}
+	err = api.secondFactor(ctx, userID, secret, code, recoveryCode)
+	if err != nil {
+		return
+	}
+	for _, q := range []string{"DELETE FROM two_factor_recovery WHERE user_id = ?", "DELETE FROM two_factor WHERE user_id = ?"} {
+		var s *sql.Stmt
+		s, err = api.sc.Prepare(q)
+		if err != nil {
+			return
+		}
+		_, err = s.ExecContext(ctx, userID)
+		if err != nil {
+			return
+		}
+	}
+	return api.store.Tokens.ClearMFA(ctx, userID)
+}
+
+//RegenerateRecoveryCodes replaces all this user's recovery codes with new ones, given a current code from their app.
+func (api *API) RegenerateRecoveryCodes(ctx context.Context, userID gp.UserID, code string) (codes gp.RecoveryCodes, err error) {
+	secret, err := api.enabledSecret(ctx, userID)
+	if err != nil {
+		return
+	}
+	err = api.secondFactor(ctx, userID, secret, code, "")
+	if err != nil {
+		return
+	}
+	return api.newRecoveryCodes(ctx, userID)
+}
+
+//TwoFactorRequirement returns whether admins and approvers in this user's university must use two-factor authentication.
+func (api *API) TwoFactorRequirement(ctx context.Context, userID gp.UserID) (req gp.TwoFactorRequirement, err error) {
+	primary, err := api.getUserUniversity(ctx, userID)
+	if err != nil {
+		return
+	}
+	s, err := api.sc.Prepare("SELECT require_2fa FROM network WHERE id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, primary.ID).Scan(&req.Required)
+	return
+}
+
+//SetTwoFactorRequirement sets whether admins and approvers in this user's university must use two-factor authentication, or returns ENOTALLOWED if they can't.
+//You have to have it enabled yourself before you can require it, so you can't lock yourself out.
+func (api *API) SetTwoFactorRequirement(ctx context.Context, userID gp.UserID, required bool) (err error) {
+	primary, err := api.getUserUniversity(ctx, userID)
+	if err != nil {
+		return
+	}
+	access, err := api.approveAccess(ctx, userID, primary.ID)
+	switch {
+	case err != nil:
+		return
+	case !access.LevelChange:
+		return &ENOTALLOWED
+	}
+	if required {
+		var enabled bool
+		enabled, err = api.twoFactorEnabled(ctx, userID)
+		switch {
+		case err != nil:
+			return
+		case !enabled:
+			return TwoFactorEnrolmentRequired
+		}
+	}
+	s, err := api.sc.Prepare("UPDATE network SET require_2fa = ? WHERE id = ?")
+	if err != nil {
+		return
+	}
+	_, err = s.ExecContext(ctx, required, primary.ID)
+	return
+}
+
+//twoFactorRequired is true if this user must use two-factor authentication: global admins (if configured), and administrators or approvers in networks which require it.
+func (api *API) twoFactorRequired(ctx context.Context, userID gp.UserID) (required bool, err error) {
+	if api.Config.TwoFactor.RequireForGlobalAdmins && api.isAdmin(ctx, userID) {
+		return true, nil
+	}
+	q := "SELECT COUNT(*) FROM user_network JOIN network " +
+		"ON (network.id = user_network.network_id AND user_network.role_level >= ?) " +
+		"OR (network.master_group = user_network.network_id AND user_network.role_level > 0) " +
+		"WHERE user_network.user_id = ? AND network.require_2fa = 1"
+	s, err := api.sc.Prepare(q)
+	if err != nil {
+		return
+	}
+	var count int
+	err = s.QueryRowContext(ctx, levels["administrator"], userID).Scan(&count)
+	return count > 0, err
+}
+
+//twoFactorSecret returns this user's secret and whether they've confirmed it, or sql.ErrNoRows if they've never started enrolling.
+func (api *API) twoFactorSecret(ctx context.Context, userID gp.UserID) (secret string, enabled bool, err error) {
+	s, err := api.sc.Prepare("SELECT secret, enabled FROM two_factor WHERE user_id = ?")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, userID).Scan(&secret, &enabled)
+	return
+}
+
+//enabledSecret returns this user's secret, or TwoFactorNotEnrolled if they haven't got two-factor authentication turned on.
+func (api *API) enabledSecret(ctx context.Context, userID gp.UserID) (secret string, err error) {
+	secret, enabled, err := api.twoFactorSecret(ctx, userID)
+	switch {
+	case err == sql.ErrNoRows || (err == nil && !enabled):
+		return "", TwoFactorNotEnrolled
+	default:
+		return
+	}
+}
+
+func (api *API) twoFactorEnabled(ctx context.Context, userID gp.UserID) (enabled bool, err error) {
+	_, enabled, err = api.twoFactorSecret(ctx, userID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return
+}
+
+//normaliseRecoveryCode lets users type recovery codes without worrying about case, spaces or dashes.
+func normaliseRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.Replace(code, "-", "", -1)
+	return strings.Replace(code, " ", "", -1)
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normaliseRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+//newRecoveryCodes throws away any existing recovery codes and issues a fresh set, all at once, so the user is never left with only some of them. We only keep their hashes.
+func (api *API) newRecoveryCodes(ctx context.Context, userID gp.UserID) (codes gp.RecoveryCodes, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		var random string
+		random, err = randomString()
+		if err != nil {
+			return
+		}
+		codes.Codes = append(codes.Codes, random[:5]+"-"+random[5:10])
+	}
+	tx, err := api.db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+		}
+	}()
+	_, err = tx.ExecContext(ctx, "DELETE FROM two_factor_recovery WHERE user_id = ?", userID)
+	if err != nil {
+		return
+	}
+	for _, code := range codes.Codes {
+		_, err = tx.ExecContext(ctx, "INSERT INTO two_factor_recovery (user_id, code_hash) VALUES (?, ?)", userID, hashRecoveryCode(code))
+		if err != nil {
+			return
+		}
+	}
+	err = tx.Commit()
+	committed = err == nil
+	return
+}
+
+//useRecoveryCode marks this recovery code as used, returning false if it isn't one of this user's unused codes.
+func (api *API) useRecoveryCode(ctx context.Context, userID gp.UserID, code string) (ok bool, err error) {
+	s, err := api.sc.Prepare("UPDATE two_factor_recovery SET used = 1 WHERE user_id = ? AND code_hash = ? AND used = 0")
+	if err != nil {
+		return
+	}
+	res, err := s.ExecContext(ctx, userID, hashRecoveryCode(code))
+	if err != nil {
+		return
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (api *API) recoveryCodesLeft(ctx context.Context, userID gp.UserID) (left int, err error) {
+	s, err := api.sc.Prepare("SELECT COUNT(*) FROM two_factor_recovery WHERE user_id = ? AND used = 0")
+	if err != nil {
+		return
+	}
+	err = s.QueryRowContext(ctx, userID).Scan(&left)
+	return
+}
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"io/ioutil"
@@ -26,11 +27,11 @@ func inferContentType(header *multipart.FileHeader) (contentType string) {
 }
 
 //StoreFile takes an uploaded file, checks if it is allowed (ie, is jpg / png / appropriate video file) and uploads it to s3 (selecting a bucket based on the user who uploaded it).
-func (api *API) StoreFile(id gp.UserID, file multipart.File, header *multipart.FileHeader) (url string, err error) {
+func (api *API) StoreFile(ctx context.Context, id gp.UserID, file multipart.File, header *multipart.FileHeader) (url string, err error) {
 	contenttype := inferContentType(header)
 	ext := filepath.Ext(header.Filename)
 	filename := randomFilename(ext)
-	bucket := api.getBucket(id)
+	bucket := api.getBucket(ctx, id)
 	data, err := ioutil.ReadAll(file)
 	if err != nil {
 		return "", err
@@ -41,13 +42,13 @@ func (api *API) StoreFile(id gp.UserID, file multipart.File, header *multipart.F
 		return "", err
 	}
 	url = cloudfrontify(url)
-	err = api.userAddUpload(id, url)
+	err = api.userAddUpload(ctx, id, url)
 	return url, err
 }
 
 //StoreFilePath acts the same as StoreFile, but uses io.Reader rather than reading everything into memory at once.
-func (api *API) StoreFilePath(id gp.UserID, path string) (URL string, err error) {
-	bucket := api.getBucket(id)
+func (api *API) StoreFilePath(ctx context.Context, id gp.UserID, path string) (URL string, err error) {
+	bucket := api.getBucket(ctx, id)
 	contentType := mime.TypeByExtension(filepath.Ext(path))
 	if contentType == "" {
 		err = errors.New("Couldn't determine content-type")
@@ -67,7 +68,7 @@ func (api *API) StoreFilePath(id gp.UserID, path string) (URL string, err error)
 		return
 	}
 	URL = cloudfrontify(bucket.URL(path[5:]))
-	err = api.userAddUpload(id, URL)
+	err = api.userAddUpload(ctx, id, URL)
 	return
 }
 
@@ -85,34 +86,34 @@ func cloudfrontify(url string) (cdnurl string) {
 }
 
 //userAddUpload records that this user has uploaded this URL.
-func (api *API) userAddUpload(id gp.UserID, url string) (err error) {
+func (api *API) userAddUpload(ctx context.Context, id gp.UserID, url string) (err error) {
 	s, err := api.sc.Prepare("INSERT INTO uploads (user_id, url) VALUES (?, ?)")
 	if err != nil {
 		return
 	}
-	_, err = s.Exec(id, url)
+	_, err = s.ExecContext(ctx, id, url)
 	return
 }
 
 //UserUploadExists returns true if the user has uploaded the file at url
-func (api *API) userUploadExists(id gp.UserID, url string) (exists bool, err error) {
+func (api *API) userUploadExists(ctx context.Context, id gp.UserID, url string) (exists bool, err error) {
 	s, err := api.sc.Prepare("SELECT COUNT(*) > 0 FROM uploads WHERE user_id = ? AND url = ?")
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(id, url).Scan(&exists)
+	err = s.QueryRowContext(ctx, id, url).Scan(&exists)
 	return
 }
 
 //GetUploadStatus returns the current status of this upload.
 //That's one of "uploaded", "transcode", "transfer", "done".
-func (api *API) GetUploadStatus(user gp.UserID, upload gp.VideoID) (UploadStatus gp.UploadStatus, err error) {
+func (api *API) GetUploadStatus(ctx context.Context, user gp.UserID, upload gp.VideoID) (UploadStatus gp.UploadStatus, err error) {
 	s, err := api.sc.Prepare("SELECT status, mp4_url, webm_url, url FROM uploads WHERE upload_id = ?")
 	if err != nil {
 		return
 	}
 	var status, mp4URL, webmURL, URL sql.NullString
-	err = s.QueryRow(upload).Scan(&status, &mp4URL, &webmURL, &URL)
+	err = s.QueryRowContext(ctx, upload).Scan(&status, &mp4URL, &webmURL, &URL)
 	if err != nil {
 		return
 	}
@@ -135,7 +136,7 @@ func (api *API) GetUploadStatus(user gp.UserID, upload gp.VideoID) (UploadStatus
 //SetUploadStatus records the current status of this upload.
 //Status must be one of "uploaded", "transcode", "transfer", "done".
 //If provided, urls[0] will be its mp4 format and urls[1] its webm..
-func (api *API) setUploadStatus(uploadStatus gp.UploadStatus) (ID gp.VideoID, err error) {
+func (api *API) setUploadStatus(ctx context.Context, uploadStatus gp.UploadStatus) (ID gp.VideoID, err error) {
 	defer api.Statsd.Time(time.Now(), "gleepost.uploads.setStatus.db")
 	var q string
 	var s *sql.Stmt
@@ -157,15 +158,15 @@ func (api *API) setUploadStatus(uploadStatus gp.UploadStatus) (ID gp.VideoID, er
 	switch {
 	case uploadStatus.ID == 0:
 		//First time, create an ID
-		res, err = s.Exec(uploadStatus.Owner, uploadStatus.Status)
+		res, err = s.ExecContext(ctx, uploadStatus.Owner, uploadStatus.Status)
 		_ID, _ := res.LastInsertId()
 		ID = gp.VideoID(_ID)
 	case uploadStatus.Uploaded == true:
 		//If it's done, record the urls of the files
-		res, err = s.Exec(uploadStatus.Owner, uploadStatus.Status, uploadStatus.MP4, uploadStatus.WebM, thumb, uploadStatus.ID)
+		res, err = s.ExecContext(ctx, uploadStatus.Owner, uploadStatus.Status, uploadStatus.MP4, uploadStatus.WebM, thumb, uploadStatus.ID)
 	default:
 		//Otherwise, just update the status.
-		res, err = s.Exec(uploadStatus.Owner, uploadStatus.Status, "", "", "", uploadStatus.ID)
+		res, err = s.ExecContext(ctx, uploadStatus.Owner, uploadStatus.Status, "", "", "", uploadStatus.ID)
 	}
 	if err != nil {
 		log.Println(err)
@@ -174,11 +175,11 @@ func (api *API) setUploadStatus(uploadStatus gp.UploadStatus) (ID gp.VideoID, er
 }
 
 //CreateJob records a Transcoding job into the queue
-func (api *API) createJob(source, target string, rotate bool, parent gp.VideoID) (err error) {
+func (api *API) createJob(ctx context.Context, source, target string, rotate bool, parent gp.VideoID) (err error) {
 	s, err := api.sc.Prepare("INSERT INTO video_jobs(parent_id, source, target, rotate) VALUES (?,?,?,?)")
 	if err != nil {
 		return
 	}
-	_, err = s.Exec(parent, source, target, rotate)
+	_, err = s.ExecContext(ctx, parent, source, target, rotate)
 	return
 }
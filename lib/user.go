@@ -1,61 +1,52 @@
 package lib
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
-	"strings"
 	"time"
 
 	"github.com/Petergatsby/GleepostAPI/lib/dir"
 	"github.com/Petergatsby/GleepostAPI/lib/dir/berkeley"
 	"github.com/Petergatsby/GleepostAPI/lib/dir/stanford"
 	"github.com/Petergatsby/GleepostAPI/lib/gp"
-	"github.com/Petergatsby/GleepostAPI/lib/psc"
+	"github.com/Petergatsby/GleepostAPI/lib/store"
 	"github.com/garyburd/redigo/redis"
-	"github.com/go-sql-driver/mysql"
 )
 
 //Users provides access to the users model.
 type Users struct {
-	sc      *psc.StatementCache
+	store   store.Users
 	statter PrefixStatter
 	pool    *redis.Pool
 }
 
 //returns ENOSUCHUSER if this user doesn't exist
-func (u Users) byID(id gp.UserID) (user gp.User, err error) {
-	user, err = u.byIDCached(id)
+func (u Users) byID(ctx context.Context, id gp.UserID) (user gp.User, err error) {
+	user, err = u.byIDCached(ctx, id)
 	if err == nil {
 		return
 	}
 	defer u.statter.Time(time.Now(), "gleepost.users.byID.db")
-	var av, lastName sql.NullString
-	s, err := u.sc.Prepare("SELECT id, avatar, firstname, lastname, official FROM users WHERE id=?")
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(id).Scan(&user.ID, &av, &user.Name, &lastName, &user.Official)
+	user, err = u.store.ByID(ctx, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			err = &gp.ENOSUCHUSER
 		}
 		return
 	}
-	if av.Valid {
-		user.Avatar = av.String
-	}
-	if lastName.Valid {
-		user.Name = user.Name + " " + lastName.String
-	}
-	u.cache(user)
+	u.cache(ctx, user)
 	return
 }
 
-func (u Users) byIDCached(id gp.UserID) (user gp.User, err error) {
+func (u Users) byIDCached(ctx context.Context, id gp.UserID) (user gp.User, err error) {
+	if u.pool == nil {
+		return user, redis.ErrNil
+	}
 	defer u.statter.Time(time.Now(), "gleepost.users.byID.cache")
-	conn := u.pool.Get()
+	conn := redisConn(ctx, u.pool)
 	defer conn.Close()
 	key := fmt.Sprintf("users:%d", id)
 	data, err := redis.Bytes(conn.Do("GET", key))
@@ -66,8 +57,11 @@ func (u Users) byIDCached(id gp.UserID) (user gp.User, err error) {
 	return
 }
 
-func (u Users) cache(user gp.User) {
-	conn := u.pool.Get()
+func (u Users) cache(ctx context.Context, user gp.User) {
+	if u.pool == nil {
+		return
+	}
+	conn := redisConn(ctx, u.pool)
 	defer conn.Close()
 	key := fmt.Sprintf("users:%d", user.ID)
 	_user, err := json.Marshal(user)
@@ -80,106 +74,102 @@ func (u Users) cache(user gp.User) {
 }
 
 //UserGetProfile returns the Profile (extended info) for the user with this ID.
-func (api *API) UserGetProfile(userID, otherID gp.UserID) (user gp.Profile, err error) {
+func (api *API) UserGetProfile(ctx context.Context, userID, otherID gp.UserID) (user gp.Profile, err error) {
 	if userID == otherID {
-		return api.getProfile(userID, otherID)
+		return api.getProfile(ctx, userID, otherID)
 	}
-	shared, e := api.sameUniversity(userID, otherID)
+	shared, e := api.sameUniversity(ctx, userID, otherID)
 	switch {
 	case e != nil:
 		fallthrough
 	case !shared:
 		err = &ENOTALLOWED
 	default:
-		return api.getProfile(userID, otherID)
+		return api.getProfile(ctx, userID, otherID)
 	}
 	return
 }
 
 //getProfile returns the Profile (extended info) for the user with this ID.
-func (api *API) getProfile(perspective, otherID gp.UserID) (user gp.Profile, err error) {
-	user, err = api._getProfile(otherID)
+func (api *API) getProfile(ctx context.Context, perspective, otherID gp.UserID) (user gp.Profile, err error) {
+	user, err = api._getProfile(ctx, otherID)
 	if err != nil {
 		return
 	}
-	user.Network, err = api.getUserUniversity(user.ID)
+	user.Network, err = api.getUserUniversity(ctx, user.ID)
 	if err != nil {
 		return
 	}
-	rsvps, err := api.subjectiveRSVPCount(perspective, otherID)
+	rsvps, err := api.subjectiveRSVPCount(ctx, perspective, otherID)
 	if err != nil {
 		return
 	}
 	user.RSVPCount = rsvps
-	groupCount, err := api.subjectiveMembershipCount(perspective, otherID)
+	groupCount, err := api.subjectiveMembershipCount(ctx, perspective, otherID)
 	if err != nil {
 		return
 	}
 	user.GroupCount = groupCount
-	postCount, err := api.userPostCount(perspective, otherID)
+	postCount, err := api.userPostCount(ctx, perspective, otherID)
 	if err != nil {
 		return
 	}
 	user.PostCount = postCount
 	if perspective == otherID {
-		user.Notifications, _ = unreadNotificationCount(api.sc, otherID)
-		user.Unread, err = api.unreadNonGroupMessageCount(otherID)
+		user.Notifications, _ = api.store.Notifications.UnseenCount(ctx, otherID)
+		user.Unread, err = api.unreadNonGroupMessageCount(ctx, otherID)
 		if err != nil {
 			log.Println(err)
 		}
-		newPosts, err := api.totalGroupsNewPosts(otherID)
+		newPosts, err := api.totalGroupsNewPosts(ctx, otherID)
 		if err != nil {
 			log.Println(err)
 		}
-		newGroupMessages, _ := api.unreadGroupMessageCount(otherID)
+		newGroupMessages, _ := api.unreadGroupMessageCount(ctx, otherID)
 		user.GroupsBadge = newPosts + newGroupMessages
-		user.FBID, err = api.fbUser(otherID)
+		user.FBID, err = api.fbUser(ctx, otherID)
 		if err != nil && err != NoSuchUser {
 			log.Println(err)
 		}
-		user.TutorialState, err = api.tutorialState(otherID)
+		user.TutorialState, err = api.tutorialState(ctx, otherID)
 		if err != nil {
 			log.Println("tutorial state err:", err)
 		}
 	}
-	go api.esIndexUser(otherID)
+	go api.esIndexUser(context.Background(), otherID)
 	return user, nil
 }
 
 //IsAdmin returns true if this user member has their Admin flag set.
-func (api *API) isAdmin(user gp.UserID) (admin bool) {
-	s, err := api.sc.Prepare("SELECT is_admin FROM users WHERE id = ?")
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(user).Scan(&admin)
-	if err == nil && admin {
-		return true
-	}
-	return false
+func (api *API) isAdmin(ctx context.Context, user gp.UserID) (admin bool) {
+	admin, err := api.store.Users.IsAdmin(ctx, user)
+	return err == nil && admin
 }
 
-//UserCreateUserSpecial manually creates a user with these details, bypassing validation etc
-func (api *API) UserCreateUserSpecial(creator gp.UserID, first, last, email, pass string, verified bool, primaryNetwork gp.NetworkID) (userID gp.UserID, err error) {
-	if !api.isAdmin(creator) {
+//UserCreateUserSpecial manually creates a user with these details, bypassing validation etc (although the password still has to meet the policy).
+func (api *API) UserCreateUserSpecial(ctx context.Context, creator gp.UserID, first, last, email, pass string, verified bool, primaryNetwork gp.NetworkID) (userID gp.UserID, err error) {
+	if !api.isAdmin(ctx, creator) {
 		err = ENOTALLOWED
 		return
 	}
-	return api.createUserSpecial(first, last, email, pass, verified, primaryNetwork)
+	if errs := api.checkPassword(pass, first, last, email); len(errs) > 0 {
+		return 0, errs
+	}
+	return api.createUserSpecial(ctx, first, last, email, pass, verified, primaryNetwork)
 }
 
-func (api *API) createUserSpecial(first, last, email, pass string, verified bool, primaryNetwork gp.NetworkID) (userID gp.UserID, err error) {
-	userID, err = api.createUser(first, last, pass, email)
+func (api *API) createUserSpecial(ctx context.Context, first, last, email, pass string, verified bool, primaryNetwork gp.NetworkID) (userID gp.UserID, err error) {
+	userID, err = api.createUser(ctx, first, last, pass, email)
 	if err != nil {
 		return
 	}
 	if verified {
-		err = api.verify(userID)
+		err = api.verify(ctx, userID)
 		if err != nil {
 			return
 		}
 	}
-	err = api.setNetwork(userID, primaryNetwork)
+	err = api.setNetwork(ctx, userID, primaryNetwork)
 	go api.lookUpDirectory(userID)
 	return
 }
@@ -191,14 +181,16 @@ func (api *API) inviteURL(token, email string) string {
 	return fmt.Sprintf("https://gleepost.com/?invite=%s&email=%s", token, email)
 }
 
+//issueInviteEmail emails an invite to join netID from userID. It's sent in the background, after the request which invited them.
 func (api *API) issueInviteEmail(email string, userID gp.UserID, netID gp.NetworkID, token string) (err error) {
+	ctx := context.Background()
 	var from gp.User
-	from, err = api.users.byID(userID)
+	from, err = api.users.byID(ctx, userID)
 	if err != nil {
 		return
 	}
 	var group gp.Group
-	group, err = api.getNetwork(netID)
+	group, err = api.getNetwork(ctx, netID)
 	if err != nil {
 		return
 	}
@@ -215,61 +207,47 @@ func (api *API) issueInviteEmail(email string, userID gp.UserID, netID gp.Networ
 }
 
 //GetEmail returns this user's email address.
-func (api *API) getEmail(id gp.UserID) (email string, err error) {
-	s, err := api.sc.Prepare("SELECT email FROM users WHERE id = ?")
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(id).Scan(&email)
-	return
+func (api *API) getEmail(ctx context.Context, id gp.UserID) (email string, err error) {
+	return api.store.Users.Email(ctx, id)
 }
 
 //UserSetName updates this user's name.
-func (api *API) UserSetName(id gp.UserID, firstName, lastName string) (err error) {
+func (api *API) UserSetName(ctx context.Context, id gp.UserID, firstName, lastName string) (err error) {
 	firstName = normaliseName(firstName)
 	lastName = normaliseName(lastName)
-	s, err := api.sc.Prepare("UPDATE users SET firstname = ?, lastname = ? where id = ?")
+	err = api.store.Users.SetName(ctx, id, firstName, lastName)
 	if err != nil {
 		return
 	}
-	_, err = s.Exec(firstName, lastName, id)
-	if err != nil {
-		return
-	}
-	api.esIndexUser(id)
+	api.esIndexUser(ctx, id)
 	return
 }
 
 //UserSetProfileImage updates this user's profile image to the new url
-func (api *API) UserSetProfileImage(id gp.UserID, url string) (err error) {
-	exists, err := api.userUploadExists(id, url)
+func (api *API) UserSetProfileImage(ctx context.Context, id gp.UserID, url string) (err error) {
+	exists, err := api.userUploadExists(ctx, id, url)
 	if err != nil {
 		return
 	}
 	if !exists {
 		return NoSuchUpload
 	}
-	err = api.setProfileImage(id, url)
+	err = api.setProfileImage(ctx, id, url)
 	if err != nil {
 		return
 	}
-	api.esIndexUser(id)
+	api.esIndexUser(ctx, id)
 	return
 }
 
-func (api *API) setProfileImage(id gp.UserID, url string) (err error) {
-	s, err := api.sc.Prepare("UPDATE users SET avatar = ? WHERE id = ?")
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(url, id)
-	return
+func (api *API) setProfileImage(ctx context.Context, id gp.UserID, url string) (err error) {
+	return api.store.Users.SetAvatar(ctx, id, url)
 }
 
 //UserHasPosted returns true if user has ever created a post from the perspective of perspective.
 //TODO: Implement a direct version
-func (api *API) userHasPosted(user gp.UserID, perspective gp.UserID) (posted bool, err error) {
-	posts, err := api.GetUserPosts(user, perspective, ByOffsetDescending, 0, 1, "")
+func (api *API) userHasPosted(ctx context.Context, user gp.UserID, perspective gp.UserID) (posted bool, err error) {
+	posts, err := api.GetUserPosts(ctx, user, perspective, ByOffsetDescending, 0, 1, "")
 	if err != nil {
 		return
 	}
@@ -285,92 +263,42 @@ func (api *API) userHasPosted(user gp.UserID, perspective gp.UserID) (posted boo
 
 //RegisterUser creates a user with a name a password hash and an email address.
 //They'll be created in an unverified state.
-func (api *API) _registerUser(first, last string, hash []byte, email string) (gp.UserID, error) {
-	s, err := api.sc.Prepare("INSERT INTO users(firstname, lastname, password, email) VALUES (?,?,?,?)")
-	if err != nil {
-		return 0, err
+func (api *API) _registerUser(ctx context.Context, first, last string, hash []byte, email string) (gp.UserID, error) {
+	id, err := api.store.Users.Register(ctx, first, last, email, hash, CurrentHashVersion)
+	if err == store.ErrExists {
+		return 0, UserAlreadyExists
 	}
-	res, err := s.Exec(first, last, hash, email)
-	if err != nil {
-		if err, ok := err.(*mysql.MySQLError); ok {
-			if err.Number == 1062 {
-				return 0, UserAlreadyExists
-			}
-		}
-		return 0, err
-	}
-	id, _ := res.LastInsertId()
-	return gp.UserID(id), nil
+	return id, err
 }
 
 //UserChangeTagline sets this user's tagline (obviously enough)
-func (api *API) UserChangeTagline(userID gp.UserID, tagline string) (err error) {
-	s, err := api.sc.Prepare("UPDATE users SET `desc` = ? WHERE id = ?")
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(tagline, userID)
-	return
+func (api *API) UserChangeTagline(ctx context.Context, userID gp.UserID, tagline string) (err error) {
+	return api.store.Users.SetTagline(ctx, userID, tagline)
 }
 
 //GetProfile fetches a user but DOES NOT GET THEIR NETWORK.
-func (api *API) _getProfile(id gp.UserID) (user gp.Profile, err error) {
+func (api *API) _getProfile(ctx context.Context, id gp.UserID) (user gp.Profile, err error) {
 	defer api.Statsd.Time(time.Now(), "gleepost.profile.byID.db")
-	var av, desc, lastName, externalID sql.NullString
-	s, err := api.sc.Prepare("SELECT `desc`, avatar, firstname, lastname, official, type, external_id FROM users WHERE id = ?")
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(id).Scan(&desc, &av, &user.Name, &lastName, &user.Official, &user.Type, &externalID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return user, &gp.ENOSUCHUSER
-		}
-		return
-	}
-	if av.Valid {
-		user.Avatar = av.String
-	}
-	if desc.Valid {
-		user.Desc = desc.String
-	}
-	if lastName.Valid {
-		user.FullName = user.Name + " " + lastName.String
-	}
-	if externalID.Valid {
-		user.InstitutionID = externalID.String
+	user, err = api.store.Users.Profile(ctx, id)
+	if err == sql.ErrNoRows {
+		return user, &gp.ENOSUCHUSER
 	}
-	user.ID = id
 	return
 }
 
 //SetBusyStatus records whether this user is busy or not.
-func (api *API) SetBusyStatus(id gp.UserID, busy bool) (err error) {
-	s, err := api.sc.Prepare("UPDATE users SET busy = ? WHERE id = ?")
-	if err != nil {
-		return
-	}
-	_, err = s.Exec(busy, id)
-	return
+func (api *API) SetBusyStatus(ctx context.Context, id gp.UserID, busy bool) (err error) {
+	return api.store.Users.SetBusy(ctx, id, busy)
 }
 
 //BusyStatus returns this user's busy status.
-func (api *API) BusyStatus(id gp.UserID) (busy bool, err error) {
-	s, err := api.sc.Prepare("SELECT busy FROM users WHERE id = ?")
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(id).Scan(&busy)
-	return
+func (api *API) BusyStatus(ctx context.Context, id gp.UserID) (busy bool, err error) {
+	return api.store.Users.Busy(ctx, id)
 }
 
 //UserIDFromFB gets the gleepost user who has fbid associated, or an error if there is none.
-func (api *API) userIDFromFB(fbid uint64) (id gp.UserID, err error) {
-	s, err := api.sc.Prepare("SELECT user_id FROM facebook WHERE fb_id = ? AND user_id IS NOT NULL")
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(fbid).Scan(&id)
+func (api *API) userIDFromFB(ctx context.Context, fbid uint64) (id gp.UserID, err error) {
+	id, err = api.store.Users.ByFacebook(ctx, fbid)
 	if err == sql.ErrNoRows {
 		err = NoSuchUser
 	}
@@ -378,12 +306,8 @@ func (api *API) userIDFromFB(fbid uint64) (id gp.UserID, err error) {
 }
 
 //UserWithEmail returns the user whose email this is, or an error if they don't exist.
-func (api *API) userWithEmail(email string) (id gp.UserID, err error) {
-	s, err := api.sc.Prepare("SELECT id FROM users WHERE email = ?")
-	if err != nil {
-		return
-	}
-	err = s.QueryRow(email).Scan(&id)
+func (api *API) userWithEmail(ctx context.Context, email string) (id gp.UserID, err error) {
+	id, err = api.store.Users.ByEmail(ctx, email)
 	if err == sql.ErrNoRows {
 		err = NoSuchUser
 	}
@@ -391,31 +315,18 @@ func (api *API) userWithEmail(email string) (id gp.UserID, err error) {
 }
 
 //GetGlobalAdmins returns all users who are gleepost company admins.
-func (api *API) getGlobalAdmins() (users []gp.User, err error) {
-	users = make([]gp.User, 0)
-	s, err := api.sc.Prepare("SELECT id, firstname, avatar, official FROM users WHERE is_admin = 1")
-	if err != nil {
-		return
-	}
-	rows, err := s.Query()
-	if err != nil {
-		return
+func (api *API) getGlobalAdmins(ctx context.Context) (users []gp.User, err error) {
+	users, err = api.store.Users.Admins(ctx)
+	if users == nil {
+		users = make([]gp.User, 0)
 	}
-	for rows.Next() {
-		var u gp.User
-		var av sql.NullString
-		err = rows.Scan(&u.ID, &u.Name, &av, &u.Official)
-		if err != nil {
-			log.Println("GetGlobalAdmins: Problem scanning:", err)
-			continue
-		}
-		users = append(users, u)
-	}
-	return users, nil
+	return
 }
 
+//lookUpDirectory fills in user's directory entry from their university's directory, in the background.
 func (api *API) lookUpDirectory(user gp.UserID) {
-	network, err := api.getUserUniversity(user)
+	ctx := context.Background()
+	network, err := api.getUserUniversity(ctx, user)
 	if err != nil {
 		log.Println(err)
 		return
@@ -429,7 +340,7 @@ func (api *API) lookUpDirectory(user gp.UserID) {
 	default:
 		d = dir.NullDirectory{}
 	}
-	email, err := api.getEmail(user)
+	email, err := api.getEmail(ctx, user)
 	if err != nil {
 		log.Println(err)
 		return
@@ -439,39 +350,16 @@ func (api *API) lookUpDirectory(user gp.UserID) {
 		log.Println(err)
 		return
 	}
-	s, err := api.sc.Prepare("UPDATE users SET type = ?, external_id = ? WHERE id = ?")
-	if err != nil {
-		log.Println(err)
-		return
-	}
-	_, err = s.Exec(userType, userID, user)
+	err = api.store.Users.SetDirectoryEntry(ctx, user, userType, userID)
 	if err != nil {
 		log.Println(err)
 	}
 }
 
-func (api *API) SetTutorialState(user gp.UserID, tutorials ...string) (err error) {
-	s, err := api.sc.Prepare("UPDATE users SET tutorial_state = ? WHERE id = ?")
-	if err != nil {
-		return
-	}
-	ts := strings.Join(tutorials, ",")
-	_, err = s.Exec(ts, user)
-	return
+func (api *API) SetTutorialState(ctx context.Context, user gp.UserID, tutorials ...string) (err error) {
+	return api.store.Users.SetTutorialState(ctx, user, tutorials)
 }
 
-func (api *API) tutorialState(user gp.UserID) (tutorialsDone []string, err error) {
-	s, err := api.sc.Prepare("SELECT tutorial_state FROM users WHERE id = ?")
-	if err != nil {
-		return
-	}
-	var ts sql.NullString
-	err = s.QueryRow(user).Scan(&ts)
-	if err != nil {
-		return
-	}
-	if ts.Valid {
-		tutorialsDone = strings.Split(ts.String, ",")
-	}
-	return
+func (api *API) tutorialState(ctx context.Context, user gp.UserID) (tutorialsDone []string, err error) {
+	return api.store.Users.TutorialState(ctx, user)
 }
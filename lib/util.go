@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"log"
 
 	"time"
@@ -8,9 +9,10 @@ import (
 
 //KeepPostsInFuture checks a list of posts every PollInterval and pushes them into the future if neccessary
 func (api *API) KeepPostsInFuture(pollInterval time.Duration) {
+	ctx := context.Background()
 	t := time.Tick(pollInterval)
 	for {
-		err := api.keepPostsInFuture()
+		err := api.keepPostsInFuture(ctx)
 		if err != nil {
 			log.Println(err)
 		}
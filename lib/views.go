@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
@@ -13,26 +14,28 @@ import (
 //Viewer handles Views submitted by clients.
 type Viewer interface {
 	RecordViews(views []gp.PostView)
-	postViewCount(post gp.PostID) (views int, err error)
+	postViewCount(ctx context.Context, post gp.PostID) (views int, err error)
 }
 
 type viewer struct {
-	broker *events.Broker
+	broker events.EventBus
 	sc     *psc.StatementCache
 }
 
 //RecordViews saves a bunch of post views, after purging views that the user couldn't have done. It also triggers a views-change event on all the posts involved.
+//Views are recorded in the background, after the request which submitted them, so it has its own context.
 func (v *viewer) RecordViews(views []gp.PostView) {
-	views = v.verifyViews(views)
-	err := v.recordViews(views)
+	ctx := context.Background()
+	views = v.verifyViews(ctx, views)
+	err := v.recordViews(ctx, views)
 	if err != nil {
 		log.Println("Error recording views:", err)
 		return
 	}
-	go v.publishNewViewCounts(views)
+	go v.publishNewViewCounts(ctx, views)
 }
 
-func (v *viewer) verifyViews(views []gp.PostView) (verified []gp.PostView) {
+func (v *viewer) verifyViews(ctx context.Context, views []gp.PostView) (verified []gp.PostView) {
 	verified = make([]gp.PostView, 0)
 	s, err := v.sc.Prepare("SELECT 1 FROM user_network JOIN wall_posts ON user_network.network_id = wall_posts.network_id WHERE user_id = ? AND wall_posts.id = ? AND wall_posts.deleted = 0")
 	if err != nil {
@@ -41,7 +44,7 @@ func (v *viewer) verifyViews(views []gp.PostView) (verified []gp.PostView) {
 	}
 	for _, view := range views {
 		var visible bool
-		err := s.QueryRow(view.User, view.Post).Scan(&visible)
+		err := s.QueryRowContext(ctx, view.User, view.Post).Scan(&visible)
 		switch {
 		case visible:
 			verified = append(verified, view)
@@ -54,13 +57,13 @@ func (v *viewer) verifyViews(views []gp.PostView) (verified []gp.PostView) {
 	return
 }
 
-func (v *viewer) recordViews(views []gp.PostView) (err error) {
+func (v *viewer) recordViews(ctx context.Context, views []gp.PostView) (err error) {
 	s, err := v.sc.Prepare("INSERT INTO post_views (user_id, post_id, ts) VALUES (?, ?, ?)")
 	if err != nil {
 		return err
 	}
 	for _, view := range views {
-		_, err = s.Exec(view.User, view.Post, view.Time.UTC())
+		_, err = s.ExecContext(ctx, view.User, view.Post, view.Time.UTC())
 		if err != nil {
 			return err
 		}
@@ -68,18 +71,18 @@ func (v *viewer) recordViews(views []gp.PostView) (err error) {
 	return nil
 }
 
-func (v *viewer) publishNewViewCounts(views []gp.PostView) {
+func (v *viewer) publishNewViewCounts(ctx context.Context, views []gp.PostView) {
 	done := make(map[gp.PostID]bool)
 
 	for _, view := range views {
 		_, ok := done[view.Post]
 		if !ok {
-			count, err := v.postViewCount(view.Post)
+			count, err := v.postViewCount(ctx, view.Post)
 			if err != nil {
 				log.Println(err)
 				continue
 			}
-			go v.broker.PublishEvent("views", fmt.Sprintf("/posts/%d", view.Post), gp.PostViewCount{Post: view.Post, Count: count}, []string{PostChannel(view.Post)})
+			go v.broker.PublishEvent(events.Views, fmt.Sprintf("/posts/%d", view.Post), gp.PostViewCount{Post: view.Post, Count: count}, []string{PostChannel(view.Post)})
 			done[view.Post] = true
 		}
 	}
@@ -91,21 +94,21 @@ func PostChannel(post gp.PostID) string {
 }
 
 //PostViewCount returns the number of total views this post has had.
-func (v *viewer) postViewCount(post gp.PostID) (count int, err error) {
+func (v *viewer) postViewCount(ctx context.Context, post gp.PostID) (count int, err error) {
 	q := "SELECT COUNT(*) FROM post_views WHERE post_id = ?"
 	s, err := v.sc.Prepare(q)
 	if err != nil {
 		return
 	}
-	err = s.QueryRow(post).Scan(&count)
+	err = s.QueryRowContext(ctx, post).Scan(&count)
 	return
 }
 
 //CanSubscribePosts takes a list of posts that a user wishes to subscribe to and returns the ones they can actually see.
-func (api *API) CanSubscribePosts(user gp.UserID, posts []gp.PostID) (subscribable []gp.PostID, err error) {
+func (api *API) CanSubscribePosts(ctx context.Context, user gp.UserID, posts []gp.PostID) (subscribable []gp.PostID, err error) {
 	subscribable = make([]gp.PostID, 0)
 	for _, p := range posts {
-		viewable, err := api.canViewPost(user, p)
+		viewable, err := api.canViewPost(ctx, user, p)
 		if err == nil && viewable {
 			subscribable = append(subscribable, p)
 		}
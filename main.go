@@ -2,8 +2,12 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"runtime"
@@ -21,16 +25,22 @@ var (
 )
 
 func main() {
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(conf.GetConfig(), flag.Args()))
+	}
 	ascii()
 	runtime.GOMAXPROCS(runtime.NumCPU())
 	log.Println("Getting config")
 	config := conf.GetConfig()
+	log.Println("Checking schema version")
+	checkSchema(config)
 	log.Println("Starting API")
 	api.Start()
-	log.Println("Starting APNS feedback daemons")
 	if !config.DevelopmentMode {
 		log.Println("Starting stats summary email daemon")
 		api.PeriodicSummary(time.Date(2014, time.April, 9, 8, 0, 0, 0, time.UTC), time.Duration(24*time.Hour))
+		log.Println("Starting digest email daemon")
+		go api.DigestDaemon()
 	}
 
 	go api.KeepPostsInFuture(30 * time.Minute)
@@ -47,5 +57,20 @@ func main() {
 		Handler: r,
 	}
 	go cleanupUploads()
+	go drainOnSignal()
 	server.ListenAndServe()
 }
+
+//drainOnSignal closes every realtime connection cleanly before the process exits, so that clients know to reconnect (to another server) and resume.
+func drainOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	sig := <-signals
+	log.Printf("Got %v, draining %d realtime connections\n", sig, api.Connections.Count())
+	remaining := api.Connections.Drain(api.Config.Realtime.DrainTimeout())
+	if remaining > 0 {
+		log.Printf("Gave up waiting on %d realtime connections\n", remaining)
+	}
+	api.Close()
+	os.Exit(0)
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/Petergatsby/GleepostAPI/lib/conf"
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+func TestEditMessage(t *testing.T) {
+	token, partner, convID := initMessageEdits(t)
+	msgID, err := sendMessage(token, convID, "Helo")
+	if err != nil {
+		t.Fatal("Error sending message:", err)
+	}
+	stale, err := sendMessage(token, convID, "Old news")
+	if err != nil {
+		t.Fatal("Error sending message:", err)
+	}
+	err = ageMessage(stale)
+	if err != nil {
+		t.Fatal("Error ageing message:", err)
+	}
+	theirs, err := sendMessage(partner, convID, "Hi")
+	if err != nil {
+		t.Fatal("Error sending message:", err)
+	}
+	batch, err := poll(partner, "", 0)
+	if err != nil {
+		t.Fatal("Error polling:", err)
+	}
+
+	type editTest struct {
+		Token          gp.Token
+		MessageID      gp.MessageID
+		Text           string
+		ExpectedStatus int
+		ExpectedType   string
+		ExpectedError  string
+	}
+	tests := []editTest{
+		{ //Empty text
+			Token:          token,
+			MessageID:      msgID,
+			Text:           "  ",
+			ExpectedStatus: 400,
+			ExpectedType:   "gp.APIerror",
+			ExpectedError:  "Message can't be empty",
+		},
+		{ //Someone else's message
+			Token:          token,
+			MessageID:      theirs,
+			Text:           "Bye",
+			ExpectedStatus: 403,
+			ExpectedType:   "gp.APIerror",
+			ExpectedError:  "You're not allowed to do that!",
+		},
+		{ //Outside the edit window
+			Token:          token,
+			MessageID:      stale,
+			Text:           "New news",
+			ExpectedStatus: 403,
+			ExpectedType:   "gp.APIerror",
+			ExpectedError:  "It's too late to change that message",
+		},
+		{ //Nonexistent message
+			Token:          token,
+			MessageID:      9999,
+			Text:           "Hello",
+			ExpectedStatus: 404,
+			ExpectedType:   "gp.APIerror",
+			ExpectedError:  "No such message",
+		},
+		{ //Your own message
+			Token:          token,
+			MessageID:      msgID,
+			Text:           "Hello",
+			ExpectedStatus: 200,
+			ExpectedType:   "gp.Message",
+		},
+	}
+	for _, test := range tests {
+		data := make(url.Values)
+		data["text"] = []string{test.Text}
+		resp, err := twoFactorRequest("PUT", fmt.Sprintf("conversations/%d/messages/%d", convID, test.MessageID), test.Token, data)
+		if err != nil {
+			t.Fatal("Couldn't make request:", err)
+		}
+		if resp.StatusCode != test.ExpectedStatus {
+			t.Fatalf("Got incorrect status code: expected %d but got %d.\n", test.ExpectedStatus, resp.StatusCode)
+		}
+		switch {
+		case test.ExpectedType == "gp.APIerror":
+			var errResp gp.APIerror
+			dec := json.NewDecoder(resp.Body)
+			dec.Decode(&errResp)
+			if errResp.Reason != test.ExpectedError {
+				t.Fatalf("Got incorrect error message: expected %s but got %s.\n", test.ExpectedError, errResp.Reason)
+			}
+		case test.ExpectedType == "gp.Message":
+			var message gp.Message
+			dec := json.NewDecoder(resp.Body)
+			err = dec.Decode(&message)
+			if err != nil {
+				t.Fatal("Error decoding message json:", err)
+			}
+			if message.Text != test.Text || message.Edited == nil {
+				t.Fatalf("Expected an edited message saying %q, got %+v\n", test.Text, message)
+			}
+		}
+		resp.Body.Close()
+	}
+
+	event := waitForMessageEvent(t, partner, batch.Cursor, "message_edited")
+	if event.ID != msgID || event.Text != "Hello" {
+		t.Fatalf("Expected message %d saying %q, got %+v\n", msgID, "Hello", event)
+	}
+	edits, err := messageHistory(token, convID, msgID)
+	if err != nil {
+		t.Fatal("Error getting history:", err)
+	}
+	if len(edits) != 1 || edits[0].Text != "Helo" {
+		t.Fatalf("Expected the history to hold the original text, got %+v\n", edits)
+	}
+}
+
+func TestDeleteMessage(t *testing.T) {
+	token, partner, convID := initMessageEdits(t)
+	msgID, err := sendMessage(token, convID, "Oops")
+	if err != nil {
+		t.Fatal("Error sending message:", err)
+	}
+	stale, err := sendMessage(token, convID, "Old news")
+	if err != nil {
+		t.Fatal("Error sending message:", err)
+	}
+	err = ageMessage(stale)
+	if err != nil {
+		t.Fatal("Error ageing message:", err)
+	}
+	theirs, err := sendMessage(partner, convID, "Hi")
+	if err != nil {
+		t.Fatal("Error sending message:", err)
+	}
+	data := make(url.Values)
+	data["text"] = []string{"Oops!"}
+	resp, err := twoFactorRequest("PUT", fmt.Sprintf("conversations/%d/messages/%d", convID, msgID), token, data)
+	if err != nil {
+		t.Fatal("Error editing message:", err)
+	}
+	resp.Body.Close()
+	batch, err := poll(partner, "", 0)
+	if err != nil {
+		t.Fatal("Error polling:", err)
+	}
+
+	type deleteTest struct {
+		Token          gp.Token
+		MessageID      gp.MessageID
+		ExpectedStatus int
+		ExpectedError  string
+	}
+	tests := []deleteTest{
+		{ //Someone else's message
+			Token:          token,
+			MessageID:      theirs,
+			ExpectedStatus: 403,
+			ExpectedError:  "You're not allowed to do that!",
+		},
+		{ //Outside the edit window
+			Token:          token,
+			MessageID:      stale,
+			ExpectedStatus: 403,
+			ExpectedError:  "It's too late to change that message",
+		},
+		{ //Nonexistent message
+			Token:          token,
+			MessageID:      9999,
+			ExpectedStatus: 404,
+			ExpectedError:  "No such message",
+		},
+		{ //Your own message
+			Token:          token,
+			MessageID:      msgID,
+			ExpectedStatus: 204,
+		},
+		{ //Already deleted
+			Token:          token,
+			MessageID:      msgID,
+			ExpectedStatus: 404,
+			ExpectedError:  "No such message",
+		},
+	}
+	for _, test := range tests {
+		resp, err := twoFactorRequest("DELETE", fmt.Sprintf("conversations/%d/messages/%d", convID, test.MessageID), test.Token, nil)
+		if err != nil {
+			t.Fatal("Couldn't make request:", err)
+		}
+		if resp.StatusCode != test.ExpectedStatus {
+			t.Fatalf("Got incorrect status code: expected %d but got %d.\n", test.ExpectedStatus, resp.StatusCode)
+		}
+		if test.ExpectedError != "" {
+			var errResp gp.APIerror
+			dec := json.NewDecoder(resp.Body)
+			dec.Decode(&errResp)
+			if errResp.Reason != test.ExpectedError {
+				t.Fatalf("Got incorrect error message: expected %s but got %s.\n", test.ExpectedError, errResp.Reason)
+			}
+		}
+		resp.Body.Close()
+	}
+
+	event := waitForMessageEvent(t, partner, batch.Cursor, "message_deleted")
+	if event.ID != msgID || !event.Deleted || event.Text != "" {
+		t.Fatalf("Expected a tombstone for message %d, got %+v\n", msgID, event)
+	}
+	//A deleted message's history goes with it.
+	resp, err = twoFactorRequest("GET", fmt.Sprintf("conversations/%d/messages/%d/edits", convID, msgID), token, nil)
+	if err != nil {
+		t.Fatal("Error getting history:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected %d, got %d\n", http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+//initMessageEdits gives patrick a fresh conversation with a partner, and returns both their sessions.
+func initMessageEdits(t *testing.T) (token, partner gp.Token, convID gp.ConversationID) {
+	err := initDB()
+	if err != nil {
+		t.Fatal("Error initializing db:", err)
+	}
+	err = truncate("conversations", "conversation_participants", "chat_messages", "message_edits")
+	if err != nil {
+		t.Fatal("Error truncating:", err)
+	}
+	err = initPartner()
+	if err != nil {
+		t.Fatal("Error creating partner:", err)
+	}
+	once.Do(setup)
+	token, err = testingGetSession("patrick@fakestanford.edu", "TestingPass")
+	if err != nil {
+		t.Fatal("Error getting session:", err)
+	}
+	partner, err = testingGetSession("partner@fakestanford.edu", "TestingPass")
+	if err != nil {
+		t.Fatal("Error getting session:", err)
+	}
+	convID, err = conversationWith(token, partner.UserID)
+	if err != nil {
+		t.Fatal("Error creating conversation:", err)
+	}
+	return
+}
+
+//ageMessage backdates a message to well outside the edit window.
+func ageMessage(id gp.MessageID) error {
+	db, err := sql.Open("mysql", conf.GetConfig().Mysql.ConnectionString())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Exec("UPDATE chat_messages SET `timestamp` = NOW() - INTERVAL 1 DAY WHERE id = ?", id)
+	return err
+}
+
+func messageHistory(token gp.Token, convID gp.ConversationID, msgID gp.MessageID) (edits []gp.MessageEdit, err error) {
+	resp, err := twoFactorRequest("GET", fmt.Sprintf("conversations/%d/messages/%d/edits", convID, msgID), token, nil)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return edits, fmt.Errorf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&edits)
+	return
+}
+
+//waitForMessageEvent polls token's stream from cursor until it sees an event of type etype, and returns the message it carries.
+func waitForMessageEvent(t *testing.T, token gp.Token, cursor, etype string) gp.Message {
+	for i := 0; i < 5; i++ {
+		batch, err := poll(token, cursor, 2)
+		if err != nil {
+			t.Fatal("Error polling:", err)
+		}
+		cursor = batch.Cursor
+		for _, e := range batch.Events {
+			var event struct {
+				Data struct {
+					Type string     `json:"type"`
+					Data gp.Message `json:"data"`
+				} `json:"data"`
+			}
+			err = json.Unmarshal(e, &event)
+			if err != nil {
+				t.Fatal("Error parsing event:", err)
+			}
+			if event.Data.Type == etype {
+				return event.Data.Data
+			}
+		}
+	}
+	t.Fatalf("Never saw a %s event\n", etype)
+	return gp.Message{}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	_ "github.com/Petergatsby/GleepostAPI/db/migrations" //Registers every migration.
+	"github.com/Petergatsby/GleepostAPI/lib/conf"
+	"github.com/Petergatsby/GleepostAPI/lib/migrate"
+)
+
+//baseSchema is the dump which fresh databases start from, before they're migrated up.
+const baseSchema = "lib/example.sql"
+
+const migrateUsage = `usage: gleepost [-conf conf.json] migrate up|down|status|fresh
+	up      apply every pending migration
+	down    roll back the most recent migration
+	status  list every migration and whether it's applied
+	fresh   drop and recreate the configured database from lib/example.sql, then migrate it up (DevelopmentMode only)`
+
+//runCommand runs the command in args instead of the server, and returns the exit status.
+func runCommand(config *conf.Config, args []string) int {
+	if len(args) != 2 || args[0] != "migrate" {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	var err error
+	switch args[1] {
+	case "up", "down", "status":
+		var db *sql.DB
+		db, err = sql.Open("mysql", config.Mysql.ConnectionString())
+		if err != nil {
+			break
+		}
+		defer db.Close()
+		switch args[1] {
+		case "up":
+			err = migrate.Up(db)
+		case "down":
+			err = migrate.Down(db)
+		default:
+			err = printStatus(db)
+		}
+	case "fresh":
+		err = freshDatabase(config)
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
+
+func printStatus(db *sql.DB) error {
+	statuses, err := migrate.Statuses(db)
+	if err != nil {
+		return err
+	}
+	for _, s := range statuses {
+		switch {
+		case s.Applied:
+			fmt.Printf("%-20s %s\n", s.At.Format("2006-01-02 15:04:05"), s.Name)
+		default:
+			fmt.Printf("%-20s %s\n", "Pending", s.Name)
+		}
+	}
+	return nil
+}
+
+//freshDatabase throws away the configured database and builds it again from scratch, for running the tests against.
+func freshDatabase(config *conf.Config) (err error) {
+	if !config.DevelopmentMode {
+		return fmt.Errorf("refusing to drop %s outside DevelopmentMode", config.Mysql.DatabaseName())
+	}
+	schema, err := ioutil.ReadFile(baseSchema)
+	if err != nil {
+		return
+	}
+	server, err := sql.Open("mysql", config.Mysql.ServerConnectionString())
+	if err != nil {
+		return
+	}
+	defer server.Close()
+	name := config.Mysql.DatabaseName()
+	log.Println("Recreating", name)
+	_, err = server.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS `%s`; CREATE DATABASE `%s` CHARACTER SET utf8mb4; USE `%s`; %s", name, name, name, schema))
+	if err != nil {
+		return
+	}
+	db, err := sql.Open("mysql", config.Mysql.ConnectionString())
+	if err != nil {
+		return
+	}
+	defer db.Close()
+	return migrate.Up(db)
+}
+
+//checkSchema refuses to start if the database isn't at the version this build expects, since half the queries could fail. In DevelopmentMode it only warns.
+func checkSchema(config *conf.Config) {
+	db, err := sql.Open("mysql", config.Mysql.ConnectionString())
+	if err != nil {
+		log.Fatal("error getting db:", err)
+	}
+	defer db.Close()
+	err = migrate.Check(db)
+	switch {
+	case err == nil:
+	case config.DevelopmentMode:
+		log.Println("Warning:", err)
+	default:
+		log.Fatal(err)
+	}
+}
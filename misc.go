@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -14,6 +16,7 @@ import (
 	"github.com/Petergatsby/GleepostAPI/lib"
 	"github.com/Petergatsby/GleepostAPI/lib/conf"
 	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/gorilla/mux"
 )
 
 var (
@@ -34,6 +37,9 @@ var EUNSUPPORTED = gp.APIerror{Reason: "Method not supported"}
 //ENOTFOUNT = 404
 var ENOTFOUND = gp.APIerror{Reason: "404 not found"}
 
+//ETIMEOUT = 504
+var ETIMEOUT = gp.APIerror{Reason: "Request timed out", StatusCode: 504}
+
 func optionsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,DELETE")
 	w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -77,8 +83,19 @@ func jsonResponse(w http.ResponseWriter, resp interface{}, code int) {
 }
 
 func jsonErr(w http.ResponseWriter, err error, code int) {
+	//Drivers and clients wrap the context's error, so don't expect to see it bare.
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		go api.Statsd.Count(1, "gleepost.timeout")
+		jsonResponse(w, ETIMEOUT, 504)
+		return
+	case errors.Is(err, context.Canceled):
+		//The client has gone away, so there's nobody to tell.
+		go api.Statsd.Count(1, "gleepost.cancelled")
+		return
+	}
 	switch err.(type) {
-	case gp.APIerror:
+	case gp.APIerror, gp.ValidationErrors:
 		jsonResponse(w, err, code)
 	default:
 		jsonResponse(w, gp.APIerror{Reason: err.Error()}, code)
@@ -92,8 +109,8 @@ func inviteMessageHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func contactFormHandler(w http.ResponseWriter, r *http.Request) {
-	ip := r.Header.Get("X-Real-IP")
-	err := api.ContactFormRequest(r.FormValue("name"), r.FormValue("college"), r.FormValue("email"), r.FormValue("phoneNo"), ip)
+	ip := clientIP(r)
+	err := api.ContactFormRequest(r.Context(), r.FormValue("name"), r.FormValue("college"), r.FormValue("email"), r.FormValue("phoneNo"), ip)
 	if err != nil {
 		if err == lib.ErrInvalidInput || err == lib.InvalidEmail {
 			jsonErr(w, err, 400)
@@ -117,9 +134,18 @@ func chasenHandler(w http.ResponseWriter, r *http.Request) {
 	}{Success: true}, 200)
 }
 
+//longLived are the routes which hold their connection open on purpose (a stream, or a long-poll with its own timeout); they never get a deadline, whatever Timeouts says.
+var longLived = map[string]bool{"/stream": true, "/stream/poll": true}
+
 func timeHandler(api *lib.API, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		route := routeTemplate(r)
+		if timeout, ok := api.Config.Timeouts.For(route); ok && !longLived[route] {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
 		next.ServeHTTP(w, r)
 		metric := statsdMetricName(r)
 		api.Statsd.Time(start, metric)
@@ -133,6 +159,21 @@ func authenticated(next authedHandler) http.Handler {
 			jsonResponse(w, &EBADTOKEN, 401)
 			return
 		}
+		if scope := requiredScope(r); scope == gp.ScopeAdmin || scope == gp.ScopeApprove {
+			_, token := credentials(r)
+			err = api.CheckSecondFactor(r.Context(), userID, token)
+			switch {
+			case err == lib.SecondFactorRequired || err == lib.TwoFactorEnrolmentRequired:
+				jsonResponse(w, err, 403)
+				return
+			case err != nil:
+				jsonErr(w, err, 500)
+				return
+			}
+		}
+		if r.Method != "GET" && r.Method != "HEAD" {
+			api.UserWrote(r.Context(), userID)
+		}
 		next(userID, w, r)
 	})
 }
@@ -141,6 +182,19 @@ type authedHandler func(gp.UserID, http.ResponseWriter, *http.Request)
 
 var ids = regexp.MustCompile(`\.\d+\.`)
 
+//routeTemplate is the path r was routed by, as it was registered on base (eg "/posts/{id:[0-9]+}").
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return r.URL.Path
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return r.URL.Path
+	}
+	return strings.TrimPrefix(template, "/api/{version}")
+}
+
 func statsdMetricName(r *http.Request) string {
 	metric := "gleepost." + strings.Replace(r.URL.Path, "/", ".", -1) + "." + strings.ToLower(r.Method)
 	metric = ids.ReplaceAllString(metric, ".by_id.")
@@ -81,7 +81,7 @@ func getGroups(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 		order = lib.ByActivity
 	}
 	count := int(_count)
-	networks, err := api.UserGetUserGroups(userID, otherID, index, count, order)
+	networks, err := api.UserGetUserGroups(r.Context(), userID, otherID, index, count, order)
 	if err != nil {
 		jsonErr(w, err, 500)
 		return
@@ -99,7 +99,7 @@ func getNetwork(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	netID := gp.NetworkID(_netID)
-	network, err := api.UserGetNetwork(userID, netID)
+	network, err := api.UserGetNetwork(r.Context(), userID, netID)
 	if err != nil {
 		e, ok := err.(*gp.APIerror)
 		if ok && *e == lib.ENOTALLOWED {
@@ -127,10 +127,10 @@ func postNetworks(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	case len(name) == 0:
 		jsonResponse(w, missingParamErr("name"), 400)
 	case err != nil || !university:
-		network, err = api.CreateGroup(userID, name, url, desc, privacy, category)
+		network, err = api.CreateGroup(r.Context(), userID, name, url, desc, privacy, category)
 	default:
 		domains := strings.Split(r.FormValue("domains"), ",")
-		network, err = api.AdminCreateUniversity(userID, name, domains...)
+		network, err = api.AdminCreateUniversity(r.Context(), userID, name, domains...)
 	}
 	switch {
 	case err == lib.ENOTALLOWED:
@@ -175,7 +175,7 @@ func postNetworkUsers(userID gp.UserID, w http.ResponseWriter, r *http.Request)
 	if len(r.FormValue("email")) > 0 {
 		emails = append(emails, r.FormValue("email"))
 	}
-	err = api.UserAddToGroup(userID, netID, users, fbusers, emails)
+	err = api.UserAddToGroup(r.Context(), userID, netID, users, fbusers, emails)
 	if err != nil {
 		e, ok := err.(*gp.APIerror)
 		if ok && *e == lib.ENOTALLOWED {
@@ -209,7 +209,7 @@ func postNetworkAdmins(userID gp.UserID, w http.ResponseWriter, r *http.Request)
 		_user, err := strconv.ParseUint(u, 10, 64)
 		if err == nil {
 			user := gp.UserID(_user)
-			err = api.UserChangeRole(userID, user, netID, "administrator")
+			err = api.UserChangeRole(r.Context(), userID, user, netID, "administrator")
 			if err != nil {
 				e, ok := err.(*gp.APIerror)
 				if ok && *e == lib.ENOTALLOWED {
@@ -223,7 +223,7 @@ func postNetworkAdmins(userID gp.UserID, w http.ResponseWriter, r *http.Request)
 			}
 		}
 	}
-	users, err := api.UserGetGroupAdmins(userID, netID)
+	users, err := api.UserGetGroupAdmins(r.Context(), userID, netID)
 	if err != nil {
 		e, ok := err.(*gp.APIerror)
 		if ok && *e == lib.ENOTALLOWED {
@@ -250,7 +250,7 @@ func getNetworkAdmins(userID gp.UserID, w http.ResponseWriter, r *http.Request)
 		return
 	}
 	netID := gp.NetworkID(_netID)
-	users, err := api.UserGetGroupAdmins(userID, netID)
+	users, err := api.UserGetGroupAdmins(r.Context(), userID, netID)
 	if err != nil {
 		e, ok := err.(*gp.APIerror)
 		if ok && *e == lib.ENOTALLOWED {
@@ -279,7 +279,7 @@ func deleteNetworkAdmins(userID gp.UserID, w http.ResponseWriter, r *http.Reques
 	//Can ignore the error, because api.UserChangeRole will complain if id 0 anyway.
 	_user, _ := strconv.ParseUint(vars["user"], 10, 64)
 	user := gp.UserID(_user)
-	err = api.UserChangeRole(userID, user, netID, "member")
+	err = api.UserChangeRole(r.Context(), userID, user, netID, "member")
 	if err != nil {
 		e, ok := err.(*gp.APIerror)
 		if ok && *e == lib.ENOTALLOWED {
@@ -305,7 +305,7 @@ func getNetworkUsers(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	netID := gp.NetworkID(_netID)
-	users, err := api.UserGetGroupMembers(userID, netID)
+	users, err := api.UserGetGroupMembers(r.Context(), userID, netID)
 	if err != nil {
 		e, ok := err.(*gp.APIerror)
 		if ok && *e == lib.ENOTALLOWED {
@@ -325,7 +325,7 @@ func getNetworkUsers(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 func getGroupPosts(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	url := "gleepost.profile.networks.get"
 	mode, index := interpretPagination(r)
-	posts, err := api.UserGetGroupsPosts(userID, mode, index, api.Config.PostPageSize, r.FormValue("filter"))
+	posts, err := api.UserGetGroupsPosts(r.Context(), userID, mode, index, api.Config.PostPageSize, r.FormValue("filter"))
 	if err != nil {
 		e, ok := err.(*gp.APIerror)
 		if ok && *e == lib.ENOTALLOWED {
@@ -350,7 +350,7 @@ func putNetwork(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	}
 	netID := gp.NetworkID(_netID)
 	url := r.FormValue("url")
-	err = api.UserSetNetworkImage(userID, netID, url)
+	err = api.UserSetNetworkImage(r.Context(), userID, netID, url)
 	if err != nil {
 		e, ok := err.(*gp.APIerror)
 		if ok && *e == lib.ENOTALLOWED {
@@ -360,7 +360,7 @@ func putNetwork(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-	group, err := api.UserGetNetwork(userID, netID)
+	group, err := api.UserGetNetwork(r.Context(), userID, netID)
 	if err != nil {
 		e, ok := err.(*gp.APIerror)
 		if ok && *e == lib.ENOTALLOWED {
@@ -383,7 +383,7 @@ func deleteUserNetwork(userID gp.UserID, w http.ResponseWriter, r *http.Request)
 		return
 	}
 	netID := gp.NetworkID(_netID)
-	err = api.UserLeaveGroup(userID, netID)
+	err = api.UserLeaveGroup(r.Context(), userID, netID)
 	if err != nil {
 		e, ok := err.(*gp.APIerror)
 		if ok && *e == lib.ENOTALLOWED {
@@ -402,7 +402,7 @@ func postNetworkRequests(userID gp.UserID, w http.ResponseWriter, r *http.Reques
 	vars := mux.Vars(r)
 	_netID, _ := strconv.ParseUint(vars["network"], 10, 64)
 	netID := gp.NetworkID(_netID)
-	err := api.UserRequestAccess(userID, netID)
+	err := api.UserRequestAccess(r.Context(), userID, netID)
 	if err != nil {
 		switch {
 		case err == lib.ENOTALLOWED:
@@ -422,7 +422,7 @@ func getNetworkRequests(userID gp.UserID, w http.ResponseWriter, r *http.Request
 	vars := mux.Vars(r)
 	_netID, _ := strconv.ParseUint(vars["network"], 10, 64)
 	netID := gp.NetworkID(_netID)
-	requests, err := api.NetworkRequests(userID, netID)
+	requests, err := api.NetworkRequests(r.Context(), userID, netID)
 	switch {
 	case err == lib.ENOTALLOWED:
 		jsonResponse(w, err, 403)
@@ -438,7 +438,7 @@ func getNetworkRequests(userID gp.UserID, w http.ResponseWriter, r *http.Request
 func getNetworks(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	index, _ := strconv.ParseInt(r.FormValue("start"), 10, 64)
 	filter := r.FormValue("filter")
-	groups, err := api.GroupsByMembershipCount(userID, index, api.Config.GroupPageSize, filter)
+	groups, err := api.GroupsByMembershipCount(r.Context(), userID, index, api.Config.GroupPageSize, filter)
 	if err != nil {
 		jsonErr(w, err, 500)
 		return
@@ -452,7 +452,7 @@ func deleteNetworkRequest(userID gp.UserID, w http.ResponseWriter, r *http.Reque
 	netID := gp.NetworkID(_netID)
 	_requestor, _ := strconv.ParseUint(vars["user"], 10, 64)
 	requestorID := gp.UserID(_requestor)
-	err := api.RejectNetworkRequest(userID, netID, requestorID)
+	err := api.RejectNetworkRequest(r.Context(), userID, netID, requestorID)
 	if err != nil {
 		switch {
 		case err == lib.ENOTALLOWED || err == lib.AlreadyRejected || err == lib.AlreadyAccepted:
@@ -472,7 +472,7 @@ func publicGetUniversity(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	_netID, _ := strconv.ParseUint(vars["network"], 10, 64)
 	netID := gp.NetworkID(_netID)
-	university, err := api.PublicUniversity(netID)
+	university, err := api.PublicUniversity(r.Context(), netID)
 	switch {
 	case err == lib.ENOTALLOWED:
 		jsonResponse(w, err, 403)
@@ -490,7 +490,7 @@ func muteGroupBadge(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 		jsonResponse(w, &EBADTOKEN, 400)
 	default:
 		t := time.Now().UTC()
-		err = api.UserMuteGroupBadge(userID, t)
+		err = api.UserMuteGroupBadge(r.Context(), userID, t)
 		if err != nil {
 			jsonResponse(w, err, 500)
 			return
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+func TestNotificationActions(t *testing.T) {
+	once.Do(setup)
+
+	err := initDB()
+	if err != nil {
+		t.Fatalf("Error initialising db: %v", err)
+	}
+	err = truncate("notifications", "notification_actors")
+	if err != nil {
+		t.Fatalf("Error truncating: %v", err)
+	}
+
+	token, err := testingGetSession("patrick@fakestanford.edu", "TestingPass")
+	if err != nil {
+		t.Fatalf("Error logging in: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		createNotification("added_you", token.UserID, token.UserID, 0, 0, "")
+	}
+	//Someone else's.
+	createNotification("added_you", token.UserID, token.UserID+1, 0, 0, "")
+
+	if count := notificationCount(t, token); count != 4 {
+		t.Fatalf("Expected 4 unseen notifications, got %d", count)
+	}
+	notifications, err := getNotifications(token, "false")
+	if err != nil || len(notifications) != 4 {
+		t.Fatalf("Expected 4 notifications, got %v (%v)", notifications, err)
+	}
+	first, second, third, last := notifications[3].ID, notifications[2].ID, notifications[1].ID, notifications[0].ID
+
+	resp, err := twoFactorRequest("POST", "notifications/seen", token, url.Values{"ids": {fmt.Sprintf("%d,%d,%d", first, second, last+1)}})
+	if err != nil {
+		t.Fatalf("Error marking notifications seen: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected %v, got %v", http.StatusNoContent, resp.StatusCode)
+	}
+	if count := notificationCount(t, token); count != 2 {
+		t.Fatalf("Expected 2 unseen notifications, got %d", count)
+	}
+
+	resp, err = twoFactorRequest("PUT", fmt.Sprintf("notifications/%d", first), token, url.Values{"seen": {"false"}})
+	if err != nil {
+		t.Fatalf("Error marking notification unseen: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected %v, got %v", http.StatusNoContent, resp.StatusCode)
+	}
+	if count := notificationCount(t, token); count != 3 {
+		t.Fatalf("Expected 3 unseen notifications, got %d", count)
+	}
+
+	resp, err = twoFactorRequest("PUT", fmt.Sprintf("notifications/%d", last+1), token, url.Values{"seen": {"true"}})
+	if err != nil {
+		t.Fatalf("Error marking notification seen: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Someone else's notification: expected %v, got %v", http.StatusNotFound, resp.StatusCode)
+	}
+
+	resp, err = twoFactorRequest("DELETE", fmt.Sprintf("notifications/%d", third), token, nil)
+	if err != nil {
+		t.Fatalf("Error deleting notification: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected %v, got %v", http.StatusNoContent, resp.StatusCode)
+	}
+	if count := notificationCount(t, token); count != 2 {
+		t.Fatalf("Expected 2 unseen notifications, got %d", count)
+	}
+	notifications, err = getNotifications(token, "true")
+	if err != nil || len(notifications) != 3 {
+		t.Fatalf("Expected 3 notifications after deleting one, got %v (%v)", notifications, err)
+	}
+
+	resp, err = twoFactorRequest("DELETE", fmt.Sprintf("notifications/%d", third), token, nil)
+	if err != nil {
+		t.Fatalf("Error deleting notification: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Deleting twice: expected %v, got %v", http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+func notificationCount(t *testing.T, token gp.Token) int {
+	resp, err := client.Get(fmt.Sprintf("%snotifications/count?id=%d&token=%s", baseURL, token.UserID, token.Token))
+	if err != nil {
+		t.Fatalf("Error getting notification count: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %v, got %v", http.StatusOK, resp.StatusCode)
+	}
+	var counts gp.BadgeCounts
+	err = json.NewDecoder(resp.Body).Decode(&counts)
+	if err != nil {
+		t.Fatalf("Error parsing counts: %v", err)
+	}
+	return counts.Notifications
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/conf"
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+func TestNotificationAggregation(t *testing.T) {
+	err := initDB()
+	if err != nil {
+		t.Fatal("Error initializing db:", err)
+	}
+	err = truncate("notifications", "notification_actors", "notification_settings", "notification_group_settings", "wall_posts", "post_likes")
+	if err != nil {
+		t.Fatal("Error truncating:", err)
+	}
+	once.Do(setup)
+	postID, err := initAggregation()
+	if err != nil {
+		t.Fatal("Error setting up post:", err)
+	}
+	owner, err := testingGetSession("patrick@fakestanford.edu", "TestingPass")
+	if err != nil {
+		t.Fatal("Error logging in:", err)
+	}
+	var likers []gp.Token
+	for _, email := range []string{"aggregate1@fakestanford.edu", "aggregate2@fakestanford.edu"} {
+		liker, err := testingGetSession(email, "TestingPass")
+		if err != nil {
+			t.Fatal("Error logging in:", err)
+		}
+		likers = append(likers, liker)
+	}
+
+	likePost(t, likers[0], postID, true)
+	first := waitForLike(t, owner, likers[0].UserID)
+
+	likePost(t, likers[1], postID, true)
+	second := waitForLike(t, owner, likers[1].UserID)
+	if second.ID <= first.ID {
+		t.Fatalf("Expected the aggregate to get a newer id than %d, got %d", first.ID, second.ID)
+	}
+	if second.Count != 2 || len(second.Actors) != 2 || second.Actors[0].ID != likers[1].UserID {
+		t.Fatalf("Expected the latest liker first, got %+v", second)
+	}
+
+	//A client which has seen the first notification pages for what's come since.
+	after, err := getPaginatedNotifications(owner, fmt.Sprintf("?after=%d", first.ID))
+	if err != nil {
+		t.Fatal("Error getting notifications:", err)
+	}
+	if len(after) != 1 || after[0].ID != second.ID {
+		t.Fatalf("Expected the aggregate after %d, got %+v", first.ID, after)
+	}
+
+	//Liking again doesn't count twice.
+	likePost(t, likers[0], postID, false)
+	likePost(t, likers[0], postID, true)
+	third := waitForLike(t, owner, likers[0].UserID)
+	if third.Count != 2 || third.Actors[0].ID != likers[0].UserID {
+		t.Fatalf("Expected the repeat liker to be the latest, got %+v", third)
+	}
+}
+
+//waitForLike waits for owner's only "liked" notification to have by as its latest liker, and returns it.
+func waitForLike(t *testing.T, owner gp.Token, by gp.UserID) (like gp.Notification) {
+	for i := 0; i < 20; i++ {
+		notifications, err := getNotifications(owner, "true")
+		if err != nil {
+			t.Fatal("Error getting notifications:", err)
+		}
+		var likes []gp.Notification
+		for _, n := range notifications {
+			if n.Type == "liked" {
+				likes = append(likes, n)
+			}
+		}
+		if len(likes) > 1 {
+			t.Fatalf("Expected likes to be aggregated, got %+v", likes)
+		}
+		if len(likes) == 1 && likes[0].By.ID == by {
+			return likes[0]
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for a like from %d", by)
+	return
+}
+
+//initAggregation creates two users to like a post of patrick's.
+func initAggregation() (postID gp.PostID, err error) {
+	db, err := sql.Open("mysql", conf.GetConfig().Mysql.ConnectionString())
+	if err != nil {
+		return
+	}
+	defer db.Close()
+	var patrick gp.UserID
+	var university gp.NetworkID
+	err = db.QueryRow("SELECT id FROM users WHERE email = 'patrick@fakestanford.edu'").Scan(&patrick)
+	if err != nil {
+		return
+	}
+	err = db.QueryRow("SELECT id FROM network WHERE name = 'Fake Stanford'").Scan(&university)
+	if err != nil {
+		return
+	}
+	for i := 1; i <= 2; i++ {
+		var res sql.Result
+		res, err = db.Exec("INSERT INTO `users` (`password`, `email`, `verified`, `firstname`, `lastname`) VALUES ('$2a$10$xLUmQbvrHAAOGuv4.uHAY.NmoLGEuEObENPiQ8kkh.Miyvdzhyge6', ?, 1, 'Aggregate', ?)", fmt.Sprintf("aggregate%d@fakestanford.edu", i), fmt.Sprintf("Liker%d", i))
+		if err != nil {
+			return
+		}
+		var id int64
+		id, err = res.LastInsertId()
+		if err != nil {
+			return
+		}
+		_, err = db.Exec("INSERT INTO `user_network` (`user_id`, `network_id`) VALUES (?, ?)", id, university)
+		if err != nil {
+			return
+		}
+	}
+	res, err := db.Exec("INSERT INTO wall_posts (`by`, text, network_id) VALUES (?, ?, ?)", patrick, "Like this", university)
+	if err != nil {
+		return
+	}
+	id, err := res.LastInsertId()
+	return gp.PostID(id), err
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+func TestNotificationSettings(t *testing.T) {
+	err := initDB()
+	if err != nil {
+		t.Fatalf("Error initializing db: %v\n", err)
+	}
+	err = truncate("notification_settings", "notification_group_settings", "notification_quiet_hours", "email_digests")
+	if err != nil {
+		t.Fatalf("Error truncating: %v\n", err)
+	}
+	once.Do(setup)
+
+	session, err := testingGetSession("patrick@fakestanford.edu", "TestingPass")
+	if err != nil {
+		t.Fatalf("Error logging in: %v\n", err)
+	}
+
+	resp, err := client.Get(fmt.Sprintf("%sprofile/notification_settings?id=%d&token=%s", baseURL, session.UserID, session.Token))
+	if err != nil {
+		t.Fatalf("Error getting settings: %v\n", err)
+	}
+	settings := decodeSettings(t, resp, http.StatusOK)
+	if c := settings.Types["liked"]; !c.InApp || !c.Push || !c.Email {
+		t.Fatalf("Expected every channel on by default, got %+v\n", c)
+	}
+	if settings.QuietHours != nil {
+		t.Fatalf("Expected no quiet hours, got %+v\n", settings.QuietHours)
+	}
+	if settings.Digest != "weekly" {
+		t.Fatalf("Expected weekly digests by default, got %s\n", settings.Digest)
+	}
+
+	resp, err = twoFactorRequest("POST", "profile/notification_settings/digest", session, url.Values{"frequency": {"daily"}})
+	if err != nil {
+		t.Fatalf("Error changing digest frequency: %v\n", err)
+	}
+	settings = decodeSettings(t, resp, http.StatusOK)
+	if settings.Digest != "daily" {
+		t.Fatalf("Expected daily digests, got %s\n", settings.Digest)
+	}
+
+	resp, err = client.Get(fmt.Sprintf("%sunsubscribe?user=%d&sig=forged", baseURL, session.UserID))
+	if err != nil {
+		t.Fatalf("Error unsubscribing: %v\n", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected %v, got %v\n", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	resp, err = twoFactorRequest("POST", "profile/notification_settings", session, url.Values{"type": {"liked"}, "push": {"false"}})
+	if err != nil {
+		t.Fatalf("Error changing settings: %v\n", err)
+	}
+	settings = decodeSettings(t, resp, http.StatusOK)
+	if c := settings.Types["liked"]; !c.InApp || c.Push || !c.Email {
+		t.Fatalf("Expected only push to be off, got %+v\n", c)
+	}
+
+	resp, err = twoFactorRequest("POST", "profile/notification_settings", session, url.Values{"type": {"poked"}, "push": {"false"}})
+	if err != nil {
+		t.Fatalf("Error changing settings: %v\n", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected %v, got %v\n", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	resp, err = twoFactorRequest("POST", "profile/notification_settings/quiet_hours", session, url.Values{"start": {"25:00"}, "end": {"07:00"}})
+	if err != nil {
+		t.Fatalf("Error setting quiet hours: %v\n", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected %v, got %v\n", http.StatusBadRequest, resp.StatusCode)
+	}
+	resp, err = twoFactorRequest("POST", "profile/notification_settings/quiet_hours", session, url.Values{"start": {"22:00"}, "end": {"07:00"}, "timezone": {"America/Los_Angeles"}})
+	if err != nil {
+		t.Fatalf("Error setting quiet hours: %v\n", err)
+	}
+	settings = decodeSettings(t, resp, http.StatusOK)
+	if q := settings.QuietHours; q == nil || q.Start != "22:00" || q.End != "07:00" || q.Timezone != "America/Los_Angeles" {
+		t.Fatalf("Unexpected quiet hours: %+v\n", q)
+	}
+
+	resp, err = twoFactorRequest("DELETE", "profile/notification_settings/quiet_hours", session, nil)
+	if err != nil {
+		t.Fatalf("Error clearing quiet hours: %v\n", err)
+	}
+	settings = decodeSettings(t, resp, http.StatusOK)
+	if settings.QuietHours != nil {
+		t.Fatalf("Expected quiet hours to be cleared, got %+v\n", settings.QuietHours)
+	}
+}
+
+func decodeSettings(t *testing.T, resp *http.Response, code int) (settings gp.NotificationSettings) {
+	defer resp.Body.Close()
+	if resp.StatusCode != code {
+		t.Fatalf("Expected %v, got %v\n", code, resp.StatusCode)
+	}
+	err := json.NewDecoder(resp.Body).Decode(&settings)
+	if err != nil {
+		t.Fatalf("Error parsing settings: %v\n", err)
+	}
+	return
+}
+
+func TestUnsubscribe(t *testing.T) {
+	err := initDB()
+	if err != nil {
+		t.Fatalf("Error initializing db: %v\n", err)
+	}
+	err = truncate("email_digests")
+	if err != nil {
+		t.Fatalf("Error truncating: %v\n", err)
+	}
+	once.Do(setup)
+	api.Config.Digest.Secret = "sekrit"
+	defer func() { api.Config.Digest.Secret = "" }()
+
+	session, err := testingGetSession("patrick@fakestanford.edu", "TestingPass")
+	if err != nil {
+		t.Fatalf("Error logging in: %v\n", err)
+	}
+	mac := hmac.New(sha256.New, []byte("sekrit"))
+	fmt.Fprintf(mac, "unsubscribe:%d", session.UserID)
+	link := url.Values{"user": {fmt.Sprintf("%d", session.UserID)}, "sig": {base64.RawURLEncoding.EncodeToString(mac.Sum(nil))}}
+
+	//Opening the link only asks for confirmation.
+	resp, err := client.Get(baseURL + "unsubscribe?" + link.Encode())
+	if err != nil {
+		t.Fatalf("Error opening unsubscribe link: %v\n", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `method="POST"`) {
+		t.Fatalf("Expected a confirmation form, got %d: %s\n", resp.StatusCode, body)
+	}
+	if digest := currentDigest(t, session); digest != "weekly" {
+		t.Fatalf("Opening the link shouldn't unsubscribe, but digest is %s\n", digest)
+	}
+
+	//A mail client's one-click unsubscribe POSTs to the link.
+	resp, err = client.Post(baseURL+"unsubscribe?"+link.Encode(), "application/x-www-form-urlencoded", strings.NewReader("List-Unsubscribe=One-Click"))
+	if err != nil {
+		t.Fatalf("Error unsubscribing: %v\n", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %v, got %v\n", http.StatusOK, resp.StatusCode)
+	}
+	if digest := currentDigest(t, session); digest != "never" {
+		t.Fatalf("Expected to be unsubscribed, but digest is %s\n", digest)
+	}
+}
+
+func currentDigest(t *testing.T, session gp.Token) string {
+	resp, err := client.Get(fmt.Sprintf("%sprofile/notification_settings?id=%d&token=%s", baseURL, session.UserID, session.Token))
+	if err != nil {
+		t.Fatalf("Error getting settings: %v\n", err)
+	}
+	return decodeSettings(t, resp, http.StatusOK).Digest
+}
@@ -1,16 +1,48 @@
 package main
 
 import (
+	"html/template"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/Petergatsby/GleepostAPI/lib"
 	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/gorilla/mux"
 )
 
 func init() {
 	base.Handle("/notifications", timeHandler(api, authenticated(notificationHandler))).Methods("PUT", "GET")
 	base.Handle("/notifications", timeHandler(api, http.HandlerFunc(optionsHandler))).Methods("OPTIONS")
 	base.Handle("/notifications", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/notifications/count", timeHandler(api, authenticated(getNotificationCount))).Methods("GET")
+	base.Handle("/notifications/count", timeHandler(api, http.HandlerFunc(optionsHandler))).Methods("OPTIONS")
+	base.Handle("/notifications/count", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/notifications/seen", timeHandler(api, authenticated(postNotificationsSeen))).Methods("POST")
+	base.Handle("/notifications/seen", timeHandler(api, http.HandlerFunc(optionsHandler))).Methods("OPTIONS")
+	base.Handle("/notifications/seen", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/notifications/{id:[0-9]+}", timeHandler(api, authenticated(putNotification))).Methods("PUT")
+	base.Handle("/notifications/{id:[0-9]+}", timeHandler(api, authenticated(deleteNotification))).Methods("DELETE")
+	base.Handle("/notifications/{id:[0-9]+}", timeHandler(api, http.HandlerFunc(optionsHandler))).Methods("OPTIONS")
+	base.Handle("/notifications/{id:[0-9]+}", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/profile/notification_settings", timeHandler(api, authenticated(getNotificationSettings))).Methods("GET")
+	base.Handle("/profile/notification_settings", timeHandler(api, authenticated(postNotificationSettings))).Methods("POST")
+	base.Handle("/profile/notification_settings", timeHandler(api, http.HandlerFunc(optionsHandler))).Methods("OPTIONS")
+	base.Handle("/profile/notification_settings", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/profile/notification_settings/networks/{network:[0-9]+}", timeHandler(api, authenticated(postGroupNotificationSettings))).Methods("POST")
+	base.Handle("/profile/notification_settings/networks/{network:[0-9]+}", timeHandler(api, authenticated(deleteGroupNotificationSettings))).Methods("DELETE")
+	base.Handle("/profile/notification_settings/networks/{network:[0-9]+}", timeHandler(api, http.HandlerFunc(optionsHandler))).Methods("OPTIONS")
+	base.Handle("/profile/notification_settings/networks/{network:[0-9]+}", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/profile/notification_settings/quiet_hours", timeHandler(api, authenticated(postQuietHours))).Methods("POST")
+	base.Handle("/profile/notification_settings/quiet_hours", timeHandler(api, authenticated(deleteQuietHours))).Methods("DELETE")
+	base.Handle("/profile/notification_settings/quiet_hours", timeHandler(api, http.HandlerFunc(optionsHandler))).Methods("OPTIONS")
+	base.Handle("/profile/notification_settings/quiet_hours", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/profile/notification_settings/digest", timeHandler(api, authenticated(postDigestFrequency))).Methods("POST")
+	base.Handle("/profile/notification_settings/digest", timeHandler(api, http.HandlerFunc(optionsHandler))).Methods("OPTIONS")
+	base.Handle("/profile/notification_settings/digest", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/unsubscribe", timeHandler(api, http.HandlerFunc(unsubscribeConfirmHandler))).Methods("GET")
+	base.Handle("/unsubscribe", timeHandler(api, http.HandlerFunc(unsubscribeHandler))).Methods("POST")
+	base.Handle("/unsubscribe", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
 }
 
 func notificationHandler(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
@@ -23,11 +55,11 @@ func notificationHandler(userID gp.UserID, w http.ResponseWriter, r *http.Reques
 		includeSeen, _ := strconv.ParseBool(r.FormValue("include_seen"))
 		mode, index := interpretPagination(r)
 		notificationID := gp.NotificationID(_upTo)
-		err = api.MarkNotificationsSeen(userID, notificationID)
+		err = api.MarkNotificationsSeen(r.Context(), userID, notificationID)
 		if err != nil {
 			jsonErr(w, err, 500)
 		} else {
-			notifications, err := api.GetUserNotifications(userID, mode, index, includeSeen)
+			notifications, err := api.GetUserNotifications(r.Context(), userID, mode, index, includeSeen)
 			if err != nil {
 				jsonErr(w, err, 500)
 			} else {
@@ -37,7 +69,7 @@ func notificationHandler(userID gp.UserID, w http.ResponseWriter, r *http.Reques
 	case r.Method == "GET":
 		includeSeen, _ := strconv.ParseBool(r.FormValue("include_seen"))
 		mode, index := interpretPagination(r)
-		notifications, err := api.GetUserNotifications(userID, mode, index, includeSeen)
+		notifications, err := api.GetUserNotifications(r.Context(), userID, mode, index, includeSeen)
 		if err != nil {
 			jsonErr(w, err, 500)
 		} else {
@@ -45,3 +77,221 @@ func notificationHandler(userID gp.UserID, w http.ResponseWriter, r *http.Reques
 		}
 	}
 }
+
+//getNotificationCount returns just the badge counts, for clients which don't need the notifications themselves.
+func getNotificationCount(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	counts, err := api.BadgeCounts(r.Context(), userID)
+	if err != nil {
+		jsonErr(w, err, 500)
+		return
+	}
+	jsonResponse(w, counts, 200)
+}
+
+//postNotificationsSeen marks a comma-separated list of notification ids as seen.
+func postNotificationsSeen(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	var ids []gp.NotificationID
+	for _, i := range strings.Split(r.FormValue("ids"), ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(i), 10, 64)
+		if err == nil {
+			ids = append(ids, gp.NotificationID(id))
+		}
+	}
+	err := api.MarkNotificationIDsSeen(r.Context(), userID, ids)
+	switch {
+	case err == lib.TooManyNotifications:
+		jsonResponse(w, err, 400)
+	case err != nil:
+		jsonErr(w, err, 500)
+	default:
+		w.WriteHeader(204)
+	}
+}
+
+//putNotification marks a single notification as seen, or unseen with seen=false.
+func putNotification(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	_id, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	seen, err := strconv.ParseBool(r.FormValue("seen"))
+	if err != nil {
+		jsonResponse(w, gp.APIerror{Reason: "seen must be true or false"}, 400)
+		return
+	}
+	err = api.SetNotificationSeen(r.Context(), userID, gp.NotificationID(_id), seen)
+	switch {
+	case err == lib.NoSuchNotification:
+		jsonResponse(w, err, 404)
+	case err != nil:
+		jsonErr(w, err, 500)
+	default:
+		w.WriteHeader(204)
+	}
+}
+
+func deleteNotification(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	_id, _ := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	err := api.DeleteNotification(r.Context(), userID, gp.NotificationID(_id))
+	switch {
+	case err == lib.NoSuchNotification:
+		jsonResponse(w, err, 404)
+	case err != nil:
+		jsonErr(w, err, 500)
+	default:
+		w.WriteHeader(204)
+	}
+}
+
+//settingsResponse replies with userID's notification settings as they are now.
+func settingsResponse(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	settings, err := api.NotificationSettings(r.Context(), userID)
+	if err != nil {
+		jsonErr(w, err, 500)
+		return
+	}
+	jsonResponse(w, settings, 200)
+}
+
+func getNotificationSettings(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	settingsResponse(userID, w, r)
+}
+
+//channelsFromForm applies whichever of in_app, push and email are in the request to current.
+func channelsFromForm(r *http.Request, current gp.Channels) gp.Channels {
+	if v, err := strconv.ParseBool(r.FormValue("in_app")); err == nil {
+		current.InApp = v
+	}
+	if v, err := strconv.ParseBool(r.FormValue("push")); err == nil {
+		current.Push = v
+	}
+	if v, err := strconv.ParseBool(r.FormValue("email")); err == nil {
+		current.Email = v
+	}
+	return current
+}
+
+//postNotificationSettings changes how the user receives one type of notification.
+func postNotificationSettings(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	settings, err := api.NotificationSettings(r.Context(), userID)
+	if err != nil {
+		jsonErr(w, err, 500)
+		return
+	}
+	ntype := r.FormValue("type")
+	current, ok := settings.Types[ntype]
+	if !ok {
+		jsonResponse(w, lib.BadNotificationType, 400)
+		return
+	}
+	err = api.SetNotificationChannels(r.Context(), userID, ntype, channelsFromForm(r, current))
+	if err != nil {
+		jsonErr(w, err, 500)
+		return
+	}
+	settingsResponse(userID, w, r)
+}
+
+//postGroupNotificationSettings overrides how the user receives notifications about one group.
+func postGroupNotificationSettings(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	_netID, _ := strconv.ParseUint(mux.Vars(r)["network"], 10, 64)
+	netID := gp.NetworkID(_netID)
+	settings, err := api.NotificationSettings(r.Context(), userID)
+	if err != nil {
+		jsonErr(w, err, 500)
+		return
+	}
+	current := gp.Channels{InApp: true, Push: true, Email: true}
+	for _, g := range settings.Groups {
+		if g.Group == netID {
+			current = g.Channels
+		}
+	}
+	err = api.SetGroupNotificationChannels(r.Context(), userID, netID, channelsFromForm(r, current))
+	switch {
+	case err == lib.ENOTALLOWED:
+		jsonResponse(w, err, 403)
+	case err != nil:
+		jsonErr(w, err, 500)
+	default:
+		settingsResponse(userID, w, r)
+	}
+}
+
+func deleteGroupNotificationSettings(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	_netID, _ := strconv.ParseUint(mux.Vars(r)["network"], 10, 64)
+	err := api.ClearGroupNotificationChannels(r.Context(), userID, gp.NetworkID(_netID))
+	if err != nil {
+		jsonErr(w, err, 500)
+		return
+	}
+	settingsResponse(userID, w, r)
+}
+
+func postQuietHours(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	q := gp.QuietHours{Start: r.FormValue("start"), End: r.FormValue("end"), Timezone: r.FormValue("timezone")}
+	err := api.SetQuietHours(r.Context(), userID, q)
+	switch {
+	case err == lib.BadQuietHours || err == lib.BadTimezone:
+		jsonResponse(w, err, 400)
+	case err != nil:
+		jsonErr(w, err, 500)
+	default:
+		settingsResponse(userID, w, r)
+	}
+}
+
+func deleteQuietHours(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	err := api.ClearQuietHours(r.Context(), userID)
+	if err != nil {
+		jsonErr(w, err, 500)
+		return
+	}
+	settingsResponse(userID, w, r)
+}
+
+func postDigestFrequency(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	err := api.SetDigestFrequency(r.Context(), userID, r.FormValue("frequency"))
+	switch {
+	case err == lib.BadDigestFrequency:
+		jsonResponse(w, err, 400)
+	case err != nil:
+		jsonErr(w, err, 500)
+	default:
+		settingsResponse(userID, w, r)
+	}
+}
+
+var unsubscribeConfirmation = template.Must(template.New("unsubscribe").Parse(`<html><body>
+<form method="POST" action="unsubscribe">
+<input type="hidden" name="user" value="{{.User}}">
+<input type="hidden" name="sig" value="{{.Sig}}">
+<p>Stop getting digest emails from Gleepost?</p>
+<button type="submit">Unsubscribe</button>
+</form>
+</body></html>`))
+
+//unsubscribeConfirmHandler is where the link at the bottom of a digest email goes. Mail scanners and link prefetchers open links, so it only asks the user to confirm; that POSTs to unsubscribeHandler.
+func unsubscribeConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	_userID, _ := strconv.ParseUint(r.FormValue("user"), 10, 64)
+	err := api.CheckUnsubscribe(gp.UserID(_userID), r.FormValue("sig"))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte("<html><body>This unsubscribe link isn't valid.</body></html>"))
+		return
+	}
+	unsubscribeConfirmation.Execute(w, struct{ User, Sig string }{r.FormValue("user"), r.FormValue("sig")})
+}
+
+//unsubscribeHandler turns off digest emails, either from the confirmation page or a mail client's one-click List-Unsubscribe-Post. It works without logging in; the link is signed instead.
+func unsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	_userID, _ := strconv.ParseUint(r.FormValue("user"), 10, 64)
+	err := api.Unsubscribe(r.Context(), gp.UserID(_userID), r.FormValue("sig"))
+	switch {
+	case err == lib.BadUnsubscribe:
+		w.WriteHeader(400)
+		w.Write([]byte("<html><body>This unsubscribe link isn't valid.</body></html>"))
+	case err != nil:
+		w.WriteHeader(500)
+		w.Write([]byte("<html><body>Something went wrong; please try again later.</body></html>"))
+	default:
+		w.Write([]byte("<html><body>You won't get any more digest emails from Gleepost. You can turn them back on in the app's settings.</body></html>"))
+	}
+}
@@ -109,7 +109,7 @@ func TestPassReset(t *testing.T) {
 		ResetTwice:         false,
 		RequestTwice:       false,
 		ExpectedStatusCode: http.StatusBadRequest,
-		ExpectedError:      "Password too weak!",
+		ExpectedError:      "Password must be at least 8 characters",
 	}
 	testResetTwice := passResetTest{
 		Email:              "pass_reset_test5@fakestanford.edu",
@@ -72,9 +72,9 @@ func getPosts(userID gp.UserID, w http.ResponseWriter, req *http.Request) {
 			return
 		}
 		network = gp.NetworkID(_network)
-		posts, err = api.UserGetNetworkPosts(userID, network, mode, index, api.Config.PostPageSize, filter)
+		posts, err = api.UserGetNetworkPosts(req.Context(), userID, network, mode, index, api.Config.PostPageSize, filter)
 	default: //We haven't been given a network, which means this handler is being called by /posts and we just want the users' default network
-		posts, err = api.UserGetPrimaryNetworkPosts(userID, mode, index, api.Config.PostPageSize, filter)
+		posts, err = api.UserGetPrimaryNetworkPosts(req.Context(), userID, mode, index, api.Config.PostPageSize, filter)
 	}
 	if err != nil {
 		e, ok := err.(*gp.APIerror)
@@ -118,9 +118,9 @@ func postPosts(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	var pending bool
 	var err error
 	if network > 0 {
-		postID, pending, err = api.UserAddPost(userID, network, text, attribs, videoID, false, url, pollExpiry, pollOptions, ts...)
+		postID, pending, err = api.UserAddPost(r.Context(), userID, network, text, attribs, videoID, false, url, pollExpiry, pollOptions, ts...)
 	} else {
-		postID, pending, err = api.UserAddPostToPrimary(userID, text, attribs, videoID, false, url, pollExpiry, pollOptions, ts...)
+		postID, pending, err = api.UserAddPostToPrimary(r.Context(), userID, text, attribs, videoID, false, url, pollExpiry, pollOptions, ts...)
 	}
 	e, ok := err.(gp.APIerror)
 	switch {
@@ -142,7 +142,7 @@ func putPosts(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	network := gp.NetworkID(_network)
 	_postID, _ := strconv.ParseUint(r.FormValue("seen"), 10, 64)
 	upTo := gp.PostID(_postID)
-	err := api.MarkPostsSeen(userID, network, upTo)
+	err := api.MarkPostsSeen(r.Context(), userID, network, upTo)
 	if err != nil {
 		jsonErr(w, err, 500)
 	} else {
@@ -159,7 +159,7 @@ func getComments(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		start = 0
 	}
-	comments, err := api.UserGetComments(userID, postID, start, api.Config.CommentPageSize)
+	comments, err := api.UserGetComments(r.Context(), userID, postID, start, api.Config.CommentPageSize)
 	if err != nil {
 		if err == lib.ENOTALLOWED {
 			jsonErr(w, err, 403)
@@ -176,7 +176,7 @@ func postComments(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	_id, _ := strconv.ParseUint(vars["id"], 10, 64)
 	postID := gp.PostID(_id)
 	text := r.FormValue("text")
-	commentID, err := api.CreateComment(postID, userID, text)
+	commentID, err := api.CreateComment(r.Context(), postID, userID, text)
 	if err != nil {
 		switch {
 		case err == lib.CommentTooShort:
@@ -199,7 +199,7 @@ func getPost(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	_id, _ := strconv.ParseUint(vars["id"], 10, 64)
 	postID := gp.PostID(_id)
-	post, err := api.UserGetPost(userID, postID)
+	post, err := api.UserGetPost(r.Context(), userID, postID)
 	if err != nil {
 		e, ok := err.(*gp.APIerror)
 		if ok && *e == lib.ENOTALLOWED {
@@ -232,7 +232,7 @@ func putPost(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 			attribs[k] = strings.Join(v, "")
 		}
 	}
-	updatedPost, err := api.UserEditPost(userID, postID, text, attribs, imgurl, videoID, reason, ts...)
+	updatedPost, err := api.UserEditPost(r.Context(), userID, postID, text, attribs, imgurl, videoID, reason, ts...)
 	if err != nil {
 		e, ok := err.(*gp.APIerror)
 		if ok && *e == lib.ENOTALLOWED {
@@ -250,7 +250,7 @@ func postImages(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	_id, _ := strconv.ParseUint(vars["id"], 10, 64)
 	postID := gp.PostID(_id)
 	url := r.FormValue("url")
-	images, err := api.UserAddPostImage(userID, postID, url)
+	images, err := api.UserAddPostImage(r.Context(), userID, postID, url)
 	switch {
 	case err == lib.ENOTALLOWED:
 		jsonErr(w, err, 403)
@@ -269,7 +269,7 @@ func postVideos(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	postID := gp.PostID(_id)
 	_videoID, err := strconv.ParseUint(r.FormValue("video"), 10, 64)
 	videoID := gp.VideoID(_videoID)
-	videos, err := api.UserAddPostVideo(userID, postID, videoID)
+	videos, err := api.UserAddPostVideo(r.Context(), userID, postID, videoID)
 	if err != nil {
 		jsonErr(w, err, 500)
 	} else {
@@ -286,7 +286,7 @@ func postLikes(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	case err != nil:
 		jsonErr(w, err, 400)
 	default:
-		err = api.UserSetLike(userID, postID, liked)
+		err = api.UserSetLike(r.Context(), userID, postID, liked)
 		switch {
 		case err == lib.ENOTALLOWED:
 			jsonResponse(w, err, 403)
@@ -302,7 +302,7 @@ func liveHandler(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	after := r.FormValue("after")
 	until := r.FormValue("until")
 	category := r.FormValue("filter")
-	posts, err := api.UserGetLive(userID, after, until, api.Config.PostPageSize, category)
+	posts, err := api.UserGetLive(r.Context(), userID, after, until, api.Config.PostPageSize, category)
 	if err != nil {
 		code := 500
 		if err == lib.EBADTIME {
@@ -317,7 +317,7 @@ func liveHandler(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 func liveSummaryHandler(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	after := r.FormValue("after")
 	until := r.FormValue("until")
-	summary, err := api.UserGetLiveSummary(userID, after, until)
+	summary, err := api.UserGetLiveSummary(r.Context(), userID, after, until)
 	if err != nil {
 		code := 500
 		if err == lib.EBADTIME {
@@ -339,7 +339,7 @@ func attendHandler(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	case r.Method == "POST":
 		//For now, assume that err is because the user specified a bad post.
 		//Could also be a db error.
-		err := api.UserAttend(post, userID, true)
+		err := api.UserAttend(r.Context(), post, userID, true)
 		if err != nil {
 			jsonResponse(w, err, 400)
 		}
@@ -347,7 +347,7 @@ func attendHandler(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	case r.Method == "DELETE":
 		//For now, assume that err is because the user specified a bad post.
 		//Could also be a db error.
-		err := api.UserAttend(post, userID, false)
+		err := api.UserAttend(r.Context(), post, userID, false)
 		if err != nil {
 			jsonResponse(w, err, 400)
 		}
@@ -359,7 +359,7 @@ func deletePost(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	_id, _ := strconv.ParseUint(vars["id"], 10, 64)
 	postID := gp.PostID(_id)
-	err := api.UserDeletePost(userID, postID)
+	err := api.UserDeletePost(r.Context(), userID, postID)
 	if err != nil {
 		e, ok := err.(*gp.APIerror)
 		if ok && *e == lib.ENOTALLOWED {
@@ -378,7 +378,7 @@ func putAttendees(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	_postID, _ := strconv.ParseUint(vars["id"], 10, 64)
 	postID := gp.PostID(_postID)
-	err := api.UserAttend(postID, userID, attending)
+	err := api.UserAttend(r.Context(), postID, userID, attending)
 	if err != nil {
 		e, ok := err.(*gp.APIerror)
 		if ok && *e == lib.ENOTALLOWED {
@@ -395,7 +395,7 @@ func getAttendees(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	_postID, _ := strconv.ParseUint(vars["id"], 10, 64)
 	postID := gp.PostID(_postID)
-	attendees, err := api.UserGetEventAttendees(userID, postID)
+	attendees, err := api.UserGetEventAttendees(r.Context(), userID, postID)
 	switch {
 	case err == lib.ENOTALLOWED:
 		jsonResponse(w, err, 403)
@@ -430,7 +430,7 @@ func postVotes(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	_postID, _ := strconv.ParseUint(vars["id"], 10, 64)
 	postID := gp.PostID(_postID)
 	option, _ := strconv.ParseInt(r.FormValue("option"), 10, 64)
-	err := api.UserCastVote(userID, postID, int(option))
+	err := api.UserCastVote(r.Context(), userID, postID, int(option))
 	switch {
 	case err == lib.ENOTALLOWED:
 		jsonResponse(w, err, 403)
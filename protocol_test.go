@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/gorilla/websocket"
+)
+
+func TestProtocolVersion(t *testing.T) {
+	err := initDB()
+	if err != nil {
+		t.Fatal("Error initializing db:", err)
+	}
+	once.Do(setup)
+	token, err := testingGetSession("patrick@fakestanford.edu", "TestingPass")
+	if err != nil {
+		t.Fatal("Error getting session:", err)
+	}
+	createConversation(token)
+	header := make(http.Header)
+	header.Set("X-GP-Auth", fmt.Sprintf("%d-%s", token.UserID, token.Token))
+	ws, resp, err := websocket.DefaultDialer.Dial("ws"+baseURL[4:]+"ws?protocol=2", header)
+	if err != nil {
+		t.Fatal("Couldn't acquire wss connection:", err)
+	}
+	defer ws.Close()
+	if resp.Header.Get("X-GP-Protocol") != "2" {
+		t.Fatal("Expected protocol 2, got", resp.Header.Get("X-GP-Protocol"))
+	}
+	err = ws.WriteJSON(wrappedAction{Data: action{Action: "presence", Form: "desktop"}})
+	if err != nil {
+		t.Fatal("Error writing status to ws:", err)
+	}
+	evt := gp.Event{}
+	err = ws.ReadJSON(&evt)
+	if err != nil {
+		t.Fatal("Couldn't read from websocket:", err)
+	}
+	if evt.Type != "presence" || evt.Version != 1 {
+		t.Fatal("Expected an unwrapped presence event, got:", evt)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/conf"
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/psc"
+	"github.com/Petergatsby/GleepostAPI/lib/store"
+)
+
+func TestPushQueueClaims(t *testing.T) {
+	q, db, ctx := pushQueueFixture(t, 10)
+	defer db.Close()
+	var mu sync.Mutex
+	claimed := make(map[uint64]int)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				job, err := q.Claim(ctx, fmt.Sprintf("worker-%d-%d", w, i), time.Minute, testApp)
+				if err != nil {
+					if err != sql.ErrNoRows {
+						t.Error("Error claiming push:", err)
+					}
+					return
+				}
+				mu.Lock()
+				claimed[job.ID]++
+				mu.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+	if len(claimed) != 10 {
+		t.Fatalf("Expected all 10 pushes to be claimed, got %d", len(claimed))
+	}
+	for id, n := range claimed {
+		if n != 1 {
+			t.Fatalf("Push %d was claimed %d times", id, n)
+		}
+	}
+	//An expired lease lets another worker take over.
+	_, err := db.Exec("UPDATE push_queue SET locked_until = NOW() - INTERVAL 1 SECOND LIMIT 1")
+	if err != nil {
+		t.Fatal("Error expiring lease:", err)
+	}
+	if _, err = q.Claim(ctx, "takeover", time.Minute, testApp); err != nil {
+		t.Fatal("Expected to take over an expired lease, got", err)
+	}
+}
+
+func TestPushQueueRetryAndDeadLetter(t *testing.T) {
+	q, db, ctx := pushQueueFixture(t, 1)
+	defer db.Close()
+	job, err := q.Claim(ctx, "worker", time.Minute, testApp)
+	if err != nil {
+		t.Fatal("Error claiming push:", err)
+	}
+	err = q.Retry(ctx, job.ID, 1, time.Hour, "APNs: 503 ServiceUnavailable")
+	if err != nil {
+		t.Fatal("Error rescheduling push:", err)
+	}
+	if _, err = q.Claim(ctx, "worker", time.Minute, testApp); err != sql.ErrNoRows {
+		t.Fatal("A push which is backing off shouldn't be claimable, got", err)
+	}
+	var attempts int
+	var lastError string
+	err = db.QueryRow("SELECT attempts, last_error FROM push_queue WHERE id = ?", job.ID).Scan(&attempts, &lastError)
+	if err != nil || attempts != 1 || lastError != "APNs: 503 ServiceUnavailable" {
+		t.Fatalf("Expected 1 failed attempt, got %d (%q, %v)", attempts, lastError, err)
+	}
+
+	job.Attempts = 8
+	err = q.DeadLetter(ctx, job, "APNs: 503 ServiceUnavailable")
+	if err != nil {
+		t.Fatal("Error dead-lettering push:", err)
+	}
+	var queued, dead int
+	db.QueryRow("SELECT COUNT(*) FROM push_queue").Scan(&queued)
+	db.QueryRow("SELECT COUNT(*) FROM push_dead_letters WHERE attempts = 8 AND device_id = ?", "device").Scan(&dead)
+	if queued != 0 || dead != 1 {
+		t.Fatalf("Expected the push to move to the dead letters, got %d queued, %d dead", queued, dead)
+	}
+}
+
+//testApp is an application this server has no pusher for, so that its own workers leave these pushes alone.
+var testApp = []string{"pushqueue-test"}
+
+//pushQueueFixture empties the real push_queue table and fills it with pushes for testApp.
+func pushQueueFixture(t *testing.T, pushes int) (store.PushQueue, *sql.DB, context.Context) {
+	err := initDB()
+	if err != nil {
+		t.Fatal("Error initializing db:", err)
+	}
+	err = truncate("push_queue", "push_dead_letters")
+	if err != nil {
+		t.Fatal("Error truncating push queue:", err)
+	}
+	db, err := sql.Open("mysql", conf.GetConfig().Mysql.ConnectionString())
+	if err != nil {
+		t.Fatal("Error initializing db:", err)
+	}
+	q := store.NewMySQL(db, psc.NewCache(db, 20), nil).PushQueue
+	ctx := context.Background()
+	for i := 0; i < pushes; i++ {
+		err = q.Enqueue(ctx, testApp[0], gp.Device{User: 1, Type: "ios", ID: "device"}, "{}")
+		if err != nil {
+			t.Fatal("Error enqueueing push:", err)
+		}
+	}
+	return q, db, ctx
+}
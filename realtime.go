@@ -1,18 +1,70 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/Petergatsby/GleepostAPI/lib"
+	"github.com/Petergatsby/GleepostAPI/lib/events"
 	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/realtime"
 	"github.com/gorilla/websocket"
 )
 
 func init() {
 	base.HandleFunc("/ws", wsHandler)
+	base.Handle("/events/schema", timeHandler(api, http.HandlerFunc(eventSchemaHandler))).Methods("GET")
+	base.Handle("/events/schema", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+}
+
+//Websocket protocol versions. Version 1 wraps each event as {"event":"message","data":{...}}; version 2 sends the event as it is.
+const (
+	protocolWrapped = 1
+	protocolBare    = 2
+	latestProtocol  = protocolBare
+)
+
+//wsProtocol picks the protocol version for a websocket: the one the client asked for with ?protocol=, or the newest we have if that's newer.
+//Clients which don't ask get version 1.
+func wsProtocol(r *http.Request) int {
+	version, err := strconv.Atoi(r.FormValue("protocol"))
+	switch {
+	case err != nil || version < protocolWrapped:
+		return protocolWrapped
+	case version > latestProtocol:
+		return latestProtocol
+	}
+	return version
+}
+
+var wrappedPrefix = []byte(`{"event":"message","data":`)
+
+//format turns a published message (always wrapped) into what a client speaking protocol expects.
+func format(protocol int, message []byte) []byte {
+	if protocol == protocolWrapped {
+		return message
+	}
+	if bytes.HasPrefix(message, wrappedPrefix) && bytes.HasSuffix(message, []byte("}")) {
+		return message[len(wrappedPrefix) : len(message)-1]
+	}
+	var wrapped struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if json.Unmarshal(message, &wrapped) != nil || len(wrapped.Data) == 0 {
+		return message
+	}
+	return wrapped.Data
+}
+
+//eventSchemaHandler describes every type of event the realtime stream carries.
+func eventSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, events.Describe(), 200)
 }
 
 type action struct {
@@ -22,6 +74,7 @@ type action struct {
 	Form            string            `json:"form"`
 	Conversation    gp.ConversationID `json:"conversation"`
 	Typing          bool              `json:"typing"`
+	Since           map[string]int64  `json:"since"`
 }
 
 type wrappedAction struct {
@@ -36,7 +89,10 @@ var upgrader = websocket.Upgrader{
 }
 
 func wsHandler(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	protocol := wsProtocol(r)
+	header := make(http.Header)
+	header.Set("X-GP-Protocol", strconv.Itoa(protocol))
+	conn, err := upgrader.Upgrade(w, r, header)
 	if err != nil {
 		log.Println(err)
 		return
@@ -50,26 +106,52 @@ func wsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
+	c, err := api.Connections.Register(userID, "websocket", clientIP(r))
+	if err != nil {
+		go api.Statsd.Count(1, "gleepost.websockets.refused")
+		e := conn.WriteJSON(err)
+		if e != nil {
+			log.Println(e)
+		}
+		return
+	}
+	defer api.Connections.Unregister(c)
 	api.Statsd.Count(1, "gleepost.websockets.open")
-	chans := lib.ConversationChannelKeys([]gp.UserPresence{{User: gp.User{ID: userID}}})
-	chans = append(chans, lib.NotificationChannelKey(userID))
+	chans := defaultChannels(userID)
+	c.Subscribed(chans, true)
 	events := api.EventSubscribe(chans)
-	go wsReader(conn, events, userID)
+	go c.Pump(events.Messages)
+	resumes := make(chan map[string]int64)
+	done := make(chan struct{})
+	defer close(done)
+	go wsReader(r.Context(), conn, events, c, resumes, done)
+	sent := make(delivered)
 	heartbeat := time.Tick(30 * time.Second)
 	for {
 		select {
-		case message, ok := <-events.Messages:
+		case message, ok := <-c.Send():
 			if !ok {
 				log.Println("Message channel is closed...")
 				return
 			}
-			err := conn.WriteMessage(websocket.TextMessage, message)
+			if !sent.live(message) {
+				continue
+			}
+			err := conn.WriteMessage(websocket.TextMessage, format(protocol, message))
 			if err != nil {
 				if err != websocket.ErrCloseSent {
 					log.Println("Saw an error: ", err)
 				}
-				events.Commands <- gp.QueueCommand{Command: "UNSUBSCRIBE", Value: []string{}}
-				close(events.Commands)
+				unsubscribe(events)
+				return
+			}
+		case since := <-resumes:
+			err := resume(conn, protocol, sent, since)
+			if err != nil {
+				if err != websocket.ErrCloseSent {
+					log.Println("Saw an error resuming: ", err)
+				}
+				unsubscribe(events)
 				return
 			}
 		case <-heartbeat:
@@ -78,17 +160,176 @@ func wsHandler(w http.ResponseWriter, r *http.Request) {
 				if err != websocket.ErrCloseSent {
 					log.Println("Saw an error pinging: ", err)
 				}
-				events.Commands <- gp.QueueCommand{Command: "UNSUBSCRIBE", Value: []string{}}
-				close(events.Commands)
+				unsubscribe(events)
 				return
 			}
+		case <-c.Done():
+			//Either the client can't keep up, or we're shutting down; either way it should reconnect and resume.
+			go api.Statsd.Count(1, "gleepost.websockets.closed."+c.Reason())
+			code := websocket.CloseGoingAway
+			if c.Reason() == realtime.ReasonSlow {
+				code = websocket.ClosePolicyViolation
+			}
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, c.Reason()), time.Now().Add(1*time.Second))
+			unsubscribe(events)
+			return
+		}
+	}
+}
+
+//delivered tracks the sequence numbers a websocket has been sent on each channel, so that replaying missed events doesn't send any of them twice.
+//Publishers can race, so events don't always arrive in order: it keeps every gap, and only ever skips a number which really was sent.
+type delivered map[string]seqRanges
+
+//seqRange is every sequence number from first to last, inclusive.
+type seqRange struct {
+	first, last int64
+}
+
+//seqRanges is a sorted list of ranges which neither overlap nor touch. It only grows by one range for each gap, and shrinks again as gaps are filled.
+type seqRanges []seqRange
+
+func (rs seqRanges) contains(seq int64) bool {
+	for _, r := range rs {
+		if seq < r.first {
+			return false
+		}
+		if seq <= r.last {
+			return true
+		}
+	}
+	return false
+}
+
+//add returns rs with first..last added, merging any ranges it overlaps or touches.
+func (rs seqRanges) add(first, last int64) seqRanges {
+	merged := seqRange{first: first, last: last}
+	out := make(seqRanges, 0, len(rs)+1)
+	i := 0
+	for ; i < len(rs) && rs[i].last+1 < merged.first; i++ {
+		out = append(out, rs[i])
+	}
+	for ; i < len(rs) && rs[i].first <= merged.last+1; i++ {
+		if rs[i].first < merged.first {
+			merged.first = rs[i].first
+		}
+		if rs[i].last > merged.last {
+			merged.last = rs[i].last
+		}
+	}
+	out = append(out, merged)
+	return append(out, rs[i:]...)
+}
+
+func (d delivered) contains(channel string, seq int64) bool {
+	return d[channel].contains(seq)
+}
+
+func (d delivered) add(channel string, first, last int64) {
+	d[channel] = d[channel].add(first, last)
+}
+
+//live records a live event, returning false if it's already been sent.
+func (d delivered) live(message []byte) bool {
+	channel, seq := eventSeq(message)
+	if seq == 0 {
+		return true
+	}
+	if d.contains(channel, seq) {
+		return false
+	}
+	d.add(channel, seq, seq)
+	return true
+}
+
+func eventSeq(message []byte) (channel string, seq int64) {
+	var wrapped struct {
+		Data struct {
+			Channel string `json:"channel"`
+			Seq     int64  `json:"seq"`
+		} `json:"data"`
+	}
+	if json.Unmarshal(message, &wrapped) != nil {
+		return "", 0
+	}
+	return wrapped.Data.Channel, wrapped.Data.Seq
+}
+
+//resume sends the client the events it missed on each channel since the sequence number it last saw.
+func resume(conn *websocket.Conn, protocol int, sent delivered, since map[string]int64) error {
+	for _, message := range missed(sent, since) {
+		if err := conn.WriteMessage(websocket.TextMessage, format(protocol, message)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//missed returns the events a client missed on each channel since the sequence number it last saw, leaving out any it's been sent already.
+//If it's missed too many to replay, it gets a "resync" event for that channel instead, and has to refetch it.
+func missed(sent delivered, since map[string]int64) (messages [][]byte) {
+	for channel, last := range since {
+		history, latest, complete, err := api.EventsSince(channel, last)
+		if err != nil {
+			log.Println("Error getting missed events:", err)
+			continue
+		}
+		if !complete {
+			go api.Statsd.Count(1, "gleepost.realtime.resync")
+			sent.add(channel, 1, latest)
+			messages = append(messages, events.ResyncMessage(channel, latest))
+			continue
+		}
+		go api.Statsd.Count(len(history), "gleepost.realtime.replayed")
+		for _, message := range history {
+			_, seq := eventSeq(message)
+			if !sent.contains(channel, seq) {
+				messages = append(messages, message)
+			}
+		}
+		if latest > last {
+			sent.add(channel, last+1, latest)
 		}
 	}
+	return
+}
+
+//defaultChannels are the channels every realtime connection gets: this user's messages and notifications.
+func defaultChannels(userID gp.UserID) []string {
+	chans := lib.ConversationChannelKeys([]gp.UserPresence{{User: gp.User{ID: userID}}})
+	return append(chans, lib.NotificationChannelKey(userID))
 }
 
-func wsReader(ws *websocket.Conn, messages gp.MsgQueue, userID gp.UserID) {
-	var d wrappedAction
+//subscribable returns the channels for these posts and networks which userID is allowed to subscribe to.
+func subscribable(ctx context.Context, userID gp.UserID, posts []int, networks []int) (chans []string, err error) {
+	var postIDs []gp.PostID
+	for _, i := range posts {
+		postIDs = append(postIDs, gp.PostID(i))
+	}
+	if len(postIDs) > 0 {
+		postIDs, err = api.CanSubscribePosts(ctx, userID, postIDs)
+		if err != nil {
+			return
+		}
+	}
+	for _, i := range postIDs {
+		chans = append(chans, lib.PostChannel(i))
+	}
+	for _, i := range networks {
+		netID := gp.NetworkID(i)
+		in, err := api.UserInNetwork(ctx, userID, netID)
+		if in && err == nil {
+			chans = append(chans, lib.NetworkChannel(netID))
+		}
+	}
+	return chans, nil
+}
+
+//wsReader handles the actions a client sends over its websocket. A client can only resume channels it's subscribed to.
+func wsReader(ctx context.Context, ws *websocket.Conn, messages gp.MsgQueue, conn *realtime.Conn, resumes chan<- map[string]int64, done <-chan struct{}) {
+	userID := conn.User()
 	for {
+		var d wrappedAction
 		if ws == nil {
 			return
 		}
@@ -103,36 +344,34 @@ func wsReader(ws *websocket.Conn, messages gp.MsgQueue, userID gp.UserID) {
 		c := d.Data
 		switch {
 		case c.Action == "presence":
-			err := api.Presences.Broadcast(userID, c.Form)
+			err := api.Presences.Broadcast(ctx, userID, c.Form)
 			if err != nil {
 				log.Println("Error broadcasting presence:", err)
 			}
 		case c.Action == "typing":
-			api.UserIsTyping(userID, c.Conversation, c.Typing)
-		case c.Action == "SUBSCRIBE" || c.Action == "UNSUBSCRIBE":
-			var postChans []gp.PostID
-			for _, i := range c.PostChannels {
-				postChans = append(postChans, gp.PostID(i))
+			api.UserIsTyping(ctx, userID, c.Conversation, c.Typing)
+		case c.Action == "resume":
+			since := make(map[string]int64)
+			for channel, seq := range c.Since {
+				if conn.IsSubscribed(channel) {
+					since[channel] = seq
+				}
 			}
-			postChans, err = api.CanSubscribePosts(userID, postChans)
+			select {
+			case resumes <- since:
+			case <-done:
+				return
+			}
+		case c.Action == "SUBSCRIBE" || c.Action == "UNSUBSCRIBE":
+			chans, err := subscribable(ctx, userID, c.PostChannels, c.NetworkChannels)
 			if err != nil {
 				log.Println(err)
 				continue
 			}
-			var chans []string
-			for _, i := range postChans {
-				chans = append(chans, lib.PostChannel(i))
-			}
-			for _, i := range c.NetworkChannels {
-				netID := gp.NetworkID(i)
-				in, err := api.UserInNetwork(userID, netID)
-				if in && err == nil {
-					chans = append(chans, lib.NetworkChannel(netID))
-				}
-			}
 			if len(chans) > 0 {
 				messages.Commands <- gp.QueueCommand{Command: c.Action, Value: chans}
 			}
+			conn.Subscribed(chans, c.Action == "SUBSCRIBE")
 		default:
 		}
 	}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+func TestRefreshToken(t *testing.T) {
+	err := initDB()
+	if err != nil {
+		t.Fatalf("Error initializing db: %v\n", err)
+	}
+	err = truncate("tokens", "refresh_tokens")
+	if err != nil {
+		t.Fatalf("Error truncating tokens: %v\n", err)
+	}
+	once.Do(setup)
+
+	login, err := testingGetSession("patrick@fakestanford.edu", "TestingPass")
+	if err != nil {
+		t.Fatalf("Error logging in: %v\n", err)
+	}
+	if len(login.RefreshToken) == 0 {
+		t.Fatalf("Expected a refresh token, got none\n")
+	}
+
+	resp, err := refreshRequest(login.RefreshToken)
+	if err != nil {
+		t.Fatalf("Error refreshing: %v\n", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %v, got %v\n", http.StatusOK, resp.StatusCode)
+	}
+	var refreshed gp.Token
+	err = json.NewDecoder(resp.Body).Decode(&refreshed)
+	if err != nil {
+		t.Fatalf("Error parsing token: %v\n", err)
+	}
+	if refreshed.UserID != login.UserID || refreshed.Token == login.Token || refreshed.RefreshToken == login.RefreshToken {
+		t.Fatalf("Expected a new token for the same user, got %v\n", refreshed)
+	}
+
+	resp, err = sessionsRequest("GET", "profile/sessions", login)
+	if err != nil {
+		t.Fatalf("Error listing sessions: %v\n", err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Rotated access token: expected %v, got %v\n", http.StatusUnauthorized, resp.StatusCode)
+	}
+	resp, err = sessionsRequest("GET", "profile/sessions", refreshed)
+	if err != nil {
+		t.Fatalf("Error listing sessions: %v\n", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("New access token: expected %v, got %v\n", http.StatusOK, resp.StatusCode)
+	}
+
+	//Presenting the first refresh token again looks like theft, so the whole session goes.
+	resp, err = refreshRequest(login.RefreshToken)
+	if err != nil {
+		t.Fatalf("Error refreshing: %v\n", err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Reused refresh token: expected %v, got %v\n", http.StatusUnauthorized, resp.StatusCode)
+	}
+	resp, err = sessionsRequest("GET", "profile/sessions", refreshed)
+	if err != nil {
+		t.Fatalf("Error listing sessions: %v\n", err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Access token after reuse: expected %v, got %v\n", http.StatusUnauthorized, resp.StatusCode)
+	}
+	resp, err = refreshRequest(refreshed.RefreshToken)
+	if err != nil {
+		t.Fatalf("Error refreshing: %v\n", err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Refresh token after reuse: expected %v, got %v\n", http.StatusUnauthorized, resp.StatusCode)
+	}
+}
+
+func refreshRequest(refresh string) (resp *http.Response, err error) {
+	data := make(url.Values)
+	data["refresh_token"] = []string{refresh}
+	req, err := http.NewRequest("POST", baseURL+"token/refresh", strings.NewReader(data.Encode()))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Close = true
+	resp, err = client.Do(req)
+	return
+}
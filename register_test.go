@@ -70,7 +70,7 @@ func TestRegister(t *testing.T) {
 		Last:               "Beef",
 		ExpectedStatusCode: http.StatusBadRequest,
 		ExpectedReturnType: "Error",
-		ExpectedError:      "Password too weak!",
+		ExpectedError:      "Password must be at least 8 characters",
 	}
 	tests := []registrationTest{testGood, testNoEmail, testInvalidEmail, testExistingUser, testWeakPass}
 
@@ -16,7 +16,7 @@ func postReports(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	_postID, _ := strconv.ParseUint(r.FormValue("post"), 10, 64)
 	postID := gp.PostID(_postID)
 	reason := r.FormValue("reason")
-	err := api.ReportPost(userID, postID, reason)
+	err := api.ReportPost(r.Context(), userID, postID, reason)
 	if err != nil {
 		e, ok := err.(*gp.APIerror)
 		if ok && *e == lib.ENOTALLOWED {
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/gorilla/websocket"
+)
+
+func TestResume(t *testing.T) {
+	err := initDB()
+	if err != nil {
+		t.Fatal("Error initializing db:", err)
+	}
+	once.Do(setup)
+	token, err := testingGetSession("patrick@fakestanford.edu", "TestingPass")
+	if err != nil {
+		t.Fatal("Error getting session:", err)
+	}
+	createConversation(token)
+
+	ws, err := wsConnect(token)
+	if err != nil {
+		t.Fatal("Couldn't acquire wss connection:", err)
+	}
+	err = ws.WriteJSON(wrappedAction{Data: action{Action: "presence", Form: "desktop"}})
+	if err != nil {
+		t.Fatal("Error writing status to ws:", err)
+	}
+	first := gp.WrappedEvent{}
+	err = ws.ReadJSON(&first)
+	if err != nil {
+		t.Fatal("Couldn't read from websocket:", err)
+	}
+	if len(first.Data.Channel) == 0 || first.Data.Seq == 0 {
+		t.Fatal("Expected the event to be numbered, got:", first.Data)
+	}
+	ws.Close()
+
+	//Reconnect, having missed nothing but the event above.
+	ws, err = wsConnect(token)
+	if err != nil {
+		t.Fatal("Couldn't acquire wss connection:", err)
+	}
+	defer ws.Close()
+	since := map[string]int64{first.Data.Channel: first.Data.Seq - 1}
+	err = ws.WriteJSON(wrappedAction{Data: action{Action: "resume", Since: since}})
+	if err != nil {
+		t.Fatal("Error writing resume to ws:", err)
+	}
+	replayed := gp.WrappedEvent{}
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	err = ws.ReadJSON(&replayed)
+	if err != nil {
+		t.Fatal("Couldn't read from websocket:", err)
+	}
+	if replayed.Data.Type != "presence" || replayed.Data.Channel != first.Data.Channel || replayed.Data.Seq != first.Data.Seq {
+		t.Fatalf("Expected %v to be replayed, got %v\n", first.Data, replayed.Data)
+	}
+
+	//Claiming to have seen events which were never sent means we've lost track; the client must start again.
+	since = map[string]int64{first.Data.Channel: first.Data.Seq + 1000}
+	err = ws.WriteJSON(wrappedAction{Data: action{Action: "resume", Since: since}})
+	if err != nil {
+		t.Fatal("Error writing resume to ws:", err)
+	}
+	resync := gp.WrappedEvent{}
+	err = ws.ReadJSON(&resync)
+	if err != nil {
+		t.Fatal("Couldn't read from websocket:", err)
+	}
+	if resync.Data.Type != "resync" || resync.Data.Channel != first.Data.Channel {
+		t.Fatal("Expected a resync, got:", resync.Data)
+	}
+}
+
+func TestDeliveredOutOfOrder(t *testing.T) {
+	sent := make(delivered)
+	event := func(seq int64) []byte {
+		return []byte(fmt.Sprintf(`{"event":"message","data":{"channel":"c","seq":%d}}`, seq))
+	}
+	//Concurrent publishers can deliver 4, 6, 5: every one of them is new.
+	for _, seq := range []int64{4, 6, 5} {
+		if !sent.live(event(seq)) {
+			t.Fatalf("Event %d was dropped as a duplicate", seq)
+		}
+	}
+	if sent.live(event(5)) {
+		t.Fatal("Event 5 was sent twice")
+	}
+	sent.live(event(9))
+	if sent.contains("c", 3) || sent.contains("c", 7) || !sent.contains("c", 9) {
+		t.Fatalf("Expected 4-6 and 9 to be delivered, got %v", sent["c"])
+	}
+	//Replaying 7-8 fills the gap.
+	sent.add("c", 7, 8)
+	if len(sent["c"]) != 1 || sent["c"][0] != (seqRange{first: 4, last: 9}) {
+		t.Fatalf("Expected 4-9 to be delivered, got %v", sent["c"])
+	}
+}
+
+func wsConnect(token gp.Token) (ws *websocket.Conn, err error) {
+	header := make(http.Header)
+	header.Set("X-GP-Auth", fmt.Sprintf("%d-%s", token.UserID, token.Token))
+	ws, resp, err := websocket.DefaultDialer.Dial("ws"+baseURL[4:]+"ws", header)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		ws.Close()
+		return nil, fmt.Errorf("expected %d, got %d", http.StatusSwitchingProtocols, resp.StatusCode)
+	}
+	return
+}
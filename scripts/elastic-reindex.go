@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+
 	"github.com/Petergatsby/GleepostAPI/lib"
 	"github.com/Petergatsby/GleepostAPI/lib/conf"
 )
@@ -9,5 +11,5 @@ func main() {
 	config := conf.GetConfig()
 	api := lib.New(*config)
 
-	api.ElasticSearchBulkReindex()
+	api.ElasticSearchBulkReindex(context.Background())
 }
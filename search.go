@@ -18,7 +18,7 @@ func init() {
 func searchUsers(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	query := vars["query"]
-	users, err := api.UserSearchUsersInPrimaryNetwork(userID, query)
+	users, err := api.UserSearchUsersInPrimaryNetwork(r.Context(), userID, query)
 	if err != nil {
 		e, ok := err.(*gp.APIerror)
 		switch {
@@ -38,7 +38,7 @@ func searchGroups(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	query := vars["query"]
 	filter := r.FormValue("filter")
-	groups, err := api.UserSearchGroups(userID, query, filter)
+	groups, err := api.UserSearchGroups(r.Context(), userID, query, filter)
 	if err != nil {
 		jsonErr(w, err, 500)
 		return
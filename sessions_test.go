@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+func TestSessions(t *testing.T) {
+	err := initDB()
+	if err != nil {
+		t.Fatalf("Error initializing db: %v\n", err)
+	}
+	err = truncate("tokens")
+	if err != nil {
+		t.Fatalf("Error truncating tokens: %v\n", err)
+	}
+	once.Do(setup)
+
+	first, err := testingGetSession("patrick@fakestanford.edu", "TestingPass")
+	if err != nil {
+		t.Fatalf("Error logging in: %v\n", err)
+	}
+	second, err := testingGetSession("patrick@fakestanford.edu", "TestingPass")
+	if err != nil {
+		t.Fatalf("Error logging in: %v\n", err)
+	}
+
+	resp, err := sessionsRequest("GET", "profile/sessions", first)
+	if err != nil {
+		t.Fatalf("Error listing sessions: %v\n", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %v, got %v\n", http.StatusOK, resp.StatusCode)
+	}
+	var sessions []gp.Session
+	err = json.NewDecoder(resp.Body).Decode(&sessions)
+	if err != nil {
+		t.Fatalf("Error parsing sessions: %v\n", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("Expected 2 sessions, got %d\n", len(sessions))
+	}
+	var other gp.SessionID
+	for _, s := range sessions {
+		if !s.Current {
+			other = s.ID
+		}
+		if len(s.Scopes) != len(gp.AllScopes) {
+			t.Fatalf("Expected every scope, got %v\n", s.Scopes)
+		}
+	}
+	if other == 0 {
+		t.Fatalf("Expected exactly one session to be current: %v\n", sessions)
+	}
+
+	resp, err = sessionsRequest("DELETE", fmt.Sprintf("profile/sessions/%d", other), first)
+	if err != nil {
+		t.Fatalf("Error revoking session: %v\n", err)
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected %v, got %v\n", http.StatusNoContent, resp.StatusCode)
+	}
+	resp, err = sessionsRequest("GET", "profile/sessions", second)
+	if err != nil {
+		t.Fatalf("Error listing sessions: %v\n", err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Revoked token: expected %v, got %v\n", http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	resp, err = sessionsRequest("DELETE", fmt.Sprintf("profile/sessions/%d", other), first)
+	if err != nil {
+		t.Fatalf("Error revoking session: %v\n", err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected %v, got %v\n", http.StatusNotFound, resp.StatusCode)
+	}
+
+	resp, err = sessionsRequest("DELETE", "profile/sessions", first)
+	if err != nil {
+		t.Fatalf("Error logging out everywhere: %v\n", err)
+	}
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected %v, got %v\n", http.StatusNoContent, resp.StatusCode)
+	}
+	resp, err = sessionsRequest("GET", "profile/sessions", first)
+	if err != nil {
+		t.Fatalf("Error listing sessions: %v\n", err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Logged out token: expected %v, got %v\n", http.StatusUnauthorized, resp.StatusCode)
+	}
+}
+
+func sessionsRequest(method, path string, token gp.Token) (resp *http.Response, err error) {
+	data := make(url.Values)
+	data["id"] = []string{fmt.Sprintf("%d", token.UserID)}
+	data["token"] = []string{token.Token}
+	req, err := http.NewRequest(method, baseURL+path+"?"+data.Encode(), nil)
+	if err != nil {
+		return
+	}
+	req.Close = true
+	resp, err = client.Do(req)
+	return
+}
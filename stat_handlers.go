@@ -45,12 +45,12 @@ func postsStatsHandler(userID gp.UserID, w http.ResponseWriter, r *http.Request)
 	stat := lib.Stat(vars["type"])
 	var stats *lib.View
 	if stat == lib.OVERVIEW {
-		stats, err = api.AggregateStatsForUser(otherID, start, finish, bucket)
+		stats, err = api.AggregateStatsForUser(r.Context(), otherID, start, finish, bucket)
 	} else {
-		stats, err = api.AggregateStatsForUser(otherID, start, finish, bucket, stat)
+		stats, err = api.AggregateStatsForUser(r.Context(), otherID, start, finish, bucket, stat)
 	}
 	if err != nil {
-		jsonResponse(w, err, 500)
+		jsonErr(w, err, 500)
 		return
 	}
 	jsonResponse(w, stats, 200)
@@ -106,12 +106,12 @@ func individualPostStats(userID gp.UserID, w http.ResponseWriter, r *http.Reques
 	stat := lib.Stat(vars["type"])
 	var stats *lib.View
 	if stat == lib.OVERVIEW {
-		stats, err = api.AggregateStatsForPost(postID, start, finish, bucket)
+		stats, err = api.AggregateStatsForPost(r.Context(), postID, start, finish, bucket)
 	} else {
-		stats, err = api.AggregateStatsForPost(postID, start, finish, bucket, stat)
+		stats, err = api.AggregateStatsForPost(r.Context(), postID, start, finish, bucket, stat)
 	}
 	if err != nil {
-		jsonResponse(w, err, 500)
+		jsonErr(w, err, 500)
 		return
 	}
 	jsonResponse(w, stats, 200)
@@ -147,9 +147,9 @@ func usersOnlineHandler(userID gp.UserID, w http.ResponseWriter, r *http.Request
 		jsonResponse(w, err, 404)
 	}
 	netID := gp.NetworkID(_network)
-	total, students, staff, faculty, alumni, err := api.UsersOnline(netID, start, finish)
+	total, students, staff, faculty, alumni, err := api.UsersOnline(r.Context(), netID, start, finish)
 	if err != nil {
-		jsonResponse(w, err, 500)
+		jsonErr(w, err, 500)
 		return
 	}
 	jsonResponse(w, onlineStats{Total: total, Students: students, Staff: staff, Faculty: faculty, Alumni: alumni}, 200)
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/realtime"
+)
+
+func init() {
+	base.Handle("/stream", timeHandler(api, authenticated(streamHandler))).Methods("GET")
+	base.Handle("/stream", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/stream/poll", timeHandler(api, authenticated(pollHandler))).Methods("GET")
+	base.Handle("/stream/poll", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+}
+
+//EBADCURSOR means a Last-Event-ID or long-poll cursor isn't one we gave out.
+var EBADCURSOR = gp.APIerror{Reason: "Bad cursor", StatusCode: 400}
+
+const (
+	//maxPollWait is the longest a long-poll will wait for an event before returning empty-handed.
+	maxPollWait = 30 * time.Second
+	//pollGather is how long a long-poll waits for more events after the first, so that a burst comes back in one response.
+	pollGather = 50 * time.Millisecond
+)
+
+//cursor is how far through each channel a client has got, as Last-Event-ID or a long-poll cursor: "c:9=4182,n:9=77".
+type cursor map[string]int64
+
+//parseCursor returns EBADCURSOR if s isn't empty and isn't a cursor, rather than guess where the client meant to start.
+func parseCursor(s string) (c cursor, err error) {
+	c = make(cursor)
+	if len(s) == 0 {
+		return c, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		i := strings.LastIndex(part, "=")
+		if i < 1 {
+			return nil, EBADCURSOR
+		}
+		seq, err := strconv.ParseInt(part[i+1:], 10, 64)
+		if err != nil || seq < 0 {
+			return nil, EBADCURSOR
+		}
+		c[part[:i]] = seq
+	}
+	return c, nil
+}
+
+func (c cursor) String() string {
+	parts := make([]string, 0, len(c))
+	for channel, seq := range c {
+		parts = append(parts, fmt.Sprintf("%s=%d", channel, seq))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+//advance moves the cursor past this event.
+func (c cursor) advance(message []byte) {
+	channel, seq := eventSeq(message)
+	if seq > c[channel] {
+		c[channel] = seq
+	}
+}
+
+//since returns where to resume each of chans from: where the cursor says, or for channels it doesn't mention, from now.
+func (c cursor) since(chans []string) (since map[string]int64, err error) {
+	since = make(map[string]int64)
+	var unknown []string
+	for _, channel := range chans {
+		if seq, ok := c[channel]; ok {
+			since[channel] = seq
+		} else {
+			unknown = append(unknown, channel)
+		}
+	}
+	latest, err := api.LatestSeqs(unknown)
+	for channel, seq := range latest {
+		since[channel] = seq
+	}
+	return
+}
+
+//streamChannels returns the channels a stream or long-poll request gets: the user's own, plus any posts and networks they've asked for and are allowed to see.
+//The posts and networks parameters are the same as the websocket SUBSCRIBE action's, as comma-separated lists.
+func streamChannels(userID gp.UserID, r *http.Request) (chans []string, err error) {
+	extra, err := subscribable(r.Context(), userID, intList(r.FormValue("posts")), intList(r.FormValue("networks")))
+	if err != nil {
+		return
+	}
+	return append(defaultChannels(userID), extra...), nil
+}
+
+func intList(s string) (ints []int) {
+	for _, part := range strings.Split(s, ",") {
+		i, err := strconv.Atoi(strings.TrimSpace(part))
+		if err == nil {
+			ints = append(ints, i)
+		}
+	}
+	return
+}
+
+//unsubscribe stops events, draining anything still in flight so the receiver isn't left blocked.
+func unsubscribe(events gp.MsgQueue) {
+	events.Commands <- gp.QueueCommand{Command: "UNSUBSCRIBE", Value: []string{}}
+	close(events.Commands)
+	go func() {
+		for range events.Messages {
+		}
+	}()
+}
+
+//register records a stream or long-poll connection, or responds with why it can't have one.
+func register(w http.ResponseWriter, r *http.Request, userID gp.UserID, transport string) (c *realtime.Conn, ok bool) {
+	c, err := api.Connections.Register(userID, transport, clientIP(r))
+	switch {
+	case err == realtime.TooManyConnections:
+		jsonResponse(w, err, 429)
+	case err != nil:
+		jsonResponse(w, err, 503)
+	default:
+		return c, true
+	}
+	go api.Statsd.Count(1, "gleepost.stream.refused")
+	return nil, false
+}
+
+//streamHandler serves the same events as /ws, as text/event-stream, for clients which can't use websockets.
+//A client which reconnects with Last-Event-ID gets what it missed first, as with the websocket resume action.
+func streamHandler(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		jsonResponse(w, gp.APIerror{Reason: "Streaming unsupported"}, 500)
+		return
+	}
+	position, err := parseCursor(r.Header.Get("Last-Event-ID"))
+	if err != nil {
+		jsonResponse(w, err, 400)
+		return
+	}
+	chans, err := streamChannels(userID, r)
+	if err != nil {
+		jsonErr(w, err, 500)
+		return
+	}
+	c, ok := register(w, r, userID, "sse")
+	if !ok {
+		return
+	}
+	defer api.Connections.Unregister(c)
+	go api.Statsd.Count(1, "gleepost.stream.open")
+	c.Subscribed(chans, true)
+	events := api.EventSubscribe(chans)
+	defer unsubscribe(events)
+	go c.Pump(events.Messages)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(200)
+
+	since, err := position.since(chans)
+	if err != nil {
+		log.Println("Error getting stream position:", err)
+	}
+	sent := make(delivered)
+	for channel, seq := range since {
+		position[channel] = seq
+	}
+	write := func(message []byte) error {
+		position.advance(message)
+		_, err := fmt.Fprintf(w, "id: %s\ndata: %s\n\n", position, message)
+		return err
+	}
+	for _, message := range missed(sent, since) {
+		if write(message) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	closed := r.Context().Done()
+	heartbeat := time.Tick(30 * time.Second)
+	for {
+		select {
+		case message, ok := <-c.Send():
+			if !ok {
+				return
+			}
+			if !sent.live(message) {
+				continue
+			}
+			if write(message) != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-closed:
+			return
+		case <-c.Done():
+			go api.Statsd.Count(1, "gleepost.stream.closed."+c.Reason())
+			return
+		}
+	}
+}
+
+//pollHandler is a long-poll fallback for the realtime stream: it returns as soon as there are any events (or after timeout seconds, 25 by default),
+//along with a cursor to pass to the next poll so nothing is missed in between.
+func pollHandler(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	position, err := parseCursor(r.FormValue("cursor"))
+	if err != nil {
+		jsonResponse(w, err, 400)
+		return
+	}
+	chans, err := streamChannels(userID, r)
+	if err != nil {
+		jsonErr(w, err, 500)
+		return
+	}
+	wait := 25 * time.Second
+	if t, err := strconv.Atoi(r.FormValue("timeout")); err == nil && t >= 0 {
+		wait = time.Duration(t) * time.Second
+	}
+	if wait > maxPollWait {
+		wait = maxPollWait
+	}
+	c, ok := register(w, r, userID, "poll")
+	if !ok {
+		return
+	}
+	defer api.Connections.Unregister(c)
+	c.Subscribed(chans, true)
+	events := api.EventSubscribe(chans)
+	defer unsubscribe(events)
+	go c.Pump(events.Messages)
+	since, err := position.since(chans)
+	if err != nil {
+		jsonErr(w, err, 500)
+		return
+	}
+	sent := make(delivered)
+	for channel, seq := range since {
+		position[channel] = seq
+	}
+	batch := gp.EventBatch{Events: make([]json.RawMessage, 0)}
+	add := func(message []byte) {
+		position.advance(message)
+		batch.Events = append(batch.Events, json.RawMessage(message))
+	}
+	for _, message := range missed(sent, since) {
+		add(message)
+	}
+	timeout := time.After(wait)
+	closed := r.Context().Done()
+	for len(batch.Events) == 0 {
+		select {
+		case message, ok := <-c.Send():
+			if !ok {
+				jsonResponse(w, gp.APIerror{Reason: "Stream closed"}, 500)
+				return
+			}
+			if sent.live(message) {
+				add(message)
+			}
+		case <-timeout:
+			batch.Cursor = position.String()
+			jsonResponse(w, batch, 200)
+			return
+		case <-closed:
+			return
+		case <-c.Done():
+			//Hand back what we have; the client's cursor lets it pick up from here on its next poll.
+			batch.Cursor = position.String()
+			jsonResponse(w, batch, 200)
+			return
+		}
+	}
+	gather := time.After(pollGather)
+gathering:
+	for {
+		select {
+		case message, ok := <-c.Send():
+			if !ok {
+				break gathering
+			}
+			if sent.live(message) {
+				add(message)
+			}
+		case <-gather:
+			break gathering
+		case <-c.Done():
+			break gathering
+		}
+	}
+	go api.Statsd.Count(len(batch.Events), "gleepost.stream.poll.events")
+	batch.Cursor = position.String()
+	jsonResponse(w, batch, 200)
+}
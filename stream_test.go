@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+func TestLongPoll(t *testing.T) {
+	err := initDB()
+	if err != nil {
+		t.Fatal("Error initializing db:", err)
+	}
+	once.Do(setup)
+	token, err := testingGetSession("patrick@fakestanford.edu", "TestingPass")
+	if err != nil {
+		t.Fatal("Error getting session:", err)
+	}
+	createConversation(token)
+
+	batch, err := poll(token, "", 0)
+	if err != nil {
+		t.Fatal("Error polling:", err)
+	}
+	if len(batch.Cursor) == 0 {
+		t.Fatal("Expected a cursor")
+	}
+
+	//Something happens between polls...
+	ws, err := wsConnect(token)
+	if err != nil {
+		t.Fatal("Couldn't acquire wss connection:", err)
+	}
+	defer ws.Close()
+	err = ws.WriteJSON(wrappedAction{Data: action{Action: "presence", Form: "mobile"}})
+	if err != nil {
+		t.Fatal("Error writing status to ws:", err)
+	}
+	evt := gp.WrappedEvent{}
+	err = ws.ReadJSON(&evt)
+	if err != nil {
+		t.Fatal("Couldn't read from websocket:", err)
+	}
+
+	//...and the next poll picks it up.
+	next, err := poll(token, batch.Cursor, 5)
+	if err != nil {
+		t.Fatal("Error polling:", err)
+	}
+	if len(next.Events) == 0 {
+		t.Fatal("Expected the presence event, got nothing")
+	}
+	var got gp.WrappedEvent
+	err = json.Unmarshal(next.Events[0], &got)
+	if err != nil {
+		t.Fatal("Error parsing event:", err)
+	}
+	if got.Data.Type != "presence" || got.Data.Seq != evt.Data.Seq {
+		t.Fatalf("Expected %v, got %v\n", evt.Data, got.Data)
+	}
+	if next.Cursor == batch.Cursor {
+		t.Fatal("Expected the cursor to move on")
+	}
+}
+
+func TestParseCursor(t *testing.T) {
+	c, err := parseCursor("c:9=4182,n:9=77")
+	if err != nil || c["c:9"] != 4182 || c["n:9"] != 77 {
+		t.Fatalf("Expected c:9=4182,n:9=77, got %v (%v)", c, err)
+	}
+	if c, err = parseCursor(""); err != nil || len(c) != 0 {
+		t.Fatalf("Expected an empty cursor, got %v (%v)", c, err)
+	}
+	for _, bad := range []string{"c:9", "c:9=x", "=4", "c:9=4,", "c:9=-1"} {
+		if _, err = parseCursor(bad); err != EBADCURSOR {
+			t.Fatalf("%q: expected EBADCURSOR, got %v", bad, err)
+		}
+	}
+}
+
+func poll(token gp.Token, cursor string, timeout int) (batch gp.EventBatch, err error) {
+	data := make(url.Values)
+	data["id"] = []string{fmt.Sprintf("%d", token.UserID)}
+	data["token"] = []string{token.Token}
+	data["cursor"] = []string{cursor}
+	data["timeout"] = []string{fmt.Sprintf("%d", timeout)}
+	resp, err := client.Get(baseURL + "stream/poll?" + data.Encode())
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return batch, fmt.Errorf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&batch)
+	return
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestWrappedDeadline(t *testing.T) {
+	wrapped := []error{
+		fmt.Errorf("query failed: %w", context.DeadlineExceeded),
+		&url.Error{Op: "Get", URL: "http://localhost:9200/gleepost/_search", Err: context.DeadlineExceeded},
+	}
+	for _, err := range wrapped {
+		w := httptest.NewRecorder()
+		jsonErr(w, err, 500)
+		if w.Code != 504 {
+			t.Fatalf("%v: expected 504, got %d", err, w.Code)
+		}
+	}
+}
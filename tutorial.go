@@ -20,7 +20,7 @@ func init() {
 
 func postProfileTutorialState(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	ts := strings.Split(r.FormValue("tutorial_state"), ",")
-	err := api.SetTutorialState(userID, ts...)
+	err := api.SetTutorialState(r.Context(), userID, ts...)
 	if err != nil {
 		jsonErr(w, err, 500)
 		return
@@ -31,7 +31,7 @@ func postProfileTutorialState(userID gp.UserID, w http.ResponseWriter, r *http.R
 
 func greetMe(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	n, _ := strconv.ParseInt(r.FormValue("preset"), 10, 64)
-	err := api.GreetMe(userID, int(n))
+	err := api.GreetMe(r.Context(), userID, int(n))
 	switch {
 	case err == lib.ErrInvalidPreset:
 		jsonErr(w, err, 400)
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/Petergatsby/GleepostAPI/lib"
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+)
+
+func init() {
+	base.Handle("/login/2fa", timeHandler(api, http.HandlerFunc(twoFactorLoginHandler))).Methods("POST")
+	base.Handle("/login/2fa", timeHandler(api, http.HandlerFunc(optionsHandler))).Methods("OPTIONS")
+	base.Handle("/login/2fa", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/profile/2fa", timeHandler(api, authenticated(getTwoFactor))).Methods("GET")
+	base.Handle("/profile/2fa", timeHandler(api, authenticated(postTwoFactor))).Methods("POST")
+	base.Handle("/profile/2fa", timeHandler(api, authenticated(deleteTwoFactor))).Methods("DELETE")
+	base.Handle("/profile/2fa", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/profile/2fa/confirm", timeHandler(api, authenticated(postTwoFactorConfirm))).Methods("POST")
+	base.Handle("/profile/2fa/confirm", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/profile/2fa/recovery_codes", timeHandler(api, authenticated(postRecoveryCodes))).Methods("POST")
+	base.Handle("/profile/2fa/recovery_codes", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+	base.Handle("/approve/2fa", timeHandler(api, authenticated(getTwoFactorRequirement))).Methods("GET")
+	base.Handle("/approve/2fa", timeHandler(api, authenticated(postTwoFactorRequirement))).Methods("POST")
+	base.Handle("/approve/2fa", timeHandler(api, http.HandlerFunc(unsupportedHandler)))
+}
+
+//twoFactorLoginHandler is the second step of logging in, for users with two-factor authentication: it swaps the challenge from /login and a code for a token.
+func twoFactorLoginHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := api.CompleteLogin(r.Context(), r.FormValue("challenge"), r.FormValue("code"), r.FormValue("recovery_code"))
+	switch {
+	case tooManyAttempts(w, err):
+		go api.Statsd.Count(1, "gleepost.auth.login.2fa.429")
+	case err == lib.BadChallenge || err == lib.BadTwoFactorCode || err == lib.TwoFactorNotEnrolled:
+		go api.Statsd.Count(1, "gleepost.auth.login.2fa.400")
+		jsonResponse(w, err, 400)
+	case err != nil:
+		go api.Statsd.Count(1, "gleepost.auth.login.2fa.500")
+		jsonErr(w, err, 500)
+	default:
+		go api.Statsd.Count(1, "gleepost.auth.login.2fa.200")
+		jsonResponse(w, token, 200)
+	}
+}
+
+func getTwoFactor(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	status, err := api.TwoFactorStatus(r.Context(), userID)
+	if err != nil {
+		jsonErr(w, err, 500)
+		return
+	}
+	jsonResponse(w, status, 200)
+}
+
+//postTwoFactor starts enrolment, returning a secret and an otpauth:// URI for the user's authenticator app.
+func postTwoFactor(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	enrolment, err := api.BeginTwoFactor(r.Context(), userID)
+	switch {
+	case err == lib.TwoFactorAlreadyEnabled:
+		jsonResponse(w, err, 409)
+	case err != nil:
+		jsonErr(w, err, 500)
+	default:
+		jsonResponse(w, enrolment, 201)
+	}
+}
+
+func postTwoFactorConfirm(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	_, token := credentials(r)
+	codes, err := api.ConfirmTwoFactor(r.Context(), userID, token, r.FormValue("code"))
+	switch {
+	case tooManyAttempts(w, err):
+	case err == lib.BadTwoFactorCode || err == lib.TwoFactorNotEnrolled:
+		jsonResponse(w, err, 400)
+	case err == lib.TwoFactorAlreadyEnabled:
+		jsonResponse(w, err, 409)
+	case err != nil:
+		jsonErr(w, err, 500)
+	default:
+		jsonResponse(w, codes, 200)
+	}
+}
+
+func deleteTwoFactor(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	err := api.DisableTwoFactor(r.Context(), userID, r.FormValue("code"), r.FormValue("recovery_code"))
+	switch {
+	case tooManyAttempts(w, err):
+	case err == lib.BadTwoFactorCode || err == lib.TwoFactorNotEnrolled:
+		jsonResponse(w, err, 400)
+	case err == lib.CantDisableTwoFactor:
+		jsonResponse(w, err, 403)
+	case err != nil:
+		jsonErr(w, err, 500)
+	default:
+		w.WriteHeader(204)
+	}
+}
+
+func postRecoveryCodes(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	codes, err := api.RegenerateRecoveryCodes(r.Context(), userID, r.FormValue("code"))
+	switch {
+	case tooManyAttempts(w, err):
+	case err == lib.BadTwoFactorCode || err == lib.TwoFactorNotEnrolled:
+		jsonResponse(w, err, 400)
+	case err != nil:
+		jsonErr(w, err, 500)
+	default:
+		jsonResponse(w, codes, 200)
+	}
+}
+
+func getTwoFactorRequirement(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	req, err := api.TwoFactorRequirement(r.Context(), userID)
+	if err != nil {
+		jsonErr(w, err, 500)
+		return
+	}
+	jsonResponse(w, req, 200)
+}
+
+func postTwoFactorRequirement(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
+	required := r.FormValue("required") == "true"
+	err := api.SetTwoFactorRequirement(r.Context(), userID, required)
+	switch {
+	case err == nil:
+		jsonResponse(w, gp.TwoFactorRequirement{Required: required}, 200)
+	case err == &lib.ENOTALLOWED || err == lib.TwoFactorEnrolmentRequired:
+		jsonErr(w, err, 403)
+	default:
+		jsonErr(w, err, 500)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Petergatsby/GleepostAPI/lib/gp"
+	"github.com/Petergatsby/GleepostAPI/lib/totp"
+)
+
+func TestTwoFactor(t *testing.T) {
+	err := initDB()
+	if err != nil {
+		t.Fatalf("Error initializing db: %v\n", err)
+	}
+	err = truncate("tokens", "two_factor", "two_factor_recovery")
+	if err != nil {
+		t.Fatalf("Error truncating: %v\n", err)
+	}
+	defer truncate("two_factor", "two_factor_recovery")
+	once.Do(setup)
+
+	session, err := testingGetSession("patrick@fakestanford.edu", "TestingPass")
+	if err != nil {
+		t.Fatalf("Error logging in: %v\n", err)
+	}
+
+	resp, err := twoFactorRequest("POST", "profile/2fa", session, nil)
+	if err != nil {
+		t.Fatalf("Error enrolling: %v\n", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected %v, got %v\n", http.StatusCreated, resp.StatusCode)
+	}
+	var enrolment gp.TwoFactorEnrolment
+	err = json.NewDecoder(resp.Body).Decode(&enrolment)
+	if err != nil {
+		t.Fatalf("Error parsing enrolment: %v\n", err)
+	}
+	if !strings.HasPrefix(enrolment.URI, "otpauth://totp/") {
+		t.Fatalf("Expected an otpauth URI, got %s\n", enrolment.URI)
+	}
+
+	code, err := totp.Code(enrolment.Secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatalf("Error generating code: %v\n", err)
+	}
+	resp, err = twoFactorRequest("POST", "profile/2fa/confirm", session, url.Values{"code": {code}})
+	if err != nil {
+		t.Fatalf("Error confirming: %v\n", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %v, got %v\n", http.StatusOK, resp.StatusCode)
+	}
+	var recovery gp.RecoveryCodes
+	err = json.NewDecoder(resp.Body).Decode(&recovery)
+	if err != nil {
+		t.Fatalf("Error parsing recovery codes: %v\n", err)
+	}
+	if len(recovery.Codes) != 10 {
+		t.Fatalf("Expected 10 recovery codes, got %d\n", len(recovery.Codes))
+	}
+
+	resp, err = loginRequest("patrick@fakestanford.edu", "TestingPass")
+	if err != nil {
+		t.Fatalf("Error logging in: %v\n", err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected %v, got %v\n", http.StatusForbidden, resp.StatusCode)
+	}
+	var status gp.Status
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	if err != nil {
+		t.Fatalf("Error parsing status: %v\n", err)
+	}
+	if status.Status != "2fa_required" || len(status.Challenge) == 0 {
+		t.Fatalf("Expected a 2fa challenge, got %v\n", status)
+	}
+
+	resp, err = twoFactorLoginRequest(status.Challenge, "not-a-code")
+	if err != nil {
+		t.Fatalf("Error completing login: %v\n", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Bad recovery code: expected %v, got %v\n", http.StatusBadRequest, resp.StatusCode)
+	}
+	resp, err = twoFactorLoginRequest(status.Challenge, recovery.Codes[0])
+	if err != nil {
+		t.Fatalf("Error completing login: %v\n", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %v, got %v\n", http.StatusOK, resp.StatusCode)
+	}
+	resp, err = twoFactorLoginRequest(status.Challenge, recovery.Codes[1])
+	if err != nil {
+		t.Fatalf("Error completing login: %v\n", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Reused challenge: expected %v, got %v\n", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func twoFactorRequest(method, path string, token gp.Token, data url.Values) (resp *http.Response, err error) {
+	if data == nil {
+		data = make(url.Values)
+	}
+	data["id"] = []string{fmt.Sprintf("%d", token.UserID)}
+	data["token"] = []string{token.Token}
+	var req *http.Request
+	switch method {
+	case "POST", "PUT", "PATCH":
+		req, err = http.NewRequest(method, baseURL+path, strings.NewReader(data.Encode()))
+		if err != nil {
+			return
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	default:
+		//The server only parses a form body for POST, PUT and PATCH.
+		req, err = http.NewRequest(method, baseURL+path+"?"+data.Encode(), nil)
+		if err != nil {
+			return
+		}
+	}
+	req.Close = true
+	resp, err = client.Do(req)
+	return
+}
+
+func twoFactorLoginRequest(challenge, recoveryCode string) (resp *http.Response, err error) {
+	data := make(url.Values)
+	data["challenge"] = []string{challenge}
+	data["recovery_code"] = []string{recoveryCode}
+	req, err := http.NewRequest("POST", baseURL+"login/2fa", strings.NewReader(data.Encode()))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Close = true
+	resp, err = client.Do(req)
+	return
+}
@@ -40,7 +40,7 @@ func postVideoUpload(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 	log.Println("About to enqueue the video for processing...")
-	videoStatus, err := api.EnqueueVideo(userID, file, header, shouldRotate)
+	videoStatus, err := api.EnqueueVideo(r.Context(), userID, file, header, shouldRotate)
 	if err != nil {
 		jsonErr(w, err, 400)
 	} else {
@@ -55,7 +55,7 @@ func getVideos(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 		_id = 0
 	}
 	videoID := gp.VideoID(_id)
-	upload, err := api.GetUploadStatus(userID, videoID)
+	upload, err := api.GetUploadStatus(r.Context(), userID, videoID)
 	if err != nil {
 		jsonErr(w, err, 500)
 		return
@@ -70,7 +70,7 @@ func getUpload(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 		_id = 0
 	}
 	videoID := gp.VideoID(_id)
-	upload, err := api.GetUploadStatus(userID, videoID)
+	upload, err := api.GetUploadStatus(r.Context(), userID, videoID)
 	if err != nil {
 		jsonErr(w, err, 500)
 		return
@@ -88,7 +88,7 @@ func uploadHandler(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	defer file.Close()
-	url, err := api.StoreFile(userID, file, header)
+	url, err := api.StoreFile(r.Context(), userID, file, header)
 	if err != nil {
 		jsonErr(w, err, 400)
 	} else {
@@ -119,7 +119,7 @@ func ngflowUpload(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		if filePath != "" {
-			url, err := api.StoreFilePath(userID, filePath)
+			url, err := api.StoreFilePath(r.Context(), userID, filePath)
 			if err != nil {
 				jsonErr(w, err, 400)
 			}
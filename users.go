@@ -49,7 +49,7 @@ func getUser(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	_otherID, _ := strconv.ParseUint(vars["id"], 10, 64)
 	otherID := gp.UserID(_otherID)
-	user, err := api.UserGetProfile(userID, otherID)
+	user, err := api.UserGetProfile(r.Context(), userID, otherID)
 	if err != nil {
 		switch {
 		case err == gp.ENOSUCHUSER:
@@ -69,7 +69,7 @@ func getUserPosts(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	_id, _ := strconv.ParseUint(vars["id"], 10, 64)
 	otherID := gp.UserID(_id)
 	mode, index := interpretPagination(r)
-	posts, err := api.GetUserPosts(otherID, userID, mode, index, api.Config.PostPageSize, r.FormValue("filter"))
+	posts, err := api.GetUserPosts(r.Context(), otherID, userID, mode, index, api.Config.PostPageSize, r.FormValue("filter"))
 	if err != nil {
 		jsonErr(w, err, 500)
 		return
@@ -86,7 +86,7 @@ Profile stuff
 func changeNameHandler(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	firstName := r.FormValue("first")
 	lastName := r.FormValue("last")
-	err := api.UserSetName(userID, firstName, lastName)
+	err := api.UserSetName(r.Context(), userID, firstName, lastName)
 	if err != nil {
 		jsonResponse(w, &EBADINPUT, 400)
 		return
@@ -102,14 +102,14 @@ func busyHandler(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			jsonResponse(w, gp.APIerror{Reason: "Bad input"}, 400)
 		}
-		err = api.SetBusyStatus(userID, status)
+		err = api.SetBusyStatus(r.Context(), userID, status)
 		if err != nil {
 			jsonErr(w, err, 500)
 		} else {
 			jsonResponse(w, &gp.BusyStatus{Busy: status}, 200)
 		}
 	case r.Method == "GET":
-		status, err := api.BusyStatus(userID)
+		status, err := api.BusyStatus(r.Context(), userID)
 		if err != nil {
 			jsonErr(w, err, 500)
 			return
@@ -120,14 +120,14 @@ func busyHandler(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 
 func profileImageHandler(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 	url := r.FormValue("url")
-	err := api.UserSetProfileImage(userID, url)
+	err := api.UserSetProfileImage(r.Context(), userID, url)
 	switch {
 	case err == lib.NoSuchUpload:
 		jsonResponse(w, err, 400)
 	case err != nil:
 		jsonErr(w, err, 500)
 	default:
-		user, err := api.UserGetProfile(userID, userID)
+		user, err := api.UserGetProfile(r.Context(), userID, userID)
 		if err != nil {
 			jsonErr(w, err, 500)
 		}
@@ -141,7 +141,7 @@ func getUserAttending(userID gp.UserID, w http.ResponseWriter, r *http.Request)
 	otherID := gp.UserID(_id)
 	category := r.FormValue("filter")
 	mode, index := interpretPagination(r)
-	events, err := api.UserEvents(userID, otherID, category, mode, index, 20)
+	events, err := api.UserEvents(r.Context(), userID, otherID, category, mode, index, 20)
 	if err != nil {
 		jsonResponse(w, err, 500)
 		return
@@ -150,7 +150,7 @@ func getUserAttending(userID gp.UserID, w http.ResponseWriter, r *http.Request)
 }
 
 func userAttending(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
-	events, err := api.UserAttends(userID)
+	events, err := api.UserAttends(r.Context(), userID)
 	if err != nil {
 		jsonResponse(w, err, 500)
 	}
@@ -158,7 +158,7 @@ func userAttending(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
 }
 
 func postProfileTagline(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
-	err := api.UserChangeTagline(userID, r.FormValue("tagline"))
+	err := api.UserChangeTagline(r.Context(), userID, r.FormValue("tagline"))
 	if err != nil {
 		jsonErr(w, err, 500)
 		return
@@ -168,7 +168,7 @@ func postProfileTagline(userID gp.UserID, w http.ResponseWriter, r *http.Request
 }
 
 func pendingPosts(userID gp.UserID, w http.ResponseWriter, r *http.Request) {
-	pending, err := api.PendingPosts(userID)
+	pending, err := api.PendingPosts(r.Context(), userID)
 	if err != nil {
 		jsonErr(w, err, 500)
 		return